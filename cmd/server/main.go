@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
@@ -12,7 +13,9 @@ import (
 	"eino-rag/internal/config"
 	"eino-rag/internal/db"
 	"eino-rag/internal/handlers"
+	"eino-rag/internal/jobs"
 	"eino-rag/internal/middleware"
+	"eino-rag/internal/routes"
 	"eino-rag/internal/services/chat"
 	"eino-rag/internal/services/document"
 	"eino-rag/internal/services/rag"
@@ -42,7 +45,7 @@ import (
 // @securityDefinitions.apikey ApiKeyAuth
 // @in header
 // @name Authorization
-// @description Bearer token authentication
+// @description Bearer token authentication. Programmatic clients can send an API key in the X-API-Key header instead
 
 func main() {
 	// 加载配置
@@ -72,17 +75,23 @@ func main() {
 	}
 	defer db.CloseRedis()
 
-	// 初始化服务
-	embeddingService := rag.NewEmbeddingService(cfg, log)
+	// 初始化服务，按 EMBEDDING_PROVIDER 选择嵌入服务
+	embeddingService, err := rag.NewEmbedder(cfg, log)
+	if err != nil {
+		log.Fatal("Invalid embedding configuration", zap.Error(err))
+	}
 
 	var retriever *rag.MilvusRetriever
-	var err error
 	retriever, err = rag.NewMilvusRetriever(cfg, embeddingService, log)
+	if errors.Is(err, rag.ErrInvalidMetricType) {
+		// 配置错误不能靠重连恢复
+		log.Fatal("Invalid Milvus configuration", zap.Error(err))
+	}
 	if err != nil {
 		// 记录错误但不退出，允许应用继续运行
 		log.Warn("Failed to create retriever, vector search features will be unavailable",
 			zap.Error(err),
-			zap.String("milvus_address", cfg.MilvusAddress))
+			zap.String("milvus_address", config.RedactURL(cfg.MilvusAddress)))
 		// 设置 retriever 为 nil，后续代码需要检查
 		retriever = nil
 	} else {
@@ -92,21 +101,53 @@ func main() {
 	// 初始化文档服务
 	docParser := document.NewDocumentParser(log)
 	docProcessor := document.NewDocumentProcessor(cfg, log)
-	docService := document.NewService(docParser, docProcessor, retriever, cfg, log)
+	docSummarizer := document.NewSummarizer(cfg, log)
+	// 直接传入nil指针会得到非nil的接口值，导致服务误以为向量库可用
+	var docRetriever rag.Retriever
+	if retriever != nil {
+		docRetriever = retriever
+	}
+	docService := document.NewService(docParser, docProcessor, docRetriever, docSummarizer, cfg, log)
+
+	// 导入示例数据（仅在配置了 SEED_PATH 且数据库为空时）
+	if cfg.SeedPath != "" {
+		if _, err := docService.SeedIfEmpty(context.Background(), cfg.SeedPath, cfg.SeedKBName); err != nil {
+			log.Warn("Failed to seed sample documents", zap.Error(err))
+		}
+	}
+
+	// SQL 与向量库的一致性检查（需要向量库）
+	var reconciler *document.Reconciler
+	if retriever != nil {
+		reconciler = document.NewReconciler(docService, retriever, cfg, log)
+		reconcileCtx, stopReconciler := context.WithCancel(context.Background())
+		defer stopReconciler()
+		reconciler.Start(reconcileCtx)
+	}
+
+	// 按知识库保留期限清理文档
+	retentionSweeper := document.NewRetentionSweeper(docService, cfg, log)
+	retentionCtx, stopRetention := context.WithCancel(context.Background())
+	defer stopRetention()
+	retentionSweeper.Start(retentionCtx)
 
 	// 初始化聊天服务
-	chatService, err := chat.NewService(docService, cfg, log)
+	chatService, err := chat.NewService(docService, embeddingService, cfg, log)
 	if err != nil {
 		log.Fatal("Failed to create chat service", zap.Error(err))
 	}
 
 	// 初始化处理器
+	jobManager := jobs.NewManager(log)
 	authHandler := handlers.NewAuthHandler(log)
-	docHandler := handlers.NewDocumentHandler(docService, log)
+	docHandler := handlers.NewDocumentHandler(docService, jobManager, log)
 	chatHandler := handlers.NewChatHandler(chatService, log)
-	kbHandler := handlers.NewKnowledgeBaseHandler(retriever, log)
-	sysHandler := handlers.NewSystemHandler(cfg, log)
+	kbHandler := handlers.NewKnowledgeBaseHandler(retriever, docService, cfg, log)
+	sysHandler := handlers.NewSystemHandler(cfg, jobManager, retriever, log)
 	userHandler := handlers.NewUserHandler(log)
+	consistencyHandler := handlers.NewConsistencyHandler(reconciler, log)
+	retentionHandler := handlers.NewRetentionHandler(retentionSweeper, log)
+	embeddingHandler := handlers.NewEmbeddingHandler(embeddingService, log)
 
 	// 设置Gin
 	gin.SetMode(cfg.GinMode)
@@ -116,6 +157,7 @@ func main() {
 	router.Use(gin.Recovery())
 	router.Use(middleware.Logger(log))
 	router.Use(middleware.CORS())
+	router.Use(middleware.Compression())
 
 	// 静态文件
 	router.Static("/static", "./web/static")
@@ -125,84 +167,17 @@ func main() {
 	setupFrontendRoutes(router)
 
 	// API路由
-	api := router.Group("/api")
-	{
-		// 健康检查
-		api.GET("/health", sysHandler.Health)
-
-		// 认证路由
-		auth := api.Group("/auth")
-		{
-			auth.POST("/register", authHandler.Register)
-			auth.POST("/login", authHandler.Login)
-
-			// 需要认证的路由
-			authRequired := auth.Group("")
-			authRequired.Use(middleware.AuthMiddleware())
-			{
-				authRequired.POST("/logout", authHandler.Logout)
-				authRequired.GET("/profile", authHandler.GetProfile)
-				authRequired.POST("/refresh", authHandler.RefreshToken)
-			}
-		}
-
-		// 需要认证的API路由
-		authorized := api.Group("")
-		authorized.Use(middleware.AuthMiddleware())
-		{
-			// 知识库管理
-			kb := authorized.Group("/knowledge-bases")
-			{
-				kb.POST("", kbHandler.Create)
-				kb.GET("", kbHandler.List)
-				kb.GET("/:id", kbHandler.Get)
-				kb.PUT("/:id", kbHandler.Update)
-				kb.DELETE("/:id", kbHandler.Delete)
-				kb.GET("/:id/documents", docHandler.List)
-			}
-
-			// 文档管理
-			docs := authorized.Group("/documents")
-			{
-				docs.GET("", docHandler.ListAll) // 获取所有文档
-				docs.POST("/upload", docHandler.Upload)
-				docs.POST("/search", docHandler.Search)
-				docs.DELETE("/:id", docHandler.Delete)
-			}
-
-			// 聊天功能
-			chat := authorized.Group("/chat")
-			{
-				chat.POST("", chatHandler.Chat)
-				chat.POST("/stream", chatHandler.ChatStream)
-				chat.GET("/conversations", chatHandler.ListConversations)
-				chat.GET("/conversations/:id", chatHandler.GetConversation)
-			}
-
-			// 系统管理（需要管理员权限）
-			system := authorized.Group("/system")
-			system.Use(middleware.RequireRole("admin"))
-			{
-				system.GET("/config", sysHandler.GetConfig)
-				system.PUT("/config", sysHandler.UpdateConfig)
-			}
-
-			// 系统统计（所有登录用户可访问）
-			authorized.GET("/system/stats", sysHandler.GetStats)
-
-			// 用户管理（需要管理员权限）
-			users := authorized.Group("/users")
-			users.Use(middleware.RequireRole("admin"))
-			{
-				users.GET("", userHandler.ListUsers)
-				users.GET("/:id", userHandler.GetUser)
-				users.POST("", userHandler.CreateUser)
-				users.PUT("/:id", userHandler.UpdateUser)
-				users.DELETE("/:id", userHandler.DeleteUser)
-				users.PUT("/:id/status", userHandler.UpdateUserStatus)
-			}
-		}
-	}
+	routes.RegisterAPI(router, routes.Handlers{
+		Auth:          authHandler,
+		Document:      docHandler,
+		Chat:          chatHandler,
+		KnowledgeBase: kbHandler,
+		System:        sysHandler,
+		User:          userHandler,
+		Consistency:   consistencyHandler,
+		Retention:     retentionHandler,
+		Embedding:     embeddingHandler,
+	})
 
 	// Swagger文档
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
@@ -315,7 +290,7 @@ func setupFrontendRoutes(router *gin.Engine) {
 func loadConfigFromDB(cfg *config.Config, log *zap.Logger) {
 	// 先打印从环境变量加载的配置
 	log.Info("Configuration loaded from environment",
-		zap.String("milvus_address", cfg.MilvusAddress),
+		zap.String("milvus_address", config.RedactURL(cfg.MilvusAddress)),
 		zap.String("ollama_url", cfg.OllamaBaseURL),
 		zap.String("embedding_model", cfg.EmbeddingModel))
 
@@ -346,10 +321,10 @@ func loadConfigFromDB(cfg *config.Config, log *zap.Logger) {
 
 			// 记录哪些配置将被覆盖
 			switch c.Key {
-			case "milvus_address", "ollama_url", "embedding_model", "openai_api_key", "allowed_file_types":
+			case "milvus_address", "milvus_username", "milvus_password", "milvus_token", "ollama_url", "embedding_model", "vector_dim", "openai_api_key", "allowed_file_types":
 				log.Info("Overriding config from database",
 					zap.String("key", c.Key),
-					zap.String("value", c.Value))
+					zap.String("value", config.RedactValue(c.Key, c.Value)))
 				overrideCount++
 			}
 		}
@@ -364,7 +339,7 @@ func loadConfigFromDB(cfg *config.Config, log *zap.Logger) {
 
 		// 打印更新后的配置
 		log.Info("Final configuration",
-			zap.String("milvus_address", cfg.MilvusAddress),
+			zap.String("milvus_address", config.RedactURL(cfg.MilvusAddress)),
 			zap.String("ollama_url", cfg.OllamaBaseURL))
 	} else {
 		log.Info("No configuration overrides from database, using environment values")
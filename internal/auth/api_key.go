@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// API密钥
+//
+// 用户可以为脚本和集成创建长期有效的API密钥，请求时通过 X-API-Key 头代替 Bearer token。
+// 密钥解析为所属用户及其角色，权限检查与 token 登录时相同。数据库只保存密钥的SHA-256哈希，
+// 明文只在创建时返回一次；撤销后的密钥和被禁用用户的密钥立即失效。
+
+const (
+	// apiKeyPrefix 密钥前缀，便于识别和扫描泄露的密钥
+	apiKeyPrefix = "erk_"
+	// apiKeyRandomBytes 密钥随机部分的字节数
+	apiKeyRandomBytes = 32
+	// apiKeyDisplayLength 列表中展示的密钥开头长度
+	apiKeyDisplayLength = 12
+	// apiKeyTouchInterval 最后使用时间的更新间隔，间隔内的请求不再写数据库
+	apiKeyTouchInterval = time.Minute
+)
+
+var (
+	// ErrInvalidAPIKey 密钥不存在、已撤销或所属用户不可用
+	ErrInvalidAPIKey = errors.New("invalid or revoked API key")
+	// ErrAPIKeyNotFound 要撤销的密钥不存在或不属于当前用户
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+// HashAPIKey 计算密钥的SHA-256哈希（十六进制）
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey 为用户生成新的API密钥，返回保存的记录和明文密钥
+func CreateAPIKey(userID uint, name string) (*models.APIKey, string, error) {
+	random := make([]byte, apiKeyRandomBytes)
+	if _, err := rand.Read(random); err != nil {
+		return nil, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	key := apiKeyPrefix + hex.EncodeToString(random)
+
+	apiKey := &models.APIKey{
+		UserID:  userID,
+		Name:    strings.TrimSpace(name),
+		KeyHash: HashAPIKey(key),
+		Prefix:  key[:apiKeyDisplayLength],
+	}
+	if err := db.GetDB().Create(apiKey).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to create API key: %w", err)
+	}
+	return apiKey, key, nil
+}
+
+// ListAPIKeys 列出用户的API密钥，包括已撤销的，按创建时间倒序
+func ListAPIKeys(userID uint) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	if err := db.GetDB().Where("user_id = ?", userID).Order("created_at DESC, id DESC").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey 撤销用户自己的API密钥，记录保留以便在列表中查看
+func RevokeAPIKey(userID, id uint) error {
+	result := db.GetDB().Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ?", id, userID).
+		Update("revoked", true)
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke API key: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// ValidateAPIKey 校验API密钥并返回所属用户（包含角色），同时记录最后使用时间
+// 最后使用时间最多每 apiKeyTouchInterval 更新一次，避免每个请求都写数据库
+func ValidateAPIKey(key string) (*models.User, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+	database := db.GetDB()
+
+	var apiKey models.APIKey
+	if err := database.Where("key_hash = ? AND revoked = ?", HashAPIKey(key), false).First(&apiKey).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, fmt.Errorf("failed to find API key: %w", err)
+	}
+
+	var user models.User
+	if err := database.Preload("Role").First(&user, apiKey.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+	if user.Status != "active" {
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= apiKeyTouchInterval {
+		// 条件更新，并发请求中只有一个写入
+		err := database.Model(&models.APIKey{}).
+			Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", apiKey.ID, now.Add(-apiKeyTouchInterval)).
+			UpdateColumn("last_used_at", now).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to update API key: %w", err)
+		}
+	}
+	return &user, nil
+}
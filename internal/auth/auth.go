@@ -1,8 +1,10 @@
 package auth
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"eino-rag/internal/db"
@@ -37,6 +39,10 @@ func Register(req *models.RegisterRequest) (*models.User, error) {
 		return nil, errors.New("email already exists")
 	}
 
+	if err := ValidatePassword(req.Password); err != nil {
+		return nil, err
+	}
+
 	// 加密密码
 	hashedPassword, err := HashPassword(req.Password)
 	if err != nil {
@@ -116,6 +122,39 @@ func Login(req *models.LoginRequest) (*models.TokenResponse, error) {
 	}, nil
 }
 
+// ErrInvalidCurrentPassword 修改密码时提供的当前密码错误
+var ErrInvalidCurrentPassword = errors.New("current password is incorrect")
+
+// ChangePassword 校验当前密码后修改为新密码，新密码需符合密码策略
+func ChangePassword(userID uint, currentPassword, newPassword string) error {
+	database := db.GetDB()
+
+	var user models.User
+	if err := database.First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return errors.New("user not found")
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if !CheckPassword(currentPassword, user.Password) {
+		return ErrInvalidCurrentPassword
+	}
+	if err := ValidatePassword(newPassword); err != nil {
+		return err
+	}
+
+	hashedPassword, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	return database.Model(&user).Updates(map[string]interface{}{
+		"password":   hashedPassword,
+		"updated_at": time.Now(),
+	}).Error
+}
+
 // GetUserByID 根据ID获取用户
 func GetUserByID(userID uint) (*models.User, error) {
 	database := db.GetDB()
@@ -155,16 +194,19 @@ func UpdateUserToken(userID uint, token string) error {
 		Update("token", token).Error
 }
 
+// 角色权限，保存在 Role.Permissions 的JSON数组中
+const (
+	PermissionAll       = "all" // 拥有全部权限
+	PermissionChat      = "chat"
+	PermissionViewKB    = "view_kb"
+	PermissionUploadDoc = "upload_doc"
+)
+
 // CheckPermission 检查用户权限
 func CheckPermission(user *models.User, permission string) (bool, error) {
 	// 如果用户已经预加载了角色
 	if user.Role != nil {
-		// 管理员拥有所有权限
-		if user.Role.Level == 0 {
-			return true, nil
-		}
-		// TODO: 实现更复杂的权限检查逻辑
-		return true, nil
+		return RoleHasPermission(user.Role, permission)
 	}
 
 	// 如果没有预加载角色，则加载
@@ -173,14 +215,40 @@ func CheckPermission(user *models.User, permission string) (bool, error) {
 	if err := database.First(&role, user.RoleID).Error; err != nil {
 		return false, fmt.Errorf("failed to get role: %w", err)
 	}
+	return RoleHasPermission(&role, permission)
+}
 
+// CheckRolePermission 按角色名检查权限，用于只有 token 中角色名的场景
+func CheckRolePermission(roleName, permission string) (bool, error) {
+	database := db.GetDB()
+	var role models.Role
+	if err := database.Where("name = ?", roleName).First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get role: %w", err)
+	}
+	return RoleHasPermission(&role, permission)
+}
+
+// RoleHasPermission 角色是否拥有指定权限，管理员（Level 为0）和拥有 all 的角色拥有全部权限
+func RoleHasPermission(role *models.Role, permission string) (bool, error) {
 	// 管理员拥有所有权限
 	if role.Level == 0 {
 		return true, nil
 	}
+	if strings.TrimSpace(role.Permissions) == "" {
+		return false, nil
+	}
 
-	// 检查具体权限
-	// 这里简化处理，实际应解析JSON
-	// TODO: 实现更复杂的权限检查逻辑
-	return true, nil
-}
\ No newline at end of file
+	var permissions []string
+	if err := json.Unmarshal([]byte(role.Permissions), &permissions); err != nil {
+		return false, fmt.Errorf("invalid permissions for role %q: %w", role.Name, err)
+	}
+	for _, p := range permissions {
+		if p == PermissionAll || p == permission {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+
+	"eino-rag/internal/config"
+)
+
+// ErrWeakPassword 密码不符合密码策略
+var ErrWeakPassword = errors.New("password does not meet the password policy")
+
+// maxPasswordBytes bcrypt 只使用前72字节，更长的密码超出部分不参与校验
+const maxPasswordBytes = 72
+
+// PasswordPolicy 密码策略
+type PasswordPolicy struct {
+	MinLength     int  `json:"min_length"`
+	RequireUpper  bool `json:"require_upper"`
+	RequireLower  bool `json:"require_lower"`
+	RequireDigit  bool `json:"require_digit"`
+	RequireSymbol bool `json:"require_symbol"`
+}
+
+// PasswordPolicyError 密码不符合策略的具体原因
+type PasswordPolicyError struct {
+	Violations []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return strings.Join(e.Violations, "; ")
+}
+
+func (e *PasswordPolicyError) Unwrap() error {
+	return ErrWeakPassword
+}
+
+// CurrentPasswordPolicy 返回当前配置的密码策略
+func CurrentPasswordPolicy() PasswordPolicy {
+	cfg := config.Get().Snapshot()
+	return PasswordPolicy{
+		MinLength:     cfg.PasswordMinLength,
+		RequireUpper:  cfg.PasswordRequireUpper,
+		RequireLower:  cfg.PasswordRequireLower,
+		RequireDigit:  cfg.PasswordRequireDigit,
+		RequireSymbol: cfg.PasswordRequireSymbol,
+	}
+}
+
+// Validate 检查密码是否符合策略，不符合时返回包含所有原因的 *PasswordPolicyError
+func (p PasswordPolicy) Validate(password string) error {
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+
+	var violations []string
+	if length := len([]rune(password)); length < p.MinLength {
+		violations = append(violations, fmt.Sprintf("password must be at least %d characters", p.MinLength))
+	}
+	if len(password) > maxPasswordBytes {
+		violations = append(violations, fmt.Sprintf("password must be at most %d bytes", maxPasswordBytes))
+	}
+	if p.RequireUpper && !hasUpper {
+		violations = append(violations, "password must contain an uppercase letter")
+	}
+	if p.RequireLower && !hasLower {
+		violations = append(violations, "password must contain a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		violations = append(violations, "password must contain a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		violations = append(violations, "password must contain a symbol")
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// ValidatePassword 按当前配置的密码策略检查密码
+func ValidatePassword(password string) error {
+	return CurrentPasswordPolicy().Validate(password)
+}
+
+// generatedPasswordLength 生成的随机密码的最小长度
+const generatedPasswordLength = 16
+
+// 生成随机密码使用的字符集，去掉了容易混淆的 0/O、1/l/I
+const (
+	passwordUpper   = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+	passwordLower   = "abcdefghijkmnopqrstuvwxyz"
+	passwordDigits  = "23456789"
+	passwordSymbols = "!@#$%^&*-_=+?"
+)
+
+// GeneratePassword 生成符合策略的随机密码，每类字符至少出现一次
+func (p PasswordPolicy) GeneratePassword() (string, error) {
+	length := generatedPasswordLength
+	if p.MinLength > length {
+		length = p.MinLength
+	}
+	if length > maxPasswordBytes {
+		length = maxPasswordBytes
+	}
+
+	classes := []string{passwordUpper, passwordLower, passwordDigits, passwordSymbols}
+	all := strings.Join(classes, "")
+
+	password := make([]byte, 0, length)
+	for _, class := range classes {
+		c, err := randomChar(class)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, c)
+	}
+	for len(password) < length {
+		c, err := randomChar(all)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, c)
+	}
+
+	// 打乱顺序，避免固定位置出现固定类型的字符
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", fmt.Errorf("failed to generate password: %w", err)
+		}
+		password[i], password[j.Int64()] = password[j.Int64()], password[i]
+	}
+	return string(password), nil
+}
+
+// randomChar 从字符集中随机取一个字符
+func randomChar(charset string) (byte, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate password: %w", err)
+	}
+	return charset[n.Int64()], nil
+}
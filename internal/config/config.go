@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -16,6 +17,49 @@ const (
 	ChunkingStrategySemantic ChunkingStrategy = "semantic"
 )
 
+type QueryExpansionMethod string
+
+const (
+	QueryExpansionSynonyms QueryExpansionMethod = "synonyms"
+	QueryExpansionLLM      QueryExpansionMethod = "llm"
+)
+
+// AnswerVerificationAction 核对发现回答中有无依据的论断时的处理方式
+type AnswerVerificationAction string
+
+const (
+	AnswerVerificationFlag       AnswerVerificationAction = "flag"       // 只在响应中标记
+	AnswerVerificationNote       AnswerVerificationAction = "note"       // 在回答末尾附加可信度提示
+	AnswerVerificationRegenerate AnswerVerificationAction = "regenerate" // 要求模型去掉无依据的论断重新生成
+)
+
+// ConversationLimitPolicy 用户的对话数达到上限时创建新对话的处理方式
+type ConversationLimitPolicy string
+
+const (
+	ConversationLimitReject      ConversationLimitPolicy = "reject"       // 拒绝创建新对话
+	ConversationLimitEvictOldest ConversationLimitPolicy = "evict_oldest" // 删除最久没有新消息的对话
+)
+
+type EmbeddingDimensionMode string
+
+const (
+	// EmbeddingDimensionStrict 维度不一致时拒绝向量化，并在错误中给出应配置的维度
+	EmbeddingDimensionStrict EmbeddingDimensionMode = "strict"
+	// EmbeddingDimensionAuto 首次成功向量化时采用模型的实际维度，集合为空时按新维度重建
+	EmbeddingDimensionAuto EmbeddingDimensionMode = "auto"
+)
+
+// ChunkLimitAction 文档分块数超过 MaxChunksPerDocument 时的处理方式
+type ChunkLimitAction string
+
+const (
+	// ChunkLimitReject 拒绝上传，返回413及分块数
+	ChunkLimitReject ChunkLimitAction = "reject"
+	// ChunkLimitTruncate 只索引前 MaxChunksPerDocument 个分块，丢弃其余分块并记录到文档
+	ChunkLimitTruncate ChunkLimitAction = "truncate"
+)
+
 type Config struct {
 	// Server
 	ServerPort string
@@ -23,7 +67,9 @@ type Config struct {
 	GinMode    string
 
 	// Database
-	DBPath string
+	DBPath     string
+	SeedPath   string // 示例文档目录，数据库为空时启动导入，为空表示不导入
+	SeedKBName string // 导入示例文档时创建的知识库名称
 
 	// Redis
 	RedisURL      string
@@ -32,10 +78,23 @@ type Config struct {
 
 	// Milvus
 	MilvusAddress   string // 完整的Milvus地址
+	MilvusUsername  string // 开启认证的Milvus用户名，与 MilvusPassword 一起使用
+	MilvusPassword  string
+	MilvusToken     string // API token（如 Zilliz Cloud），设置后优先于用户名密码
+	MilvusTLS       bool   // 使用TLS连接Milvus
 	CollectionName  string
 	VectorDimension int
+	EmbeddingDimensionMode EmbeddingDimensionMode // 嵌入模型返回的维度与 VectorDimension 不一致时的处理方式
 	MetricType      string
 	IndexType       string
+	MilvusSearchNprobe int // IVF 类索引查询的聚类数，越大召回越高、延迟越大
+	MilvusSearchEf     int // HNSW 索引查询的候选集大小，越大召回越高、延迟越大
+
+	// 每个知识库的向量写入单独的分区（kb_<id>），按知识库检索时只搜索该分区
+	MilvusKBPartitions bool
+
+	// 嵌入服务提供方：ollama 或 openai（OpenAI 兼容的 /embeddings 接口），仅能通过环境变量设置
+	EmbeddingProvider string
 
 	// Ollama
 	OllamaBaseURL  string
@@ -43,26 +102,165 @@ type Config struct {
 	LLMModel       string
 
 	// OpenAI
-	OpenAIAPIKey  string
-	OpenAIModel   string
-	OpenAIBaseURL string
+	OpenAIAPIKey       string
+	OpenAIModel        string
+	OpenAIBaseURL      string
+	OpenAIAllowedHosts []string // 允许的基础地址主机，为空时不限制主机但要求https，仅能通过环境变量设置
+	OpenAIProxyURL     string   // 访问OpenAI时使用的代理，为空时使用 HTTPS_PROXY 等环境变量，仅能通过环境变量设置
+	OpenAIJSONMode     bool     // 模型支持 JSON 模式（response_format=json_object），不支持时拒绝 response_format=json 的对话请求
+	// 模型服务不支持的生成参数（stop、presence_penalty、frequency_penalty），对话请求中的这些参数被忽略
+	OpenAIUnsupportedParams []string
 
 	// RAG
 	ChunkSize        int
 	ChunkOverlap     int
 	ChunkingStrategy ChunkingStrategy
+	MinChunkLength   int // 分块最少字符数，更短的分块合并到相邻分块，<=0 表示不过滤
+	BoilerplateMinRepeatRatio float64 // 行出现在至少该比例的页中视为页眉页脚，知识库开启 strip_boilerplate 时生效
 	TopK             int
 	ScoreThreshold   float32
+	ContextWindow    int // 检索命中后额外带上前后相邻分块的数量，0 表示不扩展
 	EmbeddingCache   bool
+	EmbeddingSkipFailedChunks bool // 为true时跳过向量化失败的分块继续索引，否则任一分块失败即整体失败
+	ContextualEmbedding bool // 向量化时在分块前加上文档标题和所在章节，知识库未单独设置时使用
+	RetrievalCache    bool          // 在Redis中缓存检索结果，知识库文档变更时失效
+	RetrievalCacheTTL time.Duration // 检索结果缓存时长
+	RecencyHalfLifeDays float64 // 时间衰减重排的默认半衰期（天），知识库和请求未指定时使用
+	MaxChunksPerDoc     int     // 检索结果中每个文档最多保留的分块数，0 表示不限制
+	RAGFallback        bool // 向量检索不可用或没有结果时，按文件名和摘要匹配文档作为降级上下文
+	RAGFallbackMaxDocs int  // 降级检索最多返回的文档数
+	RAGStrict          bool // 向量库不可用且没有降级上下文时不调用模型，直接回复知识库不可用
+	SemanticCache           bool          // 复用语义相近问题的缓存回答，需要Redis，默认关闭
+	SemanticCacheThreshold  float64       // 问题向量的余弦相似度达到该值才视为命中
+	SemanticCacheMaxEntries int           // 每个知识库最多保留的缓存回答数
+	SemanticCacheTTL        time.Duration // 缓存回答的有效期
+
+	// Retrieval candidates（启用时间衰减或按文档限量时先多召回候选再截断为 topK）
+	RetrievalCandidateMultiplier int // 相对 topK 多召回的倍数，没有这些后处理时只召回 topK 个，<=0 时为3
+
+	// Hybrid search（同时按向量相似度和关键词匹配检索）
+	HybridAlpha float64 // 混合检索中向量分数的权重 [0,1]，其余为关键词匹配分数的权重
+
+	// MMR（最大边际相关性）重排，减少检索结果中内容相近的分块
+	RetrievalMMR       bool    // 向量检索多召回候选后按 MMR 选出 topK 个，默认关闭
+	RetrievalMMRLambda float64 // 相关性的权重 [0,1]，越小越偏向多样性，1 等同于按相似度排序
+
+	// Query expansion
+	QueryExpansion         bool                 // 检索时额外用查询的改写变体检索并融合结果，默认关闭
+	QueryExpansionMethod   QueryExpansionMethod // 生成变体的方式：synonyms（同义词表）或 llm
+	QueryExpansionVariants int                  // 每个查询最多生成的变体数
+	QueryExpansionSynonyms string               // 同义词表，组之间用 ; 分隔，组内的词用 | 分隔
+	QueryExpansionCacheTTL time.Duration        // LLM 生成的变体在Redis中的缓存时长
+
+	// Chat
+	MaxStreamsPerUser  int // 普通用户同时进行的流式对话上限，<=0 表示不限制
+	MaxStreamsPerAdmin int // 管理员同时进行的流式对话上限，<=0 表示不限制
+	MaxResponseTokens      int // 默认的回复最大token数
+	MaxResponseTokensUser  int // 普通用户单次请求可设置的最大token数
+	MaxResponseTokensAdmin int // 管理员单次请求可设置的最大token数
+	MaxStoredMessageLength int // 保存的助手消息最大字符数，超出部分截断，<=0 表示不截断
+	ChatStreamMaxResumes   int // 流式回复中途出错时自动续写的次数，<=0 表示不续写
+	ChatToolCalling        bool // 默认由模型通过工具调用决定何时检索，需要模型支持函数调用
+
+	// Chat candidates（非流式对话一次生成多个候选回复，LLM 开销按候选数成倍增加）
+	MaxCandidatesUser  int // 普通用户单次请求可生成的候选回复数上限，<=1 表示不允许多个候选
+	MaxCandidatesAdmin int // 管理员单次请求可生成的候选回复数上限，<=1 表示不允许多个候选
+
+	// Chat generation params（presence_penalty/frequency_penalty 的取值范围为 [-limit, limit]，不超过 2）
+	MaxPenaltyUser  float64 // 普通用户可设置的惩罚参数绝对值上限，<=0 表示不允许设置
+	MaxPenaltyAdmin float64 // 管理员可设置的惩罚参数绝对值上限，<=0 表示不允许设置
+
+	// Chat trace（管理员调试接口，返回检索结果和完整提示词）
+	ChatTraceRateLimit int // 每个管理员每分钟可调用的次数，计数存放在Redis，<=0 表示关闭该接口
+
+	// Answer post-processing
+	AnswerFilters        []string // 回答的后处理过滤器，按顺序执行，为空表示不过滤
+	AnswerProfanityWords []string // profanity 过滤器屏蔽的词语
+
+	// Answer verification（有检索上下文时再调用一次LLM核对回答，LLM 开销翻倍）
+	AnswerVerification       bool                     // 核对回答中的论断是否有检索到的内容支持，默认关闭
+	AnswerVerificationAction AnswerVerificationAction // 发现无依据的论断时的处理方式：flag、note 或 regenerate
+
+	// Conversation limit（创建新对话时同步检查，删除的对话同时清理Redis和数据库）
+	MaxConversationsPerUser int                     // 每个用户最多保留的对话数，<=0 表示不限制
+	ConversationLimitPolicy ConversationLimitPolicy // 达到上限时的处理方式：reject 或 evict_oldest
+
+	// Conversation attachments
+	ConversationAttachmentTTL time.Duration // 对话附件在对话没有新消息多久后过期删除
+
+	// Embedding failover（主嵌入服务连续失败时改用OpenAI兼容的备用服务，阈值和试探间隔启动时生效）
+	EmbeddingFailover          bool          // 主嵌入服务不可用时是否切换到备用服务，默认关闭
+	EmbeddingFailoverModel     string        // 备用服务的嵌入模型，使用 OpenAIAPIKey、OpenAIBaseURL 访问
+	EmbeddingFailoverThreshold int           // 主服务连续失败多少次后切换到备用服务
+	EmbeddingFailoverCooldown  time.Duration // 切换后每隔多久试探一次主服务是否恢复
+
+	// Embedding concurrency（写入向量库和批量向量化共用，应不大于 EmbeddingMaxIdleConnsPerHost）
+	EmbeddingConcurrency int // 同时进行的向量化请求数，<=1 表示逐个处理
+
+	// Embedding retry（嵌入服务返回5xx或网络错误时重试，4xx和超时不重试）
+	EmbeddingMaxRetries   int           // 重试次数，<=0 表示不重试
+	EmbeddingRetryBackoff time.Duration // 首次重试等待时间，之后指数增长
+
+	// Summary
+	SummaryEnabled        bool // 上传时是否使用LLM生成文档摘要（需要配置OpenAI）
+	SummaryMinLength      int  // 文本少于该字符数的文档不生成摘要
+	SummaryMaxInputLength int  // 送入LLM的最大字符数，超出部分截断
+	SummaryIndexChunk     bool // 是否将摘要作为特殊分块写入向量库
+
+	// Document preview
+	DocumentPreviewLength int // 上传时保存的预览文本最大字符数，PDF 只取第一页，<=0 表示不保存预览
+
+	// Document dedup
+	DedupNormalize bool // 查重时是否忽略文本文件的行尾、首尾空白和连续空白差异，关闭时只按原始字节判断
 
 	// Authentication
 	JWTSecret      string
 	JWTExpireHours int
 	SessionSecret  string
 
+	// Auth rate limit（匿名认证接口限流，计数存放在Redis）
+	AuthRateLimitPerIP  int           // 单个IP每个窗口内允许的请求数，<=0 表示不限制
+	AuthRateLimitGlobal int           // 所有IP每个窗口内允许的请求总数，<=0 表示不限制
+	AuthRateLimitWindow time.Duration // 限流窗口长度
+
+	// Response compression（客户端声明 Accept-Encoding: gzip 时压缩较大的响应，SSE 流始终不压缩）
+	CompressionEnabled      bool
+	CompressionMinSize      int      // 响应体达到该字节数才压缩
+	CompressionContentTypes []string // 允许压缩的响应类型，不含参数部分
+
+	// Password policy（注册、创建/修改用户和修改密码时校验）
+	PasswordMinLength     int
+	PasswordRequireUpper  bool
+	PasswordRequireLower  bool
+	PasswordRequireDigit  bool
+	PasswordRequireSymbol bool
+
 	// Upload
-	MaxUploadSize    int64
-	AllowedFileTypes []string
+	MaxUploadSize        int64
+	AllowedFileTypes     []string
+	PDFMaxPages          int              // 单个PDF最多解析的页数，<=0 表示不限制
+	MaxChunksPerDocument int              // 单个文档切分后最多的分块数，<=0 表示不限制
+	ChunkLimitAction     ChunkLimitAction // 分块数超过上限时拒绝还是截断
+
+	// Resumable upload（分片上传）
+	UploadSessionDir string        // 保存已接收分片的目录，仅能通过环境变量设置
+	UploadSessionTTL time.Duration // 会话在多久没有新分片后过期
+	UploadJobTTL     time.Duration // 异步上传任务在多久没有更新后删除
+
+	// Metadata（分块元数据的可见范围，见 rag/metadata.go）
+	ChunkMetadataKeys    []string // 从文档元数据复制到每个分块的键，kb_id 和 doc_id 总会保留
+	ResponseMetadataKeys []string // 检索结果中返回给客户端的元数据键，其余键只在服务内部使用
+
+	// Stats
+	StatsDetailLimit int // 详细统计中知识库和上传者排行最多返回的条数
+
+	// Consistency（SQL 与 Milvus 的一致性检查）
+	ConsistencyCheckInterval time.Duration // 后台检查间隔，<=0 表示不定期检查
+	ConsistencyAutoCleanup   bool          // 检查时删除没有对应文档记录的向量，默认只报告
+
+	// Retention（知识库文档保留期限）
+	RetentionCheckInterval time.Duration // 后台清理超过保留期限的文档的间隔，<=0 表示不定期清理
+	KBDeleteGracePeriod    time.Duration // 软删除的知识库保留多久后由清理任务永久删除，<=0 表示只能手动永久删除
 
 	// Timeouts
 	IndexTimeout         time.Duration
@@ -71,6 +269,26 @@ type Config struct {
 	GRPCKeepaliveTime    time.Duration
 	EmbeddingTimeout     time.Duration
 	GRPCKeepaliveTimeout time.Duration
+	MilvusSearchTimeout  time.Duration // 单次向量检索的超时，<=0 表示不限制
+	OpenAITimeout        time.Duration // 对话模型生成的超时，启动时生效
+	RequestTimeout       time.Duration // API 请求的整体超时，到期返回504，<=0 表示不限制
+	LongRequestTimeout   time.Duration // 上传、批量任务等耗时较长的接口的请求超时，<=0 表示不限制
+
+	// Milvus retry / circuit breaker
+	MilvusMaxRetries       int           // 临时性错误的重试次数
+	MilvusRetryBackoff     time.Duration // 首次重试等待时间，之后指数增长
+	MilvusBreakerThreshold int           // 连续失败多少次后打开熔断器，<=0 表示不熔断
+	MilvusBreakerTimeout   time.Duration // 熔断器打开后多久进入半开试探
+
+	// Milvus health check（已连接时的健康检查，断开时按退避间隔重连）
+	MilvusHealthCheckInterval time.Duration // 已连接时健康检查的间隔
+	MilvusHealthCheckTimeout  time.Duration // 单次健康检查的超时
+
+	// Embedding HTTP connection pool（启动时创建，修改后需重启生效）
+	EmbeddingMaxIdleConns        int           // 所有主机的最大空闲连接数
+	EmbeddingMaxIdleConnsPerHost int           // 每个主机的最大空闲连接数，应不小于并发向量化的请求数
+	EmbeddingIdleConnTimeout     time.Duration // 空闲连接保留时长
+	EmbeddingKeepAlive           time.Duration // TCP keep-alive 探测间隔
 }
 
 var cfg *Config
@@ -90,7 +308,9 @@ func Load() *Config {
 		GinMode:    getEnv("GIN_MODE", "debug"),
 
 		// Database
-		DBPath: getEnv("DB_PATH", "./data/eino-rag.db"),
+		DBPath:     getEnv("DB_PATH", "./data/eino-rag.db"),
+		SeedPath:   getEnv("SEED_PATH", ""),
+		SeedKBName: getEnv("SEED_KB_NAME", "示例知识库"),
 
 		// Redis
 		RedisURL:      getEnv("REDIS_URL", "redis://localhost:6379"),
@@ -99,10 +319,22 @@ func Load() *Config {
 
 		// Milvus
 		MilvusAddress:   getEnv("MILVUS_ADDRESS", "localhost:19530"),
+		MilvusUsername:  getEnv("MILVUS_USERNAME", ""),
+		MilvusPassword:  getEnv("MILVUS_PASSWORD", ""),
+		MilvusToken:     getEnv("MILVUS_TOKEN", ""),
+		MilvusTLS:       getEnvAsBool("MILVUS_TLS", false),
 		CollectionName:  getEnv("COLLECTION_NAME", "eino_rag_documents"),
 		VectorDimension: getEnvAsInt("VECTOR_DIM", 1024),
+		EmbeddingDimensionMode: EmbeddingDimensionMode(getEnv("EMBEDDING_DIMENSION_MODE", string(EmbeddingDimensionStrict))),
 		MetricType:      getEnv("METRIC_TYPE", "L2"),
 		IndexType:       getEnv("INDEX_TYPE", "IVF_FLAT"),
+		MilvusSearchNprobe: getEnvAsInt("MILVUS_SEARCH_NPROBE", 16),
+		MilvusSearchEf:     getEnvAsInt("MILVUS_SEARCH_EF", 64),
+
+		MilvusKBPartitions: getEnvAsBool("MILVUS_KB_PARTITIONS", true),
+
+		// Embedding provider
+		EmbeddingProvider: getEnv("EMBEDDING_PROVIDER", "ollama"),
 
 		// Ollama
 		OllamaBaseURL:  getEnv("OLLAMA_URL", "http://localhost:11434"),
@@ -110,26 +342,165 @@ func Load() *Config {
 		LLMModel:       getEnv("LLM_MODEL", "llama2"),
 
 		// OpenAI
-		OpenAIAPIKey:  getEnv("OPENAI_API_KEY", ""),
-		OpenAIModel:   getEnv("OPENAI_MODEL", "gpt-4o"),
-		OpenAIBaseURL: getEnv("OPENAI_BASE_URL", ""),
+		OpenAIAPIKey:       getEnv("OPENAI_API_KEY", ""),
+		OpenAIModel:        getEnv("OPENAI_MODEL", "gpt-4o"),
+		OpenAIBaseURL:      getEnv("OPENAI_BASE_URL", ""),
+		OpenAIAllowedHosts: splitList(getEnv("OPENAI_ALLOWED_HOSTS", "")),
+		OpenAIProxyURL:     getEnv("OPENAI_PROXY_URL", ""),
+		OpenAIJSONMode:     getEnvAsBool("OPENAI_JSON_MODE", true),
+
+		OpenAIUnsupportedParams: splitList(getEnv("OPENAI_UNSUPPORTED_PARAMS", "")),
 
 		// RAG
 		ChunkSize:        getEnvAsInt("CHUNK_SIZE", 500),
 		ChunkOverlap:     getEnvAsInt("CHUNK_OVERLAP", 50),
 		ChunkingStrategy: ChunkingStrategy(getEnv("CHUNKING_STRATEGY", string(ChunkingStrategyLength))),
+		MinChunkLength:   getEnvAsInt("MIN_CHUNK_LENGTH", 10),
+		BoilerplateMinRepeatRatio: getEnvAsFloat("BOILERPLATE_MIN_REPEAT_RATIO", 0.5),
 		TopK:             getEnvAsInt("TOP_K", 5),
 		ScoreThreshold:   float32(getEnvAsFloat("SCORE_THRESHOLD", 0.7)),
+		ContextWindow:    getEnvAsInt("CONTEXT_WINDOW", 0),
 		EmbeddingCache:   getEnvAsBool("EMBEDDING_CACHE", true),
+		EmbeddingSkipFailedChunks: getEnvAsBool("EMBEDDING_SKIP_FAILED_CHUNKS", false),
+		ContextualEmbedding: getEnvAsBool("CONTEXTUAL_EMBEDDING", false),
+		RetrievalCache:    getEnvAsBool("RETRIEVAL_CACHE", false),
+		RetrievalCacheTTL: time.Duration(getEnvAsInt("RETRIEVAL_CACHE_TTL", 300)) * time.Second,
+		RecencyHalfLifeDays: getEnvAsFloat("RECENCY_HALF_LIFE_DAYS", 30),
+		MaxChunksPerDoc:     getEnvAsInt("MAX_CHUNKS_PER_DOC", 0),
+		RAGFallback:        getEnvAsBool("RAG_FALLBACK", false),
+		RAGFallbackMaxDocs: getEnvAsInt("RAG_FALLBACK_MAX_DOCS", 3),
+		RAGStrict:          getEnvAsBool("RAG_STRICT", false),
+		SemanticCache:           getEnvAsBool("SEMANTIC_CACHE", false),
+		SemanticCacheThreshold:  getEnvAsFloat("SEMANTIC_CACHE_THRESHOLD", 0.95),
+		SemanticCacheMaxEntries: getEnvAsInt("SEMANTIC_CACHE_MAX_ENTRIES", 200),
+		SemanticCacheTTL:        time.Duration(getEnvAsInt("SEMANTIC_CACHE_TTL", 86400)) * time.Second,
+
+		// Retrieval candidates
+		RetrievalCandidateMultiplier: getEnvAsInt("RETRIEVAL_CANDIDATE_MULTIPLIER", 3),
+
+		// Hybrid search
+		HybridAlpha: getEnvAsFloat("HYBRID_ALPHA", 0.5),
+
+		// MMR re-ranking
+		RetrievalMMR:       getEnvAsBool("RETRIEVAL_MMR", false),
+		RetrievalMMRLambda: getEnvAsFloat("RETRIEVAL_MMR_LAMBDA", 0.7),
+
+		// Query expansion
+		QueryExpansion:         getEnvAsBool("QUERY_EXPANSION", false),
+		QueryExpansionMethod:   QueryExpansionMethod(getEnv("QUERY_EXPANSION_METHOD", string(QueryExpansionSynonyms))),
+		QueryExpansionVariants: getEnvAsInt("QUERY_EXPANSION_VARIANTS", 3),
+		QueryExpansionSynonyms: getEnv("QUERY_EXPANSION_SYNONYMS", ""),
+		QueryExpansionCacheTTL: time.Duration(getEnvAsInt("QUERY_EXPANSION_CACHE_TTL", 86400)) * time.Second,
+
+		// Chat
+		MaxStreamsPerUser:  getEnvAsInt("MAX_STREAMS_PER_USER", 3),
+		MaxStreamsPerAdmin: getEnvAsInt("MAX_STREAMS_PER_ADMIN", 0),
+		MaxResponseTokens:      getEnvAsInt("MAX_RESPONSE_TOKENS", 2048),
+		MaxResponseTokensUser:  getEnvAsInt("MAX_RESPONSE_TOKENS_USER", 4096),
+		MaxResponseTokensAdmin: getEnvAsInt("MAX_RESPONSE_TOKENS_ADMIN", 16384),
+		MaxStoredMessageLength: getEnvAsInt("MAX_STORED_MESSAGE_LENGTH", 20000),
+		ChatStreamMaxResumes:   getEnvAsInt("CHAT_STREAM_MAX_RESUMES", 1),
+		ChatToolCalling:        getEnvAsBool("CHAT_TOOL_CALLING", false),
+
+		// Chat candidates
+		MaxCandidatesUser:  getEnvAsInt("MAX_CANDIDATES_USER", 3),
+		MaxCandidatesAdmin: getEnvAsInt("MAX_CANDIDATES_ADMIN", 5),
+
+		// Chat generation params
+		MaxPenaltyUser:  getEnvAsFloat("MAX_PENALTY_USER", 1.0),
+		MaxPenaltyAdmin: getEnvAsFloat("MAX_PENALTY_ADMIN", 2.0),
+
+		// Chat trace
+		ChatTraceRateLimit: getEnvAsInt("CHAT_TRACE_RATE_LIMIT", 10),
+
+		// Answer post-processing
+		AnswerFilters:        splitList(getEnv("ANSWER_FILTERS", "")),
+		AnswerProfanityWords: splitList(getEnv("ANSWER_PROFANITY_WORDS", "")),
+
+		// Answer verification
+		AnswerVerification:       getEnvAsBool("ANSWER_VERIFICATION", false),
+		AnswerVerificationAction: AnswerVerificationAction(getEnv("ANSWER_VERIFICATION_ACTION", string(AnswerVerificationFlag))),
+
+		// Conversation limit
+		MaxConversationsPerUser: getEnvAsInt("MAX_CONVERSATIONS_PER_USER", 0),
+		ConversationLimitPolicy: ConversationLimitPolicy(getEnv("CONVERSATION_LIMIT_POLICY", string(ConversationLimitReject))),
+
+		// Conversation attachments
+		ConversationAttachmentTTL: time.Duration(getEnvAsInt("CONVERSATION_ATTACHMENT_TTL", 86400)) * time.Second,
+
+		// Embedding failover
+		EmbeddingFailover:          getEnvAsBool("EMBEDDING_FAILOVER", false),
+		EmbeddingFailoverModel:     getEnv("EMBEDDING_FAILOVER_MODEL", "text-embedding-3-small"),
+		EmbeddingFailoverThreshold: getEnvAsInt("EMBEDDING_FAILOVER_THRESHOLD", 3),
+		EmbeddingFailoverCooldown:  time.Duration(getEnvAsInt("EMBEDDING_FAILOVER_COOLDOWN", 60)) * time.Second,
+
+		// Embedding concurrency
+		EmbeddingConcurrency: getEnvAsInt("EMBEDDING_CONCURRENCY", 4),
+
+		// Embedding retry
+		EmbeddingMaxRetries:   getEnvAsInt("EMBEDDING_MAX_RETRIES", 3),
+		EmbeddingRetryBackoff: time.Duration(getEnvAsInt("EMBEDDING_RETRY_BACKOFF_MS", 200)) * time.Millisecond,
+
+		// Summary
+		SummaryEnabled:        getEnvAsBool("SUMMARY_ENABLED", false),
+		SummaryMinLength:      getEnvAsInt("SUMMARY_MIN_LENGTH", 1000),
+		SummaryMaxInputLength: getEnvAsInt("SUMMARY_MAX_INPUT_LENGTH", 8000),
+		SummaryIndexChunk:     getEnvAsBool("SUMMARY_INDEX_CHUNK", true),
+
+		// Document preview
+		DocumentPreviewLength: getEnvAsInt("DOCUMENT_PREVIEW_LENGTH", 500),
+
+		// Document dedup
+		DedupNormalize: getEnvAsBool("DEDUP_NORMALIZE", true),
 
 		// Authentication
 		JWTSecret:      getEnv("JWT_SECRET", "your-secret-key-here"),
 		JWTExpireHours: getEnvAsInt("JWT_EXPIRE_HOURS", 24),
 		SessionSecret:  getEnv("SESSION_SECRET", "your-session-secret-here"),
 
+		// Auth rate limit
+		AuthRateLimitPerIP:  getEnvAsInt("AUTH_RATE_LIMIT_PER_IP", 20),
+		AuthRateLimitGlobal: getEnvAsInt("AUTH_RATE_LIMIT_GLOBAL", 500),
+		AuthRateLimitWindow: time.Duration(getEnvAsInt("AUTH_RATE_LIMIT_WINDOW", 60)) * time.Second,
+
+		// Response compression
+		CompressionEnabled:      getEnvAsBool("COMPRESSION_ENABLED", true),
+		CompressionMinSize:      getEnvAsInt("COMPRESSION_MIN_SIZE", 1024),
+		CompressionContentTypes: splitList(getEnv("COMPRESSION_CONTENT_TYPES", "application/json,text/plain,text/html,text/csv")),
+
+		// Password policy
+		PasswordMinLength:     getEnvAsInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordRequireUpper:  getEnvAsBool("PASSWORD_REQUIRE_UPPER", true),
+		PasswordRequireLower:  getEnvAsBool("PASSWORD_REQUIRE_LOWER", true),
+		PasswordRequireDigit:  getEnvAsBool("PASSWORD_REQUIRE_DIGIT", true),
+		PasswordRequireSymbol: getEnvAsBool("PASSWORD_REQUIRE_SYMBOL", false),
+
 		// Upload
-		MaxUploadSize:    getEnvAsInt64("MAX_UPLOAD_SIZE", 10*1024*1024),
-		AllowedFileTypes: strings.Split(getEnv("ALLOWED_FILE_TYPES", ".pdf,.txt,.md,.markdown,.json,.csv,.html,.htm"), ","),
+		MaxUploadSize:        getEnvAsInt64("MAX_UPLOAD_SIZE", 10*1024*1024),
+		AllowedFileTypes:     strings.Split(getEnv("ALLOWED_FILE_TYPES", ".pdf,.txt,.md,.markdown,.json,.csv,.html,.htm,.docx"), ","),
+		PDFMaxPages:          getEnvAsInt("PDF_MAX_PAGES", 1000),
+		MaxChunksPerDocument: getEnvAsInt("MAX_CHUNKS_PER_DOCUMENT", 10000),
+		ChunkLimitAction:     ChunkLimitAction(getEnv("CHUNK_LIMIT_ACTION", string(ChunkLimitReject))),
+
+		// Resumable upload
+		UploadSessionDir: getEnv("UPLOAD_SESSION_DIR", filepath.Join(os.TempDir(), "eino-rag-uploads")),
+		UploadSessionTTL: time.Duration(getEnvAsInt("UPLOAD_SESSION_TTL", 86400)) * time.Second,
+		UploadJobTTL:     time.Duration(getEnvAsInt("UPLOAD_JOB_TTL", 86400)) * time.Second,
+
+		// Metadata
+		ChunkMetadataKeys:    splitList(getEnv("CHUNK_METADATA_KEYS", "filename,file_type,kb_id,doc_id,page_start,page_end")),
+		ResponseMetadataKeys: splitList(getEnv("RESPONSE_METADATA_KEYS", "score,similarity,kb_id,doc_id,chunk_index,type,expanded,file_name,page_start,page_end,doc_created_at,doc_title,doc_author,doc_tags,doc_date,vector_score,keyword_score")),
+
+		// Stats
+		StatsDetailLimit: getEnvAsInt("STATS_DETAIL_LIMIT", 10),
+
+		// Consistency
+		ConsistencyCheckInterval: time.Duration(getEnvAsInt("CONSISTENCY_CHECK_INTERVAL", 3600)) * time.Second,
+		ConsistencyAutoCleanup:   getEnvAsBool("CONSISTENCY_AUTO_CLEANUP", false),
+
+		// Retention
+		RetentionCheckInterval: time.Duration(getEnvAsInt("RETENTION_CHECK_INTERVAL", 3600)) * time.Second,
+		KBDeleteGracePeriod:    time.Duration(getEnvAsInt("KB_DELETE_GRACE_PERIOD", 604800)) * time.Second,
 
 		// Timeouts
 		IndexTimeout:         time.Duration(getEnvAsInt("INDEX_TIMEOUT", 120)) * time.Second,
@@ -138,6 +509,26 @@ func Load() *Config {
 		GRPCKeepaliveTime:    time.Duration(getEnvAsInt("GRPC_KEEPALIVE_TIME", 30)) * time.Second,
 		EmbeddingTimeout:     time.Duration(getEnvAsInt("EMBEDDING_TIMEOUT", 120)) * time.Second,
 		GRPCKeepaliveTimeout: time.Duration(getEnvAsInt("GRPC_KEEPALIVE_TIMEOUT", 5)) * time.Second,
+		MilvusSearchTimeout:  time.Duration(getEnvAsInt("MILVUS_SEARCH_TIMEOUT", 30)) * time.Second,
+		OpenAITimeout:        time.Duration(getEnvAsInt("OPENAI_TIMEOUT", 60)) * time.Second,
+		RequestTimeout:       time.Duration(getEnvAsInt("REQUEST_TIMEOUT", 120)) * time.Second,
+		LongRequestTimeout:   time.Duration(getEnvAsInt("REQUEST_TIMEOUT_LONG", 900)) * time.Second,
+
+		// Milvus retry / circuit breaker
+		MilvusMaxRetries:       getEnvAsInt("MILVUS_MAX_RETRIES", 2),
+		MilvusRetryBackoff:     time.Duration(getEnvAsInt("MILVUS_RETRY_BACKOFF_MS", 200)) * time.Millisecond,
+		MilvusBreakerThreshold: getEnvAsInt("MILVUS_BREAKER_THRESHOLD", 5),
+		MilvusBreakerTimeout:   time.Duration(getEnvAsInt("MILVUS_BREAKER_TIMEOUT", 30)) * time.Second,
+
+		// Milvus health check
+		MilvusHealthCheckInterval: time.Duration(getEnvAsInt("MILVUS_HEALTH_CHECK_INTERVAL", 30)) * time.Second,
+		MilvusHealthCheckTimeout:  time.Duration(getEnvAsInt("MILVUS_HEALTH_CHECK_TIMEOUT", 5)) * time.Second,
+
+		// Embedding HTTP connection pool
+		EmbeddingMaxIdleConns:        getEnvAsInt("EMBEDDING_MAX_IDLE_CONNS", 32),
+		EmbeddingMaxIdleConnsPerHost: getEnvAsInt("EMBEDDING_MAX_IDLE_CONNS_PER_HOST", 16),
+		EmbeddingIdleConnTimeout:     time.Duration(getEnvAsInt("EMBEDDING_IDLE_CONN_TIMEOUT", 90)) * time.Second,
+		EmbeddingKeepAlive:           time.Duration(getEnvAsInt("EMBEDDING_KEEP_ALIVE", 30)) * time.Second,
 	}
 
 	return cfg
@@ -190,12 +581,23 @@ func getEnvAsBool(key string, defaultValue bool) bool {
 	return defaultValue
 }
 
-// UpdateFromDB 从数据库更新配置
+// UpdateFromDB 从数据库更新配置，修改期间持有写锁，修改完成后通知订阅者
 func UpdateFromDB(configs map[string]string) {
 	if cfg == nil {
 		return
 	}
-	
+
+	mu.Lock()
+	old := cfg.clone()
+	applyDBConfigs(configs)
+	updated := cfg.clone()
+	mu.Unlock()
+
+	notifySubscribers(old, updated)
+}
+
+// applyDBConfigs 把数据库中的配置写入全局配置，调用方需要持有写锁
+func applyDBConfigs(configs map[string]string) {
 	// 更新Milvus配置
 	if val, ok := configs["milvus_address"]; ok && val != "" {
 		cfg.MilvusAddress = val
@@ -203,6 +605,20 @@ func UpdateFromDB(configs map[string]string) {
 	if val, ok := configs["collection_name"]; ok {
 		cfg.CollectionName = val
 	}
+	if val, ok := configs["milvus_username"]; ok {
+		cfg.MilvusUsername = val
+	}
+	if val, ok := configs["milvus_password"]; ok {
+		cfg.MilvusPassword = val
+	}
+	if val, ok := configs["milvus_token"]; ok {
+		cfg.MilvusToken = val
+	}
+	if val, ok := configs["milvus_tls"]; ok {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			cfg.MilvusTLS = enabled
+		}
+	}
 	
 	// 更新Ollama配置
 	if val, ok := configs["ollama_url"]; ok {
@@ -219,9 +635,18 @@ func UpdateFromDB(configs map[string]string) {
 	if val, ok := configs["openai_model"]; ok {
 		cfg.OpenAIModel = val
 	}
-	if val, ok := configs["openai_base_url"]; ok && val != "" {
+	// 不满足出站限制的地址不生效
+	if val, ok := configs["openai_base_url"]; ok && val != "" && ValidateOpenAIBaseURL(val, cfg.OpenAIAllowedHosts) == nil {
 		cfg.OpenAIBaseURL = val
 	}
+	if val, ok := configs["openai_json_mode"]; ok {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			cfg.OpenAIJSONMode = enabled
+		}
+	}
+	if val, ok := configs["openai_unsupported_params"]; ok {
+		cfg.OpenAIUnsupportedParams = splitList(val)
+	}
 	
 	// 更新RAG配置
 	if val, ok := configs["chunk_size"]; ok {
@@ -237,6 +662,16 @@ func UpdateFromDB(configs map[string]string) {
 	if val, ok := configs["chunking_strategy"]; ok {
 		cfg.ChunkingStrategy = ChunkingStrategy(val)
 	}
+	if val, ok := configs["min_chunk_length"]; ok {
+		if length, err := strconv.Atoi(val); err == nil {
+			cfg.MinChunkLength = length
+		}
+	}
+	if val, ok := configs["boilerplate_min_repeat_ratio"]; ok {
+		if ratio, err := strconv.ParseFloat(val, 64); err == nil && ratio > 0 && ratio <= 1 {
+			cfg.BoilerplateMinRepeatRatio = ratio
+		}
+	}
 	if val, ok := configs["top_k"]; ok {
 		if topK, err := strconv.Atoi(val); err == nil {
 			cfg.TopK = topK
@@ -247,6 +682,193 @@ func UpdateFromDB(configs map[string]string) {
 			cfg.ScoreThreshold = float32(threshold)
 		}
 	}
+	if val, ok := configs["context_window"]; ok {
+		if window, err := strconv.Atoi(val); err == nil {
+			cfg.ContextWindow = window
+		}
+	}
+	
+	// 更新流式对话并发限制
+	if val, ok := configs["max_streams_per_user"]; ok {
+		if limit, err := strconv.Atoi(val); err == nil {
+			cfg.MaxStreamsPerUser = limit
+		}
+	}
+	if val, ok := configs["max_streams_per_admin"]; ok {
+		if limit, err := strconv.Atoi(val); err == nil {
+			cfg.MaxStreamsPerAdmin = limit
+		}
+	}
+	
+	// 更新回复长度限制
+	if val, ok := configs["max_response_tokens"]; ok {
+		if tokens, err := strconv.Atoi(val); err == nil {
+			cfg.MaxResponseTokens = tokens
+		}
+	}
+	if val, ok := configs["max_response_tokens_user"]; ok {
+		if tokens, err := strconv.Atoi(val); err == nil {
+			cfg.MaxResponseTokensUser = tokens
+		}
+	}
+	if val, ok := configs["max_response_tokens_admin"]; ok {
+		if tokens, err := strconv.Atoi(val); err == nil {
+			cfg.MaxResponseTokensAdmin = tokens
+		}
+	}
+	if val, ok := configs["max_stored_message_length"]; ok {
+		if length, err := strconv.Atoi(val); err == nil {
+			cfg.MaxStoredMessageLength = length
+		}
+	}
+	if val, ok := configs["chat_stream_max_resumes"]; ok {
+		if resumes, err := strconv.Atoi(val); err == nil {
+			cfg.ChatStreamMaxResumes = resumes
+		}
+	}
+	if val, ok := configs["chat_tool_calling"]; ok {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			cfg.ChatToolCalling = enabled
+		}
+	}
+	if val, ok := configs["max_candidates_user"]; ok {
+		if limit, err := strconv.Atoi(val); err == nil {
+			cfg.MaxCandidatesUser = limit
+		}
+	}
+	if val, ok := configs["max_candidates_admin"]; ok {
+		if limit, err := strconv.Atoi(val); err == nil {
+			cfg.MaxCandidatesAdmin = limit
+		}
+	}
+	if val, ok := configs["max_penalty_user"]; ok {
+		if limit, err := strconv.ParseFloat(val, 64); err == nil {
+			cfg.MaxPenaltyUser = limit
+		}
+	}
+	if val, ok := configs["max_penalty_admin"]; ok {
+		if limit, err := strconv.ParseFloat(val, 64); err == nil {
+			cfg.MaxPenaltyAdmin = limit
+		}
+	}
+	if val, ok := configs["chat_trace_rate_limit"]; ok {
+		if limit, err := strconv.Atoi(val); err == nil {
+			cfg.ChatTraceRateLimit = limit
+		}
+	}
+	if val, ok := configs["answer_filters"]; ok {
+		cfg.AnswerFilters = splitList(val)
+	}
+	if val, ok := configs["answer_profanity_words"]; ok {
+		cfg.AnswerProfanityWords = splitList(val)
+	}
+	if val, ok := configs["answer_verification"]; ok {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			cfg.AnswerVerification = enabled
+		}
+	}
+	if val, ok := configs["answer_verification_action"]; ok {
+		switch action := AnswerVerificationAction(val); action {
+		case AnswerVerificationFlag, AnswerVerificationNote, AnswerVerificationRegenerate:
+			cfg.AnswerVerificationAction = action
+		}
+	}
+
+	// 更新对话数上限配置
+	if val, ok := configs["max_conversations_per_user"]; ok {
+		if limit, err := strconv.Atoi(val); err == nil {
+			cfg.MaxConversationsPerUser = limit
+		}
+	}
+	if val, ok := configs["conversation_limit_policy"]; ok {
+		if policy := ConversationLimitPolicy(val); policy == ConversationLimitReject || policy == ConversationLimitEvictOldest {
+			cfg.ConversationLimitPolicy = policy
+		}
+	}
+	if val, ok := configs["conversation_attachment_ttl"]; ok {
+		if seconds, err := strconv.Atoi(val); err == nil && seconds > 0 {
+			cfg.ConversationAttachmentTTL = time.Duration(seconds) * time.Second
+		}
+	}
+
+	// 更新嵌入服务故障转移配置
+	if val, ok := configs["embedding_failover"]; ok {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			cfg.EmbeddingFailover = enabled
+		}
+	}
+	if val, ok := configs["embedding_failover_model"]; ok && val != "" {
+		cfg.EmbeddingFailoverModel = val
+	}
+	if val, ok := configs["embedding_failover_threshold"]; ok {
+		if threshold, err := strconv.Atoi(val); err == nil && threshold > 0 {
+			cfg.EmbeddingFailoverThreshold = threshold
+		}
+	}
+	if val, ok := configs["embedding_failover_cooldown"]; ok {
+		if cooldown, err := strconv.Atoi(val); err == nil && cooldown > 0 {
+			cfg.EmbeddingFailoverCooldown = time.Duration(cooldown) * time.Second
+		}
+	}
+
+	// 更新认证接口限流配置
+	if val, ok := configs["auth_rate_limit_per_ip"]; ok {
+		if limit, err := strconv.Atoi(val); err == nil {
+			cfg.AuthRateLimitPerIP = limit
+		}
+	}
+	if val, ok := configs["auth_rate_limit_global"]; ok {
+		if limit, err := strconv.Atoi(val); err == nil {
+			cfg.AuthRateLimitGlobal = limit
+		}
+	}
+	if val, ok := configs["auth_rate_limit_window"]; ok {
+		if seconds, err := strconv.Atoi(val); err == nil {
+			cfg.AuthRateLimitWindow = time.Duration(seconds) * time.Second
+		}
+	}
+
+	// 更新响应压缩配置
+	if val, ok := configs["compression_enabled"]; ok {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			cfg.CompressionEnabled = enabled
+		}
+	}
+	if val, ok := configs["compression_min_size"]; ok {
+		if size, err := strconv.Atoi(val); err == nil {
+			cfg.CompressionMinSize = size
+		}
+	}
+	if val, ok := configs["compression_content_types"]; ok {
+		cfg.CompressionContentTypes = splitList(val)
+	}
+
+	// 更新密码策略
+	if val, ok := configs["password_min_length"]; ok {
+		if length, err := strconv.Atoi(val); err == nil {
+			cfg.PasswordMinLength = length
+		}
+	}
+	if val, ok := configs["password_require_upper"]; ok {
+		if required, err := strconv.ParseBool(val); err == nil {
+			cfg.PasswordRequireUpper = required
+		}
+	}
+	if val, ok := configs["password_require_lower"]; ok {
+		if required, err := strconv.ParseBool(val); err == nil {
+			cfg.PasswordRequireLower = required
+		}
+	}
+	if val, ok := configs["password_require_digit"]; ok {
+		if required, err := strconv.ParseBool(val); err == nil {
+			cfg.PasswordRequireDigit = required
+		}
+	}
+	if val, ok := configs["password_require_symbol"]; ok {
+		if required, err := strconv.ParseBool(val); err == nil {
+			cfg.PasswordRequireSymbol = required
+		}
+	}
 	
 	// 更新文件上传限制
 	if val, ok := configs["max_file_size"]; ok {
@@ -259,6 +881,53 @@ func UpdateFromDB(configs map[string]string) {
 			cfg.MaxUploadSize = size
 		}
 	}
+	if val, ok := configs["pdf_max_pages"]; ok {
+		if pages, err := strconv.Atoi(val); err == nil {
+			cfg.PDFMaxPages = pages
+		}
+	}
+	if val, ok := configs["max_chunks_per_document"]; ok {
+		if limit, err := strconv.Atoi(val); err == nil {
+			cfg.MaxChunksPerDocument = limit
+		}
+	}
+	if val, ok := configs["chunk_limit_action"]; ok {
+		switch action := ChunkLimitAction(val); action {
+		case ChunkLimitReject, ChunkLimitTruncate:
+			cfg.ChunkLimitAction = action
+		}
+	}
+
+	// 更新统计配置
+	if val, ok := configs["stats_detail_limit"]; ok {
+		if limit, err := strconv.Atoi(val); err == nil {
+			cfg.StatsDetailLimit = limit
+		}
+	}
+
+	// 更新一致性检查配置
+	if val, ok := configs["consistency_check_interval"]; ok {
+		if seconds, err := strconv.Atoi(val); err == nil {
+			cfg.ConsistencyCheckInterval = time.Duration(seconds) * time.Second
+		}
+	}
+	if val, ok := configs["consistency_auto_cleanup"]; ok {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			cfg.ConsistencyAutoCleanup = enabled
+		}
+	}
+
+	// 更新文档保留期限配置
+	if val, ok := configs["retention_check_interval"]; ok {
+		if seconds, err := strconv.Atoi(val); err == nil {
+			cfg.RetentionCheckInterval = time.Duration(seconds) * time.Second
+		}
+	}
+	if val, ok := configs["kb_delete_grace_period"]; ok {
+		if seconds, err := strconv.Atoi(val); err == nil {
+			cfg.KBDeleteGracePeriod = time.Duration(seconds) * time.Second
+		}
+	}
 	
 	// 更新OpenAI API Key
 	if val, ok := configs["openai_api_key"]; ok && val != "" {
@@ -272,6 +941,13 @@ func UpdateFromDB(configs map[string]string) {
 		}
 	}
 	
+	if val, ok := configs["embedding_dimension_mode"]; ok {
+		switch mode := EmbeddingDimensionMode(val); mode {
+		case EmbeddingDimensionStrict, EmbeddingDimensionAuto:
+			cfg.EmbeddingDimensionMode = mode
+		}
+	}
+	
 	// 更新Milvus额外配置
 	if val, ok := configs["metric_type"]; ok && val != "" {
 		cfg.MetricType = val
@@ -279,6 +955,21 @@ func UpdateFromDB(configs map[string]string) {
 	if val, ok := configs["index_type"]; ok && val != "" {
 		cfg.IndexType = val
 	}
+	if val, ok := configs["milvus_search_nprobe"]; ok {
+		if nprobe, err := strconv.Atoi(val); err == nil {
+			cfg.MilvusSearchNprobe = nprobe
+		}
+	}
+	if val, ok := configs["milvus_search_ef"]; ok {
+		if ef, err := strconv.Atoi(val); err == nil {
+			cfg.MilvusSearchEf = ef
+		}
+	}
+	if val, ok := configs["milvus_kb_partitions"]; ok {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			cfg.MilvusKBPartitions = enabled
+		}
+	}
 	
 	// 更新嵌入缓存配置
 	if val, ok := configs["embedding_cache"]; ok {
@@ -286,6 +977,161 @@ func UpdateFromDB(configs map[string]string) {
 			cfg.EmbeddingCache = cache
 		}
 	}
+	if val, ok := configs["embedding_skip_failed_chunks"]; ok {
+		if skip, err := strconv.ParseBool(val); err == nil {
+			cfg.EmbeddingSkipFailedChunks = skip
+		}
+	}
+	if val, ok := configs["embedding_concurrency"]; ok {
+		if concurrency, err := strconv.Atoi(val); err == nil {
+			cfg.EmbeddingConcurrency = concurrency
+		}
+	}
+	if val, ok := configs["embedding_max_retries"]; ok {
+		if retries, err := strconv.Atoi(val); err == nil {
+			cfg.EmbeddingMaxRetries = retries
+		}
+	}
+	if val, ok := configs["embedding_retry_backoff_ms"]; ok {
+		if backoff, err := strconv.Atoi(val); err == nil && backoff >= 0 {
+			cfg.EmbeddingRetryBackoff = time.Duration(backoff) * time.Millisecond
+		}
+	}
+	if val, ok := configs["contextual_embedding"]; ok {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			cfg.ContextualEmbedding = enabled
+		}
+	}
+	if val, ok := configs["retrieval_cache"]; ok {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			cfg.RetrievalCache = enabled
+		}
+	}
+	if val, ok := configs["retrieval_cache_ttl"]; ok {
+		if seconds, err := strconv.Atoi(val); err == nil {
+			cfg.RetrievalCacheTTL = time.Duration(seconds) * time.Second
+		}
+	}
+	if val, ok := configs["query_expansion"]; ok {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			cfg.QueryExpansion = enabled
+		}
+	}
+	if val, ok := configs["query_expansion_method"]; ok {
+		if method := QueryExpansionMethod(val); method == QueryExpansionSynonyms || method == QueryExpansionLLM {
+			cfg.QueryExpansionMethod = method
+		}
+	}
+	if val, ok := configs["query_expansion_variants"]; ok {
+		if variants, err := strconv.Atoi(val); err == nil {
+			cfg.QueryExpansionVariants = variants
+		}
+	}
+	if val, ok := configs["query_expansion_synonyms"]; ok {
+		cfg.QueryExpansionSynonyms = val
+	}
+	if val, ok := configs["query_expansion_cache_ttl"]; ok {
+		if seconds, err := strconv.Atoi(val); err == nil {
+			cfg.QueryExpansionCacheTTL = time.Duration(seconds) * time.Second
+		}
+	}
+	if val, ok := configs["rag_fallback"]; ok {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			cfg.RAGFallback = enabled
+		}
+	}
+	if val, ok := configs["rag_fallback_max_docs"]; ok {
+		if maxDocs, err := strconv.Atoi(val); err == nil && maxDocs > 0 {
+			cfg.RAGFallbackMaxDocs = maxDocs
+		}
+	}
+	if val, ok := configs["rag_strict"]; ok {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			cfg.RAGStrict = enabled
+		}
+	}
+	if val, ok := configs["recency_half_life_days"]; ok {
+		if days, err := strconv.ParseFloat(val, 64); err == nil && days > 0 {
+			cfg.RecencyHalfLifeDays = days
+		}
+	}
+	if val, ok := configs["max_chunks_per_doc"]; ok {
+		if limit, err := strconv.Atoi(val); err == nil && limit >= 0 {
+			cfg.MaxChunksPerDoc = limit
+		}
+	}
+	if val, ok := configs["retrieval_candidate_multiplier"]; ok {
+		if multiplier, err := strconv.Atoi(val); err == nil && multiplier >= 1 {
+			cfg.RetrievalCandidateMultiplier = multiplier
+		}
+	}
+	if val, ok := configs["hybrid_alpha"]; ok {
+		if alpha, err := strconv.ParseFloat(val, 64); err == nil && alpha >= 0 && alpha <= 1 {
+			cfg.HybridAlpha = alpha
+		}
+	}
+	if val, ok := configs["retrieval_mmr"]; ok {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			cfg.RetrievalMMR = enabled
+		}
+	}
+	if val, ok := configs["retrieval_mmr_lambda"]; ok {
+		if lambda, err := strconv.ParseFloat(val, 64); err == nil && lambda >= 0 && lambda <= 1 {
+			cfg.RetrievalMMRLambda = lambda
+		}
+	}
+	if val, ok := configs["semantic_cache"]; ok {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			cfg.SemanticCache = enabled
+		}
+	}
+	if val, ok := configs["semantic_cache_threshold"]; ok {
+		if threshold, err := strconv.ParseFloat(val, 64); err == nil && threshold > 0 && threshold <= 1 {
+			cfg.SemanticCacheThreshold = threshold
+		}
+	}
+	if val, ok := configs["semantic_cache_max_entries"]; ok {
+		if entries, err := strconv.Atoi(val); err == nil && entries > 0 {
+			cfg.SemanticCacheMaxEntries = entries
+		}
+	}
+	if val, ok := configs["semantic_cache_ttl"]; ok {
+		if seconds, err := strconv.Atoi(val); err == nil && seconds > 0 {
+			cfg.SemanticCacheTTL = time.Duration(seconds) * time.Second
+		}
+	}
+	
+	// 更新文档摘要配置
+	if val, ok := configs["summary_enabled"]; ok {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			cfg.SummaryEnabled = enabled
+		}
+	}
+	if val, ok := configs["summary_min_length"]; ok {
+		if length, err := strconv.Atoi(val); err == nil {
+			cfg.SummaryMinLength = length
+		}
+	}
+	if val, ok := configs["summary_max_input_length"]; ok {
+		if length, err := strconv.Atoi(val); err == nil {
+			cfg.SummaryMaxInputLength = length
+		}
+	}
+	if val, ok := configs["summary_index_chunk"]; ok {
+		if index, err := strconv.ParseBool(val); err == nil {
+			cfg.SummaryIndexChunk = index
+		}
+	}
+	if val, ok := configs["document_preview_length"]; ok {
+		if length, err := strconv.Atoi(val); err == nil {
+			cfg.DocumentPreviewLength = length
+		}
+	}
+	if val, ok := configs["dedup_normalize"]; ok {
+		if normalize, err := strconv.ParseBool(val); err == nil {
+			cfg.DedupNormalize = normalize
+		}
+	}
 	
 	// 更新文件类型配置
 	if val, ok := configs["allowed_file_types"]; ok && val != "" {
@@ -299,6 +1145,25 @@ func UpdateFromDB(configs map[string]string) {
 		}
 	}
 	
+	if val, ok := configs["upload_session_ttl"]; ok {
+		if ttl, err := strconv.Atoi(val); err == nil {
+			cfg.UploadSessionTTL = time.Duration(ttl) * time.Second
+		}
+	}
+	if val, ok := configs["upload_job_ttl"]; ok {
+		if ttl, err := strconv.Atoi(val); err == nil {
+			cfg.UploadJobTTL = time.Duration(ttl) * time.Second
+		}
+	}
+
+	// 更新元数据允许列表，允许设置为空
+	if val, ok := configs["chunk_metadata_keys"]; ok {
+		cfg.ChunkMetadataKeys = splitList(val)
+	}
+	if val, ok := configs["response_metadata_keys"]; ok {
+		cfg.ResponseMetadataKeys = splitList(val)
+	}
+
 	// 更新超时配置
 	if val, ok := configs["index_timeout"]; ok {
 		if timeout, err := strconv.Atoi(val); err == nil {
@@ -315,6 +1180,46 @@ func UpdateFromDB(configs map[string]string) {
 			cfg.EmbeddingTimeout = time.Duration(timeout) * time.Second
 		}
 	}
+	if val, ok := configs["milvus_search_timeout"]; ok {
+		if timeout, err := strconv.Atoi(val); err == nil {
+			cfg.MilvusSearchTimeout = time.Duration(timeout) * time.Second
+		}
+	}
+	if val, ok := configs["openai_timeout"]; ok {
+		if timeout, err := strconv.Atoi(val); err == nil {
+			cfg.OpenAITimeout = time.Duration(timeout) * time.Second
+		}
+	}
+	if val, ok := configs["request_timeout"]; ok {
+		if timeout, err := strconv.Atoi(val); err == nil {
+			cfg.RequestTimeout = time.Duration(timeout) * time.Second
+		}
+	}
+	if val, ok := configs["request_timeout_long"]; ok {
+		if timeout, err := strconv.Atoi(val); err == nil {
+			cfg.LongRequestTimeout = time.Duration(timeout) * time.Second
+		}
+	}
+	if val, ok := configs["embedding_max_idle_conns"]; ok {
+		if conns, err := strconv.Atoi(val); err == nil {
+			cfg.EmbeddingMaxIdleConns = conns
+		}
+	}
+	if val, ok := configs["embedding_max_idle_conns_per_host"]; ok {
+		if conns, err := strconv.Atoi(val); err == nil {
+			cfg.EmbeddingMaxIdleConnsPerHost = conns
+		}
+	}
+	if val, ok := configs["embedding_idle_conn_timeout"]; ok {
+		if timeout, err := strconv.Atoi(val); err == nil {
+			cfg.EmbeddingIdleConnTimeout = time.Duration(timeout) * time.Second
+		}
+	}
+	if val, ok := configs["embedding_keep_alive"]; ok {
+		if interval, err := strconv.Atoi(val); err == nil {
+			cfg.EmbeddingKeepAlive = time.Duration(interval) * time.Second
+		}
+	}
 	if val, ok := configs["milvus_connect_timeout"]; ok {
 		if timeout, err := strconv.Atoi(val); err == nil {
 			cfg.MilvusConnectTimeout = time.Duration(timeout) * time.Second
@@ -330,4 +1235,36 @@ func UpdateFromDB(configs map[string]string) {
 			cfg.GRPCKeepaliveTimeout = time.Duration(timeout) * time.Second
 		}
 	}
+	
+	// 更新Milvus重试与熔断配置
+	if val, ok := configs["milvus_max_retries"]; ok {
+		if retries, err := strconv.Atoi(val); err == nil {
+			cfg.MilvusMaxRetries = retries
+		}
+	}
+	if val, ok := configs["milvus_retry_backoff_ms"]; ok {
+		if backoff, err := strconv.Atoi(val); err == nil {
+			cfg.MilvusRetryBackoff = time.Duration(backoff) * time.Millisecond
+		}
+	}
+	if val, ok := configs["milvus_breaker_threshold"]; ok {
+		if threshold, err := strconv.Atoi(val); err == nil {
+			cfg.MilvusBreakerThreshold = threshold
+		}
+	}
+	if val, ok := configs["milvus_breaker_timeout"]; ok {
+		if timeout, err := strconv.Atoi(val); err == nil {
+			cfg.MilvusBreakerTimeout = time.Duration(timeout) * time.Second
+		}
+	}
+	if val, ok := configs["milvus_health_check_interval"]; ok {
+		if seconds, err := strconv.Atoi(val); err == nil && seconds > 0 {
+			cfg.MilvusHealthCheckInterval = time.Duration(seconds) * time.Second
+		}
+	}
+	if val, ok := configs["milvus_health_check_timeout"]; ok {
+		if seconds, err := strconv.Atoi(val); err == nil && seconds > 0 {
+			cfg.MilvusHealthCheckTimeout = time.Duration(seconds) * time.Second
+		}
+	}
 }
\ No newline at end of file
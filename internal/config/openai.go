@@ -0,0 +1,97 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// OpenAI 出站访问
+//
+// OpenAIBaseURL 可以通过系统配置修改，为防止被改到任意地址，基础地址必须满足：
+//   - 配置了 OpenAIAllowedHosts 时，主机必须在列表中（*.example.com 匹配其子域名）
+//   - 使用 https；主机在 OpenAIAllowedHosts 中明确列出时允许 http，用于内网部署的模型服务
+//
+// OpenAIAllowedHosts 和 OpenAIProxyURL 只能通过环境变量设置，不能通过系统配置修改。
+
+// ErrOpenAIBaseURLNotAllowed OpenAI 基础地址不满足出站限制
+var ErrOpenAIBaseURLNotAllowed = errors.New("openai base url is not allowed")
+
+// ValidateOpenAIBaseURL 检查 OpenAI 基础地址是否允许访问，空值表示使用官方地址
+func ValidateOpenAIBaseURL(raw string, allowedHosts []string) error {
+	if raw == "" {
+		return nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return fmt.Errorf("%w: invalid url %q", ErrOpenAIBaseURLNotAllowed, raw)
+	}
+	host := strings.ToLower(u.Hostname())
+
+	allowed, explicit := hostAllowed(host, allowedHosts)
+	if !allowed {
+		return fmt.Errorf("%w: host %q is not in OPENAI_ALLOWED_HOSTS", ErrOpenAIBaseURLNotAllowed, host)
+	}
+
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if explicit {
+			return nil
+		}
+		return fmt.Errorf("%w: http is only allowed for hosts listed in OPENAI_ALLOWED_HOSTS", ErrOpenAIBaseURLNotAllowed)
+	default:
+		return fmt.Errorf("%w: unsupported scheme %q", ErrOpenAIBaseURLNotAllowed, u.Scheme)
+	}
+}
+
+// ValidateProxyURL 检查代理地址，空值表示使用环境变量中的代理设置
+func ValidateProxyURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid proxy url %q", raw)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+		return nil
+	default:
+		return fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+}
+
+// hostAllowed 判断主机是否在允许列表中，列表为空时不限制主机
+// explicit 表示主机与列表中的某一项完全一致
+func hostAllowed(host string, allowedHosts []string) (allowed, explicit bool) {
+	if len(allowedHosts) == 0 {
+		return true, false
+	}
+
+	for _, pattern := range allowedHosts {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == host {
+			return true, true
+		}
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok && strings.HasSuffix(host, "."+suffix) {
+			allowed = true
+		}
+	}
+	return allowed, false
+}
+
+// splitList 按逗号拆分配置值，去掉空白和空项
+func splitList(val string) []string {
+	var items []string
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"reflect"
+	"slices"
+	"sync"
+)
+
+// 并发访问与变更通知
+//
+// 全局配置会被 UpdateFromDB 在运行时修改，请求处理过程中读取配置时应使用 Snapshot()
+// 取得一份一致的副本，而不是直接读取共享配置的字段。只在启动时设置的字段（如端口、密钥）不受影响。
+// 需要在配置变更后重建资源的服务可以通过 Subscribe 注册回调。
+
+// mu 保护全局配置的字段，UpdateFromDB 持有写锁，Snapshot 持有读锁
+var mu sync.RWMutex
+
+// Subscriber 配置变更回调，参数为变更前后的配置快照，不能修改
+type Subscriber func(old, updated *Config)
+
+var (
+	subscribersMu sync.Mutex
+	subscribers   = map[int]Subscriber{}
+	nextSubID     int
+)
+
+// Snapshot 返回配置的副本，副本不会随之后的配置更新变化，可以在一次请求中安全地多次读取
+func (c *Config) Snapshot() *Config {
+	mu.RLock()
+	defer mu.RUnlock()
+	return c.clone()
+}
+
+// clone 复制配置，切片字段也一并复制，调用方需要持有锁
+func (c *Config) clone() *Config {
+	snapshot := *c
+	snapshot.AllowedFileTypes = slices.Clone(c.AllowedFileTypes)
+	snapshot.OpenAIAllowedHosts = slices.Clone(c.OpenAIAllowedHosts)
+	snapshot.OpenAIUnsupportedParams = slices.Clone(c.OpenAIUnsupportedParams)
+	snapshot.ChunkMetadataKeys = slices.Clone(c.ChunkMetadataKeys)
+	snapshot.ResponseMetadataKeys = slices.Clone(c.ResponseMetadataKeys)
+	snapshot.AnswerFilters = slices.Clone(c.AnswerFilters)
+	snapshot.CompressionContentTypes = slices.Clone(c.CompressionContentTypes)
+	snapshot.AnswerProfanityWords = slices.Clone(c.AnswerProfanityWords)
+	return &snapshot
+}
+
+// Subscribe 注册配置变更回调，返回取消注册的函数
+// 回调在 UpdateFromDB 修改配置后同步调用，只在配置确实发生变化时调用
+func Subscribe(fn Subscriber) (unsubscribe func()) {
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+
+	id := nextSubID
+	nextSubID++
+	subscribers[id] = fn
+	return func() {
+		subscribersMu.Lock()
+		defer subscribersMu.Unlock()
+		delete(subscribers, id)
+	}
+}
+
+// notifySubscribers 按注册顺序通知配置变更
+func notifySubscribers(old, updated *Config) {
+	if reflect.DeepEqual(old, updated) {
+		return
+	}
+
+	subscribersMu.Lock()
+	ids := make([]int, 0, len(subscribers))
+	for id := range subscribers {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	callbacks := make([]Subscriber, 0, len(ids))
+	for _, id := range ids {
+		callbacks = append(callbacks, subscribers[id])
+	}
+	subscribersMu.Unlock()
+
+	for _, fn := range callbacks {
+		fn(old, updated)
+	}
+}
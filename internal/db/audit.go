@@ -0,0 +1,19 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"eino-rag/internal/models"
+)
+
+// RecordAudit 写入一条审计日志
+func RecordAudit(entry *models.AuditLog) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	if err := GetDB().Create(entry).Error; err != nil {
+		return fmt.Errorf("failed to record audit log: %w", err)
+	}
+	return nil
+}
@@ -36,6 +36,8 @@ func Init(cfg *config.Config) error {
 	var err error
 	db, err = gorm.Open(sqlite.Open(cfg.DBPath+"?_journal_mode=WAL&_busy_timeout=5000"), &gorm.Config{
 		Logger: internalLogger.Default.LogMode(logLevel),
+		// 违反唯一约束时返回 gorm.ErrDuplicatedKey，便于调用方区分名称冲突
+		TranslateError: true,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to connect to database: %w", err)
@@ -80,6 +82,11 @@ func GetDB() *gorm.DB {
 	return db
 }
 
+// SetDB 替换数据库实例，用于测试
+func SetDB(database *gorm.DB) {
+	db = database
+}
+
 // Close 关闭数据库连接
 func Close() error {
 	if db != nil {
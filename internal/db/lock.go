@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// 分布式锁
+//
+// 多副本部署时，清理、重建索引、重新统计等后台任务只应在一个节点上执行。
+// 用法：
+//
+//	lock, err := db.AcquireLock(ctx, "reindex:kb:1", 5*time.Minute)
+//	if errors.Is(err, db.ErrLockNotAcquired) {
+//		return // 其他节点正在执行
+//	}
+//	if err != nil {
+//		return err
+//	}
+//	defer db.ReleaseLock(context.Background(), lock)
+//
+// ttl 应大于任务的最长执行时间，持有者异常退出后锁会在 ttl 到期时自动释放；
+// 执行时间不确定的任务可定期调用 RefreshLock 续期。
+
+// ErrLockNotAcquired 锁已被其他持有者占用
+var ErrLockNotAcquired = errors.New("lock is held by another owner")
+
+// ErrLockNotHeld 锁已过期或已被其他持有者获取
+var ErrLockNotHeld = errors.New("lock is no longer held")
+
+// lockKeyPrefix 锁在Redis中的键前缀
+const lockKeyPrefix = "lock:"
+
+// Lock 已获取的分布式锁，Token 用于保证只有持有者能释放或续期
+type Lock struct {
+	Key   string
+	Token string
+}
+
+// releaseScript 仅当值与持有者的token一致时删除，避免误删他人在过期后获取的锁
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// refreshScript 仅当值与持有者的token一致时重置过期时间
+var refreshScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// AcquireLock 尝试获取分布式锁，锁已被占用时返回 ErrLockNotAcquired，不会等待
+func AcquireLock(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	if redisClient == nil {
+		return nil, fmt.Errorf("redis is not initialized")
+	}
+
+	lock := &Lock{
+		Key:   lockKeyPrefix + key,
+		Token: uuid.New().String(),
+	}
+	ok, err := redisClient.SetNX(ctx, lock.Key, lock.Token, ttl).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire lock %s: %w", key, err)
+	}
+	if !ok {
+		return nil, ErrLockNotAcquired
+	}
+	return lock, nil
+}
+
+// ReleaseLock 释放分布式锁，锁已过期或被他人持有时返回 ErrLockNotHeld
+func ReleaseLock(ctx context.Context, lock *Lock) error {
+	if lock == nil {
+		return nil
+	}
+
+	released, err := releaseScript.Run(ctx, redisClient, []string{lock.Key}, lock.Token).Int()
+	if err != nil {
+		return fmt.Errorf("failed to release lock %s: %w", lock.Key, err)
+	}
+	if released == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// RefreshLock 为仍由自己持有的锁续期，锁已过期或被他人持有时返回 ErrLockNotHeld
+func RefreshLock(ctx context.Context, lock *Lock, ttl time.Duration) error {
+	refreshed, err := refreshScript.Run(ctx, redisClient, []string{lock.Key}, lock.Token, ttl.Milliseconds()).Int()
+	if err != nil {
+		return fmt.Errorf("failed to refresh lock %s: %w", lock.Key, err)
+	}
+	if refreshed == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
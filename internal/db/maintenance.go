@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 维护模式
+//
+// 批量重建索引或迁移数据期间，上传、删除和修改配置等写操作会破坏正在进行的维护，
+// 管理员开启维护模式后这些接口返回503，检索、对话等读操作不受影响。
+// 后台写入同样暂停：保留期限清理和一致性检查跳过维护期间的周期，开启前已排队的异步上传和分片上传入库
+// 等待维护结束后再开始（见 WaitForMaintenance）。
+// 状态保存在Redis中，多副本同时生效；Redis未初始化时（单机开发环境）保存在进程内。
+
+// maintenanceKey 维护模式状态在Redis中的键
+const maintenanceKey = "system:maintenance"
+
+// maintenancePollInterval 等待维护结束时检查状态的间隔
+const maintenancePollInterval = time.Second
+
+// MaintenanceState 维护模式状态
+type MaintenanceState struct {
+	Enabled   bool      `json:"enabled"`
+	Reason    string    `json:"reason,omitempty"`
+	StartedBy uint      `json:"started_by,omitempty"`
+	StartedAt time.Time `json:"started_at,omitempty"`
+}
+
+// localMaintenance Redis未初始化时使用的进程内状态
+var (
+	localMaintenanceMu sync.RWMutex
+	localMaintenance   MaintenanceState
+)
+
+// GetMaintenance 返回当前的维护模式状态，未开启时返回 Enabled 为false的零值
+func GetMaintenance(ctx context.Context) (MaintenanceState, error) {
+	if redisClient == nil {
+		localMaintenanceMu.RLock()
+		defer localMaintenanceMu.RUnlock()
+		return localMaintenance, nil
+	}
+
+	var state MaintenanceState
+	data, err := redisClient.Get(ctx, maintenanceKey).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("failed to get maintenance state: %w", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("failed to unmarshal maintenance state: %w", err)
+	}
+	return state, nil
+}
+
+// SetMaintenance 开启或关闭维护模式，关闭时清除保存的状态
+// 维护模式一直保持到管理员关闭，不设置过期时间
+func SetMaintenance(ctx context.Context, state MaintenanceState) error {
+	if !state.Enabled {
+		state = MaintenanceState{}
+	}
+	if redisClient == nil {
+		localMaintenanceMu.Lock()
+		defer localMaintenanceMu.Unlock()
+		localMaintenance = state
+		return nil
+	}
+
+	if !state.Enabled {
+		return redisClient.Del(ctx, maintenanceKey).Err()
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal maintenance state: %w", err)
+	}
+	return redisClient.Set(ctx, maintenanceKey, data, 0).Err()
+}
+
+// WaitForMaintenance 维护模式开启时阻塞到维护结束或 ctx 结束，供排队的后台写入在开始前调用
+// 读取维护状态失败时不等待，与写接口的中间件一致
+func WaitForMaintenance(ctx context.Context) error {
+	for {
+		state, err := GetMaintenance(ctx)
+		if err != nil || !state.Enabled {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(maintenancePollInterval):
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"fmt"
+
+	"eino-rag/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 对话消息持久化
+//
+// Redis中的对话是工作副本，24小时无活动后过期。每次保存消息时同时按（对话ID, 序号）写入数据库，
+// 编辑消息时删除被替换的消息；读取对话时Redis中不存在则从数据库恢复，编辑后的对话和旧分支一样不会随Redis过期丢失。
+
+// persistMessages 在数据库中删除序号在 removed 中的消息并写入 msgs，同一序号的消息被覆盖
+func persistMessages(convID string, userID uint, removed []int64, msgs []models.ChatMessage) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if len(removed) > 0 {
+			if err := tx.Where("conversation_id = ? AND seq IN ?", convID, removed).
+				Delete(&models.ConversationMessage{}).Error; err != nil {
+				return fmt.Errorf("failed to delete persisted messages: %w", err)
+			}
+		}
+		if len(msgs) == 0 {
+			return nil
+		}
+
+		rows := make([]models.ConversationMessage, len(msgs))
+		for i, msg := range msgs {
+			rows[i] = models.ConversationMessage{
+				ConversationID: convID,
+				Seq:            msg.Seq,
+				UserID:         userID,
+				Message:        msg,
+			}
+		}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "conversation_id"}, {Name: "seq"}},
+			DoUpdates: clause.AssignmentColumns([]string{"message"}),
+		}).Create(&rows).Error; err != nil {
+			return fmt.Errorf("failed to persist messages: %w", err)
+		}
+		return nil
+	})
+}
+
+// loadPersistedConversation 从数据库读取对话的消息，没有消息时返回nil
+func loadPersistedConversation(convID string) (*models.Conversation, error) {
+	var rows []models.ConversationMessage
+	if err := db.Where("conversation_id = ?", convID).Order("seq ASC").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to load persisted messages: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	conv := &models.Conversation{
+		ID:        convID,
+		UserID:    rows[0].UserID,
+		Messages:  make([]models.ChatMessage, len(rows)),
+		CreatedAt: rows[0].CreatedAt,
+		UpdatedAt: rows[len(rows)-1].CreatedAt,
+	}
+	for i, row := range rows {
+		conv.Messages[i] = row.Message
+	}
+	return conv, nil
+}
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 查询扩展缓存
+//
+// 缓存 LLM 为查询生成的改写变体，相同的问题不必每次都调用模型。
+// 变体只与查询和模型有关，不随知识库变化，随 TTL 过期。
+
+const queryExpansionPrefix = "query:expansion:"
+
+// QueryExpansionCacheAvailable Redis是否可用于缓存查询变体
+func QueryExpansionCacheAvailable() bool {
+	return redisClient != nil
+}
+
+// GetCachedExpansion 读取缓存的查询变体，未命中时返回 false
+func GetCachedExpansion(ctx context.Context, key string) ([]string, bool, error) {
+	data, err := redisClient.Get(ctx, queryExpansionPrefix+key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var variants []string
+	if err := json.Unmarshal(data, &variants); err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal cached expansion: %w", err)
+	}
+	return variants, true, nil
+}
+
+// CacheExpansion 缓存查询变体
+func CacheExpansion(ctx context.Context, key string, variants []string, ttl time.Duration) error {
+	data, err := json.Marshal(variants)
+	if err != nil {
+		return err
+	}
+	return redisClient.Set(ctx, queryExpansionPrefix+key, data, ttl).Err()
+}
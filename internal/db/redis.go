@@ -44,6 +44,11 @@ func GetRedis() *redis.Client {
 	return redisClient
 }
 
+// SetRedis 替换Redis客户端，用于测试
+func SetRedis(client *redis.Client) {
+	redisClient = client
+}
+
 // CloseRedis 关闭Redis连接
 func CloseRedis() error {
 	if redisClient != nil {
@@ -54,6 +59,16 @@ func CloseRedis() error {
 
 // 对话相关的Redis操作
 
+// 对话及其序号计数器的有效期
+const conversationTTL = 24 * time.Hour
+
+// appendMaxAttempts 并发追加消息冲突时的最多尝试次数
+const appendMaxAttempts = 10
+
+func conversationKey(convID string) string {
+	return fmt.Sprintf("conversation:%s", convID)
+}
+
 // SaveConversation 保存对话到Redis
 func SaveConversation(ctx context.Context, conv *models.Conversation) error {
 	data, err := json.Marshal(conv)
@@ -61,14 +76,35 @@ func SaveConversation(ctx context.Context, conv *models.Conversation) error {
 		return fmt.Errorf("failed to marshal conversation: %w", err)
 	}
 
-	key := fmt.Sprintf("conversation:%s", conv.ID)
-	return redisClient.Set(ctx, key, data, 24*time.Hour).Err()
+	return redisClient.Set(ctx, conversationKey(conv.ID), data, conversationTTL).Err()
 }
 
-// GetConversation 从Redis获取对话
+// GetConversation 从Redis获取对话，消息按序号排列；Redis中已过期时从数据库恢复
 func GetConversation(ctx context.Context, convID string) (*models.Conversation, error) {
-	key := fmt.Sprintf("conversation:%s", convID)
-	data, err := redisClient.Get(ctx, key).Result()
+	key := conversationKey(convID)
+	conv, err := loadConversation(ctx, redisClient, key)
+	if err != nil || conv != nil {
+		return conv, err
+	}
+
+	conv, err = loadPersistedConversation(convID)
+	if err != nil || conv == nil {
+		return nil, err
+	}
+	data, err := json.Marshal(conv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal conversation: %w", err)
+	}
+	// 并发请求已经写入时保留Redis中的版本
+	if err := redisClient.SetNX(ctx, key, data, conversationTTL).Err(); err != nil {
+		return nil, fmt.Errorf("failed to restore conversation: %w", err)
+	}
+	return conv, nil
+}
+
+// loadConversation 读取并解析对话，不存在时返回nil
+func loadConversation(ctx context.Context, cmd redis.Cmdable, key string) (*models.Conversation, error) {
+	data, err := cmd.Get(ctx, key).Result()
 	if err != nil {
 		if err == redis.Nil {
 			return nil, nil
@@ -80,11 +116,131 @@ func GetConversation(ctx context.Context, convID string) (*models.Conversation,
 	if err := json.Unmarshal([]byte(data), &conv); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal conversation: %w", err)
 	}
+	conv.SortMessages()
 
 	return &conv, nil
 }
 
-// AddMessageToConversation 添加消息到对话
+// DeleteConversations 删除对话及其序号计数器
+func DeleteConversations(ctx context.Context, convIDs ...string) error {
+	if len(convIDs) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(convIDs)*2)
+	for _, convID := range convIDs {
+		keys = append(keys, conversationKey(convID), conversationKey(convID)+":seq")
+	}
+	return redisClient.Del(ctx, keys...).Err()
+}
+
+// ReserveMessageSeqs 为对话预留 n 个连续的消息序号，返回第一个序号
+// 序号在请求开始时分配，先发送的消息即使后保存（如流式回复完成后异步保存）也排在前面
+func ReserveMessageSeqs(ctx context.Context, conv *models.Conversation, n int) (int64, error) {
+	key := conversationKey(conv.ID) + ":seq"
+	// 计数器不存在时（新对话、旧对话或计数器已过期）从已有消息的最大序号开始
+	if err := redisClient.SetNX(ctx, key, conv.LastSeq(), conversationTTL).Err(); err != nil {
+		return 0, fmt.Errorf("failed to reserve message sequence: %w", err)
+	}
+	last, err := redisClient.IncrBy(ctx, key, int64(n)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to reserve message sequence: %w", err)
+	}
+	redisClient.Expire(ctx, key, conversationTTL)
+	return last - int64(n) + 1, nil
+}
+
+// AppendMessages 将消息并入Redis中最新的对话并保存，conv 更新为保存后的对话，返回对话此前是否不存在
+// 使用 WATCH 在读取和写入之间检测并发修改，冲突时重读后重试，并发请求和异步保存不会互相覆盖
+func AppendMessages(ctx context.Context, conv *models.Conversation, msgs ...models.ChatMessage) (bool, error) {
+	return mergeMessages(ctx, conv, nil, msgs)
+}
+
+// ReplaceMessages 从Redis中最新的对话删除序号在 removed 中的消息并加入 msgs，conv 更新为保存后的对话
+// 与 AppendMessages 一样检测并发修改，编辑期间其他请求追加的消息不会丢失
+func ReplaceMessages(ctx context.Context, conv *models.Conversation, removed []int64, msgs ...models.ChatMessage) error {
+	_, err := mergeMessages(ctx, conv, removed, msgs)
+	return err
+}
+
+// mergeMessages 读取最新的对话（Redis中已过期时从数据库恢复），删除序号在 removed 中的消息并加入 msgs 后保存
+// 对话不存在时新建，但要删除消息时返回错误
+func mergeMessages(ctx context.Context, conv *models.Conversation, removed []int64, msgs []models.ChatMessage) (bool, error) {
+	key := conversationKey(conv.ID)
+	var created bool
+	var saved *models.Conversation
+	txf := func(tx *redis.Tx) error {
+		latest, err := loadConversation(ctx, tx, key)
+		if err == nil && latest == nil {
+			latest, err = loadPersistedConversation(conv.ID)
+		}
+		if err != nil {
+			return err
+		}
+		created = latest == nil
+		if created && len(removed) > 0 {
+			return fmt.Errorf("conversation not found")
+		}
+		if created {
+			latest = &models.Conversation{
+				ID:        conv.ID,
+				UserID:    conv.UserID,
+				CreatedAt: conv.CreatedAt,
+			}
+		}
+		if len(removed) > 0 {
+			drop := make(map[int64]bool, len(removed))
+			for _, seq := range removed {
+				drop[seq] = true
+			}
+			kept := latest.Messages[:0]
+			for _, msg := range latest.Messages {
+				if !drop[msg.Seq] {
+					kept = append(kept, msg)
+				}
+			}
+			latest.Messages = kept
+		}
+		latest.Messages = append(latest.Messages, msgs...)
+		latest.SortMessages()
+		latest.UpdatedAt = time.Now()
+
+		// 先写数据库再写Redis，Redis写入冲突重试时重复写入同样的内容
+		persisted := msgs
+		if len(removed) > 0 {
+			// 编辑时写入完整的对话，补齐持久化之前保存的消息
+			persisted = latest.Messages
+		}
+		if err := persistMessages(conv.ID, latest.UserID, removed, persisted); err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(latest)
+		if err != nil {
+			return fmt.Errorf("failed to marshal conversation: %w", err)
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, conversationTTL)
+			return nil
+		})
+		saved = latest
+		return err
+	}
+
+	for attempt := 0; attempt < appendMaxAttempts; attempt++ {
+		err := redisClient.Watch(ctx, txf, key)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		*conv = *saved
+		return created, nil
+	}
+	return false, fmt.Errorf("failed to save conversation: too many concurrent updates")
+}
+
+// AddMessageToConversation 添加消息到对话，消息没有序号时分配下一个序号
 func AddMessageToConversation(ctx context.Context, convID string, msg *models.ChatMessage) error {
 	conv, err := GetConversation(ctx, convID)
 	if err != nil {
@@ -95,10 +251,16 @@ func AddMessageToConversation(ctx context.Context, convID string, msg *models.Ch
 		return fmt.Errorf("conversation not found")
 	}
 
-	conv.Messages = append(conv.Messages, *msg)
-	conv.UpdatedAt = time.Now()
+	if msg.Seq == 0 {
+		seq, err := ReserveMessageSeqs(ctx, conv, 1)
+		if err != nil {
+			return err
+		}
+		msg.Seq = seq
+	}
 
-	return SaveConversation(ctx, conv)
+	_, err = AppendMessages(ctx, conv, *msg)
+	return err
 }
 
 // 缓存相关的Redis操作
@@ -130,6 +292,23 @@ func CacheGet(ctx context.Context, key string, dest interface{}) error {
 	return nil
 }
 
+// CacheTake 获取并删除缓存，缓存不存在时返回false；并发调用时只有一个能取到
+func CacheTake(ctx context.Context, key string, dest interface{}) (bool, error) {
+	data, err := redisClient.GetDel(ctx, key).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get cache: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(data), dest); err != nil {
+		return false, fmt.Errorf("failed to unmarshal cache data: %w", err)
+	}
+
+	return true, nil
+}
+
 // CacheDelete 删除缓存
 func CacheDelete(ctx context.Context, keys ...string) error {
 	if len(keys) == 0 {
@@ -149,9 +328,14 @@ func CacheExists(ctx context.Context, key string) (bool, error) {
 
 // 向量缓存相关
 
-// CacheEmbedding 缓存文本的向量
-func CacheEmbedding(ctx context.Context, text string, embedding []float32) error {
-	key := fmt.Sprintf("embedding:%x", hashString(text))
+// embeddingCacheKey 向量缓存的键，按生成向量的服务和模型区分，不同模型的向量不能混用
+func embeddingCacheKey(model, text string) string {
+	return fmt.Sprintf("embedding:%s:%x", model, hashString(text))
+}
+
+// CacheEmbedding 缓存文本的向量，model 标识生成向量的服务和模型
+func CacheEmbedding(ctx context.Context, model, text string, embedding []float32) error {
+	key := embeddingCacheKey(model, text)
 	data, err := json.Marshal(embedding)
 	if err != nil {
 		return err
@@ -159,9 +343,9 @@ func CacheEmbedding(ctx context.Context, text string, embedding []float32) error
 	return redisClient.Set(ctx, key, data, 7*24*time.Hour).Err()
 }
 
-// GetCachedEmbedding 获取缓存的向量
-func GetCachedEmbedding(ctx context.Context, text string) ([]float32, error) {
-	key := fmt.Sprintf("embedding:%x", hashString(text))
+// GetCachedEmbedding 获取指定服务和模型缓存的向量
+func GetCachedEmbedding(ctx context.Context, model, text string) ([]float32, error) {
+	key := embeddingCacheKey(model, text)
 	data, err := redisClient.Get(ctx, key).Result()
 	if err != nil {
 		if err == redis.Nil {
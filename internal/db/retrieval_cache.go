@@ -0,0 +1,114 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 检索结果缓存
+//
+// 缓存键包含知识库的版本号，知识库文档变更时递增版本号即可让旧缓存失效，
+// 旧条目不再被命中，随 TTL 自然过期。
+
+const (
+	retrievalResultPrefix  = "retrieval:result:"
+	retrievalVersionPrefix = "retrieval:version:"
+)
+
+// CachedHit 缓存的单条检索结果，只保存分块ID和分数，内容从数据库读取
+type CachedHit struct {
+	ID    string  `json:"id"`
+	Score float64 `json:"score"`
+	KBID  uint    `json:"kb_id"`
+	DocID uint    `json:"doc_id"`
+}
+
+// RetrievalCacheAvailable Redis是否可用于检索结果缓存
+func RetrievalCacheAvailable() bool {
+	return redisClient != nil
+}
+
+// RetrievalCacheVersion 获取知识库当前的缓存版本号，从未变更过时为0
+func RetrievalCacheVersion(ctx context.Context, kbID uint) (int64, error) {
+	version, err := redisClient.Get(ctx, fmt.Sprintf("%s%d", retrievalVersionPrefix, kbID)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return version, err
+}
+
+// InvalidateRetrievalCache 递增知识库的缓存版本号，使该知识库已缓存的检索结果失效
+func InvalidateRetrievalCache(ctx context.Context, kbID uint) error {
+	if redisClient == nil {
+		return nil
+	}
+	return redisClient.Incr(ctx, fmt.Sprintf("%s%d", retrievalVersionPrefix, kbID)).Err()
+}
+
+// GetCachedRetrieval 读取缓存的检索结果，未命中时返回 false
+func GetCachedRetrieval(ctx context.Context, key string) ([]CachedHit, bool, error) {
+	data, err := redisClient.Get(ctx, retrievalResultPrefix+key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var hits []CachedHit
+	if err := json.Unmarshal(data, &hits); err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal cached retrieval: %w", err)
+	}
+	return hits, true, nil
+}
+
+// CacheRetrieval 缓存检索结果
+func CacheRetrieval(ctx context.Context, key string, hits []CachedHit, ttl time.Duration) error {
+	data, err := json.Marshal(hits)
+	if err != nil {
+		return err
+	}
+	return redisClient.Set(ctx, retrievalResultPrefix+key, data, ttl).Err()
+}
+
+// ClearRetrievalCache 删除所有缓存的检索结果，返回删除的数量
+func ClearRetrievalCache(ctx context.Context) (int64, error) {
+	return deleteKeys(ctx, retrievalResultPrefix+"*")
+}
+
+// deleteKeys 分批删除匹配 pattern 的所有键，返回删除的数量
+func deleteKeys(ctx context.Context, pattern string) (int64, error) {
+	if redisClient == nil {
+		return 0, fmt.Errorf("redis is not initialized")
+	}
+
+	var deleted int64
+	iter := redisClient.Scan(ctx, 0, pattern, 500).Iterator()
+	keys := make([]string, 0, 500)
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == cap(keys) {
+			n, err := redisClient.Del(ctx, keys...).Result()
+			if err != nil {
+				return deleted, err
+			}
+			deleted += n
+			keys = keys[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return deleted, err
+	}
+	if len(keys) > 0 {
+		n, err := redisClient.Del(ctx, keys...).Result()
+		if err != nil {
+			return deleted, err
+		}
+		deleted += n
+	}
+	return deleted, nil
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// 语义缓存
+//
+// 每个知识库的缓存回答保存在一个Redis列表中，最新的在前，超过上限的旧条目被裁剪。
+// 键包含知识库的检索缓存版本号，知识库文档变更后旧列表不再被读取，随 TTL 过期。
+// 查找时读取整个列表并在内存中比较向量，条目数量由上限控制。
+
+const semanticCachePrefix = "semantic:answer:"
+
+// SemanticCacheEntry 缓存的回答及其问题向量
+type SemanticCacheEntry struct {
+	Query       string    `json:"query"`
+	Embedding   []float32 `json:"embedding"`
+	Fingerprint string    `json:"fingerprint"` // 影响回答的参数摘要，不同参数的条目互不复用
+	Answer      string    `json:"answer"`
+	Context     string    `json:"context,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func semanticCacheKey(kbID uint, version int64) string {
+	return fmt.Sprintf("%s%d:%d", semanticCachePrefix, kbID, version)
+}
+
+// GetSemanticCacheEntries 读取知识库当前版本的所有缓存回答，最新的在前
+func GetSemanticCacheEntries(ctx context.Context, kbID uint, version int64) ([]SemanticCacheEntry, error) {
+	values, err := redisClient.LRange(ctx, semanticCacheKey(kbID, version), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]SemanticCacheEntry, 0, len(values))
+	for _, value := range values {
+		var entry SemanticCacheEntry
+		if err := json.Unmarshal([]byte(value), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// AddSemanticCacheEntry 保存缓存回答，列表只保留最新的 maxEntries 条
+func AddSemanticCacheEntry(ctx context.Context, kbID uint, version int64, entry SemanticCacheEntry, maxEntries int, ttl time.Duration) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	key := semanticCacheKey(kbID, version)
+	pipe := redisClient.TxPipeline()
+	pipe.LPush(ctx, key, data)
+	pipe.LTrim(ctx, key, 0, int64(maxEntries-1))
+	pipe.Expire(ctx, key, ttl)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// ClearSemanticCache 删除所有语义缓存的回答，返回删除的列表数量
+func ClearSemanticCache(ctx context.Context) (int64, error) {
+	return deleteKeys(ctx, semanticCachePrefix+"*")
+}
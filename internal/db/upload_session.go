@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"eino-rag/internal/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 分片上传会话
+//
+// 会话只保存上传进度，已接收的内容保存在本地文件中，见 document.Service 的分片上传。
+// 每次更新会话都会重置过期时间，长时间没有新分片的会话由Redis自动删除。
+
+// uploadSessionPrefix 会话在Redis中的键前缀
+const uploadSessionPrefix = "upload:session:"
+
+// ErrUploadSessionNotFound 会话不存在或已过期
+var ErrUploadSessionNotFound = errors.New("upload session not found or expired")
+
+// UploadSessionsAvailable Redis是否可用于保存分片上传会话
+func UploadSessionsAvailable() bool {
+	return redisClient != nil
+}
+
+// SaveUploadSession 保存会话，ttl 后过期
+func SaveUploadSession(ctx context.Context, session *models.UploadSession, ttl time.Duration) error {
+	session.ExpiresAt = time.Now().Add(ttl)
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal upload session: %w", err)
+	}
+	return redisClient.Set(ctx, uploadSessionPrefix+session.ID, data, ttl).Err()
+}
+
+// GetUploadSession 获取会话，不存在时返回 ErrUploadSessionNotFound
+func GetUploadSession(ctx context.Context, id string) (*models.UploadSession, error) {
+	data, err := redisClient.Get(ctx, uploadSessionPrefix+id).Bytes()
+	if err == redis.Nil {
+		return nil, ErrUploadSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get upload session: %w", err)
+	}
+
+	var session models.UploadSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal upload session: %w", err)
+	}
+	return &session, nil
+}
+
+// DeleteUploadSession 删除会话
+func DeleteUploadSession(ctx context.Context, id string) error {
+	return redisClient.Del(ctx, uploadSessionPrefix+id).Err()
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"eino-rag/internal/auth"
+	"eino-rag/internal/models"
+	"eino-rag/internal/response"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// CreateAPIKey 创建API密钥
+// @Summary 创建API密钥
+// @Description 为当前用户创建API密钥，用于脚本等程序化访问。请求时在 X-API-Key 头中携带密钥即可代替 Bearer token，权限与当前用户的角色相同。
+// @Description 明文密钥只在本次响应的 key 字段中返回，服务端只保存其哈希，请妥善保存
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body models.CreateAPIKeyRequest true "密钥名称"
+// @Success 201 {object} response.Envelope{data=models.CreateAPIKeyResponse} "创建成功"
+// @Failure 400 {object} ErrorResponse "请求参数错误"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Router /api/auth/api-keys [post]
+func (h *AuthHandler) CreateAPIKey(c *gin.Context) {
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request data")
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	apiKey, key, err := auth.CreateAPIKey(userID, req.Name)
+	if err != nil {
+		h.logger.Error("Failed to create API key", zap.Uint("user_id", userID), zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to create API key")
+		return
+	}
+
+	h.logger.Info("API key created",
+		zap.Uint("user_id", userID),
+		zap.Uint("api_key_id", apiKey.ID),
+		zap.String("prefix", apiKey.Prefix))
+	response.JSON(c, http.StatusCreated, models.CreateAPIKeyResponse{
+		APIKey: *apiKey,
+		Key:    key,
+	})
+}
+
+// ListAPIKeys 获取API密钥列表
+// @Summary 获取API密钥列表
+// @Description 获取当前用户的API密钥，包括已撤销的。列表只包含密钥开头几位（prefix），不包含明文
+// @Tags 认证
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Envelope{data=APIKeyListResponse} "密钥列表"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Router /api/auth/api-keys [get]
+func (h *AuthHandler) ListAPIKeys(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	keys, err := auth.ListAPIKeys(userID)
+	if err != nil {
+		h.logger.Error("Failed to list API keys", zap.Uint("user_id", userID), zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to list API keys")
+		return
+	}
+
+	response.OK(c, APIKeyListResponse{APIKeys: keys})
+}
+
+// DeleteAPIKey 撤销API密钥
+// @Summary 撤销API密钥
+// @Description 撤销当前用户的API密钥，撤销后使用该密钥的请求立即返回401
+// @Tags 认证
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "密钥ID"
+// @Success 200 {object} response.Envelope{data=SuccessResponse} "撤销成功"
+// @Failure 400 {object} ErrorResponse "请求错误"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 404 {object} ErrorResponse "密钥不存在"
+// @Router /api/auth/api-keys/{id} [delete]
+func (h *AuthHandler) DeleteAPIKey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	err = auth.RevokeAPIKey(userID, uint(id))
+	if errors.Is(err, auth.ErrAPIKeyNotFound) {
+		response.Error(c, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to revoke API key", zap.Uint("user_id", userID), zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to revoke API key")
+		return
+	}
+
+	h.logger.Info("API key revoked", zap.Uint("user_id", userID), zap.Uint64("api_key_id", id))
+	response.OK(c, SuccessResponse{
+		Message: "API key revoked successfully",
+	})
+}
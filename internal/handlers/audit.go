@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// recordAudit 记录当前用户的操作到审计日志，写入失败只记录错误日志
+func recordAudit(c *gin.Context, logger *zap.Logger, action, resourceType string, resourceID uint, detail string) {
+	entry := &models.AuditLog{
+		UserID:       c.GetUint("user_id"),
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Detail:       detail,
+		IP:           c.ClientIP(),
+	}
+	if err := db.RecordAudit(entry); err != nil {
+		logger.Error("Failed to record audit log",
+			zap.String("action", action),
+			zap.Uint("resource_id", resourceID),
+			zap.Error(err))
+	}
+}
@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"eino-rag/internal/auth"
 	"eino-rag/internal/models"
+	"eino-rag/internal/response"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -27,22 +29,23 @@ func NewAuthHandler(logger *zap.Logger) *AuthHandler {
 // @Accept json
 // @Produce json
 // @Param request body models.RegisterRequest true "注册信息"
-// @Success 200 {object} models.User "注册成功"
-// @Failure 400 {object} ErrorResponse "请求参数错误"
+// @Success 200 {object} response.Envelope{data=UserResponse} "注册成功"
+// @Failure 400 {object} PasswordPolicyErrorResponse "请求参数错误或密码不符合密码策略"
 // @Failure 409 {object} ErrorResponse "邮箱已存在"
+// @Failure 429 {object} ErrorResponse "请求过于频繁"
 // @Router /api/auth/register [post]
 func (h *AuthHandler) Register(c *gin.Context) {
 	var req models.RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		h.logger.Error("Invalid register request", zap.Error(err))
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Success: false,
-			Message: "Invalid request data",
-		})
+		response.Error(c, http.StatusBadRequest, "Invalid request data")
 		return
 	}
 
 	user, err := auth.Register(&req)
+	if respondWeakPassword(c, err) {
+		return
+	}
 	if err != nil {
 		h.logger.Error("Failed to register user", zap.Error(err))
 		status := http.StatusInternalServerError
@@ -53,18 +56,12 @@ func (h *AuthHandler) Register(c *gin.Context) {
 			message = err.Error()
 		}
 		
-		c.JSON(status, ErrorResponse{
-			Success: false,
-			Message: message,
-		})
+		response.Error(c, status, message)
 		return
 	}
 
 	h.logger.Info("User registered successfully", zap.String("email", user.Email))
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"user":    user,
-	})
+	response.OK(c, UserResponse{User: user})
 }
 
 // Login 用户登录
@@ -74,18 +71,16 @@ func (h *AuthHandler) Register(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param request body models.LoginRequest true "登录信息"
-// @Success 200 {object} models.TokenResponse "登录成功"
+// @Success 200 {object} response.Envelope{data=models.TokenResponse} "登录成功"
 // @Failure 400 {object} ErrorResponse "请求参数错误"
 // @Failure 401 {object} ErrorResponse "邮箱或密码错误"
+// @Failure 429 {object} ErrorResponse "请求过于频繁"
 // @Router /api/auth/login [post]
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req models.LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		h.logger.Error("Invalid login request", zap.Error(err))
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Success: false,
-			Message: "Invalid request data",
-		})
+		response.Error(c, http.StatusBadRequest, "Invalid request data")
 		return
 	}
 
@@ -100,18 +95,12 @@ func (h *AuthHandler) Login(c *gin.Context) {
 			message = err.Error()
 		}
 		
-		c.JSON(status, ErrorResponse{
-			Success: false,
-			Message: message,
-		})
+		response.Error(c, status, message)
 		return
 	}
 
 	h.logger.Info("User logged in successfully", zap.String("email", req.Email))
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data":    tokenResp,
-	})
+	response.OK(c, tokenResp)
 }
 
 // Logout 用户登出
@@ -121,7 +110,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
-// @Success 200 {object} SuccessResponse "登出成功"
+// @Success 200 {object} response.Envelope{data=SuccessResponse} "登出成功"
 // @Router /api/auth/logout [post]
 func (h *AuthHandler) Logout(c *gin.Context) {
 	userID, _ := c.Get("user_id")
@@ -134,9 +123,8 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 	}
 
 	h.logger.Info("User logged out", zap.Any("user_id", userID))
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "Logged out successfully",
+	response.OK(c, SuccessResponse{
+		Message: "Logged out successfully",
 	})
 }
 
@@ -147,33 +135,24 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
-// @Success 200 {object} models.User "用户信息"
+// @Success 200 {object} response.Envelope{data=UserResponse} "用户信息"
 // @Failure 401 {object} ErrorResponse "未授权"
 // @Router /api/auth/profile [get]
 func (h *AuthHandler) GetProfile(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{
-			Success: false,
-			Message: "User not found in context",
-		})
+		response.Error(c, http.StatusUnauthorized, "User not found in context")
 		return
 	}
 
 	user, err := auth.GetUserByID(userID.(uint))
 	if err != nil {
 		h.logger.Error("Failed to get user profile", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Success: false,
-			Message: "Failed to get user profile",
-		})
+		response.Error(c, http.StatusInternalServerError, "Failed to get user profile")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"user":    user,
-	})
+	response.OK(c, UserResponse{User: user})
 }
 
 // RefreshToken 刷新Token
@@ -183,7 +162,7 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
-// @Success 200 {object} models.TokenResponse "新Token"
+// @Success 200 {object} response.Envelope{data=models.TokenResponse} "新Token"
 // @Failure 401 {object} ErrorResponse "Token无效"
 // @Router /api/auth/refresh [post]
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
@@ -192,20 +171,14 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	user, err := auth.GetUserByID(userID.(uint))
 	if err != nil {
 		h.logger.Error("Failed to get user for token refresh", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Success: false,
-			Message: "Failed to refresh token",
-		})
+		response.Error(c, http.StatusInternalServerError, "Failed to refresh token")
 		return
 	}
 
 	token, expiresAt, err := auth.GenerateToken(user)
 	if err != nil {
 		h.logger.Error("Failed to generate new token", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Success: false,
-			Message: "Failed to generate new token",
-		})
+		response.Error(c, http.StatusInternalServerError, "Failed to generate new token")
 		return
 	}
 
@@ -215,12 +188,75 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		h.logger.Error("Failed to update user token", zap.Error(err))
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data": models.TokenResponse{
-			Token:     token,
-			ExpiresAt: expiresAt,
-			User:      *user,
-		},
+	response.OK(c, models.TokenResponse{
+		Token:     token,
+		ExpiresAt: expiresAt,
+		User:      *user,
+	})
+}
+
+// ChangePassword 修改本人密码
+// @Summary 修改密码
+// @Description 校验当前密码后修改为新密码，新密码需符合密码策略
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body models.ChangePasswordRequest true "密码信息"
+// @Success 200 {object} response.Envelope{data=SuccessResponse} "修改成功"
+// @Failure 400 {object} PasswordPolicyErrorResponse "请求参数错误或新密码不符合密码策略"
+// @Failure 401 {object} ErrorResponse "当前密码错误"
+// @Router /api/auth/password [put]
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request data")
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	err := auth.ChangePassword(userID, req.CurrentPassword, req.NewPassword)
+	if respondWeakPassword(c, err) {
+		return
+	}
+	if errors.Is(err, auth.ErrInvalidCurrentPassword) {
+		response.Error(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to change password", zap.Uint("user_id", userID), zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to change password")
+		return
+	}
+
+	h.logger.Info("User changed password", zap.Uint("user_id", userID))
+	response.OK(c, SuccessResponse{
+		Message: "Password changed successfully",
+	})
+}
+
+// GetPasswordPolicy 获取密码策略
+// @Summary 获取密码策略
+// @Description 获取当前的密码策略，用于注册和修改密码页面提示
+// @Tags 认证
+// @Produce json
+// @Success 200 {object} response.Envelope{data=PasswordPolicyResponse} "密码策略"
+// @Router /api/auth/password-policy [get]
+func (h *AuthHandler) GetPasswordPolicy(c *gin.Context) {
+	response.OK(c, PasswordPolicyResponse{
+		Policy: auth.CurrentPasswordPolicy(),
 	})
-}
\ No newline at end of file
+}
+
+// respondWeakPassword 密码不符合策略时返回400及具体原因，已响应时返回true
+func respondWeakPassword(c *gin.Context, err error) bool {
+	var policyErr *auth.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+	response.ErrorWithData(c, http.StatusBadRequest, auth.ErrWeakPassword.Error(), PasswordPolicyViolations{
+		Violations: policyErr.Violations,
+	})
+
+	return true
+}
@@ -2,115 +2,265 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
-	"eino-rag/internal/db"
-	"eino-rag/internal/models"
+	"eino-rag/internal/config"
+	"eino-rag/internal/response"
 	"eino-rag/internal/services/chat"
 
-	"github.com/cloudwego/eino/schema"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
 type ChatHandler struct {
 	chatService *chat.Service
 	logger      *zap.Logger
+	streams     *streamLimiter
 }
 
 func NewChatHandler(chatService *chat.Service, logger *zap.Logger) *ChatHandler {
 	return &ChatHandler{
 		chatService: chatService,
 		logger:      logger,
+		streams:     newStreamLimiter(),
 	}
 }
 
 // Chat 处理聊天请求
 // @Summary 发送聊天消息
 // @Description 发送消息并获取AI回复
+// @Description response_format 指定回复格式（markdown/plain/json，默认 markdown），作为提示加入系统消息并随回复保存；json 格式在模型支持时开启 JSON 模式，不支持时返回400
+// @Description 启用RAG但向量库不可用时 retrieval_unavailable 为true，回复没有经过知识库检索；开启 RAG_STRICT 且没有降级上下文时直接回复知识库不可用的提示
+// @Description 开启 ANSWER_VERIFICATION 且检索到内容时，回答生成后由模型逐条核对论断，verification 给出有依据和无依据的论断；有无依据的论断时按 ANSWER_VERIFICATION_ACTION 只标记、附加提示或重新生成
+// @Description stop、presence_penalty、frequency_penalty 原样传给模型并随回复保存，惩罚参数的绝对值不能超过 MAX_PENALTY_USER/MAX_PENALTY_ADMIN；模型服务不支持的参数按 OPENAI_UNSUPPORTED_PARAMS 忽略
+// @Description n 大于1时 data 为 ChatCandidatesResponse：检索一次后生成 n 个候选回复，对话中不保存任何内容，调用 POST /api/chat/conversations/{id}/candidates/select 选择一个后才保存；n 不能超过 MAX_CANDIDATES_USER/MAX_CANDIDATES_ADMIN，候选回复不使用语义缓存、工具调用和回答核对
 // @Tags 聊天
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
 // @Param request body ChatRequest true "聊天请求"
-// @Success 200 {object} ChatResponse "聊天回复"
+// @Success 200 {object} response.Envelope{data=ChatResponse} "聊天回复"
 // @Failure 400 {object} ErrorResponse "请求错误"
 // @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "无权访问该知识库"
+// @Failure 404 {object} ErrorResponse "知识库不存在"
+// @Failure 409 {object} ErrorResponse "对话数已达上限（CONVERSATION_LIMIT_POLICY 为 reject 时）"
+// @Failure 504 {object} response.Envelope{data=TimeoutErrorData} "模型生成超时"
 // @Router /api/chat [post]
 func (h *ChatHandler) Chat(c *gin.Context) {
 	// 获取用户ID
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{
-			Success: false,
-			Message: "User not found in context",
-		})
+		response.Error(c, http.StatusUnauthorized, "User not found in context")
 		return
 	}
 
 	// 解析请求
 	var req ChatRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Success: false,
-			Message: "Invalid request data",
-		})
+		response.Error(c, http.StatusBadRequest, "Invalid request data")
+		return
+	}
+
+	// 检查回复长度是否在角色允许范围内
+	if limit := h.maxTokensLimit(c.GetString("role_name")); req.MaxTokens != nil && limit > 0 && *req.MaxTokens > limit {
+		response.Error(c, http.StatusBadRequest, fmt.Sprintf("max_tokens exceeds the allowed limit of %d", limit))
+		return
+	}
+	n := 1
+	if req.N != nil {
+		n = *req.N
+	}
+	if limit := h.candidatesLimit(c.GetString("role_name")); n > limit {
+		response.Error(c, http.StatusBadRequest, fmt.Sprintf("n exceeds the allowed limit of %d", limit))
+		return
+	}
+	if err := h.validatePenalties(&req, c.GetString("role_name")); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validateChatSearchEffort(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validateDateRange(req.CreatedAfter, req.CreatedBefore); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.chatService.ValidateResponseFormat(chat.ResponseFormat(req.ResponseFormat)); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.UseRAG && req.KnowledgeBaseID > 0 {
+		if err := authorizeKnowledgeBase(c, req.KnowledgeBaseID); err != nil {
+			status, message := knowledgeBaseAccessError(err)
+			if status == http.StatusInternalServerError {
+				h.logger.Error("Failed to check knowledge base access", zap.Error(err))
+			}
+			response.Error(c, status, message)
+			return
+		}
+	}
+
+	if n > 1 {
+		h.chatCandidates(c, userID.(uint), &req, n)
 		return
 	}
 
 	// 处理聊天
-	reply, convID, context, err := h.chatService.Chat(
+	reply, err := h.chatService.Chat(
 		c.Request.Context(),
 		req.Message,
 		req.ConversationID,
 		userID.(uint),
 		req.KnowledgeBaseID,
 		req.UseRAG,
+		chatOptions(&req),
 	)
 	if err != nil {
+		if errors.Is(err, chat.ErrConversationLimitReached) {
+			response.Error(c, http.StatusConflict, err.Error())
+			return
+		}
 		h.logger.Error("Failed to process chat", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Success: false,
-			Message: "Failed to process chat request",
-		})
+		if respondStageTimeout(c, err) {
+			return
+		}
+		response.Error(c, http.StatusInternalServerError, "Failed to process chat request")
+		return
+	}
+
+	response.OK(c, ChatResponse{
+		Message:              reply.Message,
+		ConversationID:       reply.ConversationID,
+		Context:              reply.Context,
+		SemanticCache:        reply.SemanticCache,
+		Verification:         reply.Verification,
+		RetrievalUnavailable: reply.RetrievalUnavailable,
+		Timestamp:            time.Now().Unix(),
+	})
+}
+
+// chatCandidates 生成多个候选回复，回复在选择前不保存到对话
+func (h *ChatHandler) chatCandidates(c *gin.Context, userID uint, req *ChatRequest, n int) {
+	reply, err := h.chatService.ChatCandidates(
+		c.Request.Context(),
+		req.Message,
+		req.ConversationID,
+		userID,
+		req.KnowledgeBaseID,
+		req.UseRAG,
+		chatOptions(req),
+		n,
+	)
+	if err != nil {
+		if errors.Is(err, chat.ErrConversationLimitReached) {
+			response.Error(c, http.StatusConflict, err.Error())
+			return
+		}
+		h.logger.Error("Failed to generate candidate replies", zap.Error(err))
+		if respondStageTimeout(c, err) {
+			return
+		}
+		response.Error(c, http.StatusInternalServerError, "Failed to process chat request")
+		return
+	}
+
+	response.OK(c, ChatCandidatesResponse{
+		ConversationID:       reply.ConversationID,
+		CandidateSetID:       reply.CandidateSetID,
+		Candidates:           reply.Candidates,
+		Context:              reply.Context,
+		RetrievalUnavailable: reply.RetrievalUnavailable,
+		Timestamp:            time.Now().Unix(),
+	})
+}
+
+// SelectCandidate 选择一个候选回复保存到对话
+// @Summary 选择候选回复
+// @Description 从 n 大于1的聊天请求返回的候选回复中选择一个，与对应的用户消息一起保存到对话；每组候选只能选择一次，1小时内未选择的候选过期丢弃
+// @Tags 聊天
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "对话ID"
+// @Param request body SelectCandidateRequest true "选择的候选回复"
+// @Success 200 {object} response.Envelope{data=SelectCandidateResponse} "保存的回复"
+// @Failure 400 {object} ErrorResponse "请求错误"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "无权限"
+// @Failure 404 {object} ErrorResponse "候选回复不存在、已过期或已选择"
+// @Router /api/chat/conversations/{id}/candidates/select [post]
+func (h *ChatHandler) SelectCandidate(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		response.Error(c, http.StatusUnauthorized, "User not found in context")
 		return
 	}
 
-	c.JSON(http.StatusOK, ChatResponse{
-		Success:        true,
-		Message:        reply,
+	convID := c.Param("id")
+	var req SelectCandidateRequest
+	if err := c.ShouldBindJSON(&req); err != nil || convID == "" {
+		response.Error(c, http.StatusBadRequest, "Invalid request data")
+		return
+	}
+
+	msg, err := h.chatService.SelectCandidate(c.Request.Context(), convID, userID.(uint), req.CandidateSetID, *req.Index)
+	if err != nil {
+		status := http.StatusInternalServerError
+		message := "Failed to select candidate"
+
+		switch {
+		case errors.Is(err, chat.ErrInvalidCandidateIndex):
+			status = http.StatusBadRequest
+			message = err.Error()
+		case errors.Is(err, chat.ErrCandidateSetNotFound):
+			status = http.StatusNotFound
+			message = err.Error()
+		case err.Error() == "unauthorized":
+			status = http.StatusForbidden
+			message = "You don't have permission to access this conversation"
+		default:
+			h.logger.Error("Failed to select candidate", zap.Error(err))
+		}
+
+		response.Error(c, status, message)
+		return
+	}
+
+	response.OK(c, SelectCandidateResponse{
 		ConversationID: convID,
-		Context:        context,
-		Timestamp:      time.Now().Unix(),
+		Message:        *msg,
 	})
 }
 
 // ListConversations 获取对话列表
 // @Summary 获取对话列表
-// @Description 获取当前用户的对话历史列表
+// @Description 获取当前用户的对话历史列表，usage 给出当前对话数和 MAX_CONVERSATIONS_PER_USER 上限（0 表示不限制）
 // @Tags 聊天
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
 // @Param page query int false "页码" default(1)
 // @Param page_size query int false "每页数量" default(10)
-// @Success 200 {object} ConversationListResponse "对话列表"
+// @Param folder query string false "按文件夹过滤"
+// @Param tag query string false "按标签过滤"
+// @Success 200 {object} response.Envelope{data=ConversationListResponse} "对话列表"
 // @Failure 401 {object} ErrorResponse "未授权"
 // @Router /api/chat/conversations [get]
 func (h *ChatHandler) ListConversations(c *gin.Context) {
 	// 获取用户ID
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{
-			Success: false,
-			Message: "User not found in context",
-		})
+		response.Error(c, http.StatusUnauthorized, "User not found in context")
 		return
 	}
 
@@ -125,23 +275,33 @@ func (h *ChatHandler) ListConversations(c *gin.Context) {
 		pageSize = 10
 	}
 
+	// 可选的文件夹和标签过滤，不传时返回全部对话
+	filter := chat.ConversationFilter{
+		Folder: strings.TrimSpace(c.Query("folder")),
+		Tag:    strings.TrimSpace(c.Query("tag")),
+	}
+
 	// 获取对话列表
-	conversations, total, err := h.chatService.GetUserConversations(userID.(uint), page, pageSize)
+	conversations, total, err := h.chatService.GetUserConversations(userID.(uint), filter, page, pageSize)
 	if err != nil {
 		h.logger.Error("Failed to get conversations", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Success: false,
-			Message: "Failed to get conversations",
-		})
+		response.Error(c, http.StatusInternalServerError, "Failed to get conversations")
+		return
+	}
+
+	usage, err := h.chatService.GetConversationUsage(userID.(uint))
+	if err != nil {
+		h.logger.Error("Failed to count conversations", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to get conversations")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"success":       true,
-		"conversations": conversations,
-		"total":         total,
-		"page":          page,
-		"page_size":     pageSize,
+	response.OK(c, ConversationListResponse{
+		Conversations: conversations,
+		Total:         total,
+		Page:          page,
+		PageSize:      pageSize,
+		Usage:         usage,
 	})
 }
 
@@ -153,7 +313,7 @@ func (h *ChatHandler) ListConversations(c *gin.Context) {
 // @Produce json
 // @Security ApiKeyAuth
 // @Param id path string true "对话ID"
-// @Success 200 {object} ConversationDetailResponse "对话详情"
+// @Success 200 {object} response.Envelope{data=ConversationDetailResponse} "对话详情"
 // @Failure 401 {object} ErrorResponse "未授权"
 // @Failure 404 {object} ErrorResponse "对话不存在"
 // @Router /api/chat/conversations/{id} [get]
@@ -161,20 +321,14 @@ func (h *ChatHandler) GetConversation(c *gin.Context) {
 	// 获取用户ID
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{
-			Success: false,
-			Message: "User not found in context",
-		})
+		response.Error(c, http.StatusUnauthorized, "User not found in context")
 		return
 	}
 
 	// 获取对话ID
 	convID := c.Param("id")
 	if convID == "" {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Success: false,
-			Message: "Conversation ID is required",
-		})
+		response.Error(c, http.StatusBadRequest, "Conversation ID is required")
 		return
 	}
 
@@ -194,31 +348,285 @@ func (h *ChatHandler) GetConversation(c *gin.Context) {
 			message = "You don't have permission to access this conversation"
 		}
 
-		c.JSON(status, ErrorResponse{
-			Success: false,
-			Message: message,
-		})
+		response.Error(c, status, message)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"success":  true,
-		"id":       convID,
-		"messages": messages,
+	response.OK(c, ConversationDetailResponse{
+		ID:       convID,
+		Messages: messages,
 	})
 }
 
+// UpdateConversation 设置对话的文件夹和标签
+// @Summary 设置对话文件夹和标签
+// @Description 设置指定对话的文件夹和标签，未提供的字段保持不变；tags 传空数组可清空标签，folder 传空字符串可移出文件夹
+// @Tags 聊天
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "对话ID"
+// @Param request body ConversationMetaRequest true "文件夹和标签"
+// @Success 200 {object} response.Envelope{data=ConversationMetaResponse} "更新后的对话"
+// @Failure 400 {object} ErrorResponse "请求错误"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "无权限"
+// @Failure 404 {object} ErrorResponse "对话不存在"
+// @Router /api/chat/conversations/{id} [patch]
+func (h *ChatHandler) UpdateConversation(c *gin.Context) {
+	// 获取用户ID
+	userID, exists := c.Get("user_id")
+	if !exists {
+		response.Error(c, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+
+	convID := c.Param("id")
+	if convID == "" {
+		response.Error(c, http.StatusBadRequest, "Conversation ID is required")
+		return
+	}
+
+	var req ConversationMetaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request data")
+		return
+	}
+
+	history, err := h.chatService.UpdateConversationMeta(convID, userID.(uint), req.Folder, req.Tags)
+	if err != nil {
+		h.logger.Error("Failed to update conversation", zap.Error(err))
+
+		status := http.StatusInternalServerError
+		message := "Failed to update conversation"
+
+		switch {
+		case errors.Is(err, chat.ErrInvalidTag):
+			status = http.StatusBadRequest
+			message = err.Error()
+		case err.Error() == "conversation not found":
+			status = http.StatusNotFound
+			message = err.Error()
+		case err.Error() == "unauthorized":
+			status = http.StatusForbidden
+			message = "You don't have permission to access this conversation"
+		}
+
+		response.Error(c, status, message)
+		return
+	}
+
+	response.OK(c, ConversationMetaResponse{
+		Conversation: history,
+	})
+}
+
+// EditMessage 修改用户消息并重新生成回复
+// @Summary 编辑消息并重新生成
+// @Description 修改对话中第 index 条消息（从0开始，必须是用户消息），丢弃其后的全部消息并使用原回复的检索参数重新生成回复。
+// @Description keep_branch 为true时被替换的内容保存为旧分支，可通过 GET /api/chat/conversations/{id}/branches 查看。
+// @Description 用户已无权访问原回复使用的知识库时返回403，知识库已删除时返回404。
+// @Tags 聊天
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "对话ID"
+// @Param index path int true "消息位置（从0开始）"
+// @Param request body EditMessageRequest true "修改后的消息"
+// @Success 200 {object} response.Envelope{data=EditMessageResponse} "修改后的消息列表"
+// @Failure 400 {object} ErrorResponse "请求错误"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "无权限"
+// @Failure 404 {object} ErrorResponse "对话或知识库不存在"
+// @Failure 409 {object} ErrorResponse "对话正在被编辑"
+// @Router /api/chat/conversations/{id}/messages/{index} [put]
+func (h *ChatHandler) EditMessage(c *gin.Context) {
+	// 获取用户ID
+	userID, exists := c.Get("user_id")
+	if !exists {
+		response.Error(c, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+
+	convID := c.Param("id")
+	index, err := strconv.Atoi(c.Param("index"))
+	if convID == "" || err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid conversation ID or message index")
+		return
+	}
+
+	var req EditMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request data")
+		return
+	}
+
+	// 重新生成前检查用户是否仍能访问原回复使用的知识库
+	opts := chat.ChatOptions{
+		AuthorizeKnowledgeBase: func(kbID uint) error {
+			return authorizeKnowledgeBase(c, kbID)
+		},
+	}
+	result, err := h.chatService.EditMessage(c.Request.Context(), convID, userID.(uint), index, req.Content, req.KeepBranch, opts)
+	if err != nil {
+		h.logger.Error("Failed to edit message", zap.Error(err))
+
+		status := http.StatusInternalServerError
+		message := "Failed to edit message"
+
+		switch {
+		case errors.Is(err, errKnowledgeBaseNotFound), errors.Is(err, errKnowledgeBaseForbidden):
+			status, message = knowledgeBaseAccessError(err)
+		case errors.Is(err, chat.ErrInvalidMessageIndex):
+			status = http.StatusBadRequest
+			message = err.Error()
+		case errors.Is(err, chat.ErrConversationBusy):
+			status = http.StatusConflict
+			message = err.Error()
+		case err.Error() == "conversation not found":
+			status = http.StatusNotFound
+			message = err.Error()
+		case err.Error() == "unauthorized":
+			status = http.StatusForbidden
+			message = "You don't have permission to access this conversation"
+		}
+
+		response.Error(c, status, message)
+		return
+	}
+
+	response.OK(c, EditMessageResponse{
+		ID:                   convID,
+		Messages:             result.Messages,
+		BranchID:             result.BranchID,
+		RetrievalUnavailable: result.RetrievalUnavailable,
+		Verification:         result.Verification,
+	})
+}
+
+// ListBranches 获取对话保留的旧分支
+// @Summary 获取对话旧分支
+// @Description 获取编辑消息时保留的旧分支，按创建时间倒序；每个分支包含被替换的消息及其之后的全部消息
+// @Tags 聊天
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "对话ID"
+// @Success 200 {object} response.Envelope{data=ConversationBranchListResponse} "旧分支列表"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Router /api/chat/conversations/{id}/branches [get]
+func (h *ChatHandler) ListBranches(c *gin.Context) {
+	// 获取用户ID
+	userID, exists := c.Get("user_id")
+	if !exists {
+		response.Error(c, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+
+	branches, err := h.chatService.GetConversationBranches(c.Param("id"), userID.(uint))
+	if err != nil {
+		h.logger.Error("Failed to get conversation branches", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to get conversation branches")
+		return
+	}
+
+	response.OK(c, ConversationBranchListResponse{
+		Branches: branches,
+	})
+}
+
+// AttachDocument 上传文档到对话
+// @Summary 上传对话附件
+// @Description 把文档上传到对话而不加入任何知识库，例如"分析这个PDF"。附件与普通文档一样解析和索引，之后该对话的每轮回复都会检索附件（无论是否启用RAG），同时指定了知识库时附件的结果排在前面
+// @Description 附件只在所属用户的这个对话中使用，不出现在知识库列表中；对话被删除或超过 CONVERSATION_ATTACHMENT_TTL 没有新消息时附件被删除。可以在发送第一条消息前上传，再用同一个对话ID开始对话
+// @Tags 聊天
+// @Accept multipart/form-data
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "对话ID"
+// @Param file formData file true "文档文件"
+// @Param page_start formData int false "PDF起始页（从1开始），仅对PDF生效"
+// @Param page_end formData int false "PDF结束页（包含），仅对PDF生效"
+// @Success 200 {object} response.Envelope{data=UploadResponse} "上传成功"
+// @Failure 400 {object} ErrorResponse "请求错误"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "无权访问该对话或没有上传权限"
+// @Failure 408 {object} ErrorResponse "上传整体超时"
+// @Failure 413 {object} ErrorResponse "文档分块数超过上限（CHUNK_LIMIT_ACTION=reject）"
+// @Failure 422 {object} ErrorResponse "文档没有可提取的文本"
+// @Failure 504 {object} response.Envelope{data=TimeoutErrorData} "切分、向量化或写入向量库超时"
+// @Router /api/chat/conversations/{id}/attach [post]
+func (h *ChatHandler) AttachDocument(c *gin.Context) {
+	// 获取用户ID
+	userID, exists := c.Get("user_id")
+	if !exists {
+		response.Error(c, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+
+	convID := c.Param("id")
+	if convID == "" {
+		response.Error(c, http.StatusBadRequest, "Conversation ID is required")
+		return
+	}
+
+	opts, err := uploadOptions(c)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Failed to get file")
+		return
+	}
+	defer file.Close()
+
+	uploadCtx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Minute)
+	defer cancel()
+
+	doc, indexed, err := h.chatService.AttachDocument(uploadCtx, convID, userID.(uint), header.Filename, file, opts)
+	if err != nil {
+		if err.Error() == "unauthorized" {
+			response.Error(c, http.StatusForbidden, "You don't have permission to access this conversation")
+			return
+		}
+		h.logger.Error("Failed to attach document to conversation",
+			zap.String("conversation_id", convID),
+			zap.String("filename", header.Filename),
+			zap.Error(err))
+		respondUploadError(c, err)
+		return
+	}
+
+	h.logger.Info("Document attached to conversation",
+		zap.String("conversation_id", convID),
+		zap.Uint("document_id", doc.ID),
+		zap.Int("indexed_chunks", indexed))
+
+	response.OK(c, newIndexResponse(doc, indexed, "Document attached successfully"))
+}
+
 // ChatStream 处理流式聊天请求
 // @Summary 发送聊天消息（流式）
-// @Description 发送消息并获取AI流式回复
+// @Description 发送消息并通过SSE获取AI流式回复。响应为 text/event-stream，每个事件是一行 `data: <SSEEvent JSON>`，后跟空行。
+// @Description 事件按顺序为：start（开始，含 conversation_id）→ context（可选，检索到的文档）→ 若干 content（增量文本）→ end（完成）。
+// @Description 任意阶段出错时发送 error 事件（含 message 和可选 code，如 too_many_streams）并结束流；模型生成超时时 code 为 timeout，message 标明超时的阶段；对话数已达上限且不允许删除旧对话时 code 为 conversation_limit。
+// @Description 开启语义缓存且命中时，回复一次性通过一个 content 事件返回，end 事件的 semantic_cache 说明命中的缓存问题和相似度。
+// @Description 模型输出中途出错且续写失败时，已发送的 content 保留，随后发送 code 为 stream_interrupted 的 error 事件而不是 end，保存的回复标记为 incomplete。
+// @Description 用户消息在开始输出前保存；客户端中途断开时停止生成，已生成的部分作为 incomplete 的回复保存，可通过 start 事件中的 conversation_id 查看。
+// @Description 启用RAG但向量库不可用时一定发送 context 事件，其 retrieval_unavailable 为true（end 事件同样带上），回复没有经过知识库检索；开启 RAG_STRICT 且没有降级上下文时只返回知识库不可用的提示。
+// @Description 开启 ANSWER_VERIFICATION 且检索到内容时，回复输出完后再核对，end 事件的 verification 给出核对结果；已输出的回复无法重新生成，需要提示时作为最后一个 content 事件发送。
 // @Tags 聊天
 // @Accept json
-// @Produce text/plain
+// @Produce text/event-stream
 // @Security ApiKeyAuth
 // @Param request body ChatRequest true "聊天请求"
-// @Success 200 {string} string "流式回复"
+// @Success 200 {object} SSEEvent "SSE事件流，每个事件的结构"
 // @Failure 400 {object} ErrorResponse "请求错误"
 // @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "无权访问该知识库，以 error 事件返回"
 // @Router /api/chat/stream [post]
 func (h *ChatHandler) ChatStream(c *gin.Context) {
 	// 设置SSE响应头
@@ -230,8 +638,8 @@ func (h *ChatHandler) ChatStream(c *gin.Context) {
 	// 获取用户ID
 	userID, exists := c.Get("user_id")
 	if !exists {
-		h.sendSSEEvent(c.Writer, "error", map[string]interface{}{
-			"message": "User not found in context",
+		h.sendSSEEvent(c.Writer, ErrorEvent{
+			Message: "User not found in context",
 		})
 		return
 	}
@@ -239,190 +647,367 @@ func (h *ChatHandler) ChatStream(c *gin.Context) {
 	// 解析请求
 	var req ChatRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		h.sendSSEEvent(c.Writer, "error", map[string]interface{}{
-			"message": "Invalid request data",
+		h.sendSSEEvent(c.Writer, ErrorEvent{
+			Message: "Invalid request data",
+		})
+		return
+	}
+
+	// 检查回复长度是否在角色允许范围内
+	if limit := h.maxTokensLimit(c.GetString("role_name")); req.MaxTokens != nil && limit > 0 && *req.MaxTokens > limit {
+		h.sendSSEEvent(c.Writer, ErrorEvent{
+			Message: fmt.Sprintf("max_tokens exceeds the allowed limit of %d", limit),
+		})
+		return
+	}
+	if req.N != nil && *req.N > 1 {
+		h.sendSSEEvent(c.Writer, ErrorEvent{
+			Message: "n > 1 is only supported by non-streaming chat",
+		})
+		return
+	}
+	if err := h.validatePenalties(&req, c.GetString("role_name")); err != nil {
+		h.sendSSEEvent(c.Writer, ErrorEvent{
+			Message: err.Error(),
+		})
+		return
+	}
+	if err := validateChatSearchEffort(&req); err != nil {
+		h.sendSSEEvent(c.Writer, ErrorEvent{
+			Message: err.Error(),
+		})
+		return
+	}
+	if err := validateDateRange(req.CreatedAfter, req.CreatedBefore); err != nil {
+		h.sendSSEEvent(c.Writer, ErrorEvent{
+			Message: err.Error(),
+		})
+		return
+	}
+	if err := h.chatService.ValidateResponseFormat(chat.ResponseFormat(req.ResponseFormat)); err != nil {
+		h.sendSSEEvent(c.Writer, ErrorEvent{
+			Message: err.Error(),
 		})
 		return
 	}
+	if req.UseRAG && req.KnowledgeBaseID > 0 {
+		if err := authorizeKnowledgeBase(c, req.KnowledgeBaseID); err != nil {
+			status, message := knowledgeBaseAccessError(err)
+			if status == http.StatusInternalServerError {
+				h.logger.Error("Failed to check knowledge base access", zap.Error(err))
+			}
+			// 尚未发送任何事件，可以设置响应状态码
+			c.Status(status)
+			h.sendSSEEvent(c.Writer, ErrorEvent{
+				Message: message,
+			})
+			return
+		}
+	}
 
 	// 创建flusher
 	flusher, ok := c.Writer.(http.Flusher)
 	if !ok {
-		h.sendSSEEvent(c.Writer, "error", map[string]interface{}{
-			"message": "Streaming not supported",
+		h.sendSSEEvent(c.Writer, ErrorEvent{
+			Message: "Streaming not supported",
+		})
+		return
+	}
+
+	// 检查用户并发流数量限制
+	limit := h.streamLimit(c.GetString("role_name"))
+	if !h.streams.acquire(userID.(uint), limit) {
+		h.logger.Warn("Too many concurrent streams",
+			zap.Uint("user_id", userID.(uint)),
+			zap.Int("limit", limit))
+		h.sendSSEEvent(c.Writer, ErrorEvent{
+			Message: fmt.Sprintf("Too many concurrent streams, at most %d allowed", limit),
+			Code:    "too_many_streams",
 		})
+		flusher.Flush()
 		return
 	}
+	defer h.streams.release(userID.(uint))
+
+	// 新对话在开始时分配ID，客户端中途断开后仍能找到已保存的消息
+	if req.ConversationID == "" {
+		req.ConversationID = uuid.New().String()
+	}
 
 	// 发送开始事件
-	h.sendSSEEvent(c.Writer, "start", map[string]interface{}{
-		"conversation_id": req.ConversationID,
-		"message":         "Starting chat",
+	h.sendSSEEvent(c.Writer, StartEvent{
+		ConversationID: req.ConversationID,
+		Message:        "Starting chat",
 	})
 	flusher.Flush()
 
 	// 处理流式聊天
-	reader, convID, _, retrievedDocs, err := h.chatService.ChatStream(
+	stream, err := h.chatService.ChatStream(
 		c.Request.Context(),
 		req.Message,
 		req.ConversationID,
 		userID.(uint),
 		req.KnowledgeBaseID,
 		req.UseRAG,
+		chatOptions(&req),
 	)
 	if err != nil {
+		if errors.Is(err, chat.ErrConversationLimitReached) {
+			h.sendSSEEvent(c.Writer, ErrorEvent{
+				Message: err.Error(),
+				Code:    "conversation_limit",
+			})
+			flusher.Flush()
+			return
+		}
 		h.logger.Error("Failed to process stream chat", zap.Error(err))
-		h.sendSSEEvent(c.Writer, "error", map[string]interface{}{
-			"message": "Failed to process chat request",
-		})
+		event := ErrorEvent{
+			Message: "Failed to process chat request",
+		}
+		// 开始事件已发送，无法再设置状态码，超时通过 code 区分
+		if _, message, ok := stageTimeoutMessage(err); ok {
+			event.Message, event.Code = message, "timeout"
+		}
+		h.sendSSEEvent(c.Writer, event)
 		flusher.Flush()
 		return
 	}
-	defer reader.Close()
-
-	// 发送检索到的文档上下文（如果有）
-	if len(retrievedDocs) > 0 {
-		h.sendSSEEvent(c.Writer, "context", map[string]interface{}{
-			"documents": h.convertDocsForSSE(retrievedDocs),
+	reader, convID, ragContext := stream.Reader, stream.ConversationID, stream.Context
+	defer func() { reader.Close() }()
+
+	// 发送检索到的文档上下文（如果有），向量库不可用时也发送，让客户端尽早提示
+	if len(stream.Documents) > 0 || stream.RetrievalUnavailable {
+		h.sendSSEEvent(c.Writer, ContextEvent{
+			Documents:            toDocResults(stream.Documents),
+			RetrievalUnavailable: stream.RetrievalUnavailable,
 		})
 		flusher.Flush()
 	}
 
 	// 读取并转发流式内容，同时收集完整回复
+	// 模型流中途出错时按配置从中断处续写，仍失败则以 error 事件结束
 	var fullReply strings.Builder
+	var streamErr error
+	completed := false
+	// 任何退出路径（正常结束、模型出错、客户端断开）都保存已生成的回复，没有读到流末尾的标记为不完整
+	defer func() {
+		h.saveStreamConversation(stream, fullReply.String(), !completed)
+		if completed {
+			go h.chatService.CacheStreamReply(stream, fullReply.String())
+		}
+	}()
+	resumes := 0
 	for {
 		chunk, err := reader.Recv()
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
-			h.logger.Error("Error reading stream", zap.Error(err))
-			break
+			h.logger.Error("Error reading stream",
+				zap.String("conversation_id", convID),
+				zap.Int("received_length", fullReply.Len()),
+				zap.Error(err))
+
+			// 客户端已断开时不再续写
+			if c.Request.Context().Err() != nil || resumes >= config.Get().Snapshot().ChatStreamMaxResumes {
+				streamErr = err
+				break
+			}
+
+			resumes++
+			resumed, resumeErr := h.chatService.ResumeStream(
+				c.Request.Context(),
+				convID,
+				userID.(uint),
+				req.Message,
+				ragContext,
+				fullReply.String(),
+				chatOptions(&req),
+			)
+			if resumeErr != nil {
+				h.logger.Error("Failed to resume stream", zap.Error(resumeErr))
+				streamErr = err
+				break
+			}
+
+			h.logger.Info("Resumed interrupted stream",
+				zap.String("conversation_id", convID),
+				zap.Int("attempt", resumes))
+			reader.Close()
+			reader = resumed
+			continue
 		}
 
 		if chunk.Content != "" {
 			fullReply.WriteString(chunk.Content)
-			h.sendSSEEvent(c.Writer, "content", map[string]interface{}{
-				"content": chunk.Content,
-			})
+			// 客户端已断开时停止读取，已生成的部分作为不完整的回复保存
+			if err := h.sendSSEEvent(c.Writer, ContentEvent{
+				Content: chunk.Content,
+			}); err != nil {
+				streamErr = err
+				break
+			}
 			flusher.Flush()
 		}
 	}
 
-	// 异步保存完整对话
-	go func() {
-		h.saveStreamConversation(userID.(uint), req.Message, fullReply.String(), convID)
-	}()
+	if streamErr != nil {
+		h.sendSSEEvent(c.Writer, ErrorEvent{
+			Message:        "The response was interrupted, the content received so far is incomplete",
+			Code:           "stream_interrupted",
+			ConversationID: convID,
+		})
+		flusher.Flush()
+		return
+	}
+
+	// 开启回答核对时核对完整的回复，需要附加的可信度提示作为最后一段内容发送并一起保存
+	verification, note := h.chatService.VerifyStreamReply(c.Request.Context(), stream, fullReply.String())
+	if note != "" {
+		fullReply.WriteString(note)
+		h.sendSSEEvent(c.Writer, ContentEvent{
+			Content: note,
+		})
+	}
+	completed = true
 
 	// 发送结束事件
-	h.sendSSEEvent(c.Writer, "end", map[string]interface{}{
-		"conversation_id": convID,
-		"message":         "Completed",
-		"timestamp":       time.Now().Unix(),
+	h.sendSSEEvent(c.Writer, EndEvent{
+		ConversationID:       convID,
+		Message:              "Completed",
+		SemanticCache:        stream.SemanticCache,
+		Verification:         verification,
+		RetrievalUnavailable: stream.RetrievalUnavailable,
+		Timestamp:            time.Now().Unix(),
 	})
 	flusher.Flush()
 }
 
-// sendSSEEvent 发送SSE事件
-func (h *ChatHandler) sendSSEEvent(w http.ResponseWriter, eventType string, data interface{}) {
-	sseData := map[string]interface{}{
-		"type": eventType,
-		"data": data,
+// chatOptions 从请求中提取单次对话的检索参数
+func chatOptions(req *ChatRequest) chat.ChatOptions {
+	var opts chat.ChatOptions
+	if req.TopK != nil {
+		opts.TopK = *req.TopK
 	}
-
-	jsonData, err := json.Marshal(sseData)
-	if err != nil {
-		h.logger.Error("Failed to marshal SSE data", zap.Error(err))
-		return
+	if req.ScoreThreshold != nil {
+		opts.ScoreThreshold = *req.ScoreThreshold
 	}
-
-	fmt.Fprintf(w, "data: %s\n\n", jsonData)
+	if req.MaxTokens != nil {
+		opts.MaxTokens = *req.MaxTokens
+	}
+	opts.ContextWindow = req.ContextWindow
+	opts.ToolCalling = req.ToolCalling
+	if req.SearchEffort != nil {
+		opts.SearchEffort = *req.SearchEffort
+	}
+	opts.RecencyWeight = req.RecencyWeight
+	opts.MaxChunksPerDoc = req.MaxChunksPerDoc
+	if req.CandidateMultiplier != nil {
+		opts.CandidateMultiplier = *req.CandidateMultiplier
+	}
+	opts.CreatorID = req.CreatorID
+	opts.CreatedAfter = req.CreatedAfter
+	opts.CreatedBefore = req.CreatedBefore
+	opts.Tags = req.Tags
+	if req.RecencyHalfLifeDays != nil {
+		opts.RecencyHalfLifeDays = *req.RecencyHalfLifeDays
+	}
+	opts.ResponseFormat = chat.ResponseFormat(req.ResponseFormat)
+	opts.Stop = req.Stop
+	opts.PresencePenalty = req.PresencePenalty
+	opts.FrequencyPenalty = req.FrequencyPenalty
+	return opts
 }
 
-// saveStreamConversation 保存流式聊天对话
-func (h *ChatHandler) saveStreamConversation(userID uint, userMessage, assistantReply, conversationID string) {
-	ctx := context.Background()
-
-	// 获取或创建对话
-	conv, err := db.GetConversation(ctx, conversationID)
-	if err != nil {
-		h.logger.Error("Failed to get conversation for saving", zap.Error(err))
-		return
+// validateChatSearchEffort 检查对话请求中的检索力度
+func validateChatSearchEffort(req *ChatRequest) error {
+	if req.SearchEffort == nil {
+		return nil
+	}
+	topK := 0
+	if req.TopK != nil {
+		topK = *req.TopK
 	}
+	return validateSearchEffort(req.KnowledgeBaseID, *req.SearchEffort, topK)
+}
 
-	if conv == nil {
-		// 创建新对话
-		conv = &models.Conversation{
-			ID:        conversationID,
-			UserID:    userID,
-			Messages:  []models.ChatMessage{},
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		}
+// maxTokensLimit 根据角色返回单次请求允许的最大回复token数，<= 0 表示不限制
+func (h *ChatHandler) maxTokensLimit(roleName string) int {
+	cfg := config.Get().Snapshot()
+	if roleName == "admin" {
+		return cfg.MaxResponseTokensAdmin
+	}
+	return cfg.MaxResponseTokensUser
+}
 
-		// 添加用户消息
-		userMsg := models.ChatMessage{
-			Role:      "user",
-			Content:   userMessage,
-			Timestamp: time.Now(),
-		}
-		conv.Messages = append(conv.Messages, userMsg)
+// maxPenalty 惩罚参数绝对值的硬上限，与 OpenAI 接口的取值范围一致
+const maxPenalty = 2.0
 
-		// 保存对话历史到数据库（如果是新对话）
-		database := db.GetDB()
-		title := userMessage
-		if len(title) > 50 {
-			title = title[:50] + "..."
+// validatePenalties 检查惩罚参数的绝对值是否在角色允许的范围内
+func (h *ChatHandler) validatePenalties(req *ChatRequest, roleName string) error {
+	cfg := config.Get().Snapshot()
+	limit := cfg.MaxPenaltyUser
+	if roleName == "admin" {
+		limit = cfg.MaxPenaltyAdmin
+	}
+	limit = min(limit, maxPenalty)
+
+	penalties := []struct {
+		name  string
+		value *float32
+	}{
+		{chat.GenerationParamPresencePenalty, req.PresencePenalty},
+		{chat.GenerationParamFrequencyPenalty, req.FrequencyPenalty},
+	}
+	for _, penalty := range penalties {
+		if penalty.value == nil {
+			continue
 		}
-
-		history := &models.ChatHistory{
-			UserID:         userID,
-			ConversationID: conversationID,
-			Title:          title,
-			CreatedAt:      time.Now(),
-			UpdatedAt:      time.Now(),
+		if limit <= 0 {
+			return fmt.Errorf("%s is not allowed", penalty.name)
 		}
-
-		if err := database.Create(history).Error; err != nil {
-			h.logger.Error("Failed to save chat history", zap.Error(err))
+		if math.Abs(float64(*penalty.value)) > limit {
+			return fmt.Errorf("%s must be between -%g and %g", penalty.name, limit, limit)
 		}
 	}
+	return nil
+}
 
-	// 添加助手回复
-	assistantMsg := models.ChatMessage{
-		Role:      "assistant",
-		Content:   assistantReply,
-		Timestamp: time.Now(),
+// candidatesLimit 根据角色返回单次请求允许的候选回复数，至少为1，不超过 chat.MaxCandidates
+func (h *ChatHandler) candidatesLimit(roleName string) int {
+	cfg := config.Get().Snapshot()
+	limit := cfg.MaxCandidatesUser
+	if roleName == "admin" {
+		limit = cfg.MaxCandidatesAdmin
 	}
-	conv.Messages = append(conv.Messages, assistantMsg)
-	conv.UpdatedAt = time.Now()
+	return max(1, min(limit, chat.MaxCandidates))
+}
 
-	// 保存对话到Redis
-	if err := db.SaveConversation(ctx, conv); err != nil {
-		h.logger.Error("Failed to save conversation", zap.Error(err))
+// streamLimit 根据角色返回允许的并发流数量，<= 0 表示不限制
+func (h *ChatHandler) streamLimit(roleName string) int {
+	cfg := config.Get().Snapshot()
+	if roleName == "admin" {
+		return cfg.MaxStreamsPerAdmin
 	}
+	return cfg.MaxStreamsPerUser
 }
 
-// convertDocsForSSE 转换文档格式用于SSE
-func (h *ChatHandler) convertDocsForSSE(docs []*schema.Document) []map[string]interface{} {
-	results := make([]map[string]interface{}, len(docs))
-	for i, doc := range docs {
-		// 从metadata中获取实际的相似度分数
-		var score float64 = 0.0
-		if doc.MetaData != nil {
-			if similarityScore, exists := doc.MetaData["similarity_score"]; exists {
-				if scoreFloat, ok := similarityScore.(float64); ok {
-					score = scoreFloat
-				}
-			}
-		}
+// sendSSEEvent 发送SSE事件，写入失败（通常是客户端已断开）时记录日志并返回错误
+func (h *ChatHandler) sendSSEEvent(w http.ResponseWriter, payload SSEPayload) error {
+	err := WriteSSEEvent(w, payload)
+	if err != nil {
+		h.logger.Error("Failed to write SSE event",
+			zap.String("type", payload.EventType()),
+			zap.Error(err))
+	}
+	return err
+}
 
-		results[i] = map[string]interface{}{
-			"id":       doc.ID,
-			"content":  doc.Content,
-			"score":    score,
-			"metadata": doc.MetaData,
-		}
+// saveStreamConversation 保存流式聊天的回复，不使用请求的 context，客户端断开后仍能保存
+func (h *ChatHandler) saveStreamConversation(stream *chat.StreamReply, assistantReply string, incomplete bool) {
+	if err := h.chatService.SaveStreamReply(context.Background(), stream, assistantReply, incomplete); err != nil {
+		h.logger.Error("Failed to save conversation",
+			zap.String("conversation_id", stream.ConversationID),
+			zap.Error(err))
 	}
-	return results
 }
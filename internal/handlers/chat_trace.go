@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"eino-rag/internal/response"
+	"eino-rag/internal/services/chat"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Trace 执行一次对话并返回各步骤的中间结果
+// @Summary 追踪对话
+// @Description 执行一次完整的RAG对话（非流式）并返回每一步的中间结果：检索参数、查询扩展生成的变体、检索到的分块及分数、拼接的上下文、发送给模型的完整消息、模型原始输出和后处理后的回答，用于区分检索和生成问题（需要管理员权限）
+// @Description 追踪不使用语义缓存、工具调用和回答核对，回复不保存到对话；指定 conversation_id 时只读取其历史消息。n 被忽略。每个管理员每分钟最多调用 CHAT_TRACE_RATE_LIMIT 次，<=0 时接口关闭
+// @Tags 聊天
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body ChatRequest true "聊天请求"
+// @Success 200 {object} response.Envelope{data=ChatTraceResponse} "追踪结果"
+// @Failure 400 {object} ErrorResponse "请求错误"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "权限不足或接口已关闭"
+// @Failure 404 {object} ErrorResponse "知识库或对话不存在"
+// @Failure 429 {object} ErrorResponse "调用过于频繁"
+// @Failure 504 {object} response.Envelope{data=TimeoutErrorData} "模型生成超时"
+// @Router /api/chat/trace [post]
+func (h *ChatHandler) Trace(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		response.Error(c, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+
+	var req ChatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request data")
+		return
+	}
+
+	if limit := h.maxTokensLimit(c.GetString("role_name")); req.MaxTokens != nil && limit > 0 && *req.MaxTokens > limit {
+		response.Error(c, http.StatusBadRequest, fmt.Sprintf("max_tokens exceeds the allowed limit of %d", limit))
+		return
+	}
+	if err := h.validatePenalties(&req, c.GetString("role_name")); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validateChatSearchEffort(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validateDateRange(req.CreatedAfter, req.CreatedBefore); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.chatService.ValidateResponseFormat(chat.ResponseFormat(req.ResponseFormat)); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.UseRAG && req.KnowledgeBaseID > 0 {
+		if err := authorizeKnowledgeBase(c, req.KnowledgeBaseID); err != nil {
+			status, message := knowledgeBaseAccessError(err)
+			if status == http.StatusInternalServerError {
+				h.logger.Error("Failed to check knowledge base access", zap.Error(err))
+			}
+			response.Error(c, status, message)
+			return
+		}
+	}
+
+	trace, err := h.chatService.Trace(
+		c.Request.Context(),
+		req.Message,
+		req.ConversationID,
+		userID.(uint),
+		req.KnowledgeBaseID,
+		req.UseRAG,
+		chatOptions(&req),
+	)
+	if err != nil {
+		switch err.Error() {
+		case "conversation not found":
+			response.Error(c, http.StatusNotFound, "Conversation not found")
+			return
+		case "unauthorized":
+			response.Error(c, http.StatusForbidden, "You don't have permission to access this conversation")
+			return
+		}
+		h.logger.Error("Failed to trace chat", zap.Error(err))
+		if respondStageTimeout(c, err) {
+			return
+		}
+		response.Error(c, http.StatusInternalServerError, "Failed to trace chat request")
+		return
+	}
+
+	h.logger.Info("Chat traced",
+		zap.Uint("user_id", userID.(uint)),
+		zap.Uint("kb_id", req.KnowledgeBaseID),
+		zap.Int("documents", len(trace.Documents)))
+
+	response.OK(c, ChatTraceResponse{
+		Query:                trace.Query,
+		QueryVariants:        trace.QueryVariants,
+		Retrieval:            trace.Retrieval,
+		Documents:            toDocResults(trace.Documents),
+		RetrievalError:       trace.RetrievalError,
+		RetrievalUnavailable: trace.RetrievalUnavailable,
+		Context:              trace.Context,
+		Prompt:               trace.Prompt,
+		RawAnswer:            trace.RawAnswer,
+		Answer:               trace.Answer,
+		RetrievalMs:          trace.RetrievalDuration.Milliseconds(),
+		GenerationMs:         trace.GenerationDuration.Milliseconds(),
+	})
+}
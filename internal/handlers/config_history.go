@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+	"eino-rag/internal/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// configValueString 将配置值转换为数据库中保存的字符串
+func configValueString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	case []string:
+		return strings.Join(v, ",")
+	case []interface{}:
+		// 处理数组类型（如 allowed_file_types）
+		var strSlice []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				strSlice = append(strSlice, s)
+			}
+		}
+		return strings.Join(strSlice, ",")
+	default:
+		// 尝试将其他类型转换为JSON字符串
+		if jsonBytes, err := json.Marshal(v); err == nil {
+			return string(jsonBytes)
+		}
+		return ""
+	}
+}
+
+// applyConfig 保存配置并记录变更历史，然后重新加载内存中的配置
+// 旧值优先取数据库中保存的值，没有时取当前生效的值（来自环境变量或默认值），以便回滚时能恢复
+// 返回本次变更ID和实际发生变化的配置项数量
+func (h *SystemHandler) applyConfig(values map[string]string, actorID uint, revertOf string) (string, int, error) {
+	// 加锁防止并发更新
+	configUpdateMutex.Lock()
+	defer configUpdateMutex.Unlock()
+
+	database := db.GetDB()
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var stored []models.SystemConfig
+	if err := database.Where("key IN ?", keys).Find(&stored).Error; err != nil {
+		return "", 0, fmt.Errorf("failed to load current config: %w", err)
+	}
+	oldValues := make(map[string]string, len(keys))
+	effective := h.configMap()
+	for _, key := range keys {
+		if value, ok := effective[key]; ok {
+			oldValues[key] = configValueString(value)
+		}
+	}
+	for _, item := range stored {
+		oldValues[item.Key] = item.Value
+	}
+
+	changeID := uuid.New().String()
+	now := time.Now()
+	var history []models.ConfigHistory
+	for _, key := range keys {
+		if oldValues[key] == values[key] {
+			continue
+		}
+		history = append(history, models.ConfigHistory{
+			ChangeID:  changeID,
+			Key:       key,
+			OldValue:  oldValues[key],
+			NewValue:  values[key],
+			ActorID:   actorID,
+			RevertOf:  revertOf,
+			CreatedAt: now,
+		})
+	}
+
+	// 更新配置，带重试逻辑
+	var err error
+	for i := 0; i < 3; i++ {
+		err = database.Transaction(func(tx *gorm.DB) error {
+			for _, key := range keys {
+				if err := tx.Save(&models.SystemConfig{Key: key, Value: values[key]}).Error; err != nil {
+					return err
+				}
+			}
+			if len(history) > 0 {
+				return tx.Create(&history).Error
+			}
+			return nil
+		})
+
+		// 如果没有错误或不是数据库锁定错误，则跳出循环
+		if err == nil || !strings.Contains(err.Error(), "database is locked") {
+			break
+		}
+
+		// 重试前等待
+		time.Sleep(time.Millisecond * 100 * time.Duration(i+1))
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	// 从数据库重新加载配置到内存
+	var updatedConfigs []models.SystemConfig
+	if err := database.Find(&updatedConfigs).Error; err == nil {
+		configMap := make(map[string]string)
+		for _, cfg := range updatedConfigs {
+			configMap[cfg.Key] = cfg.Value
+		}
+		// 更新内存中的配置
+		config.UpdateFromDB(configMap)
+	}
+
+	return changeID, len(history), nil
+}
+
+// GetConfigHistory 获取配置变更历史
+// @Summary 获取配置变更历史
+// @Description 按时间倒序返回系统配置的变更记录，同一次更新的记录共享 change_id，敏感项的新旧值已隐藏（需要管理员权限）
+// @Tags 系统
+// @Produce json
+// @Security ApiKeyAuth
+// @Param key query string false "只返回指定配置项的记录"
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Success 200 {object} response.Envelope{data=ConfigHistoryResponse} "变更历史"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "权限不足"
+// @Router /api/system/config/history [get]
+func (h *SystemHandler) GetConfigHistory(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	filter := func(tx *gorm.DB) *gorm.DB {
+		if key := c.Query("key"); key != "" {
+			return tx.Where("key = ?", key)
+		}
+		return tx
+	}
+
+	database := db.GetDB()
+	var total int64
+	if err := database.Model(&models.ConfigHistory{}).Scopes(filter).Count(&total).Error; err != nil {
+		h.logger.Error("Failed to count config history", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to get config history")
+		return
+	}
+
+	var history []models.ConfigHistory
+	if err := database.Scopes(filter).Order("id DESC").
+		Offset((page - 1) * pageSize).Limit(pageSize).Find(&history).Error; err != nil {
+		h.logger.Error("Failed to get config history", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to get config history")
+		return
+	}
+
+	for i := range history {
+		history[i].OldValue = config.RedactValue(history[i].Key, history[i].OldValue)
+		history[i].NewValue = config.RedactValue(history[i].Key, history[i].NewValue)
+	}
+
+	response.OK(c, ConfigHistoryResponse{
+		History:  history,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	})
+}
+
+// RevertConfig 回滚配置变更
+// @Summary 回滚配置变更
+// @Description 将指定变更涉及的配置项恢复为变更前的值，回滚本身也会记录为一次变更（需要管理员权限）
+// @Tags 系统
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body RevertConfigRequest true "回滚请求"
+// @Success 200 {object} response.Envelope{data=RevertConfigResponse} "回滚成功"
+// @Failure 400 {object} ErrorResponse "请求错误"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "权限不足"
+// @Failure 404 {object} ErrorResponse "变更记录不存在"
+// @Router /api/system/config/revert [post]
+func (h *SystemHandler) RevertConfig(c *gin.Context) {
+	var req RevertConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request data")
+		return
+	}
+
+	var history []models.ConfigHistory
+	if err := db.GetDB().Where("change_id = ?", req.ChangeID).Find(&history).Error; err != nil {
+		h.logger.Error("Failed to load config change", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to revert config")
+		return
+	}
+	if len(history) == 0 {
+		response.Error(c, http.StatusNotFound, "Config change not found")
+		return
+	}
+
+	values := make(map[string]string, len(history))
+	keys := make([]string, 0, len(history))
+	for _, item := range history {
+		values[item.Key] = item.OldValue
+		keys = append(keys, item.Key)
+	}
+	sort.Strings(keys)
+
+	changeID, _, err := h.applyConfig(values, c.GetUint("user_id"), req.ChangeID)
+	if err != nil {
+		h.logger.Error("Failed to revert system config", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to revert config")
+		return
+	}
+
+	recordAudit(c, h.logger, "config_revert", "system_config", 0, req.ChangeID)
+	h.logger.Info("System config reverted",
+		zap.String("change_id", req.ChangeID),
+		zap.Strings("keys", keys))
+
+	response.OK(c, RevertConfigResponse{
+		ChangeID: changeID,
+		Keys:     keys,
+	})
+}
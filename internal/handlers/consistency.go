@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"eino-rag/internal/response"
+	"eino-rag/internal/services/document"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type ConsistencyHandler struct {
+	reconciler *document.Reconciler // 可为nil，表示向量库不可用
+	logger     *zap.Logger
+}
+
+func NewConsistencyHandler(reconciler *document.Reconciler, logger *zap.Logger) *ConsistencyHandler {
+	return &ConsistencyHandler{
+		reconciler: reconciler,
+		logger:     logger,
+	}
+}
+
+// GetReport 获取SQL与向量库的一致性报告
+// @Summary 获取一致性报告
+// @Description 返回最近一次数据库与Milvus一致性检查的结果：孤立向量（没有文档记录的向量）、已清理的孤立向量和缺失向量（已索引却没有向量、已标记为失败等待重新索引）的文档（需要管理员权限）。refresh=true 或还没有报告时立即执行一次检查，是否清理孤立向量由 CONSISTENCY_AUTO_CLEANUP 决定
+// @Tags 系统
+// @Produce json
+// @Security ApiKeyAuth
+// @Param refresh query bool false "立即重新检查"
+// @Success 200 {object} response.Envelope{data=document.ConsistencyReport} "一致性报告"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "权限不足"
+// @Failure 409 {object} ErrorResponse "检查正在执行"
+// @Failure 500 {object} ErrorResponse "检查失败"
+// @Failure 503 {object} ErrorResponse "向量数据库不可用"
+// @Router /api/system/consistency [get]
+func (h *ConsistencyHandler) GetReport(c *gin.Context) {
+	if h.reconciler == nil {
+		response.Error(c, http.StatusServiceUnavailable, "Vector database is not available")
+		return
+	}
+
+	if c.Query("refresh") != "true" {
+		if report := h.reconciler.LastReport(c.Request.Context()); report != nil {
+			response.OK(c, report)
+			return
+		}
+	}
+
+	report, err := h.reconciler.Run(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, document.ErrConsistencyCheckRunning) {
+			response.Error(c, http.StatusConflict, err.Error())
+			return
+		}
+		h.logger.Error("Consistency check failed", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to check consistency")
+		return
+	}
+	response.OK(c, report)
+}
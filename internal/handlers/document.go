@@ -2,11 +2,20 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"mime/multipart"
 	"net/http"
 	"strconv"
 	"time"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/jobs"
+	"eino-rag/internal/models"
+	"eino-rag/internal/response"
 	"eino-rag/internal/services/document"
+	"eino-rag/internal/services/rag"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -14,61 +23,53 @@ import (
 
 type DocumentHandler struct {
 	docService *document.Service
+	jobs       *jobs.Manager
 	logger     *zap.Logger
 }
 
-func NewDocumentHandler(docService *document.Service, logger *zap.Logger) *DocumentHandler {
+func NewDocumentHandler(docService *document.Service, jobManager *jobs.Manager, logger *zap.Logger) *DocumentHandler {
 	return &DocumentHandler{
 		docService: docService,
+		jobs:       jobManager,
 		logger:     logger,
 	}
 }
 
 // Upload 上传文档
 // @Summary 上传文档
-// @Description 上传文档到指定知识库
+// @Description 上传文档到指定知识库，非管理员只能上传到自己创建的知识库，对话附件需通过对话上传。async=true 时只检查知识库和文件类型，返回202和上传任务，
+// @Description 解析、切分、向量化和写入在后台执行，进度通过 /api/documents/jobs/{id} 查询
 // @Tags 文档管理
 // @Accept multipart/form-data
 // @Produce json
 // @Security ApiKeyAuth
 // @Param kb_id formData int true "知识库ID"
 // @Param file formData file true "文档文件"
-// @Success 200 {object} UploadResponse "上传成功"
+// @Param page_start formData int false "PDF起始页（从1开始），仅对PDF生效"
+// @Param page_end formData int false "PDF结束页（包含），仅对PDF生效，解析页数受 PDF_MAX_PAGES 限制"
+// @Param async query bool false "是否在后台处理"
+// @Success 200 {object} response.Envelope{data=UploadResponse} "上传成功"
+// @Success 202 {object} response.Envelope{data=models.UploadJob} "已创建的上传任务"
 // @Failure 400 {object} ErrorResponse "请求错误"
 // @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "无权访问该知识库"
+// @Failure 404 {object} ErrorResponse "知识库不存在"
+// @Failure 408 {object} ErrorResponse "上传整体超时"
+// @Failure 413 {object} ErrorResponse "文档分块数超过上限（CHUNK_LIMIT_ACTION=reject）"
+// @Failure 422 {object} ErrorResponse "文档没有可提取的文本"
+// @Failure 504 {object} response.Envelope{data=TimeoutErrorData} "切分、向量化或写入向量库超时"
 // @Router /api/documents/upload [post]
 func (h *DocumentHandler) Upload(c *gin.Context) {
-	// 获取用户ID
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{
-			Success: false,
-			Message: "User not found in context",
-		})
-		return
-	}
-
-	// 获取知识库ID
-	kbIDStr := c.PostForm("kb_id")
-	kbID, err := strconv.ParseUint(kbIDStr, 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Success: false,
-			Message: "Invalid knowledge base ID",
-		})
+	form, ok := h.parseUploadForm(c)
+	if !ok {
 		return
 	}
+	defer form.file.Close()
 
-	// 获取文件
-	file, header, err := c.Request.FormFile("file")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Success: false,
-			Message: "Failed to get file",
-		})
+	if c.Query("async") == "true" {
+		h.startUploadJob(c, form)
 		return
 	}
-	defer file.Close()
 
 	// 上传文档
 	// 设置上传超时时间，避免前端无限等待
@@ -76,115 +77,250 @@ func (h *DocumentHandler) Upload(c *gin.Context) {
 	defer cancel()
 	
 	h.logger.Info("Starting document upload",
-		zap.String("filename", header.Filename),
-		zap.Int64("filesize", header.Size),
-		zap.Uint64("kb_id", kbID))
+		zap.String("filename", form.header.Filename),
+		zap.Int64("filesize", form.header.Size),
+		zap.Uint("kb_id", form.kbID))
 	
-	doc, chunkCount, err := h.docService.UploadDocument(
+	doc, indexed, err := h.docService.UploadDocument(
 		uploadCtx,
-		header.Filename,
-		file,
-		uint(kbID),
-		userID.(uint),
+		form.header.Filename,
+		form.file,
+		form.kbID,
+		form.userID,
+		form.opts,
 	)
 	if err != nil {
 		h.logger.Error("Failed to upload document", 
-			zap.String("filename", header.Filename),
+			zap.String("filename", form.header.Filename),
 			zap.Error(err))
-		
-		// 检查是否是超时错误
-		if errors.Is(err, context.DeadlineExceeded) {
-			c.JSON(http.StatusRequestTimeout, ErrorResponse{
-				Success: false,
-				Message: "Upload timeout. The file is too large or processing is taking too long.",
-			})
-			return
-		}
-		
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Success: false,
-			Message: err.Error(),
-		})
+		respondUploadError(c, err)
 		return
 	}
 
 	h.logger.Info("Document uploaded successfully",
-		zap.String("filename", header.Filename),
+		zap.String("filename", form.header.Filename),
 		zap.Uint("document_id", doc.ID),
-		zap.Int("chunk_count", chunkCount))
+		zap.Int("indexed_chunks", indexed),
+		zap.Int("failed_chunks", doc.FailedChunks))
 	
-	c.JSON(http.StatusOK, UploadResponse{
-		Success:    true,
-		Message:    "Document uploaded successfully",
-		DocumentID: doc.ID,
-		ChunkCount: chunkCount,
+	response.OK(c, newIndexResponse(doc, indexed, "Document uploaded successfully"))
+}
+
+// uploadForm 上传接口的表单参数
+type uploadForm struct {
+	userID uint
+	kbID   uint
+	opts   document.UploadOptions
+	file   multipart.File
+	header *multipart.FileHeader
+}
+
+// parseUploadForm 解析上传表单，参数无效时写入错误响应并返回false，成功时由调用方关闭文件
+func (h *DocumentHandler) parseUploadForm(c *gin.Context) (*uploadForm, bool) {
+	// 获取用户ID
+	userID, exists := c.Get("user_id")
+	if !exists {
+		response.Error(c, http.StatusUnauthorized, "User not found in context")
+		return nil, false
+	}
+
+	// 获取知识库ID
+	kbID, err := strconv.ParseUint(c.PostForm("kb_id"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid knowledge base ID")
+		return nil, false
+	}
+
+	// 只能上传到自己创建的普通知识库，对话附件通过对话上传
+	if err := authorizePersistentKnowledgeBase(c, uint(kbID)); err != nil {
+		status, message := knowledgeBaseAccessError(err)
+		if status == http.StatusInternalServerError {
+			h.logger.Error("Failed to check knowledge base access", zap.Error(err))
+		}
+		response.Error(c, status, message)
+		return nil, false
+	}
+
+	// 可选的PDF页码范围
+	opts, err := uploadOptions(c)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+
+	// 获取文件
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Failed to get file")
+		return nil, false
+	}
+	return &uploadForm{userID: userID.(uint), kbID: uint(kbID), opts: opts, file: file, header: header}, true
+}
+
+// respondUploadError 按上传失败的原因返回相应的状态码
+func respondUploadError(c *gin.Context, err error) {
+	if errors.Is(err, document.ErrInvalidPageRange) || errors.Is(err, document.ErrUnknownFileType) || errors.Is(err, document.ErrDuplicate) {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, document.ErrNoText) {
+		response.Error(c, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if errors.Is(err, document.ErrTooManyChunks) {
+		response.Error(c, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+
+	// 检查是否是超时错误：某个阶段超时返回504，上传整体超时返回408
+	if respondStageTimeout(c, err) {
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		response.Error(c, http.StatusRequestTimeout, "Upload timeout. The file is too large or processing is taking too long.")
+		return
+	}
+
+	response.Error(c, http.StatusInternalServerError, err.Error())
+}
+
+// GetLimits 获取上传限制
+// @Summary 获取上传限制
+// @Description 获取允许的文件类型、文件大小、PDF页数和单个文档的分块数上限，用于上传页面提示
+// @Tags 文档管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Envelope{data=DocumentLimitsResponse} "上传限制"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Router /api/documents/limits [get]
+func (h *DocumentHandler) GetLimits(c *gin.Context) {
+	cfg := config.Get().Snapshot()
+	response.OK(c, DocumentLimitsResponse{
+		AllowedFileTypes:     cfg.AllowedFileTypes,
+		MaxUploadSize:        cfg.MaxUploadSize,
+		PDFMaxPages:          cfg.PDFMaxPages,
+		MaxChunksPerDocument: cfg.MaxChunksPerDocument,
+		ChunkLimitAction:     string(cfg.ChunkLimitAction),
 	})
 }
 
 // Search 搜索文档
 // @Summary 搜索文档
-// @Description 在知识库中搜索相关文档
+// @Description 在知识库中搜索相关文档，可按文档创建者和创建时间过滤，结果附带文档的创建者和创建时间
+// @Description 非管理员必须指定 kb_id，且只能搜索自己创建的知识库；不指定 kb_id 时（仅管理员）搜索全部知识库
+// @Description context_window 大于0时结果中按文档补充命中分块前后的相邻分块
 // @Tags 文档管理
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
 // @Param request body SearchRequest true "搜索请求"
-// @Success 200 {object} SearchResponse "搜索结果"
+// @Success 200 {object} response.Envelope{data=SearchResponse} "搜索结果"
 // @Failure 400 {object} ErrorResponse "请求错误"
+// @Failure 403 {object} ErrorResponse "无权访问该知识库"
+// @Failure 404 {object} ErrorResponse "知识库不存在"
+// @Failure 504 {object} response.Envelope{data=TimeoutErrorData} "查询向量化或向量检索超时"
 // @Router /api/documents/search [post]
 func (h *DocumentHandler) Search(c *gin.Context) {
 	var req SearchRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Success: false,
-			Message: "Invalid request data",
-		})
+		response.Error(c, http.StatusBadRequest, "Invalid request data")
+		return
+	}
+
+	if err := validateSearchEffort(req.KnowledgeBaseID, req.SearchEffort, req.TopK); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validateDateRange(req.CreatedAfter, req.CreatedBefore); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
+	// 检查知识库访问权限，不指定知识库时检索全部知识库，仅限管理员
+	if req.KnowledgeBaseID == 0 && c.GetString("role_name") != "admin" {
+		response.Error(c, http.StatusBadRequest, "kb_id is required")
+		return
+	}
+	if req.KnowledgeBaseID > 0 {
+		if err := authorizeKnowledgeBase(c, req.KnowledgeBaseID); err != nil {
+			status, message := knowledgeBaseAccessError(err)
+			if status == http.StatusInternalServerError {
+				h.logger.Error("Failed to check knowledge base access", zap.Error(err))
+			}
+			response.Error(c, status, message)
+			return
+		}
+	}
+
 	// 搜索文档
-	docs, err := h.docService.SearchDocuments(
+	docs, err := h.docService.SearchDocumentsWithOptions(
 		c.Request.Context(),
 		req.Query,
 		req.KnowledgeBaseID,
-		req.TopK,
+		rag.RetrieveOptions{
+			TopK:                req.TopK,
+			SearchEffort:        req.SearchEffort,
+			RecencyWeight:       req.RecencyWeight,
+			RecencyHalfLifeDays: req.RecencyHalfLifeDays,
+			MaxChunksPerDoc:     req.MaxChunksPerDoc,
+			CandidateMultiplier: req.CandidateMultiplier,
+			CreatorID:           req.CreatorID,
+			CreatedAfter:        req.CreatedAfter,
+			CreatedBefore:       req.CreatedBefore,
+			Tags:                req.Tags,
+			Hybrid:              req.UseHybrid,
+		},
 	)
 	if err != nil {
 		h.logger.Error("Failed to search documents", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Success: false,
-			Message: "Failed to search documents",
-		})
+		if respondStageTimeout(c, err) {
+			return
+		}
+		response.Error(c, http.StatusInternalServerError, "Failed to search documents")
 		return
 	}
 
-	// 转换结果
-	results := make([]DocResult, 0, len(docs))
-	for _, doc := range docs {
-		score := 0.0
-		if v, ok := doc.MetaData["score"].(float64); ok {
-			score = v
-		}
-		
-		results = append(results, DocResult{
-			ID:       doc.ID,
-			Content:  doc.Content,
-			Score:    score,
-			Metadata: doc.MetaData,
-		})
+	// 按需补充相邻分块，扩展失败不影响检索结果本身
+	contextWindow := config.Get().Snapshot().ContextWindow
+	if req.ContextWindow != nil {
+		contextWindow = *req.ContextWindow
+	}
+	if expanded, err := h.docService.ExpandContext(docs, contextWindow); err != nil {
+		h.logger.Warn("Failed to expand search context", zap.Error(err))
+	} else {
+		docs = expanded
 	}
 
-	c.JSON(http.StatusOK, SearchResponse{
-		Success:   true,
+	// 转换结果
+	results := toDocResults(docs)
+
+	response.OK(c, SearchResponse{
 		Query:     req.Query,
 		Documents: results,
 		Timestamp: time.Now().Unix(),
 	})
 }
 
+// validateSearchEffort 按当前索引类型检查请求的检索力度，topK <= 0 时使用知识库或全局的默认值
+func validateSearchEffort(kbID uint, effort, topK int) error {
+	if effort <= 0 {
+		return nil
+	}
+	cfg := config.Get().Snapshot()
+	return rag.ValidateSearchEffort(cfg.IndexType, effort, document.ResolveTopK(cfg, kbID, topK))
+}
+
+// validateDateRange 检查按创建时间过滤的范围，两端都指定时起始时间必须早于结束时间
+func validateDateRange(after, before *time.Time) error {
+	if after != nil && before != nil && !after.Before(*before) {
+		return fmt.Errorf("created_after must be earlier than created_before")
+	}
+	return nil
+}
+
 // List 获取文档列表
 // @Summary 获取文档列表
-// @Description 获取指定知识库的文档列表
+// @Description 获取指定知识库的文档列表（仅管理员或知识库创建者）
 // @Tags 文档管理
 // @Accept json
 // @Produce json
@@ -192,17 +328,24 @@ func (h *DocumentHandler) Search(c *gin.Context) {
 // @Param kb_id path int true "知识库ID"
 // @Param page query int false "页码" default(1)
 // @Param page_size query int false "每页数量" default(10)
-// @Success 200 {object} DocumentListResponse "文档列表"
+// @Success 200 {object} response.Envelope{data=DocumentListResponse} "文档列表"
 // @Failure 400 {object} ErrorResponse "请求错误"
+// @Failure 403 {object} ErrorResponse "无权访问该知识库"
+// @Failure 404 {object} ErrorResponse "知识库不存在"
 // @Router /api/knowledge-bases/{kb_id}/documents [get]
 func (h *DocumentHandler) List(c *gin.Context) {
 	// 获取知识库ID
 	kbID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Success: false,
-			Message: "Invalid knowledge base ID",
-		})
+		response.Error(c, http.StatusBadRequest, "Invalid knowledge base ID")
+		return
+	}
+	if err := authorizePersistentKnowledgeBase(c, uint(kbID)); err != nil {
+		status, message := knowledgeBaseAccessError(err)
+		if status == http.StatusInternalServerError {
+			h.logger.Error("Failed to check knowledge base access", zap.Error(err))
+		}
+		response.Error(c, status, message)
 		return
 	}
 
@@ -221,29 +364,406 @@ func (h *DocumentHandler) List(c *gin.Context) {
 	docs, total, err := h.docService.GetDocumentsByKB(uint(kbID), page, pageSize)
 	if err != nil {
 		h.logger.Error("Failed to get documents", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Success: false,
-			Message: "Failed to get documents",
-		})
+		response.Error(c, http.StatusInternalServerError, "Failed to get documents")
 		return
 	}
 
 	// 转换结果
 	docInfos := make([]DocumentInfo, len(docs))
 	for i, doc := range docs {
-		docInfos[i] = DocumentInfo{
-			ID:              doc.ID,
-			KnowledgeBaseID: doc.KnowledgeBaseID,
-			FileName:        doc.FileName,
-			FileSize:        doc.FileSize,
-			Hash:            doc.Hash,
-			CreatorID:       doc.CreatorID,
-			CreatedAt:       doc.CreatedAt,
+		docInfos[i] = toDocumentInfo(&doc)
+	}
+
+	response.OK(c, DocumentListResponse{
+		Documents: docInfos,
+		Total:     total,
+		Page:      page,
+		PageSize:  pageSize,
+	})
+}
+
+// chunkExportMaxLimit 分块导出单页最多的分块数
+const chunkExportMaxLimit = 100000
+
+// ExportChunks 导出知识库分块及向量
+// @Summary 导出知识库分块及向量
+// @Description 以JSON Lines流式导出知识库的分块，每行包含分块ID、内容、元数据和向量，供外部工具使用；没有向量的分块不导出（仅管理员或知识库创建者）
+// @Description 指定 limit 时分页导出，还有更多分块时响应头 X-Next-Cursor 为下一页的 cursor；不指定时导出全部
+// @Tags 知识库
+// @Produce application/x-ndjson
+// @Security ApiKeyAuth
+// @Param id path int true "知识库ID"
+// @Param format query string false "导出格式，目前只支持 jsonl" default(jsonl)
+// @Param cursor query int false "从该游标之后开始导出，即上一页的 X-Next-Cursor" default(0)
+// @Param limit query int false "本页最多读取的分块数，0表示全部，最大100000" default(0)
+// @Success 200 {file} file "每行一个分块的JSON"
+// @Failure 400 {object} ErrorResponse "请求错误"
+// @Failure 403 {object} ErrorResponse "权限不足"
+// @Failure 404 {object} ErrorResponse "知识库不存在"
+// @Failure 503 {object} ErrorResponse "向量库不可用"
+// @Router /api/knowledge-bases/{id}/chunks/export [get]
+func (h *DocumentHandler) ExportChunks(c *gin.Context) {
+	kbID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid knowledge base ID")
+		return
+	}
+	if format := c.DefaultQuery("format", "jsonl"); format != "jsonl" {
+		response.Error(c, http.StatusBadRequest, "Unsupported export format, only jsonl is supported")
+		return
+	}
+	cursor, err := strconv.ParseUint(c.DefaultQuery("cursor", "0"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil || limit < 0 || limit > chunkExportMaxLimit {
+		response.Error(c, http.StatusBadRequest, fmt.Sprintf("limit must be between 0 and %d", chunkExportMaxLimit))
+		return
+	}
+
+	if err := authorizeKnowledgeBase(c, uint(kbID)); err != nil {
+		status, message := knowledgeBaseAccessError(err)
+		if status == http.StatusInternalServerError {
+			h.logger.Error("Failed to check knowledge base access", zap.Error(err))
+		}
+		response.Error(c, status, message)
+		return
+	}
+
+	next, err := h.docService.NextChunkCursor(uint(kbID), uint(cursor), limit)
+	if err != nil {
+		h.logger.Error("Failed to prepare chunk export", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to export chunks")
+		return
+	}
+
+	recordAudit(c, h.logger, "kb_chunk_export", "knowledge_base", uint(kbID), fmt.Sprintf("cursor=%d limit=%d", cursor, limit))
+
+	filename := fmt.Sprintf("kb_%d_chunks_%s.jsonl", kbID, time.Now().Format("20060102150405"))
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if next > 0 {
+		c.Header("X-Next-Cursor", strconv.FormatUint(uint64(next), 10))
+	}
+
+	// 第一批写出前出错仍可返回错误响应，之后只能中断输出并记录日志
+	started := false
+	encoder := json.NewEncoder(c.Writer)
+	exported, err := h.docService.ExportChunks(c.Request.Context(), uint(kbID), uint(cursor), limit, func(batch []document.ChunkExport) error {
+		if !started {
+			started = true
+			c.Status(http.StatusOK)
+		}
+		for i := range batch {
+			if err := encoder.Encode(&batch[i]); err != nil {
+				return err
+			}
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil {
+		h.logger.Error("Failed to export chunks",
+			zap.Uint64("kb_id", kbID),
+			zap.Int("exported", exported),
+			zap.Error(err))
+		if !started {
+			c.Writer.Header().Del("Content-Disposition")
+			c.Writer.Header().Del("X-Next-Cursor")
+			if rag.IsVectorStoreUnavailable(err) {
+				response.Error(c, http.StatusServiceUnavailable, "Vector database is not available")
+			} else {
+				response.Error(c, http.StatusInternalServerError, "Failed to export chunks")
+			}
+		}
+		return
+	}
+	if !started {
+		c.Status(http.StatusOK)
+		c.Writer.WriteHeaderNow()
+	}
+
+	h.logger.Info("Knowledge base chunks exported",
+		zap.Uint64("kb_id", kbID),
+		zap.Uint("user_id", c.GetUint("user_id")),
+		zap.Int("chunks", exported))
+}
+
+// Get 获取文档详情
+// @Summary 获取文档详情
+// @Description 获取文档信息及其入库处理状态（仅管理员或文档所在知识库的创建者）
+// @Tags 文档管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "文档ID"
+// @Success 200 {object} response.Envelope{data=DocumentDetailResponse} "文档详情"
+// @Failure 400 {object} ErrorResponse "请求错误"
+// @Failure 403 {object} ErrorResponse "无权访问该知识库"
+// @Failure 404 {object} ErrorResponse "文档不存在"
+// @Router /api/documents/{id} [get]
+func (h *DocumentHandler) Get(c *gin.Context) {
+	// 获取文档ID
+	docID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid document ID")
+		return
+	}
+
+	doc, err := h.docService.GetDocument(uint(docID))
+	if err != nil {
+		status := http.StatusInternalServerError
+		message := "Failed to get document"
+
+		if err.Error() == "document not found" {
+			status = http.StatusNotFound
+			message = err.Error()
+		} else {
+			h.logger.Error("Failed to get document", zap.Error(err))
+		}
+
+		response.Error(c, status, message)
+		return
+	}
+	if err := authorizePersistentKnowledgeBase(c, doc.KnowledgeBaseID); err != nil {
+		status, message := knowledgeBaseAccessError(err)
+		if status == http.StatusInternalServerError {
+			h.logger.Error("Failed to check knowledge base access", zap.Error(err))
+		}
+		response.Error(c, status, message)
+		return
+	}
+
+	response.OK(c, DocumentDetailResponse{
+		Document: toDocumentInfo(doc),
+	})
+}
+
+// Preview 获取文档预览
+// @Summary 获取文档预览
+// @Description 返回上传时保存的文档开头文本（最多 DOCUMENT_PREVIEW_LENGTH 个字符，PDF 不超过第一页），不执行检索也不返回分块
+// @Description 预览为去除控制字符后的纯文本，显示时仍应按文本转义
+// @Tags 文档管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "文档ID"
+// @Success 200 {object} response.Envelope{data=DocumentPreviewResponse} "文档预览"
+// @Failure 400 {object} ErrorResponse "请求错误"
+// @Failure 403 {object} ErrorResponse "无权访问该知识库"
+// @Failure 404 {object} ErrorResponse "文档不存在"
+// @Router /api/documents/{id}/preview [get]
+func (h *DocumentHandler) Preview(c *gin.Context) {
+	docID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid document ID")
+		return
+	}
+
+	doc, err := h.docService.GetDocumentPreview(uint(docID))
+	if err != nil {
+		if err.Error() == "document not found" {
+			response.Error(c, http.StatusNotFound, err.Error())
+			return
+		}
+		h.logger.Error("Failed to get document preview", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to get document preview")
+		return
+	}
+
+	// 预览包含文档内容，需要有知识库的访问权限
+	if err := authorizeKnowledgeBase(c, doc.KnowledgeBaseID); err != nil {
+		status, message := knowledgeBaseAccessError(err)
+		if status == http.StatusInternalServerError {
+			h.logger.Error("Failed to check knowledge base access", zap.Error(err))
+		}
+		response.Error(c, status, message)
+		return
+	}
+
+	// 预览在文档删除前不会变化，允许客户端短时间缓存
+	c.Header("Cache-Control", "private, max-age=300")
+	response.OK(c, DocumentPreviewResponse{
+		DocumentID: doc.ID,
+		FileName:   doc.FileName,
+		FileType:   doc.FileType,
+		TotalPages: doc.TotalPages,
+		Preview:    doc.Preview,
+	})
+}
+
+// RetryIndex 重新索引失败的文档
+// @Summary 重新索引文档
+// @Description 使用已保存的分块重新执行向量化和写入，仅适用于状态为failed的文档
+// @Tags 文档管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "文档ID"
+// @Success 200 {object} response.Envelope{data=UploadResponse} "重新索引成功"
+// @Failure 400 {object} ErrorResponse "请求错误"
+// @Failure 403 {object} ErrorResponse "权限不足"
+// @Failure 404 {object} ErrorResponse "文档不存在"
+// @Failure 409 {object} ErrorResponse "文档正在重新索引或状态不符"
+// @Failure 504 {object} response.Envelope{data=TimeoutErrorData} "向量化或写入向量库超时"
+// @Router /api/documents/{id}/retry-index [post]
+func (h *DocumentHandler) RetryIndex(c *gin.Context) {
+	// 获取文档ID
+	docID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid document ID")
+		return
+	}
+
+	// 仅文档创建者或管理员可以重试
+	doc, err := h.docService.GetDocument(uint(docID))
+	if err != nil {
+		status := http.StatusInternalServerError
+		message := "Failed to get document"
+		if err.Error() == "document not found" {
+			status = http.StatusNotFound
+			message = err.Error()
+		}
+		response.Error(c, status, message)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	roleName, _ := c.Get("role_name")
+	if roleName != "admin" && doc.CreatorID != userID.(uint) {
+		response.Error(c, http.StatusForbidden, "You don't have permission to re-index this document")
+		return
+	}
+
+	retried, indexed, err := h.docService.RetryIndex(c.Request.Context(), doc.ID)
+	if err != nil {
+		h.logger.Error("Failed to retry document indexing",
+			zap.Uint("doc_id", doc.ID),
+			zap.Error(err))
+
+		if respondStageTimeout(c, err) {
+			return
+		}
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, document.ErrRetryInProgress), errors.Is(err, document.ErrNotFailed):
+			status = http.StatusConflict
+		case errors.Is(err, document.ErrNoStoredChunks):
+			status = http.StatusUnprocessableEntity
+		}
+
+		response.Error(c, status, err.Error())
+		return
+	}
+
+	response.OK(c, newIndexResponse(retried, indexed, "Document re-indexed successfully"))
+}
+
+// RetryFailed 批量重新索引失败的文档
+// @Summary 批量重新索引失败文档
+// @Description 对所有状态为failed的文档重新执行向量化和写入（管理员接口）。async=true 时在后台执行并返回任务，进度可通过 /api/system/jobs/{id}/stream 订阅
+// @Tags 文档管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param async query bool false "是否在后台执行"
+// @Success 200 {object} response.Envelope{data=RetryFailedResponse} "重试结果统计"
+// @Success 202 {object} response.Envelope{data=JobResponse} "已启动的后台任务"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "权限不足"
+// @Router /api/documents/retry-failed [post]
+func (h *DocumentHandler) RetryFailed(c *gin.Context) {
+	if c.Query("async") == "true" {
+		job := h.jobs.Start("retry_failed", func(ctx context.Context, progress jobs.Reporter) (interface{}, error) {
+			return h.docService.RetryFailedDocuments(ctx, progress)
+		})
+		response.JSON(c, http.StatusAccepted, JobResponse{Job: job})
+		return
+	}
+
+	result, err := h.docService.RetryFailedDocuments(c.Request.Context(), nil)
+	if err != nil && result == nil {
+		h.logger.Error("Failed to retry failed documents", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to retry failed documents")
+		return
+	}
+
+	response.OK(c, RetryFailedResponse{
+		Total:     result.Total,
+		Succeeded: result.Succeeded,
+		Failed:    result.Failed,
+		Skipped:   result.Skipped,
+		FailedIDs: result.FailedIDs,
+	})
+}
+
+// ListOutdated 获取分块参数过期的文档
+// @Summary 获取分块参数过期的文档
+// @Description 列出已索引、但索引时使用的分块参数（chunk_size/chunk_overlap/chunking_strategy）与当前配置不一致的文档（管理员接口）
+// @Tags 文档管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param kb_id query int false "知识库ID，不传时查询全部知识库"
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(10)
+// @Success 200 {object} response.Envelope{data=OutdatedDocumentsResponse} "过期文档列表"
+// @Failure 400 {object} ErrorResponse "请求错误"
+// @Failure 403 {object} ErrorResponse "权限不足"
+// @Router /api/documents/outdated [get]
+func (h *DocumentHandler) ListOutdated(c *gin.Context) {
+	kbID, err := optionalKBID(c)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid knowledge base ID")
+		return
+	}
+
+	// 获取分页参数
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	docs, total, err := h.docService.GetOutdatedDocuments(kbID, page, pageSize)
+	if err != nil {
+		h.logger.Error("Failed to get outdated documents", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to get outdated documents")
+		return
+	}
+
+	docIDs := make([]uint, len(docs))
+	for i, doc := range docs {
+		docIDs[i] = doc.ID
+	}
+	hasText, err := h.docService.HasStoredText(docIDs)
+	if err != nil {
+		h.logger.Error("Failed to check stored document text", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to get outdated documents")
+		return
+	}
+
+	docInfos := make([]OutdatedDocumentInfo, len(docs))
+	for i, doc := range docs {
+		docInfos[i] = OutdatedDocumentInfo{
+			DocumentInfo: toDocumentInfo(&doc),
+			Reindexable:  hasText[doc.ID],
 		}
 	}
 
-	c.JSON(http.StatusOK, DocumentListResponse{
-		Success:   true,
+	current := document.CurrentChunkingParams(config.Get().Snapshot())
+	response.OK(c, OutdatedDocumentsResponse{
+		Current: ChunkingConfig{
+			ChunkSize:        current.ChunkSize,
+			ChunkOverlap:     current.ChunkOverlap,
+			ChunkingStrategy: string(current.Strategy),
+		},
 		Documents: docInfos,
 		Total:     total,
 		Page:      page,
@@ -251,6 +771,65 @@ func (h *DocumentHandler) List(c *gin.Context) {
 	})
 }
 
+// RechunkOutdated 使用当前分块配置重新索引过期的文档
+// @Summary 重新索引分块参数过期的文档
+// @Description 使用当前分块配置重新切分并索引所有过期文档（管理员接口）。没有保存解析文本的旧文档会被跳过，需要重新上传。
+// @Description async=true 时在后台执行并返回任务，进度可通过 /api/system/jobs/{id}/stream 订阅
+// @Tags 文档管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param kb_id query int false "知识库ID，不传时处理全部知识库"
+// @Param async query bool false "是否在后台执行"
+// @Success 200 {object} response.Envelope{data=RetryFailedResponse} "重新索引结果统计"
+// @Success 202 {object} response.Envelope{data=JobResponse} "已启动的后台任务"
+// @Failure 400 {object} ErrorResponse "请求错误"
+// @Failure 403 {object} ErrorResponse "权限不足"
+// @Router /api/documents/rechunk-outdated [post]
+func (h *DocumentHandler) RechunkOutdated(c *gin.Context) {
+	kbID, err := optionalKBID(c)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid knowledge base ID")
+		return
+	}
+
+	if c.Query("async") == "true" {
+		job := h.jobs.Start("rechunk_outdated", func(ctx context.Context, progress jobs.Reporter) (interface{}, error) {
+			return h.docService.RechunkOutdatedDocuments(ctx, kbID, progress)
+		})
+		response.JSON(c, http.StatusAccepted, JobResponse{Job: job})
+		return
+	}
+
+	result, err := h.docService.RechunkOutdatedDocuments(c.Request.Context(), kbID, nil)
+	if err != nil && result == nil {
+		h.logger.Error("Failed to re-chunk outdated documents", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to re-chunk outdated documents")
+		return
+	}
+
+	response.OK(c, RetryFailedResponse{
+		Total:     result.Total,
+		Succeeded: result.Succeeded,
+		Failed:    result.Failed,
+		Skipped:   result.Skipped,
+		FailedIDs: result.FailedIDs,
+	})
+}
+
+// optionalKBID 解析可选的 kb_id 查询参数，未提供时返回 0
+func optionalKBID(c *gin.Context) (uint, error) {
+	val := c.Query("kb_id")
+	if val == "" {
+		return 0, nil
+	}
+	kbID, err := strconv.ParseUint(val, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint(kbID), nil
+}
+
 // Delete 删除文档
 // @Summary 删除文档
 // @Description 删除指定文档
@@ -259,7 +838,7 @@ func (h *DocumentHandler) List(c *gin.Context) {
 // @Produce json
 // @Security ApiKeyAuth
 // @Param id path int true "文档ID"
-// @Success 200 {object} SuccessResponse "删除成功"
+// @Success 200 {object} response.Envelope{data=SuccessResponse} "删除成功"
 // @Failure 400 {object} ErrorResponse "请求错误"
 // @Failure 404 {object} ErrorResponse "文档不存在"
 // @Router /api/documents/{id} [delete]
@@ -267,10 +846,7 @@ func (h *DocumentHandler) Delete(c *gin.Context) {
 	// 获取文档ID
 	docID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Success: false,
-			Message: "Invalid document ID",
-		})
+		response.Error(c, http.StatusBadRequest, "Invalid document ID")
 		return
 	}
 
@@ -286,29 +862,25 @@ func (h *DocumentHandler) Delete(c *gin.Context) {
 			message = err.Error()
 		}
 		
-		c.JSON(status, ErrorResponse{
-			Success: false,
-			Message: message,
-		})
+		response.Error(c, status, message)
 		return
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse{
-		Success: true,
+	response.OK(c, SuccessResponse{
 		Message: "Document deleted successfully",
 	})
 }
 
 // ListAll 获取所有文档列表
 // @Summary 获取所有文档列表
-// @Description 获取系统中所有文档的列表（管理员接口）
+// @Description 获取文档列表，管理员返回所有文档，其他用户只返回自己创建的知识库中的文档
 // @Tags 文档管理
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
 // @Param page query int false "页码" default(1)
 // @Param page_size query int false "每页数量" default(10)
-// @Success 200 {object} DocumentListResponse "文档列表"
+// @Success 200 {object} response.Envelope{data=DocumentListResponse} "文档列表"
 // @Failure 400 {object} ErrorResponse "请求错误"
 // @Router /api/documents [get]
 func (h *DocumentHandler) ListAll(c *gin.Context) {
@@ -324,42 +896,104 @@ func (h *DocumentHandler) ListAll(c *gin.Context) {
 	}
 
 	// 获取文档列表
-	docs, total, err := h.docService.GetAllDocuments(page, pageSize)
+	docs, total, err := h.docService.GetAllDocuments(page, pageSize, accessibleKnowledgeBases(c))
 	if err != nil {
 		h.logger.Error("Failed to get all documents", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Success: false,
-			Message: "Failed to get documents",
-		})
+		response.Error(c, http.StatusInternalServerError, "Failed to get documents")
 		return
 	}
 
 	// 转换结果
 	docInfos := make([]DocumentInfo, len(docs))
 	for i, doc := range docs {
-		docInfo := DocumentInfo{
-			ID:              doc.ID,
-			KnowledgeBaseID: doc.KnowledgeBaseID,
-			FileName:        doc.FileName,
-			FileSize:        doc.FileSize,
-			Hash:            doc.Hash,
-			CreatorID:       doc.CreatorID,
-			CreatedAt:       doc.CreatedAt,
-		}
-		
-		// 如果预加载了知识库信息，添加知识库名称
-		if doc.KnowledgeBase != nil {
-			docInfo.KnowledgeBaseName = doc.KnowledgeBase.Name
-		}
-		
-		docInfos[i] = docInfo
+		docInfos[i] = toDocumentInfo(&doc)
 	}
 
-	c.JSON(http.StatusOK, DocumentListResponse{
-		Success:   true,
+	response.OK(c, DocumentListResponse{
 		Documents: docInfos,
 		Total:     total,
 		Page:      page,
 		PageSize:  pageSize,
 	})
-}
\ No newline at end of file
+}
+
+// toDocumentInfo 转换文档模型为响应格式
+func toDocumentInfo(doc *models.Document) DocumentInfo {
+	info := DocumentInfo{
+		ID:               doc.ID,
+		KnowledgeBaseID:  doc.KnowledgeBaseID,
+		FileName:         doc.FileName,
+		FileSize:         doc.FileSize,
+		FileType:         doc.FileType,
+		Hash:             doc.Hash,
+		NormalizedHash:   doc.NormalizedHash,
+		Status:           string(doc.Status),
+		StatusMessage:    doc.StatusMessage,
+		Summary:          doc.Summary,
+		FailedChunks:     doc.FailedChunks,
+		TruncatedChunks:  doc.TruncatedChunks,
+		Redactions:       doc.Redactions,
+		PageStart:        doc.PageStart,
+		PageEnd:          doc.PageEnd,
+		TotalPages:       doc.TotalPages,
+		ChunkSize:        doc.ChunkSize,
+		ChunkOverlap:     doc.ChunkOverlap,
+		ChunkingStrategy: doc.ChunkingStrategy,
+		Title:            doc.Title,
+		Author:           doc.Author,
+		Tags:             doc.Tags,
+		Date:             doc.DocumentDate,
+		CreatorID:        doc.CreatorID,
+		CreatedAt:        doc.CreatedAt,
+		UpdatedAt:        doc.UpdatedAt,
+	}
+
+	// 如果预加载了知识库信息，添加知识库名称
+	if doc.KnowledgeBase != nil {
+		info.KnowledgeBaseName = doc.KnowledgeBase.Name
+	}
+
+	return info
+}
+
+// newIndexResponse 构造索引结果响应，有分块被跳过时提示部分索引
+func newIndexResponse(doc *models.Document, indexed int, message string) UploadResponse {
+	if doc.FailedChunks > 0 {
+		message = fmt.Sprintf("Document partially indexed: %d chunks failed to embed and were skipped", doc.FailedChunks)
+	} else if doc.TruncatedChunks > 0 {
+		message = fmt.Sprintf("Document partially indexed: %d chunks beyond the maximum number of chunks were dropped", doc.TruncatedChunks)
+	}
+	return UploadResponse{
+		Message:         message,
+		DocumentID:      doc.ID,
+		ChunkCount:      indexed + doc.FailedChunks,
+		IndexedChunks:   indexed,
+		FailedChunks:    doc.FailedChunks,
+		TruncatedChunks: doc.TruncatedChunks,
+	}
+}
+
+// uploadOptions 解析上传表单中的可选参数
+func uploadOptions(c *gin.Context) (document.UploadOptions, error) {
+	var opts document.UploadOptions
+
+	if val := c.PostForm("page_start"); val != "" {
+		start, err := strconv.Atoi(val)
+		if err != nil || start < 1 {
+			return opts, fmt.Errorf("page_start must be a positive integer")
+		}
+		opts.PageStart = start
+	}
+	if val := c.PostForm("page_end"); val != "" {
+		end, err := strconv.Atoi(val)
+		if err != nil || end < 1 {
+			return opts, fmt.Errorf("page_end must be a positive integer")
+		}
+		opts.PageEnd = end
+	}
+	if opts.PageStart > 0 && opts.PageEnd > 0 && opts.PageStart > opts.PageEnd {
+		return opts, fmt.Errorf("page_start must not be greater than page_end")
+	}
+
+	return opts, nil
+}
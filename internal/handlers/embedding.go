@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"eino-rag/internal/response"
+	"eino-rag/internal/services/rag"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type EmbeddingHandler struct {
+	embedding rag.Embedder
+	logger    *zap.Logger
+}
+
+func NewEmbeddingHandler(embedding rag.Embedder, logger *zap.Logger) *EmbeddingHandler {
+	return &EmbeddingHandler{
+		embedding: embedding,
+		logger:    logger,
+	}
+}
+
+// GetStatus 获取嵌入服务状态
+// @Summary 获取嵌入服务状态
+// @Description 返回当前生成向量使用的服务和模型，以及故障转移状态：是否开启、切换到备用服务的时间和主服务最近一次失败的原因（需要管理员权限）
+// @Tags 系统
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Envelope{data=EmbeddingStatusResponse} "嵌入服务状态"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "权限不足"
+// @Router /api/system/embeddings/status [get]
+func (h *EmbeddingHandler) GetStatus(c *gin.Context) {
+	var status rag.EmbeddingStatus
+	if reporter, ok := h.embedding.(rag.EmbeddingStatusReporter); ok {
+		status = reporter.Status()
+	}
+	response.OK(c, embeddingStatusResponse(status))
+}
+
+func embeddingStatusResponse(status rag.EmbeddingStatus) EmbeddingStatusResponse {
+	resp := EmbeddingStatusResponse{
+		ActiveProvider:  status.ActiveProvider,
+		ActiveModel:     status.ActiveModel,
+		PrimaryModel:    status.PrimaryModel,
+		FailoverEnabled: status.FailoverEnabled,
+		FailoverModel:   status.FailoverModel,
+		LastError:       status.LastError,
+	}
+	if !status.FailedOverAt.IsZero() {
+		resp.FailedOverAt = status.FailedOverAt.Unix()
+	}
+	return resp
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"eino-rag/internal/jobs"
+	"eino-rag/internal/response"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// jobStreamKeepAlive 任务进度流在没有更新时发送心跳的间隔，避免代理断开空闲连接
+const jobStreamKeepAlive = 15 * time.Second
+
+// GetJob 获取后台任务状态
+// @Summary 获取后台任务状态
+// @Description 获取批量重建索引等后台任务的当前进度和结果（需要管理员权限）。任务结束一小时后不再保留
+// @Tags 系统
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "任务ID"
+// @Success 200 {object} response.Envelope{data=JobResponse} "任务状态"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "权限不足"
+// @Failure 404 {object} ErrorResponse "任务不存在"
+// @Router /api/system/jobs/{id} [get]
+func (h *SystemHandler) GetJob(c *gin.Context) {
+	job, ok := h.jobs.Get(c.Param("id"))
+	if !ok {
+		response.Error(c, http.StatusNotFound, "Job not found")
+		return
+	}
+
+	response.OK(c, JobResponse{
+		Job: job,
+	})
+}
+
+// StreamJob 通过SSE订阅后台任务进度
+// @Summary 订阅后台任务进度（流式）
+// @Description 通过SSE推送后台任务的进度（需要管理员权限）。响应为 text/event-stream，每个事件是一行 `data: <SSEEvent JSON>`，后跟空行。
+// @Description 连接后立即发送一次 progress 事件（当前状态），之后每处理一个项目发送一次，data 为任务的完整状态（percent、current、errors 等）。
+// @Description 任务成功结束时发送 end 事件（含最终状态和结果）并关闭连接；失败时发送 code 为 job_failed 的 error 事件。没有更新时每15秒发送一次注释行作为心跳
+// @Tags 系统
+// @Produce text/event-stream
+// @Security ApiKeyAuth
+// @Param id path string true "任务ID"
+// @Success 200 {object} SSEEvent "SSE事件流，每个事件的结构"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "权限不足"
+// @Failure 404 {object} ErrorResponse "任务不存在"
+// @Router /api/system/jobs/{id}/stream [get]
+func (h *SystemHandler) StreamJob(c *gin.Context) {
+	job, updates, cancel, ok := h.jobs.Subscribe(c.Param("id"))
+	if !ok {
+		response.Error(c, http.StatusNotFound, "Job not found")
+		return
+	}
+	defer cancel()
+
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		response.Error(c, http.StatusInternalServerError, "Streaming not supported")
+		return
+	}
+
+	// 设置SSE响应头
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	h.sendSSEEvent(c.Writer, JobProgressEvent{Job: job})
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(jobStreamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			// 客户端断开，任务继续在后台执行
+			h.logger.Debug("Job stream client disconnected", zap.String("job_id", job.ID))
+			return
+
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(c.Writer, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case update, open := <-updates:
+			if !open {
+				// 任务已结束，通道关闭前的最新状态可能已被读取，重新获取最终状态
+				final, found := h.jobs.Get(job.ID)
+				if !found {
+					final = job
+				}
+				h.sendJobEnd(c.Writer, final)
+				flusher.Flush()
+				return
+			}
+			job = update
+			h.sendSSEEvent(c.Writer, JobProgressEvent{Job: job})
+			flusher.Flush()
+		}
+	}
+}
+
+// sendJobEnd 发送任务结束事件
+func (h *SystemHandler) sendJobEnd(w http.ResponseWriter, job jobs.Job) {
+	if job.Status == jobs.StatusFailed {
+		h.sendSSEEvent(w, ErrorEvent{
+			Message: job.Error,
+			Code:    "job_failed",
+		})
+		return
+	}
+	h.sendSSEEvent(w, JobEndEvent{Job: job})
+}
+
+// sendSSEEvent 发送SSE事件
+func (h *SystemHandler) sendSSEEvent(w http.ResponseWriter, payload SSEPayload) {
+	if err := WriteSSEEvent(w, payload); err != nil {
+		h.logger.Error("Failed to write SSE event",
+			zap.String("type", payload.EventType()),
+			zap.Error(err))
+	}
+}
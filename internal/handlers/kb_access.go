@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/document"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	errKnowledgeBaseNotFound  = errors.New("knowledge base not found")
+	errKnowledgeBaseForbidden = errors.New("knowledge base access denied")
+)
+
+// authorizeKnowledgeBase 检查当前用户能否检索知识库中的内容
+// 管理员可以访问所有知识库，其他用户只能访问自己创建的知识库
+func authorizeKnowledgeBase(c *gin.Context, kbID uint) error {
+	return checkKnowledgeBaseAccess(c, db.GetDB(), kbID)
+}
+
+// authorizePersistentKnowledgeBase 与 authorizeKnowledgeBase 相同，但对话附件知识库视为不存在
+// 用于上传和管理知识库的接口，附件只能通过对话上传
+func authorizePersistentKnowledgeBase(c *gin.Context, kbID uint) error {
+	return checkKnowledgeBaseAccess(c, db.GetDB().Scopes(document.PersistentKnowledgeBases), kbID)
+}
+
+// checkKnowledgeBaseAccess 在 tx 的范围内查找知识库并检查当前用户是否为管理员或创建者
+func checkKnowledgeBaseAccess(c *gin.Context, tx *gorm.DB, kbID uint) error {
+	var kb models.KnowledgeBase
+	if err := tx.Select("id", "creator_id").First(&kb, kbID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errKnowledgeBaseNotFound
+		}
+		return fmt.Errorf("failed to get knowledge base: %w", err)
+	}
+
+	if c.GetString("role_name") != "admin" && kb.CreatorID != c.GetUint("user_id") {
+		return errKnowledgeBaseForbidden
+	}
+	return nil
+}
+
+// accessibleKnowledgeBases 查询范围：管理员可以看到所有知识库，其他用户只能看到自己创建的知识库
+func accessibleKnowledgeBases(c *gin.Context) func(tx *gorm.DB) *gorm.DB {
+	isAdmin := c.GetString("role_name") == "admin"
+	userID := c.GetUint("user_id")
+	return func(tx *gorm.DB) *gorm.DB {
+		if isAdmin {
+			return tx
+		}
+		return tx.Where("creator_id = ?", userID)
+	}
+}
+
+// knowledgeBaseAccessError 返回访问检查失败时响应的状态码和错误信息
+func knowledgeBaseAccessError(err error) (int, string) {
+	switch {
+	case errors.Is(err, errKnowledgeBaseNotFound):
+		return http.StatusNotFound, "Knowledge base not found"
+	case errors.Is(err, errKnowledgeBaseForbidden):
+		return http.StatusForbidden, "You don't have permission to access this knowledge base"
+	default:
+		return http.StatusInternalServerError, "Failed to get knowledge base"
+	}
+}
@@ -1,12 +1,21 @@
 package handlers
 
 import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"eino-rag/internal/config"
 	"eino-rag/internal/db"
 	"eino-rag/internal/models"
+	"eino-rag/internal/response"
+	"eino-rag/internal/services/document"
 	"eino-rag/internal/services/rag"
 	"gorm.io/gorm"
 	"github.com/gin-gonic/gin"
@@ -14,14 +23,18 @@ import (
 )
 
 type KnowledgeBaseHandler struct {
-	retriever *rag.MilvusRetriever
-	logger    *zap.Logger
+	retriever  *rag.MilvusRetriever
+	docService *document.Service
+	config     *config.Config
+	logger     *zap.Logger
 }
 
-func NewKnowledgeBaseHandler(retriever *rag.MilvusRetriever, logger *zap.Logger) *KnowledgeBaseHandler {
+func NewKnowledgeBaseHandler(retriever *rag.MilvusRetriever, docService *document.Service, cfg *config.Config, logger *zap.Logger) *KnowledgeBaseHandler {
 	return &KnowledgeBaseHandler{
-		retriever: retriever,
-		logger:    logger,
+		retriever:  retriever,
+		docService: docService,
+		config:     cfg,
+		logger:     logger,
 	}
 }
 
@@ -33,27 +46,58 @@ func NewKnowledgeBaseHandler(retriever *rag.MilvusRetriever, logger *zap.Logger)
 // @Produce json
 // @Security ApiKeyAuth
 // @Param request body CreateKBRequest true "创建请求"
-// @Success 200 {object} models.KnowledgeBase "创建成功"
+// @Success 200 {object} response.Envelope{data=KBCreateResponse} "创建成功，get_or_create 时可能返回已有的知识库"
 // @Failure 400 {object} ErrorResponse "请求错误"
 // @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 409 {object} KBConflictResponse "同名知识库已存在"
 // @Router /api/knowledge-bases [post]
 func (h *KnowledgeBaseHandler) Create(c *gin.Context) {
 	// 获取用户ID
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{
-			Success: false,
-			Message: "User not found in context",
-		})
+		response.Error(c, http.StatusUnauthorized, "User not found in context")
 		return
 	}
 
 	// 解析请求
 	var req CreateKBRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Success: false,
-			Message: "Invalid request data",
+		response.Error(c, http.StatusBadRequest, "Invalid request data")
+		return
+	}
+
+	database := db.GetDB()
+
+	// 同一用户下知识库名称唯一，便于脚本重复执行
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		response.Error(c, http.StatusBadRequest, "Name must not be empty")
+		return
+	}
+	if _, err := document.CompileBoilerplatePatterns(req.BoilerplatePatterns); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := document.ValidatePIICategories(req.PIIRedaction); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	existing, err := findKnowledgeBaseByName(userID.(uint), req.Name, 0)
+	if err != nil {
+		h.logger.Error("Failed to check knowledge base name", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to create knowledge base")
+		return
+	}
+	if existing != nil {
+		if req.GetOrCreate {
+			response.OK(c, KBCreateResponse{
+				KnowledgeBase: existing,
+				Created:       false,
+			})
+			return
+		}
+		response.ErrorWithData(c, http.StatusConflict, "Knowledge base with this name already exists", KBConflict{
+			ExistingID: existing.ID,
 		})
 		return
 	}
@@ -62,37 +106,76 @@ func (h *KnowledgeBaseHandler) Create(c *gin.Context) {
 	kb := &models.KnowledgeBase{
 		Name:        req.Name,
 		Description: req.Description,
+		DefaultTopK: req.DefaultTopK,
+		RecencyWeight:       req.RecencyWeight,
+		RecencyHalfLifeDays: req.RecencyHalfLifeDays,
+		StripBoilerplate:    req.StripBoilerplate,
+		BoilerplatePatterns: req.BoilerplatePatterns,
+		ContextualEmbedding: req.ContextualEmbedding,
+		PIIRedaction:        req.PIIRedaction,
+		RetentionDays:       req.RetentionDays,
+		RetentionAction:     req.RetentionAction,
 		CreatorID:   userID.(uint),
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
 
-	database := db.GetDB()
 	if err := database.Create(kb).Error; err != nil {
+		// 并发创建同名知识库时由唯一索引拒绝
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			h.nameConflict(c, kb.CreatorID, kb.Name, 0)
+			return
+		}
 		h.logger.Error("Failed to create knowledge base", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Success: false,
-			Message: "Failed to create knowledge base",
-		})
+		response.Error(c, http.StatusInternalServerError, "Failed to create knowledge base")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"knowledge_base": kb,
+	response.OK(c, KBCreateResponse{
+		KnowledgeBase: kb,
+		Created:       true,
 	})
 }
 
+// findKnowledgeBaseByName 查找创建者名下的同名知识库，excludeID 非0时跳过该知识库，不存在时返回nil
+// 软删除的知识库和对话附件知识库不参与比较，与唯一索引 idx_kb_creator_name_unique 的范围一致
+func findKnowledgeBaseByName(creatorID uint, name string, excludeID uint) (*models.KnowledgeBase, error) {
+	query := db.GetDB().Scopes(document.PersistentKnowledgeBases).Where("creator_id = ? AND name = ?", creatorID, name)
+	if excludeID != 0 {
+		query = query.Where("id <> ?", excludeID)
+	}
+	var kb models.KnowledgeBase
+	if err := query.First(&kb).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &kb, nil
+}
+
+// nameConflict 写入违反唯一索引时返回409，尽量附带已有知识库的ID
+func (h *KnowledgeBaseHandler) nameConflict(c *gin.Context, creatorID uint, name string, excludeID uint) {
+	var conflict KBConflict
+	existing, err := findKnowledgeBaseByName(creatorID, name, excludeID)
+	if err != nil {
+		h.logger.Warn("Failed to find conflicting knowledge base", zap.Error(err))
+	} else if existing != nil {
+		conflict.ExistingID = existing.ID
+	}
+	response.ErrorWithData(c, http.StatusConflict, "Knowledge base with this name already exists", conflict)
+}
+
 // List 获取知识库列表
 // @Summary 获取知识库列表
-// @Description 获取所有知识库列表
+// @Description 获取知识库列表，管理员返回所有知识库，其他用户只返回自己创建的知识库
 // @Tags 知识库
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
 // @Param page query int false "页码" default(1)
 // @Param page_size query int false "每页数量" default(10)
-// @Success 200 {object} KBListResponse "知识库列表"
+// @Success 200 {object} response.Envelope{data=KBListResponse} "知识库列表"
 // @Failure 401 {object} ErrorResponse "未授权"
 // @Router /api/knowledge-bases [get]
 func (h *KnowledgeBaseHandler) List(c *gin.Context) {
@@ -108,27 +191,23 @@ func (h *KnowledgeBaseHandler) List(c *gin.Context) {
 	}
 
 	database := db.GetDB()
+	// 只列出当前用户可以访问的知识库，与检索和对话的访问规则一致
+	visible := accessibleKnowledgeBases(c)
 	
 	// 计算总数
 	var total int64
-	if err := database.Model(&models.KnowledgeBase{}).Count(&total).Error; err != nil {
+	if err := database.Model(&models.KnowledgeBase{}).Scopes(document.PersistentKnowledgeBases, visible).Count(&total).Error; err != nil {
 		h.logger.Error("Failed to count knowledge bases", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Success: false,
-			Message: "Failed to get knowledge bases",
-		})
+		response.Error(c, http.StatusInternalServerError, "Failed to get knowledge bases")
 		return
 	}
 
 	// 分页查询
 	var kbs []models.KnowledgeBase
 	offset := (page - 1) * pageSize
-	if err := database.Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&kbs).Error; err != nil {
+	if err := database.Scopes(document.PersistentKnowledgeBases, visible).Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&kbs).Error; err != nil {
 		h.logger.Error("Failed to get knowledge bases", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Success: false,
-			Message: "Failed to get knowledge bases",
-		})
+		response.Error(c, http.StatusInternalServerError, "Failed to get knowledge bases")
 		return
 	}
 
@@ -140,14 +219,22 @@ func (h *KnowledgeBaseHandler) List(c *gin.Context) {
 			Name:        kb.Name,
 			Description: kb.Description,
 			DocCount:    kb.DocCount,
+			DefaultTopK: kb.DefaultTopK,
+			RecencyWeight:       kb.RecencyWeight,
+			RecencyHalfLifeDays: kb.RecencyHalfLifeDays,
+			StripBoilerplate:    kb.StripBoilerplate,
+			BoilerplatePatterns: kb.BoilerplatePatterns,
+			ContextualEmbedding: kb.ContextualEmbedding,
+			PIIRedaction:        kb.PIIRedaction,
+			RetentionDays:       kb.RetentionDays,
+			RetentionAction:     string(kb.RetentionAction),
 			CreatorID:   kb.CreatorID,
 			CreatedAt:   kb.CreatedAt,
 			UpdatedAt:   kb.UpdatedAt,
 		}
 	}
 
-	c.JSON(http.StatusOK, KBListResponse{
-		Success:        true,
+	response.OK(c, KBListResponse{
 		KnowledgeBases: kbWithDocs,
 		Total:          total,
 		Page:           page,
@@ -157,31 +244,39 @@ func (h *KnowledgeBaseHandler) List(c *gin.Context) {
 
 // Get 获取知识库详情
 // @Summary 获取知识库详情
-// @Description 获取指定知识库的详细信息
+// @Description 获取指定知识库的详细信息（仅管理员或知识库创建者）
 // @Tags 知识库
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
 // @Param id path int true "知识库ID"
-// @Success 200 {object} models.KnowledgeBase "知识库详情"
+// @Success 200 {object} response.Envelope{data=KBResponse} "知识库详情"
 // @Failure 400 {object} ErrorResponse "请求错误"
+// @Failure 403 {object} ErrorResponse "无权访问该知识库"
 // @Failure 404 {object} ErrorResponse "知识库不存在"
 // @Router /api/knowledge-bases/{id} [get]
 func (h *KnowledgeBaseHandler) Get(c *gin.Context) {
 	// 获取知识库ID
 	kbID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Success: false,
-			Message: "Invalid knowledge base ID",
-		})
+		response.Error(c, http.StatusBadRequest, "Invalid knowledge base ID")
+		return
+	}
+
+	// 仅管理员或创建者可以查看；对话附件知识库只在所属对话中使用，不能作为知识库查看
+	if err := authorizePersistentKnowledgeBase(c, uint(kbID)); err != nil {
+		status, message := knowledgeBaseAccessError(err)
+		if status == http.StatusInternalServerError {
+			h.logger.Error("Failed to check knowledge base access", zap.Error(err))
+		}
+		response.Error(c, status, message)
 		return
 	}
 
 	database := db.GetDB()
 	
 	var kb models.KnowledgeBase
-	if err := database.First(&kb, kbID).Error; err != nil {
+	if err := database.Scopes(document.PersistentKnowledgeBases).First(&kb, kbID).Error; err != nil {
 		h.logger.Error("Failed to get knowledge base", zap.Error(err))
 		
 		status := http.StatusInternalServerError
@@ -192,50 +287,52 @@ func (h *KnowledgeBaseHandler) Get(c *gin.Context) {
 			message = "Knowledge base not found"
 		}
 		
-		c.JSON(status, ErrorResponse{
-			Success: false,
-			Message: message,
-		})
+		response.Error(c, status, message)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"knowledge_base": kb,
+	response.OK(c, KBResponse{
+		KnowledgeBase: &kb,
 	})
 }
 
 // Update 更新知识库
 // @Summary 更新知识库
-// @Description 更新知识库信息
+// @Description 更新知识库信息（仅管理员或知识库创建者）
 // @Tags 知识库
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
 // @Param id path int true "知识库ID"
 // @Param request body UpdateKBRequest true "更新请求"
-// @Success 200 {object} SuccessResponse "更新成功"
+// @Success 200 {object} response.Envelope{data=SuccessResponse} "更新成功"
 // @Failure 400 {object} ErrorResponse "请求错误"
+// @Failure 403 {object} ErrorResponse "权限不足"
 // @Failure 404 {object} ErrorResponse "知识库不存在"
+// @Failure 409 {object} KBConflictResponse "创建者名下已有同名知识库"
 // @Router /api/knowledge-bases/{id} [put]
 func (h *KnowledgeBaseHandler) Update(c *gin.Context) {
 	// 获取知识库ID
 	kbID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Success: false,
-			Message: "Invalid knowledge base ID",
-		})
+		response.Error(c, http.StatusBadRequest, "Invalid knowledge base ID")
 		return
 	}
 
 	// 解析请求
 	var req UpdateKBRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Success: false,
-			Message: "Invalid request data",
-		})
+		response.Error(c, http.StatusBadRequest, "Invalid request data")
+		return
+	}
+
+	// 只有管理员或创建者可以修改，保留期限等设置会触发后台删除文档
+	if err := authorizePersistentKnowledgeBase(c, uint(kbID)); err != nil {
+		status, message := knowledgeBaseAccessError(err)
+		if status == http.StatusInternalServerError {
+			h.logger.Error("Failed to check knowledge base access", zap.Error(err))
+		}
+		response.Error(c, status, message)
 		return
 	}
 
@@ -243,115 +340,556 @@ func (h *KnowledgeBaseHandler) Update(c *gin.Context) {
 	
 	// 构建更新字段
 	updates := make(map[string]interface{})
+	var kb models.KnowledgeBase
 	if req.Name != "" {
+		// 与创建时相同，改名后在创建者名下必须唯一
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			response.Error(c, http.StatusBadRequest, "Name must not be empty")
+			return
+		}
+		if err := database.Select("id", "creator_id").First(&kb, kbID).Error; err != nil {
+			h.logger.Error("Failed to get knowledge base", zap.Error(err))
+			response.Error(c, http.StatusInternalServerError, "Failed to update knowledge base")
+			return
+		}
+		existing, err := findKnowledgeBaseByName(kb.CreatorID, req.Name, kb.ID)
+		if err != nil {
+			h.logger.Error("Failed to check knowledge base name", zap.Error(err))
+			response.Error(c, http.StatusInternalServerError, "Failed to update knowledge base")
+			return
+		}
+		if existing != nil {
+			response.ErrorWithData(c, http.StatusConflict, "Knowledge base with this name already exists", KBConflict{
+				ExistingID: existing.ID,
+			})
+			return
+		}
 		updates["name"] = req.Name
 	}
 	if req.Description != "" {
 		updates["description"] = req.Description
 	}
+	if req.DefaultTopK != nil {
+		updates["default_top_k"] = *req.DefaultTopK
+	}
+	if req.RecencyWeight != nil {
+		updates["recency_weight"] = *req.RecencyWeight
+	}
+	if req.RecencyHalfLifeDays != nil {
+		updates["recency_half_life_days"] = *req.RecencyHalfLifeDays
+	}
+	if req.StripBoilerplate != nil {
+		updates["strip_boilerplate"] = *req.StripBoilerplate
+	}
+	if req.ContextualEmbedding != nil {
+		updates["contextual_embedding"] = *req.ContextualEmbedding
+	}
+	if req.RetentionDays != nil {
+		updates["retention_days"] = *req.RetentionDays
+	}
+	if req.RetentionAction != nil {
+		updates["retention_action"] = *req.RetentionAction
+	}
+	if req.BoilerplatePatterns != nil {
+		if _, err := document.CompileBoilerplatePatterns(*req.BoilerplatePatterns); err != nil {
+			response.Error(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		// 按字段更新不会经过序列化器，需要自行编码
+		patterns, err := json.Marshal(*req.BoilerplatePatterns)
+		if err != nil {
+			response.Error(c, http.StatusBadRequest, "Invalid boilerplate patterns")
+			return
+		}
+		updates["boilerplate_patterns"] = string(patterns)
+	}
+	if req.PIIRedaction != nil {
+		if err := document.ValidatePIICategories(*req.PIIRedaction); err != nil {
+			response.Error(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		categories, err := json.Marshal(*req.PIIRedaction)
+		if err != nil {
+			response.Error(c, http.StatusBadRequest, "Invalid PII categories")
+			return
+		}
+		updates["pii_redaction"] = string(categories)
+	}
 	updates["updated_at"] = time.Now()
 
 	// 执行更新
-	result := database.Model(&models.KnowledgeBase{}).Where("id = ?", kbID).Updates(updates)
+	result := database.Model(&models.KnowledgeBase{}).Scopes(document.PersistentKnowledgeBases).Where("id = ?", kbID).Updates(updates)
+	if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+		h.nameConflict(c, kb.CreatorID, req.Name, kb.ID)
+		return
+	}
 	if result.Error != nil {
 		h.logger.Error("Failed to update knowledge base", zap.Error(result.Error))
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Success: false,
-			Message: "Failed to update knowledge base",
-		})
+		response.Error(c, http.StatusInternalServerError, "Failed to update knowledge base")
 		return
 	}
 
 	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, ErrorResponse{
-			Success: false,
-			Message: "Knowledge base not found",
-		})
+		response.Error(c, http.StatusNotFound, "Knowledge base not found")
 		return
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse{
-		Success: true,
+	response.OK(c, SuccessResponse{
 		Message: "Knowledge base updated successfully",
 	})
 }
 
 // Delete 删除知识库
 // @Summary 删除知识库
-// @Description 删除知识库及其所有文档
+// @Description 软删除知识库：知识库不再出现在列表中，文档不参与检索，向量保留；宽限期内可以恢复，之后永久删除（仅管理员或知识库创建者）
 // @Tags 知识库
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
 // @Param id path int true "知识库ID"
-// @Success 200 {object} SuccessResponse "删除成功"
+// @Success 200 {object} response.Envelope{data=KBDeleteResponse} "删除成功"
 // @Failure 400 {object} ErrorResponse "请求错误"
+// @Failure 403 {object} ErrorResponse "权限不足"
 // @Failure 404 {object} ErrorResponse "知识库不存在"
 // @Router /api/knowledge-bases/{id} [delete]
 func (h *KnowledgeBaseHandler) Delete(c *gin.Context) {
 	// 获取知识库ID
 	kbID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Success: false,
-			Message: "Invalid knowledge base ID",
-		})
+		response.Error(c, http.StatusBadRequest, "Invalid knowledge base ID")
 		return
 	}
 
-	database := db.GetDB()
-	
-	// 开始事务
-	err = database.Transaction(func(tx *gorm.DB) error {
-		// 检查知识库是否存在
-		var kb models.KnowledgeBase
-		if err := tx.First(&kb, kbID).Error; err != nil {
-			return err
+	// 只有管理员或创建者可以删除，与恢复相同；对话附件随对话删除，不能作为知识库删除
+	if err := authorizePersistentKnowledgeBase(c, uint(kbID)); err != nil {
+		status, message := knowledgeBaseAccessError(err)
+		if status == http.StatusInternalServerError {
+			h.logger.Error("Failed to check knowledge base access", zap.Error(err))
 		}
+		response.Error(c, status, message)
+		return
+	}
 
-		// 删除向量数据库中的文档
-		if h.retriever != nil {
-			if err := h.retriever.DeleteByKnowledgeBase(c.Request.Context(), uint(kbID)); err != nil {
-				h.logger.Error("Failed to delete vectors", zap.Error(err))
-				// 继续删除，不中断流程
-			}
-		} else {
-			h.logger.Warn("Vector deletion skipped - retriever not available", zap.Uint64("kb_id", kbID))
+	kb, err := h.docService.SoftDeleteKnowledgeBase(c.Request.Context(), uint(kbID))
+	if err != nil {
+		h.logger.Error("Failed to delete knowledge base", zap.Error(err))
+		
+		status := http.StatusInternalServerError
+		message := "Failed to delete knowledge base"
+		
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+			message = "Knowledge base not found"
 		}
+		
+		response.Error(c, status, message)
+		return
+	}
+	recordAudit(c, h.logger, "kb_delete", "knowledge_base", kb.ID, kb.Name)
 
-		// 删除所有文档记录
-		if err := tx.Where("knowledge_base_id = ?", kbID).Delete(&models.Document{}).Error; err != nil {
-			return err
-		}
+	resp := KBDeleteResponse{Message: "Knowledge base deleted successfully"}
+	if grace := h.config.Snapshot().KBDeleteGracePeriod; grace > 0 {
+		purgeAfter := kb.DeletedAt.Time.Add(grace)
+		resp.PurgeAfter = &purgeAfter
+	}
+	response.OK(c, resp)
+}
+
+// Restore 恢复已删除的知识库
+// @Summary 恢复知识库
+// @Description 恢复宽限期内软删除的知识库及其文档，doc_count 按已索引的文档重新统计（仅管理员或知识库创建者）
+// @Tags 知识库
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "知识库ID"
+// @Success 200 {object} response.Envelope{data=KBResponse} "恢复后的知识库"
+// @Failure 400 {object} ErrorResponse "请求错误"
+// @Failure 403 {object} ErrorResponse "权限不足"
+// @Failure 404 {object} ErrorResponse "知识库不存在或没有被删除"
+// @Failure 409 {object} ErrorResponse "已有同名知识库"
+// @Router /api/knowledge-bases/{id}/restore [post]
+func (h *KnowledgeBaseHandler) Restore(c *gin.Context) {
+	kbID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid knowledge base ID")
+		return
+	}
 
-		// 删除知识库
-		if err := tx.Delete(&kb).Error; err != nil {
-			return err
+	var deleted models.KnowledgeBase
+	if err := db.GetDB().Unscoped().Select("id", "creator_id").
+		Where("deleted_at IS NOT NULL").First(&deleted, kbID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Error(c, http.StatusNotFound, document.ErrKnowledgeBaseNotDeleted.Error())
+			return
 		}
+		h.logger.Error("Failed to get knowledge base", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to restore knowledge base")
+		return
+	}
+	if c.GetString("role_name") != "admin" && deleted.CreatorID != c.GetUint("user_id") {
+		response.Error(c, http.StatusForbidden, "You don't have permission to access this knowledge base")
+		return
+	}
+
+	kb, err := h.docService.RestoreKnowledgeBase(c.Request.Context(), uint(kbID))
+	switch {
+	case errors.Is(err, document.ErrKnowledgeBaseNotDeleted):
+		response.Error(c, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, document.ErrKnowledgeBaseNameTaken):
+		response.Error(c, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		h.logger.Error("Failed to restore knowledge base", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to restore knowledge base")
+		return
+	}
+	recordAudit(c, h.logger, "kb_restore", "knowledge_base", kb.ID, kb.Name)
 
-		return nil
+	response.OK(c, KBResponse{
+		KnowledgeBase: kb,
 	})
+}
 
+// HardDelete 永久删除知识库
+// @Summary 永久删除知识库
+// @Description 永久删除知识库（包括已软删除的）及其所有文档和向量，不能恢复；confirm 必须与知识库名称一致（管理员接口）
+// @Tags 知识库
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "知识库ID"
+// @Param request body HardDeleteKBRequest true "确认信息"
+// @Success 200 {object} response.Envelope{data=SuccessResponse} "删除成功"
+// @Failure 400 {object} ErrorResponse "请求错误或确认名称不一致"
+// @Failure 403 {object} ErrorResponse "权限不足"
+// @Failure 404 {object} ErrorResponse "知识库不存在"
+// @Router /api/knowledge-bases/{id}/hard-delete [post]
+func (h *KnowledgeBaseHandler) HardDelete(c *gin.Context) {
+	kbID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		h.logger.Error("Failed to delete knowledge base", zap.Error(err))
-		
+		response.Error(c, http.StatusBadRequest, "Invalid knowledge base ID")
+		return
+	}
+
+	var req HardDeleteKBRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var kb models.KnowledgeBase
+	if err := db.GetDB().Unscoped().Select("id", "name").First(&kb, kbID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Error(c, http.StatusNotFound, "Knowledge base not found")
+			return
+		}
+		h.logger.Error("Failed to get knowledge base", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to delete knowledge base")
+		return
+	}
+	if req.Confirm != kb.Name {
+		response.Error(c, http.StatusBadRequest, "Confirmation does not match the knowledge base name")
+		return
+	}
+
+	if err := h.docService.PurgeKnowledgeBase(c.Request.Context(), kb.ID); err != nil {
+		h.logger.Error("Failed to permanently delete knowledge base", zap.Error(err))
 		status := http.StatusInternalServerError
 		message := "Failed to delete knowledge base"
-		
-		if err.Error() == "record not found" {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
 			status = http.StatusNotFound
 			message = "Knowledge base not found"
 		}
-		
-		c.JSON(status, ErrorResponse{
-			Success: false,
-			Message: message,
-		})
+		response.Error(c, status, message)
 		return
 	}
+	recordAudit(c, h.logger, "kb_hard_delete", "knowledge_base", kb.ID, kb.Name)
 
-	c.JSON(http.StatusOK, SuccessResponse{
-		Success: true,
-		Message: "Knowledge base deleted successfully",
+	response.OK(c, SuccessResponse{
+		Message: "Knowledge base permanently deleted",
 	})
-}
\ No newline at end of file
+}
+
+// Evaluate 评估知识库检索质量
+// @Summary 评估检索质量
+// @Description 对一组带标注的查询执行检索，返回 recall@k、precision@k、MRR 汇总及逐条结果（仅管理员或知识库创建者）
+// @Tags 知识库
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "知识库ID"
+// @Param request body EvaluateRequest true "评估用例"
+// @Success 200 {object} response.Envelope{data=EvaluateResponse} "评估结果"
+// @Failure 400 {object} ErrorResponse "请求错误"
+// @Failure 403 {object} ErrorResponse "权限不足"
+// @Failure 404 {object} ErrorResponse "知识库不存在"
+// @Failure 503 {object} ErrorResponse "向量数据库不可用"
+// @Router /api/knowledge-bases/{id}/evaluate [post]
+func (h *KnowledgeBaseHandler) Evaluate(c *gin.Context) {
+	// 获取知识库ID
+	kbID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid knowledge base ID")
+		return
+	}
+
+	var req EvaluateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request data")
+		return
+	}
+
+	// 检查知识库是否存在
+	var kb models.KnowledgeBase
+	if err := db.GetDB().First(&kb, kbID).Error; err != nil {
+		status := http.StatusInternalServerError
+		message := "Failed to get knowledge base"
+		if err == gorm.ErrRecordNotFound {
+			status = http.StatusNotFound
+			message = "Knowledge base not found"
+		}
+		response.Error(c, status, message)
+		return
+	}
+
+	// 仅管理员或知识库创建者可以评估
+	userID, _ := c.Get("user_id")
+	roleName, _ := c.Get("role_name")
+	if roleName != "admin" && kb.CreatorID != userID.(uint) {
+		response.Error(c, http.StatusForbidden, "You don't have permission to evaluate this knowledge base")
+		return
+	}
+
+	if h.retriever == nil {
+		response.Error(c, http.StatusServiceUnavailable, "Vector database is not available")
+		return
+	}
+
+	cases := make([]rag.EvalCase, len(req.Cases))
+	for i, item := range req.Cases {
+		cases[i] = rag.EvalCase{
+			Query:          item.Query,
+			ExpectedDocIDs: item.ExpectedDocIDs,
+		}
+	}
+
+	// 未指定 top_k 时按知识库的默认值评估，与实际检索保持一致
+	topK := req.TopK
+	if topK <= 0 {
+		topK = kb.DefaultTopK
+	}
+	report := h.retriever.Evaluate(c.Request.Context(), kb.ID, cases, topK)
+
+	h.logger.Info("Knowledge base evaluated",
+		zap.Uint("kb_id", kb.ID),
+		zap.Int("queries", report.QueryCount),
+		zap.Int("failed", report.FailedCount),
+		zap.Float64("recall", report.Recall),
+		zap.Float64("mrr", report.MRR))
+
+	response.OK(c, EvaluateResponse{
+		Report: report,
+	})
+}
+
+// exportBatchSize 导出时每批读取的文档数，控制内存占用
+const exportBatchSize = 50
+
+// ExportDocuments 导出知识库文档
+// @Summary 导出知识库文档
+// @Description 以zip流式导出知识库中所有文档保存的解析文本，并附带 manifest.json 元数据；系统未保存原始文件，导出内容为解析后的文本
+// @Tags 知识库
+// @Produce application/zip
+// @Security ApiKeyAuth
+// @Param id path int true "知识库ID"
+// @Success 200 {file} file "zip压缩包"
+// @Failure 400 {object} ErrorResponse "请求错误"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "权限不足"
+// @Failure 404 {object} ErrorResponse "知识库不存在"
+// @Router /api/knowledge-bases/{id}/documents/export [get]
+func (h *KnowledgeBaseHandler) ExportDocuments(c *gin.Context) {
+	kbID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid knowledge base ID")
+		return
+	}
+
+	database := db.GetDB()
+	var kb models.KnowledgeBase
+	if err := database.First(&kb, kbID).Error; err != nil {
+		status := http.StatusInternalServerError
+		message := "Failed to get knowledge base"
+		if err == gorm.ErrRecordNotFound {
+			status = http.StatusNotFound
+			message = "Knowledge base not found"
+		}
+		response.Error(c, status, message)
+		return
+	}
+
+	// 仅管理员或知识库创建者可以导出
+	userID := c.GetUint("user_id")
+	if c.GetString("role_name") != "admin" && kb.CreatorID != userID {
+		response.Error(c, http.StatusForbidden, "You don't have permission to export this knowledge base")
+		return
+	}
+
+	recordAudit(c, h.logger, "kb_export", "knowledge_base", kb.ID, kb.Name)
+
+	filename := fmt.Sprintf("kb_%d_documents_%s.zip", kb.ID, time.Now().Format("20060102150405"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	manifest := ExportManifest{
+		KnowledgeBaseID:   kb.ID,
+		KnowledgeBaseName: kb.Name,
+		Description:       kb.Description,
+		ExportedAt:        time.Now(),
+		ExportedBy:        userID,
+		ContentFormat:     "parsed_text",
+		Documents:         []ExportManifestEntry{},
+	}
+
+	// 响应头已发送，之后出错只能中断输出并记录日志
+	archive := zip.NewWriter(c.Writer)
+	var batch []models.Document
+	err = database.Where("knowledge_base_id = ?", kb.ID).Order("id ASC").
+		FindInBatches(&batch, exportBatchSize, func(tx *gorm.DB, _ int) error {
+			ids := make([]uint, len(batch))
+			for i, doc := range batch {
+				ids[i] = doc.ID
+			}
+			var texts []models.DocumentText
+			if err := database.Where("document_id IN ?", ids).Find(&texts).Error; err != nil {
+				return err
+			}
+			contents := make(map[uint]string, len(texts))
+			for _, text := range texts {
+				contents[text.DocumentID] = text.Content
+			}
+
+			for _, doc := range batch {
+				entry := ExportManifestEntry{
+					ID:        doc.ID,
+					FileName:  doc.FileName,
+					FileType:  doc.FileType,
+					FileSize:  doc.FileSize,
+					Hash:      doc.Hash,
+					Status:    string(doc.Status),
+					Summary:   doc.Summary,
+					CreatorID: doc.CreatorID,
+					CreatedAt: doc.CreatedAt,
+				}
+				if content, ok := contents[doc.ID]; ok {
+					entry.ContentFile = exportFileName(doc)
+					w, err := archive.Create(entry.ContentFile)
+					if err != nil {
+						return err
+					}
+					if _, err := io.WriteString(w, content); err != nil {
+						return err
+					}
+				}
+				manifest.Documents = append(manifest.Documents, entry)
+			}
+			c.Writer.Flush()
+			return nil
+		}).Error
+	if err == nil {
+		var w io.Writer
+		if w, err = archive.Create("manifest.json"); err == nil {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(manifest)
+		}
+	}
+	if closeErr := archive.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		h.logger.Error("Failed to export knowledge base documents",
+			zap.Uint("kb_id", kb.ID),
+			zap.Error(err))
+		return
+	}
+
+	h.logger.Info("Knowledge base documents exported",
+		zap.Uint("kb_id", kb.ID),
+		zap.Uint("user_id", userID),
+		zap.Int("documents", len(manifest.Documents)))
+}
+
+// exportFileName 文档在导出压缩包中的路径，使用ID前缀避免重名
+func exportFileName(doc models.Document) string {
+	name := strings.NewReplacer("/", "_", "\\", "_").Replace(doc.FileName)
+	return fmt.Sprintf("documents/%d_%s.txt", doc.ID, name)
+}
+
+// PreviewPIIRedaction 预览个人信息清理效果
+// @Summary 预览个人信息清理
+// @Description 按知识库的 pii_redaction 设置（或请求中指定的类别）清理一段文本并返回结果、各类别替换次数和被替换的原文（最多100条），不保存任何内容（仅管理员或知识库创建者）
+// @Tags 知识库
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "知识库ID"
+// @Param request body PIIPreviewRequest true "预览文本"
+// @Success 200 {object} response.Envelope{data=PIIPreviewResponse} "清理结果"
+// @Failure 400 {object} ErrorResponse "请求错误"
+// @Failure 403 {object} ErrorResponse "权限不足"
+// @Failure 404 {object} ErrorResponse "知识库不存在"
+// @Router /api/knowledge-bases/{id}/pii-preview [post]
+func (h *KnowledgeBaseHandler) PreviewPIIRedaction(c *gin.Context) {
+	kbID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid knowledge base ID")
+		return
+	}
+
+	var req PIIPreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request data")
+		return
+	}
+
+	var kb models.KnowledgeBase
+	if err := db.GetDB().First(&kb, kbID).Error; err != nil {
+		status := http.StatusInternalServerError
+		message := "Failed to get knowledge base"
+		if err == gorm.ErrRecordNotFound {
+			status = http.StatusNotFound
+			message = "Knowledge base not found"
+		}
+		response.Error(c, status, message)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	roleName, _ := c.Get("role_name")
+	if roleName != "admin" && kb.CreatorID != userID.(uint) {
+		response.Error(c, http.StatusForbidden, "You don't have permission to access this knowledge base")
+		return
+	}
+
+	categories := kb.PIIRedaction
+	if req.Categories != nil {
+		if err := document.ValidatePIICategories(req.Categories); err != nil {
+			response.Error(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		categories = req.Categories
+	}
+
+	result := document.RedactPII(req.Text, categories)
+	response.OK(c, PIIPreviewResponse{
+		Text:       result.Text,
+		Categories: categories,
+		Redactions: result.Counts,
+		Matches:    result.Matches,
+	})
+}
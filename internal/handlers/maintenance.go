@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/response"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// maintenanceResponse 把维护状态转换为接口响应
+func maintenanceResponse(state db.MaintenanceState) MaintenanceResponse {
+	resp := MaintenanceResponse{
+		Enabled:   state.Enabled,
+		Reason:    state.Reason,
+		StartedBy: state.StartedBy,
+	}
+	if !state.StartedAt.IsZero() {
+		resp.StartedAt = state.StartedAt.Unix()
+	}
+	return resp
+}
+
+// GetMaintenance 获取维护模式状态
+// @Summary 获取维护模式状态
+// @Description 返回维护模式是否开启以及开启原因、开启人和开启时间（需要管理员权限）
+// @Tags 系统
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Envelope{data=MaintenanceResponse} "维护模式状态"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "权限不足"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Router /api/system/maintenance [get]
+func (h *SystemHandler) GetMaintenance(c *gin.Context) {
+	state, err := db.GetMaintenance(c.Request.Context())
+	if err != nil {
+		h.logger.Error("Failed to get maintenance state", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to get maintenance state")
+		return
+	}
+	response.OK(c, maintenanceResponse(state))
+}
+
+// SetMaintenance 开启或关闭维护模式
+// @Summary 开启或关闭维护模式
+// @Description 维护模式下上传、删除文档和修改知识库、系统配置等写接口返回503，检索和对话不受影响，用于批量重建索引或迁移数据。维护模式保持到管理员关闭，多副本部署时同时生效（需要管理员权限）
+// @Tags 系统
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body MaintenanceRequest true "维护模式设置"
+// @Success 200 {object} response.Envelope{data=MaintenanceResponse} "维护模式状态"
+// @Failure 400 {object} ErrorResponse "请求参数错误"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "权限不足"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Router /api/system/maintenance [put]
+func (h *SystemHandler) SetMaintenance(c *gin.Context) {
+	var req MaintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	state := db.MaintenanceState{Enabled: *req.Enabled}
+	if state.Enabled {
+		state.Reason = req.Reason
+		state.StartedBy = c.GetUint("user_id")
+		state.StartedAt = time.Now()
+	}
+	if err := db.SetMaintenance(c.Request.Context(), state); err != nil {
+		h.logger.Error("Failed to set maintenance state", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to set maintenance state")
+		return
+	}
+
+	action := "maintenance_disable"
+	if state.Enabled {
+		action = "maintenance_enable"
+	}
+	recordAudit(c, h.logger, action, "system", 0, fmt.Sprintf("reason=%q", state.Reason))
+	h.logger.Info("Maintenance mode changed",
+		zap.Bool("enabled", state.Enabled),
+		zap.String("reason", state.Reason),
+		zap.Uint("user_id", c.GetUint("user_id")))
+
+	response.OK(c, maintenanceResponse(state))
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"eino-rag/internal/response"
+	"eino-rag/internal/services/document"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type RetentionHandler struct {
+	sweeper *document.RetentionSweeper
+	logger  *zap.Logger
+}
+
+func NewRetentionHandler(sweeper *document.RetentionSweeper, logger *zap.Logger) *RetentionHandler {
+	return &RetentionHandler{
+		sweeper: sweeper,
+		logger:  logger,
+	}
+}
+
+// GetReport 获取知识库文档保留期限的清理报告
+// @Summary 获取保留期限清理报告
+// @Description 返回最近一次按知识库 retention_days 清理文档的结果：每个有过期文档的知识库的处理方式（delete/archive）、截止时间、已处理和处理失败的文档ID（需要管理员权限）。refresh=true 或还没有报告时立即执行一次清理
+// @Tags 系统
+// @Produce json
+// @Security ApiKeyAuth
+// @Param refresh query bool false "立即执行清理"
+// @Success 200 {object} response.Envelope{data=document.RetentionReport} "清理报告"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "权限不足"
+// @Failure 409 {object} ErrorResponse "清理正在执行"
+// @Failure 500 {object} ErrorResponse "清理失败"
+// @Router /api/system/retention [get]
+func (h *RetentionHandler) GetReport(c *gin.Context) {
+	if c.Query("refresh") != "true" {
+		if report := h.sweeper.LastReport(c.Request.Context()); report != nil {
+			response.OK(c, report)
+			return
+		}
+	}
+
+	report, err := h.sweeper.Run(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, document.ErrRetentionSweepRunning) {
+			response.Error(c, http.StatusConflict, err.Error())
+			return
+		}
+		h.logger.Error("Retention sweep failed", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to apply retention")
+		return
+	}
+	response.OK(c, report)
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/jobs"
+	"eino-rag/internal/services/chat"
+	"eino-rag/internal/services/rag"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// SSE事件类型
+const (
+	SSEEventStart   = "start"
+	SSEEventContext = "context"
+	SSEEventContent = "content"
+	SSEEventEnd     = "end"
+	SSEEventError   = "error"
+
+	// 后台任务进度流
+	SSEEventProgress = "progress"
+
+	// 流式上传的处理阶段
+	SSEEventParse = "parse"
+	SSEEventChunk = "chunk"
+	SSEEventEmbed = "embed"
+)
+
+// SSEPayload SSE事件的数据部分，EventType 决定外层的 type 字段
+type SSEPayload interface {
+	EventType() string
+}
+
+// StartEvent 流开始事件，未指定对话ID时包含新分配的ID
+type StartEvent struct {
+	ConversationID string `json:"conversation_id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Message        string `json:"message" example:"Starting chat"`
+}
+
+// ContextEvent 检索到的文档上下文事件
+// 向量库不可用时同样发送，Documents 为空或只有降级检索的结果，RetrievalUnavailable 为true
+type ContextEvent struct {
+	Documents            []DocResult `json:"documents"`
+	RetrievalUnavailable bool        `json:"retrieval_unavailable,omitempty"`
+}
+
+// ContentEvent 增量文本事件
+type ContentEvent struct {
+	Content string `json:"content" example:"人工智能"`
+}
+
+// EndEvent 流正常结束事件
+type EndEvent struct {
+	ConversationID string                 `json:"conversation_id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Message        string                 `json:"message" example:"Completed"`
+	SemanticCache  *chat.SemanticCacheHit `json:"semantic_cache,omitempty"` // 回复来自语义缓存时不为nil
+	// 开启回答核对时的核对结果，有无依据的论断时提示已作为最后一个 content 事件发送
+	Verification *chat.AnswerVerification `json:"verification,omitempty"`
+	// 启用了RAG但向量库不可用，回复没有经过知识库检索
+	RetrievalUnavailable bool  `json:"retrieval_unavailable,omitempty"`
+	Timestamp            int64 `json:"timestamp" example:"1640995200"`
+}
+
+// ErrorEvent 错误事件
+// 回复中途中断时 Code 为 stream_interrupted，并带上对话ID，此前的 content 事件仍有效
+// 模型生成超时时 Code 为 timeout，对话数已达上限时 Code 为 conversation_limit
+type ErrorEvent struct {
+	Message        string `json:"message" example:"Failed to process chat request"`
+	Code           string `json:"code,omitempty" example:"too_many_streams"`
+	ConversationID string `json:"conversation_id,omitempty" example:"550e8400-e29b-41d4-a716-446655440000"`
+}
+
+// JobProgressEvent 后台任务进度事件，携带任务的完整状态
+type JobProgressEvent struct {
+	jobs.Job
+}
+
+// JobEndEvent 后台任务成功结束事件，携带任务的最终状态和结果
+type JobEndEvent struct {
+	jobs.Job
+}
+
+// UploadProgressEvent 流式上传的进度事件，Stage 即事件类型
+//   - parse: 文档解析完成并已创建文档记录，DocumentID 为文档ID
+//   - chunk: 切分完成，Total 为分块数
+//   - embed: 每向量化 10 个分块及全部完成时发送，Processed 为已完成的分块数
+type UploadProgressEvent struct {
+	Stage      string `json:"stage" enums:"parse,chunk,embed" example:"embed"`
+	DocumentID uint   `json:"document_id,omitempty" example:"123"`
+	Processed  int    `json:"processed" example:"20"`
+	Total      int    `json:"total" example:"120"`
+}
+
+// UploadEndEvent 流式上传成功结束事件，携带与普通上传相同的结果
+type UploadEndEvent struct {
+	UploadResponse
+}
+
+func (e UploadProgressEvent) EventType() string { return e.Stage }
+func (UploadEndEvent) EventType() string        { return SSEEventEnd }
+
+func (JobProgressEvent) EventType() string { return SSEEventProgress }
+func (JobEndEvent) EventType() string      { return SSEEventEnd }
+
+func (StartEvent) EventType() string   { return SSEEventStart }
+func (ContextEvent) EventType() string { return SSEEventContext }
+func (ContentEvent) EventType() string { return SSEEventContent }
+func (EndEvent) EventType() string     { return SSEEventEnd }
+func (ErrorEvent) EventType() string   { return SSEEventError }
+
+// WriteSSEEvent 将事件按 `data: {"type":...,"data":...}` 格式写入
+func WriteSSEEvent(w io.Writer, payload SSEPayload) error {
+	jsonData, err := json.Marshal(SSEEvent{
+		Type: payload.EventType(),
+		Data: payload,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal SSE data: %w", err)
+	}
+
+	_, err = fmt.Fprintf(w, "data: %s\n\n", jsonData)
+	return err
+}
+
+// toDocResults 转换检索结果为响应格式，元数据只保留 RESPONSE_METADATA_KEYS 中的键
+func toDocResults(docs []*schema.Document) []DocResult {
+	allowed := config.Get().Snapshot().ResponseMetadataKeys
+	results := make([]DocResult, 0, len(docs))
+	for _, doc := range docs {
+		score := 0.0
+		if v, ok := doc.MetaData["score"].(float64); ok {
+			score = v
+		}
+
+		results = append(results, DocResult{
+			ID:       doc.ID,
+			Content:  doc.Content,
+			Score:    score,
+			Metadata: rag.FilterMetadata(doc.MetaData, allowed),
+		})
+	}
+	return results
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import "sync"
+
+// streamLimiter 统计每个用户当前活跃的流式对话数量
+type streamLimiter struct {
+	mu     sync.Mutex
+	active map[uint]int
+}
+
+func newStreamLimiter() *streamLimiter {
+	return &streamLimiter{
+		active: make(map[uint]int),
+	}
+}
+
+// acquire 尝试为用户占用一个流式名额，limit <= 0 表示不限制
+func (l *streamLimiter) acquire(userID uint, limit int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if limit > 0 && l.active[userID] >= limit {
+		return false
+	}
+	l.active[userID]++
+	return true
+}
+
+// release 释放用户占用的流式名额
+func (l *streamLimiter) release(userID uint) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.active[userID] <= 1 {
+		delete(l.active, userID)
+		return
+	}
+	l.active[userID]--
+}
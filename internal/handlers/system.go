@@ -1,7 +1,7 @@
 package handlers
 
 import (
-	"encoding/json"
+	"context"
 	"net/http"
 	"strconv"
 	"strings"
@@ -10,53 +10,64 @@ import (
 
 	"eino-rag/internal/config"
 	"eino-rag/internal/db"
+	"eino-rag/internal/jobs"
 	"eino-rag/internal/models"
+	"eino-rag/internal/response"
+	"eino-rag/internal/services/chat"
+	"eino-rag/internal/services/document"
+	"eino-rag/internal/services/rag"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
-	"gorm.io/gorm"
 )
 
 type SystemHandler struct {
-	config *config.Config
-	logger *zap.Logger
+	config    *config.Config
+	jobs      *jobs.Manager
+	retriever *rag.MilvusRetriever
+	logger    *zap.Logger
 }
 
 // 配置更新互斥锁，防止并发更新
 var configUpdateMutex sync.Mutex
 
-func NewSystemHandler(cfg *config.Config, logger *zap.Logger) *SystemHandler {
+func NewSystemHandler(cfg *config.Config, jobManager *jobs.Manager, retriever *rag.MilvusRetriever, logger *zap.Logger) *SystemHandler {
 	return &SystemHandler{
-		config: cfg,
-		logger: logger,
+		config:    cfg,
+		jobs:      jobManager,
+		retriever: retriever,
+		logger:    logger,
 	}
 }
 
 // Health 健康检查
 // @Summary 健康检查
-// @Description 检查服务健康状态
+// @Description 检查服务健康状态，maintenance 为 true 表示处于维护模式，写操作暂不可用
 // @Tags 系统
 // @Accept json
 // @Produce json
-// @Success 200 {object} HealthResponse "服务健康"
+// @Success 200 {object} response.Envelope{data=HealthResponse} "服务健康"
 // @Router /api/health [get]
 func (h *SystemHandler) Health(c *gin.Context) {
-	c.JSON(http.StatusOK, HealthResponse{
-		Status:    "healthy",
-		Timestamp: time.Now().Unix(),
-		Service:   "eino-rag",
-		Version:   "1.0.0",
+	// 读取维护状态失败不影响健康检查，按未开启处理
+	maintenance, _ := db.GetMaintenance(c.Request.Context())
+	response.OK(c, HealthResponse{
+		Status:      "healthy",
+		Timestamp:   time.Now().Unix(),
+		Service:     "eino-rag",
+		Version:     "1.0.0",
+		Maintenance: maintenance.Enabled,
 	})
 }
 
 // GetConfig 获取系统配置
 // @Summary 获取系统配置
-// @Description 获取系统配置信息
+// @Description 获取系统配置信息。密码、令牌和密钥等敏感项已设置时返回 [REDACTED]，地址中的密码被隐藏
 // @Tags 系统
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
-// @Success 200 {object} SystemConfigResponse "系统配置"
+// @Success 200 {object} response.Envelope{data=SystemConfigResponse} "系统配置"
 // @Failure 401 {object} ErrorResponse "未授权"
 // @Failure 403 {object} ErrorResponse "权限不足"
 // @Router /api/system/config [get]
@@ -64,86 +75,217 @@ func (h *SystemHandler) GetConfig(c *gin.Context) {
 	// 检查是否为管理员
 	roleName, _ := c.Get("role_name")
 	if roleName != "admin" {
-		c.JSON(http.StatusForbidden, ErrorResponse{
-			Success: false,
-			Message: "Admin permission required",
-		})
+		response.Error(c, http.StatusForbidden, "Admin permission required")
 		return
 	}
 
-	// 从 Go 配置变量读取所有配置
+	configMap := h.configMap()
+	for key, value := range configMap {
+		if s, ok := value.(string); ok {
+			configMap[key] = config.RedactValue(key, s)
+		}
+	}
+	response.OK(c, SystemConfigResponse{
+		Config: configMap,
+	})
+}
+
+// configMap 返回当前生效的所有配置
+func (h *SystemHandler) configMap() map[string]interface{} {
+	// 从 Go 配置变量读取所有配置，使用快照保证各项来自同一版本
+	cfg := h.config.Snapshot()
 	configMap := make(map[string]interface{})
 	
 	// Server 配置
-	configMap["server_port"] = h.config.ServerPort
-	configMap["server_host"] = h.config.ServerHost
-	configMap["gin_mode"] = h.config.GinMode
+	configMap["server_port"] = cfg.ServerPort
+	configMap["server_host"] = cfg.ServerHost
+	configMap["gin_mode"] = cfg.GinMode
 	
 	// Database 配置
-	configMap["db_path"] = h.config.DBPath
+	configMap["db_path"] = cfg.DBPath
+	configMap["seed_path"] = cfg.SeedPath
 	
 	// Redis 配置
-	configMap["redis_url"] = h.config.RedisURL
-	configMap["redis_db"] = h.config.RedisDB
-	configMap["redis_password"] = h.config.RedisPassword
+	configMap["redis_url"] = cfg.RedisURL
+	configMap["redis_db"] = cfg.RedisDB
+	configMap["redis_password"] = cfg.RedisPassword
 	
 	// Milvus 配置
-	configMap["milvus_address"] = h.config.MilvusAddress
-	configMap["collection_name"] = h.config.CollectionName
-	configMap["vector_dimension"] = h.config.VectorDimension
-	configMap["metric_type"] = h.config.MetricType
-	configMap["index_type"] = h.config.IndexType
+	configMap["milvus_address"] = cfg.MilvusAddress
+	configMap["collection_name"] = cfg.CollectionName
+	configMap["milvus_username"] = cfg.MilvusUsername
+	configMap["milvus_password"] = cfg.MilvusPassword
+	configMap["milvus_token"] = cfg.MilvusToken
+	configMap["milvus_tls"] = cfg.MilvusTLS
+	configMap["vector_dimension"] = cfg.VectorDimension
+	configMap["embedding_dimension_mode"] = string(cfg.EmbeddingDimensionMode)
+	configMap["metric_type"] = cfg.MetricType
+	configMap["index_type"] = cfg.IndexType
+	configMap["milvus_search_nprobe"] = cfg.MilvusSearchNprobe
+	configMap["milvus_search_ef"] = cfg.MilvusSearchEf
+	configMap["milvus_kb_partitions"] = cfg.MilvusKBPartitions
 	
 	// Ollama 配置
-	configMap["ollama_base_url"] = h.config.OllamaBaseURL
-	configMap["embedding_model"] = h.config.EmbeddingModel
-	configMap["llm_model"] = h.config.LLMModel
+	configMap["embedding_provider"] = cfg.EmbeddingProvider
+	configMap["ollama_base_url"] = cfg.OllamaBaseURL
+	configMap["embedding_model"] = cfg.EmbeddingModel
+	configMap["llm_model"] = cfg.LLMModel
 	
 	// OpenAI 配置
-	configMap["openai_api_key"] = h.config.OpenAIAPIKey
-	configMap["openai_model"] = h.config.OpenAIModel
-	configMap["openai_base_url"] = h.config.OpenAIBaseURL
+	configMap["openai_api_key"] = cfg.OpenAIAPIKey
+	configMap["openai_model"] = cfg.OpenAIModel
+	configMap["openai_base_url"] = cfg.OpenAIBaseURL
+	configMap["openai_json_mode"] = cfg.OpenAIJSONMode
+	configMap["openai_unsupported_params"] = cfg.OpenAIUnsupportedParams
 	
 	// RAG 配置
-	configMap["chunk_size"] = h.config.ChunkSize
-	configMap["chunk_overlap"] = h.config.ChunkOverlap
-	configMap["chunking_strategy"] = string(h.config.ChunkingStrategy)
-	configMap["top_k"] = h.config.TopK
-	configMap["score_threshold"] = h.config.ScoreThreshold
-	configMap["embedding_cache"] = h.config.EmbeddingCache
+	configMap["chunk_size"] = cfg.ChunkSize
+	configMap["chunk_overlap"] = cfg.ChunkOverlap
+	configMap["chunking_strategy"] = string(cfg.ChunkingStrategy)
+	configMap["min_chunk_length"] = cfg.MinChunkLength
+	configMap["boilerplate_min_repeat_ratio"] = cfg.BoilerplateMinRepeatRatio
+	configMap["top_k"] = cfg.TopK
+	configMap["score_threshold"] = cfg.ScoreThreshold
+	configMap["context_window"] = cfg.ContextWindow
+	configMap["embedding_cache"] = cfg.EmbeddingCache
+	configMap["embedding_skip_failed_chunks"] = cfg.EmbeddingSkipFailedChunks
+	configMap["embedding_concurrency"] = cfg.EmbeddingConcurrency
+	configMap["embedding_max_retries"] = cfg.EmbeddingMaxRetries
+	configMap["embedding_retry_backoff_ms"] = cfg.EmbeddingRetryBackoff.Milliseconds()
+	configMap["contextual_embedding"] = cfg.ContextualEmbedding
+	configMap["retrieval_cache"] = cfg.RetrievalCache
+	configMap["retrieval_cache_ttl"] = cfg.RetrievalCacheTTL.Seconds()
+	configMap["query_expansion"] = cfg.QueryExpansion
+	configMap["query_expansion_method"] = cfg.QueryExpansionMethod
+	configMap["query_expansion_variants"] = cfg.QueryExpansionVariants
+	configMap["query_expansion_synonyms"] = cfg.QueryExpansionSynonyms
+	configMap["query_expansion_cache_ttl"] = cfg.QueryExpansionCacheTTL.Seconds()
+	configMap["recency_half_life_days"] = cfg.RecencyHalfLifeDays
+	configMap["max_chunks_per_doc"] = cfg.MaxChunksPerDoc
+	configMap["retrieval_candidate_multiplier"] = cfg.RetrievalCandidateMultiplier
+	configMap["hybrid_alpha"] = cfg.HybridAlpha
+	configMap["retrieval_mmr"] = cfg.RetrievalMMR
+	configMap["retrieval_mmr_lambda"] = cfg.RetrievalMMRLambda
+	configMap["rag_fallback"] = cfg.RAGFallback
+	configMap["rag_fallback_max_docs"] = cfg.RAGFallbackMaxDocs
+	configMap["rag_strict"] = cfg.RAGStrict
+	configMap["semantic_cache"] = cfg.SemanticCache
+	configMap["semantic_cache_threshold"] = cfg.SemanticCacheThreshold
+	configMap["semantic_cache_max_entries"] = cfg.SemanticCacheMaxEntries
+	configMap["semantic_cache_ttl"] = cfg.SemanticCacheTTL.Seconds()
+	
+	// Chat 配置
+	configMap["max_streams_per_user"] = cfg.MaxStreamsPerUser
+	configMap["max_streams_per_admin"] = cfg.MaxStreamsPerAdmin
+	configMap["max_response_tokens"] = cfg.MaxResponseTokens
+	configMap["max_response_tokens_user"] = cfg.MaxResponseTokensUser
+	configMap["max_response_tokens_admin"] = cfg.MaxResponseTokensAdmin
+	configMap["max_stored_message_length"] = cfg.MaxStoredMessageLength
+	configMap["chat_stream_max_resumes"] = cfg.ChatStreamMaxResumes
+	configMap["chat_tool_calling"] = cfg.ChatToolCalling
+	configMap["max_candidates_user"] = cfg.MaxCandidatesUser
+	configMap["max_candidates_admin"] = cfg.MaxCandidatesAdmin
+	configMap["max_penalty_user"] = cfg.MaxPenaltyUser
+	configMap["max_penalty_admin"] = cfg.MaxPenaltyAdmin
+	configMap["chat_trace_rate_limit"] = cfg.ChatTraceRateLimit
+	configMap["answer_filters"] = cfg.AnswerFilters
+	configMap["answer_profanity_words"] = cfg.AnswerProfanityWords
+	configMap["answer_verification"] = cfg.AnswerVerification
+	configMap["answer_verification_action"] = cfg.AnswerVerificationAction
+	configMap["max_conversations_per_user"] = cfg.MaxConversationsPerUser
+	configMap["conversation_limit_policy"] = cfg.ConversationLimitPolicy
+	configMap["conversation_attachment_ttl"] = cfg.ConversationAttachmentTTL.Seconds()
+	configMap["embedding_failover"] = cfg.EmbeddingFailover
+	configMap["embedding_failover_model"] = cfg.EmbeddingFailoverModel
+	configMap["embedding_failover_threshold"] = cfg.EmbeddingFailoverThreshold
+	configMap["embedding_failover_cooldown"] = cfg.EmbeddingFailoverCooldown.Seconds()
+	
+	// 文档摘要配置
+	configMap["summary_enabled"] = cfg.SummaryEnabled
+	configMap["summary_min_length"] = cfg.SummaryMinLength
+	configMap["summary_max_input_length"] = cfg.SummaryMaxInputLength
+	configMap["summary_index_chunk"] = cfg.SummaryIndexChunk
+	configMap["document_preview_length"] = cfg.DocumentPreviewLength
+	configMap["dedup_normalize"] = cfg.DedupNormalize
 	
 	// Authentication 配置
-	configMap["jwt_secret"] = h.config.JWTSecret
-	configMap["jwt_expire_hours"] = h.config.JWTExpireHours
-	configMap["session_secret"] = h.config.SessionSecret
+	configMap["jwt_secret"] = cfg.JWTSecret
+	configMap["jwt_expire_hours"] = cfg.JWTExpireHours
+	configMap["session_secret"] = cfg.SessionSecret
+	configMap["auth_rate_limit_per_ip"] = cfg.AuthRateLimitPerIP
+	configMap["auth_rate_limit_global"] = cfg.AuthRateLimitGlobal
+	configMap["auth_rate_limit_window"] = cfg.AuthRateLimitWindow.Seconds()
+	configMap["compression_enabled"] = cfg.CompressionEnabled
+	configMap["compression_min_size"] = cfg.CompressionMinSize
+	configMap["compression_content_types"] = cfg.CompressionContentTypes
+	configMap["password_min_length"] = cfg.PasswordMinLength
+	configMap["password_require_upper"] = cfg.PasswordRequireUpper
+	configMap["password_require_lower"] = cfg.PasswordRequireLower
+	configMap["password_require_digit"] = cfg.PasswordRequireDigit
+	configMap["password_require_symbol"] = cfg.PasswordRequireSymbol
 	
 	// Upload 配置
-	configMap["max_upload_size"] = h.config.MaxUploadSize
-	configMap["allowed_file_types"] = h.config.AllowedFileTypes
+	configMap["max_upload_size"] = cfg.MaxUploadSize
+	configMap["allowed_file_types"] = cfg.AllowedFileTypes
+	configMap["pdf_max_pages"] = cfg.PDFMaxPages
+	configMap["max_chunks_per_document"] = cfg.MaxChunksPerDocument
+	configMap["chunk_limit_action"] = cfg.ChunkLimitAction
+	configMap["upload_session_ttl"] = cfg.UploadSessionTTL.Seconds()
+	configMap["upload_job_ttl"] = cfg.UploadJobTTL.Seconds()
+
+	// 元数据允许列表
+	configMap["chunk_metadata_keys"] = cfg.ChunkMetadataKeys
+	configMap["response_metadata_keys"] = cfg.ResponseMetadataKeys
+
+	// Stats 配置
+	configMap["stats_detail_limit"] = cfg.StatsDetailLimit
+
+	// 一致性检查配置
+	configMap["consistency_check_interval"] = cfg.ConsistencyCheckInterval.Seconds()
+	configMap["consistency_auto_cleanup"] = cfg.ConsistencyAutoCleanup
+
+	// 文档保留期限配置
+	configMap["retention_check_interval"] = cfg.RetentionCheckInterval.Seconds()
+	configMap["kb_delete_grace_period"] = cfg.KBDeleteGracePeriod.Seconds()
 	
 	// Timeouts 配置（转换为秒）
-	configMap["index_timeout"] = h.config.IndexTimeout.Seconds()
-	configMap["milvus_insert_timeout"] = h.config.MilvusInsertTimeout.Seconds()
-	configMap["milvus_connect_timeout"] = h.config.MilvusConnectTimeout.Seconds()
-	configMap["grpc_keepalive_time"] = h.config.GRPCKeepaliveTime.Seconds()
-	configMap["embedding_timeout"] = h.config.EmbeddingTimeout.Seconds()
-	configMap["grpc_keepalive_timeout"] = h.config.GRPCKeepaliveTimeout.Seconds()
-
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"config": configMap,
-	})
+	configMap["index_timeout"] = cfg.IndexTimeout.Seconds()
+	configMap["milvus_insert_timeout"] = cfg.MilvusInsertTimeout.Seconds()
+	configMap["milvus_connect_timeout"] = cfg.MilvusConnectTimeout.Seconds()
+	configMap["grpc_keepalive_time"] = cfg.GRPCKeepaliveTime.Seconds()
+	configMap["embedding_timeout"] = cfg.EmbeddingTimeout.Seconds()
+	configMap["grpc_keepalive_timeout"] = cfg.GRPCKeepaliveTimeout.Seconds()
+	configMap["milvus_search_timeout"] = cfg.MilvusSearchTimeout.Seconds()
+	configMap["openai_timeout"] = cfg.OpenAITimeout.Seconds()
+	configMap["request_timeout"] = cfg.RequestTimeout.Seconds()
+	configMap["request_timeout_long"] = cfg.LongRequestTimeout.Seconds()
+	
+	// Milvus 重试与熔断配置
+	configMap["milvus_max_retries"] = cfg.MilvusMaxRetries
+	configMap["milvus_retry_backoff_ms"] = cfg.MilvusRetryBackoff.Milliseconds()
+	configMap["milvus_breaker_threshold"] = cfg.MilvusBreakerThreshold
+	configMap["milvus_breaker_timeout"] = cfg.MilvusBreakerTimeout.Seconds()
+	configMap["milvus_health_check_interval"] = cfg.MilvusHealthCheckInterval.Seconds()
+	configMap["milvus_health_check_timeout"] = cfg.MilvusHealthCheckTimeout.Seconds()
+
+	// Embedding 连接池配置
+	configMap["embedding_max_idle_conns"] = cfg.EmbeddingMaxIdleConns
+	configMap["embedding_max_idle_conns_per_host"] = cfg.EmbeddingMaxIdleConnsPerHost
+	configMap["embedding_idle_conn_timeout"] = cfg.EmbeddingIdleConnTimeout.Seconds()
+	configMap["embedding_keep_alive"] = cfg.EmbeddingKeepAlive.Seconds()
+
+	return configMap
 }
 
 // UpdateConfig 更新系统配置
 // @Summary 更新系统配置
-// @Description 更新系统配置信息
+// @Description 更新系统配置信息。openai_base_url 必须满足 OPENAI_ALLOWED_HOSTS 的出站限制，否则返回400；敏感项的值为 [REDACTED] 时保持不变
 // @Tags 系统
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
 // @Param request body SystemConfigRequest true "配置信息"
-// @Success 200 {object} SuccessResponse "更新成功"
+// @Success 200 {object} response.Envelope{data=SuccessResponse} "更新成功"
 // @Failure 400 {object} ErrorResponse "请求错误"
 // @Failure 401 {object} ErrorResponse "未授权"
 // @Failure 403 {object} ErrorResponse "权限不足"
@@ -152,107 +294,52 @@ func (h *SystemHandler) UpdateConfig(c *gin.Context) {
 	// 检查是否为管理员
 	roleName, _ := c.Get("role_name")
 	if roleName != "admin" {
-		c.JSON(http.StatusForbidden, ErrorResponse{
-			Success: false,
-			Message: "Admin permission required",
-		})
+		response.Error(c, http.StatusForbidden, "Admin permission required")
 		return
 	}
 
 	// 解析请求
 	var req SystemConfigRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Success: false,
-			Message: "Invalid request data",
-		})
+		response.Error(c, http.StatusBadRequest, "Invalid request data")
 		return
 	}
 
-	// 加锁防止并发更新
-	configUpdateMutex.Lock()
-	defer configUpdateMutex.Unlock()
-
-	database := db.GetDB()
-	
-	// 更新配置，带重试逻辑
-	var err error
-	for i := 0; i < 3; i++ {
-		err = database.Transaction(func(tx *gorm.DB) error {
-		for key, value := range req.Configs {
-			// 将值转换为字符串存储
-			var valueStr string
-			switch v := value.(type) {
-			case string:
-				valueStr = v
-			case float64:
-				valueStr = strconv.FormatFloat(v, 'f', -1, 64)
-			case int:
-				valueStr = strconv.Itoa(v)
-			case bool:
-				valueStr = strconv.FormatBool(v)
-			case []interface{}:
-				// 处理数组类型（如 allowed_file_types）
-				var strSlice []string
-				for _, item := range v {
-					if s, ok := item.(string); ok {
-						strSlice = append(strSlice, s)
-					}
-				}
-				valueStr = strings.Join(strSlice, ",")
-			default:
-				// 尝试将其他类型转换为JSON字符串
-				if jsonBytes, err := json.Marshal(v); err == nil {
-					valueStr = string(jsonBytes)
-				} else {
-					valueStr = ""
-				}
-			}
-			
-			config := models.SystemConfig{
-				Key:   key,
-				Value: valueStr,
-			}
-			
-			// 使用更高效的 Save 方法
-			if err := tx.Save(&config).Error; err != nil {
-				return err
-			}
-		}
-		return nil
-	})
-	
-		// 如果没有错误或不是数据库锁定错误，则跳出循环
-		if err == nil || !strings.Contains(err.Error(), "database is locked") {
-			break
+	values := make(map[string]string, len(req.Configs))
+	for key, value := range req.Configs {
+		// 原样提交获取到的配置时，敏感项是占位符，不覆盖已保存的值
+		if s := configValueString(value); !config.IsSecretKey(key) || s != config.RedactedValue {
+			values[key] = s
 		}
-		
-		// 重试前等待
-		time.Sleep(time.Millisecond * 100 * time.Duration(i+1))
+	}
+	if err := config.ValidateOpenAIBaseURL(values["openai_base_url"], h.config.OpenAIAllowedHosts); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := chat.ValidateAnswerFilters(strings.Split(values["answer_filters"], ",")); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, err := rag.ParseMetricType(values["metric_type"]); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, err := rag.ParseIndexType(values["index_type"]); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
 	}
 
+	changeID, changed, err := h.applyConfig(values, c.GetUint("user_id"), "")
 	if err != nil {
 		h.logger.Error("Failed to update system config", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Success: false,
-			Message: "Failed to update system config",
-		})
+		response.Error(c, http.StatusInternalServerError, "Failed to update system config")
 		return
 	}
-
-	// 从数据库重新加载配置到内存
-	var updatedConfigs []models.SystemConfig
-	if err := database.Find(&updatedConfigs).Error; err == nil {
-		configMap := make(map[string]string)
-		for _, cfg := range updatedConfigs {
-			configMap[cfg.Key] = cfg.Value
-		}
-		// 更新内存中的配置
-		config.UpdateFromDB(configMap)
+	if changed > 0 {
+		recordAudit(c, h.logger, "config_update", "system_config", 0, changeID)
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse{
-		Success: true,
+	response.OK(c, SuccessResponse{
 		Message: "System config updated successfully",
 	})
 }
@@ -264,7 +351,7 @@ func (h *SystemHandler) UpdateConfig(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
-// @Success 200 {object} map[string]interface{} "统计信息"
+// @Success 200 {object} response.Envelope{data=StatsResponse} "统计信息"
 // @Failure 401 {object} ErrorResponse "未授权"
 // @Router /api/system/stats [get]
 func (h *SystemHandler) GetStats(c *gin.Context) {
@@ -303,8 +390,310 @@ func (h *SystemHandler) GetStats(c *gin.Context) {
 	database.Model(&models.Document{}).Where("DATE(created_at) = ?", today).Count(&todayDocs)
 	stats["today_new_documents"] = todayDocs
 	
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"stats":   stats,
+	response.OK(c, StatsResponse{Stats: stats})
+}
+
+// statsActivityDays 详细统计中近期活动覆盖的天数
+const statsActivityDays = 7
+
+// GetDetailedStats 获取详细统计
+// @Summary 获取详细统计
+// @Description 获取按知识库、上传者和日期分组的统计信息，用于管理后台图表
+// @Tags 系统
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param limit query int false "知识库和上传者排行返回条数，不超过系统配置的上限"
+// @Success 200 {object} response.Envelope{data=DetailedStatsResponse} "详细统计"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "权限不足"
+// @Failure 500 {object} ErrorResponse "服务器错误"
+// @Router /api/system/stats/detailed [get]
+func (h *SystemHandler) GetDetailedStats(c *gin.Context) {
+	limit := h.config.Snapshot().StatsDetailLimit
+	if limit <= 0 {
+		limit = 10
+	}
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l < limit {
+		limit = l
+	}
+
+	stats, err := h.detailedStats(limit)
+	if err != nil {
+		h.logger.Error("Failed to compute detailed stats", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to compute detailed stats")
+		return
+	}
+
+	response.OK(c, DetailedStatsResponse{
+		Stats: *stats,
 	})
-}
\ No newline at end of file
+}
+
+// detailedStats 使用分组查询计算详细统计，每类数据一次查询
+func (h *SystemHandler) detailedStats(limit int) (*DetailedStats, error) {
+	database := db.GetDB()
+	stats := &DetailedStats{
+		KnowledgeBases: []KnowledgeBaseStat{},
+		TopUploaders:   []UploaderStat{},
+	}
+
+	// 文档总数和存储总量
+	var totals struct {
+		Count int64
+		Bytes int64
+	}
+	if err := database.Model(&models.Document{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(file_size), 0) AS bytes").
+		Scan(&totals).Error; err != nil {
+		return nil, err
+	}
+	stats.DocumentCount = totals.Count
+	stats.StorageBytes = totals.Bytes
+
+	if err := database.Model(&models.DocumentChunk{}).Count(&stats.ChunkCount).Error; err != nil {
+		return nil, err
+	}
+
+	// 各知识库的文档数和存储量
+	if err := database.Table("knowledge_bases AS kb").
+		Select("kb.id, kb.name, COUNT(d.id) AS doc_count, COALESCE(SUM(d.file_size), 0) AS storage_bytes").
+		Joins("LEFT JOIN documents AS d ON d.knowledge_base_id = kb.id").
+		Group("kb.id, kb.name").
+		Order("doc_count DESC, kb.id ASC").
+		Limit(limit).
+		Scan(&stats.KnowledgeBases).Error; err != nil {
+		return nil, err
+	}
+
+	// 上传文档最多的用户
+	if err := database.Table("documents AS d").
+		Select("u.id AS user_id, u.name, COUNT(d.id) AS doc_count, COALESCE(SUM(d.file_size), 0) AS storage_bytes").
+		Joins("JOIN users AS u ON u.id = d.creator_id").
+		Group("u.id, u.name").
+		Order("doc_count DESC, u.id ASC").
+		Limit(limit).
+		Scan(&stats.TopUploaders).Error; err != nil {
+		return nil, err
+	}
+
+	// 近期每日新增文档和对话
+	since := time.Now().AddDate(0, 0, -(statsActivityDays - 1))
+	sinceDate := since.Format("2006-01-02")
+	type dailyCount struct {
+		Day   string
+		Count int64
+	}
+	var docDaily, chatDaily []dailyCount
+	if err := database.Model(&models.Document{}).
+		Select("DATE(created_at) AS day, COUNT(*) AS count").
+		Where("DATE(created_at) >= ?", sinceDate).
+		Group("day").
+		Scan(&docDaily).Error; err != nil {
+		return nil, err
+	}
+	if err := database.Model(&models.ChatHistory{}).
+		Select("DATE(created_at) AS day, COUNT(*) AS count").
+		Where("DATE(created_at) >= ?", sinceDate).
+		Group("day").
+		Scan(&chatDaily).Error; err != nil {
+		return nil, err
+	}
+
+	activity := make([]DailyActivity, statsActivityDays)
+	index := make(map[string]int, statsActivityDays)
+	for i := range activity {
+		day := since.AddDate(0, 0, i).Format("2006-01-02")
+		activity[i].Date = day
+		index[day] = i
+	}
+	for _, d := range docDaily {
+		if i, ok := index[d.Day]; ok {
+			activity[i].Documents = d.Count
+		}
+	}
+	for _, d := range chatDaily {
+		if i, ok := index[d.Day]; ok {
+			activity[i].Conversations = d.Count
+		}
+	}
+	stats.RecentActivity = activity
+
+	return stats, nil
+}
+
+// ClearRetrievalCache 清空检索结果缓存
+// @Summary 清空检索缓存
+// @Description 删除Redis中所有缓存的检索结果和语义缓存的回答（需要管理员权限）
+// @Tags 系统
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Envelope{data=ClearCacheResponse} "清空成功"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "权限不足"
+// @Router /api/system/cache/retrieval [delete]
+func (h *SystemHandler) ClearRetrievalCache(c *gin.Context) {
+	cleared, err := db.ClearRetrievalCache(c.Request.Context())
+	if err != nil {
+		h.logger.Error("Failed to clear retrieval cache", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to clear retrieval cache")
+		return
+	}
+	semantic, err := db.ClearSemanticCache(c.Request.Context())
+	if err != nil {
+		h.logger.Error("Failed to clear semantic cache", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to clear semantic cache")
+		return
+	}
+	cleared += semantic
+
+	h.logger.Info("Retrieval cache cleared", zap.Int64("cleared", cleared))
+	response.OK(c, ClearCacheResponse{
+		Cleared: cleared,
+	})
+}
+
+// GetMilvusStatus 获取Milvus连接状态
+// @Summary 获取Milvus连接状态
+// @Description 获取Milvus连接状态、熔断器状态和后台重连的退避间隔（需要管理员权限）
+// @Tags 系统
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Envelope{data=MilvusStatusResponse} "连接状态"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "权限不足"
+// @Failure 503 {object} ErrorResponse "向量数据库不可用"
+// @Router /api/system/milvus/status [get]
+func (h *SystemHandler) GetMilvusStatus(c *gin.Context) {
+	if h.retriever == nil {
+		response.Error(c, http.StatusServiceUnavailable, "Vector database is not available")
+		return
+	}
+	response.OK(c, milvusStatusResponse(h.retriever.Status()))
+}
+
+// ResetMilvusBackoff 重置Milvus重连退避
+// @Summary 重置Milvus重连退避
+// @Description 把后台重连的退避间隔重置为最小值并立即触发一次重连，用于修复Milvus后尽快恢复服务（需要管理员权限）。重连在后台进行，结果通过状态接口查看
+// @Tags 系统
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Envelope{data=MilvusStatusResponse} "已触发重连"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "权限不足"
+// @Failure 503 {object} ErrorResponse "向量数据库不可用"
+// @Router /api/system/milvus/reset-backoff [post]
+func (h *SystemHandler) ResetMilvusBackoff(c *gin.Context) {
+	if h.retriever == nil {
+		response.Error(c, http.StatusServiceUnavailable, "Vector database is not available")
+		return
+	}
+	h.retriever.ResetBackoff()
+	response.OK(c, milvusStatusResponse(h.retriever.Status()))
+}
+
+// MigrateMilvusPartitions 把默认分区中的向量迁移到知识库分区
+// @Summary 迁移向量到知识库分区
+// @Description 在后台把默认分区（_default）中的向量按知识库移动到各自的分区（kb_<id>），迁移之前写入的向量也只需搜索知识库分区（需要管理员权限）。对话附件知识库的向量留在默认分区。迁移期间检索照常进行，中断后可以重新执行，进度可通过 /api/system/jobs/{id}/stream 订阅
+// @Tags 系统
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 202 {object} response.Envelope{data=JobResponse} "已启动的后台任务"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "权限不足"
+// @Failure 503 {object} ErrorResponse "向量数据库不可用"
+// @Router /api/system/milvus/migrate-partitions [post]
+func (h *SystemHandler) MigrateMilvusPartitions(c *gin.Context) {
+	if h.retriever == nil {
+		response.Error(c, http.StatusServiceUnavailable, "Vector database is not available")
+		return
+	}
+	job := h.jobs.Start("milvus_partition_migration", func(ctx context.Context, progress jobs.Reporter) (interface{}, error) {
+		skip, err := document.AttachmentKnowledgeBaseIDs()
+		if err != nil {
+			return nil, err
+		}
+		return h.retriever.MigratePartitions(ctx, skip, progress)
+	})
+	response.JSON(c, http.StatusAccepted, JobResponse{Job: job})
+}
+
+// CompareEmbeddings 对比两个嵌入模型的检索结果
+// @Summary 对比嵌入模型
+// @Description 用两个嵌入模型分别生成问题的向量，在各自的向量集合中检索 topK 个结果并排列返回，用于更换嵌入模型前评估效果（需要管理员权限）。集合不存在或维度与模型不一致时该侧只返回向量维度和错误信息，未指定集合的非当前模型只生成向量
+// @Tags 系统
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body CompareEmbeddingsRequest true "对比请求"
+// @Success 200 {object} response.Envelope{data=CompareEmbeddingsResponse} "对比结果"
+// @Failure 400 {object} ErrorResponse "请求参数错误"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "权限不足"
+// @Failure 503 {object} ErrorResponse "向量数据库不可用"
+// @Router /api/system/embeddings/compare [post]
+func (h *SystemHandler) CompareEmbeddings(c *gin.Context) {
+	var req CompareEmbeddingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if h.retriever == nil {
+		response.Error(c, http.StatusServiceUnavailable, "Vector database is not available")
+		return
+	}
+
+	topK := document.ResolveTopK(h.config.Snapshot(), req.KnowledgeBaseID, req.TopK)
+	targets := make([]rag.CompareTarget, len(req.Models))
+	for i, m := range req.Models {
+		targets[i] = rag.CompareTarget{Model: m.Model, Collection: m.Collection}
+	}
+	results := h.retriever.CompareEmbeddings(c.Request.Context(), req.Query, targets, req.KnowledgeBaseID, topK)
+
+	resp := CompareEmbeddingsResponse{
+		Query:  req.Query,
+		TopK:   topK,
+		Models: make([]EmbeddingCompareSide, len(results)),
+		Shared: []string{},
+	}
+	seen := make(map[string]int)
+	for i, result := range results {
+		resp.Models[i] = EmbeddingCompareSide{
+			Model:               result.Model,
+			Collection:          result.Collection,
+			Dimension:           result.Dimension,
+			CollectionExists:    result.CollectionExists,
+			CollectionDimension: result.CollectionDimension,
+			EmbeddingMs:         result.EmbeddingTime.Milliseconds(),
+			SearchMs:            result.SearchTime.Milliseconds(),
+			Results:             toDocResults(result.Results),
+			Error:               result.Error,
+		}
+		for _, doc := range result.Results {
+			if seen[doc.ID] == i {
+				seen[doc.ID] = i + 1
+			}
+		}
+	}
+	for _, doc := range results[0].Results {
+		if seen[doc.ID] == len(results) {
+			resp.Shared = append(resp.Shared, doc.ID)
+		}
+	}
+
+	response.OK(c, resp)
+}
+
+// milvusStatusResponse 转换为接口返回的状态
+func milvusStatusResponse(status rag.MilvusStatus) MilvusStatusResponse {
+	resp := MilvusStatusResponse{
+		Connected:    status.Connected,
+		BreakerOpen:  status.BreakerOpen,
+		RetryDelayMs: status.RetryDelay.Milliseconds(),
+		LastError:    status.LastError,
+	}
+	if !status.NextRetryAt.IsZero() {
+		resp.NextRetryAt = status.NextRetryAt.Unix()
+	}
+	return resp
+}
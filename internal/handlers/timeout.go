@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"eino-rag/internal/response"
+	"eino-rag/internal/services/rag"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TimeoutErrorData 阶段超时时随错误信息返回的详情
+type TimeoutErrorData struct {
+	Stage          string  `json:"stage" example:"embedding"`
+	TimeoutSeconds float64 `json:"timeout_seconds" example:"120"`
+}
+
+// stageTimeoutMessage 错误由某个处理阶段超时引起时返回提示信息，例如 "Embedding timed out after 2m0s"
+func stageTimeoutMessage(err error) (*rag.TimeoutError, string, bool) {
+	var timeoutErr *rag.TimeoutError
+	if !errors.As(err, &timeoutErr) {
+		return nil, "", false
+	}
+	stage := string(timeoutErr.Stage)
+	if stage != "" {
+		stage = strings.ToUpper(stage[:1]) + stage[1:]
+	}
+	return timeoutErr, fmt.Sprintf("%s timed out after %s", stage, timeoutErr.Timeout), true
+}
+
+// respondStageTimeout 错误由阶段超时引起时返回 504 并标明超时的阶段，已处理时返回true
+func respondStageTimeout(c *gin.Context, err error) bool {
+	timeoutErr, message, ok := stageTimeoutMessage(err)
+	if !ok {
+		return false
+	}
+	response.ErrorWithData(c, http.StatusGatewayTimeout, message, TimeoutErrorData{
+		Stage:          string(timeoutErr.Stage),
+		TimeoutSeconds: timeoutErr.Timeout.Seconds(),
+	})
+	return true
+}
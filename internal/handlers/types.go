@@ -1,26 +1,90 @@
 package handlers
 
-import "time"
+import (
+	"time"
+
+	"eino-rag/internal/auth"
+	"eino-rag/internal/jobs"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/chat"
+	"eino-rag/internal/services/document"
+	"eino-rag/internal/services/rag"
+)
 
 // Common response types
 
+// 成功的响应都包装在 response.Envelope 的 data 中，以下 *Response 类型描述 data 的内容
+
+// ErrorResponse 失败时的响应，与 response.Envelope 结构相同
 type ErrorResponse struct {
 	Success bool   `json:"success" example:"false"`
-	Message string `json:"message" example:"Error message"`
+	Error   string `json:"error" example:"Error message"`
+}
+
+// PasswordPolicyErrorResponse 密码不符合密码策略
+type PasswordPolicyErrorResponse struct {
+	Success bool                     `json:"success" example:"false"`
+	Error   string                   `json:"error" example:"password does not meet the password policy"`
+	Data    PasswordPolicyViolations `json:"data"`
+}
+
+// PasswordPolicyViolations 密码不符合的具体规则
+type PasswordPolicyViolations struct {
+	Violations []string `json:"violations" example:"password must be at least 8 characters,password must contain a digit"`
+}
+
+type PasswordPolicyResponse struct {
+	Policy auth.PasswordPolicy `json:"policy"`
+}
+
+// UserResponse 单个用户
+type UserResponse struct {
+	User *models.User `json:"user"`
+}
+
+// APIKeyListResponse API密钥列表
+type APIKeyListResponse struct {
+	APIKeys []models.APIKey `json:"api_keys"`
+}
+
+type UserListResponse struct {
+	Users    []models.User `json:"users"`
+	Total    int64         `json:"total" example:"25"`
+	Page     int           `json:"page" example:"1"`
+	PageSize int           `json:"page_size" example:"10"`
 }
 
 type SuccessResponse struct {
-	Success bool   `json:"success" example:"true"`
 	Message string `json:"message" example:"Operation successful"`
 }
 
 // Upload response types
 
 type UploadResponse struct {
-	Success    bool   `json:"success" example:"true"`
-	Message    string `json:"message" example:"Document indexed successfully"`
-	DocumentID uint   `json:"document_id,omitempty" example:"123"`
-	ChunkCount int    `json:"chunk_count,omitempty" example:"5"`
+	Message         string `json:"message" example:"Document indexed successfully"`
+	DocumentID      uint   `json:"document_id,omitempty" example:"123"`
+	ChunkCount      int    `json:"chunk_count,omitempty" example:"5"`
+	IndexedChunks   int    `json:"indexed_chunks" example:"5"`
+	FailedChunks    int    `json:"failed_chunks" example:"0"`
+	TruncatedChunks int    `json:"truncated_chunks,omitempty" example:"0"`
+}
+
+// DocumentLimitsResponse 上传限制
+type DocumentLimitsResponse struct {
+	AllowedFileTypes     []string `json:"allowed_file_types" example:".pdf,.txt,.md"`
+	MaxUploadSize        int64    `json:"max_upload_size" example:"10485760"`
+	PDFMaxPages          int      `json:"pdf_max_pages" example:"1000"`
+	MaxChunksPerDocument int      `json:"max_chunks_per_document" example:"10000"`
+	ChunkLimitAction     string   `json:"chunk_limit_action" example:"reject" enums:"reject,truncate"`
+}
+
+// CreateUploadSessionRequest 创建分片上传会话
+type CreateUploadSessionRequest struct {
+	KnowledgeBaseID uint   `json:"kb_id" binding:"required" example:"1"`
+	FileName        string `json:"filename" binding:"required" example:"manual.pdf"`
+	Size            int64  `json:"size" binding:"required,min=1" example:"104857600"` // 文件总字节数
+	PageStart       int    `json:"page_start" binding:"min=0" example:"1"`
+	PageEnd         int    `json:"page_end" binding:"min=0" example:"200"`
 }
 
 // Search request/response types
@@ -30,10 +94,32 @@ type SearchRequest struct {
 	KnowledgeBaseID uint   `json:"kb_id,omitempty" example:"1"`
 	TopK            int    `json:"top_k,omitempty" example:"5"`
 	ReturnContext   bool   `json:"return_context" example:"true"`
+	// 每个命中分块前后补充的相邻分块数量，不填时使用全局配置，0 表示不扩展
+	ContextWindow *int `json:"context_window,omitempty" binding:"omitempty,min=0,max=5" example:"1"`
+	// 检索力度：IVF 索引为 nprobe，HNSW 索引为 ef；越大召回越高、延迟越大
+	SearchEffort int `json:"search_effort,omitempty" binding:"omitempty,min=1" example:"32"`
+	// 时间衰减重排中新鲜度的权重，不填时使用知识库的设置，0 表示关闭
+	RecencyWeight *float64 `json:"recency_weight,omitempty" binding:"omitempty,gte=0,lte=1" example:"0.3"`
+	// 新鲜度衰减到一半所需的天数，不填时使用知识库的设置或全局配置
+	RecencyHalfLifeDays float64 `json:"recency_half_life_days,omitempty" binding:"omitempty,gt=0" example:"14"`
+	// 每个文档最多返回的分块数，不填时使用全局配置，0 表示不限制
+	MaxChunksPerDoc *int `json:"max_chunks_per_doc,omitempty" binding:"omitempty,min=0" example:"2"`
+	// 启用时间衰减或按文档限量时相对 top_k 多召回的倍数，不填时使用全局配置
+	CandidateMultiplier int `json:"candidate_multiplier,omitempty" binding:"omitempty,min=1,max=10" example:"5"`
+	// 以下为文档过滤条件，同时指定时需全部满足
+	// 只检索该用户创建的文档
+	CreatorID uint `json:"creator_id,omitempty" example:"2"`
+	// 只检索在此时间及之后创建的文档（RFC3339）
+	CreatedAfter *time.Time `json:"created_after,omitempty" example:"2024-01-01T00:00:00Z"`
+	// 只检索在此时间之前创建的文档（RFC3339）
+	CreatedBefore *time.Time `json:"created_before,omitempty" example:"2024-07-01T00:00:00Z"`
+	// 只检索包含全部这些标签的文档（markdown frontmatter 中的 tags，不区分大小写）
+	Tags []string `json:"tags,omitempty" binding:"omitempty,max=10,dive,min=1,max=100" example:"deployment"`
+	// 混合检索：同时按关键词匹配分块内容，按 HYBRID_ALPHA 混合向量分数和关键词分数
+	UseHybrid bool `json:"use_hybrid,omitempty" example:"false"`
 }
 
 type SearchResponse struct {
-	Success   bool        `json:"success" example:"true"`
 	Query     string      `json:"query" example:"人工智能的发展历史"`
 	Context   string      `json:"context,omitempty" example:"根据检索到的文档..."`
 	Documents []DocResult `json:"documents"`
@@ -54,14 +140,159 @@ type ChatRequest struct {
 	ConversationID  string `json:"conversation_id,omitempty" example:"550e8400-e29b-41d4-a716-446655440000"`
 	KnowledgeBaseID uint   `json:"kb_id,omitempty" example:"1"`
 	UseRAG          bool   `json:"use_rag" example:"true"`
+	// 以下检索参数可选，未设置时使用系统配置
+	TopK           *int     `json:"top_k,omitempty" binding:"omitempty,min=1,max=50" example:"5"`
+	ScoreThreshold *float32 `json:"score_threshold,omitempty" binding:"omitempty,gte=0,lte=1" example:"0.5"`
+	ContextWindow  *int     `json:"context_window,omitempty" binding:"omitempty,min=0,max=5" example:"1"`
+	// 检索力度：IVF 索引为 nprobe，HNSW 索引为 ef；越大召回越高、延迟越大
+	SearchEffort *int `json:"search_effort,omitempty" binding:"omitempty,min=1" example:"32"`
+	// 时间衰减重排中新鲜度的权重，不填时使用知识库的设置，0 表示关闭
+	RecencyWeight *float64 `json:"recency_weight,omitempty" binding:"omitempty,gte=0,lte=1" example:"0.3"`
+	// 新鲜度衰减到一半所需的天数，不填时使用知识库的设置或全局配置
+	RecencyHalfLifeDays *float64 `json:"recency_half_life_days,omitempty" binding:"omitempty,gt=0" example:"14"`
+	// 每个文档最多检索的分块数，不填时使用全局配置，0 表示不限制
+	MaxChunksPerDoc *int `json:"max_chunks_per_doc,omitempty" binding:"omitempty,min=0" example:"2"`
+	// 启用时间衰减或按文档限量时相对 top_k 多召回的倍数，不填时使用全局配置
+	CandidateMultiplier *int `json:"candidate_multiplier,omitempty" binding:"omitempty,min=1,max=10" example:"5"`
+	// 以下为文档过滤条件，同时指定时需全部满足
+	// 只检索该用户创建的文档
+	CreatorID uint `json:"creator_id,omitempty" example:"2"`
+	// 只检索在此时间及之后创建的文档（RFC3339）
+	CreatedAfter *time.Time `json:"created_after,omitempty" example:"2024-01-01T00:00:00Z"`
+	// 只检索在此时间之前创建的文档（RFC3339）
+	CreatedBefore *time.Time `json:"created_before,omitempty" example:"2024-07-01T00:00:00Z"`
+	// 只检索包含全部这些标签的文档（markdown frontmatter 中的 tags，不区分大小写）
+	Tags []string `json:"tags,omitempty" binding:"omitempty,max=10,dive,min=1,max=100" example:"deployment"`
+	// 是否由模型通过 search_knowledge_base 工具自行决定何时检索，需要模型支持函数调用
+	ToolCalling *bool `json:"tool_calling,omitempty" example:"false"`
+	// 回复最大token数，不能超过当前角色允许的上限
+	MaxTokens *int `json:"max_tokens,omitempty" binding:"omitempty,min=1" example:"1024"`
+	// 回复格式：markdown（默认）、plain 或 json；json 要求配置的模型支持 JSON 模式
+	ResponseFormat string `json:"response_format,omitempty" example:"markdown"`
+	// 候选回复数，默认1；大于1时返回多个候选且不保存回复，不能超过当前角色允许的上限，仅非流式对话支持
+	N *int `json:"n,omitempty" binding:"omitempty,min=1" example:"3"`
+	// 以下生成参数可选，模型服务不支持的参数被忽略（见 OPENAI_UNSUPPORTED_PARAMS），使用的参数随回复保存
+	// 停止序列，最多4个，生成到其中任一序列时截止
+	Stop []string `json:"stop,omitempty" binding:"omitempty,max=4,dive,min=1,max=50" example:"###"`
+	// 存在惩罚和频率惩罚，取值在 [-2, 2] 内且绝对值不能超过当前角色允许的上限
+	PresencePenalty  *float32 `json:"presence_penalty,omitempty" binding:"omitempty,gte=-2,lte=2" example:"0.5"`
+	FrequencyPenalty *float32 `json:"frequency_penalty,omitempty" binding:"omitempty,gte=-2,lte=2" example:"0.5"`
 }
 
 type ChatResponse struct {
-	Success        bool   `json:"success" example:"true"`
 	Message        string `json:"message" example:"AI的回复内容"`
 	ConversationID string `json:"conversation_id" example:"550e8400-e29b-41d4-a716-446655440000"`
 	Context        string `json:"context,omitempty" example:"基于以下文档..."`
-	Timestamp      int64  `json:"timestamp" example:"1640995200"`
+	// 回复来自语义缓存时说明命中的缓存问题和相似度
+	SemanticCache *chat.SemanticCacheHit `json:"semantic_cache,omitempty"`
+	// 开启回答核对且检索到内容时，回答中有依据和无依据的论断及对无依据论断采取的处理
+	Verification *chat.AnswerVerification `json:"verification,omitempty"`
+	// 启用了RAG但向量库不可用，回复没有经过知识库检索；与检索成功但没有相关文档区分
+	RetrievalUnavailable bool  `json:"retrieval_unavailable,omitempty" example:"false"`
+	Timestamp            int64 `json:"timestamp" example:"1640995200"`
+}
+
+// ChatCandidatesResponse n 大于1时的聊天回复，选择其中一个后才保存到对话
+type ChatCandidatesResponse struct {
+	ConversationID string   `json:"conversation_id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	CandidateSetID string   `json:"candidate_set_id" example:"8b3f0c52-6f1e-4a51-9d1c-2f0e6a7c9b10"` // 选择候选回复时使用，1小时内有效
+	Candidates     []string `json:"candidates" example:"回答一,回答二"`
+	Context        string   `json:"context,omitempty" example:"基于以下文档..."`
+	// 启用了RAG但向量库不可用，回复没有经过知识库检索
+	RetrievalUnavailable bool  `json:"retrieval_unavailable,omitempty" example:"false"`
+	Timestamp            int64 `json:"timestamp" example:"1640995200"`
+}
+
+// SelectCandidateRequest 选择一个候选回复保存到对话
+type SelectCandidateRequest struct {
+	CandidateSetID string `json:"candidate_set_id" binding:"required" example:"8b3f0c52-6f1e-4a51-9d1c-2f0e6a7c9b10"`
+	Index          *int   `json:"index" binding:"required,min=0" example:"1"` // 候选回复的位置（从0开始）
+}
+
+type SelectCandidateResponse struct {
+	ConversationID string             `json:"conversation_id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Message        models.ChatMessage `json:"message"` // 保存的助手消息
+}
+
+// ChatTraceResponse 一次对话各步骤的中间结果，用于排查检索和生成问题
+type ChatTraceResponse struct {
+	Query string `json:"query" example:"如何重置密码？"`
+	// 开启查询扩展时额外检索的改写
+	QueryVariants []string `json:"query_variants,omitempty" example:"怎样修改密码"`
+	// 实际使用的检索参数，未启用RAG时为空
+	Retrieval *models.RetrievalParams `json:"retrieval,omitempty"`
+	// 检索到的分块及分数
+	Documents            []DocResult `json:"documents"`
+	RetrievalError       string      `json:"retrieval_error,omitempty" example:"failed to retrieve documents: milvus is not connected"`
+	RetrievalUnavailable bool        `json:"retrieval_unavailable,omitempty" example:"false"`
+	Context              string      `json:"context" example:"文档 1:\n..."`
+	// 发送给模型的完整消息
+	Prompt []chat.TraceMessage `json:"prompt"`
+	// 模型的原始输出和经过后处理过滤器的回答
+	RawAnswer    string `json:"raw_answer" example:"模型的原始输出"`
+	Answer       string `json:"answer" example:"经过后处理的回答"`
+	RetrievalMs  int64  `json:"retrieval_ms" example:"35"`
+	GenerationMs int64  `json:"generation_ms" example:"1820"`
+}
+
+// ConversationMetaRequest 设置对话文件夹和标签，未提供的字段保持不变
+type ConversationMetaRequest struct {
+	Folder *string  `json:"folder,omitempty" binding:"omitempty,max=100" example:"work"`
+	Tags   []string `json:"tags,omitempty" binding:"omitempty,max=20,dive,max=50" example:"research,rag"`
+}
+
+type ConversationMetaResponse struct {
+	Conversation *models.ChatHistory `json:"conversation"`
+}
+
+type ConversationListResponse struct {
+	Conversations []models.ChatHistory `json:"conversations"`
+	Total         int64                `json:"total" example:"20"`
+	Page          int                  `json:"page" example:"1"`
+	PageSize      int                  `json:"page_size" example:"10"`
+	// 当前用户的对话总数（不受过滤条件影响）和上限
+	Usage *chat.ConversationUsage `json:"usage"`
+}
+
+type ConversationDetailResponse struct {
+	ID       string               `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Messages []models.ChatMessage `json:"messages"`
+}
+
+// EditMessageRequest 修改对话中的用户消息并重新生成回复
+type EditMessageRequest struct {
+	Content string `json:"content" binding:"required" example:"改成问：如何配置Milvus索引？"`
+	// 为true时保留被替换的消息及其之后的内容，可通过分支列表查看
+	KeepBranch bool `json:"keep_branch" example:"true"`
+}
+
+type EditMessageResponse struct {
+	ID                   string               `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Messages             []models.ChatMessage `json:"messages"`
+	BranchID             uint                 `json:"branch_id,omitempty" example:"3"`                 // 保留的旧分支ID
+	RetrievalUnavailable bool                 `json:"retrieval_unavailable,omitempty" example:"false"` // 向量库不可用，新回复没有经过知识库检索
+	// 开启回答核对时新回复的核对结果
+	Verification *chat.AnswerVerification `json:"verification,omitempty"`
+}
+
+type ConversationBranchListResponse struct {
+	Branches []models.ConversationBranch `json:"branches"`
+}
+
+// SSE streaming types
+
+// SSEEvent 流式聊天接口每一行 `data: {...}` 的JSON结构
+// type 取值及对应 data 内容：
+//   - start:   StartEvent
+//   - context: ContextEvent
+//   - content: ContentEvent
+//   - end:     EndEvent（任务进度流为 JobEndEvent，流式上传为 UploadEndEvent）
+//   - error:   ErrorEvent
+//   - progress: JobProgressEvent
+//   - parse/chunk/embed: UploadProgressEvent
+type SSEEvent struct {
+	Type string      `json:"type" enums:"start,context,content,end,error,progress,parse,chunk,embed" example:"content"`
+	Data interface{} `json:"data" swaggertype:"object"`
 }
 
 // Knowledge base types
@@ -69,50 +300,223 @@ type ChatResponse struct {
 type CreateKBRequest struct {
 	Name        string `json:"name" binding:"required,min=1,max=200" example:"技术文档库"`
 	Description string `json:"description" example:"存储技术相关文档"`
+	// 请求未指定 top_k 时的检索数量，0 或不填表示使用全局配置
+	DefaultTopK int `json:"default_top_k" binding:"omitempty,min=0,max=50" example:"3"`
+	// 时间衰减重排中新鲜度的权重，0 或不填表示不启用，适用于新闻、变更日志等越新越相关的知识库
+	RecencyWeight float64 `json:"recency_weight" binding:"omitempty,gte=0,lte=1" example:"0.3"`
+	// 新鲜度衰减到一半所需的天数，0 或不填表示使用全局配置
+	RecencyHalfLifeDays float64 `json:"recency_half_life_days" binding:"omitempty,gte=0" example:"14"`
+	// 切分前删除页眉页脚等在多数页中重复出现的行，适用于PDF等带页眉页脚的文档
+	StripBoilerplate bool `json:"strip_boilerplate" example:"false"`
+	// 切分前删除匹配这些正则表达式的内容，删除后为空的行一并去掉
+	BoilerplatePatterns []string `json:"boilerplate_patterns,omitempty" binding:"omitempty,max=50" example:"^Confidential.*$"`
+	// 向量化时在分块前加上文档标题和所在章节，提高按标题提问的召回率，不填表示使用全局配置
+	ContextualEmbedding *bool `json:"contextual_embedding,omitempty" example:"true"`
+	// 切分前替换为占位符的个人信息类别：email/id_card/credit_card/ssn/phone/ip，不填表示不清理
+	PIIRedaction []string `json:"pii_redaction,omitempty" example:"email,phone"`
+	// 文档保留天数，创建时间早于该期限的文档由后台任务处理，0 或不填表示永久保留
+	RetentionDays int `json:"retention_days" binding:"omitempty,min=0" example:"90"`
+	// 文档超过保留期限时的处理方式：delete 删除文档和向量，archive 删除向量并保留文档记录，不填表示删除
+	RetentionAction models.RetentionAction `json:"retention_action,omitempty" binding:"omitempty,oneof=delete archive" example:"archive"`
+	// 为true时同名知识库已存在则直接返回该知识库，否则返回409
+	GetOrCreate bool `json:"get_or_create" example:"false"`
+}
+
+// KBConflictResponse 当前用户已有同名知识库
+type KBConflictResponse struct {
+	Success bool       `json:"success" example:"false"`
+	Error   string     `json:"error" example:"Knowledge base with this name already exists"`
+	Data    KBConflict `json:"data"`
+}
+
+// KBConflict 已存在的同名知识库
+type KBConflict struct {
+	ExistingID uint `json:"existing_id" example:"1"`
+}
+
+type KBResponse struct {
+	KnowledgeBase *models.KnowledgeBase `json:"knowledge_base"`
+}
+
+// KBDeleteResponse 软删除知识库的结果
+type KBDeleteResponse struct {
+	Message string `json:"message" example:"Knowledge base deleted successfully"`
+	// 在此之前可以恢复，之后由清理任务永久删除；未配置宽限期时为空，只能手动永久删除
+	PurgeAfter *time.Time `json:"purge_after,omitempty"`
+}
+
+// HardDeleteKBRequest 永久删除知识库的确认，必须填写知识库名称
+type HardDeleteKBRequest struct {
+	Confirm string `json:"confirm" binding:"required" example:"技术文档库"`
+}
+
+// KBCreateResponse 创建知识库的结果，get_or_create 返回已有知识库时 Created 为 false
+type KBCreateResponse struct {
+	KnowledgeBase *models.KnowledgeBase `json:"knowledge_base"`
+	Created       bool                  `json:"created" example:"true"`
 }
 
 type UpdateKBRequest struct {
 	Name        string `json:"name,omitempty" example:"更新后的名称"`
 	Description string `json:"description,omitempty" example:"更新后的描述"`
+	// 设置为0表示恢复使用全局配置，不填则不修改
+	DefaultTopK *int `json:"default_top_k,omitempty" binding:"omitempty,min=0,max=50" example:"8"`
+	// 设置为0表示关闭时间衰减重排，不填则不修改
+	RecencyWeight *float64 `json:"recency_weight,omitempty" binding:"omitempty,gte=0,lte=1" example:"0.3"`
+	// 设置为0表示恢复使用全局配置，不填则不修改
+	RecencyHalfLifeDays *float64 `json:"recency_half_life_days,omitempty" binding:"omitempty,gte=0" example:"14"`
+	// 是否删除页眉页脚等重复行，只影响之后上传的文档，不填则不修改
+	StripBoilerplate *bool `json:"strip_boilerplate,omitempty" example:"true"`
+	// 替换全部清理规则，传空数组表示清除，不填则不修改，只影响之后上传的文档
+	BoilerplatePatterns *[]string `json:"boilerplate_patterns,omitempty" binding:"omitempty,max=50" example:"^Page \\d+ of \\d+$"`
+	// 是否在向量化时加上文档标题和所在章节，只影响之后索引的文档，已有文档需重新切分，不填则不修改
+	ContextualEmbedding *bool `json:"contextual_embedding,omitempty" example:"true"`
+	// 替换全部个人信息类别，传空数组表示关闭，不填则不修改，只影响之后上传的文档
+	PIIRedaction *[]string `json:"pii_redaction,omitempty" example:"email,phone"`
+	// 设置为0表示永久保留，不填则不修改，下次后台清理时按新的期限处理已有文档
+	RetentionDays *int `json:"retention_days,omitempty" binding:"omitempty,min=0" example:"90"`
+	// 超过保留期限时的处理方式：delete 或 archive，不填则不修改
+	RetentionAction *models.RetentionAction `json:"retention_action,omitempty" binding:"omitempty,oneof=delete archive" example:"archive"`
 }
 
 type KBListResponse struct {
-	Success         bool                    `json:"success" example:"true"`
-	KnowledgeBases  []KnowledgeBaseWithDocs `json:"knowledge_bases"`
-	Total           int64                   `json:"total" example:"10"`
-	Page            int                     `json:"page" example:"1"`
-	PageSize        int                     `json:"page_size" example:"10"`
+	KnowledgeBases []KnowledgeBaseWithDocs `json:"knowledge_bases"`
+	Total          int64                   `json:"total" example:"10"`
+	Page           int                     `json:"page" example:"1"`
+	PageSize       int                     `json:"page_size" example:"10"`
 }
 
 type KnowledgeBaseWithDocs struct {
-	ID          uint      `json:"id" example:"1"`
-	Name        string    `json:"name" example:"技术文档库"`
-	Description string    `json:"description" example:"存储技术相关文档"`
-	DocCount    int       `json:"doc_count" example:"42"`
-	CreatorID   uint      `json:"creator_id" example:"1"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID                  uint      `json:"id" example:"1"`
+	Name                string    `json:"name" example:"技术文档库"`
+	Description         string    `json:"description" example:"存储技术相关文档"`
+	DocCount            int       `json:"doc_count" example:"42"`
+	DefaultTopK         int       `json:"default_top_k" example:"0"`
+	RecencyWeight       float64   `json:"recency_weight" example:"0"`
+	RecencyHalfLifeDays float64   `json:"recency_half_life_days" example:"0"`
+	StripBoilerplate    bool      `json:"strip_boilerplate" example:"false"`
+	BoilerplatePatterns []string  `json:"boilerplate_patterns,omitempty"`
+	ContextualEmbedding *bool     `json:"contextual_embedding,omitempty" example:"true"`
+	PIIRedaction        []string  `json:"pii_redaction,omitempty"`
+	RetentionDays       int       `json:"retention_days" example:"0"`
+	RetentionAction     string    `json:"retention_action,omitempty" example:"archive"`
+	CreatorID           uint      `json:"creator_id" example:"1"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// PIIPreviewRequest 个人信息清理预览请求
+type PIIPreviewRequest struct {
+	Text string `json:"text" binding:"required,max=1048576" example:"联系人：alice@example.com，电话 13812345678"`
+	// 预览使用的类别，不填时使用知识库当前的设置
+	Categories []string `json:"categories,omitempty" example:"email,phone"`
+}
+
+// PIIPreviewResponse 个人信息清理预览结果，不会保存任何内容
+type PIIPreviewResponse struct {
+	Text       string              `json:"text" example:"联系人：[REDACTED_EMAIL]，电话 [REDACTED_PHONE]"`
+	Categories []string            `json:"categories" example:"email,phone"`
+	Redactions map[string]int      `json:"redactions"`
+	Matches    []document.PIIMatch `json:"matches"`
+}
+
+type EvaluateRequest struct {
+	TopK  int                   `json:"top_k,omitempty" binding:"omitempty,min=1,max=50" example:"5"`
+	Cases []EvaluateCaseRequest `json:"cases" binding:"required,min=1,max=200,dive"`
+}
+
+type EvaluateCaseRequest struct {
+	Query          string `json:"query" binding:"required" example:"如何配置Milvus"`
+	ExpectedDocIDs []uint `json:"expected_doc_ids" binding:"required,min=1" example:"12,15"`
+}
+
+type EvaluateResponse struct {
+	Report *rag.EvalReport `json:"report"`
 }
 
 // Document types
 
 type DocumentListResponse struct {
-	Success   bool            `json:"success" example:"true"`
-	Documents []DocumentInfo  `json:"documents"`
-	Total     int64           `json:"total" example:"50"`
-	Page      int             `json:"page" example:"1"`
-	PageSize  int             `json:"page_size" example:"10"`
+	Documents []DocumentInfo `json:"documents"`
+	Total     int64          `json:"total" example:"50"`
+	Page      int            `json:"page" example:"1"`
+	PageSize  int            `json:"page_size" example:"10"`
 }
 
 type DocumentInfo struct {
-	ID              uint      `json:"id" example:"123"`
-	KnowledgeBaseID uint      `json:"kb_id" example:"1"`
-	KnowledgeBaseName string  `json:"kb_name,omitempty" example:"技术文档"`
-	FileName        string    `json:"file_name" example:"document.pdf"`
-	FileSize        int64     `json:"file_size" example:"1048576"`
-	Hash            string    `json:"hash" example:"abc123..."`
-	CreatorID       uint      `json:"creator_id" example:"1"`
-	CreatedAt       time.Time `json:"created_at"`
+	ID                uint           `json:"id" example:"123"`
+	KnowledgeBaseID   uint           `json:"kb_id" example:"1"`
+	KnowledgeBaseName string         `json:"kb_name,omitempty" example:"技术文档"`
+	FileName          string         `json:"file_name" example:"document.pdf"`
+	FileSize          int64          `json:"file_size" example:"1048576"`
+	FileType          string         `json:"file_type,omitempty" example:".pdf"`
+	Hash              string         `json:"hash" example:"abc123..."`
+	NormalizedHash    string         `json:"normalized_hash,omitempty" example:"def456..."`
+	Status            string         `json:"status" example:"indexed"`
+	StatusMessage     string         `json:"status_message,omitempty" example:"embedding: failed to index document"`
+	Summary           string         `json:"summary,omitempty" example:"本文介绍了系统的部署流程和常见问题。"`
+	FailedChunks      int            `json:"failed_chunks,omitempty" example:"0"`
+	TruncatedChunks   int            `json:"truncated_chunks,omitempty" example:"0"`
+	Redactions        map[string]int `json:"redactions,omitempty"`
+	PageStart         int            `json:"page_start,omitempty" example:"1"`
+	PageEnd           int            `json:"page_end,omitempty" example:"50"`
+	TotalPages        int            `json:"total_pages,omitempty" example:"2000"`
+	ChunkSize         int            `json:"chunk_size" example:"500"`
+	ChunkOverlap      int            `json:"chunk_overlap" example:"50"`
+	ChunkingStrategy  string         `json:"chunking_strategy" example:"length"`
+	CreatorID         uint           `json:"creator_id" example:"1"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+
+	// markdown frontmatter 中的文档属性
+	Title  string     `json:"title,omitempty" example:"部署指南"`
+	Author string     `json:"author,omitempty" example:"张三"`
+	Tags   []string   `json:"tags,omitempty" example:"deployment,ops"`
+	Date   *time.Time `json:"date,omitempty"`
+}
+
+// ChunkingConfig 分块参数
+type ChunkingConfig struct {
+	ChunkSize        int    `json:"chunk_size" example:"500"`
+	ChunkOverlap     int    `json:"chunk_overlap" example:"50"`
+	ChunkingStrategy string `json:"chunking_strategy" example:"length"`
+}
+
+// OutdatedDocumentInfo 分块参数过期的文档，Reindexable 为 false 表示没有保存文本，只能重新上传
+type OutdatedDocumentInfo struct {
+	DocumentInfo
+	Reindexable bool `json:"reindexable" example:"true"`
+}
+
+type OutdatedDocumentsResponse struct {
+	Current   ChunkingConfig         `json:"current"`
+	Documents []OutdatedDocumentInfo `json:"documents"`
+	Total     int64                  `json:"total" example:"12"`
+	Page      int                    `json:"page" example:"1"`
+	PageSize  int                    `json:"page_size" example:"10"`
+}
+
+type RetryFailedResponse struct {
+	Total     int    `json:"total" example:"5"`
+	Succeeded int    `json:"succeeded" example:"3"`
+	Failed    int    `json:"failed" example:"1"`
+	Skipped   int    `json:"skipped" example:"1"`
+	FailedIDs []uint `json:"failed_ids,omitempty"`
+}
+
+type DocumentDetailResponse struct {
+	Document DocumentInfo `json:"document"`
+}
+
+// DocumentPreviewResponse 文档开头的预览文本
+type DocumentPreviewResponse struct {
+	DocumentID uint   `json:"document_id" example:"123"`
+	FileName   string `json:"file_name" example:"document.pdf"`
+	FileType   string `json:"file_type,omitempty" example:".pdf"`
+	// PDF总页数，预览只包含第一页
+	TotalPages int `json:"total_pages,omitempty" example:"20"`
+	// 纯文本，未保存解析文本的文档为空
+	Preview string `json:"preview" example:"第一章 系统概述"`
 }
 
 // System config types
@@ -122,15 +526,190 @@ type SystemConfigRequest struct {
 }
 
 type SystemConfigResponse struct {
-	Success bool                   `json:"success" example:"true"`
-	Configs map[string]interface{} `json:"configs"`
+	Config map[string]interface{} `json:"config"`
+}
+
+// Knowledge base export
+
+// ExportManifest 导出压缩包中的 manifest.json
+type ExportManifest struct {
+	KnowledgeBaseID   uint                  `json:"kb_id"`
+	KnowledgeBaseName string                `json:"kb_name"`
+	Description       string                `json:"description,omitempty"`
+	ExportedAt        time.Time             `json:"exported_at"`
+	ExportedBy        uint                  `json:"exported_by"`
+	ContentFormat     string                `json:"content_format"` // 文档内容为解析后的文本
+	Documents         []ExportManifestEntry `json:"documents"`
+}
+
+// ExportManifestEntry 单个文档的元数据，ContentFile 为空表示没有保存可导出的内容
+type ExportManifestEntry struct {
+	ID          uint      `json:"id"`
+	FileName    string    `json:"file_name"`
+	FileType    string    `json:"file_type,omitempty"`
+	FileSize    int64     `json:"file_size"`
+	Hash        string    `json:"hash"`
+	Status      string    `json:"status"`
+	Summary     string    `json:"summary,omitempty"`
+	CreatorID   uint      `json:"creator_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	ContentFile string    `json:"content_file,omitempty"`
+}
+
+// Detailed stats
+
+// BulkUserResult 批量创建中单个用户的结果
+type BulkUserResult struct {
+	Index   int          `json:"index" example:"0"` // 在请求列表中的位置
+	Email   string       `json:"email" example:"alice@example.com"`
+	Status  string       `json:"status" enums:"created,skipped,failed" example:"created"`
+	Message string       `json:"message,omitempty" example:"Email already exists"`
+	User    *models.User `json:"user,omitempty"`
+	// 请求未提供密码时生成的随机密码，只在本次响应中返回，请转交用户并提醒其修改
+	GeneratedPassword string `json:"generated_password,omitempty" example:"k7R#pX2m9Qw!eT4z"`
+}
+
+type BulkCreateUsersResponse struct {
+	Created int              `json:"created" example:"8"`
+	Skipped int              `json:"skipped" example:"1"`
+	Failed  int              `json:"failed" example:"1"`
+	Results []BulkUserResult `json:"results"`
+}
+
+// JobResponse 后台任务状态
+type JobResponse struct {
+	Job jobs.Job `json:"job"`
+}
+
+type ConfigHistoryResponse struct {
+	History  []models.ConfigHistory `json:"history"`
+	Total    int64                  `json:"total" example:"25"`
+	Page     int                    `json:"page" example:"1"`
+	PageSize int                    `json:"page_size" example:"20"`
+}
+
+type RevertConfigRequest struct {
+	ChangeID string `json:"change_id" binding:"required" example:"0b6f7c1e-3d0a-4f5e-9a51-2f0e7d4c8b12"`
+}
+
+type RevertConfigResponse struct {
+	ChangeID string   `json:"change_id" example:"7c2d9a4b-1e6f-4b3a-8d5c-9f0a1b2c3d4e"` // 本次回滚产生的变更ID
+	Keys     []string `json:"keys"`                                                     // 恢复的配置项
+}
+
+type ClearCacheResponse struct {
+	Cleared int64 `json:"cleared" example:"42"`
+}
+
+type CompareEmbeddingsRequest struct {
+	Query           string                  `json:"query" binding:"required" example:"如何配置向量索引"`
+	Models          []EmbeddingCompareModel `json:"models" binding:"required,len=2,dive"`
+	KnowledgeBaseID uint                    `json:"kb_id" example:"1"` // 为0时检索所有知识库
+	TopK            int                     `json:"top_k" binding:"min=0,max=100" example:"5"`
+}
+
+type EmbeddingCompareModel struct {
+	Model string `json:"model" binding:"required" example:"bge-m3"`
+	// 该模型的向量集合，为空时当前配置的模型使用默认集合，其他模型只生成向量不检索
+	Collection string `json:"collection" example:"eino_rag_documents_nomic"`
+}
+
+type EmbeddingCompareSide struct {
+	Model               string      `json:"model" example:"bge-m3"`
+	Collection          string      `json:"collection,omitempty" example:"eino_rag_documents"`
+	Dimension           int         `json:"dimension" example:"1024"`
+	CollectionExists    bool        `json:"collection_exists" example:"true"`
+	CollectionDimension int         `json:"collection_dimension,omitempty" example:"1024"`
+	EmbeddingMs         int64       `json:"embedding_ms" example:"35"`
+	SearchMs            int64       `json:"search_ms" example:"12"`
+	Results             []DocResult `json:"results"`
+	Error               string      `json:"error,omitempty" example:"milvus is not connected"`
+}
+
+type CompareEmbeddingsResponse struct {
+	Query  string                 `json:"query" example:"如何配置向量索引"`
+	TopK   int                    `json:"top_k" example:"5"`
+	Models []EmbeddingCompareSide `json:"models"`
+	Shared []string               `json:"shared"` // 两侧都检索到的分块ID
+}
+
+type MilvusStatusResponse struct {
+	Connected    bool   `json:"connected" example:"false"`
+	BreakerOpen  bool   `json:"breaker_open" example:"false"`
+	RetryDelayMs int64  `json:"retry_delay_ms" example:"64000"`                           // 当前重连退避间隔
+	NextRetryAt  int64  `json:"next_retry_at,omitempty" example:"1640995200"`             // 下一次重连检查的时间（Unix秒）
+	LastError    string `json:"last_error,omitempty" example:"context deadline exceeded"` // 最近一次重连失败的原因
+}
+
+type EmbeddingStatusResponse struct {
+	ActiveProvider  string `json:"active_provider" example:"ollama"` // 当前生成向量的服务：ollama 或 openai
+	ActiveModel     string `json:"active_model" example:"nomic-embed-text"`
+	PrimaryModel    string `json:"primary_model" example:"nomic-embed-text"`
+	FailoverEnabled bool   `json:"failover_enabled" example:"true"`
+	FailoverModel   string `json:"failover_model,omitempty" example:"text-embedding-3-small"`
+	FailedOverAt    int64  `json:"failed_over_at,omitempty" example:"1640995200"`     // 切换到备用服务的时间（Unix秒）
+	LastError       string `json:"last_error,omitempty" example:"connection refused"` // 主服务最近一次失败的原因
+}
+
+type StatsResponse struct {
+	Stats map[string]interface{} `json:"stats"`
+}
+
+type KnowledgeBaseStat struct {
+	ID           uint   `json:"id" example:"1"`
+	Name         string `json:"name" example:"产品手册"`
+	DocCount     int64  `json:"doc_count" example:"42"`
+	StorageBytes int64  `json:"storage_bytes" example:"10485760"`
+}
+
+type UploaderStat struct {
+	UserID       uint   `json:"user_id" example:"1"`
+	Name         string `json:"name" example:"张三"`
+	DocCount     int64  `json:"doc_count" example:"12"`
+	StorageBytes int64  `json:"storage_bytes" example:"5242880"`
+}
+
+type DailyActivity struct {
+	Date          string `json:"date" example:"2024-01-01"`
+	Documents     int64  `json:"documents" example:"5"`
+	Conversations int64  `json:"conversations" example:"20"`
+}
+
+type DetailedStats struct {
+	DocumentCount  int64               `json:"document_count" example:"100"`
+	ChunkCount     int64               `json:"chunk_count" example:"5000"`
+	StorageBytes   int64               `json:"storage_bytes" example:"104857600"`
+	KnowledgeBases []KnowledgeBaseStat `json:"knowledge_bases"`
+	TopUploaders   []UploaderStat      `json:"top_uploaders"`
+	RecentActivity []DailyActivity     `json:"recent_activity"`
+}
+
+type DetailedStatsResponse struct {
+	Stats DetailedStats `json:"stats"`
 }
 
 // Health check
 
 type HealthResponse struct {
-	Status    string `json:"status" example:"healthy"`
-	Timestamp int64  `json:"timestamp" example:"1640995200"`
-	Service   string `json:"service" example:"eino-rag"`
-	Version   string `json:"version" example:"1.0.0"`
+	Status      string `json:"status" example:"healthy"`
+	Timestamp   int64  `json:"timestamp" example:"1640995200"`
+	Service     string `json:"service" example:"eino-rag"`
+	Version     string `json:"version" example:"1.0.0"`
+	Maintenance bool   `json:"maintenance" example:"false"` // 维护模式下写操作返回503
+}
+
+// Maintenance mode
+
+// MaintenanceRequest 开启或关闭维护模式
+type MaintenanceRequest struct {
+	Enabled *bool  `json:"enabled" binding:"required"`
+	Reason  string `json:"reason" binding:"max=200" example:"reindexing knowledge bases"`
+}
+
+// MaintenanceResponse 维护模式状态
+type MaintenanceResponse struct {
+	Enabled   bool   `json:"enabled"`
+	Reason    string `json:"reason,omitempty"`
+	StartedBy uint   `json:"started_by,omitempty"`
+	StartedAt int64  `json:"started_at,omitempty"` // Unix时间戳
 }
\ No newline at end of file
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"eino-rag/internal/jobs"
+	"eino-rag/internal/response"
+	"eino-rag/internal/services/document"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// startUploadJob 保存异步上传任务并在后台入库，返回202和任务
+func (h *DocumentHandler) startUploadJob(c *gin.Context, form *uploadForm) {
+	job, data, err := h.docService.CreateUploadJob(c.Request.Context(), form.header.Filename, form.file, form.kbID, form.userID)
+	if err != nil {
+		h.logger.Error("Failed to create upload job",
+			zap.String("filename", form.header.Filename),
+			zap.Error(err))
+		respondUploadError(c, err)
+		return
+	}
+
+	h.logger.Info("Upload job created",
+		zap.String("job_id", job.ID),
+		zap.String("filename", job.FileName),
+		zap.Int("filesize", len(data)),
+		zap.Uint("kb_id", job.KnowledgeBaseID))
+	queued := *job
+	h.jobs.Start("async_upload", func(ctx context.Context, progress jobs.Reporter) (interface{}, error) {
+		doc, indexed, err := h.docService.RunUploadJob(ctx, &queued, data, form.opts)
+		if err != nil {
+			h.logger.Error("Failed to ingest async upload",
+				zap.String("job_id", queued.ID),
+				zap.String("filename", queued.FileName),
+				zap.Error(err))
+			return nil, err
+		}
+		return newIndexResponse(doc, indexed, "Document uploaded successfully"), nil
+	})
+	response.JSON(c, http.StatusAccepted, job)
+}
+
+// GetUploadJob 获取异步上传任务
+// @Summary 获取异步上传任务
+// @Description 获取 async=true 上传的处理状态（pending/processing/completed/failed）、完成百分比和分块数。
+// @Description 完成百分比按处理阶段估算；status 为 completed 时 document_id 为入库的文档，failed 时 error 为失败原因。只能查询自己创建的任务，超过 UPLOAD_JOB_TTL 没有更新的任务不再保留
+// @Tags 文档管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "任务ID"
+// @Success 200 {object} response.Envelope{data=models.UploadJob} "任务状态"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 404 {object} ErrorResponse "任务不存在或已过期"
+// @Router /api/documents/jobs/{id} [get]
+func (h *DocumentHandler) GetUploadJob(c *gin.Context) {
+	job, err := h.docService.GetUploadJob(c.Request.Context(), c.Param("id"))
+	if err == nil && job.UserID != c.GetUint("user_id") {
+		err = document.ErrUploadJobNotFound
+	}
+	if errors.Is(err, document.ErrUploadJobNotFound) {
+		response.Error(c, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to load upload job", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to load upload job")
+		return
+	}
+	response.OK(c, job)
+}
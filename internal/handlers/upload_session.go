@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/db"
+	"eino-rag/internal/jobs"
+	"eino-rag/internal/models"
+	"eino-rag/internal/response"
+	"eino-rag/internal/services/document"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// uploadOffsetHeader 分片的起始位置，响应中为已接收的字节数
+const uploadOffsetHeader = "Upload-Offset"
+
+// uploadPartLockTTL 写入一个分片时持有会话锁的最长时间
+const uploadPartLockTTL = 30 * time.Minute
+
+// CreateUploadSession 创建分片上传会话
+// @Summary 创建分片上传会话
+// @Description 声明文件名和大小，创建可断点续传的上传会话。之后用 PATCH 按顺序上传分片，会话在 UPLOAD_SESSION_TTL 内没有新分片时过期
+// @Tags 文档管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body CreateUploadSessionRequest true "会话信息"
+// @Success 201 {object} response.Envelope{data=models.UploadSession} "会话已创建"
+// @Failure 400 {object} ErrorResponse "请求错误"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "无权访问该知识库"
+// @Failure 404 {object} ErrorResponse "知识库不存在"
+// @Failure 413 {object} ErrorResponse "文件超过大小上限"
+// @Failure 503 {object} ErrorResponse "Redis不可用"
+// @Router /api/documents/uploads [post]
+func (h *DocumentHandler) CreateUploadSession(c *gin.Context) {
+	var req CreateUploadSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request data")
+		return
+	}
+	if req.PageStart > 0 && req.PageEnd > 0 && req.PageStart > req.PageEnd {
+		response.Error(c, http.StatusBadRequest, "page_start must not be greater than page_end")
+		return
+	}
+	if !db.UploadSessionsAvailable() {
+		response.Error(c, http.StatusServiceUnavailable, "Resumable uploads require Redis")
+		return
+	}
+	if err := authorizePersistentKnowledgeBase(c, req.KnowledgeBaseID); err != nil {
+		status, message := knowledgeBaseAccessError(err)
+		if status == http.StatusInternalServerError {
+			h.logger.Error("Failed to check knowledge base access", zap.Error(err))
+		}
+		response.Error(c, status, message)
+		return
+	}
+
+	session, err := h.docService.NewUploadSession(c.GetUint("user_id"), req.KnowledgeBaseID, req.FileName, req.Size, document.UploadOptions{
+		PageStart: req.PageStart,
+		PageEnd:   req.PageEnd,
+	})
+	if err != nil {
+		if errors.Is(err, document.ErrUploadTooLarge) {
+			response.Error(c, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		h.logger.Error("Failed to create upload session", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to create upload session")
+		return
+	}
+	if err := db.SaveUploadSession(c.Request.Context(), session, config.Get().Snapshot().UploadSessionTTL); err != nil {
+		h.docService.DiscardUploadParts(session.ID)
+		h.logger.Error("Failed to save upload session", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to create upload session")
+		return
+	}
+
+	h.logger.Info("Upload session created",
+		zap.String("session_id", session.ID),
+		zap.String("filename", session.FileName),
+		zap.Int64("size", session.Size))
+	c.Header(uploadOffsetHeader, "0")
+	response.JSON(c, http.StatusCreated, session)
+}
+
+// GetUploadSession 获取分片上传会话
+// @Summary 获取分片上传会话
+// @Description 获取已接收的字节数和入库状态。上传中断后从 offset 继续上传，status 为 completed 时 document_id 为入库的文档
+// @Tags 文档管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "会话ID"
+// @Success 200 {object} response.Envelope{data=models.UploadSession} "会话状态"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 404 {object} ErrorResponse "会话不存在或已过期"
+// @Router /api/documents/uploads/{id} [get]
+func (h *DocumentHandler) GetUploadSession(c *gin.Context) {
+	session, ok := h.loadUploadSession(c)
+	if !ok {
+		return
+	}
+	c.Header(uploadOffsetHeader, strconv.FormatInt(session.Offset, 10))
+	response.OK(c, session)
+}
+
+// UploadPart 上传一个分片
+// @Summary 上传分片
+// @Description 请求体为分片的原始字节，Upload-Offset 请求头为分片的起始位置，必须等于会话已接收的字节数。
+// @Description 中途断开时已收到的部分仍然有效，查询会话后从新的 offset 继续。收到最后一个分片后在后台入库，返回202，通过查询会话获取结果
+// @Tags 文档管理
+// @Accept application/octet-stream
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "会话ID"
+// @Param Upload-Offset header int true "分片的起始位置"
+// @Success 200 {object} response.Envelope{data=models.UploadSession} "分片已接收"
+// @Success 202 {object} response.Envelope{data=models.UploadSession} "文件已收齐，正在入库"
+// @Failure 400 {object} ErrorResponse "请求错误"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 404 {object} ErrorResponse "会话不存在或已过期"
+// @Failure 409 {object} response.Envelope{data=models.UploadSession} "起始位置不一致或另一个分片正在上传"
+// @Failure 413 {object} ErrorResponse "分片超出声明的文件大小"
+// @Router /api/documents/uploads/{id} [patch]
+func (h *DocumentHandler) UploadPart(c *gin.Context) {
+	offset, err := strconv.ParseInt(c.GetHeader(uploadOffsetHeader), 10, 64)
+	if err != nil || offset < 0 {
+		response.Error(c, http.StatusBadRequest, "Upload-Offset header must be a non-negative integer")
+		return
+	}
+	if _, ok := h.loadUploadSession(c); !ok {
+		return
+	}
+
+	// 同一会话同时只能写入一个分片
+	lock, err := db.AcquireLock(c.Request.Context(), "upload:"+c.Param("id"), uploadPartLockTTL)
+	if errors.Is(err, db.ErrLockNotAcquired) {
+		response.Error(c, http.StatusConflict, "Another part is being uploaded to this session")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to lock upload session", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to upload part")
+		return
+	}
+	defer db.ReleaseLock(context.Background(), lock)
+
+	// 取得锁后重新读取，拿到最新的位置
+	session, ok := h.loadUploadSession(c)
+	if !ok {
+		return
+	}
+
+	writeErr := h.docService.WriteUploadPart(session, offset, c.Request.Body)
+	if errors.Is(writeErr, document.ErrUploadOffsetMismatch) {
+		c.Header(uploadOffsetHeader, strconv.FormatInt(session.Offset, 10))
+		response.ErrorWithData(c, http.StatusConflict, writeErr.Error(), session)
+		return
+	}
+	if errors.Is(writeErr, document.ErrUploadTooLarge) {
+		response.Error(c, http.StatusRequestEntityTooLarge, writeErr.Error())
+		return
+	}
+
+	ttl := config.Get().Snapshot().UploadSessionTTL
+	complete := writeErr == nil && session.Offset == session.Size
+	if complete {
+		session.Status = models.UploadSessionProcessing
+	}
+	// 写入中途出错时同样保存，已收到的部分不必重传
+	if err := db.SaveUploadSession(context.Background(), session, ttl); err != nil {
+		h.logger.Error("Failed to save upload session", zap.String("session_id", session.ID), zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to upload part")
+		return
+	}
+	c.Header(uploadOffsetHeader, strconv.FormatInt(session.Offset, 10))
+	if writeErr != nil {
+		h.logger.Warn("Upload part interrupted",
+			zap.String("session_id", session.ID),
+			zap.Int64("offset", session.Offset),
+			zap.Error(writeErr))
+		response.ErrorWithData(c, http.StatusBadRequest, writeErr.Error(), session)
+		return
+	}
+	if !complete {
+		response.OK(c, session)
+		return
+	}
+
+	h.logger.Info("Upload received, starting ingestion",
+		zap.String("session_id", session.ID),
+		zap.String("filename", session.FileName))
+	completed := *session
+	h.jobs.Start("resumable_upload", func(ctx context.Context, progress jobs.Reporter) (interface{}, error) {
+		return h.completeUpload(ctx, &completed, ttl)
+	})
+	response.JSON(c, http.StatusAccepted, session)
+}
+
+// completeUpload 入库已收齐的文件，并把结果记录到会话中；维护模式下等待维护结束后再入库
+func (h *DocumentHandler) completeUpload(ctx context.Context, session *models.UploadSession, ttl time.Duration) (interface{}, error) {
+	var doc *models.Document
+	var indexed int
+	err := db.WaitForMaintenance(ctx)
+	if err == nil {
+		doc, indexed, err = h.docService.CompleteUpload(ctx, session)
+	}
+	if err != nil {
+		h.logger.Error("Failed to ingest resumable upload",
+			zap.String("session_id", session.ID),
+			zap.String("filename", session.FileName),
+			zap.Error(err))
+		session.Status = models.UploadSessionFailed
+		session.Error = err.Error()
+	} else {
+		session.Status = models.UploadSessionCompleted
+		session.DocumentID = doc.ID
+	}
+
+	// 会话在入库期间被删除时不再保存结果
+	if _, getErr := db.GetUploadSession(ctx, session.ID); getErr == nil {
+		if saveErr := db.SaveUploadSession(ctx, session, ttl); saveErr != nil {
+			h.logger.Error("Failed to save upload session", zap.String("session_id", session.ID), zap.Error(saveErr))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newIndexResponse(doc, indexed, "Document uploaded successfully"), nil
+}
+
+// TerminateUploadSession 终止分片上传会话
+// @Summary 终止分片上传会话
+// @Description 放弃上传，删除会话和已接收的内容。正在入库的会话不能终止
+// @Tags 文档管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "会话ID"
+// @Success 200 {object} response.Envelope{data=SuccessResponse} "已终止"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 404 {object} ErrorResponse "会话不存在或已过期"
+// @Failure 409 {object} ErrorResponse "会话正在入库"
+// @Router /api/documents/uploads/{id} [delete]
+func (h *DocumentHandler) TerminateUploadSession(c *gin.Context) {
+	session, ok := h.loadUploadSession(c)
+	if !ok {
+		return
+	}
+	if session.Status == models.UploadSessionProcessing {
+		response.Error(c, http.StatusConflict, "Upload is being ingested and cannot be terminated")
+		return
+	}
+
+	if err := db.DeleteUploadSession(c.Request.Context(), session.ID); err != nil {
+		h.logger.Error("Failed to delete upload session", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to terminate upload session")
+		return
+	}
+	h.docService.DiscardUploadParts(session.ID)
+
+	response.OK(c, SuccessResponse{
+		Message: "Upload session terminated",
+	})
+}
+
+// loadUploadSession 读取路径中的会话，只能访问自己创建的会话，失败时已写入响应
+func (h *DocumentHandler) loadUploadSession(c *gin.Context) (*models.UploadSession, bool) {
+	if !db.UploadSessionsAvailable() {
+		response.Error(c, http.StatusServiceUnavailable, "Resumable uploads require Redis")
+		return nil, false
+	}
+
+	session, err := db.GetUploadSession(c.Request.Context(), c.Param("id"))
+	if err == nil && session.UserID != c.GetUint("user_id") {
+		err = db.ErrUploadSessionNotFound
+	}
+	if errors.Is(err, db.ErrUploadSessionNotFound) {
+		response.Error(c, http.StatusNotFound, err.Error())
+		return nil, false
+	}
+	if err != nil {
+		h.logger.Error("Failed to load upload session", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to load upload session")
+		return nil, false
+	}
+	return session, true
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"eino-rag/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// UploadStream 上传文档并通过SSE推送处理进度
+// @Summary 上传文档（流式进度）
+// @Description 与 /api/documents/upload 相同的上传流程，处理过程中通过SSE推送进度。响应为 text/event-stream，每个事件是一行 `data: <SSEEvent JSON>`，后跟空行。
+// @Description 依次发送 parse（解析完成，含文档ID）、chunk（切分完成，total 为分块数）和多个 embed（向量化进度，processed/total）事件，
+// @Description 成功时以 end 事件结束，data 与普通上传的结果相同；失败时发送 code 为 upload_failed 的 error 事件。
+// @Description 表单参数无效时在开始推送前返回JSON错误。客户端中途断开不会中断处理，文档按普通上传的方式保存
+// @Tags 文档管理
+// @Accept multipart/form-data
+// @Produce text/event-stream
+// @Security ApiKeyAuth
+// @Param kb_id formData int true "知识库ID"
+// @Param file formData file true "文档文件"
+// @Param page_start formData int false "PDF起始页（从1开始），仅对PDF生效"
+// @Param page_end formData int false "PDF结束页（包含），仅对PDF生效，解析页数受 PDF_MAX_PAGES 限制"
+// @Success 200 {object} SSEEvent "SSE事件流，每个事件的结构"
+// @Failure 400 {object} ErrorResponse "请求错误"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "无权访问该知识库"
+// @Failure 404 {object} ErrorResponse "知识库不存在"
+// @Router /api/documents/upload/stream [post]
+func (h *DocumentHandler) UploadStream(c *gin.Context) {
+	form, ok := h.parseUploadForm(c)
+	if !ok {
+		return
+	}
+	defer form.file.Close()
+
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		h.sendSSEEvent(c.Writer, ErrorEvent{Message: "Streaming not supported"})
+		return
+	}
+
+	// 设置SSE响应头
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	// 每个事件写入后立即发送，客户端断开后写入失败不影响处理
+	send := func(payload SSEPayload) {
+		h.sendSSEEvent(c.Writer, payload)
+		flusher.Flush()
+	}
+
+	opts := form.opts
+	opts.Progress = func(doc *models.Document, chunkCount int) {
+		switch doc.Status {
+		case models.DocumentStatusUploaded:
+			send(UploadProgressEvent{Stage: SSEEventParse, DocumentID: doc.ID})
+		case models.DocumentStatusEmbedding:
+			send(UploadProgressEvent{Stage: SSEEventChunk, DocumentID: doc.ID, Total: chunkCount})
+		}
+	}
+	opts.EmbedProgress = func(processed, total int) {
+		send(UploadProgressEvent{Stage: SSEEventEmbed, Processed: processed, Total: total})
+	}
+
+	// 与普通上传的超时相同，但不随客户端断开而取消，避免留下处理到一半的文档
+	uploadCtx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), 5*time.Minute)
+	defer cancel()
+
+	h.logger.Info("Starting streamed document upload",
+		zap.String("filename", form.header.Filename),
+		zap.Int64("filesize", form.header.Size),
+		zap.Uint("kb_id", form.kbID))
+
+	doc, indexed, err := h.docService.UploadDocument(uploadCtx, form.header.Filename, form.file, form.kbID, form.userID, opts)
+	if err != nil {
+		h.logger.Error("Failed to upload document",
+			zap.String("filename", form.header.Filename),
+			zap.Error(err))
+		send(ErrorEvent{Message: err.Error(), Code: "upload_failed"})
+		return
+	}
+
+	h.logger.Info("Document uploaded successfully",
+		zap.String("filename", form.header.Filename),
+		zap.Uint("document_id", doc.ID),
+		zap.Int("indexed_chunks", indexed),
+		zap.Int("failed_chunks", doc.FailedChunks))
+	send(UploadEndEvent{UploadResponse: newIndexResponse(doc, indexed, "Document uploaded successfully")})
+}
+
+// sendSSEEvent 发送SSE事件
+func (h *DocumentHandler) sendSSEEvent(w http.ResponseWriter, payload SSEPayload) {
+	if err := WriteSSEEvent(w, payload); err != nil {
+		h.logger.Debug("Failed to write SSE event",
+			zap.String("type", payload.EventType()),
+			zap.Error(err))
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"eino-rag/internal/auth"
 	"eino-rag/internal/db"
 	"eino-rag/internal/models"
+	"eino-rag/internal/response"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -23,16 +24,27 @@ func NewUserHandler(logger *zap.Logger) *UserHandler {
 	}
 }
 
+// currentUserScope 获取当前管理员的管理范围，失败时返回错误响应
+func (h *UserHandler) currentUserScope(c *gin.Context) (userManageScope, bool) {
+	scope, err := userScope(c)
+	if err != nil {
+		h.logger.Error("Failed to get user scope", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to get current user")
+		return userManageScope{}, false
+	}
+	return scope, true
+}
+
 // ListUsers 获取用户列表
 // @Summary 获取用户列表
-// @Description 获取系统中的所有用户（需要管理员权限）
+// @Description 获取系统中的所有用户（需要管理员权限），分组管理员只能看到同组用户
 // @Tags 用户管理
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
 // @Param page query int false "页码" default(1)
 // @Param page_size query int false "每页数量" default(10)
-// @Success 200 {object} map[string]interface{} "用户列表"
+// @Success 200 {object} response.Envelope{data=UserListResponse} "用户列表"
 // @Failure 401 {object} ErrorResponse "未授权"
 // @Failure 403 {object} ErrorResponse "权限不足"
 // @Router /api/users [get]
@@ -54,15 +66,16 @@ func (h *UserHandler) ListUsers(c *gin.Context) {
 	var users []models.User
 	var total int64
 	
-	query := db.GetDB().Model(&models.User{})
+	scope, ok := h.currentUserScope(c)
+	if !ok {
+		return
+	}
+	query := scopeUsers(db.GetDB().Model(&models.User{}), scope)
 	
 	// 获取总数
 	if err := query.Count(&total).Error; err != nil {
 		h.logger.Error("Failed to count users", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Success: false,
-			Message: "Failed to count users",
-		})
+		response.Error(c, http.StatusInternalServerError, "Failed to count users")
 		return
 	}
 	
@@ -73,10 +86,7 @@ func (h *UserHandler) ListUsers(c *gin.Context) {
 		Order("created_at DESC").
 		Find(&users).Error; err != nil {
 		h.logger.Error("Failed to get users", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Success: false,
-			Message: "Failed to get users",
-		})
+		response.Error(c, http.StatusInternalServerError, "Failed to get users")
 		return
 	}
 	
@@ -86,24 +96,23 @@ func (h *UserHandler) ListUsers(c *gin.Context) {
 		users[i].Token = ""
 	}
 	
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"users":   users,
-		"total":   total,
-		"page":    page,
-		"page_size": pageSize,
+	response.OK(c, UserListResponse{
+		Users:    users,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
 	})
 }
 
 // GetUser 获取用户详情
 // @Summary 获取用户详情
-// @Description 根据ID获取用户详细信息（需要管理员权限）
+// @Description 根据ID获取用户详细信息（需要管理员权限），分组管理员只能获取同组用户
 // @Tags 用户管理
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
 // @Param id path int true "用户ID"
-// @Success 200 {object} models.User "用户信息"
+// @Success 200 {object} response.Envelope{data=UserResponse} "用户信息"
 // @Failure 401 {object} ErrorResponse "未授权"
 // @Failure 403 {object} ErrorResponse "权限不足"
 // @Failure 404 {object} ErrorResponse "用户不存在"
@@ -111,28 +120,24 @@ func (h *UserHandler) ListUsers(c *gin.Context) {
 func (h *UserHandler) GetUser(c *gin.Context) {
 	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Success: false,
-			Message: "Invalid user ID",
-		})
+		response.Error(c, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 	
+	scope, ok := h.currentUserScope(c)
+	if !ok {
+		return
+	}
+
 	var user models.User
-	if err := db.GetDB().Preload("Role").First(&user, userID).Error; err != nil {
+	if err := scopeUsers(db.GetDB(), scope).Preload("Role").First(&user, userID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, ErrorResponse{
-				Success: false,
-				Message: "User not found",
-			})
+			response.Error(c, http.StatusNotFound, "User not found")
 			return
 		}
 		
 		h.logger.Error("Failed to get user", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Success: false,
-			Message: "Failed to get user",
-		})
+		response.Error(c, http.StatusInternalServerError, "Failed to get user")
 		return
 	}
 	
@@ -140,22 +145,21 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 	user.Password = ""
 	user.Token = ""
 	
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"user":    user,
+	response.OK(c, UserResponse{
+		User: &user,
 	})
 }
 
 // CreateUser 创建用户
 // @Summary 创建用户
-// @Description 创建新用户（需要管理员权限）
+// @Description 创建新用户（需要管理员权限），分组管理员创建的用户属于其分组
 // @Tags 用户管理
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
 // @Param request body models.CreateUserRequest true "用户信息"
-// @Success 200 {object} models.User "创建的用户"
-// @Failure 400 {object} ErrorResponse "请求参数错误"
+// @Success 200 {object} response.Envelope{data=UserResponse} "创建的用户"
+// @Failure 400 {object} PasswordPolicyErrorResponse "请求参数错误或密码不符合密码策略"
 // @Failure 401 {object} ErrorResponse "未授权"
 // @Failure 403 {object} ErrorResponse "权限不足"
 // @Failure 409 {object} ErrorResponse "用户已存在"
@@ -164,54 +168,53 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 	var req models.CreateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		h.logger.Error("Invalid create user request", zap.Error(err))
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Success: false,
-			Message: "Invalid request data",
-		})
+		response.Error(c, http.StatusBadRequest, "Invalid request data")
 		return
 	}
 	
 	// 检查邮箱是否已存在
 	var existingUser models.User
 	if err := db.GetDB().Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
-		c.JSON(http.StatusConflict, ErrorResponse{
-			Success: false,
-			Message: "Email already exists",
-		})
+		response.Error(c, http.StatusConflict, "Email already exists")
 		return
 	}
 	
 	// 获取角色
-	var role models.Role
-	if req.RoleName != "" {
-		if err := db.GetDB().Where("name = ?", req.RoleName).First(&role).Error; err != nil {
+	role, err := findRole(req.RoleName)
+	if err != nil {
+		if req.RoleName != "" {
 			h.logger.Error("Failed to find role", zap.Error(err), zap.String("role", req.RoleName))
-			c.JSON(http.StatusBadRequest, ErrorResponse{
-				Success: false,
-				Message: "Invalid role",
-			})
-			return
-		}
-	} else {
-		// 默认角色为user
-		if err := db.GetDB().Where("name = ?", "user").First(&role).Error; err != nil {
-			h.logger.Error("Failed to find default role", zap.Error(err))
-			c.JSON(http.StatusInternalServerError, ErrorResponse{
-				Success: false,
-				Message: "Failed to find default role",
-			})
+			response.Error(c, http.StatusBadRequest, "Invalid role")
 			return
 		}
+		h.logger.Error("Failed to find default role", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to find default role")
+		return
 	}
 	
+	if respondWeakPassword(c, auth.ValidatePassword(req.Password)) {
+		return
+	}
+
+	scope, ok := h.currentUserScope(c)
+	if !ok {
+		return
+	}
+	group, err := resolveUserGroup(scope, req.Group)
+	if err != nil {
+		response.Error(c, http.StatusForbidden, "Cannot create users outside your group")
+		return
+	}
+	if !canAssignRole(scope, role) {
+		response.Error(c, http.StatusForbidden, "Cannot assign a role above your own")
+		return
+	}
+
 	// 创建用户
 	hashedPassword, err := auth.HashPassword(req.Password)
 	if err != nil {
 		h.logger.Error("Failed to hash password", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Success: false,
-			Message: "Failed to process password",
-		})
+		response.Error(c, http.StatusInternalServerError, "Failed to process password")
 		return
 	}
 	
@@ -221,6 +224,7 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		Password: hashedPassword,
 		RoleID:   role.ID,
 		Status:   req.Status,
+		Group:    group,
 	}
 	
 	if user.Status == "" {
@@ -229,10 +233,7 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 	
 	if err := db.GetDB().Create(&user).Error; err != nil {
 		h.logger.Error("Failed to create user", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Success: false,
-			Message: "Failed to create user",
-		})
+		response.Error(c, http.StatusInternalServerError, "Failed to create user")
 		return
 	}
 	
@@ -245,23 +246,32 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 	user.Password = ""
 	
 	h.logger.Info("User created successfully", zap.String("email", user.Email))
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"user":    user,
+	response.OK(c, UserResponse{
+		User: &user,
 	})
 }
 
+// findRole 按名称查找角色，名称为空时返回默认的 user 角色
+func findRole(roleName string) (models.Role, error) {
+	if roleName == "" {
+		roleName = "user"
+	}
+	var role models.Role
+	err := db.GetDB().Where("name = ?", roleName).First(&role).Error
+	return role, err
+}
+
 // UpdateUser 更新用户
 // @Summary 更新用户信息
-// @Description 更新用户信息（需要管理员权限）
+// @Description 更新用户信息（需要管理员权限），分组管理员只能更新同组用户且不能修改分组
 // @Tags 用户管理
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
 // @Param id path int true "用户ID"
 // @Param request body models.UpdateUserRequest true "更新信息"
-// @Success 200 {object} models.User "更新后的用户"
-// @Failure 400 {object} ErrorResponse "请求参数错误"
+// @Success 200 {object} response.Envelope{data=UserResponse} "更新后的用户"
+// @Failure 400 {object} PasswordPolicyErrorResponse "请求参数错误或密码不符合密码策略"
 // @Failure 401 {object} ErrorResponse "未授权"
 // @Failure 403 {object} ErrorResponse "权限不足"
 // @Failure 404 {object} ErrorResponse "用户不存在"
@@ -269,39 +279,32 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 func (h *UserHandler) UpdateUser(c *gin.Context) {
 	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Success: false,
-			Message: "Invalid user ID",
-		})
+		response.Error(c, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 	
 	var req models.UpdateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		h.logger.Error("Invalid update user request", zap.Error(err))
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Success: false,
-			Message: "Invalid request data",
-		})
+		response.Error(c, http.StatusBadRequest, "Invalid request data")
 		return
 	}
 	
+	scope, ok := h.currentUserScope(c)
+	if !ok {
+		return
+	}
+
 	// 获取用户
 	var user models.User
-	if err := db.GetDB().First(&user, userID).Error; err != nil {
+	if err := scopeUsers(db.GetDB(), scope).First(&user, userID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, ErrorResponse{
-				Success: false,
-				Message: "User not found",
-			})
+			response.Error(c, http.StatusNotFound, "User not found")
 			return
 		}
 		
 		h.logger.Error("Failed to get user", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Success: false,
-			Message: "Failed to get user",
-		})
+		response.Error(c, http.StatusInternalServerError, "Failed to get user")
 		return
 	}
 	
@@ -316,23 +319,20 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		// 检查邮箱是否已被使用
 		var existingUser models.User
 		if err := db.GetDB().Where("email = ? AND id != ?", req.Email, userID).First(&existingUser).Error; err == nil {
-			c.JSON(http.StatusConflict, ErrorResponse{
-				Success: false,
-				Message: "Email already exists",
-			})
+			response.Error(c, http.StatusConflict, "Email already exists")
 			return
 		}
 		updates["email"] = req.Email
 	}
 	
 	if req.Password != "" {
+		if respondWeakPassword(c, auth.ValidatePassword(req.Password)) {
+			return
+		}
 		hashedPassword, err := auth.HashPassword(req.Password)
 		if err != nil {
 			h.logger.Error("Failed to hash password", zap.Error(err))
-			c.JSON(http.StatusInternalServerError, ErrorResponse{
-				Success: false,
-				Message: "Failed to process password",
-			})
+			response.Error(c, http.StatusInternalServerError, "Failed to process password")
 			return
 		}
 		updates["password"] = hashedPassword
@@ -342,10 +342,11 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		var role models.Role
 		if err := db.GetDB().Where("name = ?", req.RoleName).First(&role).Error; err != nil {
 			h.logger.Error("Failed to find role", zap.Error(err), zap.String("role", req.RoleName))
-			c.JSON(http.StatusBadRequest, ErrorResponse{
-				Success: false,
-				Message: "Invalid role",
-			})
+			response.Error(c, http.StatusBadRequest, "Invalid role")
+			return
+		}
+		if !canAssignRole(scope, role) {
+			response.Error(c, http.StatusForbidden, "Cannot assign a role above your own")
 			return
 		}
 		updates["role_id"] = role.ID
@@ -354,14 +355,19 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 	if req.Status != "" {
 		updates["status"] = req.Status
 	}
+
+	if req.Group != nil && *req.Group != user.Group {
+		if !scope.all {
+			response.Error(c, http.StatusForbidden, "Only super admins can change user groups")
+			return
+		}
+		updates["user_group"] = *req.Group
+	}
 	
 	// 执行更新
 	if err := db.GetDB().Model(&user).Updates(updates).Error; err != nil {
 		h.logger.Error("Failed to update user", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Success: false,
-			Message: "Failed to update user",
-		})
+		response.Error(c, http.StatusInternalServerError, "Failed to update user")
 		return
 	}
 	
@@ -375,21 +381,20 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 	user.Token = ""
 	
 	h.logger.Info("User updated successfully", zap.Uint("user_id", uint(userID)))
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"user":    user,
+	response.OK(c, UserResponse{
+		User: &user,
 	})
 }
 
 // DeleteUser 删除用户
 // @Summary 删除用户
-// @Description 删除指定用户（需要管理员权限）
+// @Description 删除指定用户（需要管理员权限），分组管理员只能删除同组用户
 // @Tags 用户管理
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
 // @Param id path int true "用户ID"
-// @Success 200 {object} SuccessResponse "删除成功"
+// @Success 200 {object} response.Envelope{data=SuccessResponse} "删除成功"
 // @Failure 400 {object} ErrorResponse "请求参数错误"
 // @Failure 401 {object} ErrorResponse "未授权"
 // @Failure 403 {object} ErrorResponse "权限不足"
@@ -398,68 +403,57 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 func (h *UserHandler) DeleteUser(c *gin.Context) {
 	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Success: false,
-			Message: "Invalid user ID",
-		})
+		response.Error(c, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 	
 	// 不允许删除ID为1的管理员
 	if userID == 1 {
-		c.JSON(http.StatusForbidden, ErrorResponse{
-			Success: false,
-			Message: "Cannot delete primary admin user",
-		})
+		response.Error(c, http.StatusForbidden, "Cannot delete primary admin user")
 		return
 	}
 	
 	// 不允许用户删除自己
 	currentUserID, _ := c.Get("user_id")
 	if uint(userID) == currentUserID.(uint) {
-		c.JSON(http.StatusForbidden, ErrorResponse{
-			Success: false,
-			Message: "Cannot delete your own account",
-		})
+		response.Error(c, http.StatusForbidden, "Cannot delete your own account")
 		return
 	}
 	
+	scope, ok := h.currentUserScope(c)
+	if !ok {
+		return
+	}
+
 	// 执行删除
-	result := db.GetDB().Delete(&models.User{}, userID)
+	result := scopeUsers(db.GetDB(), scope).Delete(&models.User{}, userID)
 	if result.Error != nil {
 		h.logger.Error("Failed to delete user", zap.Error(result.Error))
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Success: false,
-			Message: "Failed to delete user",
-		})
+		response.Error(c, http.StatusInternalServerError, "Failed to delete user")
 		return
 	}
 	
 	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, ErrorResponse{
-			Success: false,
-			Message: "User not found",
-		})
+		response.Error(c, http.StatusNotFound, "User not found")
 		return
 	}
 	
 	h.logger.Info("User deleted successfully", zap.Uint("user_id", uint(userID)))
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "User deleted successfully",
+	response.OK(c, SuccessResponse{
+		Message: "User deleted successfully",
 	})
 }
 
 // UpdateUserStatus 更新用户状态
 // @Summary 更新用户状态
-// @Description 激活或禁用用户（需要管理员权限）
+// @Description 激活或禁用用户（需要管理员权限），分组管理员只能修改同组用户
 // @Tags 用户管理
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
 // @Param id path int true "用户ID"
 // @Param request body models.UpdateUserStatusRequest true "状态信息"
-// @Success 200 {object} SuccessResponse "更新成功"
+// @Success 200 {object} response.Envelope{data=SuccessResponse} "更新成功"
 // @Failure 400 {object} ErrorResponse "请求参数错误"
 // @Failure 401 {object} ErrorResponse "未授权"
 // @Failure 403 {object} ErrorResponse "权限不足"
@@ -468,47 +462,37 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 func (h *UserHandler) UpdateUserStatus(c *gin.Context) {
 	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Success: false,
-			Message: "Invalid user ID",
-		})
+		response.Error(c, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 	
 	var req models.UpdateUserStatusRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		h.logger.Error("Invalid update status request", zap.Error(err))
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Success: false,
-			Message: "Invalid request data",
-		})
+		response.Error(c, http.StatusBadRequest, "Invalid request data")
 		return
 	}
 	
 	if req.Status != "active" && req.Status != "inactive" {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Success: false,
-			Message: "Invalid status value",
-		})
+		response.Error(c, http.StatusBadRequest, "Invalid status value")
 		return
 	}
 	
+	scope, ok := h.currentUserScope(c)
+	if !ok {
+		return
+	}
+
 	// 更新状态
-	result := db.GetDB().Model(&models.User{}).Where("id = ?", userID).Update("status", req.Status)
+	result := scopeUsers(db.GetDB().Model(&models.User{}), scope).Where("id = ?", userID).Update("status", req.Status)
 	if result.Error != nil {
 		h.logger.Error("Failed to update user status", zap.Error(result.Error))
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Success: false,
-			Message: "Failed to update user status",
-		})
+		response.Error(c, http.StatusInternalServerError, "Failed to update user status")
 		return
 	}
 	
 	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, ErrorResponse{
-			Success: false,
-			Message: "User not found",
-		})
+		response.Error(c, http.StatusNotFound, "User not found")
 		return
 	}
 	
@@ -516,8 +500,7 @@ func (h *UserHandler) UpdateUserStatus(c *gin.Context) {
 		zap.Uint("user_id", uint(userID)),
 		zap.String("status", req.Status))
 		
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "User status updated successfully",
+	response.OK(c, SuccessResponse{
+		Message: "User status updated successfully",
 	})
 }
\ No newline at end of file
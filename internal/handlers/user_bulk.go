@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"eino-rag/internal/auth"
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+	"eino-rag/internal/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 批量创建结果状态
+const (
+	bulkUserCreated = "created"
+	bulkUserSkipped = "skipped"
+	bulkUserFailed  = "failed"
+)
+
+// BulkCreateUsers 批量创建用户
+// @Summary 批量创建用户
+// @Description 批量导入用户（需要管理员权限），分组管理员导入的用户属于其分组。每个用户单独校验，邮箱已存在的跳过，未提供密码时生成随机密码并在结果中返回；通过校验的用户在同一个事务中创建
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body models.BulkCreateUsersRequest true "用户列表，最多100个"
+// @Success 200 {object} response.Envelope{data=BulkCreateUsersResponse} "每个用户的创建结果"
+// @Failure 400 {object} ErrorResponse "请求参数错误"
+// @Failure 401 {object} ErrorResponse "未授权"
+// @Failure 403 {object} ErrorResponse "权限不足"
+// @Router /api/users/bulk [post]
+func (h *UserHandler) BulkCreateUsers(c *gin.Context) {
+	var req models.BulkCreateUsersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Error("Invalid bulk create users request", zap.Error(err))
+		response.Error(c, http.StatusBadRequest, "Invalid request data")
+		return
+	}
+
+	scope, ok := h.currentUserScope(c)
+	if !ok {
+		return
+	}
+
+	results := make([]BulkUserResult, len(req.Users))
+	var pending []int // 通过校验、待创建的用户下标
+	users := make([]models.User, len(req.Users))
+	seen := make(map[string]bool, len(req.Users))
+	roles := make(map[string]models.Role)
+
+	for i, entry := range req.Users {
+		results[i] = BulkUserResult{Index: i, Email: entry.Email}
+
+		if err := binding.Validator.ValidateStruct(entry); err != nil {
+			results[i].Status = bulkUserFailed
+			results[i].Message = err.Error()
+			continue
+		}
+
+		// 邮箱在本次请求中重复或已存在时跳过
+		if seen[entry.Email] {
+			results[i].Status = bulkUserSkipped
+			results[i].Message = "Duplicate email in request"
+			continue
+		}
+		seen[entry.Email] = true
+
+		var existing int64
+		if err := db.GetDB().Model(&models.User{}).Where("email = ?", entry.Email).Count(&existing).Error; err != nil {
+			h.logger.Error("Failed to check existing user", zap.Error(err))
+			results[i].Status = bulkUserFailed
+			results[i].Message = "Failed to check existing user"
+			continue
+		}
+		if existing > 0 {
+			results[i].Status = bulkUserSkipped
+			results[i].Message = "Email already exists"
+			continue
+		}
+
+		group, err := resolveUserGroup(scope, entry.Group)
+		if err != nil {
+			results[i].Status = bulkUserFailed
+			results[i].Message = "Cannot create users outside your group"
+			continue
+		}
+
+		role, ok := roles[entry.RoleName]
+		if !ok {
+			var err error
+			role, err = findRole(entry.RoleName)
+			if err != nil {
+				results[i].Status = bulkUserFailed
+				if entry.RoleName != "" {
+					results[i].Message = "Invalid role"
+				} else {
+					results[i].Message = "Failed to find default role"
+				}
+				continue
+			}
+			roles[entry.RoleName] = role
+		}
+		if !canAssignRole(scope, role) {
+			results[i].Status = bulkUserFailed
+			results[i].Message = "Cannot assign a role above your own"
+			continue
+		}
+
+		password := entry.Password
+		if password == "" {
+			generated, err := auth.CurrentPasswordPolicy().GeneratePassword()
+			if err != nil {
+				h.logger.Error("Failed to generate password", zap.Error(err))
+				results[i].Status = bulkUserFailed
+				results[i].Message = "Failed to generate password"
+				continue
+			}
+			password = generated
+			results[i].GeneratedPassword = generated
+		} else if err := auth.ValidatePassword(password); err != nil {
+			results[i].Status = bulkUserFailed
+			results[i].Message = err.Error()
+			continue
+		}
+
+		hashedPassword, err := auth.HashPassword(password)
+		if err != nil {
+			h.logger.Error("Failed to hash password", zap.Error(err))
+			results[i].Status = bulkUserFailed
+			results[i].Message = "Failed to process password"
+			results[i].GeneratedPassword = ""
+			continue
+		}
+
+		users[i] = models.User{
+			Name:     entry.Name,
+			Email:    entry.Email,
+			Password: hashedPassword,
+			RoleID:   role.ID,
+			Status:   entry.Status,
+			Group:    group,
+		}
+		if users[i].Status == "" {
+			users[i].Status = "active"
+		}
+		pending = append(pending, i)
+	}
+
+	// 通过校验的用户在同一个事务中创建，任一失败则全部回滚
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		for _, i := range pending {
+			if err := tx.Create(&users[i]).Error; err != nil {
+				return fmt.Errorf("failed to create user %s: %w", users[i].Email, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		h.logger.Error("Failed to bulk create users", zap.Error(err))
+		response.Error(c, http.StatusInternalServerError, "Failed to create users, no users were created")
+		return
+	}
+
+	for _, i := range pending {
+		user := users[i]
+		role := roles[req.Users[i].RoleName]
+		user.Role = &role
+		user.RoleName = role.Name
+		results[i].Status = bulkUserCreated
+		results[i].User = &user
+	}
+
+	resp := BulkCreateUsersResponse{Results: results}
+	for _, result := range results {
+		switch result.Status {
+		case bulkUserCreated:
+			resp.Created++
+		case bulkUserSkipped:
+			resp.Skipped++
+		default:
+			resp.Failed++
+		}
+	}
+
+	h.logger.Info("Bulk user creation completed",
+		zap.Int("created", resp.Created),
+		zap.Int("skipped", resp.Skipped),
+		zap.Int("failed", resp.Failed))
+	response.OK(c, resp)
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 用户管理范围
+//
+// 用户可以属于一个分组（group）。角色等级为0的超级管理员可以管理所有用户并为用户分配分组。
+// 其他可以访问用户管理接口的角色（如 group_admin）只能查看和管理同一分组的用户，未分配分组时只能管理
+// 未分组的用户；创建的用户自动加入其分组，不能修改用户的分组，也不能分配比自己等级更高的角色；
+// 范围外的用户按不存在处理。默认的 admin 角色等级为0，没有配置分组管理员时行为与之前相同。
+
+// errUserScopeForbidden 分组管理员尝试把用户放到自己的分组之外
+var errUserScopeForbidden = errors.New("group admins cannot assign users to another group")
+
+// userManageScope 当前管理员可管理的用户范围
+type userManageScope struct {
+	all   bool   // 超级管理员，可管理所有用户
+	group string // 非超级管理员所在的分组
+	level int    // 当前管理员的角色等级
+}
+
+// userScope 返回当前管理员可管理的用户范围
+func userScope(c *gin.Context) (userManageScope, error) {
+	var admin models.User
+	if err := db.GetDB().Preload("Role").Select("id", "role_id", "user_group").First(&admin, c.GetUint("user_id")).Error; err != nil {
+		return userManageScope{}, fmt.Errorf("failed to get current user: %w", err)
+	}
+	if admin.Role == nil {
+		return userManageScope{}, fmt.Errorf("current user %d has no role", admin.ID)
+	}
+	return userManageScope{
+		all:   admin.Role.Level == 0,
+		group: admin.Group,
+		level: admin.Role.Level,
+	}, nil
+}
+
+// scopeUsers 将用户查询限制在管理范围内，分组管理员看不到同组中等级比自己高的用户
+func scopeUsers(query *gorm.DB, scope userManageScope) *gorm.DB {
+	if scope.all {
+		return query
+	}
+	roles := db.GetDB().Model(&models.Role{}).Select("id").Where("level >= ?", scope.level)
+	return query.Where("user_group = ? AND role_id IN (?)", scope.group, roles)
+}
+
+// resolveUserGroup 返回新用户的分组，分组管理员只能使用自己的分组，未指定时默认为当前管理员的分组
+func resolveUserGroup(scope userManageScope, requested string) (string, error) {
+	if requested == "" {
+		return scope.group, nil
+	}
+	if !scope.all && requested != scope.group {
+		return "", errUserScopeForbidden
+	}
+	return requested, nil
+}
+
+// canAssignRole 分组管理员只能分配等级不高于自己的角色
+func canAssignRole(scope userManageScope, role models.Role) bool {
+	return scope.all || role.Level >= scope.level
+}
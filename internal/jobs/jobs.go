@@ -0,0 +1,269 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// 后台任务
+//
+// 批量重建索引等耗时较长的管理操作在后台执行，通过 Manager 记录进度，
+// 调用方可以查询任务状态或订阅进度更新。任务状态只保存在当前进程的内存中，
+// 多副本部署时需要把请求发到启动任务的节点。
+
+// Status 任务状态
+type Status string
+
+const (
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+)
+
+// maxErrors 每个任务保留的最近错误条数
+const maxErrors = 20
+
+// retention 已结束的任务保留时长，超过后在启动新任务时清理
+const retention = time.Hour
+
+// Job 任务状态快照
+type Job struct {
+	ID         string      `json:"id" example:"5f0c7a1e-8d2b-4c3e-9a4f-1b2c3d4e5f60"`
+	Type       string      `json:"type" example:"rechunk_outdated"`
+	Status     Status      `json:"status" enums:"running,completed,failed" example:"running"`
+	Total      int         `json:"total" example:"1200"`
+	Processed  int         `json:"processed" example:"300"`
+	Failed     int         `json:"failed" example:"2"`
+	Percent    float64     `json:"percent" example:"25"`
+	Current    string      `json:"current,omitempty" example:"document 42"` // 正在处理的项目
+	Errors     []string    `json:"errors,omitempty"`                        // 最近的处理错误
+	Error      string      `json:"error,omitempty"`                         // 任务失败的原因
+	Result     interface{} `json:"result,omitempty" swaggertype:"object"`
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+}
+
+// Done 任务是否已结束
+func (j Job) Done() bool {
+	return j.Status != StatusRunning
+}
+
+// Reporter 接收批量操作的进度，批量操作在没有任务时可传入nil
+type Reporter interface {
+	// SetTotal 设置需要处理的项目总数
+	SetTotal(total int)
+	// Advance 记录一个项目处理完成，err 不为nil时计为失败
+	Advance(item string, err error)
+}
+
+// RunFunc 任务的执行函数，返回的结果保存在任务的 Result 中
+type RunFunc func(ctx context.Context, progress Reporter) (interface{}, error)
+
+type jobState struct {
+	job         Job
+	subscribers map[chan Job]struct{}
+}
+
+// Manager 管理后台任务的状态和订阅
+type Manager struct {
+	mu     sync.Mutex
+	jobs   map[string]*jobState
+	logger *zap.Logger
+}
+
+// NewManager 创建任务管理器
+func NewManager(logger *zap.Logger) *Manager {
+	return &Manager{
+		jobs:   make(map[string]*jobState),
+		logger: logger,
+	}
+}
+
+// Start 在后台启动任务并立即返回初始状态
+// 任务使用独立的上下文执行，不随发起请求的结束而取消
+func (m *Manager) Start(jobType string, run RunFunc) Job {
+	m.mu.Lock()
+	m.pruneLocked(time.Now())
+	state := &jobState{
+		job: Job{
+			ID:        uuid.New().String(),
+			Type:      jobType,
+			Status:    StatusRunning,
+			StartedAt: time.Now(),
+		},
+		subscribers: make(map[chan Job]struct{}),
+	}
+	m.jobs[state.job.ID] = state
+	job := state.job
+	m.mu.Unlock()
+
+	m.logger.Info("Background job started",
+		zap.String("job_id", job.ID),
+		zap.String("type", jobType))
+
+	go m.run(job.ID, run)
+	return job
+}
+
+// run 执行任务并记录最终状态
+func (m *Manager) run(id string, run RunFunc) {
+	var result interface{}
+	var err error
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("job panicked: %v", r)
+			}
+		}()
+		result, err = run(context.Background(), &progress{manager: m, id: id})
+	}()
+
+	m.update(id, func(job *Job) {
+		now := time.Now()
+		job.FinishedAt = &now
+		job.Current = ""
+		job.Result = result
+		if err != nil {
+			job.Status = StatusFailed
+			job.Error = err.Error()
+		} else {
+			job.Status = StatusCompleted
+			if job.Total > 0 {
+				job.Percent = 100
+			}
+		}
+	})
+
+	if err != nil {
+		m.logger.Error("Background job failed", zap.String("job_id", id), zap.Error(err))
+	} else {
+		m.logger.Info("Background job completed", zap.String("job_id", id))
+	}
+}
+
+// Get 返回任务的当前状态
+func (m *Manager) Get(id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return snapshot(state.job), true
+}
+
+// Subscribe 订阅任务的进度更新，返回当前状态和更新通道
+// 通道只保留最新的状态，任务结束后关闭；不再需要时调用 cancel 取消订阅
+func (m *Manager) Subscribe(id string) (Job, <-chan Job, func(), bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, ok := m.jobs[id]
+	if !ok {
+		return Job{}, nil, nil, false
+	}
+
+	ch := make(chan Job, 1)
+	if state.job.Done() {
+		close(ch)
+		return snapshot(state.job), ch, func() {}, true
+	}
+
+	state.subscribers[ch] = struct{}{}
+	cancel := func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if _, ok := state.subscribers[ch]; ok {
+			delete(state.subscribers, ch)
+			close(ch)
+		}
+	}
+	return snapshot(state.job), ch, cancel, true
+}
+
+// update 修改任务状态并通知订阅者，任务结束时关闭所有订阅通道
+func (m *Manager) update(id string, fn func(job *Job)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, ok := m.jobs[id]
+	if !ok {
+		return
+	}
+	fn(&state.job)
+
+	job := snapshot(state.job)
+	for ch := range state.subscribers {
+		// 订阅者来不及读取时丢弃旧状态，只保留最新的
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- job
+		if job.Done() {
+			close(ch)
+			delete(state.subscribers, ch)
+		}
+	}
+}
+
+// pruneLocked 清理结束时间超过保留时长的任务，调用方需持有锁
+func (m *Manager) pruneLocked(now time.Time) {
+	for id, state := range m.jobs {
+		if state.job.FinishedAt != nil && now.Sub(*state.job.FinishedAt) > retention {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+// snapshot 复制任务状态，避免订阅者与任务共享切片
+func snapshot(job Job) Job {
+	job.Errors = append([]string(nil), job.Errors...)
+	return job
+}
+
+// progress 将批量操作的进度写入任务状态
+type progress struct {
+	manager *Manager
+	id      string
+}
+
+func (p *progress) SetTotal(total int) {
+	p.manager.update(p.id, func(job *Job) {
+		job.Total = total
+		job.Percent = percent(job.Processed, total)
+	})
+}
+
+func (p *progress) Advance(item string, err error) {
+	p.manager.update(p.id, func(job *Job) {
+		job.Processed++
+		job.Current = item
+		if err != nil {
+			job.Failed++
+			job.Errors = append(job.Errors, fmt.Sprintf("%s: %v", item, err))
+			if len(job.Errors) > maxErrors {
+				job.Errors = job.Errors[len(job.Errors)-maxErrors:]
+			}
+		}
+		job.Percent = percent(job.Processed, job.Total)
+	})
+}
+
+// percent 计算完成百分比，保留一位小数
+func percent(processed, total int) float64 {
+	if total <= 0 {
+		return 0
+	}
+	p := float64(processed) * 100 / float64(total)
+	if p > 100 {
+		p = 100
+	}
+	return float64(int(p*10)) / 10
+}
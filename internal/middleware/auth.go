@@ -1,36 +1,50 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
 	"eino-rag/internal/auth"
+	"eino-rag/internal/response"
 
 	"github.com/gin-gonic/gin"
 )
 
-// AuthMiddleware JWT认证中间件
+// AuthMiddleware 认证中间件，接受 Bearer token（JWT）或 X-API-Key 头中的API密钥
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// API密钥解析为所属用户，上下文中的用户信息与token登录时相同
+		if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+			user, err := auth.ValidateAPIKey(apiKey)
+			if errors.Is(err, auth.ErrInvalidAPIKey) {
+				response.Abort(c, http.StatusUnauthorized, err.Error())
+				return
+			}
+			if err != nil {
+				response.Abort(c, http.StatusInternalServerError, "Failed to validate API key")
+				return
+			}
+
+			c.Set("user_id", user.ID)
+			c.Set("email", user.Email)
+			c.Set("role_name", user.RoleName)
+
+			c.Next()
+			return
+		}
+
 		// 获取Authorization header
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"success": false,
-				"message": "Authorization header required",
-			})
-			c.Abort()
+			response.Abort(c, http.StatusUnauthorized, "Authorization header required")
 			return
 		}
 
 		// 解析Bearer token
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"success": false,
-				"message": "Invalid authorization header format",
-			})
-			c.Abort()
+			response.Abort(c, http.StatusUnauthorized, "Invalid authorization header format")
 			return
 		}
 
@@ -39,11 +53,7 @@ func AuthMiddleware() gin.HandlerFunc {
 		// 验证token
 		claims, err := auth.ValidateToken(token)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"success": false,
-				"message": "Invalid or expired token",
-			})
-			c.Abort()
+			response.Abort(c, http.StatusUnauthorized, "Invalid or expired token")
 			return
 		}
 
@@ -61,11 +71,7 @@ func RequireRole(roles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		roleName, exists := c.Get("role_name")
 		if !exists {
-			c.JSON(http.StatusForbidden, gin.H{
-				"success": false,
-				"message": "Role information not found",
-			})
-			c.Abort()
+			response.Abort(c, http.StatusForbidden, "Role information not found")
 			return
 		}
 
@@ -81,11 +87,30 @@ func RequireRole(roles ...string) gin.HandlerFunc {
 		}
 
 		if !allowed {
-			c.JSON(http.StatusForbidden, gin.H{
-				"success": false,
-				"message": "Insufficient permissions",
-			})
-			c.Abort()
+			response.Abort(c, http.StatusForbidden, "Insufficient permissions")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePermission 权限中间件，按 token 中的角色检查 Role.Permissions 是否包含 permission
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roleName, exists := c.Get("role_name")
+		if !exists {
+			response.Abort(c, http.StatusForbidden, "Role information not found")
+			return
+		}
+
+		allowed, err := auth.CheckRolePermission(roleName.(string), permission)
+		if err != nil {
+			response.Abort(c, http.StatusInternalServerError, "Failed to check permissions")
+			return
+		}
+		if !allowed {
+			response.Abort(c, http.StatusForbidden, "Insufficient permissions")
 			return
 		}
 
@@ -0,0 +1,178 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"eino-rag/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 响应压缩
+//
+// 客户端在 Accept-Encoding 中声明 gzip 时，类型在 COMPRESSION_CONTENT_TYPES 中且达到 COMPRESSION_MIN_SIZE 字节的响应用 gzip 压缩。
+// 响应体先缓冲到最小长度再决定是否压缩，较小的响应原样返回。
+// 调用 Flush 的响应（SSE 流）需要逐段发送，一律不压缩；text/event-stream 也不应加入允许的类型。
+
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	},
+}
+
+// Compression gzip 响应压缩中间件，配置在每个请求时读取，可在运行时修改
+func Compression() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := config.Get().Snapshot()
+		if !cfg.CompressionEnabled || c.Request.Method == http.MethodHead || !acceptsGzip(c.Request) {
+			c.Next()
+			return
+		}
+
+		original := c.Writer
+		writer := &gzipResponseWriter{
+			ResponseWriter: original,
+			minSize:        cfg.CompressionMinSize,
+			contentTypes:   cfg.CompressionContentTypes,
+		}
+		c.Writer = writer
+		defer func() {
+			writer.finish()
+			c.Writer = original
+		}()
+
+		c.Next()
+	}
+}
+
+// acceptsGzip 判断请求是否接受 gzip 编码，q=0 表示明确拒绝
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		value, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q=")
+		if !ok {
+			return true
+		}
+		q, err := strconv.ParseFloat(value, 64)
+		return err == nil && q > 0
+	}
+	return false
+}
+
+// gzipResponseWriter 缓冲响应体直到能决定是否压缩，之后直接写出或经 gzip 写出
+type gzipResponseWriter struct {
+	gin.ResponseWriter
+	minSize      int
+	contentTypes []string
+
+	buf     bytes.Buffer
+	decided bool         // 是否已决定压缩与否，决定前响应体留在 buf 中
+	gz      *gzip.Writer // 决定压缩后不为nil
+}
+
+func (w *gzipResponseWriter) Write(data []byte) (int, error) {
+	if w.decided {
+		return w.writeDecided(data)
+	}
+	w.buf.Write(data)
+	if w.buf.Len() < w.minSize {
+		return len(data), nil
+	}
+	if err := w.decide(w.compressible()); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (w *gzipResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// WriteHeaderNow 立即发送响应头，之后无法再修改编码，响应不压缩
+func (w *gzipResponseWriter) WriteHeaderNow() {
+	if !w.decided {
+		w.decide(false)
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// Flush 需要逐段发送的响应不压缩
+func (w *gzipResponseWriter) Flush() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// compressible 按状态码、已有编码和响应类型判断是否可以压缩
+func (w *gzipResponseWriter) compressible() bool {
+	header := w.Header()
+	switch w.Status() {
+	case http.StatusNoContent, http.StatusNotModified, http.StatusPartialContent:
+		return false
+	}
+	if header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, allowed := range w.contentTypes {
+		if strings.EqualFold(mediaType, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// decide 决定是否压缩并写出已缓冲的内容
+func (w *gzipResponseWriter) decide(compress bool) error {
+	w.decided = true
+	if compress {
+		header := w.Header()
+		header.Set("Content-Encoding", "gzip")
+		header.Add("Vary", "Accept-Encoding")
+		header.Del("Content-Length")
+		w.gz = gzipWriterPool.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	_, err := w.writeDecided(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
+
+func (w *gzipResponseWriter) writeDecided(data []byte) (int, error) {
+	if w.gz != nil {
+		return w.gz.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// finish 请求处理结束后写出剩余内容，未达到最小长度的响应原样写出
+func (w *gzipResponseWriter) finish() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.gz != nil {
+		w.gz.Close()
+		gzipWriterPool.Put(w.gz)
+		w.gz = nil
+	}
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BlockDuringMaintenance 维护模式下拒绝写操作的中间件，返回503
+// 只挂在上传、删除和修改配置等写接口上；读取维护状态失败时放行请求，避免Redis故障阻断写操作
+func BlockDuringMaintenance() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), rateLimitTimeout)
+		defer cancel()
+
+		state, err := db.GetMaintenance(ctx)
+		if err != nil || !state.Enabled {
+			c.Next()
+			return
+		}
+
+		message := "Service is in maintenance mode, write operations are temporarily disabled"
+		if state.Reason != "" {
+			message += ": " + state.Reason
+		}
+		response.Abort(c, http.StatusServiceUnavailable, message)
+	}
+}
@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/db"
+	"eino-rag/internal/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// rateLimitTimeout 单次限流计数的Redis操作超时
+const rateLimitTimeout = 500 * time.Millisecond
+
+// AuthRateLimit 匿名认证接口限流中间件，按客户端IP和全局两个维度计数
+// 计数存放在Redis中以便多副本共享，Redis不可用时放行请求
+func AuthRateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := config.Get().Snapshot()
+		window := cfg.AuthRateLimitWindow
+		rdb := db.GetRedis()
+		if rdb == nil || window <= 0 || (cfg.AuthRateLimitPerIP <= 0 && cfg.AuthRateLimitGlobal <= 0) {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), rateLimitTimeout)
+		defer cancel()
+
+		// 固定窗口：同一窗口内的请求共享同一个计数键
+		slot := time.Now().Unix() / int64(window.Seconds())
+
+		if cfg.AuthRateLimitPerIP > 0 {
+			key := fmt.Sprintf("ratelimit:auth:ip:%s:%d", c.ClientIP(), slot)
+			if retryAfter, limited := hitLimit(ctx, rdb, key, cfg.AuthRateLimitPerIP, window); limited {
+				abortRateLimited(c, retryAfter)
+				return
+			}
+		}
+
+		if cfg.AuthRateLimitGlobal > 0 {
+			key := fmt.Sprintf("ratelimit:auth:global:%d", slot)
+			if retryAfter, limited := hitLimit(ctx, rdb, key, cfg.AuthRateLimitGlobal, window); limited {
+				abortRateLimited(c, retryAfter)
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// chatTraceWindow 对话追踪接口的限流窗口
+const chatTraceWindow = time.Minute
+
+// ChatTraceRateLimit 对话追踪接口按用户限流，每分钟最多 CHAT_TRACE_RATE_LIMIT 次，<=0 时关闭该接口
+// 需在认证之后使用；Redis不可用时放行请求
+func ChatTraceRateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := config.Get().Snapshot().ChatTraceRateLimit
+		if limit <= 0 {
+			response.Abort(c, http.StatusForbidden, "Chat trace is disabled")
+			return
+		}
+		rdb := db.GetRedis()
+		if rdb == nil {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), rateLimitTimeout)
+		defer cancel()
+
+		slot := time.Now().Unix() / int64(chatTraceWindow.Seconds())
+		key := fmt.Sprintf("ratelimit:chat-trace:user:%d:%d", c.GetUint("user_id"), slot)
+		if retryAfter, limited := hitLimit(ctx, rdb, key, limit, chatTraceWindow); limited {
+			abortRateLimited(c, retryAfter)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// hitLimit 计数加一并判断是否超过上限，超限时返回距窗口结束的时间
+func hitLimit(ctx context.Context, rdb *redis.Client, key string, limit int, window time.Duration) (time.Duration, bool) {
+	pipe := rdb.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	ttl := pipe.TTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, false
+	}
+
+	// 首次计数或过期时间丢失时设置过期，避免计数键永久残留
+	if incr.Val() == 1 || ttl.Val() < 0 {
+		rdb.Expire(ctx, key, window)
+	}
+
+	if incr.Val() <= int64(limit) {
+		return 0, false
+	}
+
+	retryAfter := ttl.Val()
+	if retryAfter <= 0 {
+		retryAfter = window
+	}
+	return retryAfter, true
+}
+
+// abortRateLimited 返回429并设置Retry-After头（秒）
+func abortRateLimited(c *gin.Context, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	response.Abort(c, http.StatusTooManyRequests, "Too many requests, please try again later")
+}
@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 请求超时
+//
+// RequestTimeout 给请求的 context 设置截止时间（REQUEST_TIMEOUT），数据库、Milvus、模型调用等使用请求 context 的下游操作
+// 到期后被取消。处理函数在到期之后才写响应、或者没有写响应时返回 504；到期前已经开始写的响应不受影响。
+// 不检查 context 的操作无法被打断，超时在处理函数返回后才生效。
+// 上传、批量任务等耗时较长的接口用 LongRequestTimeout 改用 REQUEST_TIMEOUT_LONG，流式接口和下载用 NoRequestTimeout 不设截止时间；
+// 覆盖只在挂了 RequestTimeout 的路由组内生效，截止时间都从请求开始计算。
+
+// requestDeadlineKey 当前请求超时设置在 gin.Context 中的键
+const requestDeadlineKey = "request_deadline"
+
+// requestDeadline 一个请求的超时设置
+type requestDeadline struct {
+	parent  context.Context // 设置截止时间之前的请求 context，覆盖时从它重新派生
+	timeout time.Duration   // 当前生效的超时，0 表示不限制
+}
+
+// RequestTimeout 按 REQUEST_TIMEOUT 给请求设置截止时间，到期后返回 504，<=0 表示不限制
+func RequestTimeout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deadline := &requestDeadline{parent: c.Request.Context()}
+		c.Set(requestDeadlineKey, deadline)
+		c.Writer = &timeoutWriter{ResponseWriter: c.Writer, c: c, deadline: deadline}
+		runWithTimeout(c, deadline, config.Get().Snapshot().RequestTimeout)
+	}
+}
+
+// LongRequestTimeout 把当前路由的超时改为 REQUEST_TIMEOUT_LONG，用于上传、批量任务等耗时较长的接口
+func LongRequestTimeout() gin.HandlerFunc {
+	return overrideRequestTimeout(func(cfg *config.Config) time.Duration {
+		return cfg.LongRequestTimeout
+	})
+}
+
+// NoRequestTimeout 取消当前路由的超时，用于流式响应和下载
+func NoRequestTimeout() gin.HandlerFunc {
+	return overrideRequestTimeout(func(*config.Config) time.Duration {
+		return 0
+	})
+}
+
+// overrideRequestTimeout 用 timeout 返回的超时替换路由组设置的超时
+func overrideRequestTimeout(timeout func(cfg *config.Config) time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, ok := c.Get(requestDeadlineKey)
+		if !ok {
+			c.Next()
+			return
+		}
+		runWithTimeout(c, value.(*requestDeadline), timeout(config.Get().Snapshot()))
+	}
+}
+
+// runWithTimeout 以截止时间为 timeout 的 context 执行后续处理，处理函数到期后没有写响应时返回 504
+func runWithTimeout(c *gin.Context, deadline *requestDeadline, timeout time.Duration) {
+	ctx, cancel := deadline.parent, context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(deadline.parent, timeout)
+	}
+	defer cancel()
+	deadline.timeout = max(timeout, 0)
+	c.Request = c.Request.WithContext(ctx)
+
+	c.Next()
+
+	if !c.Writer.Written() && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		// 经过 timeoutWriter 写入，响应被替换为 504
+		c.Writer.WriteHeaderNow()
+	}
+}
+
+// timeoutWriter 请求到期后把处理函数写入的响应替换为 504，并丢弃之后写入的内容
+type timeoutWriter struct {
+	gin.ResponseWriter
+	c        *gin.Context
+	deadline *requestDeadline
+	timedOut bool
+}
+
+// expired 请求已经到期且响应还没开始写时写入 504，返回处理函数的内容是否应被丢弃
+func (w *timeoutWriter) expired() bool {
+	if w.timedOut {
+		return true
+	}
+	if w.ResponseWriter.Written() || !errors.Is(w.c.Request.Context().Err(), context.DeadlineExceeded) {
+		return false
+	}
+
+	w.timedOut = true
+	body, _ := json.Marshal(response.Envelope{
+		Success: false,
+		Error:   fmt.Sprintf("Request timed out after %s", w.deadline.timeout),
+	})
+	header := w.ResponseWriter.Header()
+	header.Del("Content-Length")
+	header.Del("Content-Disposition")
+	header.Set("Content-Type", "application/json; charset=utf-8")
+	w.ResponseWriter.WriteHeader(http.StatusGatewayTimeout)
+	w.ResponseWriter.Write(body)
+	return true
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	if w.expired() {
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	if w.expired() {
+		return len(s), nil
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	if !w.expired() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *timeoutWriter) Flush() {
+	if !w.expired() {
+		w.ResponseWriter.Flush()
+	}
+}
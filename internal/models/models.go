@@ -1,6 +1,8 @@
 package models
 
 import (
+	"fmt"
+	"sort"
 	"time"
 
 	"gorm.io/gorm"
@@ -20,6 +22,9 @@ type User struct {
 	LastLoginAt  *time.Time `json:"last_login_at"`
 	CreatedAt    time.Time  `json:"created_at"`
 	UpdatedAt    time.Time  `json:"updated_at"`
+
+	// Group 用户分组，为空表示不属于任何分组；非超级管理员只能管理同组用户
+	Group string `gorm:"column:user_group;size:100;index" json:"group,omitempty"`
 }
 
 // AfterFind hook to populate RoleName
@@ -41,15 +46,67 @@ type Role struct {
 }
 
 // KnowledgeBase 知识库表
+// 同一创建者的知识库名称唯一，软删除的知识库和对话附件知识库不参与唯一约束
 type KnowledgeBase struct {
-	ID          uint      `gorm:"primaryKey" json:"id"`
-	Name        string    `gorm:"size:200;not null" json:"name"`
-	DocCount    int       `gorm:"default:0" json:"doc_count"`
-	Description string    `gorm:"type:text" json:"description"`
-	CreatorID   uint      `json:"creator_id"`
-	Creator     *User     `gorm:"foreignKey:CreatorID" json:"creator,omitempty"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	Name        string `gorm:"size:200;not null;uniqueIndex:idx_kb_creator_name_unique,priority:2,where:deleted_at IS NULL AND (conversation_id IS NULL OR conversation_id = '')" json:"name"`
+	DocCount    int    `gorm:"default:0" json:"doc_count"`
+	Description string `gorm:"type:text" json:"description"`
+	CreatorID   uint   `gorm:"uniqueIndex:idx_kb_creator_name_unique,priority:1" json:"creator_id"`
+	Creator     *User  `gorm:"foreignKey:CreatorID" json:"creator,omitempty"`
+	DefaultTopK int    `gorm:"default:0" json:"default_top_k"` // 请求未指定时的检索数量，0 表示使用全局配置
+	// 时间衰减重排：新鲜度在最终分数中的权重 [0,1]，0 表示不启用
+	RecencyWeight float64 `gorm:"default:0" json:"recency_weight"`
+	// 新鲜度衰减到一半所需的天数，0 表示使用全局配置
+	RecencyHalfLifeDays float64 `gorm:"default:0" json:"recency_half_life_days"`
+	// 切分前删除页眉页脚等在多数页中重复出现的行
+	StripBoilerplate bool `gorm:"default:false" json:"strip_boilerplate"`
+	// 切分前删除匹配这些正则表达式的内容，与 StripBoilerplate 无关，配置即生效
+	BoilerplatePatterns []string `gorm:"serializer:json;type:text" json:"boilerplate_patterns,omitempty"`
+	// 切分前将这些类别的个人信息替换为占位符，为空表示不清理
+	PIIRedaction []string `gorm:"serializer:json;type:text" json:"pii_redaction,omitempty"`
+	// 文档保留天数，创建时间早于该期限的文档由后台任务删除或归档，0 表示永久保留
+	RetentionDays int `gorm:"default:0" json:"retention_days"`
+	// 文档超过保留期限时的处理方式，为空表示删除
+	RetentionAction RetentionAction `gorm:"size:20" json:"retention_action,omitempty"`
+	// 非空时为该对话的附件知识库，只在该对话中检索，不出现在知识库列表中
+	ConversationID string `gorm:"size:64;index" json:"conversation_id,omitempty"`
+	// 对话附件的过期时间，对话有新消息时延长，过期后由后台任务删除
+	ExpiresAt *time.Time `gorm:"index" json:"expires_at,omitempty"`
+	// 向量化时在分块前加上文档标题和所在章节，nil 表示使用全局配置
+	ContextualEmbedding *bool     `json:"contextual_embedding,omitempty"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+	// 软删除时间，删除后在宽限期内可以恢复，之后由清理任务永久删除
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty" swaggertype:"string"`
+}
+
+// RetentionAction 文档超过知识库保留期限时的处理方式
+type RetentionAction string
+
+const (
+	RetentionDelete  RetentionAction = "delete"  // 删除文档记录、分块和向量
+	RetentionArchive RetentionAction = "archive" // 删除分块和向量，保留文档记录和原文，状态改为 archived
+)
+
+// DocumentStatus 文档入库流水线状态
+type DocumentStatus string
+
+const (
+	DocumentStatusUploaded  DocumentStatus = "uploaded"  // 已上传，等待处理
+	DocumentStatusParsing   DocumentStatus = "parsing"   // 正在解析文件内容
+	DocumentStatusChunking  DocumentStatus = "chunking"  // 正在切分文本
+	DocumentStatusEmbedding DocumentStatus = "embedding" // 正在生成向量并写入向量库
+	DocumentStatusIndexed   DocumentStatus = "indexed"   // 已完成索引
+	DocumentStatusFailed    DocumentStatus = "failed"    // 处理失败，原因见 StatusMessage
+
+	DocumentStatusPartiallyIndexed DocumentStatus = "partially_indexed" // 已索引，但部分分块向量化失败被跳过
+	DocumentStatusArchived         DocumentStatus = "archived"          // 超过知识库保留期限已归档，不再参与检索
+)
+
+// IsIndexed 文档是否已写入向量库（包括部分索引），此类文档计入知识库文档数量
+func (s DocumentStatus) IsIndexed() bool {
+	return s == DocumentStatusIndexed || s == DocumentStatusPartiallyIndexed
 }
 
 // Document 文档表
@@ -59,11 +116,52 @@ type Document struct {
 	KnowledgeBase   *KnowledgeBase `gorm:"foreignKey:KnowledgeBaseID" json:"knowledge_base,omitempty"`
 	FileName        string         `gorm:"size:255;not null" json:"file_name"`
 	FileSize        int64          `json:"file_size"`
+	FileType        string         `gorm:"size:20" json:"file_type"` // 解析时使用的文件类型，扩展名缺失时由内容推断
 	Hash            string         `gorm:"size:64" json:"hash"`
-	CreatorID       uint           `json:"creator_id"`
-	Creator         *User          `gorm:"foreignKey:CreatorID" json:"creator,omitempty"`
-	CreatedAt       time.Time      `json:"created_at"`
-	UpdatedAt       time.Time      `json:"updated_at"`
+	NormalizedHash  string         `gorm:"size:64;index" json:"normalized_hash,omitempty"` // 规范化文本内容后的哈希，二进制文件与 Hash 相同
+	Status          DocumentStatus `gorm:"size:20;default:'indexed';index" json:"status"`
+	StatusMessage   string         `gorm:"type:text" json:"status_message,omitempty"`
+	Summary         string         `gorm:"type:text" json:"summary,omitempty"`
+	FailedChunks    int            `json:"failed_chunks,omitempty"`    // 向量化失败被跳过的分块数
+	TruncatedChunks int            `json:"truncated_chunks,omitempty"` // 超过分块数上限被丢弃的分块数
+	PageStart       int            `json:"page_start,omitempty"`       // PDF实际解析的起始页
+	PageEnd         int            `json:"page_end,omitempty"`         // PDF实际解析的结束页
+	TotalPages      int            `json:"total_pages,omitempty"`      // PDF总页数
+	// 入库前清理的个人信息类别及各类别的替换次数
+	Redactions map[string]int `gorm:"serializer:json;type:text" json:"redactions,omitempty"`
+	// 上传时保存的开头文本（PDF 为第一页），由预览接口返回
+	Preview string `gorm:"type:text" json:"-"`
+	// markdown frontmatter 中的标题、作者、标签和日期，可按标签过滤检索
+	Title        string     `gorm:"size:255" json:"title,omitempty"`
+	Author       string     `gorm:"size:255" json:"author,omitempty"`
+	Tags         []string   `gorm:"serializer:json;type:text" json:"tags,omitempty"`
+	DocumentDate *time.Time `json:"date,omitempty"`
+	// 所属知识库被软删除的时间，恢复知识库时清空；不为空的文档不参与检索
+	KnowledgeBaseDeletedAt *time.Time `gorm:"index" json:"kb_deleted_at,omitempty"`
+	// 索引时使用的分块参数，与当前配置不一致时需要重新索引
+	ChunkSize        int       `json:"chunk_size"`
+	ChunkOverlap     int       `json:"chunk_overlap"`
+	ChunkingStrategy string    `gorm:"size:20" json:"chunking_strategy"`
+	CreatorID        uint      `json:"creator_id"`
+	Creator          *User     `gorm:"foreignKey:CreatorID" json:"creator,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// DocumentChunk 文档分块表，保存切分后的内容以便重新索引
+type DocumentChunk struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	DocumentID uint      `gorm:"index;not null" json:"document_id"`
+	ChunkID    string    `gorm:"size:36;not null;index" json:"chunk_id"` // 向量库中的ID
+	ChunkIndex int       `json:"chunk_index"`
+	Content    string    `gorm:"type:text" json:"content"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// DocumentText 文档解析后的完整文本，分块配置变更时用于重新切分
+type DocumentText struct {
+	DocumentID uint   `gorm:"primaryKey" json:"document_id"`
+	Content    string `gorm:"type:text" json:"content"`
 }
 
 // ChatHistory Chat对话记录表
@@ -73,6 +171,8 @@ type ChatHistory struct {
 	User         *User     `gorm:"foreignKey:UserID" json:"user,omitempty"`
 	ConversationID string  `gorm:"size:36;not null" json:"conversation_id"` // UUID
 	Title        string    `gorm:"size:200" json:"title"`
+	Folder       string    `gorm:"size:100;index" json:"folder,omitempty"`
+	Tags         []string  `gorm:"serializer:json;type:text" json:"tags,omitempty"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
@@ -85,9 +185,44 @@ type SystemConfig struct {
 
 // ChatMessage Redis中存储的聊天消息
 type ChatMessage struct {
-	Role      string    `json:"role"`      // user/assistant
-	Content   string    `json:"content"`
-	Timestamp time.Time `json:"timestamp"`
+	Role           string           `json:"role"` // user/assistant
+	Content        string           `json:"content"`
+	Retrieval      *RetrievalParams `json:"retrieval,omitempty"`       // 生成该回复时使用的检索参数
+	Incomplete     bool             `json:"incomplete,omitempty"`      // 流式回复中途出错，内容不完整
+	ResponseFormat string           `json:"response_format,omitempty"` // 生成该回复时要求的格式：markdown/plain/json
+	Timestamp      time.Time        `json:"timestamp"`
+	Seq            int64            `json:"seq"` // 对话内单调递增的序号，在请求开始时分配，消息按序号排列
+	// 生成该回复时传给模型的停止序列和惩罚参数，未设置时为空
+	Generation *GenerationParams `json:"generation,omitempty"`
+}
+
+// GenerationParams 生成参数，随消息保存以便复现；只记录实际传给模型的参数
+type GenerationParams struct {
+	Stop             []string `json:"stop,omitempty"`
+	PresencePenalty  *float32 `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float32 `json:"frequency_penalty,omitempty"`
+}
+
+// RetrievalParams 检索参数，随消息保存以便复现
+type RetrievalParams struct {
+	KnowledgeBaseID     uint       `json:"kb_id"`
+	TopK                int        `json:"top_k"`
+	ScoreThreshold      float32    `json:"score_threshold"`
+	ContextWindow       int        `json:"context_window,omitempty"`
+	SearchEffort        int        `json:"search_effort,omitempty"`
+	RecencyWeight       float64    `json:"recency_weight,omitempty"`         // 时间衰减重排权重，0 表示不启用
+	RecencyHalfLifeDays float64    `json:"recency_half_life_days,omitempty"` // 时间衰减半衰期（天）
+	MaxChunksPerDoc     int        `json:"max_chunks_per_doc,omitempty"`     // 每个文档最多检索的分块数，0 表示不限制
+	CreatorID           uint       `json:"creator_id,omitempty"`             // 只检索该用户创建的文档
+	CreatedAfter        *time.Time `json:"created_after,omitempty"`          // 只检索在此时间及之后创建的文档
+	CreatedBefore       *time.Time `json:"created_before,omitempty"`         // 只检索在此时间之前创建的文档
+	ToolCalling         bool       `json:"tool_calling,omitempty"`           // 由模型通过工具调用决定何时检索
+	// 对话附件所在的知识库，与 KnowledgeBaseID 一起检索，0 表示对话没有附件
+	AttachmentKnowledgeBaseID uint `json:"attachment_kb_id,omitempty"`
+	// 启用重排或筛选时多召回的倍数，0 表示使用配置（加入该字段之前保存的参数）
+	CandidateMultiplier int `json:"candidate_multiplier,omitempty"`
+	// 只检索包含全部这些标签的文档
+	Tags []string `json:"tags,omitempty"`
 }
 
 // Conversation Redis中存储的对话
@@ -99,6 +234,29 @@ type Conversation struct {
 	UpdatedAt time.Time     `json:"updated_at"`
 }
 
+// SortMessages 按序号排列消息，没有序号的旧消息按保存顺序补上序号
+func (c *Conversation) SortMessages() {
+	for i := range c.Messages {
+		if c.Messages[i].Seq == 0 {
+			c.Messages[i].Seq = int64(i + 1)
+		}
+	}
+	sort.SliceStable(c.Messages, func(i, j int) bool {
+		return c.Messages[i].Seq < c.Messages[j].Seq
+	})
+}
+
+// LastSeq 返回对话中最大的消息序号，没有消息时为0
+func (c *Conversation) LastSeq() int64 {
+	var last int64
+	for _, msg := range c.Messages {
+		if msg.Seq > last {
+			last = msg.Seq
+		}
+	}
+	return last
+}
+
 // LoginRequest 登录请求
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
@@ -109,7 +267,13 @@ type LoginRequest struct {
 type RegisterRequest struct {
 	Name     string `json:"name" binding:"required,min=2,max=100"`
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	Password string `json:"password" binding:"required"` // 强度由密码策略校验
+}
+
+// ChangePasswordRequest 修改本人密码请求
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
 }
 
 // TokenResponse Token响应
@@ -123,18 +287,35 @@ type TokenResponse struct {
 type CreateUserRequest struct {
 	Name     string `json:"name" binding:"required,min=2,max=100"`
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	Password string `json:"password" binding:"required"` // 强度由密码策略校验
 	RoleName string `json:"role_name"`
 	Status   string `json:"status"`
+	Group    string `json:"group"` // 为空时使用当前管理员的分组
 }
 
-// UpdateUserRequest 更新用户请求
-type UpdateUserRequest struct {
-	Name     string `json:"name"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+// BulkCreateUsersRequest 批量创建用户请求
+type BulkCreateUsersRequest struct {
+	Users []BulkUserEntry `json:"users" binding:"required,min=1,max=100"`
+}
+
+// BulkUserEntry 批量创建中的单个用户，校验规则与 CreateUserRequest 相同，密码可省略
+type BulkUserEntry struct {
+	Name     string `json:"name" binding:"required,min=2,max=100"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password"` // 为空时生成随机密码
 	RoleName string `json:"role_name"`
 	Status   string `json:"status"`
+	Group    string `json:"group"`
+}
+
+// UpdateUserRequest 更新用户请求
+type UpdateUserRequest struct {
+	Name     string  `json:"name"`
+	Email    string  `json:"email"`
+	Password string  `json:"password"`
+	RoleName string  `json:"role_name"`
+	Status   string  `json:"status"`
+	Group    *string `json:"group"` // 不为nil时修改分组，空字符串表示移出分组，仅超级管理员可修改
 }
 
 // UpdateUserStatusRequest 更新用户状态请求
@@ -142,16 +323,181 @@ type UpdateUserStatusRequest struct {
 	Status string `json:"status" binding:"required,oneof=active inactive"`
 }
 
+// AuditLog 审计日志表，记录导出等敏感操作
+type AuditLog struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	UserID       uint      `gorm:"index" json:"user_id"`
+	Action       string    `gorm:"size:50;index" json:"action"`
+	ResourceType string    `gorm:"size:50" json:"resource_type"`
+	ResourceID   uint      `json:"resource_id"`
+	Detail       string    `gorm:"type:text" json:"detail,omitempty"`
+	IP           string    `gorm:"size:64" json:"ip"`
+	CreatedAt    time.Time `gorm:"index" json:"created_at"`
+}
+
+// ConfigHistory 系统配置变更记录，同一次更新中各项的记录共享 ChangeID
+type ConfigHistory struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ChangeID  string    `gorm:"size:36;index" json:"change_id"`
+	Key       string    `gorm:"size:100;index" json:"key"`
+	OldValue  string    `gorm:"type:text" json:"old_value"`
+	NewValue  string    `gorm:"type:text" json:"new_value"`
+	ActorID   uint      `gorm:"index" json:"actor_id"`
+	RevertOf  string    `gorm:"size:36" json:"revert_of,omitempty"` // 回滚操作撤销的变更ID
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+// ConversationBranch 编辑消息时保留的旧分支，即被替换的消息及其之后的全部消息
+type ConversationBranch struct {
+	ID             uint          `gorm:"primaryKey" json:"id"`
+	ConversationID string        `gorm:"size:36;not null;index" json:"conversation_id"`
+	UserID         uint          `gorm:"index" json:"user_id"`
+	FromIndex      int           `json:"from_index"` // 分支第一条消息在原对话中的位置
+	Messages       []ChatMessage `gorm:"serializer:json;type:text" json:"messages"`
+	CreatedAt      time.Time     `json:"created_at"`
+}
+
+// ConversationMessage 对话消息的持久化副本，Redis中的对话过期后从这里恢复
+type ConversationMessage struct {
+	ID             uint        `gorm:"primaryKey" json:"id"`
+	ConversationID string      `gorm:"size:36;not null;uniqueIndex:idx_conv_message_seq" json:"conversation_id"`
+	Seq            int64       `gorm:"not null;uniqueIndex:idx_conv_message_seq" json:"seq"`
+	UserID         uint        `gorm:"index" json:"user_id"`
+	Message        ChatMessage `gorm:"serializer:json;type:text" json:"message"`
+	CreatedAt      time.Time   `json:"created_at"`
+}
+
+// UploadSessionStatus 分片上传会话状态
+type UploadSessionStatus string
+
+const (
+	UploadSessionUploading  UploadSessionStatus = "uploading"  // 等待上传剩余的分片
+	UploadSessionProcessing UploadSessionStatus = "processing" // 已收齐，正在入库
+	UploadSessionCompleted  UploadSessionStatus = "completed"  // 入库完成，文档ID见 DocumentID
+	UploadSessionFailed     UploadSessionStatus = "failed"     // 入库失败，原因见 Error
+)
+
+// UploadSession Redis中存储的分片上传会话，到期后自动删除
+type UploadSession struct {
+	ID              string              `json:"id"`
+	UserID          uint                `json:"user_id"`
+	KnowledgeBaseID uint                `json:"kb_id"`
+	FileName        string              `json:"filename"`
+	Size            int64               `json:"size"`   // 文件总字节数
+	Offset          int64               `json:"offset"` // 已接收的字节数，下一个分片从这里开始
+	PageStart       int                 `json:"page_start,omitempty"`
+	PageEnd         int                 `json:"page_end,omitempty"`
+	Status          UploadSessionStatus `json:"status"`
+	DocumentID      uint                `json:"document_id,omitempty"`
+	Error           string              `json:"error,omitempty"`
+	CreatedAt       time.Time           `json:"created_at"`
+	ExpiresAt       time.Time           `json:"expires_at"`
+}
+
+// UploadJobStatus 异步上传任务状态
+type UploadJobStatus string
+
+const (
+	UploadJobPending    UploadJobStatus = "pending"    // 已接收文件，等待处理
+	UploadJobProcessing UploadJobStatus = "processing" // 正在解析、切分、向量化或写入向量库
+	UploadJobCompleted  UploadJobStatus = "completed"  // 入库完成，文档ID见 DocumentID
+	UploadJobFailed     UploadJobStatus = "failed"     // 入库失败，原因见 Error
+)
+
+// UploadJob 异步上传任务，超过 UPLOAD_JOB_TTL 没有更新后删除
+type UploadJob struct {
+	ID              string          `gorm:"primaryKey;size:36" json:"id"`
+	UserID          uint            `gorm:"index" json:"user_id"`
+	KnowledgeBaseID uint            `json:"kb_id"`
+	FileName        string          `gorm:"size:255" json:"filename"`
+	Status          UploadJobStatus `gorm:"size:20" json:"status"`
+	Progress        float64         `json:"progress"`    // 完成百分比，按处理阶段估算
+	ChunkCount      int             `json:"chunk_count"` // 切分出的分块数，切分完成前为0
+	DocumentID      uint            `json:"document_id,omitempty"`
+	Error           string          `gorm:"type:text" json:"error,omitempty"`
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `gorm:"index" json:"updated_at"`
+	FinishedAt      *time.Time      `json:"finished_at,omitempty"`
+}
+
+// APIKey 用户创建的API密钥，用于脚本等程序化访问，只保存密钥的SHA-256哈希
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index;not null" json:"user_id"`
+	Name       string     `gorm:"size:100;not null" json:"name"`
+	KeyHash    string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	Prefix     string     `gorm:"size:16" json:"prefix"` // 密钥开头几位，用于在列表中辨认
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Revoked    bool       `gorm:"default:false;index" json:"revoked"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreateAPIKeyRequest 创建API密钥请求
+type CreateAPIKeyRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// CreateAPIKeyResponse 创建API密钥响应，Key 为明文密钥，只在创建时返回一次
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
 // Migrate 自动迁移数据库表
 func Migrate(db *gorm.DB) error {
-	return db.AutoMigrate(
+	if err := renameDuplicateKnowledgeBases(db); err != nil {
+		return err
+	}
+	if err := db.AutoMigrate(
 		&User{},
 		&Role{},
 		&KnowledgeBase{},
 		&Document{},
+		&DocumentChunk{},
+		&DocumentText{},
 		&ChatHistory{},
 		&SystemConfig{},
-	)
+		&AuditLog{},
+		&ConfigHistory{},
+		&ConversationBranch{},
+		&ConversationMessage{},
+		&UploadJob{},
+		&APIKey{},
+	); err != nil {
+		return err
+	}
+
+	// 旧版本的 idx_kb_creator_name 不是唯一索引，已由 idx_kb_creator_name_unique 代替
+	if db.Migrator().HasIndex(&KnowledgeBase{}, "idx_kb_creator_name") {
+		return db.Migrator().DropIndex(&KnowledgeBase{}, "idx_kb_creator_name")
+	}
+	return nil
+}
+
+// renameDuplicateKnowledgeBases 创建唯一索引前处理旧数据中同一创建者的同名知识库：保留最早的一个，其余在名称后加上ID
+func renameDuplicateKnowledgeBases(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&KnowledgeBase{}) || !migrator.HasColumn(&KnowledgeBase{}, "conversation_id") ||
+		migrator.HasIndex(&KnowledgeBase{}, "idx_kb_creator_name_unique") {
+		return nil
+	}
+
+	var duplicates []KnowledgeBase
+	if err := db.Where("(conversation_id IS NULL OR conversation_id = '') AND id NOT IN (?)",
+		db.Model(&KnowledgeBase{}).
+			Select("MIN(id)").
+			Where("conversation_id IS NULL OR conversation_id = ''").
+			Group("creator_id, name")).
+		Find(&duplicates).Error; err != nil {
+		return fmt.Errorf("failed to find duplicate knowledge bases: %w", err)
+	}
+	for _, kb := range duplicates {
+		name := fmt.Sprintf("%s (%d)", kb.Name, kb.ID)
+		if err := db.Model(&KnowledgeBase{}).Where("id = ?", kb.ID).UpdateColumn("name", name).Error; err != nil {
+			return fmt.Errorf("failed to rename duplicate knowledge base: %w", err)
+		}
+	}
+	return nil
 }
 
 // InitRoles 初始化默认角色
@@ -162,6 +508,11 @@ func InitRoles(db *gorm.DB) error {
 			Level:       0,
 			Permissions: `["all"]`,
 		},
+		{
+			Name:        "group_admin",
+			Level:       5,
+			Permissions: `["chat", "view_kb", "upload_doc", "manage_users"]`,
+		},
 		{
 			Name:        "user",
 			Level:       10,
@@ -177,11 +528,13 @@ func InitRoles(db *gorm.DB) error {
 	for _, role := range roles {
 		var existing Role
 		if err := db.Where("name = ?", role.Name).First(&existing).Error; err == gorm.ErrRecordNotFound {
-			if err := db.Create(&role).Error; err != nil {
+			// 显式写入 level，否则等级0会被列默认值999替换
+			if err := db.Select("Name", "Level", "Permissions").Create(&role).Error; err != nil {
 				return err
 			}
 		}
 	}
 
-	return nil
+	// 修复之前按默认值999写入的 admin 角色等级
+	return db.Model(&Role{}).Where("name = ? AND level = ?", "admin", 999).Update("level", 0).Error
 }
\ No newline at end of file
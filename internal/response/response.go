@@ -0,0 +1,49 @@
+package response
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 统一响应格式
+//
+// 所有JSON接口（流式接口除外）都返回相同的外层结构：
+//
+//	成功: {"success": true, "data": {...}}
+//	失败: {"success": false, "error": "错误信息"}
+//
+// 部分错误需要附带额外信息（如密码策略的违规项、冲突的知识库ID），放在 data 中返回。
+
+// Envelope 统一的响应结构
+type Envelope struct {
+	Success bool        `json:"success" example:"true"`
+	Data    interface{} `json:"data,omitempty" swaggertype:"object"`
+	Error   string      `json:"error,omitempty" example:""`
+}
+
+// OK 返回200和数据
+func OK(c *gin.Context, data interface{}) {
+	JSON(c, http.StatusOK, data)
+}
+
+// JSON 以指定状态码返回数据
+func JSON(c *gin.Context, status int, data interface{}) {
+	c.JSON(status, Envelope{Success: true, Data: data})
+}
+
+// Error 以指定状态码返回错误信息
+func Error(c *gin.Context, status int, message string) {
+	c.JSON(status, Envelope{Success: false, Error: message})
+}
+
+// ErrorWithData 返回错误信息，并在 data 中附带错误详情
+func ErrorWithData(c *gin.Context, status int, message string, data interface{}) {
+	c.JSON(status, Envelope{Success: false, Data: data, Error: message})
+}
+
+// Abort 返回错误信息并中止后续处理，供中间件使用
+func Abort(c *gin.Context, status int, message string) {
+	Error(c, status, message)
+	c.Abort()
+}
@@ -0,0 +1,170 @@
+package routes
+
+import (
+	"eino-rag/internal/auth"
+	"eino-rag/internal/handlers"
+	"eino-rag/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API路由
+//
+// /api 下全部接口的路由及其认证、权限、维护模式和超时中间件，服务和测试注册同一份路由表。
+
+// Handlers API路由使用的处理器
+type Handlers struct {
+	Auth          *handlers.AuthHandler
+	Document      *handlers.DocumentHandler
+	Chat          *handlers.ChatHandler
+	KnowledgeBase *handlers.KnowledgeBaseHandler
+	System        *handlers.SystemHandler
+	User          *handlers.UserHandler
+	Consistency   *handlers.ConsistencyHandler
+	Retention     *handlers.RetentionHandler
+	Embedding     *handlers.EmbeddingHandler
+}
+
+// RegisterAPI 在 router 上注册 /api 下的全部接口
+func RegisterAPI(router *gin.Engine, h Handlers) {
+	// 文档上传和检索按角色的权限列表检查（下方的 auth 路由组会遮蔽 auth 包）
+	uploadPermission := middleware.RequirePermission(auth.PermissionUploadDoc)
+	searchPermission := middleware.RequirePermission(auth.PermissionViewKB)
+
+	// API路由
+	api := router.Group("/api")
+	api.Use(middleware.RequestTimeout())
+	{
+		// 耗时较长的接口放宽请求超时，流式响应和下载不设超时
+		longTimeout := middleware.LongRequestTimeout()
+		noTimeout := middleware.NoRequestTimeout()
+
+		// 健康检查
+		api.GET("/health", h.System.Health)
+
+		// 认证路由
+		auth := api.Group("/auth")
+		{
+			// 匿名认证接口按IP和全局限流
+			authLimit := middleware.AuthRateLimit()
+			auth.POST("/register", authLimit, h.Auth.Register)
+			auth.POST("/login", authLimit, h.Auth.Login)
+			auth.GET("/password-policy", h.Auth.GetPasswordPolicy)
+
+			// 需要认证的路由
+			authRequired := auth.Group("")
+			authRequired.Use(middleware.AuthMiddleware())
+			{
+				authRequired.POST("/logout", h.Auth.Logout)
+				authRequired.GET("/profile", h.Auth.GetProfile)
+				authRequired.POST("/refresh", h.Auth.RefreshToken)
+				authRequired.PUT("/password", h.Auth.ChangePassword)
+				authRequired.POST("/api-keys", h.Auth.CreateAPIKey)
+				authRequired.GET("/api-keys", h.Auth.ListAPIKeys)
+				authRequired.DELETE("/api-keys/:id", h.Auth.DeleteAPIKey)
+			}
+		}
+
+		// 需要认证的API路由
+		authorized := api.Group("")
+		authorized.Use(middleware.AuthMiddleware())
+		{
+			// 维护模式下拒绝写操作，重建索引等维护操作本身不受限制
+			writeGuard := middleware.BlockDuringMaintenance()
+
+			// 知识库管理
+			kb := authorized.Group("/knowledge-bases")
+			{
+				kb.POST("", writeGuard, h.KnowledgeBase.Create)
+				kb.GET("", h.KnowledgeBase.List)
+				kb.GET("/:id", h.KnowledgeBase.Get)
+				kb.PUT("/:id", writeGuard, h.KnowledgeBase.Update)
+				kb.DELETE("/:id", writeGuard, h.KnowledgeBase.Delete)
+				kb.POST("/:id/restore", writeGuard, h.KnowledgeBase.Restore)
+				kb.POST("/:id/hard-delete", writeGuard, middleware.RequireRole("admin"), h.KnowledgeBase.HardDelete)
+				kb.GET("/:id/documents", h.Document.List)
+				kb.GET("/:id/documents/export", noTimeout, h.KnowledgeBase.ExportDocuments)
+				kb.GET("/:id/chunks/export", noTimeout, h.Document.ExportChunks)
+				kb.POST("/:id/evaluate", longTimeout, h.KnowledgeBase.Evaluate)
+				kb.POST("/:id/pii-preview", h.KnowledgeBase.PreviewPIIRedaction)
+			}
+
+			// 文档管理
+			docs := authorized.Group("/documents")
+			{
+				docs.GET("", h.Document.ListAll) // 获取所有文档
+				docs.POST("/upload", writeGuard, uploadPermission, longTimeout, h.Document.Upload)
+				docs.POST("/upload/stream", writeGuard, uploadPermission, noTimeout, h.Document.UploadStream)
+				docs.GET("/limits", h.Document.GetLimits)
+				docs.POST("/uploads", writeGuard, uploadPermission, h.Document.CreateUploadSession)
+				docs.GET("/uploads/:id", h.Document.GetUploadSession)
+				docs.PATCH("/uploads/:id", writeGuard, uploadPermission, longTimeout, h.Document.UploadPart)
+				docs.DELETE("/uploads/:id", writeGuard, h.Document.TerminateUploadSession)
+				docs.GET("/jobs/:id", h.Document.GetUploadJob)
+				docs.POST("/search", searchPermission, h.Document.Search)
+				docs.POST("/retry-failed", middleware.RequireRole("admin"), longTimeout, h.Document.RetryFailed)
+				docs.GET("/outdated", middleware.RequireRole("admin"), h.Document.ListOutdated)
+				docs.POST("/rechunk-outdated", middleware.RequireRole("admin"), longTimeout, h.Document.RechunkOutdated)
+				docs.GET("/:id", h.Document.Get)
+				docs.GET("/:id/preview", h.Document.Preview)
+				docs.POST("/:id/retry-index", writeGuard, longTimeout, h.Document.RetryIndex)
+				docs.DELETE("/:id", writeGuard, h.Document.Delete)
+			}
+
+			// 聊天功能
+			chat := authorized.Group("/chat")
+			{
+				chat.POST("", h.Chat.Chat)
+				chat.POST("/stream", noTimeout, h.Chat.ChatStream)
+				// 调试接口，返回检索内容和完整提示词
+				chat.POST("/trace", middleware.RequireRole("admin"), middleware.ChatTraceRateLimit(), h.Chat.Trace)
+				chat.GET("/conversations", h.Chat.ListConversations)
+				chat.GET("/conversations/:id", h.Chat.GetConversation)
+				chat.PATCH("/conversations/:id", h.Chat.UpdateConversation)
+				chat.PUT("/conversations/:id/messages/:index", h.Chat.EditMessage)
+				chat.GET("/conversations/:id/branches", h.Chat.ListBranches)
+				chat.POST("/conversations/:id/attach", writeGuard, uploadPermission, longTimeout, h.Chat.AttachDocument)
+				chat.POST("/conversations/:id/candidates/select", h.Chat.SelectCandidate)
+			}
+
+			// 系统管理（需要管理员权限）
+			system := authorized.Group("/system")
+			system.Use(middleware.RequireRole("admin"))
+			{
+				system.GET("/config", h.System.GetConfig)
+				system.PUT("/config", writeGuard, h.System.UpdateConfig)
+				system.GET("/config/history", h.System.GetConfigHistory)
+				system.POST("/config/revert", writeGuard, h.System.RevertConfig)
+				system.GET("/maintenance", h.System.GetMaintenance)
+				system.PUT("/maintenance", h.System.SetMaintenance)
+				system.GET("/stats/detailed", h.System.GetDetailedStats)
+				system.DELETE("/cache/retrieval", h.System.ClearRetrievalCache)
+				system.GET("/milvus/status", h.System.GetMilvusStatus)
+				system.POST("/milvus/reset-backoff", h.System.ResetMilvusBackoff)
+				system.POST("/milvus/migrate-partitions", writeGuard, h.System.MigrateMilvusPartitions)
+				system.POST("/embeddings/compare", h.System.CompareEmbeddings)
+				system.GET("/embeddings/status", h.Embedding.GetStatus)
+				system.GET("/consistency", h.Consistency.GetReport)
+				system.GET("/retention", h.Retention.GetReport)
+				system.GET("/jobs/:id", h.System.GetJob)
+				system.GET("/jobs/:id/stream", noTimeout, h.System.StreamJob)
+			}
+
+			// 系统统计（所有登录用户可访问）
+			authorized.GET("/system/stats", h.System.GetStats)
+
+			// 用户管理（需要管理员权限，分组管理员只能管理同组用户）
+			users := authorized.Group("/users")
+			users.Use(middleware.RequireRole("admin", "group_admin"))
+			{
+				users.GET("", h.User.ListUsers)
+				users.GET("/:id", h.User.GetUser)
+				users.POST("", h.User.CreateUser)
+				users.POST("/bulk", longTimeout, h.User.BulkCreateUsers)
+				users.PUT("/:id", h.User.UpdateUser)
+				users.DELETE("/:id", h.User.DeleteUser)
+				users.PUT("/:id/status", h.User.UpdateUserStatus)
+			}
+		}
+	}
+}
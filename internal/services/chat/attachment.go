@@ -0,0 +1,81 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/document"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 对话附件
+//
+// 上传到对话的文档保存在对话专用的附件知识库中（见 document/attachment.go）。对话的每轮回复都会检索附件，
+// 无论是否启用RAG；同时指定了知识库时两边分别检索，附件的结果排在前面。附件只在所属用户的对话中使用，
+// 对话有新消息时延长附件的过期时间。附件可以在发送第一条消息前上传，之后用同一个对话ID开始对话即可。
+
+// AttachDocument 把文档上传到对话，对话已存在时必须属于该用户
+func (s *Service) AttachDocument(ctx context.Context, convID string, userID uint, filename string, content io.Reader, opts document.UploadOptions) (*models.Document, int, error) {
+	owner, found, err := s.conversationOwner(ctx, convID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if found && owner != userID {
+		return nil, 0, fmt.Errorf("unauthorized")
+	}
+	return s.docService.AttachToConversation(ctx, convID, userID, filename, content, opts)
+}
+
+// conversationOwner 依次从Redis中的对话、对话记录和附件知识库查找对话所属的用户
+func (s *Service) conversationOwner(ctx context.Context, convID string) (uint, bool, error) {
+	if db.GetRedis() != nil {
+		conv, err := db.GetConversation(ctx, convID)
+		if err != nil {
+			return 0, false, err
+		}
+		if conv != nil {
+			return conv.UserID, true, nil
+		}
+	}
+
+	var history models.ChatHistory
+	err := db.GetDB().Select("user_id").Where("conversation_id = ?", convID).First(&history).Error
+	if err == nil {
+		return history.UserID, true, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, false, fmt.Errorf("failed to get conversation: %w", err)
+	}
+
+	kb, err := s.docService.ConversationKnowledgeBase(convID)
+	if err != nil || kb == nil {
+		return 0, false, err
+	}
+	return kb.CreatorID, true, nil
+}
+
+// withAttachments 对话有附件时在检索参数中加入附件知识库，未启用RAG时只检索附件
+func (s *Service) withAttachments(retrieval *models.RetrievalParams, convID string, userID uint, opts ChatOptions) *models.RetrievalParams {
+	kb, err := s.docService.ConversationKnowledgeBase(convID)
+	if err != nil {
+		s.logger.Warn("Failed to get conversation attachments", zap.String("conversation_id", convID), zap.Error(err))
+		return retrieval
+	}
+	if kb == nil || kb.CreatorID != userID {
+		return retrieval
+	}
+	s.docService.TouchConversationAttachments(convID)
+
+	if retrieval == nil {
+		retrieval = s.RetrievalParams(kb.ID, true, opts)
+		retrieval.KnowledgeBaseID = 0
+	}
+	retrieval.AttachmentKnowledgeBaseID = kb.ID
+	return retrieval
+}
@@ -0,0 +1,162 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// 编辑消息与对话分支
+//
+// 编辑对话中的某条用户消息时，该消息之后的内容全部丢弃，用修改后的消息重新生成回复。
+// 需要保留旧内容时，先把被替换的消息及其之后的全部消息作为分支写入数据库，写入成功后才修改对话，
+// 保证旧分支不会因为中途失败而丢失。生成回复期间对话可能有其他请求追加的消息，保存时只替换编辑开始时读到的消息，
+// 并同步写入数据库（见 db.ReplaceMessages）。重新生成使用原回复保存的检索参数，原回复不存在时不检索；
+// 用户可能已经失去原知识库的权限，检索前重新检查。
+
+// editLockTTL 编辑消息时对话锁的有效期，应大于生成一次回复的最长时间
+const editLockTTL = 2 * time.Minute
+
+var (
+	// ErrInvalidMessageIndex 消息位置超出范围或不是用户消息
+	ErrInvalidMessageIndex = errors.New("message index must refer to a user message in the conversation")
+	// ErrConversationBusy 对话正在被另一个请求编辑
+	ErrConversationBusy = errors.New("conversation is being edited by another request")
+)
+
+// EditResult 编辑消息的结果
+type EditResult struct {
+	Messages             []models.ChatMessage
+	BranchID             uint                // 保留的旧分支ID，未保留时为0
+	RetrievalUnavailable bool                // 启用了RAG但向量库不可用，新回复没有经过知识库检索
+	Verification         *AnswerVerification // 开启回答核对时新回复的核对结果
+}
+
+// EditMessage 修改对话中第 index 条用户消息并重新生成回复，keepBranch 为true时保留被替换的内容
+func (s *Service) EditMessage(ctx context.Context, convID string, userID uint, index int, content string, keepBranch bool, opts ChatOptions) (*EditResult, error) {
+	lock, err := db.AcquireLock(ctx, "conversation:edit:"+convID, editLockTTL)
+	if errors.Is(err, db.ErrLockNotAcquired) {
+		return nil, ErrConversationBusy
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer db.ReleaseLock(context.Background(), lock)
+
+	conv, err := db.GetConversation(ctx, convID)
+	if err != nil {
+		return nil, err
+	}
+	if conv == nil {
+		return nil, fmt.Errorf("conversation not found")
+	}
+	if conv.UserID != userID {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	if index < 0 || index >= len(conv.Messages) || conv.Messages[index].Role != "user" {
+		return nil, ErrInvalidMessageIndex
+	}
+
+	// 使用原回复的检索参数、回复格式和生成参数重新生成
+	var retrieval *models.RetrievalParams
+	format := opts.ResponseFormat
+	sampling := s.GenerationParams(opts)
+	if index+1 < len(conv.Messages) && conv.Messages[index+1].Role == "assistant" {
+		retrieval = conv.Messages[index+1].Retrieval
+		if format == "" {
+			format = ResponseFormat(conv.Messages[index+1].ResponseFormat)
+		}
+		if sampling == nil {
+			sampling = conv.Messages[index+1].Generation
+		}
+	}
+	if retrieval != nil && retrieval.KnowledgeBaseID > 0 && opts.AuthorizeKnowledgeBase != nil {
+		if err := opts.AuthorizeKnowledgeBase(retrieval.KnowledgeBaseID); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &EditResult{}
+	if keepBranch {
+		branch := &models.ConversationBranch{
+			ConversationID: convID,
+			UserID:         userID,
+			FromIndex:      index,
+			Messages:       append([]models.ChatMessage(nil), conv.Messages[index:]...),
+			CreatedAt:      time.Now(),
+		}
+		if err := db.GetDB().Create(branch).Error; err != nil {
+			return nil, fmt.Errorf("failed to save conversation branch: %w", err)
+		}
+		result.BranchID = branch.ID
+	}
+
+	// 编辑后的消息和新回复使用新的序号，排在被替换的消息之后
+	seq, err := db.ReserveMessageSeqs(ctx, conv, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	userMsg := models.ChatMessage{
+		Role:      "user",
+		Content:   content,
+		Timestamp: time.Now(),
+		Seq:       seq,
+	}
+	messages := append([]models.ChatMessage(nil), conv.Messages[:index]...)
+	messages = append(messages, userMsg)
+
+	gen, err := s.generate(ctx, messages, content, retrieval, s.maxTokens(opts), format, sampling)
+	if err != nil {
+		return nil, err
+	}
+	assistantMsg := models.ChatMessage{
+		Role:           "assistant",
+		Content:        TruncateMessage(gen.reply, s.config.Snapshot().MaxStoredMessageLength),
+		Retrieval:      retrieval,
+		ResponseFormat: string(ResolveResponseFormat(format)),
+		Generation:     sampling,
+		Timestamp:      time.Now(),
+		Seq:            seq + 1,
+	}
+
+	removed := make([]int64, 0, len(conv.Messages)-index)
+	for _, msg := range conv.Messages[index:] {
+		removed = append(removed, msg.Seq)
+	}
+	if err := db.ReplaceMessages(ctx, conv, removed, userMsg, assistantMsg); err != nil {
+		return nil, fmt.Errorf("failed to save conversation: %w", err)
+	}
+
+	// 对话标题取自第一条消息
+	if index == 0 {
+		if err := db.GetDB().Model(&models.ChatHistory{}).
+			Where("conversation_id = ? AND user_id = ?", convID, userID).
+			Update("title", conversationTitle(content)).Error; err != nil {
+			s.logger.Warn("Failed to update conversation title", zap.Error(err))
+		}
+	}
+
+	result.Messages = conv.Messages
+	result.RetrievalUnavailable = gen.unavailable
+	result.Verification = gen.verification
+	return result, nil
+}
+
+// GetConversationBranches 获取对话保留的旧分支，按创建时间倒序
+func (s *Service) GetConversationBranches(convID string, userID uint) ([]models.ConversationBranch, error) {
+	var branches []models.ConversationBranch
+	if err := db.GetDB().
+		Where("conversation_id = ? AND user_id = ?", convID, userID).
+		Order("created_at DESC, id DESC").
+		Find(&branches).Error; err != nil {
+		return nil, err
+	}
+	return branches, nil
+}
@@ -0,0 +1,252 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/rag"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// 多个候选回复
+//
+// 非流式对话可以一次生成 n 个候选回复（A/B 比较、"换一个回答"）：检索只做一次，各候选使用相同的上下文并发生成。
+// 生成后用户消息和候选回复暂存在Redis中（candidateSetTTL），对话中不保存任何内容；客户端调用选择接口后，
+// 用户消息和选中的回复才使用生成时预留的序号保存到对话，其余候选丢弃。超时未选择的候选直接过期。
+//
+// 候选回复不使用语义缓存、工具调用和回答核对：缓存只有一个回答，后两者的开销还要再乘以候选数。
+
+// MaxCandidates 单次请求的候选回复数硬上限，不受角色配置影响
+const MaxCandidates = 8
+
+// candidateSetTTL 候选回复等待选择的时间
+const candidateSetTTL = time.Hour
+
+var (
+	// ErrInvalidCandidateCount 候选回复数不在 2 到 MaxCandidates 之间
+	ErrInvalidCandidateCount = fmt.Errorf("candidate count must be between 2 and %d", MaxCandidates)
+	// ErrCandidateSetNotFound 候选回复不存在、已过期或已经选择过
+	ErrCandidateSetNotFound = errors.New("candidate set not found, expired or already selected")
+	// ErrInvalidCandidateIndex 选择的候选回复序号超出范围
+	ErrInvalidCandidateIndex = errors.New("candidate index out of range")
+)
+
+// CandidateReply 多个候选回复的生成结果
+type CandidateReply struct {
+	ConversationID       string
+	CandidateSetID       string // 选择候选回复时使用
+	Candidates           []string
+	Context              string
+	RetrievalUnavailable bool // 启用了RAG但向量库不可用，回复没有经过知识库检索
+}
+
+// candidateSet 暂存在Redis中等待选择的候选回复
+type candidateSet struct {
+	ConversationID string                   `json:"conversation_id"`
+	UserID         uint                     `json:"user_id"`
+	UserMessage    models.ChatMessage       `json:"user_message"` // 选择后保存，回复使用其后的序号
+	Candidates     []string                 `json:"candidates"`
+	Retrieval      *models.RetrievalParams  `json:"retrieval,omitempty"`
+	ResponseFormat string                   `json:"response_format"`
+	Generation     *models.GenerationParams `json:"generation,omitempty"`
+}
+
+// candidateSetKey 候选回复在Redis中的键
+func candidateSetKey(setID string) string {
+	return "chat:candidates:" + setID
+}
+
+// ChatCandidates 为一条消息生成 n 个候选回复，回复不保存到对话，由 SelectCandidate 保存选中的一个
+func (s *Service) ChatCandidates(
+	ctx context.Context,
+	message string,
+	conversationID string,
+	userID uint,
+	kbID uint,
+	useRAG bool,
+	opts ChatOptions,
+	n int,
+) (*CandidateReply, error) {
+	if n < 2 || n > MaxCandidates {
+		return nil, ErrInvalidCandidateCount
+	}
+	if conversationID == "" {
+		conversationID = uuid.New().String()
+	}
+
+	conv, err := s.getOrCreateConversation(ctx, conversationID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation: %w", err)
+	}
+	if len(conv.Messages) == 0 {
+		if err := s.EnforceConversationLimit(ctx, userID, conversationID); err != nil {
+			return nil, err
+		}
+	}
+	// 生成时就预留序号，选择前对话中发送的其他消息排在后面
+	seq, err := db.ReserveMessageSeqs(ctx, conv, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	userMsg := models.ChatMessage{
+		Role:      "user",
+		Content:   message,
+		Timestamp: time.Now(),
+		Seq:       seq,
+	}
+	history := append(conv.Messages, userMsg)
+
+	retrieval := s.withAttachments(s.RetrievalParams(kbID, useRAG, opts), conversationID, userID, opts)
+	if retrieval != nil {
+		retrieval.ToolCalling = false
+	}
+	ragContext, unavailable := s.candidateContext(ctx, message, retrieval)
+
+	format := opts.ResponseFormat
+	sampling := s.GenerationParams(opts)
+	var candidates []string
+	if s.strictUnavailable(unavailable, ragContext) {
+		candidates = []string{retrievalUnavailableReply}
+	} else {
+		candidates, err = s.generateCandidates(ctx, message, ragContext, history, s.maxTokens(opts), format, sampling, n)
+		if err != nil {
+			return nil, rag.WrapTimeout(ctx, rag.StageGeneration, s.generationTimeout, fmt.Errorf("failed to generate reply: %w", err))
+		}
+	}
+
+	setID := uuid.New().String()
+	set := candidateSet{
+		ConversationID: conversationID,
+		UserID:         userID,
+		UserMessage:    userMsg,
+		Candidates:     candidates,
+		Retrieval:      retrieval,
+		ResponseFormat: string(ResolveResponseFormat(format)),
+		Generation:     sampling,
+	}
+	if err := db.CacheSet(ctx, candidateSetKey(setID), set, candidateSetTTL); err != nil {
+		return nil, fmt.Errorf("failed to save candidates: %w", err)
+	}
+
+	return &CandidateReply{
+		ConversationID:       conversationID,
+		CandidateSetID:       setID,
+		Candidates:           candidates,
+		Context:              ragContext,
+		RetrievalUnavailable: unavailable,
+	}, nil
+}
+
+// candidateContext 为所有候选回复检索一次上下文，同时返回向量库是否不可用
+func (s *Service) candidateContext(ctx context.Context, message string, retrieval *models.RetrievalParams) (string, bool) {
+	unavailable := s.vectorStoreDown(retrieval)
+	if retrieval == nil {
+		return "", unavailable
+	}
+	docs, down, err := s.retrieve(ctx, message, retrieval)
+	if err != nil {
+		s.logger.Error("Failed to retrieve documents", zap.Error(err))
+		return "", unavailable || down
+	}
+	if len(docs) == 0 {
+		return "", unavailable || down
+	}
+	return s.buildRAGContext(docs), unavailable || down
+}
+
+// generateCandidates 并发生成 n 个候选回复，部分失败时只返回成功的，全部失败时返回第一个错误
+func (s *Service) generateCandidates(ctx context.Context, message, ragContext string, history []models.ChatMessage, maxTokens int, format ResponseFormat, sampling *models.GenerationParams, n int) ([]string, error) {
+	replies := make([]string, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			replies[i], errs[i] = s.generateReply(ctx, message, ragContext, history, maxTokens, format, sampling)
+		}(i)
+	}
+	wg.Wait()
+
+	candidates := make([]string, 0, n)
+	var firstErr error
+	for i, reply := range replies {
+		if errs[i] != nil {
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+			continue
+		}
+		candidates = append(candidates, s.FilterAnswer(reply, format))
+	}
+	if len(candidates) == 0 {
+		return nil, firstErr
+	}
+	if firstErr != nil {
+		s.logger.Warn("Some candidate replies failed",
+			zap.Int("requested", n),
+			zap.Int("generated", len(candidates)),
+			zap.Error(firstErr))
+	}
+	return candidates, nil
+}
+
+// SelectCandidate 把选中的候选回复连同对应的用户消息保存到对话，每组候选只能选择一次
+func (s *Service) SelectCandidate(ctx context.Context, convID string, userID uint, setID string, index int) (*models.ChatMessage, error) {
+	key := candidateSetKey(setID)
+	var set candidateSet
+	if err := db.CacheGet(ctx, key, &set); err != nil {
+		return nil, err
+	}
+	if set.ConversationID == "" || set.ConversationID != convID {
+		return nil, ErrCandidateSetNotFound
+	}
+	if set.UserID != userID {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	if index < 0 || index >= len(set.Candidates) {
+		return nil, ErrInvalidCandidateIndex
+	}
+
+	// 校验通过后再取出，并发选择时只有一个请求能保存
+	taken, err := db.CacheTake(ctx, key, &set)
+	if err != nil {
+		return nil, err
+	}
+	if !taken {
+		return nil, ErrCandidateSetNotFound
+	}
+
+	conv, err := s.getOrCreateConversation(ctx, convID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation: %w", err)
+	}
+	assistantMsg := models.ChatMessage{
+		Role:           "assistant",
+		Content:        TruncateMessage(set.Candidates[index], s.config.Snapshot().MaxStoredMessageLength),
+		Retrieval:      set.Retrieval,
+		ResponseFormat: set.ResponseFormat,
+		Generation:     set.Generation,
+		Timestamp:      time.Now(),
+		Seq:            set.UserMessage.Seq + 1,
+	}
+
+	created, err := db.AppendMessages(ctx, conv, set.UserMessage, assistantMsg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save conversation: %w", err)
+	}
+	if created {
+		s.saveConversationHistory(userID, convID, set.UserMessage.Content)
+	} else {
+		s.touchConversation(userID, convID)
+	}
+	return &assistantMsg, nil
+}
@@ -0,0 +1,76 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+
+	"eino-rag/internal/models"
+
+	"github.com/cloudwego/eino-ext/components/model/openai"
+	"github.com/cloudwego/eino/components/model"
+)
+
+// ResponseFormat 回复格式，通过系统提示告知模型，JSON 格式在模型支持时同时开启 JSON 模式
+type ResponseFormat string
+
+const (
+	ResponseFormatMarkdown ResponseFormat = "markdown"
+	ResponseFormatPlain    ResponseFormat = "plain"
+	ResponseFormatJSON     ResponseFormat = "json"
+)
+
+// ErrUnsupportedResponseFormat 回复格式无效，或当前模型不支持该格式
+var ErrUnsupportedResponseFormat = errors.New("unsupported response format")
+
+// formatInstructions 各回复格式追加到系统提示中的说明
+var formatInstructions = map[ResponseFormat]string{
+	ResponseFormatMarkdown: "请使用 Markdown 格式组织回答，适当使用标题、列表和代码块。",
+	ResponseFormatPlain:    "请使用纯文本回答，不要使用 Markdown 等任何标记语法（如 #、*、``` 或表格）。",
+	ResponseFormatJSON:     `请只输出一个合法的 JSON 对象，不要输出 JSON 以外的任何内容。对象包含 "answer" 字段（字符串，回答内容），引用了检索到的文档时包含 "sources" 字段（字符串数组，文档编号如 "文档 1"）。`,
+}
+
+// ResolveResponseFormat 返回实际使用的回复格式，未指定时为 Markdown
+func ResolveResponseFormat(format ResponseFormat) ResponseFormat {
+	if format == "" {
+		return ResponseFormatMarkdown
+	}
+	return format
+}
+
+// ValidateResponseFormat 检查回复格式是否有效，JSON 格式要求配置的模型支持 JSON 模式
+func (s *Service) ValidateResponseFormat(format ResponseFormat) error {
+	format = ResolveResponseFormat(format)
+	if _, ok := formatInstructions[format]; !ok {
+		return fmt.Errorf("%w: %q, expected markdown, plain or json", ErrUnsupportedResponseFormat, format)
+	}
+	if cfg := s.config.Snapshot(); format == ResponseFormatJSON && !cfg.OpenAIJSONMode {
+		return fmt.Errorf("%w: model %q does not support JSON mode", ErrUnsupportedResponseFormat, cfg.OpenAIModel)
+	}
+	return nil
+}
+
+// withFormatInstruction 在系统提示末尾追加回复格式说明
+func withFormatInstruction(systemPrompt string, format ResponseFormat) string {
+	return systemPrompt + "\n\n" + formatInstructions[ResolveResponseFormat(format)]
+}
+
+// modelOptions 返回调用模型的参数：回复最大token数和生成参数，JSON 格式时开启 JSON 模式
+func (s *Service) modelOptions(maxTokens int, format ResponseFormat, sampling *models.GenerationParams) []model.Option {
+	var opts []model.Option
+	if maxTokens > 0 {
+		opts = append(opts, model.WithMaxTokens(maxTokens))
+	}
+	// 额外字段只能设置一次，JSON 模式和惩罚参数合并在一起发送
+	samplingOpts, extra := samplingOptions(sampling)
+	opts = append(opts, samplingOpts...)
+	if ResolveResponseFormat(format) == ResponseFormatJSON && s.config.Snapshot().OpenAIJSONMode {
+		if extra == nil {
+			extra = map[string]any{}
+		}
+		extra["response_format"] = map[string]string{"type": "json_object"}
+	}
+	if len(extra) > 0 {
+		opts = append(opts, openai.WithExtraFields(extra))
+	}
+	return opts
+}
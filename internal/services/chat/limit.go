@@ -0,0 +1,128 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 每个用户的对话数上限
+//
+// 设置了 MAX_CONVERSATIONS_PER_USER 后，开始新对话时按用户已有的对话记录计数，达到上限时按 CONVERSATION_LIMIT_POLICY 处理：
+//   - reject        拒绝创建新对话，返回 ErrConversationLimitReached
+//   - evict_oldest  删除最久没有新消息的对话（Redis中的对话、对话附件、对话记录和保留的旧分支），腾出一个位置
+//
+// 对话记录的 updated_at 在每次保存消息时更新，作为最近使用时间。继续已有的对话不受上限影响。
+
+// ErrConversationLimitReached 用户的对话数已达上限且不允许删除旧对话
+var ErrConversationLimitReached = errors.New("conversation limit reached")
+
+// ConversationUsage 用户当前的对话数和上限，Limit 为0表示不限制
+type ConversationUsage struct {
+	Count int64 `json:"count" example:"12"`
+	Limit int   `json:"limit" example:"50"`
+}
+
+// GetConversationUsage 返回用户当前的对话数和上限
+func (s *Service) GetConversationUsage(userID uint) (*ConversationUsage, error) {
+	var count int64
+	if err := db.GetDB().Model(&models.ChatHistory{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	limit := s.config.Snapshot().MaxConversationsPerUser
+	if limit < 0 {
+		limit = 0
+	}
+	return &ConversationUsage{Count: count, Limit: limit}, nil
+}
+
+// EnforceConversationLimit 在用户开始新对话 convID 前检查对话数上限，已有的对话直接放行
+func (s *Service) EnforceConversationLimit(ctx context.Context, userID uint, convID string) error {
+	cfg := s.config.Snapshot()
+	if cfg.MaxConversationsPerUser <= 0 {
+		return nil
+	}
+	database := db.GetDB()
+
+	// Redis中的对话过期后对话记录仍在，不算新对话
+	var existing int64
+	if err := database.Model(&models.ChatHistory{}).Where("conversation_id = ?", convID).Count(&existing).Error; err != nil {
+		return fmt.Errorf("failed to check conversation: %w", err)
+	}
+	if existing > 0 {
+		return nil
+	}
+
+	usage, err := s.GetConversationUsage(userID)
+	if err != nil {
+		return fmt.Errorf("failed to count conversations: %w", err)
+	}
+	excess := int(usage.Count) - cfg.MaxConversationsPerUser + 1
+	if excess <= 0 {
+		return nil
+	}
+	if cfg.ConversationLimitPolicy != config.ConversationLimitEvictOldest {
+		return fmt.Errorf("%w: at most %d conversations allowed, delete old conversations first", ErrConversationLimitReached, cfg.MaxConversationsPerUser)
+	}
+
+	var convIDs []string
+	if err := database.Model(&models.ChatHistory{}).
+		Where("user_id = ?", userID).
+		Order("updated_at ASC, id ASC").
+		Limit(excess).
+		Pluck("conversation_id", &convIDs).Error; err != nil {
+		return fmt.Errorf("failed to find oldest conversations: %w", err)
+	}
+	if err := s.deleteConversations(ctx, userID, convIDs); err != nil {
+		return err
+	}
+	s.logger.Info("Evicted oldest conversations to stay within limit",
+		zap.Uint("user_id", userID),
+		zap.Int("limit", cfg.MaxConversationsPerUser),
+		zap.Strings("conversation_ids", convIDs))
+	return nil
+}
+
+// deleteConversations 删除用户的对话：先删除Redis中的对话和对话附件，再删除对话记录、持久化的消息和保留的旧分支
+func (s *Service) deleteConversations(ctx context.Context, userID uint, convIDs []string) error {
+	if len(convIDs) == 0 {
+		return nil
+	}
+	if db.GetRedis() != nil {
+		if err := db.DeleteConversations(ctx, convIDs...); err != nil {
+			return fmt.Errorf("failed to delete conversations from redis: %w", err)
+		}
+	}
+	if err := s.docService.DeleteConversationAttachments(ctx, convIDs...); err != nil {
+		return err
+	}
+	return db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND conversation_id IN ?", userID, convIDs).Delete(&models.ConversationBranch{}).Error; err != nil {
+			return fmt.Errorf("failed to delete conversation branches: %w", err)
+		}
+		if err := tx.Where("user_id = ? AND conversation_id IN ?", userID, convIDs).Delete(&models.ConversationMessage{}).Error; err != nil {
+			return fmt.Errorf("failed to delete conversation messages: %w", err)
+		}
+		if err := tx.Where("user_id = ? AND conversation_id IN ?", userID, convIDs).Delete(&models.ChatHistory{}).Error; err != nil {
+			return fmt.Errorf("failed to delete chat history: %w", err)
+		}
+		return nil
+	})
+}
+
+// touchConversation 更新对话记录的最近使用时间，对话数达到上限时据此删除最久未使用的对话
+func (s *Service) touchConversation(userID uint, convID string) {
+	if err := db.GetDB().Model(&models.ChatHistory{}).
+		Where("user_id = ? AND conversation_id = ?", userID, convID).
+		Update("updated_at", time.Now()).Error; err != nil {
+		s.logger.Warn("Failed to update conversation activity", zap.String("conversation_id", convID), zap.Error(err))
+	}
+}
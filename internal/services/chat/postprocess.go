@@ -0,0 +1,284 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"eino-rag/internal/config"
+
+	"github.com/cloudwego/eino/schema"
+	"go.uber.org/zap"
+)
+
+// 回答后处理
+//
+// 生成的回答在返回和保存之前依次经过 ANSWER_FILTERS 中的过滤器，默认不过滤。每个过滤器是一个文本到文本的函数：
+//   - meta_commentary     删除"作为一个AI语言模型……"之类的自我说明句子
+//   - system_prompt_echo  删除复述系统提示的句子
+//   - profanity           将 ANSWER_PROFANITY_WORDS 中的词（不区分大小写）替换为等长的 *
+//
+// 非流式回答整体过滤；流式回答按句缓冲，一句结束（。！？；!?; 或换行，句点需后跟空白）后再过滤并输出，
+// 过滤器只会看到完整的句子。JSON 格式的回答不过滤，避免破坏结构。
+// 其他过滤器可在启动时通过 RegisterAnswerFilter 注册后在 ANSWER_FILTERS 中引用。
+
+// AnswerFilter 回答过滤器，返回处理后的文本
+type AnswerFilter func(text string) string
+
+// AnswerFilterFactory 按当前配置创建过滤器
+type AnswerFilterFactory func(cfg *config.Config) AnswerFilter
+
+// ErrUnknownAnswerFilter ANSWER_FILTERS 中包含未注册的过滤器
+var ErrUnknownAnswerFilter = errors.New("unknown answer filter")
+
+var (
+	answerFiltersMu sync.RWMutex
+	answerFilters   = map[string]AnswerFilterFactory{
+		"meta_commentary":    func(*config.Config) AnswerFilter { return stripMetaCommentary },
+		"system_prompt_echo": func(*config.Config) AnswerFilter { return stripSystemPromptEcho },
+		"profanity":          newProfanityFilter,
+	}
+)
+
+// RegisterAnswerFilter 注册过滤器，同名的过滤器会被替换
+func RegisterAnswerFilter(name string, factory AnswerFilterFactory) {
+	answerFiltersMu.Lock()
+	defer answerFiltersMu.Unlock()
+	answerFilters[name] = factory
+}
+
+// ValidateAnswerFilters 检查过滤器是否都已注册，忽略空白的名称
+func ValidateAnswerFilters(names []string) error {
+	answerFiltersMu.RLock()
+	defer answerFiltersMu.RUnlock()
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := answerFilters[name]; !ok {
+			registered := make([]string, 0, len(answerFilters))
+			for n := range answerFilters {
+				registered = append(registered, n)
+			}
+			sort.Strings(registered)
+			return fmt.Errorf("%w %q, available: %s", ErrUnknownAnswerFilter, name, strings.Join(registered, ", "))
+		}
+	}
+	return nil
+}
+
+// answerFilter 按配置组合过滤器，没有配置过滤器或回答为 JSON 格式时返回nil
+func (s *Service) answerFilter(format ResponseFormat) AnswerFilter {
+	cfg := s.config.Snapshot()
+	if len(cfg.AnswerFilters) == 0 || ResolveResponseFormat(format) == ResponseFormatJSON {
+		return nil
+	}
+
+	answerFiltersMu.RLock()
+	defer answerFiltersMu.RUnlock()
+	var chain []AnswerFilter
+	for _, name := range cfg.AnswerFilters {
+		factory, ok := answerFilters[name]
+		if !ok {
+			s.logger.Warn("Skipping unknown answer filter", zap.String("filter", name))
+			continue
+		}
+		if filter := factory(cfg); filter != nil {
+			chain = append(chain, filter)
+		}
+	}
+	if len(chain) == 0 {
+		return nil
+	}
+	return func(text string) string {
+		for _, filter := range chain {
+			text = filter(text)
+		}
+		return text
+	}
+}
+
+// FilterAnswer 按配置过滤完整的回答
+func (s *Service) FilterAnswer(text string, format ResponseFormat) string {
+	if filter := s.answerFilter(format); filter != nil {
+		return filter(text)
+	}
+	return text
+}
+
+// FilterStream 按句过滤流式回答，没有配置过滤器时原样返回
+func (s *Service) FilterStream(stream messageStream, format ResponseFormat) messageStream {
+	filter := s.answerFilter(format)
+	if filter == nil {
+		return stream
+	}
+	return &filteredStream{stream: stream, filter: filter}
+}
+
+// filteredStream 缓冲流式回答，每凑齐完整的句子就过滤后输出
+type filteredStream struct {
+	stream  messageStream
+	filter  AnswerFilter
+	pending strings.Builder // 尚未结束的句子
+	err     error           // 输出缓冲内容后再返回的错误
+}
+
+func (f *filteredStream) Recv() (*schema.Message, error) {
+	for f.err == nil {
+		msg, err := f.stream.Recv()
+		if err != nil {
+			// 流结束或出错时先输出剩余的内容，中断的回答也保留已生成的部分
+			f.err = err
+			break
+		}
+		f.pending.WriteString(msg.Content)
+
+		complete, rest := splitCompleteSentences(f.pending.String())
+		if complete == "" {
+			continue
+		}
+		f.pending.Reset()
+		f.pending.WriteString(rest)
+		if content := f.filter(complete); content != "" {
+			return &schema.Message{Role: schema.Assistant, Content: content}, nil
+		}
+	}
+
+	if f.pending.Len() > 0 {
+		content := f.filter(f.pending.String())
+		f.pending.Reset()
+		if content != "" {
+			return &schema.Message{Role: schema.Assistant, Content: content}, nil
+		}
+	}
+	return nil, f.err
+}
+
+func (f *filteredStream) Close() {
+	f.stream.Close()
+}
+
+// isSentenceEnd 判断字符 r 是否结束一个句子，next 为之后的字符，没有时为 utf8.RuneError
+func isSentenceEnd(r, next rune) bool {
+	switch r {
+	case '。', '！', '？', '；', '!', '?', ';', '\n':
+		return true
+	case '.':
+		return next == ' ' || next == '\t' || next == '\n'
+	}
+	return false
+}
+
+// splitCompleteSentences 返回文本中已结束的句子（含句末的空白）和剩余未结束的部分
+func splitCompleteSentences(text string) (string, string) {
+	end := 0
+	for i, r := range text {
+		next, _ := utf8.DecodeRuneInString(text[i+utf8.RuneLen(r):])
+		if isSentenceEnd(r, next) {
+			end = i + utf8.RuneLen(r)
+		}
+	}
+	// 句末的空白归入已结束的部分
+	for end < len(text) && (text[end] == ' ' || text[end] == '\t' || text[end] == '\n') {
+		end++
+	}
+	return text[:end], text[end:]
+}
+
+// splitSentences 将文本切分为句子，每句保留句末标点和空白，拼接后与原文一致
+func splitSentences(text string) []string {
+	var sentences []string
+	start := 0
+	for i, r := range text {
+		if i < start {
+			continue
+		}
+		size := utf8.RuneLen(r)
+		next, _ := utf8.DecodeRuneInString(text[i+size:])
+		if !isSentenceEnd(r, next) {
+			continue
+		}
+		end := i + size
+		for end < len(text) && (text[end] == ' ' || text[end] == '\t') {
+			end++
+		}
+		sentences = append(sentences, text[start:end])
+		start = end
+	}
+	if start < len(text) {
+		sentences = append(sentences, text[start:])
+	}
+	return sentences
+}
+
+// dropSentences 删除满足条件的句子
+func dropSentences(text string, drop func(sentence string) bool) string {
+	var b strings.Builder
+	for _, sentence := range splitSentences(text) {
+		if !drop(strings.TrimSpace(sentence)) {
+			b.WriteString(sentence)
+		}
+	}
+	return b.String()
+}
+
+// metaCommentaryPattern 模型的自我说明，只匹配句首
+var metaCommentaryPattern = regexp.MustCompile(`(?i)^(?:as an ai\b|as a (?:large )?language model\b|i am an ai\b|i'm an ai\b|i'm just an ai\b|作为(?:一个|一名)?(?:ai|人工智能)|我(?:只)?是(?:一个)?(?:ai|人工智能)(?:语言模型|助手|模型)?[，,。])`)
+
+// stripMetaCommentary 删除以自我说明开头的句子
+func stripMetaCommentary(text string) string {
+	return dropSentences(text, metaCommentaryPattern.MatchString)
+}
+
+// systemPromptPhrases 系统提示中的句子，回答中出现时视为复述系统提示
+var systemPromptPhrases = func() []string {
+	prompts := []string{"你是一个有帮助的AI助手。", "请基于以下检索到的文档内容回答用户的问题：", resumePrompt}
+	for _, instruction := range formatInstructions {
+		prompts = append(prompts, instruction)
+	}
+
+	var phrases []string
+	for _, prompt := range prompts {
+		for _, sentence := range splitSentences(prompt) {
+			sentence = strings.TrimRight(strings.TrimSpace(sentence), "。！？；：!?;:.")
+			if utf8.RuneCountInString(sentence) >= 8 {
+				phrases = append(phrases, sentence)
+			}
+		}
+	}
+	return phrases
+}()
+
+// stripSystemPromptEcho 删除包含系统提示原句的句子
+func stripSystemPromptEcho(text string) string {
+	return dropSentences(text, func(sentence string) bool {
+		for _, phrase := range systemPromptPhrases {
+			if strings.Contains(sentence, phrase) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// newProfanityFilter 按 ANSWER_PROFANITY_WORDS 创建屏蔽过滤器，没有配置词语时返回nil
+func newProfanityFilter(cfg *config.Config) AnswerFilter {
+	if len(cfg.AnswerProfanityWords) == 0 {
+		return nil
+	}
+	words := make([]string, len(cfg.AnswerProfanityWords))
+	for i, word := range cfg.AnswerProfanityWords {
+		words[i] = regexp.QuoteMeta(word)
+	}
+	pattern := regexp.MustCompile(`(?i)` + strings.Join(words, "|"))
+	return func(text string) string {
+		return pattern.ReplaceAllStringFunc(text, func(match string) string {
+			return strings.Repeat("*", utf8.RuneCountInString(match))
+		})
+	}
+}
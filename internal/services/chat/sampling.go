@@ -0,0 +1,62 @@
+package chat
+
+import (
+	"slices"
+
+	"eino-rag/internal/models"
+
+	"github.com/cloudwego/eino/components/model"
+)
+
+// 生成参数
+//
+// 对话请求可以指定停止序列（stop）和存在/频率惩罚（presence_penalty、frequency_penalty），用于减少重复或在自定义标记处截止。
+// 参数随请求传给 OpenAI 兼容接口（Ollama 的兼容接口同样支持），并随回复保存以便复现；重新生成时沿用原回复的参数。
+// 部分模型服务不接受其中某些参数（例如一些推理模型不支持 stop），在 OPENAI_UNSUPPORTED_PARAMS 中列出后这些参数被忽略，
+// 请求照常生成，保存的参数也不包含它们。取值范围和按角色的上限由 handler 校验。
+
+// 生成参数名，与 OpenAI 接口的字段名一致
+const (
+	GenerationParamStop             = "stop"
+	GenerationParamPresencePenalty  = "presence_penalty"
+	GenerationParamFrequencyPenalty = "frequency_penalty"
+)
+
+// GenerationParams 返回本次请求实际传给模型的生成参数，去掉模型服务不支持的参数，没有任何参数时返回nil
+func (s *Service) GenerationParams(opts ChatOptions) *models.GenerationParams {
+	unsupported := s.config.Snapshot().OpenAIUnsupportedParams
+	params := &models.GenerationParams{}
+	if len(opts.Stop) > 0 && !slices.Contains(unsupported, GenerationParamStop) {
+		params.Stop = slices.Clone(opts.Stop)
+	}
+	if opts.PresencePenalty != nil && !slices.Contains(unsupported, GenerationParamPresencePenalty) {
+		penalty := *opts.PresencePenalty
+		params.PresencePenalty = &penalty
+	}
+	if opts.FrequencyPenalty != nil && !slices.Contains(unsupported, GenerationParamFrequencyPenalty) {
+		penalty := *opts.FrequencyPenalty
+		params.FrequencyPenalty = &penalty
+	}
+	if len(params.Stop) == 0 && params.PresencePenalty == nil && params.FrequencyPenalty == nil {
+		return nil
+	}
+	return params
+}
+
+// samplingOptions 把生成参数转换为调用模型的参数，惩罚参数没有通用选项，作为额外字段发送
+func samplingOptions(sampling *models.GenerationParams) (opts []model.Option, extra map[string]any) {
+	if sampling == nil {
+		return nil, nil
+	}
+	if len(sampling.Stop) > 0 {
+		opts = append(opts, model.WithStop(sampling.Stop))
+	}
+	extra = map[string]any{}
+	if sampling.PresencePenalty != nil {
+		extra[GenerationParamPresencePenalty] = *sampling.PresencePenalty
+	}
+	if sampling.FrequencyPenalty != nil {
+		extra[GenerationParamFrequencyPenalty] = *sampling.FrequencyPenalty
+	}
+	return opts, extra
+}
@@ -0,0 +1,180 @@
+package chat
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"time"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/rag"
+
+	"github.com/cloudwego/eino/schema"
+	"go.uber.org/zap"
+)
+
+// 语义缓存
+//
+// 同一个问题经常以不同的措辞被反复提问。开启 SemanticCache 后，知识库对话的第一轮问题会先计算向量，
+// 与该知识库缓存的问题向量比较，相似度达到阈值时直接返回缓存的回答，不再检索和调用模型。
+// 有历史消息的对话不使用缓存，因为回答依赖上下文；检索参数、模型或回复长度不同的条目互不复用。
+// 知识库文档变更后缓存随检索缓存版本号一起失效。
+//
+// 查找需要额外计算一次问题向量，开启 EmbeddingCache 时随后的检索会复用该向量。
+
+// semanticCacheTimeout 写入语义缓存的超时时间，写入在回复完成后执行，不使用请求的上下文
+const semanticCacheTimeout = 2 * time.Second
+
+// SemanticCacheHit 回复来自语义缓存时返回给调用方的说明
+type SemanticCacheHit struct {
+	Query      string  `json:"query" example:"如何重置密码？"` // 命中的缓存问题
+	Similarity float64 `json:"similarity" example:"0.97"`
+}
+
+// semanticLookup 一次语义缓存查找的结果，未命中时用于在回复生成后写入缓存
+type semanticLookup struct {
+	kbID        uint
+	version     int64
+	query       string
+	embedding   []float32
+	fingerprint string
+	entry       *db.SemanticCacheEntry // 命中的条目，未命中时为nil
+	similarity  float64
+}
+
+// hit 返回命中信息，未命中时返回nil
+func (l *semanticLookup) hit() *SemanticCacheHit {
+	if l == nil || l.entry == nil {
+		return nil
+	}
+	return &SemanticCacheHit{Query: l.entry.Query, Similarity: l.similarity}
+}
+
+// semanticCacheable 本轮对话是否可以使用语义缓存：只用于知识库对话的第一轮问题，
+// 未配置模型时的模拟回复不需要缓存，使用备用嵌入服务期间问题向量不能与缓存中的向量比较
+func (s *Service) semanticCacheable(history []models.ChatMessage, retrieval *models.RetrievalParams) bool {
+	return s.config.Snapshot().SemanticCache &&
+		s.embedder != nil &&
+		s.chatModel != nil &&
+		retrieval != nil &&
+		len(history) == 1 &&
+		db.RetrievalCacheAvailable() &&
+		!rag.EmbeddingFailingOver(s.embedder)
+}
+
+// semanticFingerprint 由影响回答的参数计算摘要
+func (s *Service) semanticFingerprint(retrieval *models.RetrievalParams, maxTokens int, format ResponseFormat, sampling *models.GenerationParams) string {
+	data, _ := json.Marshal(struct {
+		Retrieval *models.RetrievalParams  `json:"r"`
+		Model     string                   `json:"m"`
+		MaxTokens int                      `json:"t"`
+		Format    ResponseFormat           `json:"f"`
+		Sampling  *models.GenerationParams `json:"g,omitempty"`
+	}{
+		Retrieval: retrieval,
+		Model:     s.config.Snapshot().OpenAIModel,
+		MaxTokens: maxTokens,
+		Format:    ResolveResponseFormat(format),
+		Sampling:  sampling,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// lookupSemanticCache 查找与问题语义相近的缓存回答，出错时记录日志并返回nil，按未启用处理
+func (s *Service) lookupSemanticCache(ctx context.Context, message string, retrieval *models.RetrievalParams, maxTokens int, format ResponseFormat, sampling *models.GenerationParams) *semanticLookup {
+	cfg := s.config.Snapshot()
+	kbID := retrieval.KnowledgeBaseID
+	version, err := db.RetrievalCacheVersion(ctx, kbID)
+	if err != nil {
+		s.logger.Warn("Failed to get retrieval cache version for semantic cache", zap.Error(err))
+		return nil
+	}
+
+	embedding, err := s.embedder.EmbedText(ctx, message)
+	if err != nil {
+		s.logger.Warn("Failed to embed query for semantic cache", zap.Error(err))
+		return nil
+	}
+
+	lookup := &semanticLookup{
+		kbID:        kbID,
+		version:     version,
+		query:       message,
+		embedding:   embedding,
+		fingerprint: s.semanticFingerprint(retrieval, maxTokens, format, sampling),
+	}
+
+	entries, err := db.GetSemanticCacheEntries(ctx, kbID, version)
+	if err != nil {
+		s.logger.Warn("Failed to read semantic cache", zap.Error(err))
+		return lookup
+	}
+
+	cutoff := time.Now().Add(-cfg.SemanticCacheTTL)
+	for i := range entries {
+		entry := &entries[i]
+		if entry.Fingerprint != lookup.fingerprint || entry.CreatedAt.Before(cutoff) {
+			continue
+		}
+		similarity := rag.CosineSimilarity(embedding, entry.Embedding)
+		if similarity >= cfg.SemanticCacheThreshold && similarity > lookup.similarity {
+			lookup.entry = entry
+			lookup.similarity = similarity
+		}
+	}
+
+	if lookup.entry != nil {
+		s.logger.Info("Semantic cache hit",
+			zap.Uint("kb_id", kbID),
+			zap.Float64("similarity", lookup.similarity))
+	}
+	return lookup
+}
+
+// storeSemanticCache 缓存本次生成的回答，已命中缓存或未启用时不做任何事
+func (s *Service) storeSemanticCache(lookup *semanticLookup, answer, ragContext string) {
+	cfg := s.config.Snapshot()
+	if lookup == nil || lookup.entry != nil || answer == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), semanticCacheTimeout)
+	defer cancel()
+
+	entry := db.SemanticCacheEntry{
+		Query:       lookup.query,
+		Embedding:   lookup.embedding,
+		Fingerprint: lookup.fingerprint,
+		Answer:      answer,
+		Context:     ragContext,
+		CreatedAt:   time.Now(),
+	}
+	if err := db.AddSemanticCacheEntry(ctx, lookup.kbID, lookup.version, entry, cfg.SemanticCacheMaxEntries, cfg.SemanticCacheTTL); err != nil {
+		s.logger.Warn("Failed to write semantic cache", zap.Error(err))
+	}
+}
+
+// cachedStreamReader 将缓存的回答作为一条消息输出，保留原有的格式
+type cachedStreamReader struct {
+	content string
+	done    bool
+}
+
+func (r *cachedStreamReader) Recv() (*schema.Message, error) {
+	if r.done {
+		return nil, io.EOF
+	}
+	r.done = true
+	return &schema.Message{
+		Role:    schema.Assistant,
+		Content: r.content,
+	}, nil
+}
+
+func (r *cachedStreamReader) Close() {
+	r.done = true
+}
@@ -2,6 +2,8 @@ package chat
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -11,44 +13,52 @@ import (
 	"eino-rag/internal/db"
 	"eino-rag/internal/models"
 	"eino-rag/internal/services/document"
+	"eino-rag/internal/services/llm"
+	"eino-rag/internal/services/rag"
 
 	"github.com/cloudwego/eino-ext/components/model/openai"
 	"github.com/cloudwego/eino/schema"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 type Service struct {
 	chatModel  *openai.ChatModel
 	docService *document.Service
+	embedder   rag.Embedder // 可为nil，表示不使用语义缓存
 	logger     *zap.Logger
 	config     *config.Config
+
+	generationTimeout time.Duration // 创建对话模型时的超时，用于标明超时错误
 }
 
 func NewService(
 	docService *document.Service,
+	embedder rag.Embedder,
 	cfg *config.Config,
 	logger *zap.Logger,
 ) (*Service, error) {
 	service := &Service{
 		docService: docService,
+		embedder:   embedder,
 		logger:     logger,
 		config:     cfg,
+
+		generationTimeout: cfg.OpenAITimeout,
+	}
+	if service.generationTimeout <= 0 {
+		service.generationTimeout = 60 * time.Second
 	}
 
 	// 初始化ChatModel（如果配置了）
 	if cfg.OpenAIAPIKey != "" {
-		chatModelConfig := &openai.ChatModelConfig{
-			APIKey:  cfg.OpenAIAPIKey,
-			Model:   cfg.OpenAIModel,
-			Timeout: 60 * time.Second,
-		}
-
-		if cfg.OpenAIBaseURL != "" {
-			chatModelConfig.BaseURL = cfg.OpenAIBaseURL
+		chatModelConfig, err := llm.NewChatModelConfig(cfg, service.generationTimeout)
+		if err != nil {
+			logger.Warn("Invalid OpenAI client config, ChatModel disabled", zap.Error(err))
+			return service, nil
 		}
 
-		var err error
 		service.chatModel, err = openai.NewChatModel(context.Background(), chatModelConfig)
 		if err != nil {
 			logger.Warn("Failed to initialize OpenAI ChatModel", zap.Error(err))
@@ -58,7 +68,175 @@ func NewService(
 	return service, nil
 }
 
-// Chat 处理聊天请求
+// ChatOptions 单次对话的可选参数，零值表示使用默认配置
+type ChatOptions struct {
+	TopK                int            // 检索返回数量，<= 0 时使用知识库的 DefaultTopK 或配置的 TopK
+	ScoreThreshold      float32        // 检索最低相似度，<= 0 时不过滤
+	MaxTokens           int            // 回复最大token数，<= 0 时使用配置的 MaxResponseTokens
+	ContextWindow       *int           // 相邻分块扩展数量，nil 时使用配置的 ContextWindow
+	ToolCalling         *bool          // 是否由模型通过工具调用决定何时检索，nil 时使用配置的 ChatToolCalling
+	SearchEffort        int            // 检索力度（nprobe/ef），<= 0 时使用配置的默认值
+	RecencyWeight       *float64       // 时间衰减重排权重，nil 时使用知识库的设置
+	RecencyHalfLifeDays float64        // 时间衰减半衰期（天），<= 0 时使用知识库的设置或全局配置
+	MaxChunksPerDoc     *int           // 每个文档最多检索的分块数，nil 时使用配置的 MaxChunksPerDoc
+	CandidateMultiplier int            // 启用重排或筛选时多召回的倍数，<= 0 时使用配置的 RetrievalCandidateMultiplier
+	CreatorID           uint           // 只检索该用户创建的文档，0 表示不过滤
+	CreatedAfter        *time.Time     // 只检索在此时间及之后创建的文档
+	CreatedBefore       *time.Time     // 只检索在此时间之前创建的文档
+	Tags                []string       // 只检索包含全部这些标签的文档
+	ResponseFormat      ResponseFormat // 回复格式，为空时使用 Markdown
+	// 以下生成参数为空时使用模型的默认值，模型服务不支持的参数被忽略
+	Stop             []string // 停止序列，生成到其中任一序列时截止
+	PresencePenalty  *float32 // 存在惩罚，减少重复话题
+	FrequencyPenalty *float32 // 频率惩罚，减少重复用词
+	// AuthorizeKnowledgeBase 检查当前用户能否检索知识库，nil 时不检查；编辑消息时用于重新检查原回复使用的知识库
+	AuthorizeKnowledgeBase func(kbID uint) error
+}
+
+// truncatedMarker 保存时被截断的消息末尾标记
+const truncatedMarker = "\n\n[消息过长，已截断]"
+
+// TruncateMessage 按字符数截断消息用于保存，maxLen <= 0 表示不截断
+func TruncateMessage(content string, maxLen int) string {
+	if maxLen <= 0 {
+		return content
+	}
+
+	runes := []rune(content)
+	if len(runes) <= maxLen {
+		return content
+	}
+	return string(runes[:maxLen]) + truncatedMarker
+}
+
+// maxTokens 返回本次请求的回复最大token数
+func (s *Service) maxTokens(opts ChatOptions) int {
+	if opts.MaxTokens > 0 {
+		return opts.MaxTokens
+	}
+	return s.config.Snapshot().MaxResponseTokens
+}
+
+// RetrievalParams 计算本次对话实际使用的检索参数，未启用RAG时返回nil
+func (s *Service) RetrievalParams(kbID uint, useRAG bool, opts ChatOptions) *models.RetrievalParams {
+	cfg := s.config.Snapshot()
+	if !useRAG || kbID == 0 {
+		return nil
+	}
+
+	topK := document.ResolveTopK(cfg, kbID, opts.TopK)
+	recencyWeight, recencyHalfLife := document.ResolveRecency(cfg, kbID, opts.RecencyWeight, opts.RecencyHalfLifeDays)
+	if recencyWeight == 0 {
+		recencyHalfLife = 0
+	}
+
+	contextWindow := cfg.ContextWindow
+	if opts.ContextWindow != nil {
+		contextWindow = *opts.ContextWindow
+	}
+
+	return &models.RetrievalParams{
+		KnowledgeBaseID:     kbID,
+		TopK:                topK,
+		ScoreThreshold:      opts.ScoreThreshold,
+		ContextWindow:       contextWindow,
+		SearchEffort:        opts.SearchEffort,
+		RecencyWeight:       recencyWeight,
+		RecencyHalfLifeDays: recencyHalfLife,
+		MaxChunksPerDoc:     document.ResolveMaxChunksPerDoc(cfg, opts.MaxChunksPerDoc),
+		CandidateMultiplier: document.ResolveCandidateMultiplier(cfg, opts.CandidateMultiplier),
+		CreatorID:           opts.CreatorID,
+		CreatedAfter:        opts.CreatedAfter,
+		CreatedBefore:       opts.CreatedBefore,
+		Tags:                opts.Tags,
+		ToolCalling:         s.useToolCalling(opts),
+	}
+}
+
+// retrieve 按检索参数搜索相关文档，同时返回向量库是否不可用
+// 对话有附件时先检索附件，再检索指定的知识库，知识库检索失败时只使用附件的结果
+func (s *Service) retrieve(ctx context.Context, message string, params *models.RetrievalParams) ([]*schema.Document, bool, error) {
+	if params.AttachmentKnowledgeBaseID == 0 {
+		return s.retrieveFrom(ctx, message, params.KnowledgeBaseID, params)
+	}
+
+	attached, unavailable, err := s.retrieveFrom(ctx, message, params.AttachmentKnowledgeBaseID, params)
+	if err != nil || params.KnowledgeBaseID == 0 {
+		return attached, unavailable, err
+	}
+	docs, down, err := s.retrieveFrom(ctx, message, params.KnowledgeBaseID, params)
+	if err != nil {
+		s.logger.Warn("Failed to retrieve documents, using conversation attachments only", zap.Error(err))
+	}
+	return append(attached, docs...), unavailable || down, nil
+}
+
+// retrieveFrom 在一个知识库中搜索相关文档，并按需补充相邻分块，同时返回向量库是否不可用
+// 向量检索失败或没有结果且开启了 RAGFallback 时，改用按文件名和摘要匹配的降级检索
+func (s *Service) retrieveFrom(ctx context.Context, message string, kbID uint, params *models.RetrievalParams) ([]*schema.Document, bool, error) {
+	opts := rag.RetrieveOptions{
+		TopK:           params.TopK,
+		ScoreThreshold: params.ScoreThreshold,
+		SearchEffort:   params.SearchEffort,
+		// 参数已在 RetrievalParams 中确定，0 表示不启用
+		RecencyWeight:       &params.RecencyWeight,
+		RecencyHalfLifeDays: params.RecencyHalfLifeDays,
+		MaxChunksPerDoc:     &params.MaxChunksPerDoc,
+		CandidateMultiplier: params.CandidateMultiplier,
+		CreatorID:           params.CreatorID,
+		CreatedAfter:        params.CreatedAfter,
+		CreatedBefore:       params.CreatedBefore,
+		Tags:                params.Tags,
+	}
+	docs, err := s.docService.SearchDocumentsWithOptions(ctx, message, kbID, opts)
+	unavailable := rag.IsVectorStoreUnavailable(err)
+	if (err != nil || len(docs) == 0) && s.config.Snapshot().RAGFallback {
+		docs, err = s.fallbackRetrieve(ctx, message, kbID, opts, err)
+		return docs, unavailable, err
+	}
+	if err != nil || params.ContextWindow <= 0 {
+		return docs, unavailable, err
+	}
+
+	expanded, err := s.docService.ExpandContext(docs, params.ContextWindow)
+	if err != nil {
+		// 扩展失败不影响检索结果本身
+		s.logger.Warn("Failed to expand retrieval context", zap.Error(err))
+		return docs, false, nil
+	}
+	return expanded, false, nil
+}
+
+// fallbackRetrieve 执行降级检索，vectorErr 为向量检索的错误，降级检索也失败时一并返回
+func (s *Service) fallbackRetrieve(ctx context.Context, message string, kbID uint, opts rag.RetrieveOptions, vectorErr error) ([]*schema.Document, error) {
+	docs, err := s.docService.FallbackSearch(ctx, message, kbID, opts)
+	if err != nil {
+		if vectorErr != nil {
+			return nil, fmt.Errorf("%w (fallback search also failed: %v)", vectorErr, err)
+		}
+		return nil, err
+	}
+
+	if len(docs) > 0 {
+		s.logger.Warn("Using fallback retrieval by document name and summary",
+			zap.Uint("kb_id", kbID),
+			zap.Int("documents", len(docs)),
+			zap.NamedError("vector_error", vectorErr))
+	}
+	return docs, nil
+}
+
+// ChatReply 非流式聊天的结果
+type ChatReply struct {
+	Message              string
+	ConversationID       string
+	Context              string
+	SemanticCache        *SemanticCacheHit   // 回复来自语义缓存时不为nil
+	RetrievalUnavailable bool                // 启用了RAG但向量库不可用，回复没有经过知识库检索
+	Verification         *AnswerVerification // 开启回答核对时的核对结果
+}
+
+// Chat 处理聊天请求，回复来自语义缓存时返回命中信息
 func (s *Service) Chat(
 	ctx context.Context,
 	message string,
@@ -66,7 +244,8 @@ func (s *Service) Chat(
 	userID uint,
 	kbID uint,
 	useRAG bool,
-) (string, string, string, error) {
+	opts ChatOptions,
+) (*ChatReply, error) {
 	// 如果没有对话ID，创建新的
 	if conversationID == "" {
 		conversationID = uuid.New().String()
@@ -75,7 +254,17 @@ func (s *Service) Chat(
 	// 获取或创建对话
 	conv, err := s.getOrCreateConversation(ctx, conversationID, userID)
 	if err != nil {
-		return "", "", "", fmt.Errorf("failed to get conversation: %w", err)
+		return nil, fmt.Errorf("failed to get conversation: %w", err)
+	}
+	if len(conv.Messages) == 0 {
+		if err := s.EnforceConversationLimit(ctx, userID, conversationID); err != nil {
+			return nil, err
+		}
+	}
+	// 预留用户消息和回复的序号，保证先发送的消息排在前面
+	seq, err := db.ReserveMessageSeqs(ctx, conv, 2)
+	if err != nil {
+		return nil, err
 	}
 
 	// 添加用户消息
@@ -83,47 +272,138 @@ func (s *Service) Chat(
 		Role:      "user",
 		Content:   message,
 		Timestamp: time.Now(),
+		Seq:       seq,
 	}
 	conv.Messages = append(conv.Messages, userMsg)
 
-	// 准备上下文
-	var ragContext string
-	if useRAG && kbID > 0 {
-		// 检索相关文档
-		docs, err := s.docService.SearchDocuments(ctx, message, kbID, s.config.TopK)
-		if err != nil {
-			s.logger.Error("Failed to retrieve documents", zap.Error(err))
-		} else if len(docs) > 0 {
-			ragContext = s.buildRAGContext(docs)
-		}
-	}
-
 	// 生成回复
-	reply, err := s.generateReply(ctx, message, ragContext, conv.Messages)
+	retrieval := s.withAttachments(s.RetrievalParams(kbID, useRAG, opts), conversationID, userID, opts)
+	sampling := s.GenerationParams(opts)
+	gen, err := s.generate(ctx, conv.Messages, message, retrieval, s.maxTokens(opts), opts.ResponseFormat, sampling)
 	if err != nil {
-		return "", "", "", fmt.Errorf("failed to generate reply: %w", err)
+		return nil, err
 	}
 
 	// 添加助手消息
 	assistantMsg := models.ChatMessage{
-		Role:      "assistant",
-		Content:   reply,
-		Timestamp: time.Now(),
+		Role:           "assistant",
+		Content:        TruncateMessage(gen.reply, s.config.Snapshot().MaxStoredMessageLength),
+		Retrieval:      retrieval,
+		ResponseFormat: string(ResolveResponseFormat(opts.ResponseFormat)),
+		Generation:     sampling,
+		Timestamp:      time.Now(),
+		Seq:            seq + 1,
 	}
-	conv.Messages = append(conv.Messages, assistantMsg)
-	conv.UpdatedAt = time.Now()
 
-	// 保存对话
-	if err := db.SaveConversation(ctx, conv); err != nil {
+	// 保存对话，并入生成期间其他请求保存的消息
+	created, err := db.AppendMessages(ctx, conv, userMsg, assistantMsg)
+	if err != nil {
 		s.logger.Error("Failed to save conversation", zap.Error(err))
 	}
 
 	// 保存对话历史到数据库（如果是新对话）
-	if len(conv.Messages) == 2 { // 第一轮对话
+	if created {
 		s.saveConversationHistory(userID, conversationID, message)
+	} else if err == nil {
+		s.touchConversation(userID, conversationID)
 	}
 
-	return reply, conversationID, ragContext, nil
+	return &ChatReply{
+		Message:              gen.reply,
+		ConversationID:       conversationID,
+		Context:              gen.ragContext,
+		SemanticCache:        gen.semantic.hit(),
+		RetrievalUnavailable: gen.unavailable,
+		Verification:         gen.verification,
+	}, nil
+}
+
+// generation 生成一次回复的结果
+type generation struct {
+	reply       string
+	ragContext  string
+	semantic    *semanticLookup
+	unavailable bool // 向量库不可用，回复没有经过知识库检索
+	// 开启回答核对时的核对结果，没有核对时为nil
+	verification *AnswerVerification
+}
+
+// generate 为对话历史中的最后一条用户消息生成回复，返回回复、检索上下文和语义缓存查找结果
+// 生成完成后按需写入语义缓存
+func (s *Service) generate(ctx context.Context, history []models.ChatMessage, message string, retrieval *models.RetrievalParams, maxTokens int, format ResponseFormat, sampling *models.GenerationParams) (*generation, error) {
+	var err error
+	var ragContext string
+	var reply string
+	var semantic *semanticLookup
+	if s.semanticCacheable(history, retrieval) {
+		semantic = s.lookupSemanticCache(ctx, message, retrieval, maxTokens, format, sampling)
+		if semantic.hit() != nil {
+			reply = semantic.entry.Answer
+			ragContext = semantic.entry.Context
+		}
+	}
+	// 向量库不可用时不使用工具调用，检索失败的情况由下面的流程处理
+	unavailable := reply == "" && s.vectorStoreDown(retrieval)
+	if reply == "" && retrieval != nil && retrieval.ToolCalling && !unavailable {
+		// 工具调用模式由模型决定何时检索，失败时回退为先检索再生成
+		var docs []*schema.Document
+		reply, docs, err = s.replyWithTools(ctx, history, retrieval, maxTokens, format, sampling)
+		if err != nil {
+			s.logger.Warn("Tool calling failed, falling back to retrieval before generation", zap.Error(err))
+		} else if len(docs) > 0 {
+			ragContext = s.buildRAGContext(docs)
+		}
+	}
+
+	if reply == "" {
+		if retrieval != nil {
+			// 检索相关文档
+			docs, down, err := s.retrieve(ctx, message, retrieval)
+			unavailable = unavailable || down
+			if err != nil {
+				s.logger.Error("Failed to retrieve documents", zap.Error(err))
+			} else if len(docs) > 0 {
+				ragContext = s.buildRAGContext(docs)
+			}
+		}
+
+		// 生成回复
+		if s.strictUnavailable(unavailable, ragContext) {
+			reply = retrievalUnavailableReply
+		} else {
+			reply, err = s.generateReply(ctx, message, ragContext, history, maxTokens, format, sampling)
+			if err != nil {
+				return nil, rag.WrapTimeout(ctx, rag.StageGeneration, s.generationTimeout, fmt.Errorf("failed to generate reply: %w", err))
+			}
+		}
+	}
+	reply = s.FilterAnswer(reply, format)
+	var verification *AnswerVerification
+	if semantic.hit() == nil {
+		reply, verification = s.applyVerification(ctx, reply, message, ragContext, history, maxTokens, format, sampling)
+	}
+	if !unavailable {
+		s.storeSemanticCache(semantic, reply, ragContext)
+	}
+	return &generation{reply: reply, ragContext: ragContext, semantic: semantic, unavailable: unavailable, verification: verification}, nil
+}
+
+// StreamReply 流式聊天的结果
+type StreamReply struct {
+	Reader         messageStream
+	ConversationID string
+	Context        string
+	Documents      []*schema.Document
+	SemanticCache  *SemanticCacheHit // 回复来自语义缓存时不为nil
+	// 启用了RAG但向量库不可用，回复没有经过知识库检索
+	RetrievalUnavailable bool
+
+	semantic    *semanticLookup
+	conv        *models.Conversation
+	userMessage models.ChatMessage // 开始输出前已保存，回复由 SaveStreamReply 使用其后的序号保存
+	retrieval   *models.RetrievalParams
+	format      ResponseFormat
+	sampling    *models.GenerationParams
 }
 
 // ChatStream 处理流式聊天请求
@@ -134,10 +414,8 @@ func (s *Service) ChatStream(
 	userID uint,
 	kbID uint,
 	useRAG bool,
-) (interface {
-	Recv() (*schema.Message, error)
-	Close()
-}, string, string, []*schema.Document, error) {
+	opts ChatOptions,
+) (*StreamReply, error) {
 	// 如果没有对话ID，创建新的
 	if conversationID == "" {
 		conversationID = uuid.New().String()
@@ -146,44 +424,135 @@ func (s *Service) ChatStream(
 	// 获取或创建对话
 	conv, err := s.getOrCreateConversation(ctx, conversationID, userID)
 	if err != nil {
-		return nil, "", "", nil, fmt.Errorf("failed to get conversation: %w", err)
+		return nil, fmt.Errorf("failed to get conversation: %w", err)
+	}
+	if len(conv.Messages) == 0 {
+		if err := s.EnforceConversationLimit(ctx, userID, conversationID); err != nil {
+			return nil, err
+		}
 	}
 
-	// 添加用户消息
+	seq, err := db.ReserveMessageSeqs(ctx, conv, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	// 添加用户消息，开始输出前保存，客户端中途断开时也不会丢失
 	userMsg := models.ChatMessage{
 		Role:      "user",
 		Content:   message,
 		Timestamp: time.Now(),
+		Seq:       seq,
 	}
 	conv.Messages = append(conv.Messages, userMsg)
 
 	// 准备上下文
 	var ragContext string
 	var retrievedDocs []*schema.Document
-	if useRAG && kbID > 0 {
-		// 检索相关文档
-		docs, err := s.docService.SearchDocuments(ctx, message, kbID, s.config.TopK)
+	var reader messageStream
+	retrieval := s.withAttachments(s.RetrievalParams(kbID, useRAG, opts), conversationID, userID, opts)
+	sampling := s.GenerationParams(opts)
+	var semantic *semanticLookup
+	if s.semanticCacheable(conv.Messages, retrieval) {
+		semantic = s.lookupSemanticCache(ctx, message, retrieval, s.maxTokens(opts), opts.ResponseFormat, sampling)
+		if semantic.hit() != nil {
+			reader = &cachedStreamReader{content: semantic.entry.Answer}
+			ragContext = semantic.entry.Context
+		}
+	}
+	// 向量库不可用时不使用工具调用，检索失败的情况由下面的流程处理
+	unavailable := reader == nil && s.vectorStoreDown(retrieval)
+	if reader == nil && retrieval != nil && retrieval.ToolCalling && !unavailable {
+		// 工具调用模式由模型决定何时检索，失败时回退为先检索再生成
+		reader, retrievedDocs, err = s.streamWithTools(ctx, conv.Messages, retrieval, s.maxTokens(opts), opts.ResponseFormat, sampling)
 		if err != nil {
-			s.logger.Error("Failed to retrieve documents", zap.Error(err))
-		} else if len(docs) > 0 {
-			retrievedDocs = docs
-			ragContext = s.buildRAGContext(docs)
+			s.logger.Warn("Tool calling failed, falling back to retrieval before generation", zap.Error(err))
+		} else if len(retrievedDocs) > 0 {
+			ragContext = s.buildRAGContext(retrievedDocs)
+		}
+	}
+
+	if reader == nil {
+		if retrieval != nil {
+			// 检索相关文档
+			docs, down, err := s.retrieve(ctx, message, retrieval)
+			unavailable = unavailable || down
+			if err != nil {
+				s.logger.Error("Failed to retrieve documents", zap.Error(err))
+			} else if len(docs) > 0 {
+				retrievedDocs = docs
+				ragContext = s.buildRAGContext(docs)
+			}
+		}
+
+		// 生成流式回复
+		if s.strictUnavailable(unavailable, ragContext) {
+			reader = &cachedStreamReader{content: retrievalUnavailableReply}
+		} else {
+			reader, err = s.generateStreamReply(ctx, message, ragContext, conv.Messages, s.maxTokens(opts), opts.ResponseFormat, sampling)
+			if err != nil {
+				return nil, rag.WrapTimeout(ctx, rag.StageGeneration, s.generationTimeout, fmt.Errorf("failed to generate stream reply: %w", err))
+			}
 		}
 	}
 
-	// 生成流式回复
-	reader, err := s.generateStreamReply(ctx, message, ragContext, conv.Messages)
+	// 先保存用户消息，回复需要在handler中收集完整后由 SaveStreamReply 保存
+	created, err := db.AppendMessages(ctx, conv, userMsg)
 	if err != nil {
-		return nil, "", "", nil, fmt.Errorf("failed to generate stream reply: %w", err)
+		reader.Close()
+		return nil, fmt.Errorf("failed to save user message: %w", err)
 	}
+	if created {
+		s.saveConversationHistory(userID, conversationID, message)
+	} else {
+		s.touchConversation(userID, conversationID)
+	}
+
+	return &StreamReply{
+		Reader:               s.FilterStream(reader, opts.ResponseFormat),
+		ConversationID:       conversationID,
+		Context:              ragContext,
+		Documents:            retrievedDocs,
+		SemanticCache:        semantic.hit(),
+		RetrievalUnavailable: unavailable,
+		semantic:             semantic,
+		conv:                 conv,
+		userMessage:          userMsg,
+		retrieval:            retrieval,
+		format:               opts.ResponseFormat,
+		sampling:             sampling,
+	}, nil
+}
 
-	// 注意：流式聊天的对话保存需要在handler中处理，因为我们无法在这里收集完整回复
+// SaveStreamReply 保存流式聊天的回复，用户消息已在开始输出前保存，中断的回复保留已输出部分并标记为不完整
+// 回复使用请求开始时预留的序号，晚于后续消息保存时仍排在正确的位置
+func (s *Service) SaveStreamReply(ctx context.Context, reply *StreamReply, content string, incomplete bool) error {
+	assistantMsg := models.ChatMessage{
+		Role:           "assistant",
+		Content:        TruncateMessage(content, s.config.Snapshot().MaxStoredMessageLength),
+		Retrieval:      reply.retrieval,
+		Incomplete:     incomplete,
+		ResponseFormat: string(ResolveResponseFormat(reply.format)),
+		Generation:     reply.sampling,
+		Timestamp:      time.Now(),
+		Seq:            reply.userMessage.Seq + 1,
+	}
+
+	_, err := db.AppendMessages(ctx, reply.conv, assistantMsg)
+	return err
+}
 
-	return reader, conversationID, ragContext, retrievedDocs, nil
+// CacheStreamReply 流式回复完整结束后写入语义缓存，回复中断时不应调用
+// 向量库不可用时的回复没有经过检索，不写入缓存
+func (s *Service) CacheStreamReply(reply *StreamReply, content string) {
+	if reply.RetrievalUnavailable {
+		return
+	}
+	s.storeSemanticCache(reply.semantic, content, reply.Context)
 }
 
 // generateReply 生成回复
-func (s *Service) generateReply(ctx context.Context, message, ragContext string, history []models.ChatMessage) (string, error) {
+func (s *Service) generateReply(ctx context.Context, message, ragContext string, history []models.ChatMessage, maxTokens int, format ResponseFormat, sampling *models.GenerationParams) (string, error) {
 	// 如果没有配置ChatModel，返回模拟回复
 	if s.chatModel == nil {
 		if ragContext != "" {
@@ -194,38 +563,10 @@ func (s *Service) generateReply(ctx context.Context, message, ragContext string,
 	}
 
 	// 构建消息列表
-	messages := make([]*schema.Message, 0, len(history)+2)
-
-	// 添加系统消息
-	systemPrompt := "你是一个有帮助的AI助手。"
-	if ragContext != "" {
-		systemPrompt += fmt.Sprintf("\n\n请基于以下检索到的文档内容回答用户的问题：\n\n%s", ragContext)
-	}
-
-	messages = append(messages, &schema.Message{
-		Role:    schema.System,
-		Content: systemPrompt,
-	})
-
-	// 添加历史消息（限制最近10条）
-	start := 0
-	if len(history) > 10 {
-		start = len(history) - 10
-	}
-
-	for i := start; i < len(history); i++ {
-		role := schema.User
-		if history[i].Role == "assistant" {
-			role = schema.Assistant
-		}
-		messages = append(messages, &schema.Message{
-			Role:    role,
-			Content: history[i].Content,
-		})
-	}
+	messages := buildPrompt(ragContext, history, format)
 
 	// 调用ChatModel
-	resp, err := s.chatModel.Generate(ctx, messages)
+	resp, err := s.chatModel.Generate(ctx, messages, s.modelOptions(maxTokens, format, sampling)...)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate response: %w", err)
 	}
@@ -237,8 +578,42 @@ func (s *Service) generateReply(ctx context.Context, message, ragContext string,
 	return resp.Content, nil
 }
 
+// resumePrompt 流式回复中断后要求模型接着已输出内容继续
+const resumePrompt = "你的上一条回复在中途被中断了。请从中断处直接继续输出，不要重复已经输出的内容，也不要添加任何说明。"
+
+// ResumeStream 流式回复中途出错后，基于已输出的部分内容继续生成
+func (s *Service) ResumeStream(
+	ctx context.Context,
+	conversationID string,
+	userID uint,
+	message string,
+	ragContext string,
+	partial string,
+	opts ChatOptions,
+) (interface {
+	Recv() (*schema.Message, error)
+	Close()
+}, error) {
+	conv, err := s.getOrCreateConversation(ctx, conversationID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation: %w", err)
+	}
+
+	// 本轮的用户消息已在开始输出前保存，在末尾补上已输出的部分回复和继续指令
+	history := append(conv.Messages,
+		models.ChatMessage{Role: "assistant", Content: partial},
+		models.ChatMessage{Role: "user", Content: resumePrompt},
+	)
+
+	reader, err := s.generateStreamReply(ctx, message, ragContext, history, s.maxTokens(opts), opts.ResponseFormat, s.GenerationParams(opts))
+	if err != nil {
+		return nil, rag.WrapTimeout(ctx, rag.StageGeneration, s.generationTimeout, fmt.Errorf("failed to resume stream reply: %w", err))
+	}
+	return s.FilterStream(reader, opts.ResponseFormat), nil
+}
+
 // generateStreamReply 生成流式回复
-func (s *Service) generateStreamReply(ctx context.Context, message, ragContext string, history []models.ChatMessage) (interface {
+func (s *Service) generateStreamReply(ctx context.Context, message, ragContext string, history []models.ChatMessage, maxTokens int, format ResponseFormat, sampling *models.GenerationParams) (interface {
 	Recv() (*schema.Message, error)
 	Close()
 }, error) {
@@ -256,20 +631,29 @@ func (s *Service) generateStreamReply(ctx context.Context, message, ragContext s
 	}
 
 	// 构建消息列表
-	messages := make([]*schema.Message, 0, len(history)+2)
+	messages := buildPrompt(ragContext, history, format)
 
-	// 添加系统消息
+	// 直接返回ChatModel的Stream结果
+	return s.chatModel.Stream(ctx, messages, s.modelOptions(maxTokens, format, sampling)...)
+}
+
+// buildPrompt 构建生成回复时发送给模型的完整消息列表，系统消息包含检索上下文和回复格式说明
+func buildPrompt(ragContext string, history []models.ChatMessage, format ResponseFormat) []*schema.Message {
 	systemPrompt := "你是一个有帮助的AI助手。"
 	if ragContext != "" {
 		systemPrompt += fmt.Sprintf("\n\n请基于以下检索到的文档内容回答用户的问题：\n\n%s", ragContext)
 	}
+	return buildMessages(withFormatInstruction(systemPrompt, format), history)
+}
 
+// buildMessages 构建发送给模型的消息列表：系统消息加最近10条历史消息
+func buildMessages(systemPrompt string, history []models.ChatMessage) []*schema.Message {
+	messages := make([]*schema.Message, 0, len(history)+2)
 	messages = append(messages, &schema.Message{
 		Role:    schema.System,
 		Content: systemPrompt,
 	})
 
-	// 添加历史消息（限制最近10条）
 	start := 0
 	if len(history) > 10 {
 		start = len(history) - 10
@@ -285,9 +669,7 @@ func (s *Service) generateStreamReply(ctx context.Context, message, ragContext s
 			Content: history[i].Content,
 		})
 	}
-
-	// 直接返回ChatModel的Stream结果
-	return s.chatModel.Stream(ctx, messages)
+	return messages
 }
 
 // buildRAGContext 构建RAG上下文
@@ -295,7 +677,13 @@ func (s *Service) buildRAGContext(docs []*schema.Document) string {
 	var context strings.Builder
 
 	for i, doc := range docs {
-		context.WriteString(fmt.Sprintf("文档 %d:\n", i+1))
+		if doc.MetaData["type"] == rag.ChunkTypeFallback {
+			// 降级检索只按文件名和摘要匹配，提示模型内容未必与问题相关
+			fileName, _ := doc.MetaData["file_name"].(string)
+			context.WriteString(fmt.Sprintf("文档 %d（降级检索：按文件名或摘要匹配到《%s》，内容可能与问题无关）:\n", i+1, fileName))
+		} else {
+			context.WriteString(fmt.Sprintf("文档 %d:\n", i+1))
+		}
 		context.WriteString(doc.Content)
 		context.WriteString("\n\n")
 
@@ -343,16 +731,10 @@ func (s *Service) getOrCreateConversation(ctx context.Context, convID string, us
 func (s *Service) saveConversationHistory(userID uint, convID string, firstMessage string) {
 	database := db.GetDB()
 
-	// 提取标题（取前50个字符）
-	title := firstMessage
-	if len(title) > 50 {
-		title = title[:50] + "..."
-	}
-
 	history := &models.ChatHistory{
 		UserID:         userID,
 		ConversationID: convID,
-		Title:          title,
+		Title:          conversationTitle(firstMessage),
 		CreatedAt:      time.Now(),
 		UpdatedAt:      time.Now(),
 	}
@@ -362,21 +744,48 @@ func (s *Service) saveConversationHistory(userID uint, convID string, firstMessa
 	}
 }
 
+// conversationTitle 由第一条消息生成对话标题（取前50个字符）
+func conversationTitle(firstMessage string) string {
+	if len(firstMessage) > 50 {
+		return firstMessage[:50] + "..."
+	}
+	return firstMessage
+}
+
+// ConversationFilter 对话列表过滤条件，零值表示不过滤
+type ConversationFilter struct {
+	Folder string
+	Tag    string
+}
+
 // GetUserConversations 获取用户的对话列表
-func (s *Service) GetUserConversations(userID uint, page, pageSize int) ([]models.ChatHistory, int64, error) {
+func (s *Service) GetUserConversations(userID uint, filter ConversationFilter, page, pageSize int) ([]models.ChatHistory, int64, error) {
 	database := db.GetDB()
 
 	var total int64
 	var histories []models.ChatHistory
 
+	filterScope := func(tx *gorm.DB) *gorm.DB {
+		tx = tx.Where("user_id = ?", userID)
+		if filter.Folder != "" {
+			tx = tx.Where("folder = ?", filter.Folder)
+		}
+		if filter.Tag != "" {
+			// 标签以JSON数组保存，按带引号的完整元素匹配
+			encoded, _ := json.Marshal(filter.Tag)
+			tx = tx.Where("tags LIKE ? ESCAPE '\\'", "%"+escapeLike(string(encoded))+"%")
+		}
+		return tx
+	}
+
 	// 计算总数
-	if err := database.Model(&models.ChatHistory{}).Where("user_id = ?", userID).Count(&total).Error; err != nil {
+	if err := database.Model(&models.ChatHistory{}).Scopes(filterScope).Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
 
 	// 分页查询
 	offset := (page - 1) * pageSize
-	if err := database.Where("user_id = ?", userID).
+	if err := database.Scopes(filterScope).
 		Offset(offset).
 		Limit(pageSize).
 		Order("created_at DESC").
@@ -387,6 +796,73 @@ func (s *Service) GetUserConversations(userID uint, page, pageSize int) ([]model
 	return histories, total, nil
 }
 
+// UpdateConversationMeta 设置对话的文件夹和标签，nil 表示不修改该字段
+func (s *Service) UpdateConversationMeta(convID string, userID uint, folder *string, tags []string) (*models.ChatHistory, error) {
+	database := db.GetDB()
+
+	var history models.ChatHistory
+	if err := database.Where("conversation_id = ?", convID).First(&history).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("conversation not found")
+		}
+		return nil, err
+	}
+
+	// 验证用户权限
+	if history.UserID != userID {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	// 只更新请求中提供的字段，使用结构体更新以便标签走JSON序列化
+	columns := []string{"updated_at"}
+	if folder != nil {
+		history.Folder = strings.TrimSpace(*folder)
+		columns = append(columns, "folder")
+	}
+	if tags != nil {
+		normalized, err := normalizeTags(tags)
+		if err != nil {
+			return nil, err
+		}
+		history.Tags = normalized
+		columns = append(columns, "tags")
+	}
+	history.UpdatedAt = time.Now()
+
+	if err := database.Model(&history).Select(columns).Updates(&history).Error; err != nil {
+		return nil, fmt.Errorf("failed to update conversation: %w", err)
+	}
+
+	return &history, nil
+}
+
+// ErrInvalidTag 标签包含不允许的字符
+var ErrInvalidTag = errors.New("tags must not contain quotes or backslashes")
+
+// normalizeTags 去除空白、空标签和重复标签，保持原有顺序
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if strings.ContainsAny(tag, "\"\\") {
+			return nil, ErrInvalidTag
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized, nil
+}
+
+// escapeLike 转义 LIKE 通配符
+func escapeLike(s string) string {
+	replacer := strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_")
+	return replacer.Replace(s)
+}
+
 // GetConversationMessages 获取对话消息
 func (s *Service) GetConversationMessages(ctx context.Context, convID string, userID uint) ([]models.ChatMessage, error) {
 	conv, err := db.GetConversation(ctx, convID)
@@ -0,0 +1,234 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"eino-rag/internal/models"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"go.uber.org/zap"
+)
+
+// searchToolName 工具调用模式下提供给模型的知识库检索工具名
+const searchToolName = "search_knowledge_base"
+
+// maxToolRounds 单次回复中模型最多调用工具的轮数，超过后不再提供工具，直接生成回复
+const maxToolRounds = 3
+
+// toolSystemPrompt 工具调用模式的系统提示
+const toolSystemPrompt = "你是一个有帮助的AI助手。当问题需要查阅知识库中的资料时，请调用 search_knowledge_base 工具检索，并基于检索结果回答；检索不到相关内容时请如实说明。"
+
+// searchToolInfo 知识库检索工具的定义
+var searchToolInfo = &schema.ToolInfo{
+	Name: searchToolName,
+	Desc: "在当前知识库中检索与查询相关的文档片段",
+	ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+		"query": {
+			Type:     schema.String,
+			Desc:     "检索查询，使用与问题相关的关键词或完整问句",
+			Required: true,
+		},
+	}),
+}
+
+// messageStream 流式回复
+type messageStream interface {
+	Recv() (*schema.Message, error)
+	Close()
+}
+
+// useToolCalling 判断本次对话是否使用工具调用模式，未配置模型时始终为false
+func (s *Service) useToolCalling(opts ChatOptions) bool {
+	if s.chatModel == nil {
+		return false
+	}
+	if opts.ToolCalling != nil {
+		return *opts.ToolCalling
+	}
+	return s.config.Snapshot().ChatToolCalling
+}
+
+// streamWithTools 工具调用模式生成流式回复，由模型通过 search_knowledge_base 工具自行决定何时检索
+// 返回最终回复的流和所有工具调用检索到的文档
+func (s *Service) streamWithTools(ctx context.Context, history []models.ChatMessage, params *models.RetrievalParams, maxTokens int, format ResponseFormat, sampling *models.GenerationParams) (messageStream, []*schema.Document, error) {
+	messages := buildMessages(withFormatInstruction(toolSystemPrompt, format), history)
+
+	modelOpts := s.modelOptions(maxTokens, format, sampling)
+	toolOpts := append(modelOpts[:len(modelOpts):len(modelOpts)], model.WithTools([]*schema.ToolInfo{searchToolInfo}))
+
+	var docs []*schema.Document
+	for round := 0; round < maxToolRounds; round++ {
+		stream, err := s.chatModel.Stream(ctx, messages, toolOpts...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to stream with tools: %w", err)
+		}
+
+		reply, toolCall, err := peekToolCalls(stream)
+		if err != nil {
+			return nil, nil, err
+		}
+		if toolCall == nil {
+			return reply, uniqueDocuments(docs), nil
+		}
+
+		// 执行工具调用，并把结果反馈给模型继续生成
+		messages = append(messages, toolCall)
+		for _, call := range toolCall.ToolCalls {
+			content, found := s.runSearchTool(ctx, call, params)
+			docs = append(docs, found...)
+			messages = append(messages, schema.ToolMessage(content, call.ID, schema.WithToolName(call.Function.Name)))
+		}
+	}
+
+	s.logger.Warn("Tool calling reached max rounds, generating without tools",
+		zap.Int("max_rounds", maxToolRounds))
+	stream, err := s.chatModel.Stream(ctx, messages, modelOpts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to stream final reply: %w", err)
+	}
+	return stream, uniqueDocuments(docs), nil
+}
+
+// replyWithTools 工具调用模式生成完整回复
+func (s *Service) replyWithTools(ctx context.Context, history []models.ChatMessage, params *models.RetrievalParams, maxTokens int, format ResponseFormat, sampling *models.GenerationParams) (string, []*schema.Document, error) {
+	stream, docs, err := s.streamWithTools(ctx, history, params, maxTokens, format, sampling)
+	if err != nil {
+		return "", nil, err
+	}
+	reply, err := collectStream(stream)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read reply: %w", err)
+	}
+	return reply, docs, nil
+}
+
+// runSearchTool 执行一次工具调用，返回反馈给模型的内容和检索到的文档
+func (s *Service) runSearchTool(ctx context.Context, call schema.ToolCall, params *models.RetrievalParams) (string, []*schema.Document) {
+	if call.Function.Name != searchToolName {
+		return fmt.Sprintf("未知工具：%s", call.Function.Name), nil
+	}
+
+	var args struct {
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil || strings.TrimSpace(args.Query) == "" {
+		return "参数错误：需要提供非空的 query", nil
+	}
+
+	s.logger.Debug("Model requested knowledge base search",
+		zap.String("query", args.Query),
+		zap.Uint("kb_id", params.KnowledgeBaseID))
+
+	found, _, err := s.retrieve(ctx, args.Query, params)
+	if err != nil {
+		s.logger.Error("Failed to retrieve documents for tool call", zap.Error(err))
+		return "检索失败，知识库暂时不可用", nil
+	}
+	if len(found) == 0 {
+		return "未检索到相关内容", nil
+	}
+	return s.buildRAGContext(found), found
+}
+
+// peekToolCalls 读取流的开头判断模型是直接回复还是调用工具
+// 直接回复时返回可继续读取的流；调用工具时读完整个流，返回合并后的工具调用消息
+func peekToolCalls(stream *schema.StreamReader[*schema.Message]) (messageStream, *schema.Message, error) {
+	var buffered []*schema.Message
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			stream.Close()
+			return &bufferedStream{buffered: buffered}, nil, nil
+		}
+		if err != nil {
+			stream.Close()
+			return nil, nil, fmt.Errorf("failed to read model stream: %w", err)
+		}
+
+		buffered = append(buffered, chunk)
+		if len(chunk.ToolCalls) > 0 {
+			break
+		}
+		if chunk.Content != "" {
+			return &bufferedStream{buffered: buffered, stream: stream}, nil, nil
+		}
+	}
+
+	defer stream.Close()
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read tool call stream: %w", err)
+		}
+		buffered = append(buffered, chunk)
+	}
+
+	msg, err := schema.ConcatMessages(buffered)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to merge tool call chunks: %w", err)
+	}
+	return nil, msg, nil
+}
+
+// bufferedStream 先返回已读取的分片，再继续读取剩余的流
+type bufferedStream struct {
+	buffered []*schema.Message
+	stream   *schema.StreamReader[*schema.Message]
+}
+
+func (b *bufferedStream) Recv() (*schema.Message, error) {
+	if len(b.buffered) > 0 {
+		msg := b.buffered[0]
+		b.buffered = b.buffered[1:]
+		return msg, nil
+	}
+	if b.stream == nil {
+		return nil, io.EOF
+	}
+	return b.stream.Recv()
+}
+
+func (b *bufferedStream) Close() {
+	if b.stream != nil {
+		b.stream.Close()
+	}
+}
+
+// collectStream 读完流式回复并拼接为完整内容
+func collectStream(stream messageStream) (string, error) {
+	defer stream.Close()
+
+	var reply strings.Builder
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return reply.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		reply.WriteString(chunk.Content)
+	}
+}
+
+// uniqueDocuments 按ID去重，保留首次出现的顺序
+func uniqueDocuments(docs []*schema.Document) []*schema.Document {
+	seen := make(map[string]bool, len(docs))
+	unique := make([]*schema.Document, 0, len(docs))
+	for _, doc := range docs {
+		if seen[doc.ID] {
+			continue
+		}
+		seen[doc.ID] = true
+		unique = append(unique, doc)
+	}
+	return unique
+}
@@ -0,0 +1,112 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/document"
+	"eino-rag/internal/services/rag"
+
+	"github.com/cloudwego/eino/schema"
+	"go.uber.org/zap"
+)
+
+// 对话追踪
+//
+// 排查回答质量问题时需要区分是检索还是生成出了问题。Trace 执行一次完整的RAG对话并返回每一步的中间结果：
+// 检索参数、查询扩展生成的变体、检索到的分块及分数、拼接的上下文、发送给模型的完整消息和最终回答。
+// 追踪不使用语义缓存和工具调用，也不核对回答，始终按"先检索再生成"的流程执行；结果不保存到对话，
+// 指定对话时只读取其历史消息。接口会暴露提示词和检索内容，只对管理员开放并按 CHAT_TRACE_RATE_LIMIT 限流。
+
+// TraceMessage 发送给模型的一条消息
+type TraceMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Trace 一次对话各步骤的中间结果
+type Trace struct {
+	Query                string
+	QueryVariants        []string                // 开启查询扩展时额外检索的改写
+	Retrieval            *models.RetrievalParams // 未启用RAG时为nil
+	Documents            []*schema.Document
+	RetrievalError       string // 检索失败的原因，失败时在没有上下文的情况下继续生成
+	RetrievalUnavailable bool   // 向量库不可用，回复没有经过知识库检索
+	Context              string
+	Prompt               []TraceMessage
+	RawAnswer            string // 模型的原始输出
+	Answer               string // 经过后处理过滤器后的回答
+	RetrievalDuration    time.Duration
+	GenerationDuration   time.Duration
+}
+
+// Trace 执行一次对话并返回各步骤的中间结果，回复不保存到对话
+func (s *Service) Trace(
+	ctx context.Context,
+	message string,
+	conversationID string,
+	userID uint,
+	kbID uint,
+	useRAG bool,
+	opts ChatOptions,
+) (*Trace, error) {
+	var history []models.ChatMessage
+	if conversationID != "" {
+		messages, err := s.GetConversationMessages(ctx, conversationID, userID)
+		if err != nil {
+			return nil, err
+		}
+		history = messages
+	}
+	history = append(history, models.ChatMessage{Role: "user", Content: message, Timestamp: time.Now()})
+
+	trace := &Trace{Query: message}
+	if conversationID != "" {
+		trace.Retrieval = s.withAttachments(s.RetrievalParams(kbID, useRAG, opts), conversationID, userID, opts)
+	} else {
+		trace.Retrieval = s.RetrievalParams(kbID, useRAG, opts)
+	}
+	if trace.Retrieval != nil {
+		trace.Retrieval.ToolCalling = false
+	}
+
+	trace.RetrievalUnavailable = s.vectorStoreDown(trace.Retrieval)
+	if trace.Retrieval != nil {
+		start := time.Now()
+		retrieveCtx, recorder := document.WithVariantRecorder(ctx)
+		docs, down, err := s.retrieve(retrieveCtx, message, trace.Retrieval)
+		trace.RetrievalDuration = time.Since(start)
+		trace.QueryVariants = recorder.Variants()
+		trace.RetrievalUnavailable = trace.RetrievalUnavailable || down
+		if err != nil {
+			s.logger.Warn("Failed to retrieve documents for trace", zap.Error(err))
+			trace.RetrievalError = err.Error()
+		} else {
+			trace.Documents = docs
+			if len(docs) > 0 {
+				trace.Context = s.buildRAGContext(docs)
+			}
+		}
+	}
+
+	format := opts.ResponseFormat
+	for _, msg := range buildPrompt(trace.Context, history, format) {
+		trace.Prompt = append(trace.Prompt, TraceMessage{Role: string(msg.Role), Content: msg.Content})
+	}
+
+	if s.strictUnavailable(trace.RetrievalUnavailable, trace.Context) {
+		trace.RawAnswer = retrievalUnavailableReply
+	} else {
+		start := time.Now()
+		reply, err := s.generateReply(ctx, message, trace.Context, history, s.maxTokens(opts), format, s.GenerationParams(opts))
+		trace.GenerationDuration = time.Since(start)
+		if err != nil {
+			return nil, rag.WrapTimeout(ctx, rag.StageGeneration, s.generationTimeout, fmt.Errorf("failed to generate reply: %w", err))
+		}
+		trace.RawAnswer = reply
+	}
+	trace.Answer = s.FilterAnswer(trace.RawAnswer, format)
+	return trace, nil
+}
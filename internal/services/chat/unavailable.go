@@ -0,0 +1,27 @@
+package chat
+
+import (
+	"eino-rag/internal/models"
+)
+
+// 向量库不可用
+//
+// Milvus 未配置、断开或熔断时检索必然失败，这与"检索成功但没有相关文档"不同：
+// 此时的回答没有经过知识库检索，需要让用户知道。启用RAG的对话遇到这种情况时：
+//   - 回复（ChatReply、StreamReply、EditResult）带上 RetrievalUnavailable 标记
+//   - 不使用工具调用模式，直接走先检索再生成的流程，开启 RAG_FALLBACK 时仍可使用降级检索的上下文
+//   - 开启 RAG_STRICT 且没有任何上下文时不调用模型，直接回复 retrievalUnavailableReply
+//   - 不写入语义缓存，避免知识库恢复后继续返回没有依据的回答
+
+// retrievalUnavailableReply 严格模式下向量库不可用时的回复
+const retrievalUnavailableReply = "抱歉，知识库检索服务暂时不可用，无法基于知识库内容回答您的问题，请稍后重试。"
+
+// vectorStoreDown 启用RAG时，在检索前判断向量库是否已知不可用
+func (s *Service) vectorStoreDown(retrieval *models.RetrievalParams) bool {
+	return retrieval != nil && !s.docService.VectorStoreAvailable()
+}
+
+// strictUnavailable 是否应以 retrievalUnavailableReply 代替模型回答
+func (s *Service) strictUnavailable(unavailable bool, ragContext string) bool {
+	return unavailable && ragContext == "" && s.config.Snapshot().RAGStrict
+}
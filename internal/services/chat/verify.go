@@ -0,0 +1,176 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/models"
+
+	"github.com/cloudwego/eino/schema"
+	"go.uber.org/zap"
+)
+
+// 回答核对（cite or refuse）
+//
+// 开启 ANSWER_VERIFICATION 后，有检索上下文的回答生成后再调用一次模型，逐条核对回答中的论断是否有检索到的内容支持，
+// 核对结果（有依据和无依据的论断）随回复返回。发现无依据的论断时按 ANSWER_VERIFICATION_ACTION 处理：
+//   - flag        只在响应中标记
+//   - note        在回答末尾附加可信度提示，JSON 格式的回答不附加
+//   - regenerate  把无依据的论断交给模型，要求只根据检索内容重新回答，新回答不再核对；流式回答已经发出，按 note 处理
+//
+// 每次回答多一次（regenerate 时两次）模型调用，因此默认关闭。没有检索到内容、回答来自语义缓存或
+// 向量库不可用时的固定回复不核对，核对失败时原样返回回答。
+
+// verificationMaxTokens 核对结果的最大token数
+const verificationMaxTokens = 1024
+
+const verificationPrompt = `你是一个事实核查助手。请把下面的回答拆分为独立的事实性论断，逐条判断是否能由检索到的文档内容直接支持。
+问候、过渡语和对问题的复述不算论断。只输出如下格式的JSON，不要输出其他内容：
+{"claims":[{"claim":"论断原文","supported":true}]}
+
+检索到的文档内容：
+%s
+
+回答：
+%s`
+
+const regeneratePrompt = `上一次的回答中以下论断没有检索到的文档内容支持：
+%s
+请只根据检索到的文档内容重新回答用户的问题，删除或改正这些论断；文档中没有相关信息时直接说明无法从知识库中找到答案。`
+
+// verificationNote 回答中有无依据的论断时附加的提示，%d 为无依据的论断数
+const verificationNote = "\n\n> 注意：回答中有 %d 处内容未能在检索到的文档中找到依据，请谨慎参考。"
+
+// AnswerVerification 回答的核对结果
+type AnswerVerification struct {
+	Supported   []string                        `json:"supported"`             // 有检索内容支持的论断
+	Unsupported []string                        `json:"unsupported"`           // 没有检索内容支持的论断
+	Action      config.AnswerVerificationAction `json:"action,omitempty"`      // 对无依据论断实际采取的处理，没有无依据论断时为空
+	Regenerated bool                            `json:"regenerated,omitempty"` // 回答已按核对结果重新生成，新回答未再核对
+}
+
+// verificationResult 模型输出的核对结果
+type verificationResult struct {
+	Claims []struct {
+		Claim     string `json:"claim"`
+		Supported bool   `json:"supported"`
+	} `json:"claims"`
+}
+
+// shouldVerify 是否需要核对回答，未配置模型或没有检索上下文时不核对
+func (s *Service) shouldVerify(ragContext string) bool {
+	return s.chatModel != nil && ragContext != "" && s.config.Snapshot().AnswerVerification
+}
+
+// verifyAnswer 调用模型核对回答中的论断
+func (s *Service) verifyAnswer(ctx context.Context, answer, ragContext string) (*AnswerVerification, error) {
+	messages := []*schema.Message{
+		schema.UserMessage(fmt.Sprintf(verificationPrompt, ragContext, answer)),
+	}
+	resp, err := s.chatModel.Generate(ctx, messages, s.modelOptions(verificationMaxTokens, ResponseFormatJSON, nil)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify answer: %w", err)
+	}
+	return ParseVerification(resp.Content)
+}
+
+// ParseVerification 解析模型输出的核对结果，允许JSON前后有多余的文字或代码块标记
+func ParseVerification(content string) (*AnswerVerification, error) {
+	start, end := strings.Index(content, "{"), strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return nil, errors.New("verification result is not JSON")
+	}
+	var result verificationResult
+	if err := json.Unmarshal([]byte(content[start:end+1]), &result); err != nil {
+		return nil, fmt.Errorf("invalid verification result: %w", err)
+	}
+
+	verification := &AnswerVerification{Supported: []string{}, Unsupported: []string{}}
+	for _, claim := range result.Claims {
+		text := strings.TrimSpace(claim.Claim)
+		if text == "" {
+			continue
+		}
+		if claim.Supported {
+			verification.Supported = append(verification.Supported, text)
+		} else {
+			verification.Unsupported = append(verification.Unsupported, text)
+		}
+	}
+	return verification, nil
+}
+
+// VerificationNote 返回附加在回答末尾的可信度提示，没有无依据的论断时为空
+func VerificationNote(verification *AnswerVerification) string {
+	if verification == nil || len(verification.Unsupported) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(verificationNote, len(verification.Unsupported))
+}
+
+// applyVerification 核对非流式回答并按配置处理无依据的论断，返回处理后的回答和核对结果
+func (s *Service) applyVerification(ctx context.Context, reply, message, ragContext string, history []models.ChatMessage, maxTokens int, format ResponseFormat, sampling *models.GenerationParams) (string, *AnswerVerification) {
+	if !s.shouldVerify(ragContext) {
+		return reply, nil
+	}
+	verification, err := s.verifyAnswer(ctx, reply, ragContext)
+	if err != nil {
+		s.logger.Warn("Answer verification failed, returning unverified answer", zap.Error(err))
+		return reply, nil
+	}
+	if len(verification.Unsupported) == 0 {
+		return reply, verification
+	}
+
+	action := s.config.Snapshot().AnswerVerificationAction
+	if action == config.AnswerVerificationRegenerate {
+		regenerated, err := s.regenerateSupported(ctx, reply, message, ragContext, history, maxTokens, format, sampling, verification.Unsupported)
+		if err == nil {
+			verification.Action = action
+			verification.Regenerated = true
+			return s.FilterAnswer(regenerated, format), verification
+		}
+		s.logger.Warn("Failed to regenerate answer without unsupported claims, appending note instead", zap.Error(err))
+		action = config.AnswerVerificationNote
+	}
+	if action == config.AnswerVerificationNote && ResolveResponseFormat(format) != ResponseFormatJSON {
+		verification.Action = action
+		return reply + VerificationNote(verification), verification
+	}
+	verification.Action = config.AnswerVerificationFlag
+	return reply, verification
+}
+
+// regenerateSupported 在对话末尾补上原回答和无依据的论断，要求模型只根据检索内容重新回答
+func (s *Service) regenerateSupported(ctx context.Context, reply, message, ragContext string, history []models.ChatMessage, maxTokens int, format ResponseFormat, sampling *models.GenerationParams, unsupported []string) (string, error) {
+	history = append(history[:len(history):len(history)],
+		models.ChatMessage{Role: "assistant", Content: reply},
+		models.ChatMessage{Role: "user", Content: fmt.Sprintf(regeneratePrompt, "- "+strings.Join(unsupported, "\n- "))},
+	)
+	return s.generateReply(ctx, message, ragContext, history, maxTokens, format, sampling)
+}
+
+// VerifyStreamReply 核对已完整输出的流式回答，流式回答无法重新生成，有无依据的论断时按配置返回需要追加输出的提示
+func (s *Service) VerifyStreamReply(ctx context.Context, reply *StreamReply, content string) (*AnswerVerification, string) {
+	if reply.SemanticCache != nil || !s.shouldVerify(reply.Context) {
+		return nil, ""
+	}
+	verification, err := s.verifyAnswer(ctx, content, reply.Context)
+	if err != nil {
+		s.logger.Warn("Stream answer verification failed", zap.Error(err))
+		return nil, ""
+	}
+	if len(verification.Unsupported) == 0 {
+		return verification, ""
+	}
+	if s.config.Snapshot().AnswerVerificationAction == config.AnswerVerificationFlag || ResolveResponseFormat(reply.format) == ResponseFormatJSON {
+		verification.Action = config.AnswerVerificationFlag
+		return verification, ""
+	}
+	verification.Action = config.AnswerVerificationNote
+	return verification, VerificationNote(verification)
+}
@@ -0,0 +1,166 @@
+package document
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 对话附件
+//
+// 用户可以把文档直接上传到对话中（"分析这个PDF"），不加入任何持久的知识库。每个对话的附件放在一个专用的知识库中，
+// 知识库的 conversation_id 标明所属对话：解析、切分和向量化与普通上传相同，检索时按该知识库过滤，只在所属对话中使用。
+//
+// 附件知识库不出现在知识库列表中。对话被删除时附件一并删除；对话超过 CONVERSATION_ATTACHMENT_TTL 没有新消息时，
+// 附件由保留期限清理任务删除，与Redis中对话的过期时间一致。
+
+// conversationKBName 附件知识库的名称
+const conversationKBName = "conversation attachments"
+
+// PersistentKnowledgeBases 只查询普通知识库，排除对话附件知识库
+func PersistentKnowledgeBases(tx *gorm.DB) *gorm.DB {
+	return tx.Where("conversation_id IS NULL OR conversation_id = ''")
+}
+
+// isAttachmentKnowledgeBase 知识库是否是对话附件知识库，附件知识库的向量写入默认分区
+func isAttachmentKnowledgeBase(kbID uint) (bool, error) {
+	var count int64
+	if err := db.GetDB().Model(&models.KnowledgeBase{}).Unscoped().
+		Where("id = ? AND conversation_id <> ''", kbID).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check knowledge base: %w", err)
+	}
+	return count > 0, nil
+}
+
+// AttachmentKnowledgeBaseIDs 返回所有对话附件知识库的ID，迁移向量分区时跳过
+func AttachmentKnowledgeBaseIDs() ([]uint, error) {
+	var ids []uint
+	if err := db.GetDB().Model(&models.KnowledgeBase{}).Unscoped().
+		Where("conversation_id <> ''").Pluck("id", &ids).Error; err != nil {
+		return nil, fmt.Errorf("failed to list attachment knowledge bases: %w", err)
+	}
+	return ids, nil
+}
+
+// attachmentExpiry 从现在起附件的过期时间
+func (s *Service) attachmentExpiry() time.Time {
+	ttl := s.config.Snapshot().ConversationAttachmentTTL
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return time.Now().Add(ttl)
+}
+
+// ConversationKnowledgeBase 返回对话的附件知识库，对话没有附件时返回nil
+func (s *Service) ConversationKnowledgeBase(convID string) (*models.KnowledgeBase, error) {
+	var kb models.KnowledgeBase
+	err := db.GetDB().Where("conversation_id = ?", convID).First(&kb).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation attachments: %w", err)
+	}
+	return &kb, nil
+}
+
+// AttachToConversation 把文档上传到对话的附件知识库，对话还没有附件时先创建知识库
+func (s *Service) AttachToConversation(ctx context.Context, convID string, userID uint, filename string, content io.Reader, opts UploadOptions) (*models.Document, int, error) {
+	kb, err := s.ConversationKnowledgeBase(convID)
+	if err != nil {
+		return nil, 0, err
+	}
+	expiresAt := s.attachmentExpiry()
+	if kb == nil {
+		kb = &models.KnowledgeBase{
+			Name:           conversationKBName,
+			Description:    "Documents attached to conversation " + convID,
+			CreatorID:      userID,
+			ConversationID: convID,
+			ExpiresAt:      &expiresAt,
+		}
+		if err := db.GetDB().Create(kb).Error; err != nil {
+			return nil, 0, fmt.Errorf("failed to create conversation attachments: %w", err)
+		}
+	} else if err := db.GetDB().Model(kb).Update("expires_at", expiresAt).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to update conversation attachments: %w", err)
+	}
+
+	return s.UploadDocument(ctx, filename, content, kb.ID, userID, opts)
+}
+
+// TouchConversationAttachments 对话有新消息时延长附件的过期时间
+func (s *Service) TouchConversationAttachments(convID string) {
+	if err := db.GetDB().Model(&models.KnowledgeBase{}).
+		Where("conversation_id = ?", convID).
+		Update("expires_at", s.attachmentExpiry()).Error; err != nil {
+		s.logger.Warn("Failed to extend conversation attachments", zap.String("conversation_id", convID), zap.Error(err))
+	}
+}
+
+// DeleteConversationAttachments 删除对话的附件：文档、分块、向量和附件知识库
+func (s *Service) DeleteConversationAttachments(ctx context.Context, convIDs ...string) error {
+	if len(convIDs) == 0 {
+		return nil
+	}
+	var kbs []models.KnowledgeBase
+	if err := db.GetDB().Where("conversation_id IN ?", convIDs).Find(&kbs).Error; err != nil {
+		return fmt.Errorf("failed to list conversation attachments: %w", err)
+	}
+	for _, kb := range kbs {
+		if err := s.deleteAttachmentKnowledgeBase(ctx, kb.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteExpiredAttachments 删除 now 时已过期的对话附件，返回附件被删除的对话ID
+func (s *Service) DeleteExpiredAttachments(ctx context.Context, now time.Time) ([]string, error) {
+	var kbs []models.KnowledgeBase
+	if err := db.GetDB().WithContext(ctx).
+		Where("conversation_id <> '' AND expires_at < ?", now).
+		Find(&kbs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list expired conversation attachments: %w", err)
+	}
+
+	convIDs := []string{}
+	for _, kb := range kbs {
+		if err := ctx.Err(); err != nil {
+			return convIDs, err
+		}
+		if err := s.deleteAttachmentKnowledgeBase(ctx, kb.ID); err != nil {
+			s.logger.Warn("Failed to delete expired conversation attachments",
+				zap.String("conversation_id", kb.ConversationID),
+				zap.Error(err))
+			continue
+		}
+		convIDs = append(convIDs, kb.ConversationID)
+	}
+	return convIDs, nil
+}
+
+// deleteAttachmentKnowledgeBase 逐个删除附件知识库中的文档，再删除知识库
+func (s *Service) deleteAttachmentKnowledgeBase(ctx context.Context, kbID uint) error {
+	var docIDs []uint
+	if err := db.GetDB().Model(&models.Document{}).Where("knowledge_base_id = ?", kbID).Pluck("id", &docIDs).Error; err != nil {
+		return fmt.Errorf("failed to list conversation attachments: %w", err)
+	}
+	for _, docID := range docIDs {
+		if err := s.DeleteDocument(ctx, docID); err != nil {
+			return fmt.Errorf("failed to delete attachment %d: %w", docID, err)
+		}
+	}
+	if err := db.GetDB().Unscoped().Delete(&models.KnowledgeBase{}, kbID).Error; err != nil {
+		return fmt.Errorf("failed to delete conversation attachments: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package document
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"eino-rag/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// 页眉页脚等模板内容清理
+//
+// PDF 和网页导出的文档每一页都会带上相同的页眉、页脚和页码（如 "Confidential — Page 3 of 40"），
+// 切分后会成为大量无意义的分块。知识库开启 StripBoilerplate 后，在切分前执行：
+//   - 去掉每行末尾的空白
+//   - 统计每行出现在多少页中（PDF 按页，其他格式按换页符分页），数字视为相同，出现比例达到阈值的行视为模板内容删除
+//   - 按知识库配置的正则规则删除匹配的内容，删除后为空的行一并去掉
+//
+// 正则规则独立于重复行检测，配置了规则即生效。HTML 解析后不保留换行，只有正则规则对其有效。
+
+// minBoilerplateSections 重复行检测最少需要的页数，太少时无法区分模板内容和正文
+const minBoilerplateSections = 3
+
+// maxLoggedBoilerplateLines 日志中最多列出的被删除行数
+const maxLoggedBoilerplateLines = 20
+
+// ErrInvalidBoilerplatePattern 知识库配置的清理规则不是合法的正则表达式
+var ErrInvalidBoilerplatePattern = errors.New("invalid boilerplate pattern")
+
+var digitsPattern = regexp.MustCompile(`\d+`)
+
+// BoilerplateOptions 模板内容清理选项
+type BoilerplateOptions struct {
+	DetectRepeated bool             // 是否删除在多数页中重复出现的行
+	MinRepeatRatio float64          // 行出现的页数占总页数的比例达到该值视为重复
+	Patterns       []*regexp.Regexp // 删除匹配的内容
+}
+
+// RemovedBoilerplate 被删除的一类内容
+type RemovedBoilerplate struct {
+	Line  string // 重复行的原文（取第一次出现）或匹配的正则规则
+	Count int    // 删除的次数
+}
+
+// BoilerplateResult 清理结果
+type BoilerplateResult struct {
+	Text    string
+	Removed []RemovedBoilerplate // 按删除次数倒序
+}
+
+// CompileBoilerplatePatterns 编译知识库配置的清理规则
+func CompileBoilerplatePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: %v", ErrInvalidBoilerplatePattern, pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// StripBoilerplate 清理各页中的模板内容，返回以空行连接的文本
+func StripBoilerplate(sections []string, opts BoilerplateOptions) *BoilerplateResult {
+	lines := make([][]string, len(sections))
+	for i, section := range sections {
+		lines[i] = strings.Split(section, "\n")
+		for j, line := range lines[i] {
+			lines[i][j] = strings.TrimRightFunc(line, unicode.IsSpace)
+		}
+	}
+
+	repeated := map[string]bool{}
+	if opts.DetectRepeated {
+		repeated = repeatedLines(lines, opts.MinRepeatRatio)
+	}
+
+	removed := map[string]*RemovedBoilerplate{}
+	record := func(key, line string) {
+		if r, ok := removed[key]; ok {
+			r.Count++
+			return
+		}
+		removed[key] = &RemovedBoilerplate{Line: line, Count: 1}
+	}
+
+	cleaned := make([]string, 0, len(sections))
+	for _, sectionLines := range lines {
+		kept := make([]string, 0, len(sectionLines))
+		for _, line := range sectionLines {
+			if key := normalizeBoilerplateLine(line); repeated[key] {
+				record(key, strings.TrimSpace(line))
+				continue
+			}
+			if line, ok := applyBoilerplatePatterns(line, opts.Patterns, record); ok {
+				kept = append(kept, line)
+			}
+		}
+		if section := strings.TrimSpace(strings.Join(kept, "\n")); section != "" {
+			cleaned = append(cleaned, section)
+		}
+	}
+
+	result := &BoilerplateResult{Text: strings.Join(cleaned, "\n\n")}
+	for _, r := range removed {
+		result.Removed = append(result.Removed, *r)
+	}
+	sort.Slice(result.Removed, func(i, j int) bool {
+		if result.Removed[i].Count != result.Removed[j].Count {
+			return result.Removed[i].Count > result.Removed[j].Count
+		}
+		return result.Removed[i].Line < result.Removed[j].Line
+	})
+	return result
+}
+
+// applyBoilerplatePatterns 删除行中匹配规则的内容，删除后为空时返回false
+func applyBoilerplatePatterns(line string, patterns []*regexp.Regexp, record func(key, line string)) (string, bool) {
+	matched := false
+	for _, re := range patterns {
+		if !re.MatchString(line) {
+			continue
+		}
+		matched = true
+		record("pattern:"+re.String(), re.String())
+		line = strings.TrimRightFunc(re.ReplaceAllString(line, ""), unicode.IsSpace)
+	}
+	return line, !matched || strings.TrimSpace(line) != ""
+}
+
+// repeatedLines 找出在足够多的页中出现的行，返回归一化后的行
+func repeatedLines(sections [][]string, minRatio float64) map[string]bool {
+	repeated := map[string]bool{}
+	if len(sections) < minBoilerplateSections {
+		return repeated
+	}
+
+	counts := map[string]int{}
+	for _, lines := range sections {
+		seen := map[string]bool{}
+		for _, line := range lines {
+			key := normalizeBoilerplateLine(line)
+			if key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			counts[key]++
+		}
+	}
+
+	threshold := int(math.Ceil(minRatio * float64(len(sections))))
+	if threshold < minBoilerplateSections {
+		threshold = minBoilerplateSections
+	}
+	for key, count := range counts {
+		if count >= threshold {
+			repeated[key] = true
+		}
+	}
+	return repeated
+}
+
+// normalizeBoilerplateLine 归一化一行用于比较：合并空白，数字替换为 #，使不同页的页码视为同一行
+func normalizeBoilerplateLine(line string) string {
+	line = strings.Join(strings.Fields(line), " ")
+	return digitsPattern.ReplaceAllString(line, "#")
+}
+
+// boilerplateSections 返回用于重复行检测的分页：PDF 按页，其他格式按换页符分隔
+// 没有分页信息时只有一段，不做重复行检测，避免把正文中反复出现的行（如代码块标记）误删
+func boilerplateSections(parsed *ParseResult) []string {
+	if len(parsed.Pages) > 0 {
+		return parsed.Pages
+	}
+	return strings.Split(parsed.Text, "\f")
+}
+
+// stripBoilerplate 按知识库设置清理解析结果中的模板内容，未开启时原样返回
+func (s *Service) stripBoilerplate(kb *models.KnowledgeBase, filename string, parsed *ParseResult) (string, error) {
+	if !kb.StripBoilerplate && len(kb.BoilerplatePatterns) == 0 {
+		return parsed.Text, nil
+	}
+
+	patterns, err := CompileBoilerplatePatterns(kb.BoilerplatePatterns)
+	if err != nil {
+		return "", err
+	}
+	result := StripBoilerplate(boilerplateSections(parsed), BoilerplateOptions{
+		DetectRepeated: kb.StripBoilerplate,
+		MinRepeatRatio: s.config.Snapshot().BoilerplateMinRepeatRatio,
+		Patterns:       patterns,
+	})
+
+	if len(result.Removed) > 0 {
+		total := 0
+		lines := make([]string, 0, maxLoggedBoilerplateLines)
+		for _, r := range result.Removed {
+			total += r.Count
+			if len(lines) < maxLoggedBoilerplateLines {
+				lines = append(lines, fmt.Sprintf("%s (x%d)", r.Line, r.Count))
+			}
+		}
+		s.logger.Info("Stripped boilerplate from document",
+			zap.String("filename", filename),
+			zap.Uint("kb_id", kb.ID),
+			zap.Int("removed", total),
+			zap.Strings("lines", lines))
+	}
+	return result.Text, nil
+}
@@ -0,0 +1,38 @@
+package document
+
+import "eino-rag/internal/config"
+
+// 候选召回倍数
+//
+// 时间衰减重排、按文档限量等检索后处理需要比最终 topK 更多的候选，否则重排后更相关、
+// 或来自其他文档的结果在召回阶段就被截掉。启用这些后处理时先从向量库召回 topK × 倍数个候选，
+// 处理完成后再截断为 topK；没有后处理时倍数固定为1，只召回 topK 个。
+// 倍数默认为 RETRIEVAL_CANDIDATE_MULTIPLIER，请求可以单独指定，召回数不超过 maxRetrievalCandidates。
+// 新增的检索后处理应通过 retrievalCandidates 计算召回数，而不是自行放大 topK。
+
+// MaxCandidateMultiplier 候选召回倍数的上限
+const MaxCandidateMultiplier = 10
+
+// defaultCandidateMultiplier 未配置候选召回倍数时使用的倍数
+const defaultCandidateMultiplier = 3
+
+// maxRetrievalCandidates 放大后最多召回的候选数
+const maxRetrievalCandidates = 100
+
+// ResolveCandidateMultiplier 返回实际使用的候选召回倍数，请求指定的值（> 0）优先，结果在 1 到 MaxCandidateMultiplier 之间
+// 配置的倍数 <= 0 时使用 defaultCandidateMultiplier
+func ResolveCandidateMultiplier(cfg *config.Config, requested int) int {
+	multiplier := cfg.RetrievalCandidateMultiplier
+	if multiplier <= 0 {
+		multiplier = defaultCandidateMultiplier
+	}
+	if requested > 0 {
+		multiplier = requested
+	}
+	return max(1, min(multiplier, MaxCandidateMultiplier))
+}
+
+// retrievalCandidates 启用检索后处理时的召回数量，不少于 topK，不超过 maxRetrievalCandidates
+func retrievalCandidates(topK, multiplier int) int {
+	return max(topK, min(topK*multiplier, maxRetrievalCandidates))
+}
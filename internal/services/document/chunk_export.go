@@ -0,0 +1,154 @@
+package document
+
+import (
+	"context"
+	"fmt"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/rag"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 分块导出
+//
+// 按分块记录的ID顺序导出知识库的分块及其向量，供外部工具（离线评估、可视化、迁移）使用。
+// 每批从数据库读取 chunkExportBatchSize 个分块，再按分块ID到向量库查询向量，内存占用与知识库大小无关。
+// 游标为上一页最后一个分块记录的ID，新写入的分块ID更大，翻页过程中不会重复或遗漏已有的分块。
+// 没有向量的分块（索引失败的文档、已归档的文档）不导出。
+
+// chunkExportBatchSize 每批读取的分块数
+const chunkExportBatchSize = 500
+
+// ChunkExportMetadata 导出分块的元数据
+type ChunkExportMetadata struct {
+	KnowledgeBaseID uint   `json:"kb_id"`
+	DocumentID      uint   `json:"doc_id"`
+	FileName        string `json:"file_name"`
+	ChunkIndex      int    `json:"chunk_index"`
+	Cursor          uint   `json:"cursor"` // 分块记录的ID，从该值继续导出可得到之后的分块
+}
+
+// ChunkExport 导出的一个分块
+type ChunkExport struct {
+	ID        string              `json:"id"`
+	Content   string              `json:"content"`
+	Metadata  ChunkExportMetadata `json:"metadata"`
+	Embedding []float32           `json:"embedding"`
+}
+
+// chunkExportRow 分块与所属文档的查询结果
+type chunkExportRow struct {
+	ID         uint
+	ChunkID    string
+	ChunkIndex int
+	Content    string
+	DocumentID uint
+	FileName   string
+}
+
+// chunkExportQuery 知识库中ID大于 cursor 的分块
+func chunkExportQuery(kbID, cursor uint) *gorm.DB {
+	return db.GetDB().Model(&models.DocumentChunk{}).
+		Joins("JOIN documents ON documents.id = document_chunks.document_id").
+		Where("documents.knowledge_base_id = ? AND document_chunks.id > ?", kbID, cursor)
+}
+
+// NextChunkCursor 返回从 cursor 开始导出 limit 个分块后的下一页游标，没有更多分块时返回0
+// 下一页游标按分块记录计算，其中没有向量的分块不导出，一页实际导出的分块可能少于 limit
+func (s *Service) NextChunkCursor(kbID, cursor uint, limit int) (uint, error) {
+	if limit <= 0 {
+		return 0, nil
+	}
+	var ids []uint
+	if err := chunkExportQuery(kbID, cursor).
+		Order("document_chunks.id ASC").
+		Offset(limit-1).Limit(2).
+		Pluck("document_chunks.id", &ids).Error; err != nil {
+		return 0, fmt.Errorf("failed to count chunks: %w", err)
+	}
+	if len(ids) < 2 {
+		return 0, nil
+	}
+	return ids[0], nil
+}
+
+// ExportChunks 从 cursor 之后按顺序导出知识库的分块，limit 为0时导出全部
+// 每批分块查到向量后调用 emit，emit 返回错误时停止导出；返回导出的分块数
+func (s *Service) ExportChunks(ctx context.Context, kbID, cursor uint, limit int, emit func([]ChunkExport) error) (int, error) {
+	exporter, ok := s.retriever.(rag.VectorExporter)
+	if !ok {
+		return 0, rag.ErrVectorStoreUnavailable
+	}
+
+	exported, scanned := 0, 0
+	for limit <= 0 || scanned < limit {
+		if err := ctx.Err(); err != nil {
+			return exported, err
+		}
+
+		batchSize := chunkExportBatchSize
+		if limit > 0 {
+			batchSize = min(batchSize, limit-scanned)
+		}
+		var rows []chunkExportRow
+		if err := chunkExportQuery(kbID, cursor).
+			Select("document_chunks.id, document_chunks.chunk_id, document_chunks.chunk_index, document_chunks.content, document_chunks.document_id, documents.file_name").
+			Order("document_chunks.id ASC").
+			Limit(batchSize).
+			Scan(&rows).Error; err != nil {
+			return exported, fmt.Errorf("failed to load chunks: %w", err)
+		}
+		if len(rows) == 0 {
+			break
+		}
+		scanned += len(rows)
+		cursor = rows[len(rows)-1].ID
+
+		chunkIDs := make([]string, len(rows))
+		for i, row := range rows {
+			chunkIDs[i] = row.ChunkID
+		}
+		embeddings, err := exporter.ChunkEmbeddings(ctx, chunkIDs)
+		if err != nil {
+			return exported, err
+		}
+
+		batch := make([]ChunkExport, 0, len(rows))
+		for _, row := range rows {
+			embedding, ok := embeddings[row.ChunkID]
+			if !ok {
+				continue
+			}
+			batch = append(batch, ChunkExport{
+				ID:      row.ChunkID,
+				Content: row.Content,
+				Metadata: ChunkExportMetadata{
+					KnowledgeBaseID: kbID,
+					DocumentID:      row.DocumentID,
+					FileName:        row.FileName,
+					ChunkIndex:      row.ChunkIndex,
+					Cursor:          row.ID,
+				},
+				Embedding: embedding,
+			})
+		}
+		if skipped := len(rows) - len(batch); skipped > 0 {
+			s.logger.Debug("Skipped chunks without vectors in export",
+				zap.Uint("kb_id", kbID),
+				zap.Int("skipped", skipped))
+		}
+		if len(batch) > 0 {
+			if err := emit(batch); err != nil {
+				return exported, err
+			}
+			exported += len(batch)
+		}
+		if len(rows) < batchSize {
+			break
+		}
+	}
+	return exported, nil
+}
@@ -0,0 +1,44 @@
+package document
+
+import (
+	"errors"
+	"fmt"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/models"
+
+	"github.com/cloudwego/eino/schema"
+	"go.uber.org/zap"
+)
+
+// 分块数上限
+//
+// 超大文档可能切分出数十万个分块，向量化耗时、Milvus 容量和调用成本都会失控。
+// MAX_CHUNKS_PER_DOCUMENT 限制单个文档的分块数，在切分后、向量化前检查：
+// CHUNK_LIMIT_ACTION=reject 时拒绝上传并返回分块数（413），不保留文档记录；
+// truncate 时只索引前 MAX_CHUNKS_PER_DOCUMENT 个分块，丢弃的数量记录在文档的 truncated_chunks 中。
+// 重新切分时同样检查，拒绝时保留原有分块和向量。
+
+// ErrTooManyChunks 文档切分后的分块数超过上限
+var ErrTooManyChunks = errors.New("document exceeds the maximum number of chunks")
+
+// limitChunks 按分块数上限拒绝或截断分块，截断时记录到 doc.TruncatedChunks
+func (s *Service) limitChunks(doc *models.Document, chunks []*schema.Document, cfg *config.Config) ([]*schema.Document, error) {
+	doc.TruncatedChunks = 0
+	limit := cfg.MaxChunksPerDocument
+	if limit <= 0 || len(chunks) <= limit {
+		return chunks, nil
+	}
+
+	if cfg.ChunkLimitAction != config.ChunkLimitTruncate {
+		return nil, fmt.Errorf("%w: %d chunks, at most %d allowed", ErrTooManyChunks, len(chunks), limit)
+	}
+
+	doc.TruncatedChunks = len(chunks) - limit
+	s.logger.Warn("Document exceeds the maximum number of chunks, truncating",
+		zap.Uint("doc_id", doc.ID),
+		zap.String("filename", doc.FileName),
+		zap.Int("chunk_count", len(chunks)),
+		zap.Int("limit", limit))
+	return chunks[:limit], nil
+}
@@ -0,0 +1,322 @@
+package document
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/rag"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// SQL 与向量库一致性检查
+//
+// 删除失败或上传中途崩溃会使数据库和 Milvus 不一致：
+//   - 孤立向量：Milvus 中有向量，数据库中已没有对应文档。默认只报告，开启 CONSISTENCY_AUTO_CLEANUP 后按文档删除
+//   - 缺失向量：文档已索引，Milvus 中却没有任何向量。文档被标记为失败，可通过重试接口重新索引
+//
+// Reconciler 每隔 CONSISTENCY_CHECK_INTERVAL 检查一次，多副本部署时每个周期只有获得 leader 锁的节点执行，
+// 最近一次报告保存在Redis中供各节点查询。
+
+// ErrConsistencyCheckRunning 已有一致性检查正在执行
+var ErrConsistencyCheckRunning = errors.New("consistency check is already running")
+
+// consistencyGracePeriod 最近更新过的文档不检查缺失，避免把正在写入的文档误判为缺失
+const consistencyGracePeriod = 10 * time.Minute
+
+// consistencyPollInterval 后台循环尝试获取 leader 锁的间隔
+const consistencyPollInterval = time.Minute
+
+const (
+	consistencyLeaderLockKey = "consistency:leader"
+	consistencyRunLockKey    = "consistency:run"
+	consistencyRunLockTTL    = 30 * time.Minute
+	consistencyReportKey     = "consistency:report"
+)
+
+// MissingVectorsMessage 因缺失向量被标记为失败的文档的状态说明
+const MissingVectorsMessage = "vectors missing from vector database, re-index required"
+
+// ConsistencyReport 一次一致性检查的结果
+type ConsistencyReport struct {
+	CheckedAt     time.Time `json:"checked_at"`
+	DurationMs    int64     `json:"duration_ms"`
+	SQLDocuments  int       `json:"sql_documents"`   // 数据库中的文档数
+	OrphanDocIDs  []uint    `json:"orphan_doc_ids"`  // 有向量但没有文档记录的文档ID
+	CleanedDocIDs []uint    `json:"cleaned_doc_ids"` // 已删除孤立向量的文档ID
+	MissingDocIDs []uint    `json:"missing_doc_ids"` // 已索引但没有向量、已标记为待重新索引的文档ID
+	AutoCleanup   bool      `json:"auto_cleanup"`
+}
+
+// Reconciler 定期检查数据库与向量库的一致性
+type Reconciler struct {
+	service *Service
+	store   rag.VectorInventory
+	config  *config.Config
+	logger  *zap.Logger
+
+	mu   sync.RWMutex
+	last *ConsistencyReport // Redis不可用时使用本节点最近一次的报告
+}
+
+func NewReconciler(service *Service, store rag.VectorInventory, cfg *config.Config, logger *zap.Logger) *Reconciler {
+	return &Reconciler{
+		service: service,
+		store:   store,
+		config:  cfg,
+		logger:  logger,
+	}
+}
+
+// Start 在后台定期执行检查，ctx 结束时停止
+func (r *Reconciler) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(consistencyPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.runAsLeader(ctx)
+			}
+		}
+	}()
+}
+
+// runAsLeader 获取 leader 锁后执行检查，锁不释放，在一个检查间隔后过期，期间其他节点不再检查
+func (r *Reconciler) runAsLeader(ctx context.Context) {
+	interval := r.config.Snapshot().ConsistencyCheckInterval
+	if interval <= 0 {
+		return
+	}
+
+	// 维护期间向量可能正在重建，检查会误删向量或误标记文档，等下一个周期
+	if state, err := db.GetMaintenance(ctx); err != nil || state.Enabled {
+		if err != nil {
+			r.logger.Warn("Failed to get maintenance state, skipping consistency check", zap.Error(err))
+		}
+		return
+	}
+
+	if _, err := db.AcquireLock(ctx, consistencyLeaderLockKey, interval); err != nil {
+		if !errors.Is(err, db.ErrLockNotAcquired) {
+			r.logger.Warn("Failed to acquire consistency check leader lock", zap.Error(err))
+		}
+		return
+	}
+	if _, err := r.Run(ctx); err != nil && !errors.Is(err, ErrConsistencyCheckRunning) {
+		r.logger.Error("Consistency check failed", zap.Error(err))
+	}
+}
+
+// Run 立即执行一次检查并保存报告，是否清理孤立向量由 CONSISTENCY_AUTO_CLEANUP 决定
+func (r *Reconciler) Run(ctx context.Context) (*ConsistencyReport, error) {
+	lock, err := db.AcquireLock(ctx, consistencyRunLockKey, consistencyRunLockTTL)
+	if errors.Is(err, db.ErrLockNotAcquired) {
+		return nil, ErrConsistencyCheckRunning
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer db.ReleaseLock(context.Background(), lock)
+
+	report, err := r.Check(ctx, r.config.Snapshot().ConsistencyAutoCleanup)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.last = report
+	r.mu.Unlock()
+	if err := db.CacheSet(ctx, consistencyReportKey, report, 0); err != nil {
+		r.logger.Warn("Failed to save consistency report", zap.Error(err))
+	}
+	return report, nil
+}
+
+// LastReport 返回最近一次检查的报告，还没有检查过时返回nil
+func (r *Reconciler) LastReport(ctx context.Context) *ConsistencyReport {
+	if db.GetRedis() != nil {
+		var report ConsistencyReport
+		if err := db.CacheGet(ctx, consistencyReportKey, &report); err != nil {
+			r.logger.Warn("Failed to load consistency report", zap.Error(err))
+		} else if !report.CheckedAt.IsZero() {
+			return &report
+		}
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.last
+}
+
+// Check 比较数据库与向量库中的文档，cleanup 为true时删除孤立向量，缺失向量的文档标记为失败
+func (r *Reconciler) Check(ctx context.Context, cleanup bool) (*ConsistencyReport, error) {
+	start := time.Now()
+	report := &ConsistencyReport{
+		CheckedAt:     start,
+		OrphanDocIDs:  []uint{},
+		CleanedDocIDs: []uint{},
+		MissingDocIDs: []uint{},
+		AutoCleanup:   cleanup,
+	}
+
+	var docIDs []uint
+	if err := db.GetDB().WithContext(ctx).Model(&models.Document{}).Pluck("id", &docIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+	report.SQLDocuments = len(docIDs)
+
+	orphans, err := r.store.OrphanDocuments(ctx, docIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list orphan vectors: %w", err)
+	}
+	// 检查期间新上传的文档可能已写入向量，再次确认文档记录确实不存在
+	if orphans, err = withoutExistingDocuments(ctx, orphans); err != nil {
+		return nil, err
+	}
+	report.OrphanDocIDs = append(report.OrphanDocIDs, orphans...)
+	if cleanup {
+		for _, docID := range orphans {
+			if err := r.store.DeleteByDocument(ctx, docID); err != nil {
+				r.logger.Warn("Failed to delete orphan vectors",
+					zap.Uint("doc_id", docID),
+					zap.Error(err))
+				continue
+			}
+			report.CleanedDocIDs = append(report.CleanedDocIDs, docID)
+		}
+	}
+
+	missing, err := r.missingDocuments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range missing {
+		flagged, err := r.service.flagMissingVectors(ctx, doc)
+		if err != nil {
+			r.logger.Warn("Failed to flag document with missing vectors",
+				zap.Uint("doc_id", doc.ID),
+				zap.Error(err))
+			continue
+		}
+		if flagged {
+			report.MissingDocIDs = append(report.MissingDocIDs, doc.ID)
+		}
+	}
+
+	report.DurationMs = time.Since(start).Milliseconds()
+	r.logger.Info("Consistency check completed",
+		zap.Int("sql_documents", report.SQLDocuments),
+		zap.Int("orphans", len(report.OrphanDocIDs)),
+		zap.Int("cleaned", len(report.CleanedDocIDs)),
+		zap.Int("missing", len(report.MissingDocIDs)),
+		zap.Int64("duration_ms", report.DurationMs))
+	return report, nil
+}
+
+// missingDocuments 返回已索引超过宽限期、但向量库中没有任何向量的文档
+func (r *Reconciler) missingDocuments(ctx context.Context) ([]models.Document, error) {
+	var indexed []models.Document
+	if err := db.GetDB().WithContext(ctx).
+		Select("id", "knowledge_base_id", "status").
+		Where("status IN ?", []models.DocumentStatus{models.DocumentStatusIndexed, models.DocumentStatusPartiallyIndexed}).
+		Where("updated_at < ?", time.Now().Add(-consistencyGracePeriod)).
+		Find(&indexed).Error; err != nil {
+		return nil, fmt.Errorf("failed to list indexed documents: %w", err)
+	}
+	if len(indexed) == 0 {
+		return nil, nil
+	}
+
+	docIDs := make([]uint, len(indexed))
+	for i, doc := range indexed {
+		docIDs[i] = doc.ID
+	}
+	present, err := r.store.DocumentsWithVectors(ctx, docIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents with vectors: %w", err)
+	}
+	hasVectors := make(map[uint]bool, len(present))
+	for _, docID := range present {
+		hasVectors[docID] = true
+	}
+
+	var missing []models.Document
+	for _, doc := range indexed {
+		if !hasVectors[doc.ID] {
+			missing = append(missing, doc)
+		}
+	}
+	return missing, nil
+}
+
+// withoutExistingDocuments 去掉 docIDs 中数据库里存在记录的文档
+func withoutExistingDocuments(ctx context.Context, docIDs []uint) ([]uint, error) {
+	if len(docIDs) == 0 {
+		return docIDs, nil
+	}
+	var existing []uint
+	if err := db.GetDB().WithContext(ctx).Model(&models.Document{}).
+		Where("id IN ?", docIDs).Pluck("id", &existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to check documents: %w", err)
+	}
+	found := make(map[uint]bool, len(existing))
+	for _, docID := range existing {
+		found[docID] = true
+	}
+	result := make([]uint, 0, len(docIDs))
+	for _, docID := range docIDs {
+		if !found[docID] {
+			result = append(result, docID)
+		}
+	}
+	return result, nil
+}
+
+// flagMissingVectors 将缺失向量的已索引文档标记为失败，并减少知识库文档数量
+// 文档在检查期间已被重新索引或删除时不做修改，返回false
+func (s *Service) flagMissingVectors(ctx context.Context, doc models.Document) (bool, error) {
+	flagged := false
+	err := db.GetDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Document{}).
+			Where("id = ? AND status = ?", doc.ID, doc.Status).
+			Updates(map[string]interface{}{
+				"status":         models.DocumentStatusFailed,
+				"status_message": MissingVectorsMessage,
+				"updated_at":     time.Now(),
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to update document status: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		if err := tx.Model(&models.KnowledgeBase{}).
+			Where("id = ?", doc.KnowledgeBaseID).
+			Update("doc_count", gorm.Expr("doc_count - 1")).Error; err != nil {
+			return fmt.Errorf("failed to update knowledge base doc count: %w", err)
+		}
+		flagged = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	if flagged {
+		s.logger.Warn("Document has no vectors, marked for re-index",
+			zap.Uint("doc_id", doc.ID),
+			zap.Uint("kb_id", doc.KnowledgeBaseID))
+		s.invalidateRetrievalCache(doc.KnowledgeBaseID)
+	}
+	return flagged, nil
+}
@@ -0,0 +1,154 @@
+package document
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/rag"
+
+	"github.com/cloudwego/eino/schema"
+	"gorm.io/gorm"
+)
+
+// 上下文向量化
+//
+// 只对分块原文向量化时，按章节标题提问往往检索不到正文：标题只出现在章节的第一个分块中。
+// 开启后在向量化前给每个分块加上文档标题（文件名去掉扩展名）和所在章节的标题路径：
+//
+//	用户手册 > 安装 > Linux
+//
+//	<分块原文>
+//
+// 组合后的文本只用于生成向量，保存和展示的仍是分块原文，集合结构不变。
+// 章节按 Markdown 标题（# 开头的行）识别，没有标题的文档只加文档标题。
+// 由 CONTEXTUAL_EMBEDDING 或知识库的 contextual_embedding 开启，只影响之后索引的文档；
+// 修改后可重新切分已有文档，并用知识库评估接口对比开启前后的命中率。
+
+// markdownHeading 匹配 Markdown ATX 标题行，去掉结尾可选的 #
+var markdownHeading = regexp.MustCompile(`^(#{1,6})[ \t]+(.+?)(?:[ \t]+#+)?[ \t]*$`)
+
+// chunkProbeLength 在全文中定位分块时使用的分块开头字节数
+const chunkProbeLength = 64
+
+// sectionHeading 文本中的一个标题
+type sectionHeading struct {
+	offset int    // 标题行在文本中的字节偏移
+	level  int    // 标题级别，1-6
+	path   string // 从最高级标题到该标题的路径
+}
+
+// ResolveContextualEmbedding 返回知识库是否开启上下文向量化，知识库未设置时使用全局配置
+func ResolveContextualEmbedding(cfg *config.Config, kb *models.KnowledgeBase) bool {
+	if kb != nil && kb.ContextualEmbedding != nil {
+		return *kb.ContextualEmbedding
+	}
+	return cfg.ContextualEmbedding
+}
+
+// addEmbeddingContext 知识库开启上下文向量化时，为每个分块设置加上文档标题和章节的向量化文本
+func (s *Service) addEmbeddingContext(doc *models.Document, chunks []*schema.Document) error {
+	database := db.GetDB()
+	var kb models.KnowledgeBase
+	if err := database.Select("id", "contextual_embedding").First(&kb, doc.KnowledgeBaseID).Error; err != nil {
+		return fmt.Errorf("failed to load knowledge base: %w", err)
+	}
+	if !ResolveContextualEmbedding(s.config.Snapshot(), &kb) {
+		return nil
+	}
+
+	// 没有保存全文的旧文档只加文档标题
+	var text models.DocumentText
+	if err := database.Select("content").First(&text, "document_id = ?", doc.ID).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to load document text: %w", err)
+	}
+
+	title := strings.TrimSuffix(doc.FileName, filepath.Ext(doc.FileName))
+	for i, section := range chunkSections(text.Content, chunks) {
+		prefix := title
+		if section != "" {
+			prefix += " > " + section
+		}
+		if chunks[i].MetaData == nil {
+			chunks[i].MetaData = map[string]interface{}{}
+		}
+		chunks[i].MetaData[rag.EmbeddingTextKey] = prefix + "\n\n" + chunks[i].Content
+	}
+	return nil
+}
+
+// chunkSections 返回每个分块所在章节的标题路径，不在任何章节中时为空
+// 分块按顺序在全文中定位，以分块开头所在的位置确定章节
+func chunkSections(text string, chunks []*schema.Document) []string {
+	sections := make([]string, len(chunks))
+	headings := parseHeadings(text)
+	if len(headings) == 0 {
+		return sections
+	}
+
+	pos := 0
+	for i, chunk := range chunks {
+		if probe := chunkProbe(chunk.Content); probe != "" {
+			if idx := strings.Index(text[pos:], probe); idx >= 0 {
+				pos += idx
+			}
+		}
+		// 最后一个不晚于分块开头的标题
+		n := sort.Search(len(headings), func(j int) bool { return headings[j].offset > pos })
+		if n > 0 {
+			sections[i] = headings[n-1].path
+		}
+	}
+	return sections
+}
+
+// parseHeadings 解析 Markdown 标题及其路径，代码块中以 # 开头的行不视为标题
+func parseHeadings(text string) []sectionHeading {
+	var headings []sectionHeading
+	var stack []sectionHeading
+	inFence := false
+	offset := 0
+	for _, line := range strings.SplitAfter(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			inFence = !inFence
+		case !inFence:
+			if m := markdownHeading.FindStringSubmatch(trimmed); m != nil {
+				level := len(m[1])
+				for len(stack) > 0 && stack[len(stack)-1].level >= level {
+					stack = stack[:len(stack)-1]
+				}
+				path := m[2]
+				if len(stack) > 0 {
+					path = stack[len(stack)-1].path + " > " + path
+				}
+				heading := sectionHeading{offset: offset, level: level, path: path}
+				stack = append(stack, heading)
+				headings = append(headings, heading)
+			}
+		}
+		offset += len(line)
+	}
+	return headings
+}
+
+// chunkProbe 返回分块第一行的开头，用于在全文中定位分块
+func chunkProbe(content string) string {
+	probe, _, _ := strings.Cut(content, "\n")
+	if len(probe) <= chunkProbeLength {
+		return probe
+	}
+	end := chunkProbeLength
+	for end > 0 && !utf8.RuneStart(probe[end]) {
+		end--
+	}
+	return probe[:end]
+}
@@ -0,0 +1,58 @@
+package document
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"unicode/utf8"
+)
+
+// 内容查重
+//
+// 上传时计算两个哈希：原始字节的 Hash 和规范化文本后的 NormalizedHash，两者都保存。
+// 规范化去掉UTF-8 BOM，把 CRLF/CR 统一为 LF，去掉每行首尾空白、合并行内连续的空格和制表符、合并连续空行，
+// 因此只有行尾或空白不同的文本文件被视为重复。PDF 等二进制文件不做规范化，两个哈希相同。
+// DEDUP_NORMALIZE 关闭时查重只比较原始字节；规范化哈希仍然保存，之后开启即可生效。
+// 规范化哈希加入之前上传的文档只能按原始字节匹配。
+
+// utf8BOM UTF-8字节顺序标记
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// NormalizeContent 规范化文本内容用于查重，内容不是有效的UTF-8文本时原样返回
+func NormalizeContent(data []byte) []byte {
+	if bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		return data
+	}
+	data = bytes.TrimPrefix(data, utf8BOM)
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	data = bytes.ReplaceAll(data, []byte("\r"), []byte("\n"))
+
+	var out bytes.Buffer
+	out.Grow(len(data))
+	blank := false
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		fields := bytes.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == '\t' })
+		if len(fields) == 0 {
+			blank = out.Len() > 0
+			continue
+		}
+		if out.Len() > 0 {
+			out.WriteByte('\n')
+			if blank {
+				out.WriteByte('\n')
+			}
+		}
+		blank = false
+		out.Write(bytes.Join(fields, []byte(" ")))
+	}
+	return out.Bytes()
+}
+
+// ContentHashes 返回原始字节的哈希和用于查重的规范化哈希，PDF 的规范化哈希与原始哈希相同
+func ContentHashes(data []byte, fileType string) (hash, normalizedHash string) {
+	hash = fmt.Sprintf("%x", sha256.Sum256(data))
+	if fileType == ".pdf" {
+		return hash, hash
+	}
+	return hash, fmt.Sprintf("%x", sha256.Sum256(NormalizeContent(data)))
+}
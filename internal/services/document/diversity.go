@@ -0,0 +1,42 @@
+package document
+
+import (
+	"eino-rag/internal/config"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// 按文档限量
+//
+// topK 个结果都来自同一个文档时，回答只能参考这一个文档的内容。启用后每个文档最多保留
+// maxPerDoc 个分块，空出的名额由其他文档的分块补上。与时间衰减一样先多召回候选再筛选，
+// 候选中其他文档的分块不足时返回的结果可能少于 topK。
+
+// ResolveMaxChunksPerDoc 返回实际使用的每个文档分块上限，请求指定的值优先，0 表示不限制
+func ResolveMaxChunksPerDoc(cfg *config.Config, maxPerDoc *int) int {
+	if maxPerDoc != nil {
+		return max(0, *maxPerDoc)
+	}
+	return max(0, cfg.MaxChunksPerDoc)
+}
+
+// limitPerDocument 按顺序保留结果，每个文档最多 maxPerDoc 个分块
+// 缺少 doc_id 的结果不受限制
+func limitPerDocument(docs []*schema.Document, maxPerDoc int) []*schema.Document {
+	if maxPerDoc <= 0 {
+		return docs
+	}
+
+	counts := make(map[uint]int)
+	limited := make([]*schema.Document, 0, len(docs))
+	for _, doc := range docs {
+		if docID, ok := doc.MetaData["doc_id"].(uint); ok {
+			if counts[docID] >= maxPerDoc {
+				continue
+			}
+			counts[docID]++
+		}
+		limited = append(limited, doc)
+	}
+	return limited
+}
@@ -0,0 +1,167 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DOCX 解析
+//
+// .docx 是 zip 包，正文在 word/document.xml 中。按文档顺序读取段落（w:p）中的文本（w:t），
+// 文本行（w:r）中的制表符（w:tab）保留为 \t，换行（w:br、w:cr）保留为换行，每个段落一行，空段落跳过；
+// 段落属性中的制表位（w:pPr/w:tabs/w:tab）不是文本。只处理 WordprocessingML 命名空间的元素，
+// 同名的其他命名空间元素（如绘图中的 a:t）忽略。
+// 表格按行展开：同一单元格内的段落用空格连接，同一行的单元格用 " | " 连接，每行一行；
+// 嵌套表格的内容并入外层单元格。修订中被删除的文本（w:delText）不计入正文。
+
+// docxDocumentPath docx 包中正文所在的文件
+const docxDocumentPath = "word/document.xml"
+
+// docxCellSeparator 表格同一行单元格之间的分隔符
+const docxCellSeparator = " | "
+
+// docxNamespaces WordprocessingML 的命名空间，包括 Transitional 和 Strict 两种格式
+var docxNamespaces = map[string]bool{
+	"http://schemas.openxmlformats.org/wordprocessingml/2006/main": true,
+	"http://purl.oclc.org/ooxml/wordprocessingml/main":             true,
+}
+
+// parseDOCX 解析 docx 文件，提取段落和表格文本
+func (p *DocumentParser) parseDOCX(content []byte) (string, error) {
+	reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return "", fmt.Errorf("failed to open DOCX: %w", err)
+	}
+
+	var document *zip.File
+	for _, f := range reader.File {
+		if f.Name == docxDocumentPath {
+			document = f
+			break
+		}
+	}
+	if document == nil {
+		return "", fmt.Errorf("failed to parse DOCX: %s not found", docxDocumentPath)
+	}
+
+	rc, err := document.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to read DOCX: %w", err)
+	}
+	defer rc.Close()
+
+	text, err := extractDOCXText(rc)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse DOCX: %w", err)
+	}
+	return text, nil
+}
+
+// extractDOCXText 从 word/document.xml 中按顺序提取文本
+func extractDOCXText(r io.Reader) (string, error) {
+	decoder := xml.NewDecoder(r)
+
+	var lines []string
+	var paragraph strings.Builder
+	var cell, row []string
+	tableDepth := 0
+	runDepth := 0
+	inText := false
+
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if !docxNamespaces[t.Name.Space] {
+				continue
+			}
+			switch t.Name.Local {
+			case "r":
+				runDepth++
+			case "t":
+				inText = true
+			case "tab":
+				if runDepth > 0 {
+					paragraph.WriteString("\t")
+				}
+			case "br", "cr":
+				if runDepth > 0 {
+					paragraph.WriteString("\n")
+				}
+			case "tbl":
+				tableDepth++
+			case "tr":
+				if tableDepth == 1 {
+					row = row[:0]
+				}
+			case "tc":
+				if tableDepth == 1 {
+					cell = cell[:0]
+				}
+			}
+		case xml.CharData:
+			if inText {
+				paragraph.Write(t)
+			}
+		case xml.EndElement:
+			if !docxNamespaces[t.Name.Space] {
+				continue
+			}
+			switch t.Name.Local {
+			case "r":
+				runDepth--
+			case "t":
+				inText = false
+			case "p":
+				text := strings.TrimSpace(paragraph.String())
+				paragraph.Reset()
+				if text == "" {
+					continue
+				}
+				if tableDepth > 0 {
+					cell = append(cell, strings.Join(strings.Fields(text), " "))
+				} else {
+					lines = append(lines, text)
+				}
+			case "tc":
+				if tableDepth == 1 {
+					row = append(row, strings.Join(cell, " "))
+				}
+			case "tr":
+				if tableDepth == 1 && strings.TrimSpace(strings.Join(row, "")) != "" {
+					lines = append(lines, strings.Join(row, docxCellSeparator))
+				}
+			case "tbl":
+				tableDepth--
+			}
+		}
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// isDOCX 内容是包含 word/document.xml 的 zip 包
+func isDOCX(content []byte) bool {
+	reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return false
+	}
+	for _, f := range reader.File {
+		if f.Name == docxDocumentPath {
+			return true
+		}
+	}
+	return false
+}
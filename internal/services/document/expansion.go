@@ -0,0 +1,302 @@
+package document
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/db"
+	"eino-rag/internal/services/llm"
+	"eino-rag/internal/services/rag"
+
+	"github.com/cloudwego/eino-ext/components/model/openai"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"go.uber.org/zap"
+)
+
+// 查询扩展
+//
+// 用户的用词与文档不同时（如"login"和"sign in"）向量检索容易漏掉相关分块。开启 QUERY_EXPANSION 后，
+// 除原查询外再为查询生成最多 QUERY_EXPANSION_VARIANTS 个改写变体，分别检索后按倒数排名融合（见 rag.FuseRankings）：
+//   - synonyms  按 QUERY_EXPANSION_SYNONYMS 同义词表替换查询中的词，不调用模型
+//   - llm       由LLM生成改写，结果在Redis中缓存 QUERY_EXPANSION_CACHE_TTL，未配置LLM时退回同义词表
+//
+// 每个变体都要多做一次向量化和检索，llm 方式还要多一次模型调用，因此默认关闭。
+// 生成变体失败时只用原查询检索，变体检索失败时忽略该变体。
+
+// queryExpansionTimeout 调用LLM生成变体的超时时间
+const queryExpansionTimeout = 10 * time.Second
+
+// queryExpansionMaxTokens 生成变体的最大token数
+const queryExpansionMaxTokens = 256
+
+const queryExpansionPrompt = `请为下面的检索问题生成 %d 个含义相同但措辞不同的改写，尽量换用同义词或不同的术语（例如"登录"和"登入"、"login"和"sign in"），保持原问题的语言。
+每行输出一个改写，不要编号，不要输出其他内容。
+
+问题：%s`
+
+// variantListMarker 模型输出中行首的列表符号或编号
+var variantListMarker = regexp.MustCompile(`^(?:[-*•]|\d+[.)、])\s*`)
+
+// QueryExpander 为查询生成改写变体
+type QueryExpander struct {
+	chatModel model.BaseChatModel // 可为nil，表示未配置LLM
+	logger    *zap.Logger
+	config    *config.Config
+}
+
+// NewQueryExpander 创建查询扩展器，配置了LLM时可使用 llm 方式生成变体
+func NewQueryExpander(cfg *config.Config, logger *zap.Logger) *QueryExpander {
+	expander := &QueryExpander{logger: logger, config: cfg}
+	if cfg.OpenAIAPIKey == "" {
+		return expander
+	}
+
+	chatModelConfig, err := llm.NewChatModelConfig(cfg, queryExpansionTimeout)
+	if err != nil {
+		logger.Warn("Invalid OpenAI client config, query expansion limited to synonyms", zap.Error(err))
+		return expander
+	}
+	chatModel, err := openai.NewChatModel(context.Background(), chatModelConfig)
+	if err != nil {
+		logger.Warn("Failed to initialize query expansion ChatModel", zap.Error(err))
+		return expander
+	}
+	expander.chatModel = chatModel
+	return expander
+}
+
+// Expand 按配置的方式生成查询的改写变体，不包含原查询
+func (e *QueryExpander) Expand(ctx context.Context, query string) []string {
+	cfg := e.config.Snapshot()
+	if cfg.QueryExpansionVariants <= 0 || strings.TrimSpace(query) == "" {
+		return nil
+	}
+
+	if cfg.QueryExpansionMethod == config.QueryExpansionLLM {
+		if e.chatModel != nil {
+			return e.llmVariants(ctx, cfg, query)
+		}
+		e.logger.Warn("Query expansion method is llm but no LLM is configured, using synonyms")
+	}
+	return SynonymVariants(query, ParseSynonymGroups(cfg.QueryExpansionSynonyms), cfg.QueryExpansionVariants)
+}
+
+// llmVariants 由LLM生成变体，优先使用缓存，生成失败时返回nil
+func (e *QueryExpander) llmVariants(ctx context.Context, cfg *config.Config, query string) []string {
+	key := expansionCacheKey(cfg, query)
+	cacheable := db.QueryExpansionCacheAvailable() && cfg.QueryExpansionCacheTTL > 0
+	if cacheable {
+		variants, found, err := db.GetCachedExpansion(ctx, key)
+		if err != nil {
+			e.logger.Warn("Failed to read query expansion cache", zap.Error(err))
+		}
+		if found {
+			return variants
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, queryExpansionTimeout)
+	defer cancel()
+	messages := []*schema.Message{
+		schema.UserMessage(fmt.Sprintf(queryExpansionPrompt, cfg.QueryExpansionVariants, query)),
+	}
+	resp, err := e.chatModel.Generate(ctx, messages, model.WithMaxTokens(queryExpansionMaxTokens))
+	if err != nil {
+		e.logger.Warn("Failed to generate query variants", zap.Error(err))
+		return nil
+	}
+
+	variants := parseVariants(resp.Content, query, cfg.QueryExpansionVariants)
+	if cacheable {
+		if err := db.CacheExpansion(ctx, key, variants, cfg.QueryExpansionCacheTTL); err != nil {
+			e.logger.Warn("Failed to write query expansion cache", zap.Error(err))
+		}
+	}
+	return variants
+}
+
+// expansionCacheKey 由规范化的查询、模型和变体数计算缓存键
+func expansionCacheKey(cfg *config.Config, query string) string {
+	data, _ := json.Marshal(struct {
+		Query    string `json:"q"`
+		Model    string `json:"m"`
+		Variants int    `json:"n"`
+	}{
+		Query:    strings.Join(strings.Fields(strings.ToLower(query)), " "),
+		Model:    cfg.OpenAIModel,
+		Variants: cfg.QueryExpansionVariants,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// parseVariants 解析模型输出的变体，每行一个，去掉编号、引号、重复项和与原查询相同的行
+func parseVariants(content, query string, limit int) []string {
+	seen := map[string]bool{strings.ToLower(strings.TrimSpace(query)): true}
+	var variants []string
+	for _, line := range strings.Split(content, "\n") {
+		line = variantListMarker.ReplaceAllString(strings.TrimSpace(line), "")
+		line = strings.TrimSpace(strings.Trim(line, `"'“”「」`))
+		if line == "" || seen[strings.ToLower(line)] {
+			continue
+		}
+		seen[strings.ToLower(line)] = true
+		variants = append(variants, line)
+		if len(variants) == limit {
+			break
+		}
+	}
+	return variants
+}
+
+// ParseSynonymGroups 解析同义词表，组之间用 ; 分隔，组内的词用 | 分隔，少于两个词的组被忽略
+func ParseSynonymGroups(value string) [][]string {
+	var groups [][]string
+	for _, group := range strings.Split(value, ";") {
+		var terms []string
+		for _, term := range strings.Split(group, "|") {
+			if term = strings.TrimSpace(term); term != "" {
+				terms = append(terms, term)
+			}
+		}
+		if len(terms) >= 2 {
+			groups = append(groups, terms)
+		}
+	}
+	return groups
+}
+
+// SynonymVariants 将查询中出现的词替换为同组的其他词，生成最多 limit 个变体
+// 英文词按整词匹配，不区分大小写；每组只替换查询中最先匹配到的词
+func SynonymVariants(query string, groups [][]string, limit int) []string {
+	seen := map[string]bool{query: true}
+	var variants []string
+	for _, group := range groups {
+		for _, term := range group {
+			pattern := synonymPattern(term)
+			if !pattern.MatchString(query) {
+				continue
+			}
+			for _, other := range group {
+				if other == term {
+					continue
+				}
+				variant := pattern.ReplaceAllLiteralString(query, other)
+				if seen[variant] {
+					continue
+				}
+				seen[variant] = true
+				variants = append(variants, variant)
+				if len(variants) == limit {
+					return variants
+				}
+			}
+			break
+		}
+	}
+	return variants
+}
+
+// synonymPattern 不区分大小写匹配词语，以字母或数字开头或结尾的一侧要求词的边界
+func synonymPattern(term string) *regexp.Regexp {
+	pattern := regexp.QuoteMeta(term)
+	if r, _ := utf8.DecodeRuneInString(term); isASCIIWordRune(r) {
+		pattern = `\b` + pattern
+	}
+	if r, _ := utf8.DecodeLastRuneInString(term); isASCIIWordRune(r) {
+		pattern += `\b`
+	}
+	return regexp.MustCompile(`(?i)` + pattern)
+}
+
+// isASCIIWordRune 判断字符是否为 ASCII 字母或数字，\b 只对这些字符生效
+func isASCIIWordRune(r rune) bool {
+	return r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// expandedRetrieve 开启查询扩展时用原查询和各个变体分别检索并融合结果，否则直接检索
+func (s *Service) expandedRetrieve(ctx context.Context, query string, kbID uint, opts rag.RetrieveOptions) ([]*schema.Document, error) {
+	if !s.config.Snapshot().QueryExpansion {
+		return s.cachedRetrieve(ctx, query, kbID, opts)
+	}
+	variants := s.expander.Expand(ctx, query)
+	if recorder, ok := ctx.Value(variantRecorderKey{}).(*VariantRecorder); ok {
+		recorder.record(variants)
+	}
+	if len(variants) == 0 {
+		return s.cachedRetrieve(ctx, query, kbID, opts)
+	}
+
+	queries := append([]string{query}, variants...)
+	results := make([][]*schema.Document, len(queries))
+	errs := make([]error, len(queries))
+	var wg sync.WaitGroup
+	for i, q := range queries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = s.cachedRetrieve(ctx, q, kbID, opts)
+		}()
+	}
+	wg.Wait()
+
+	if errs[0] != nil {
+		return nil, errs[0]
+	}
+	for i, err := range errs[1:] {
+		if err != nil {
+			s.logger.Warn("Failed to retrieve with query variant",
+				zap.String("variant", variants[i]),
+				zap.Error(err))
+		}
+	}
+	s.logger.Debug("Retrieved with expanded query",
+		zap.Uint("kb_id", kbID),
+		zap.Strings("variants", variants))
+	return rag.FuseRankings(results...), nil
+}
+
+// variantRecorderKey 上下文中 VariantRecorder 的键
+type variantRecorderKey struct{}
+
+// VariantRecorder 记录检索时实际使用的查询变体，用于调试时查看完整的检索过程
+type VariantRecorder struct {
+	mu       sync.Mutex
+	variants []string
+}
+
+// WithVariantRecorder 返回记录查询变体的context，使用该context的检索会把生成的变体写入返回的记录器
+func WithVariantRecorder(ctx context.Context) (context.Context, *VariantRecorder) {
+	recorder := &VariantRecorder{}
+	return context.WithValue(ctx, variantRecorderKey{}, recorder), recorder
+}
+
+// record 追加变体，多次检索（如对话附件和知识库）生成的相同变体只记录一次
+func (r *VariantRecorder) record(variants []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, v := range variants {
+		if !slices.Contains(r.variants, v) {
+			r.variants = append(r.variants, v)
+		}
+	}
+}
+
+// Variants 返回记录的变体，未开启查询扩展或没有生成变体时为空
+func (r *VariantRecorder) Variants() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.variants)
+}
@@ -0,0 +1,163 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/rag"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// 降级检索
+//
+// Milvus 不可用或向量检索没有结果时，对话仍然可以带上一些上下文：在数据库中按文件名和摘要匹配查询，
+// 取匹配文档保存的原文开头作为上下文。这里只是关键词匹配，结果的 metadata 中 type 为 ChunkTypeFallback，
+// 对话中会标明为降级检索的内容。由 RAG_FALLBACK 开启，只在向量检索之后使用。
+
+// 匹配得分：查询中包含完整的文件名 > 查询词出现在文件名中 > 查询词出现在摘要中
+const (
+	fallbackStemScore    = 3
+	fallbackNameScore    = 2
+	fallbackSummaryScore = 1
+)
+
+// minFallbackTermLength 参与匹配的查询词最少字符数，中文两个字已经能表达完整的词，英文则要求更长以排除 of、is 等
+const (
+	minFallbackTermLength    = 3
+	minFallbackCJKTermLength = 2
+)
+
+// fallbackExcerptLength 每个文档最多取用的原文字符数
+const fallbackExcerptLength = 1500
+
+// FallbackSearch 按文件名和摘要匹配查询，返回匹配文档的原文摘录，没有匹配时返回空
+// opts 中只有创建者和创建时间过滤生效
+func (s *Service) FallbackSearch(ctx context.Context, query string, kbID uint, opts rag.RetrieveOptions) ([]*schema.Document, error) {
+	cfg := s.config.Snapshot()
+
+	var candidates []models.Document
+	if err := documentQuery(kbID, opts).WithContext(ctx).
+		Select("id", "knowledge_base_id", "file_name", "summary", "created_at").
+		Find(&candidates).Error; err != nil {
+		return nil, fmt.Errorf("failed to load documents for fallback search: %w", err)
+	}
+
+	terms := fallbackTerms(query)
+	lowerQuery := strings.ToLower(query)
+	scores := make(map[uint]int, len(candidates))
+	matched := make([]models.Document, 0, len(candidates))
+	for _, doc := range candidates {
+		if score := fallbackScore(doc, lowerQuery, terms); score > 0 {
+			scores[doc.ID] = score
+			matched = append(matched, doc)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		if scores[matched[i].ID] != scores[matched[j].ID] {
+			return scores[matched[i].ID] > scores[matched[j].ID]
+		}
+		return matched[i].CreatedAt.After(matched[j].CreatedAt)
+	})
+	if len(matched) > cfg.RAGFallbackMaxDocs {
+		matched = matched[:cfg.RAGFallbackMaxDocs]
+	}
+	if len(matched) == 0 {
+		return []*schema.Document{}, nil
+	}
+
+	docIDs := make([]uint, 0, len(matched))
+	for _, doc := range matched {
+		docIDs = append(docIDs, doc.ID)
+	}
+	var texts []models.DocumentText
+	if err := db.GetDB().WithContext(ctx).Where("document_id IN ?", docIDs).Find(&texts).Error; err != nil {
+		return nil, fmt.Errorf("failed to load document texts for fallback search: %w", err)
+	}
+	contents := make(map[uint]string, len(texts))
+	for _, text := range texts {
+		contents[text.DocumentID] = text.Content
+	}
+
+	docs := make([]*schema.Document, 0, len(matched))
+	for _, doc := range matched {
+		content := strings.TrimSpace(contents[doc.ID])
+		if content == "" {
+			continue
+		}
+		if runes := []rune(content); len(runes) > fallbackExcerptLength {
+			content = string(runes[:fallbackExcerptLength])
+		}
+		docs = append(docs, &schema.Document{
+			ID:      fmt.Sprintf("fallback_%d", doc.ID),
+			Content: content,
+			MetaData: map[string]interface{}{
+				"type":      rag.ChunkTypeFallback,
+				"kb_id":     doc.KnowledgeBaseID,
+				"doc_id":    doc.ID,
+				"file_name": doc.FileName,
+			},
+		})
+	}
+	return s.attachDocumentInfo(docs), nil
+}
+
+// fallbackScore 计算文档与查询的匹配得分，0 表示不匹配
+func fallbackScore(doc models.Document, lowerQuery string, terms []string) int {
+	name := strings.ToLower(doc.FileName)
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	summary := strings.ToLower(doc.Summary)
+
+	score := 0
+	if isFallbackTerm(stem) && strings.Contains(lowerQuery, stem) {
+		score += fallbackStemScore
+	}
+	for _, term := range terms {
+		switch {
+		case strings.Contains(name, term):
+			score += fallbackNameScore
+		case strings.Contains(summary, term):
+			score += fallbackSummaryScore
+		}
+	}
+	return score
+}
+
+// fallbackTerms 把查询拆分为去重的小写词，按字母和数字以外的字符分隔，中文连续字符视为一个词
+func fallbackTerms(query string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	seen := make(map[string]bool, len(fields))
+	terms := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if !isFallbackTerm(field) || seen[field] {
+			continue
+		}
+		seen[field] = true
+		terms = append(terms, field)
+	}
+	return terms
+}
+
+// isFallbackTerm 词是否足够长，可以用于匹配
+func isFallbackTerm(term string) bool {
+	length := utf8.RuneCountInString(term)
+	if length >= minFallbackTermLength {
+		return true
+	}
+	for _, r := range term {
+		if r > unicode.MaxASCII {
+			return length >= minFallbackCJKTermLength
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package document
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/rag"
+
+	"github.com/cloudwego/eino/schema"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 按文档创建者、创建时间和标签过滤
+//
+// 向量库中只保存了分块所属的文档ID，过滤时先在数据库中查询出符合条件的文档，
+// 再以文档ID作为检索条件，多个条件之间为 AND 关系；指定多个标签时文档需要包含全部标签（不区分大小写）。
+// 检索结果的 metadata 中附带文档的创建者（creator_id、creator_name）和创建时间（doc_created_at），
+// 以及 markdown frontmatter 中的标题、作者、标签和日期（doc_title、doc_author、doc_tags、doc_date）。
+
+// hasDocumentFilter 是否指定了按文档属性过滤的条件
+func hasDocumentFilter(opts rag.RetrieveOptions) bool {
+	return opts.CreatorID > 0 || opts.CreatedAfter != nil || opts.CreatedBefore != nil || len(opts.Tags) > 0
+}
+
+// filteredDocIDs 查询知识库中符合过滤条件的文档ID，kbID 为0时查询所有知识库
+func filteredDocIDs(kbID uint, opts rag.RetrieveOptions) ([]uint, error) {
+	var ids []uint
+	if err := documentQuery(kbID, opts).Pluck("id", &ids).Error; err != nil {
+		return nil, fmt.Errorf("failed to filter documents: %w", err)
+	}
+	return ids, nil
+}
+
+// documentQuery 返回按知识库和文档属性过滤的文档查询，kbID 为0时查询所有知识库
+func documentQuery(kbID uint, opts rag.RetrieveOptions) *gorm.DB {
+	query := db.GetDB().Model(&models.Document{}).Scopes(ActiveDocuments)
+	if kbID > 0 {
+		query = query.Where("knowledge_base_id = ?", kbID)
+	}
+	if opts.CreatorID > 0 {
+		query = query.Where("creator_id = ?", opts.CreatorID)
+	}
+	if opts.CreatedAfter != nil {
+		query = query.Where("created_at >= ?", *opts.CreatedAfter)
+	}
+	if opts.CreatedBefore != nil {
+		query = query.Where("created_at < ?", *opts.CreatedBefore)
+	}
+	for _, tag := range opts.Tags {
+		// 标签以JSON数组保存，按带引号的完整元素匹配
+		encoded, _ := json.Marshal(tag)
+		query = query.Where("tags LIKE ? ESCAPE '\\'", "%"+escapeLike(string(encoded))+"%")
+	}
+	return query
+}
+
+// escapeLike 转义 LIKE 通配符
+func escapeLike(s string) string {
+	replacer := strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_")
+	return replacer.Replace(s)
+}
+
+// attachDocumentInfo 在检索结果中附带所属文档的创建者、创建时间和 frontmatter 属性
+// 返回新的结果，不修改检索器或缓存持有的元数据；所属知识库已软删除的结果被去掉，查询失败时原样返回
+func (s *Service) attachDocumentInfo(docs []*schema.Document) []*schema.Document {
+	if len(docs) == 0 {
+		return docs
+	}
+
+	docIDs := make([]uint, 0, len(docs))
+	for _, doc := range docs {
+		if docID, ok := doc.MetaData["doc_id"].(uint); ok {
+			docIDs = append(docIDs, docID)
+		}
+	}
+
+	var records []models.Document
+	if err := db.GetDB().Select("id", "creator_id", "created_at", "knowledge_base_deleted_at",
+		"title", "author", "tags", "document_date").
+		Preload("Creator", func(tx *gorm.DB) *gorm.DB { return tx.Select("id", "name") }).
+		Where("id IN ?", docIDs).Find(&records).Error; err != nil {
+		s.logger.Warn("Failed to load document creators for search results", zap.Error(err))
+		return docs
+	}
+	byID := make(map[uint]*models.Document, len(records))
+	for i := range records {
+		byID[records[i].ID] = &records[i]
+	}
+
+	attached := make([]*schema.Document, 0, len(docs))
+	for _, doc := range docs {
+		docID, _ := doc.MetaData["doc_id"].(uint)
+		record, ok := byID[docID]
+		if !ok {
+			attached = append(attached, doc)
+			continue
+		}
+		// 知识库已软删除，向量保留到永久删除，但不再出现在检索结果中
+		if record.KnowledgeBaseDeletedAt != nil {
+			continue
+		}
+
+		metaData := make(map[string]interface{}, len(doc.MetaData)+7)
+		for k, v := range doc.MetaData {
+			metaData[k] = v
+		}
+		metaData["creator_id"] = record.CreatorID
+		metaData["doc_created_at"] = record.CreatedAt
+		if record.Creator != nil {
+			metaData["creator_name"] = record.Creator.Name
+		}
+		if record.Title != "" {
+			metaData["doc_title"] = record.Title
+		}
+		if record.Author != "" {
+			metaData["doc_author"] = record.Author
+		}
+		if len(record.Tags) > 0 {
+			metaData["doc_tags"] = record.Tags
+		}
+		if record.DocumentDate != nil {
+			metaData["doc_date"] = *record.DocumentDate
+		}
+
+		attached = append(attached, &schema.Document{
+			ID:       doc.ID,
+			Content:  doc.Content,
+			MetaData: metaData,
+		})
+	}
+	return attached
+}
@@ -0,0 +1,207 @@
+package document
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"eino-rag/internal/models"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Markdown frontmatter
+//
+// Markdown 文档开头的 frontmatter（YAML 以 --- 包围，TOML 以 +++ 包围）在解析时从正文中去掉，
+// 其中的 title、author、tags、date 保存为文档属性：文档列表返回这些字段，检索结果附带 doc_title 等元数据，
+// 检索和对话可以按标签过滤文档。其余字段被忽略。
+// 没有 frontmatter、frontmatter 无法解析或不是键值对时，文档内容原样保留。
+
+const (
+	maxFrontmatterTitleLength = 255 // 标题最大字符数，与 file_name 列一致
+	maxFrontmatterTags        = 50  // 最多保留的标签数
+)
+
+// Frontmatter 从 markdown frontmatter 中提取的文档属性，未提供的字段为零值
+type Frontmatter struct {
+	Title  string
+	Author string
+	Tags   []string
+	Date   *time.Time
+}
+
+// frontmatterDateLayouts frontmatter 中 date 字段支持的格式
+var frontmatterDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// ExtractFrontmatter 从 markdown 文本开头提取 frontmatter，返回提取的属性和去掉 frontmatter 后的正文
+// 没有 frontmatter 时返回 nil 和原文；frontmatter 无法解析时返回错误和原文
+func ExtractFrontmatter(text string) (*Frontmatter, string, error) {
+	content := strings.TrimPrefix(text, "\ufeff")
+	var delimiter string
+	switch {
+	case strings.HasPrefix(content, "---"):
+		delimiter = "---"
+	case strings.HasPrefix(content, "+++"):
+		delimiter = "+++"
+	default:
+		return nil, text, nil
+	}
+
+	// 开始分隔符必须单独占一行
+	firstLine, rest, ok := strings.Cut(content, "\n")
+	if !ok || strings.TrimSpace(firstLine) != delimiter {
+		return nil, text, nil
+	}
+	header, body, ok := cutFrontmatter(rest, delimiter)
+	if !ok {
+		return nil, text, nil
+	}
+
+	fields := map[string]interface{}{}
+	var err error
+	if delimiter == "+++" {
+		err = toml.Unmarshal([]byte(header), &fields)
+	} else {
+		err = yaml.Unmarshal([]byte(header), &fields)
+	}
+	if err != nil {
+		return nil, text, fmt.Errorf("invalid frontmatter: %w", err)
+	}
+	// 开头的分隔线之间只有注释（如 YAML 中的 # 标题）时不是 frontmatter
+	if len(fields) == 0 && strings.TrimSpace(header) != "" {
+		return nil, text, nil
+	}
+
+	fm := &Frontmatter{}
+	for key, value := range fields {
+		switch strings.ToLower(key) {
+		case "title":
+			fm.Title = truncateRunes(frontmatterString(value), maxFrontmatterTitleLength)
+		case "author", "authors":
+			fm.Author = truncateRunes(strings.Join(frontmatterList(value), ", "), maxFrontmatterTitleLength)
+		case "tags":
+			fm.Tags = NormalizeTags(frontmatterList(value))
+		case "date":
+			fm.Date = frontmatterDate(value)
+		}
+	}
+	return fm, strings.TrimLeft(body, "\r\n"), nil
+}
+
+// cutFrontmatter 在 rest 中查找单独占一行的结束分隔符（YAML 也可以用 ...），返回 frontmatter 和其后的正文
+func cutFrontmatter(rest, delimiter string) (string, string, bool) {
+	offset := 0
+	for offset <= len(rest) {
+		line, next, found := strings.Cut(rest[offset:], "\n")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == delimiter || (delimiter == "---" && trimmed == "...") {
+			return rest[:offset], next, true
+		}
+		if !found {
+			break
+		}
+		offset += len(line) + 1
+	}
+	return "", "", false
+}
+
+// NormalizeTags 去掉标签两端的空白、空标签和重复的标签（不区分大小写），最多保留 maxFrontmatterTags 个
+func NormalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		key := strings.ToLower(tag)
+		if tag == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		normalized = append(normalized, tag)
+		if len(normalized) == maxFrontmatterTags {
+			break
+		}
+	}
+	if len(normalized) == 0 {
+		return nil
+	}
+	return normalized
+}
+
+// frontmatterString 把标量值转换为字符串，列表和映射返回空字符串
+func frontmatterString(value interface{}) string {
+	switch v := value.(type) {
+	case nil, []interface{}, map[string]interface{}:
+		return ""
+	case string:
+		return strings.TrimSpace(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return strings.TrimSpace(fmt.Sprint(v))
+	}
+}
+
+// frontmatterList 把列表或逗号分隔的字符串转换为字符串列表
+func frontmatterList(value interface{}) []string {
+	items, ok := value.([]interface{})
+	if !ok {
+		return strings.Split(frontmatterString(value), ",")
+	}
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		if s := frontmatterString(item); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// frontmatterDate 解析 date 字段，YAML 和 TOML 的日期类型以及常见格式的字符串均可，无法解析时返回nil
+func frontmatterDate(value interface{}) *time.Time {
+	if t, ok := value.(time.Time); ok {
+		return &t
+	}
+	s := frontmatterString(value)
+	for _, layout := range frontmatterDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return &t
+		}
+	}
+	return nil
+}
+
+// addFrontmatterMetadata 把文档的 frontmatter 属性加入文档元数据，是否复制到分块由 CHUNK_METADATA_KEYS 决定
+func addFrontmatterMetadata(metadata map[string]interface{}, doc *models.Document) {
+	if doc.Title != "" {
+		metadata["title"] = doc.Title
+	}
+	if doc.Author != "" {
+		metadata["author"] = doc.Author
+	}
+	if len(doc.Tags) > 0 {
+		metadata["tags"] = doc.Tags
+	}
+	if doc.DocumentDate != nil {
+		metadata["date"] = *doc.DocumentDate
+	}
+}
+
+// truncateRunes 截取 s 的前 n 个字符
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// isMarkdownType 文件类型是否为 markdown
+func isMarkdownType(fileType string) bool {
+	return fileType == ".md" || fileType == ".markdown"
+}
@@ -0,0 +1,186 @@
+package document
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 知识库软删除
+//
+// 删除知识库只记录删除时间（deleted_at），知识库不再出现在列表中，也不能访问；其文档标记 kb_deleted_at，
+// 不参与检索和跨知识库的文档列表、重试、重新分块，文档记录、原文、分块和向量都保留，doc_count 不变。
+// 宽限期（KB_DELETE_GRACE_PERIOD）内可以恢复，恢复后文档取消标记，doc_count 按已索引的文档重新统计。
+// 超过宽限期后由保留期限清理任务（见 retention.go）永久删除；管理员也可以随时永久删除，与原来的删除接口相同，
+// 删除知识库、文档记录、原文、分块和所有向量，不能恢复。
+
+var (
+	// ErrKnowledgeBaseNotDeleted 要恢复的知识库不存在或没有被删除
+	ErrKnowledgeBaseNotDeleted = errors.New("knowledge base not found or not deleted")
+	// ErrKnowledgeBaseNameTaken 恢复的知识库与创建者现有的知识库同名
+	ErrKnowledgeBaseNameTaken = errors.New("an active knowledge base with the same name already exists")
+)
+
+// ActiveDocuments 排除所属知识库已被软删除的文档
+func ActiveDocuments(tx *gorm.DB) *gorm.DB {
+	return tx.Where("knowledge_base_deleted_at IS NULL")
+}
+
+// SoftDeleteKnowledgeBase 软删除知识库并标记其文档，向量保留到永久删除
+func (s *Service) SoftDeleteKnowledgeBase(ctx context.Context, kbID uint) (*models.KnowledgeBase, error) {
+	var kb models.KnowledgeBase
+	now := time.Now()
+	err := db.GetDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&kb, kbID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Document{}).
+			Where("knowledge_base_id = ? AND knowledge_base_deleted_at IS NULL", kbID).
+			Update("knowledge_base_deleted_at", now).Error; err != nil {
+			return fmt.Errorf("failed to mark documents: %w", err)
+		}
+		if err := tx.Model(&kb).Update("deleted_at", now).Error; err != nil {
+			return fmt.Errorf("failed to delete knowledge base: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	kb.DeletedAt = gorm.DeletedAt{Time: now, Valid: true}
+	s.invalidateRetrievalCache(kbID)
+	return &kb, nil
+}
+
+// RestoreKnowledgeBase 恢复软删除的知识库，取消文档标记并重新统计 doc_count
+func (s *Service) RestoreKnowledgeBase(ctx context.Context, kbID uint) (*models.KnowledgeBase, error) {
+	database := db.GetDB().WithContext(ctx)
+
+	var kb models.KnowledgeBase
+	if err := database.Unscoped().Where("deleted_at IS NOT NULL").First(&kb, kbID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrKnowledgeBaseNotDeleted
+		}
+		return nil, err
+	}
+
+	// 删除后创建者可能新建了同名知识库，恢复后名称不再唯一
+	var count int64
+	if err := database.Model(&models.KnowledgeBase{}).
+		Where("creator_id = ? AND name = ?", kb.CreatorID, kb.Name).
+		Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to check knowledge base name: %w", err)
+	}
+	if count > 0 {
+		return nil, ErrKnowledgeBaseNameTaken
+	}
+
+	err := database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Document{}).
+			Where("knowledge_base_id = ?", kbID).
+			Update("knowledge_base_deleted_at", nil).Error; err != nil {
+			return fmt.Errorf("failed to restore documents: %w", err)
+		}
+
+		var indexed int64
+		if err := tx.Model(&models.Document{}).
+			Where("knowledge_base_id = ? AND status IN ?", kbID,
+				[]models.DocumentStatus{models.DocumentStatusIndexed, models.DocumentStatusPartiallyIndexed}).
+			Count(&indexed).Error; err != nil {
+			return fmt.Errorf("failed to count documents: %w", err)
+		}
+		kb.DocCount = int(indexed)
+		kb.DeletedAt = gorm.DeletedAt{}
+		return tx.Unscoped().Model(&kb).Updates(map[string]interface{}{
+			"deleted_at": nil,
+			"doc_count":  kb.DocCount,
+		}).Error
+	})
+	// 检查名称后并发创建了同名知识库，由唯一索引拒绝
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil, ErrKnowledgeBaseNameTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.invalidateRetrievalCache(kbID)
+	return &kb, nil
+}
+
+// PurgeKnowledgeBase 永久删除知识库（包括软删除的）、其文档记录、原文、分块和向量
+func (s *Service) PurgeKnowledgeBase(ctx context.Context, kbID uint) error {
+	err := db.GetDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var kb models.KnowledgeBase
+		if err := tx.Unscoped().First(&kb, kbID).Error; err != nil {
+			return err
+		}
+
+		// 删除向量数据库中的文档
+		if s.retriever != nil {
+			if err := s.retriever.DeleteByKnowledgeBase(ctx, kbID); err != nil {
+				s.logger.Error("Failed to delete vectors", zap.Error(err))
+				// 继续删除，不中断流程
+			}
+		} else {
+			s.logger.Warn("Vector deletion skipped - retriever not available", zap.Uint("kb_id", kbID))
+		}
+
+		// 删除所有文档分块、文本和文档记录
+		kbDocIDs := tx.Model(&models.Document{}).Select("id").Where("knowledge_base_id = ?", kbID)
+		if err := tx.Where("document_id IN (?)", kbDocIDs).Delete(&models.DocumentChunk{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("document_id IN (?)", kbDocIDs).Delete(&models.DocumentText{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("knowledge_base_id = ?", kbID).Delete(&models.Document{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Delete(&kb).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	s.invalidateRetrievalCache(kbID)
+	return nil
+}
+
+// PurgeDeletedKnowledgeBases 永久删除软删除时间早于宽限期的知识库，返回已删除的知识库ID
+func (s *Service) PurgeDeletedKnowledgeBases(ctx context.Context, now time.Time) ([]uint, error) {
+	grace := s.config.Snapshot().KBDeleteGracePeriod
+	if grace <= 0 {
+		return nil, nil
+	}
+
+	var kbIDs []uint
+	if err := db.GetDB().WithContext(ctx).Unscoped().Model(&models.KnowledgeBase{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", now.Add(-grace)).
+		Order("id").
+		Pluck("id", &kbIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list deleted knowledge bases: %w", err)
+	}
+
+	purged := []uint{}
+	for _, kbID := range kbIDs {
+		if err := ctx.Err(); err != nil {
+			return purged, err
+		}
+		if err := s.PurgeKnowledgeBase(ctx, kbID); err != nil {
+			s.logger.Warn("Failed to purge deleted knowledge base", zap.Uint("kb_id", kbID), zap.Error(err))
+			continue
+		}
+		purged = append(purged, kbID)
+	}
+	return purged, nil
+}
@@ -0,0 +1,115 @@
+package document
+
+import (
+	"fmt"
+	"strings"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// chunkPosition 分块在文档中的位置
+type chunkPosition struct {
+	docID uint
+	index int
+}
+
+// ExpandContext 为检索命中的分块补充同一文档中前后 window 个相邻分块
+// 结果按命中文档的排名分组，组内按分块顺序排列并去重；无法定位的分块（如摘要）保持原位
+func (s *Service) ExpandContext(hits []*schema.Document, window int) ([]*schema.Document, error) {
+	if window <= 0 || len(hits) == 0 {
+		return hits, nil
+	}
+
+	database := db.GetDB()
+
+	// 通过分块ID查出命中分块的文档和序号
+	chunkIDs := make([]string, 0, len(hits))
+	for _, hit := range hits {
+		chunkIDs = append(chunkIDs, hit.ID)
+	}
+	var hitRecords []models.DocumentChunk
+	if err := database.Select("chunk_id", "document_id", "chunk_index").
+		Where("chunk_id IN ?", chunkIDs).Find(&hitRecords).Error; err != nil {
+		return nil, fmt.Errorf("failed to load hit chunks: %w", err)
+	}
+	positions := make(map[string]chunkPosition, len(hitRecords))
+	for _, record := range hitRecords {
+		positions[record.ChunkID] = chunkPosition{docID: record.DocumentID, index: record.ChunkIndex}
+	}
+	if len(positions) == 0 {
+		return hits, nil
+	}
+
+	// 一次查询取回所有命中分块的相邻范围
+	conds := make([]string, 0, len(positions))
+	args := make([]interface{}, 0, len(positions)*3)
+	for _, pos := range positions {
+		conds = append(conds, "(document_id = ? AND chunk_index BETWEEN ? AND ?)")
+		args = append(args, pos.docID, pos.index-window, pos.index+window)
+	}
+	var neighborRecords []models.DocumentChunk
+	if err := database.Where(strings.Join(conds, " OR "), args...).
+		Order("document_id ASC, chunk_index ASC").Find(&neighborRecords).Error; err != nil {
+		return nil, fmt.Errorf("failed to load neighbor chunks: %w", err)
+	}
+	neighbors := make(map[uint][]models.DocumentChunk)
+	for _, record := range neighborRecords {
+		neighbors[record.DocumentID] = append(neighbors[record.DocumentID], record)
+	}
+
+	hitByID := make(map[string]*schema.Document, len(hits))
+	for _, hit := range hits {
+		hitByID[hit.ID] = hit
+	}
+
+	// 每个文档内需要保留的分块序号
+	wanted := make(map[uint]map[int]bool)
+	for _, pos := range positions {
+		if wanted[pos.docID] == nil {
+			wanted[pos.docID] = make(map[int]bool)
+		}
+		for i := pos.index - window; i <= pos.index+window; i++ {
+			wanted[pos.docID][i] = true
+		}
+	}
+
+	expanded := make([]*schema.Document, 0, len(neighborRecords))
+	emitted := make(map[uint]bool)
+	for _, hit := range hits {
+		pos, ok := positions[hit.ID]
+		if !ok {
+			expanded = append(expanded, hit)
+			continue
+		}
+		if emitted[pos.docID] {
+			continue
+		}
+		emitted[pos.docID] = true
+
+		for _, record := range neighbors[pos.docID] {
+			if !wanted[pos.docID][record.ChunkIndex] {
+				continue
+			}
+			if doc, ok := hitByID[record.ChunkID]; ok {
+				doc.MetaData["chunk_index"] = record.ChunkIndex
+				expanded = append(expanded, doc)
+				continue
+			}
+			expanded = append(expanded, &schema.Document{
+				ID:      record.ChunkID,
+				Content: record.Content,
+				MetaData: map[string]interface{}{
+					"kb_id":       hit.MetaData["kb_id"],
+					"doc_id":      record.DocumentID,
+					"chunk_index": record.ChunkIndex,
+					"expanded":    true,
+				},
+			})
+		}
+	}
+
+	return expanded, nil
+}
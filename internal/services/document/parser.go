@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"strings"
@@ -23,48 +24,144 @@ func NewDocumentParser(logger *zap.Logger) *DocumentParser {
 	}
 }
 
+// ErrInvalidPageRange 页码范围无效
+var ErrInvalidPageRange = errors.New("invalid page range")
+
+// ParseOptions 解析选项，零值表示解析全部内容
+type ParseOptions struct {
+	PageStart int    // PDF起始页（从1开始，包含），<= 0 表示从第一页开始
+	PageEnd   int    // PDF结束页（包含），<= 0 表示到最后一页
+	MaxPages  int    // 最多解析的PDF页数，<= 0 表示不限制
+	FileType  string // 已检测的文件类型（如 .pdf），为空时根据文件名和内容检测
+}
+
+// ParseResult 解析结果，仅PDF会记录实际解析的页码范围
+type ParseResult struct {
+	Text       string
+	FileType   string // 实际使用的文件类型
+	PageStart  int
+	PageEnd    int
+	TotalPages int
+	Pages      []string // PDF每一页的文本，用于识别页眉页脚
+	// markdown frontmatter 中的文档属性，没有 frontmatter 时为nil
+	Frontmatter *Frontmatter
+}
+
 // ParseDocument 解析文档内容
 func (p *DocumentParser) ParseDocument(filename string, content []byte) (string, error) {
-	ext := strings.ToLower(filepath.Ext(filename))
-	
+	result, err := p.ParseDocumentWithOptions(filename, content, ParseOptions{})
+	if err != nil {
+		return "", err
+	}
+	return result.Text, nil
+}
+
+// ParseDocumentWithOptions 按解析选项解析文档内容，页码范围只对PDF生效
+func (p *DocumentParser) ParseDocumentWithOptions(filename string, content []byte, opts ParseOptions) (*ParseResult, error) {
+	ext := opts.FileType
+	if ext == "" {
+		detected, err := p.DetectFileType(filename, content)
+		if err != nil {
+			return nil, err
+		}
+		ext = detected
+	}
+
+	var text string
+	var err error
 	switch ext {
-	case ".txt", ".md", ".markdown":
-		return string(content), nil
+	case ".txt":
+		text = string(content)
+	case ".md", ".markdown":
+		return p.parseMarkdown(content, ext), nil
 	case ".pdf":
-		return p.parsePDF(content)
+		result, err := p.parsePDF(content, opts)
+		if err != nil {
+			return nil, err
+		}
+		result.FileType = ext
+		return result, nil
 	case ".json":
-		return p.parseJSON(content)
+		text, err = p.parseJSON(content)
 	case ".csv":
-		return p.parseCSV(content)
+		text, err = p.parseCSV(content)
 	case ".html", ".htm":
-		return p.parseHTML(content)
+		text, err = p.parseHTML(content)
+	case ".docx":
+		text, err = p.parseDOCX(content)
 	default:
-		return "", fmt.Errorf("unsupported file type: %s", ext)
+		return nil, fmt.Errorf("unsupported file type: %s", ext)
+	}
+	if err != nil {
+		return nil, err
 	}
+	return &ParseResult{Text: text, FileType: ext}, nil
+}
+
+// parseMarkdown 解析markdown文件，去掉开头的 frontmatter 并提取其中的文档属性
+// frontmatter 无法解析时保留原文
+func (p *DocumentParser) parseMarkdown(content []byte, ext string) *ParseResult {
+	fm, text, err := ExtractFrontmatter(string(content))
+	if err != nil {
+		p.logger.Warn("Failed to parse markdown frontmatter, keeping it as text", zap.Error(err))
+	}
+	return &ParseResult{Text: text, FileType: ext, Frontmatter: fm}
+}
+
+// pageRange 根据选项和总页数计算实际解析的页码范围
+func pageRange(opts ParseOptions, numPages int) (int, int, error) {
+	start, end := opts.PageStart, opts.PageEnd
+	if start <= 0 {
+		start = 1
+	}
+	if end <= 0 || end > numPages {
+		end = numPages
+	}
+	if start > numPages {
+		return 0, 0, fmt.Errorf("%w: page_start %d exceeds total pages %d", ErrInvalidPageRange, start, numPages)
+	}
+	if start > end {
+		return 0, 0, fmt.Errorf("%w: page_start %d is after page_end %d", ErrInvalidPageRange, start, end)
+	}
+
+	// 全局页数上限
+	if opts.MaxPages > 0 && end-start+1 > opts.MaxPages {
+		end = start + opts.MaxPages - 1
+	}
+	return start, end, nil
 }
 
 // parsePDF 解析PDF文件
-func (p *DocumentParser) parsePDF(content []byte) (string, error) {
+func (p *DocumentParser) parsePDF(content []byte, opts ParseOptions) (*ParseResult, error) {
 	reader := bytes.NewReader(content)
 	pdfReader, err := pdf.NewReader(reader, int64(len(content)))
 	if err != nil {
-		return "", fmt.Errorf("failed to create PDF reader: %w", err)
+		return nil, fmt.Errorf("failed to create PDF reader: %w", err)
 	}
 
 	var text strings.Builder
+	var pages []string
 	numPages := pdfReader.NumPage()
+
+	start, end, err := pageRange(opts, numPages)
+	if err != nil {
+		return nil, err
+	}
 	
 	p.logger.Info("Starting PDF parsing",
 		zap.Int("total_pages", numPages),
+		zap.Int("page_start", start),
+		zap.Int("page_end", end),
 		zap.Int("content_size", len(content)))
 	
-	for i := 1; i <= numPages; i++ {
+	pageCount := end - start + 1
+	for i := start; i <= end; i++ {
 		// 记录解析进度
-		if i%10 == 0 || i == numPages {
+		if parsed := i - start + 1; parsed%10 == 0 || i == end {
 			p.logger.Info("PDF parsing progress",
 				zap.Int("current_page", i),
 				zap.Int("total_pages", numPages),
-				zap.Float64("progress", float64(i)/float64(numPages)*100))
+				zap.Float64("progress", float64(parsed)/float64(pageCount)*100))
 		}
 		
 		page := pdfReader.Page(i)
@@ -82,14 +179,21 @@ func (p *DocumentParser) parsePDF(content []byte) (string, error) {
 		
 		text.WriteString(pageText)
 		text.WriteString("\n\n")
+		pages = append(pages, pageText)
 	}
 
 	result := strings.TrimSpace(text.String())
 	if result == "" {
-		return "", fmt.Errorf("no text content found in PDF")
+		return nil, fmt.Errorf("no text content found in PDF")
 	}
 
-	return result, nil
+	return &ParseResult{
+		Text:       result,
+		PageStart:  start,
+		PageEnd:    end,
+		TotalPages: numPages,
+		Pages:      pages,
+	}, nil
 }
 
 // parseJSON 解析JSON文件
@@ -162,8 +266,11 @@ func (p *DocumentParser) parseHTML(content []byte) (string, error) {
 
 // ValidateFileType 验证文件类型是否支持
 func (p *DocumentParser) ValidateFileType(filename string, allowedTypes []string) error {
-	ext := strings.ToLower(filepath.Ext(filename))
-	
+	return p.ValidateDetectedType(strings.ToLower(filepath.Ext(filename)), filename, allowedTypes)
+}
+
+// ValidateDetectedType 验证检测出的文件类型是否在允许列表中
+func (p *DocumentParser) ValidateDetectedType(ext, filename string, allowedTypes []string) error {
 	// Debug logging
 	p.logger.Debug("Validating file type",
 		zap.String("filename", filename),
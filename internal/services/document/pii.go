@@ -0,0 +1,176 @@
+package document
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"eino-rag/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// 个人信息清理
+//
+// 部分知识库出于合规要求不能在分块和向量中保存原始的个人信息。知识库配置 pii_redaction 后，
+// 在解析和清理模板内容之后、切分之前，将匹配的内容替换为 [REDACTED_<类别>] 占位符：
+//   - email        电子邮箱
+//   - id_card      18位居民身份证号（校验末位）
+//   - credit_card  13-19位银行卡号（Luhn 校验），允许空格或短横线分隔
+//   - ssn          美国社会安全号 123-45-6789
+//   - phone        手机号（可带 +86）和带分隔符的国际/北美电话号码
+//   - ip           IPv4 地址
+//
+// 按上述顺序依次替换，已替换的内容不会再被后面的类别匹配（如身份证号不会再被识别为银行卡号）。
+// 各类别替换的次数记录在文档的 redactions 中，不记录原文。保存的全文、分块、向量和摘要都只包含替换后的文本。
+// 检测基于正则表达式，无法识别姓名、地址等自由文本，可先用预览接口检查效果。默认不开启。
+
+// PII 类别
+const (
+	PIIEmail      = "email"
+	PIIIDCard     = "id_card"
+	PIICreditCard = "credit_card"
+	PIISSN        = "ssn"
+	PIIPhone      = "phone"
+	PIIIP         = "ip"
+)
+
+// maxRedactionMatches 清理结果中最多列出的匹配内容，用于预览
+const maxRedactionMatches = 100
+
+// ErrUnknownPIICategory 知识库配置了不支持的个人信息类别
+var ErrUnknownPIICategory = errors.New("unknown PII category")
+
+// piiDetector 一类个人信息的检测规则
+type piiDetector struct {
+	category string
+	pattern  *regexp.Regexp
+	valid    func(match string) bool // 为nil时正则匹配即视为命中
+}
+
+// piiDetectors 按替换顺序排列，位数更多、规则更严格的类别在前
+var piiDetectors = []piiDetector{
+	{category: PIIEmail, pattern: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`)},
+	{category: PIIIDCard, pattern: regexp.MustCompile(`\b\d{17}[\dXx]\b`), valid: validIDCard},
+	{category: PIICreditCard, pattern: regexp.MustCompile(`\b\d(?:[ \-]?\d){12,18}\b`), valid: validLuhn},
+	{category: PIISSN, pattern: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)},
+	{category: PIIPhone, pattern: regexp.MustCompile(`(?:\+86[ \-]?)?\b1[3-9]\d{9}\b|\+\d{1,3}[ .\-]?\(?\d{1,4}\)?(?:[ .\-]?\d{2,4}){2,4}\b|\(?\b\d{3}\)?[ .\-]\d{3}[ .\-]\d{4}\b`)},
+	{category: PIIIP, pattern: regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\.){3}(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\b`)},
+}
+
+// PIIMatch 一处被替换的内容
+type PIIMatch struct {
+	Category string `json:"category" example:"email"`
+	Value    string `json:"value" example:"alice@example.com"`
+}
+
+// RedactionResult 个人信息清理结果
+type RedactionResult struct {
+	Text    string
+	Counts  map[string]int // 各类别替换的次数，没有替换时为空
+	Matches []PIIMatch     // 被替换的原文，最多 maxRedactionMatches 条
+}
+
+// PIICategories 返回支持的个人信息类别，按替换顺序排列
+func PIICategories() []string {
+	categories := make([]string, len(piiDetectors))
+	for i, d := range piiDetectors {
+		categories[i] = d.category
+	}
+	return categories
+}
+
+// ValidatePIICategories 检查知识库配置的个人信息类别是否都受支持
+func ValidatePIICategories(categories []string) error {
+	supported := PIICategories()
+	for _, category := range categories {
+		found := false
+		for _, s := range supported {
+			if category == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w %q, supported: %s", ErrUnknownPIICategory, category, strings.Join(supported, ", "))
+		}
+	}
+	return nil
+}
+
+// RedactPII 将文本中指定类别的个人信息替换为占位符
+func RedactPII(text string, categories []string) *RedactionResult {
+	result := &RedactionResult{Text: text, Counts: map[string]int{}}
+	enabled := make(map[string]bool, len(categories))
+	for _, category := range categories {
+		enabled[category] = true
+	}
+
+	for _, d := range piiDetectors {
+		if !enabled[d.category] {
+			continue
+		}
+		placeholder := "[REDACTED_" + strings.ToUpper(d.category) + "]"
+		result.Text = d.pattern.ReplaceAllStringFunc(result.Text, func(match string) string {
+			if d.valid != nil && !d.valid(match) {
+				return match
+			}
+			result.Counts[d.category]++
+			if len(result.Matches) < maxRedactionMatches {
+				result.Matches = append(result.Matches, PIIMatch{Category: d.category, Value: match})
+			}
+			return placeholder
+		})
+	}
+	return result
+}
+
+// validIDCard 校验18位身份证号的末位校验码
+func validIDCard(id string) bool {
+	weights := []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	checks := "10X98765432"
+	sum := 0
+	for i, w := range weights {
+		sum += int(id[i]-'0') * w
+	}
+	return strings.ToUpper(id[17:]) == string(checks[sum%11])
+}
+
+// validLuhn 去掉分隔符后按 Luhn 算法校验卡号
+func validLuhn(number string) bool {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(number)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// redactPII 按知识库设置清理文本中的个人信息，返回清理后的文本和各类别的替换次数
+func (s *Service) redactPII(kb *models.KnowledgeBase, filename, text string) (string, map[string]int) {
+	if len(kb.PIIRedaction) == 0 {
+		return text, nil
+	}
+
+	result := RedactPII(text, kb.PIIRedaction)
+	if len(result.Counts) > 0 {
+		s.logger.Info("Redacted PII from document",
+			zap.String("filename", filename),
+			zap.Uint("kb_id", kb.ID),
+			zap.Any("redactions", result.Counts))
+	}
+	return result.Text, result.Counts
+}
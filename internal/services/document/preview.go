@@ -0,0 +1,106 @@
+package document
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 文档预览
+//
+// 上传时把解析后文本的开头（DOCUMENT_PREVIEW_LENGTH 个字符，PDF 不超过第一页）保存为预览，
+// 文档列表中无需检索或读取全部分块就能辨认文档内容。预览取自去除样板内容和个人信息之后的文本，与保存的全文一致；
+// 控制字符和不可见的格式字符（如双向文本控制符）被去掉，连续空行合并，作为纯文本显示。
+// 预览列加入之前上传的文档在第一次请求预览时由保存的全文生成并写回。
+
+// blankLines 连续两个以上的空行
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// sanitizePreview 去掉不适合直接显示的字符：无效的UTF-8、控制字符（换行和制表符除外）和格式字符
+func sanitizePreview(text string) string {
+	text = strings.ToValidUTF8(text, "")
+	text = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' {
+			return r
+		}
+		if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+			return -1
+		}
+		return r
+	}, text)
+	return strings.TrimSpace(blankLines.ReplaceAllString(text, "\n\n"))
+}
+
+// BuildPreview 由文档文本生成预览，最多 maxLen 个字符；firstPage 不为空时预览不超过第一页的长度
+// maxLen <= 0 时返回空字符串
+func BuildPreview(text, firstPage string, maxLen int) string {
+	if maxLen <= 0 {
+		return ""
+	}
+	text = sanitizePreview(text)
+	if page := sanitizePreview(firstPage); page != "" {
+		maxLen = min(maxLen, utf8.RuneCountInString(page))
+	}
+
+	runes := []rune(text)
+	if len(runes) <= maxLen {
+		return text
+	}
+	return strings.TrimSpace(string(runes[:maxLen]))
+}
+
+// firstPage 返回PDF第一个有文本的页面，其他类型返回空字符串
+func firstPage(parsed *ParseResult) string {
+	for _, page := range parsed.Pages {
+		if strings.TrimSpace(page) != "" {
+			return page
+		}
+	}
+	return ""
+}
+
+// GetDocumentPreview 返回文档及其预览，没有保存预览的旧文档由保存的全文生成并写回
+func (s *Service) GetDocumentPreview(docID uint) (*models.Document, error) {
+	var doc models.Document
+	if err := db.GetDB().
+		Select("id", "knowledge_base_id", "file_name", "file_type", "total_pages", "preview").
+		First(&doc, docID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("document not found")
+		}
+		return nil, err
+	}
+	if doc.Preview != "" {
+		return &doc, nil
+	}
+
+	maxLen := s.config.Snapshot().DocumentPreviewLength
+	if maxLen <= 0 {
+		return &doc, nil
+	}
+	var text models.DocumentText
+	err := db.GetDB().First(&text, "document_id = ?", docID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &doc, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document text: %w", err)
+	}
+
+	doc.Preview = BuildPreview(text.Content, "", maxLen)
+	if err := db.GetDB().Model(&models.Document{}).Where("id = ?", docID).
+		UpdateColumn("preview", doc.Preview).Error; err != nil {
+		// 写回失败不影响本次返回，下次请求时重新生成
+		s.logger.Warn("Failed to save document preview", zap.Uint("doc_id", docID), zap.Error(err))
+	}
+	return &doc, nil
+}
@@ -3,6 +3,8 @@ package document
 import (
 	"fmt"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"eino-rag/internal/config"
 
@@ -15,6 +17,7 @@ type DocumentProcessor struct {
 	chunkSize        int
 	chunkOverlap     int
 	chunkingStrategy config.ChunkingStrategy
+	minChunkLength   int
 	logger           *zap.Logger
 }
 
@@ -23,10 +26,40 @@ func NewDocumentProcessor(cfg *config.Config, logger *zap.Logger) *DocumentProce
 		chunkSize:        cfg.ChunkSize,
 		chunkOverlap:     cfg.ChunkOverlap,
 		chunkingStrategy: cfg.ChunkingStrategy,
+		minChunkLength:   cfg.MinChunkLength,
 		logger:           logger,
 	}
 }
 
+// ChunkingParams 分块参数，随文档保存以便检测配置变更
+type ChunkingParams struct {
+	ChunkSize    int
+	ChunkOverlap int
+	Strategy     config.ChunkingStrategy
+	// MinChunkLength 只过滤噪声分块，不随文档保存，修改后不会将文档标记为需要重建索引
+	MinChunkLength int
+}
+
+// CurrentChunkingParams 返回当前配置的分块参数
+func CurrentChunkingParams(cfg *config.Config) ChunkingParams {
+	return ChunkingParams{
+		ChunkSize:      cfg.ChunkSize,
+		ChunkOverlap:   cfg.ChunkOverlap,
+		Strategy:       cfg.ChunkingStrategy,
+		MinChunkLength: cfg.MinChunkLength,
+	}
+}
+
+// ProcessTextWithParams 使用指定的分块参数处理文本，不影响处理器的默认参数
+func (p *DocumentProcessor) ProcessTextWithParams(content string, metadata map[string]interface{}, params ChunkingParams) ([]*schema.Document, error) {
+	processor := *p
+	processor.chunkSize = params.ChunkSize
+	processor.chunkOverlap = params.ChunkOverlap
+	processor.chunkingStrategy = params.Strategy
+	processor.minChunkLength = params.MinChunkLength
+	return processor.ProcessText(content, metadata)
+}
+
 // ProcessText 处理文本并分块
 func (p *DocumentProcessor) ProcessText(content string, metadata map[string]interface{}) ([]*schema.Document, error) {
 	p.logger.Info("Starting text processing",
@@ -62,19 +95,26 @@ func (p *DocumentProcessor) ProcessText(content string, metadata map[string]inte
 		return nil, fmt.Errorf("failed to split content: %w", err)
 	}
 
+	// 合并过短的分块，同时去掉空白分块，保证 chunk_index 连续
+	var merged, dropped int
+	chunks, merged, dropped = p.mergeShortChunks(chunks)
+	if merged > 0 || dropped > 0 {
+		p.logger.Info("Filtered short chunks",
+			zap.Int("min_chunk_length", p.minChunkLength),
+			zap.Int("merged", merged),
+			zap.Int("dropped", dropped),
+			zap.Int("chunk_count", len(chunks)))
+	}
+
 	// 创建文档对象
 	p.logger.Info("Creating document objects from chunks")
 	documents := make([]*schema.Document, 0, len(chunks))
 	for i, chunk := range chunks {
-		if strings.TrimSpace(chunk) == "" {
-			continue
-		}
-
 		doc := &schema.Document{
 			ID:      uuid.New().String(),
 			Content: chunk,
 			MetaData: map[string]interface{}{
-				"chunk_index": i,
+				"chunk_index":  i,
 				"total_chunks": len(chunks),
 			},
 		}
@@ -115,12 +155,14 @@ func (p *DocumentProcessor) splitByLength(content string) []string {
 	var chunks []string
 	start := 0
 	iteration := 0
+	maxIterations := p.maxSplitIterations(len(content))
 
 	for start < len(content) {
 		iteration++
-		if iteration > 1000 {
+		if iteration > maxIterations {
 			p.logger.Error("Too many iterations in splitByLength, possible infinite loop",
 				zap.Int("iteration", iteration),
+				zap.Int("max_iterations", maxIterations),
 				zap.Int("start", start),
 				zap.Int("content_length", len(content)))
 			break
@@ -133,7 +175,7 @@ func (p *DocumentProcessor) splitByLength(content string) []string {
 		// 尝试在单词边界处分割
 		if end < len(content) {
 			// 向前查找空格
-			for i := end; i > start && i > end-50; i-- {
+			for i := end; i > start && i > end-wordBoundaryLookback; i-- {
 				if content[i] == ' ' || content[i] == '\n' {
 					end = i
 					break
@@ -163,52 +205,158 @@ func (p *DocumentProcessor) splitByLength(content string) []string {
 	return chunks
 }
 
+// mergeShortChunks 将少于 minChunkLength 个字符的分块合并到前一个分块（第一个分块合并到后一个）。
+// 合并到前一个分块时去掉两者重叠的部分，避免同一段内容在分块中重复；去掉重叠后没有新内容的
+// 短分块直接丢弃，空白分块总是丢弃。只剩一个分块时即使过短也保留。
+// 只去掉合并处两侧的空白，未合并的分块内容保持不变。
+// 返回处理后的分块以及合并和丢弃的数量
+func (p *DocumentProcessor) mergeShortChunks(chunks []string) ([]string, int, int) {
+	result := make([]string, 0, len(chunks))
+	merged, dropped := 0, 0
+	pending := "" // 位于开头、等待合并到后一个分块的短内容
+
+	for _, chunk := range chunks {
+		trimmed := strings.TrimSpace(chunk)
+		if trimmed == "" {
+			continue
+		}
+		if p.minChunkLength <= 0 || utf8.RuneCountInString(trimmed) >= p.minChunkLength {
+			if pending != "" {
+				chunk = joinChunks(pending, chunk)
+				pending = ""
+			}
+			result = append(result, chunk)
+			continue
+		}
+
+		switch {
+		case len(result) == 0:
+			// 还没有前一个分块，累积到后一个分块开头
+			if pending != "" {
+				chunk = joinChunks(pending, chunk)
+			}
+			pending = chunk
+			merged++
+		default:
+			prev := result[len(result)-1]
+			overlap := p.chunkOverlapLen(prev, chunk)
+			rest := chunk[overlap:]
+			switch {
+			case strings.TrimSpace(rest) == "":
+				dropped++
+			case overlap > 0:
+				// 重叠来自同一段连续文本，原样接上
+				result[len(result)-1] = prev + rest
+				merged++
+			default:
+				result[len(result)-1] = joinChunks(prev, rest)
+				merged++
+			}
+		}
+	}
+
+	// 所有分块都过短时保留合并后的内容
+	if pending != "" {
+		result = append(result, pending)
+		merged--
+	}
+	return result, merged, dropped
+}
+
+// joinChunks 用空行连接两个分块，只去掉连接处两侧的空白
+func joinChunks(prev, next string) string {
+	return strings.TrimRightFunc(prev, unicode.IsSpace) + "\n\n" + strings.TrimLeftFunc(next, unicode.IsSpace)
+}
+
+// chunkOverlapLen 返回 next 开头与 prev 结尾重叠的字节数，未配置重叠时为0
+// 重叠须在 next 的单词边界处结束，避免把偶然相同的字符当作重叠
+func (p *DocumentProcessor) chunkOverlapLen(prev, next string) int {
+	if p.chunkOverlap <= 0 {
+		return 0
+	}
+	for n := len(next); n > 0; n-- {
+		if n < len(next) && next[n] != ' ' && next[n] != '\n' {
+			continue
+		}
+		if strings.HasSuffix(prev, next[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// wordBoundaryLookback splitByLength 在块末尾向前查找单词边界的最大字符数
+const wordBoundaryLookback = 50
+
+// maxSplitIterations 估算 splitByLength 的迭代上限
+// 每次迭代至少前进 chunkSize - chunkOverlap - wordBoundaryLookback 个字符（最少1个），
+// 按该步长所需的次数留出一倍余量，只有真正的死循环才会触发
+func (p *DocumentProcessor) maxSplitIterations(contentLen int) int {
+	step := p.chunkSize - p.chunkOverlap - wordBoundaryLookback
+	if step < 1 {
+		step = 1
+	}
+	return contentLen/step*2 + 10
+}
+
+// semanticSegment 语义分块的最小单位：一个段落，或超长段落拆出的一个片段
+type semanticSegment struct {
+	text string
+	sep  string // 与前一个单位之间的分隔符，段落之间为空行，片段之间为原文中的空白
+}
+
 // splitBySemantic 基于语义的分块（简化版本）
+// 段落按顺序装入块中，超过块大小的段落先在句末拆成片段，片段与普通段落一样装入块、携带重叠，
+// 因此超长段落的末尾会与后面的段落合并，同一文档的分块大小保持一致。
+// 新块会携带上一块最后一个单位的末尾作为重叠，重叠长度不超过 chunkOverlap，
+// 且总是短于该单位本身，避免整段重复
 func (p *DocumentProcessor) splitBySemantic(content string) []string {
 	// 首先按段落分割
-	paragraphs := strings.Split(content, "\n\n")
-	
-	var chunks []string
-	var currentChunk strings.Builder
-	currentSize := 0
-
-	for _, para := range paragraphs {
+	var segments []semanticSegment
+	for _, para := range strings.Split(content, "\n\n") {
 		para = strings.TrimSpace(para)
 		if para == "" {
 			continue
 		}
-
-		paraSize := len(para)
-		
-		// 如果段落本身就超过块大小，使用长度分割
-		if paraSize > p.chunkSize {
-			// 保存当前块
-			if currentSize > 0 {
-				chunks = append(chunks, currentChunk.String())
-				currentChunk.Reset()
-				currentSize = 0
-			}
-			
-			// 分割大段落
-			subChunks := p.splitByLength(para)
-			chunks = append(chunks, subChunks...)
+		if len(para) <= p.chunkSize {
+			segments = append(segments, semanticSegment{text: para, sep: "\n\n"})
 			continue
 		}
+		pieces := p.splitParagraph(para, p.maxPieceSize())
+		pieces[0].sep = "\n\n"
+		segments = append(segments, pieces...)
+	}
 
-		// 如果添加这个段落会超过块大小，先保存当前块
-		if currentSize+paraSize+2 > p.chunkSize && currentSize > 0 {
+	var chunks []string
+	var currentChunk strings.Builder
+	currentSize := 0
+	lastSegment := "" // 最近写入块中的最后一个单位，用于计算重叠
+
+	for _, segment := range segments {
+		size := len(segment.text)
+
+		// 如果添加这个单位会超过块大小，先保存当前块
+		if currentSize > 0 && currentSize+len(segment.sep)+size > p.chunkSize {
 			chunks = append(chunks, currentChunk.String())
 			currentChunk.Reset()
 			currentSize = 0
 		}
 
-		// 添加段落到当前块
+		// 新块开头携带上一块的末尾，并保证加入该单位后不超过块大小
+		if currentSize == 0 && len(chunks) > 0 {
+			if overlap := p.overlapTail(lastSegment, p.chunkSize-size-len(segment.sep)); overlap != "" {
+				currentChunk.WriteString(overlap)
+				currentSize = len(overlap)
+			}
+		}
+
 		if currentSize > 0 {
-			currentChunk.WriteString("\n\n")
-			currentSize += 2
+			currentChunk.WriteString(segment.sep)
+			currentSize += len(segment.sep)
 		}
-		currentChunk.WriteString(para)
-		currentSize += paraSize
+		currentChunk.WriteString(segment.text)
+		currentSize += size
+		lastSegment = segment.text
 	}
 
 	// 保存最后一个块
@@ -219,8 +367,145 @@ func (p *DocumentProcessor) splitBySemantic(content string) []string {
 	return chunks
 }
 
-// EstimateTokens 估算文本的token数量（简单估算）
+// maxPieceSize 超长段落拆出的片段的最大长度，为新块开头的重叠留出空间
+func (p *DocumentProcessor) maxPieceSize() int {
+	size := p.chunkSize - min(p.chunkOverlap, p.chunkSize/2) - 2
+	return max(size, 1)
+}
+
+// sentenceEnd 句末标点，其后可以拆分段落
+const sentenceEnd = "。！？；!?;"
+
+// splitParagraph 将超长段落拆成不超过 maxLen 的片段，片段之间保留原文的空白作为分隔符
+// 在句末标点和换行处拆分，每句一个片段，由 splitBySemantic 装入块中；单句仍过长时在单词边界处拆分，没有单词边界时按字符拆分
+func (p *DocumentProcessor) splitParagraph(para string, maxLen int) []semanticSegment {
+	var pieces []semanticSegment
+	add := func(text, sep string) {
+		for len(text) > maxLen {
+			cut, next := splitPoint(text, maxLen)
+			pieces = append(pieces, semanticSegment{text: text[:cut], sep: sep})
+			sep = whitespaceSep(text[cut:next])
+			text = text[next:]
+		}
+		pieces = append(pieces, semanticSegment{text: text, sep: sep})
+	}
+
+	start, sep := 0, ""
+	for i, r := range para {
+		boundary := r == '\n' || strings.ContainsRune(sentenceEnd, r) ||
+			(r == '.' && i+1 < len(para) && unicode.IsSpace(rune(para[i+1])))
+		if !boundary {
+			continue
+		}
+		end := i + utf8.RuneLen(r)
+		if r == '\n' {
+			end = i
+		}
+		if sentence := strings.TrimSpace(para[start:end]); sentence != "" {
+			add(sentence, sep)
+		}
+		// 句子之间的空白作为下一个片段的分隔符
+		rest := para[end:]
+		trimmed := strings.TrimLeftFunc(rest, unicode.IsSpace)
+		sep = whitespaceSep(rest[:len(rest)-len(trimmed)])
+		start = len(para) - len(trimmed)
+	}
+	if start < len(para) {
+		if sentence := strings.TrimSpace(para[start:]); sentence != "" {
+			add(sentence, sep)
+		}
+	}
+	return pieces
+}
+
+// splitPoint 在 text 的前 maxLen 个字节内选择拆分位置，返回片段结束位置和下一片段开始位置
+// 优先在最后一个空白处拆分，没有空白时在最后一个完整字符后拆分
+func splitPoint(text string, maxLen int) (int, int) {
+	if idx := strings.LastIndexAny(text[:maxLen+1], " \n\t"); idx > 0 {
+		cut, next := idx, idx+1
+		for cut > 0 && unicode.IsSpace(rune(text[cut-1])) {
+			cut--
+		}
+		for next < len(text) && unicode.IsSpace(rune(text[next])) {
+			next++
+		}
+		return cut, next
+	}
+	cut := maxLen
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	if cut == 0 {
+		// maxLen 小于一个字符时至少保留一个字符
+		_, size := utf8.DecodeRuneInString(text)
+		cut = size
+	}
+	return cut, cut
+}
+
+// whitespaceSep 将片段之间的空白规整为分隔符：包含换行时为换行，其他空白为一个空格
+func whitespaceSep(space string) string {
+	switch {
+	case space == "":
+		return ""
+	case strings.Contains(space, "\n"):
+		return "\n"
+	default:
+		return " "
+	}
+}
+
+// overlapTail 取文本末尾作为下一块的重叠内容，长度不超过 chunkOverlap 和 maxLen，且短于文本本身
+func (p *DocumentProcessor) overlapTail(text string, maxLen int) string {
+	n := p.chunkOverlap
+	if n > maxLen {
+		n = maxLen
+	}
+	if n > len(text)-1 {
+		n = len(text) - 1
+	}
+	if n <= 0 {
+		return ""
+	}
+
+	// 对齐到字符边界
+	start := len(text) - n
+	for start < len(text) && !utf8.RuneStart(text[start]) {
+		start++
+	}
+	tail := text[start:]
+
+	// 尽量从单词边界开始，避免截断半个单词
+	if idx := strings.IndexAny(tail, " \n"); idx >= 0 && idx < len(tail)/2 {
+		tail = tail[idx+1:]
+	}
+
+	return strings.TrimSpace(tail)
+}
+
+// EstimateTokens 按文字类型估算文本的token数量
+// 中日韩字符大约每个字符一个token，其他文字（拉丁字母、数字、标点、空白）大约每4个字符一个token
 func (p *DocumentProcessor) EstimateTokens(text string) int {
-	// 简单估算：平均每4个字符一个token
-	return len(text) / 4
+	cjkCount := 0
+	otherCount := 0
+	for _, r := range text {
+		if isCJK(r) {
+			cjkCount++
+		} else {
+			otherCount++
+		}
+	}
+
+	// 其他文字向上取整，避免短文本被估算为0
+	return cjkCount + (otherCount+3)/4
+}
+
+// isCJK 判断字符是否为中日韩文字或全角标点
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r) ||
+		(r >= 0x3000 && r <= 0x303F) || // 中日韩标点
+		(r >= 0xFF00 && r <= 0xFFEF) // 全角字符
 }
\ No newline at end of file
@@ -0,0 +1,117 @@
+package document
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+
+	"github.com/cloudwego/eino/schema"
+	"go.uber.org/zap"
+)
+
+// 时间衰减重排
+//
+// 新闻、变更日志等知识库中越新的文档越相关，仅按语义相似度排序容易把过时内容排在前面。
+// 启用后每个结果的最终分数为：
+//
+//	score = (1 - weight) * similarity + weight * 0.5^(age / halfLife)
+//
+// 其中 age 为文档创建至今的时间。为避免较新但相似度略低的结果在召回阶段就被截掉，
+// 启用时按候选召回倍数多召回候选再重排截断（见 candidates.go）。
+
+// ResolveRecency 返回实际使用的时间衰减权重和半衰期（天）
+// 请求指定的值优先，其次是知识库的设置，半衰期最后使用全局配置；权重为0表示不启用
+func ResolveRecency(cfg *config.Config, kbID uint, weight *float64, halfLifeDays float64) (float64, float64) {
+	var kb models.KnowledgeBase
+	if kbID > 0 && (weight == nil || halfLifeDays <= 0) {
+		db.GetDB().Select("recency_weight", "recency_half_life_days").First(&kb, kbID)
+	}
+
+	resolvedWeight := kb.RecencyWeight
+	if weight != nil {
+		resolvedWeight = *weight
+	}
+	resolvedWeight = math.Max(0, math.Min(1, resolvedWeight))
+
+	resolvedHalfLife := halfLifeDays
+	if resolvedHalfLife <= 0 {
+		resolvedHalfLife = kb.RecencyHalfLifeDays
+	}
+	if resolvedHalfLife <= 0 {
+		resolvedHalfLife = cfg.RecencyHalfLifeDays
+	}
+	return resolvedWeight, resolvedHalfLife
+}
+
+// recencyFactor 按半衰期计算新鲜度，刚创建为1，每经过一个半衰期减半
+func recencyFactor(createdAt, now time.Time, halfLifeDays float64) float64 {
+	if halfLifeDays <= 0 {
+		return 0
+	}
+	ageDays := now.Sub(createdAt).Hours() / 24
+	if ageDays < 0 {
+		ageDays = 0
+	}
+	return math.Exp2(-ageDays / halfLifeDays)
+}
+
+// applyRecency 结合相似度和文档创建时间重新计算分数并排序
+// 原始相似度保存在 similarity 中，找不到所属文档的结果新鲜度按0计算
+func (s *Service) applyRecency(docs []*schema.Document, weight, halfLifeDays float64, now time.Time) []*schema.Document {
+	if len(docs) == 0 {
+		return docs
+	}
+
+	docIDs := make([]uint, 0, len(docs))
+	for _, doc := range docs {
+		if docID, ok := doc.MetaData["doc_id"].(uint); ok {
+			docIDs = append(docIDs, docID)
+		}
+	}
+
+	var records []models.Document
+	if err := db.GetDB().Select("id", "created_at").Where("id IN ?", docIDs).Find(&records).Error; err != nil {
+		// 查询失败时保持按相似度排序
+		s.logger.Warn("Failed to load document timestamps for recency ranking", zap.Error(err))
+		return docs
+	}
+	createdAt := make(map[uint]time.Time, len(records))
+	for _, record := range records {
+		createdAt[record.ID] = record.CreatedAt
+	}
+
+	ranked := make([]*schema.Document, 0, len(docs))
+	for _, doc := range docs {
+		similarity, _ := doc.MetaData["score"].(float64)
+		docID, _ := doc.MetaData["doc_id"].(uint)
+
+		// 复制元数据，避免修改检索器或缓存持有的结果
+		metaData := make(map[string]interface{}, len(doc.MetaData)+2)
+		for k, v := range doc.MetaData {
+			metaData[k] = v
+		}
+
+		freshness := 0.0
+		if created, ok := createdAt[docID]; ok {
+			freshness = recencyFactor(created, now, halfLifeDays)
+			metaData["doc_created_at"] = created
+		}
+		metaData["similarity"] = similarity
+		metaData["score"] = (1-weight)*similarity + weight*freshness
+
+		ranked = append(ranked, &schema.Document{
+			ID:       doc.ID,
+			Content:  doc.Content,
+			MetaData: metaData,
+		})
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].MetaData["score"].(float64) > ranked[j].MetaData["score"].(float64)
+	})
+	return ranked
+}
@@ -0,0 +1,166 @@
+package document
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// 分片上传
+//
+// 大文件在不稳定的网络中上传失败后不必从头开始。客户端先创建会话并声明文件大小，
+// 然后按顺序上传分片，每个分片都带上起始位置（已接收的字节数）：
+//   - 起始位置与服务端记录的不一致时拒绝，客户端查询会话状态后从正确的位置继续
+//   - 请求中途断开时，已经收到的部分仍然有效，会话的位置推进到实际写入的字节数
+//   - 收到最后一个分片后，按普通上传的流程解析、切分和索引
+//
+// 会话保存在Redis中（见 db.SaveUploadSession），已接收的内容保存在 UPLOAD_SESSION_DIR 下的
+// <会话ID>.part 文件中。会话在 UPLOAD_SESSION_TTL 内没有新分片时过期，
+// 创建新会话时顺带删除已过期会话遗留的文件。
+
+var (
+	// ErrUploadOffsetMismatch 分片的起始位置与已接收的字节数不一致
+	ErrUploadOffsetMismatch = errors.New("upload offset does not match")
+	// ErrUploadTooLarge 声明的文件大小超过上限，或分片超出声明的文件大小
+	ErrUploadTooLarge = errors.New("upload exceeds the declared or maximum size")
+	// ErrUploadIncomplete 还有分片没有上传
+	ErrUploadIncomplete = errors.New("upload is not complete")
+)
+
+// NewUploadSession 检查文件大小和知识库，创建空的分片文件，返回尚未保存的会话
+func (s *Service) NewUploadSession(userID, kbID uint, filename string, size int64, opts UploadOptions) (*models.UploadSession, error) {
+	cfg := s.config.Snapshot()
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid upload size %d", size)
+	}
+	if size > cfg.MaxUploadSize {
+		return nil, fmt.Errorf("%w: %d bytes, at most %d allowed", ErrUploadTooLarge, size, cfg.MaxUploadSize)
+	}
+
+	var kb models.KnowledgeBase
+	if err := db.GetDB().Select("id").First(&kb, kbID).Error; err != nil {
+		return nil, fmt.Errorf("knowledge base with id %d not found", kbID)
+	}
+
+	if err := os.MkdirAll(cfg.UploadSessionDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	s.removeExpiredUploadParts(cfg.UploadSessionDir, cfg.UploadSessionTTL)
+
+	session := &models.UploadSession{
+		ID:              uuid.New().String(),
+		UserID:          userID,
+		KnowledgeBaseID: kbID,
+		FileName:        filename,
+		Size:            size,
+		PageStart:       opts.PageStart,
+		PageEnd:         opts.PageEnd,
+		Status:          models.UploadSessionUploading,
+		CreatedAt:       time.Now(),
+	}
+	file, err := os.Create(s.uploadPartPath(session.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload file: %w", err)
+	}
+	file.Close()
+	return session, nil
+}
+
+// WriteUploadPart 从 offset 开始写入一个分片并推进会话的位置
+// 写入中途出错时，已写入的部分同样计入位置，返回错误由调用方保存会话后告知客户端
+func (s *Service) WriteUploadPart(session *models.UploadSession, offset int64, part io.Reader) error {
+	if session.Status != models.UploadSessionUploading || offset != session.Offset {
+		return fmt.Errorf("%w: expected %d, got %d", ErrUploadOffsetMismatch, session.Offset, offset)
+	}
+
+	file, err := os.OpenFile(s.uploadPartPath(session.ID), os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open upload file: %w", err)
+	}
+	defer file.Close()
+
+	// 丢弃上一个请求写入后没来得及记录的内容
+	if err := file.Truncate(session.Offset); err != nil {
+		return fmt.Errorf("failed to truncate upload file: %w", err)
+	}
+	if _, err := file.Seek(session.Offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek upload file: %w", err)
+	}
+
+	// 多读一个字节，用于判断分片是否超出声明的大小
+	remaining := session.Size - session.Offset
+	written, err := io.Copy(file, io.LimitReader(part, remaining+1))
+	if written > remaining {
+		file.Truncate(session.Offset)
+		return fmt.Errorf("%w: declared %d bytes", ErrUploadTooLarge, session.Size)
+	}
+	session.Offset += written
+	if err != nil {
+		return fmt.Errorf("failed to write upload part: %w", err)
+	}
+	return nil
+}
+
+// CompleteUpload 按普通上传的流程处理已收齐的文件，完成后删除分片文件
+func (s *Service) CompleteUpload(ctx context.Context, session *models.UploadSession) (*models.Document, int, error) {
+	if session.Offset != session.Size {
+		return nil, 0, fmt.Errorf("%w: received %d of %d bytes", ErrUploadIncomplete, session.Offset, session.Size)
+	}
+
+	path := s.uploadPartPath(session.ID)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open upload file: %w", err)
+	}
+	defer func() {
+		file.Close()
+		os.Remove(path)
+	}()
+
+	return s.UploadDocument(ctx, session.FileName, file, session.KnowledgeBaseID, session.UserID, UploadOptions{
+		PageStart: session.PageStart,
+		PageEnd:   session.PageEnd,
+	})
+}
+
+// DiscardUploadParts 删除会话已接收的内容
+func (s *Service) DiscardUploadParts(sessionID string) {
+	if err := os.Remove(s.uploadPartPath(sessionID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		s.logger.Warn("Failed to remove upload file", zap.String("session_id", sessionID), zap.Error(err))
+	}
+}
+
+// uploadPartPath 会话已接收内容的文件路径
+func (s *Service) uploadPartPath(sessionID string) string {
+	return filepath.Join(s.config.Snapshot().UploadSessionDir, filepath.Base(sessionID)+".part")
+}
+
+// removeExpiredUploadParts 删除超过 ttl 没有写入的分片文件，对应的会话已在Redis中过期
+func (s *Service) removeExpiredUploadParts(dir string, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, "*.part"))
+	if err != nil {
+		return
+	}
+	for _, path := range matches {
+		info, err := os.Stat(path)
+		if err != nil || time.Since(info.ModTime()) < ttl {
+			continue
+		}
+		if err := os.Remove(path); err == nil {
+			s.logger.Info("Removed expired upload file", zap.String("path", path))
+		}
+	}
+}
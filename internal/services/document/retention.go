@@ -0,0 +1,297 @@
+package document
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 知识库文档保留期限
+//
+// 知识库设置了 retention_days 后，创建时间早于该期限的文档按 retention_action 处理：
+//   - delete   与删除接口相同，删除文档记录、原文、分块和向量
+//   - archive  删除分块和向量，保留文档记录和原文，状态改为 archived，不再参与检索
+//
+// 已索引的文档被处理后知识库的 doc_count 相应减少。未设置 retention_days 的知识库永久保留文档。
+// 清理时同时删除已过期的对话附件（见 attachment.go），并永久删除超过宽限期的软删除知识库（见 kb_delete.go）。
+// RetentionSweeper 每隔 RETENTION_CHECK_INTERVAL 执行一次，多副本部署时每个周期只有获得 leader 锁的节点执行，
+// 最近一次报告保存在Redis中供各节点查询。
+
+// ErrRetentionSweepRunning 已有保留期限清理正在执行
+var ErrRetentionSweepRunning = errors.New("retention sweep is already running")
+
+const (
+	retentionLeaderLockKey = "retention:leader"
+	retentionRunLockKey    = "retention:run"
+	retentionRunLockTTL    = 30 * time.Minute
+	retentionReportKey     = "retention:report"
+)
+
+// RetentionResult 一个知识库的清理结果
+type RetentionResult struct {
+	KnowledgeBaseID uint                   `json:"kb_id"`
+	RetentionDays   int                    `json:"retention_days"`
+	Action          models.RetentionAction `json:"action"`
+	Cutoff          time.Time              `json:"cutoff"`                   // 创建时间早于该时间的文档被处理
+	DocIDs          []uint                 `json:"doc_ids"`                  // 已删除或归档的文档ID
+	FailedDocIDs    []uint                 `json:"failed_doc_ids,omitempty"` // 处理失败、下次清理时重试的文档ID
+}
+
+// RetentionReport 一次保留期限清理的结果，只包含有过期文档的知识库
+type RetentionReport struct {
+	RanAt          time.Time         `json:"ran_at"`
+	DurationMs     int64             `json:"duration_ms"`
+	KnowledgeBases []RetentionResult `json:"knowledge_bases"`
+	// 附件已过期删除的对话ID
+	ExpiredAttachments []string `json:"expired_attachments,omitempty"`
+	// 超过宽限期被永久删除的软删除知识库ID
+	PurgedKnowledgeBases []uint `json:"purged_knowledge_bases,omitempty"`
+}
+
+// ApplyRetention 删除或归档各知识库中创建时间早于保留期限的文档，单个文档失败不影响其他文档
+func (s *Service) ApplyRetention(ctx context.Context, now time.Time) (*RetentionReport, error) {
+	database := db.GetDB()
+	report := &RetentionReport{RanAt: now, KnowledgeBases: []RetentionResult{}}
+
+	var kbs []models.KnowledgeBase
+	if err := database.WithContext(ctx).Where("retention_days > 0").Find(&kbs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list knowledge bases with retention: %w", err)
+	}
+
+	for _, kb := range kbs {
+		action := kb.RetentionAction
+		if action == "" {
+			action = models.RetentionDelete
+		}
+		cutoff := now.AddDate(0, 0, -kb.RetentionDays)
+
+		var docIDs []uint
+		if err := database.WithContext(ctx).Model(&models.Document{}).
+			Where("knowledge_base_id = ? AND created_at < ? AND status <> ?", kb.ID, cutoff, models.DocumentStatusArchived).
+			Order("id").
+			Pluck("id", &docIDs).Error; err != nil {
+			return nil, fmt.Errorf("failed to list expired documents: %w", err)
+		}
+		if len(docIDs) == 0 {
+			continue
+		}
+
+		result := RetentionResult{
+			KnowledgeBaseID: kb.ID,
+			RetentionDays:   kb.RetentionDays,
+			Action:          action,
+			Cutoff:          cutoff,
+			DocIDs:          []uint{},
+		}
+		for _, docID := range docIDs {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			var err error
+			if action == models.RetentionArchive {
+				err = s.archiveDocument(ctx, docID)
+			} else {
+				err = s.DeleteDocument(ctx, docID)
+			}
+			if err != nil {
+				s.logger.Warn("Failed to apply retention to document",
+					zap.Uint("kb_id", kb.ID),
+					zap.Uint("doc_id", docID),
+					zap.String("action", string(action)),
+					zap.Error(err))
+				result.FailedDocIDs = append(result.FailedDocIDs, docID)
+				continue
+			}
+			result.DocIDs = append(result.DocIDs, docID)
+		}
+
+		s.logger.Info("Applied knowledge base retention",
+			zap.Uint("kb_id", kb.ID),
+			zap.Int("retention_days", kb.RetentionDays),
+			zap.String("action", string(action)),
+			zap.Uints("doc_ids", result.DocIDs),
+			zap.Uints("failed_doc_ids", result.FailedDocIDs))
+		report.KnowledgeBases = append(report.KnowledgeBases, result)
+	}
+
+	expired, err := s.DeleteExpiredAttachments(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	if len(expired) > 0 {
+		s.logger.Info("Deleted expired conversation attachments", zap.Strings("conversation_ids", expired))
+		report.ExpiredAttachments = expired
+	}
+
+	purged, err := s.PurgeDeletedKnowledgeBases(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	if len(purged) > 0 {
+		s.logger.Info("Purged deleted knowledge bases", zap.Uints("kb_ids", purged))
+		report.PurgedKnowledgeBases = purged
+	}
+
+	report.DurationMs = time.Since(now).Milliseconds()
+	return report, nil
+}
+
+// archiveDocument 删除文档的分块和向量，保留文档记录和原文，状态改为 archived
+func (s *Service) archiveDocument(ctx context.Context, docID uint) error {
+	database := db.GetDB()
+
+	var doc models.Document
+	if err := database.First(&doc, docID).Error; err != nil {
+		return fmt.Errorf("document not found: %w", err)
+	}
+	wasIndexed := doc.Status.IsIndexed()
+
+	err := database.Transaction(func(tx *gorm.DB) error {
+		// 从向量数据库删除
+		if s.retriever != nil {
+			if err := s.retriever.DeleteByDocument(ctx, docID); err != nil {
+				return fmt.Errorf("failed to delete from vector database: %w", err)
+			}
+		} else {
+			s.logger.Warn("Vector deletion skipped - retriever not available",
+				zap.Uint("doc_id", docID))
+		}
+
+		if err := tx.Where("document_id = ?", docID).Delete(&models.DocumentChunk{}).Error; err != nil {
+			return fmt.Errorf("failed to delete document chunks: %w", err)
+		}
+		if err := tx.Model(&doc).Updates(map[string]interface{}{
+			"status":         models.DocumentStatusArchived,
+			"status_message": "",
+		}).Error; err != nil {
+			return fmt.Errorf("failed to archive document: %w", err)
+		}
+
+		// 更新知识库文档数量（未完成索引的文档没有计入）
+		if !wasIndexed {
+			return nil
+		}
+		if err := tx.Model(&models.KnowledgeBase{}).
+			Where("id = ?", doc.KnowledgeBaseID).
+			Update("doc_count", gorm.Expr("doc_count - 1")).Error; err != nil {
+			return fmt.Errorf("failed to update knowledge base doc count: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.invalidateRetrievalCache(doc.KnowledgeBaseID)
+	return nil
+}
+
+// RetentionSweeper 定期按知识库的保留期限清理文档
+type RetentionSweeper struct {
+	service *Service
+	config  *config.Config
+	logger  *zap.Logger
+
+	mu   sync.RWMutex
+	last *RetentionReport // Redis不可用时使用本节点最近一次的报告
+}
+
+func NewRetentionSweeper(service *Service, cfg *config.Config, logger *zap.Logger) *RetentionSweeper {
+	return &RetentionSweeper{
+		service: service,
+		config:  cfg,
+		logger:  logger,
+	}
+}
+
+// Start 在后台定期执行清理，ctx 结束时停止
+func (r *RetentionSweeper) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(consistencyPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.runAsLeader(ctx)
+			}
+		}
+	}()
+}
+
+// runAsLeader 获取 leader 锁后执行清理，锁不释放，在一个清理间隔后过期，期间其他节点不再清理
+func (r *RetentionSweeper) runAsLeader(ctx context.Context) {
+	interval := r.config.Snapshot().RetentionCheckInterval
+	if interval <= 0 {
+		return
+	}
+
+	// 维护期间不删除或归档文档，等下一个周期
+	if state, err := db.GetMaintenance(ctx); err != nil || state.Enabled {
+		if err != nil {
+			r.logger.Warn("Failed to get maintenance state, skipping retention sweep", zap.Error(err))
+		}
+		return
+	}
+
+	if _, err := db.AcquireLock(ctx, retentionLeaderLockKey, interval); err != nil {
+		if !errors.Is(err, db.ErrLockNotAcquired) {
+			r.logger.Warn("Failed to acquire retention sweep leader lock", zap.Error(err))
+		}
+		return
+	}
+	if _, err := r.Run(ctx); err != nil && !errors.Is(err, ErrRetentionSweepRunning) {
+		r.logger.Error("Retention sweep failed", zap.Error(err))
+	}
+}
+
+// Run 立即执行一次清理并保存报告
+func (r *RetentionSweeper) Run(ctx context.Context) (*RetentionReport, error) {
+	lock, err := db.AcquireLock(ctx, retentionRunLockKey, retentionRunLockTTL)
+	if errors.Is(err, db.ErrLockNotAcquired) {
+		return nil, ErrRetentionSweepRunning
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer db.ReleaseLock(context.Background(), lock)
+
+	report, err := r.service.ApplyRetention(ctx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.last = report
+	r.mu.Unlock()
+	if err := db.CacheSet(ctx, retentionReportKey, report, 0); err != nil {
+		r.logger.Warn("Failed to save retention report", zap.Error(err))
+	}
+	return report, nil
+}
+
+// LastReport 返回最近一次清理的报告，还没有清理过时返回nil
+func (r *RetentionSweeper) LastReport(ctx context.Context) *RetentionReport {
+	if db.GetRedis() != nil {
+		var report RetentionReport
+		if err := db.CacheGet(ctx, retentionReportKey, &report); err != nil {
+			r.logger.Warn("Failed to load retention report", zap.Error(err))
+		} else if !report.RanAt.IsZero() {
+			return &report
+		}
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.last
+}
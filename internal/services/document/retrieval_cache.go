@@ -0,0 +1,182 @@
+package document
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/rag"
+
+	"github.com/cloudwego/eino/schema"
+	"go.uber.org/zap"
+)
+
+// invalidateTimeout 使检索缓存失效的超时时间，失效在文档变更后执行，不使用请求的上下文
+const invalidateTimeout = 2 * time.Second
+
+// retrievalCacheKey 由规范化的查询、知识库、缓存版本、检索参数以及影响结果的模型和索引配置计算缓存键
+func (s *Service) retrievalCacheKey(query string, kbID uint, version int64, opts rag.RetrieveOptions) string {
+	cfg := s.config.Snapshot()
+	data, _ := json.Marshal(struct {
+		Query      string              `json:"q"`
+		KBID       uint                `json:"kb"`
+		Version    int64               `json:"v"`
+		Options    rag.RetrieveOptions `json:"o"`
+		Provider   string              `json:"p"`
+		Model      string              `json:"m"`
+		Collection string              `json:"c"`
+		IndexType  string              `json:"i"`
+		MetricType string              `json:"mt"`
+		Effort     int                 `json:"e"`
+		Alpha      float64             `json:"a"`
+		MMR        bool                `json:"mmr"`
+		MMRLambda  float64             `json:"ml"`
+	}{
+		Query:      strings.Join(strings.Fields(strings.ToLower(query)), " "),
+		KBID:       kbID,
+		Version:    version,
+		Options:    opts,
+		Provider:   cfg.EmbeddingProvider,
+		Model:      cfg.EmbeddingModel,
+		Collection: cfg.CollectionName,
+		IndexType:  cfg.IndexType,
+		MetricType: cfg.MetricType,
+		Effort:     rag.DefaultSearchEffort(cfg),
+		Alpha:      cfg.HybridAlpha,
+		MMR:        cfg.RetrievalMMR,
+		MMRLambda:  cfg.RetrievalMMRLambda,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// cachedRetrieve 检索文档，开启检索缓存时优先使用缓存的结果
+// 缓存只对指定知识库的检索生效，Redis 出错时直接检索
+func (s *Service) cachedRetrieve(ctx context.Context, query string, kbID uint, opts rag.RetrieveOptions) ([]*schema.Document, error) {
+	cfg := s.config.Snapshot()
+	// 使用备用嵌入服务期间的检索结果与主服务不同，不读写缓存
+	if !cfg.RetrievalCache || kbID == 0 || !db.RetrievalCacheAvailable() || rag.EmbeddingFailingOver(s.retriever) {
+		return s.retriever.RetrieveWithOptions(ctx, query, kbID, opts)
+	}
+
+	version, err := db.RetrievalCacheVersion(ctx, kbID)
+	if err != nil {
+		s.logger.Warn("Failed to get retrieval cache version", zap.Error(err))
+		return s.retriever.RetrieveWithOptions(ctx, query, kbID, opts)
+	}
+	key := s.retrievalCacheKey(query, kbID, version, opts)
+
+	hits, found, err := db.GetCachedRetrieval(ctx, key)
+	if err != nil {
+		s.logger.Warn("Failed to read retrieval cache", zap.Error(err))
+	}
+	if found {
+		docs, ok, err := loadCachedHits(hits)
+		if err != nil {
+			s.logger.Warn("Failed to load cached retrieval hits", zap.Error(err))
+		}
+		if ok {
+			s.logger.Debug("Retrieval cache hit",
+				zap.Uint("kb_id", kbID),
+				zap.Int("results", len(docs)))
+			return docs, nil
+		}
+	}
+
+	docs, err := s.retriever.RetrieveWithOptions(ctx, query, kbID, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	hits = make([]db.CachedHit, 0, len(docs))
+	for _, doc := range docs {
+		score, _ := doc.MetaData["score"].(float64)
+		hitKBID, _ := doc.MetaData["kb_id"].(uint)
+		hitDocID, _ := doc.MetaData["doc_id"].(uint)
+		hits = append(hits, db.CachedHit{ID: doc.ID, Score: score, KBID: hitKBID, DocID: hitDocID})
+	}
+	if err := db.CacheRetrieval(ctx, key, hits, cfg.RetrievalCacheTTL); err != nil {
+		s.logger.Warn("Failed to write retrieval cache", zap.Error(err))
+	}
+	return docs, nil
+}
+
+// loadCachedHits 从数据库读取缓存结果对应的分块内容，有分块已不存在时返回 false
+func loadCachedHits(hits []db.CachedHit) ([]*schema.Document, bool, error) {
+	if len(hits) == 0 {
+		return nil, true, nil
+	}
+
+	var chunkIDs []string
+	var summaryDocIDs []uint
+	for _, hit := range hits {
+		if rag.IsSummaryChunk(hit.ID) {
+			summaryDocIDs = append(summaryDocIDs, hit.DocID)
+		} else {
+			chunkIDs = append(chunkIDs, hit.ID)
+		}
+	}
+
+	contents := make(map[string]string, len(hits))
+	database := db.GetDB()
+	if len(chunkIDs) > 0 {
+		var chunks []models.DocumentChunk
+		if err := database.Select("chunk_id", "content").Where("chunk_id IN ?", chunkIDs).Find(&chunks).Error; err != nil {
+			return nil, false, err
+		}
+		for _, chunk := range chunks {
+			contents[chunk.ChunkID] = chunk.Content
+		}
+	}
+	if len(summaryDocIDs) > 0 {
+		var docs []models.Document
+		if err := database.Select("id", "summary").Where("id IN ?", summaryDocIDs).Find(&docs).Error; err != nil {
+			return nil, false, err
+		}
+		for _, doc := range docs {
+			if doc.Summary != "" {
+				contents[rag.SummaryChunkID(doc.ID)] = doc.Summary
+			}
+		}
+	}
+
+	docs := make([]*schema.Document, 0, len(hits))
+	for _, hit := range hits {
+		content, ok := contents[hit.ID]
+		if !ok {
+			return nil, false, nil
+		}
+		doc := &schema.Document{
+			ID:      hit.ID,
+			Content: content,
+			MetaData: map[string]interface{}{
+				"score":  hit.Score,
+				"kb_id":  hit.KBID,
+				"doc_id": hit.DocID,
+				"cached": true,
+			},
+		}
+		if rag.IsSummaryChunk(hit.ID) {
+			doc.MetaData["type"] = rag.ChunkTypeSummary
+		}
+		docs = append(docs, doc)
+	}
+	return docs, true, nil
+}
+
+// invalidateRetrievalCache 知识库的文档或向量发生变化后使其检索缓存失效
+func (s *Service) invalidateRetrievalCache(kbID uint) {
+	ctx, cancel := context.WithTimeout(context.Background(), invalidateTimeout)
+	defer cancel()
+
+	if err := db.InvalidateRetrievalCache(ctx, kbID); err != nil {
+		s.logger.Warn("Failed to invalidate retrieval cache",
+			zap.Uint("kb_id", kbID),
+			zap.Error(err))
+	}
+}
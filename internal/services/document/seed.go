@@ -0,0 +1,247 @@
+package document
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 启动时导入示例数据
+//
+// 演示和测试环境配置 SEED_PATH 后，服务启动时创建一个知识库并导入该目录下的示例文档。
+// 只有在数据库中还没有任何知识库（包括已软删除的）和文档时才会开始导入，已有数据的数据库永远不会被修改。
+// 示例文档通过正常的上传流程导入，会生成真实的分块和向量。
+//
+// 示例知识库的ID在创建时写入系统配置 seed_kb_id，所有文档导入成功后写入 seed_completed。
+// 导入中断或有文档失败时，下次启动继续向该知识库导入，已导入的文档作为重复文档跳过；
+// 多副本同时启动时通过分布式锁保证只有一个节点导入。
+
+const (
+	// seedKnowledgeBaseKey 系统配置中示例知识库ID的键
+	seedKnowledgeBaseKey = "seed_kb_id"
+	// seedCompletedKey 系统配置中示例数据导入完成时间的键
+	seedCompletedKey = "seed_completed"
+	// seedLockKey 导入示例数据的分布式锁
+	seedLockKey = "seed"
+	// seedLockTTL 导入示例数据的锁有效期，应大于导入全部示例文档的时间
+	seedLockTTL = 30 * time.Minute
+)
+
+// SeedResult 示例数据导入结果
+type SeedResult struct {
+	KnowledgeBaseID uint
+	Imported        int
+	Skipped         int // 之前的导入中已经导入的文档
+	Failed          int
+}
+
+// SeedIfEmpty 数据库为空时创建知识库并导入 dir 下的示例文档，之前的导入未完成时继续导入；
+// 数据库非空、导入已完成或其他节点正在导入时返回nil
+// 示例文档以默认管理员的身份导入，单个文档导入失败不影响其他文档
+func (s *Service) SeedIfEmpty(ctx context.Context, dir, kbName string) (*SeedResult, error) {
+	if s.retriever == nil {
+		return nil, fmt.Errorf("vector database is not available, cannot seed sample documents")
+	}
+
+	// 未配置Redis时只有单个节点，不需要加锁
+	if db.GetRedis() != nil {
+		lock, err := db.AcquireLock(ctx, seedLockKey, seedLockTTL)
+		if errors.Is(err, db.ErrLockNotAcquired) {
+			s.logger.Info("Another instance is seeding sample documents, skipping seed")
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer db.ReleaseLock(context.Background(), lock)
+	}
+
+	completed, err := seedConfigValue(seedCompletedKey)
+	if err != nil {
+		return nil, err
+	}
+	if completed != "" {
+		s.logger.Info("Sample documents already seeded, skipping seed")
+		return nil, nil
+	}
+
+	kb, removed, err := seedKnowledgeBase()
+	if err != nil {
+		return nil, err
+	}
+	if removed {
+		// 示例知识库在导入完成前被删除，不再重新导入
+		s.logger.Info("Seed knowledge base was deleted before seeding completed, skipping seed")
+		return nil, markSeedCompleted()
+	}
+	if kb == nil {
+		empty, err := databaseEmpty()
+		if err != nil {
+			return nil, err
+		}
+		if !empty {
+			s.logger.Info("Database already contains knowledge bases or documents, skipping seed")
+			return nil, nil
+		}
+	}
+
+	files, err := seedFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var admin models.User
+	adminRole := db.GetDB().Model(&models.Role{}).Select("id").Where("name = ?", "admin")
+	if err := db.GetDB().Where("role_id = (?)", adminRole).Order("id").First(&admin).Error; err != nil {
+		return nil, fmt.Errorf("failed to find admin user for seeding: %w", err)
+	}
+
+	if kb == nil {
+		kb = &models.KnowledgeBase{
+			Name:        kbName,
+			Description: "启动时导入的示例文档",
+			CreatorID:   admin.ID,
+		}
+		// 知识库和它的ID记录在同一事务中写入，中断后下次启动能找到该知识库
+		err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(kb).Error; err != nil {
+				return err
+			}
+			return tx.Save(&models.SystemConfig{Key: seedKnowledgeBaseKey, Value: strconv.FormatUint(uint64(kb.ID), 10)}).Error
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create seed knowledge base: %w", err)
+		}
+	} else {
+		s.logger.Info("Resuming incomplete sample document seed", zap.Uint("kb_id", kb.ID))
+	}
+
+	result := &SeedResult{KnowledgeBaseID: kb.ID}
+	for _, path := range files {
+		err := s.seedFile(ctx, path, kb.ID, admin.ID)
+		if errors.Is(err, ErrDuplicate) {
+			result.Skipped++
+			continue
+		}
+		if err != nil {
+			s.logger.Warn("Failed to seed sample document",
+				zap.String("path", path),
+				zap.Error(err))
+			result.Failed++
+			continue
+		}
+		result.Imported++
+	}
+
+	// 有文档导入失败时不记录完成，下次启动重试失败的文档
+	if result.Failed == 0 {
+		if err := markSeedCompleted(); err != nil {
+			return result, err
+		}
+	}
+
+	s.logger.Info("Seeded sample knowledge base",
+		zap.Uint("kb_id", kb.ID),
+		zap.String("name", kb.Name),
+		zap.Int("imported", result.Imported),
+		zap.Int("skipped", result.Skipped),
+		zap.Int("failed", result.Failed))
+	return result, nil
+}
+
+// seedConfigValue 读取示例数据相关的系统配置，不存在时返回空字符串
+func seedConfigValue(key string) (string, error) {
+	var item models.SystemConfig
+	err := db.GetDB().Where("key = ?", key).First(&item).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get seed state: %w", err)
+	}
+	return item.Value, nil
+}
+
+// seedKnowledgeBase 返回之前创建的示例知识库，还没有创建时返回nil；知识库已被删除（包括软删除）时 removed 为true
+func seedKnowledgeBase() (kb *models.KnowledgeBase, removed bool, err error) {
+	value, err := seedConfigValue(seedKnowledgeBaseKey)
+	if err != nil || value == "" {
+		return nil, false, err
+	}
+	kbID, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid seed knowledge base id %q: %w", value, err)
+	}
+
+	kb = &models.KnowledgeBase{}
+	err = db.GetDB().First(kb, kbID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, true, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get seed knowledge base: %w", err)
+	}
+	return kb, false, nil
+}
+
+// markSeedCompleted 记录示例数据导入完成，之后启动不再导入
+func markSeedCompleted() error {
+	value := time.Now().UTC().Format(time.RFC3339)
+	if err := db.GetDB().Save(&models.SystemConfig{Key: seedCompletedKey, Value: value}).Error; err != nil {
+		return fmt.Errorf("failed to record seed completion: %w", err)
+	}
+	return nil
+}
+
+// seedFile 通过上传流程导入单个示例文档
+func (s *Service) seedFile(ctx context.Context, path string, kbID, userID uint) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, _, err = s.UploadDocument(ctx, filepath.Base(path), file, kbID, userID, UploadOptions{})
+	return err
+}
+
+// databaseEmpty 数据库中是否还没有任何知识库和文档，已软删除的知识库也算作已有数据
+func databaseEmpty() (bool, error) {
+	var kbCount, docCount int64
+	if err := db.GetDB().Model(&models.KnowledgeBase{}).Unscoped().Count(&kbCount).Error; err != nil {
+		return false, fmt.Errorf("failed to count knowledge bases: %w", err)
+	}
+	if err := db.GetDB().Model(&models.Document{}).Count(&docCount).Error; err != nil {
+		return false, fmt.Errorf("failed to count documents: %w", err)
+	}
+	return kbCount == 0 && docCount == 0, nil
+}
+
+// seedFiles 返回目录下的示例文件，按文件名排序，忽略子目录和隐藏文件
+func seedFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seed directory: %w", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() || entry.Name()[0] == '.' {
+			continue
+		}
+		files = append(files, filepath.Join(dir, entry.Name()))
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -2,13 +2,16 @@ package document
 
 import (
 	"context"
-	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
+	"sync"
 	"time"
 
 	"eino-rag/internal/config"
 	"eino-rag/internal/db"
+	"eino-rag/internal/jobs"
 	"eino-rag/internal/models"
 	"eino-rag/internal/services/rag"
 
@@ -17,27 +20,70 @@ import (
 	"gorm.io/gorm"
 )
 
+var (
+	ErrRetryInProgress = errors.New("document is already being re-indexed")
+	ErrNotFailed       = errors.New("only failed documents can be re-indexed")
+	ErrNoStoredChunks  = errors.New("no stored chunks for this document, please upload it again")
+	ErrNoStoredText    = errors.New("no stored text for this document, please upload it again")
+	ErrNotIndexed      = errors.New("only indexed documents can be re-chunked")
+	ErrDuplicate       = errors.New("document already exists in this knowledge base")
+	ErrNoText          = errors.New("document has no extractable text")
+)
+
 type Service struct {
-	parser    *DocumentParser
-	processor *DocumentProcessor
-	retriever *rag.MilvusRetriever
-	logger    *zap.Logger
-	config    *config.Config
+	parser     *DocumentParser
+	processor  *DocumentProcessor
+	retriever  rag.Retriever // 可为nil，表示向量库不可用
+	summarizer *Summarizer // 可为nil，表示不生成摘要
+	expander   *QueryExpander
+	logger     *zap.Logger
+	config     *config.Config
+	retrying   sync.Map // 正在重新索引的文档ID，防止并发重试
+}
+
+// RetryResult 批量重新索引的统计结果
+type RetryResult struct {
+	Total     int    `json:"total"`
+	Succeeded int    `json:"succeeded"`
+	Failed    int    `json:"failed"`
+	Skipped   int    `json:"skipped"`
+	FailedIDs []uint `json:"failed_ids,omitempty"`
 }
 
 func NewService(
 	parser *DocumentParser,
 	processor *DocumentProcessor,
-	retriever *rag.MilvusRetriever,
+	retriever rag.Retriever,
+	summarizer *Summarizer,
 	cfg *config.Config,
 	logger *zap.Logger,
 ) *Service {
 	return &Service{
-		parser:    parser,
-		processor: processor,
-		retriever: retriever,
-		logger:    logger,
-		config:    cfg,
+		parser:     parser,
+		processor:  processor,
+		retriever:  retriever,
+		summarizer: summarizer,
+		expander:   NewQueryExpander(cfg, logger),
+		logger:     logger,
+		config:     cfg,
+	}
+}
+
+// UploadOptions 上传时的可选参数
+type UploadOptions struct {
+	PageStart int // PDF起始页，<= 0 表示从第一页开始
+	PageEnd   int // PDF结束页，<= 0 表示到最后一页
+
+	// Progress 不为nil时在每个处理阶段开始时调用，doc.Status 为当前阶段，切分完成后 chunkCount 为分块数，见 upload_job.go
+	Progress func(doc *models.Document, chunkCount int)
+	// EmbedProgress 不为nil时报告向量化进度，见 rag.AddOptions.Progress
+	EmbedProgress func(processed, total int)
+}
+
+// reportProgress 通知处理阶段的变化
+func (o UploadOptions) reportProgress(doc *models.Document, chunkCount int) {
+	if o.Progress != nil {
+		o.Progress(doc, chunkCount)
 	}
 }
 
@@ -48,7 +94,9 @@ func (s *Service) UploadDocument(
 	content io.Reader,
 	kbID uint,
 	userID uint,
+	opts UploadOptions,
 ) (*models.Document, int, error) {
+	cfg := s.config.Snapshot()
 	// 先检查retriever是否可用
 	if s.retriever == nil {
 		return nil, 0, fmt.Errorf("vector database is not available, please try again later")
@@ -66,170 +114,871 @@ func (s *Service) UploadDocument(
 	// Debug: Log allowed file types
 	s.logger.Info("Validating file upload",
 		zap.String("filename", filename),
-		zap.Strings("allowed_types", s.config.AllowedFileTypes))
+		zap.Strings("allowed_types", cfg.AllowedFileTypes))
 	
-	// 验证文件类型
-	if err := s.parser.ValidateFileType(filename, s.config.AllowedFileTypes); err != nil {
-		return nil, 0, err
-	}
-
 	// 读取文件内容
-	data, err := io.ReadAll(io.LimitReader(content, s.config.MaxUploadSize))
+	data, err := io.ReadAll(io.LimitReader(content, cfg.MaxUploadSize))
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to read file: %w", err)
 	}
 
-	// 计算文件哈希
-	hash := fmt.Sprintf("%x", sha256.Sum256(data))
+	// 验证文件类型，没有扩展名或扩展名不受支持时根据内容推断
+	fileType, err := s.parser.DetectFileType(filename, data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := s.parser.ValidateDetectedType(fileType, filename, cfg.AllowedFileTypes); err != nil {
+		return nil, 0, err
+	}
+
+	// 计算文件哈希，开启规范化时只有空白或行尾不同的文本文件也视为重复
+	hash, normalizedHash := ContentHashes(data, fileType)
 
 	// 检查文件是否已存在
 	database = db.GetDB()
+	dupQuery := database.Where("hash = ? AND knowledge_base_id = ?", hash, kbID)
+	if cfg.DedupNormalize {
+		dupQuery = database.Where("(hash = ? OR normalized_hash = ?) AND knowledge_base_id = ?", hash, normalizedHash, kbID)
+	}
 	var existingDoc models.Document
-	if err := database.Where("hash = ? AND knowledge_base_id = ?", hash, kbID).First(&existingDoc).Error; err == nil {
-		return nil, 0, fmt.Errorf("document already exists in this knowledge base")
+	if err := dupQuery.First(&existingDoc).Error; err == nil {
+		if existingDoc.Status != models.DocumentStatusFailed {
+			return nil, 0, ErrDuplicate
+		}
+		// 之前处理失败的记录不阻止重新上传，先清理旧记录
+		if err := s.removeFailedDocument(ctx, &existingDoc); err != nil {
+			return nil, 0, err
+		}
 	}
 
-	// 解析文档内容
-	text, err := s.parser.ParseDocument(filename, data)
+	// 解析文档内容，没有可用文本时不创建文档记录
+	parsed, err := s.parser.ParseDocumentWithOptions(filename, data, ParseOptions{
+		PageStart: opts.PageStart,
+		PageEnd:   opts.PageEnd,
+		MaxPages:  cfg.PDFMaxPages,
+		FileType:  fileType,
+	})
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to parse document: %w", err)
 	}
+	// 按知识库设置清理页眉页脚等模板内容
+	text, err := s.stripBoilerplate(&kb, filename, parsed)
+	if err != nil {
+		return nil, 0, err
+	}
+	// 按知识库设置替换个人信息，保存的全文、分块和向量都不包含原文
+	text, redactions := s.redactPII(&kb, filename, text)
+	if strings.TrimSpace(text) == "" {
+		if fileType == ".pdf" {
+			return nil, 0, fmt.Errorf("%w: the PDF may contain only scanned images, run OCR on it before uploading", ErrNoText)
+		}
+		return nil, 0, ErrNoText
+	}
 
-	// 创建文档记录
+	// 创建文档记录，后续每个阶段都会更新其状态
+	params := CurrentChunkingParams(cfg)
 	doc := &models.Document{
-		KnowledgeBaseID: kbID,
-		FileName:        filename,
-		FileSize:        int64(len(data)),
-		Hash:            hash,
-		CreatorID:       userID,
-		CreatedAt:       time.Now(),
-		UpdatedAt:       time.Now(),
+		KnowledgeBaseID:  kbID,
+		FileName:         filename,
+		FileSize:         int64(len(data)),
+		FileType:         fileType,
+		Hash:             hash,
+		NormalizedHash:   normalizedHash,
+		Status:           models.DocumentStatusUploaded,
+		ChunkSize:        params.ChunkSize,
+		ChunkOverlap:     params.ChunkOverlap,
+		ChunkingStrategy: string(params.Strategy),
+		PageStart:        parsed.PageStart, // 仅PDF记录实际解析的页码范围
+		PageEnd:          parsed.PageEnd,
+		TotalPages:       parsed.TotalPages,
+		Redactions:       redactions,
+		Preview:          BuildPreview(text, firstPage(parsed), cfg.DocumentPreviewLength),
+		CreatorID:        userID,
+		CreatedAt:        time.Now(),
+		UpdatedAt:        time.Now(),
+	}
+	if fm := parsed.Frontmatter; fm != nil {
+		doc.Title, doc.Author, doc.Tags, doc.DocumentDate = fm.Title, fm.Author, fm.Tags, fm.Date
+	}
+	if err := database.Create(doc).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to save document: %w", err)
 	}
 
-	// 开始事务
-	chunkCount := 0
+	// 保存解析后的文本，分块配置变更后可直接重新切分
+	if err := database.Create(&models.DocumentText{DocumentID: doc.ID, Content: text}).Error; err != nil {
+		return nil, 0, s.failDocument(doc, fmt.Errorf("failed to save document text: %w", err))
+	}
+
+	opts.reportProgress(doc, 0)
+
+	// 处理文档内容为chunks
+	s.updateStatus(doc, models.DocumentStatusChunking, "")
+	opts.reportProgress(doc, 0)
+	s.logger.Info("Starting document processing",
+		zap.String("filename", filename),
+		zap.Uint("doc_id", doc.ID),
+		zap.Int("text_length", len(text)))
+
+	metadata := map[string]interface{}{
+		"filename":  filename,
+		"file_type": fileType,
+		"kb_id":     kbID,
+		"doc_id":    doc.ID,
+		"user_id":   userID,
+	}
+	if parsed.TotalPages > 0 {
+		metadata["page_start"] = parsed.PageStart
+		metadata["page_end"] = parsed.PageEnd
+	}
+	addFrontmatterMetadata(metadata, doc)
+	metadata = chunkMetadata(s.config.Snapshot(), metadata)
+
+	// 使用 goroutine 和超时处理文本处理
+	type processResult struct {
+		chunks []*schema.Document
+		err    error
+	}
+
+	resultChan := make(chan processResult, 1)
+
+	go func() {
+		chunks, err := s.processor.ProcessTextWithParams(text, metadata, params)
+		resultChan <- processResult{chunks: chunks, err: err}
+	}()
+
+	// 使用配置的索引超时
 	var chunks []*schema.Document
-	err = database.Transaction(func(tx *gorm.DB) error {
-		// 保存文档记录
-		if err := tx.Create(doc).Error; err != nil {
-			return fmt.Errorf("failed to save document: %w", err)
+	select {
+	case result := <-resultChan:
+		if result.err != nil {
+			return nil, 0, s.failDocument(doc, fmt.Errorf("failed to process document: %w", result.err))
 		}
+		chunks = result.chunks
+	case <-time.After(cfg.IndexTimeout):
+		return nil, 0, s.failDocument(doc, &rag.TimeoutError{Stage: rag.StageChunking, Timeout: cfg.IndexTimeout, Err: context.DeadlineExceeded})
+	}
 
-		// 处理文档内容为chunks
-		s.logger.Info("Starting document processing",
-			zap.String("filename", filename),
-			zap.Uint("doc_id", doc.ID),
-			zap.Int("text_length", len(text)))
-		
-		metadata := map[string]interface{}{
-			"filename": filename,
-			"kb_id":    kbID,
-			"doc_id":   doc.ID,
-			"user_id":  userID,
-		}
-
-		// 使用 goroutine 和超时处理文本处理
-		type processResult struct {
-			chunks []*schema.Document
-			err    error
-		}
-		
-		resultChan := make(chan processResult, 1)
-		
-		go func() {
-			chunks, err := s.processor.ProcessText(text, metadata)
-			resultChan <- processResult{chunks: chunks, err: err}
-		}()
-		
-		// 使用配置的索引超时
-		select {
-		case result := <-resultChan:
-			if result.err != nil {
-				return fmt.Errorf("failed to process document: %w", result.err)
-			}
-			chunks = result.chunks
-		case <-time.After(s.config.IndexTimeout):
-			return fmt.Errorf("document processing timeout after %v", s.config.IndexTimeout)
+	// 分块数超过上限时在向量化前拒绝或截断，拒绝时不保留文档记录
+	chunks, err = s.limitChunks(doc, chunks, cfg)
+	if err != nil {
+		if removeErr := s.removeFailedDocument(ctx, doc); removeErr != nil {
+			s.logger.Warn("Failed to remove rejected document",
+				zap.Uint("doc_id", doc.ID),
+				zap.Error(removeErr))
 		}
+		return nil, 0, err
+	}
 
-		chunkCount = len(chunks)
-		s.logger.Info("Document processed into chunks",
-			zap.String("filename", filename),
-			zap.Uint("doc_id", doc.ID),
-			zap.Int("chunk_count", chunkCount))
+	chunkCount := len(chunks)
+	s.logger.Info("Document processed into chunks",
+		zap.String("filename", filename),
+		zap.Uint("doc_id", doc.ID),
+		zap.Int("chunk_count", chunkCount))
+
+	// 保存分块内容，索引失败时可直接重试
+	if err := s.saveChunks(doc.ID, chunks); err != nil {
+		return nil, 0, s.failDocument(doc, err)
+	}
+
+	// 添加到向量数据库
+	s.updateStatus(doc, models.DocumentStatusEmbedding, "")
+	opts.reportProgress(doc, chunkCount)
+	s.logger.Info("Starting vector indexing",
+		zap.String("filename", filename),
+		zap.Uint("doc_id", doc.ID),
+		zap.Int("chunk_count", chunkCount))
+
+	indexed, err := s.indexChunks(ctx, doc, chunks, opts.EmbedProgress)
+	if err != nil {
+		return nil, 0, s.failDocument(doc, err)
+	}
+
+	s.logger.Info("Vector indexing completed",
+		zap.String("filename", filename),
+		zap.Uint("doc_id", doc.ID),
+		zap.Int("indexed_chunks", indexed),
+		zap.Int("failed_chunks", doc.FailedChunks))
+
+	// 标记索引完成并更新知识库文档数量
+	if err := s.markIndexed(doc); err != nil {
+		return nil, 0, s.failDocument(doc, err)
+	}
+
+	s.logger.Info("Document uploaded successfully",
+		zap.String("filename", filename),
+		zap.Uint("kb_id", kbID),
+		zap.Uint("doc_id", doc.ID),
+		zap.Int("chunks", indexed))
+
+	// 异步生成摘要，不阻塞上传
+	if s.summarizer != nil && s.summarizer.ShouldSummarize(text) {
+		go s.generateSummary(doc.ID, kbID, text)
+	}
+
+	return doc, indexed, nil
+}
+
+// indexChunks 将分块写入向量库，返回成功写入的数量
+// 开启 EmbeddingSkipFailedChunks 时跳过向量化失败的分块，并记录到 doc.FailedChunks；progress 不为nil时报告向量化进度
+func (s *Service) indexChunks(ctx context.Context, doc *models.Document, chunks []*schema.Document, progress func(processed, total int)) (int, error) {
+	if err := s.addEmbeddingContext(doc, chunks); err != nil {
+		return 0, err
+	}
+	attachment, err := isAttachmentKnowledgeBase(doc.KnowledgeBaseID)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := s.retriever.AddDocumentsWithOptions(ctx, chunks, doc.KnowledgeBaseID, doc.ID, rag.AddOptions{
+		SkipFailed:       s.config.Snapshot().EmbeddingSkipFailedChunks,
+		Progress:         progress,
+		DefaultPartition: attachment,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to index document: %w", err)
+	}
+
+	doc.FailedChunks = len(result.FailedChunkIDs)
+	return result.Indexed, nil
+}
+
+// generateSummary 生成并保存文档摘要，按配置将摘要作为特殊分块写入向量库
+func (s *Service) generateSummary(docID, kbID uint, text string) {
+	ctx, cancel := context.WithTimeout(context.Background(), summaryTimeout)
+	defer cancel()
+
+	summary, err := s.summarizer.Summarize(ctx, text)
+	if err != nil {
+		s.logger.Warn("Failed to summarize document",
+			zap.Uint("doc_id", docID),
+			zap.Error(err))
+		return
+	}
+
+	result := db.GetDB().Model(&models.Document{}).Where("id = ?", docID).Update("summary", summary)
+	if result.Error != nil {
+		s.logger.Warn("Failed to save document summary",
+			zap.Uint("doc_id", docID),
+			zap.Error(result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		// 文档在生成摘要期间已被删除
+		return
+	}
+
+	s.logger.Info("Document summary generated",
+		zap.Uint("doc_id", docID),
+		zap.Int("summary_length", len(summary)))
+
+	s.indexSummary(ctx, docID, kbID, summary)
+}
+
+// indexSummary 按配置将摘要作为特殊分块写入向量库
+func (s *Service) indexSummary(ctx context.Context, docID, kbID uint, summary string) {
+	if summary == "" || !s.config.Snapshot().SummaryIndexChunk || s.retriever == nil {
+		return
+	}
+
+	attachment, err := isAttachmentKnowledgeBase(kbID)
+	if err != nil {
+		s.logger.Warn("Failed to index document summary",
+			zap.Uint("doc_id", docID),
+			zap.Error(err))
+		return
+	}
+
+	chunk := &schema.Document{
+		ID:      rag.SummaryChunkID(docID),
+		Content: summary,
+	}
+	opts := rag.AddOptions{DefaultPartition: attachment}
+	if _, err := s.retriever.AddDocumentsWithOptions(ctx, []*schema.Document{chunk}, kbID, docID, opts); err != nil {
+		s.logger.Warn("Failed to index document summary",
+			zap.Uint("doc_id", docID),
+			zap.Error(err))
+		return
+	}
+	s.invalidateRetrievalCache(kbID)
+}
+
+// markIndexed 在同一事务中将文档标记为已索引并增加知识库文档数量
+// 有分块被跳过或截断时标记为部分索引
+func (s *Service) markIndexed(doc *models.Document) error {
+	status := models.DocumentStatusIndexed
+	var messages []string
+	if doc.FailedChunks > 0 {
+		status = models.DocumentStatusPartiallyIndexed
+		messages = append(messages, fmt.Sprintf("%d chunks failed to embed and were skipped", doc.FailedChunks))
+	}
+	if doc.TruncatedChunks > 0 {
+		status = models.DocumentStatusPartiallyIndexed
+		messages = append(messages, fmt.Sprintf("%d chunks beyond the maximum number of chunks were dropped", doc.TruncatedChunks))
+	}
+	message := strings.Join(messages, "; ")
+
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(doc).Updates(map[string]interface{}{
+			"status":            status,
+			"status_message":    message,
+			"failed_chunks":     doc.FailedChunks,
+			"truncated_chunks":  doc.TruncatedChunks,
+			"chunk_size":        doc.ChunkSize,
+			"chunk_overlap":     doc.ChunkOverlap,
+			"chunking_strategy": doc.ChunkingStrategy,
+			"updated_at":        time.Now(),
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update document status: %w", err)
+		}
 
-		// 添加到向量数据库
-		s.logger.Info("Starting vector indexing",
-			zap.String("filename", filename),
-			zap.Uint("doc_id", doc.ID),
-			zap.Int("chunk_count", chunkCount))
-		
-		if err := s.retriever.AddDocuments(ctx, chunks, kbID, doc.ID); err != nil {
-			return fmt.Errorf("failed to index document: %w", err)
-		}
-		
-		s.logger.Info("Vector indexing completed",
-			zap.String("filename", filename),
-			zap.Uint("doc_id", doc.ID))
-
-		// 更新知识库文档数量
-		s.logger.Info("Updating knowledge base doc count",
-			zap.Uint("kb_id", kbID))
-		
 		// 使用 Exec 执行原生 SQL 更新
-		result := tx.Exec("UPDATE knowledge_bases SET doc_count = doc_count + 1, updated_at = ? WHERE id = ?", 
-			time.Now(), kbID)
-		
+		result := tx.Exec("UPDATE knowledge_bases SET doc_count = doc_count + 1, updated_at = ? WHERE id = ?",
+			time.Now(), doc.KnowledgeBaseID)
+
 		if result.Error != nil {
 			return fmt.Errorf("failed to update knowledge base doc count: %w", result.Error)
 		}
-		
+
 		if result.RowsAffected == 0 {
-			return fmt.Errorf("knowledge base with id %d not found", kbID)
+			return fmt.Errorf("knowledge base with id %d not found", doc.KnowledgeBaseID)
 		}
-		
+
 		s.logger.Info("Knowledge base doc count updated",
-			zap.Uint("kb_id", kbID),
+			zap.Uint("kb_id", doc.KnowledgeBaseID),
 			zap.Int64("rows_affected", result.RowsAffected))
 
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	s.invalidateRetrievalCache(doc.KnowledgeBaseID)
+	return nil
+}
 
+// updateStatus 更新文档的流水线状态
+func (s *Service) updateStatus(doc *models.Document, status models.DocumentStatus, message string) {
+	doc.Status = status
+	doc.StatusMessage = message
+	if err := db.GetDB().Model(&models.Document{}).Where("id = ?", doc.ID).Updates(map[string]interface{}{
+		"status":         status,
+		"status_message": message,
+		"updated_at":     time.Now(),
+	}).Error; err != nil {
+		s.logger.Warn("Failed to update document status",
+			zap.Uint("doc_id", doc.ID),
+			zap.String("status", string(status)),
+			zap.Error(err))
+	}
+}
+
+// failDocument 将文档标记为失败并记录原因，返回原始错误
+func (s *Service) failDocument(doc *models.Document, err error) error {
+	s.logger.Error("Document ingestion failed",
+		zap.Uint("doc_id", doc.ID),
+		zap.String("stage", string(doc.Status)),
+		zap.Error(err))
+	s.updateStatus(doc, models.DocumentStatusFailed, fmt.Sprintf("%s: %v", doc.Status, err))
+	// 失败前可能已删除或写入了部分向量
+	s.invalidateRetrievalCache(doc.KnowledgeBaseID)
+	return err
+}
+
+// removeFailedDocument 清理处理失败的文档记录及其可能残留的向量
+func (s *Service) removeFailedDocument(ctx context.Context, doc *models.Document) error {
+	if err := s.retriever.DeleteByDocument(ctx, doc.ID); err != nil {
+		s.logger.Warn("Failed to delete vectors of failed document",
+			zap.Uint("doc_id", doc.ID),
+			zap.Error(err))
+	}
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("document_id = ?", doc.ID).Delete(&models.DocumentChunk{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("document_id = ?", doc.ID).Delete(&models.DocumentText{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(doc).Error
+	})
 	if err != nil {
+		return fmt.Errorf("failed to remove failed document: %w", err)
+	}
+	s.invalidateRetrievalCache(doc.KnowledgeBaseID)
+	return nil
+}
+
+// saveChunks 保存文档的分块内容
+func (s *Service) saveChunks(docID uint, chunks []*schema.Document) error {
+	records := make([]models.DocumentChunk, len(chunks))
+	for i, chunk := range chunks {
+		records[i] = models.DocumentChunk{
+			DocumentID: docID,
+			ChunkID:    chunk.ID,
+			ChunkIndex: i,
+			Content:    chunk.Content,
+			CreatedAt:  time.Now(),
+		}
+	}
+
+	if len(records) == 0 {
+		return nil
+	}
+	if err := db.GetDB().CreateInBatches(records, 100).Error; err != nil {
+		return fmt.Errorf("failed to save document chunks: %w", err)
+	}
+	return nil
+}
+
+// RetryIndex 使用已保存的分块重新执行向量化和写入，仅适用于失败的文档
+// 返回更新后的文档和成功写入的分块数
+func (s *Service) RetryIndex(ctx context.Context, docID uint) (*models.Document, int, error) {
+	if s.retriever == nil {
+		return nil, 0, fmt.Errorf("vector database is not available, please try again later")
+	}
+
+	// 同一文档同时只允许一个重试
+	if _, loaded := s.retrying.LoadOrStore(docID, struct{}{}); loaded {
+		return nil, 0, ErrRetryInProgress
+	}
+	defer s.retrying.Delete(docID)
+
+	database := db.GetDB()
+	var doc models.Document
+	if err := database.First(&doc, docID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, 0, fmt.Errorf("document not found")
+		}
 		return nil, 0, err
 	}
+	if doc.Status != models.DocumentStatusFailed {
+		return nil, 0, ErrNotFailed
+	}
 
-	s.logger.Info("Document uploaded successfully",
-		zap.String("filename", filename),
-		zap.Uint("kb_id", kbID),
+	// 读取已保存的分块
+	var records []models.DocumentChunk
+	if err := database.Where("document_id = ?", docID).Order("chunk_index ASC").Find(&records).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load document chunks: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, 0, ErrNoStoredChunks
+	}
+
+	chunks := make([]*schema.Document, len(records))
+	for i, record := range records {
+		chunks[i] = &schema.Document{
+			ID:      record.ChunkID,
+			Content: record.Content,
+		}
+	}
+
+	s.logger.Info("Retrying document indexing",
 		zap.Uint("doc_id", doc.ID),
-		zap.Int("chunks", chunkCount))
+		zap.Int("chunk_count", len(chunks)))
 
-	return doc, chunkCount, nil
+	// 清理上次可能残留的向量，避免重复
+	s.updateStatus(&doc, models.DocumentStatusEmbedding, "")
+	if err := s.retriever.DeleteByDocument(ctx, doc.ID); err != nil {
+		return nil, 0, s.failDocument(&doc, fmt.Errorf("failed to clean up old vectors: %w", err))
+	}
+
+	indexed, err := s.indexChunks(ctx, &doc, chunks, nil)
+	if err != nil {
+		return nil, 0, s.failDocument(&doc, err)
+	}
+
+	if err := s.markIndexed(&doc); err != nil {
+		return nil, 0, s.failDocument(&doc, err)
+	}
+
+	s.logger.Info("Document re-indexed successfully",
+		zap.Uint("doc_id", doc.ID),
+		zap.Int("indexed_chunks", indexed),
+		zap.Int("failed_chunks", doc.FailedChunks))
+
+	return &doc, indexed, nil
+}
+
+// RetryFailedDocuments 重新索引所有失败的文档，progress 不为nil时报告每个文档的处理进度
+func (s *Service) RetryFailedDocuments(ctx context.Context, progress jobs.Reporter) (*RetryResult, error) {
+	var docIDs []uint
+	if err := db.GetDB().Model(&models.Document{}).
+		Where("status = ?", models.DocumentStatusFailed).
+		Scopes(ActiveDocuments).
+		Pluck("id", &docIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list failed documents: %w", err)
+	}
+
+	result := &RetryResult{Total: len(docIDs)}
+	if progress != nil {
+		progress.SetTotal(len(docIDs))
+	}
+	for _, docID := range docIDs {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+
+		_, _, err := s.RetryIndex(ctx, docID)
+		switch {
+		case err == nil:
+			result.Succeeded++
+		case errors.Is(err, ErrRetryInProgress), errors.Is(err, ErrNotFailed), errors.Is(err, ErrNoStoredChunks):
+			result.Skipped++
+			err = nil
+		default:
+			result.Failed++
+			result.FailedIDs = append(result.FailedIDs, docID)
+		}
+		if progress != nil {
+			progress.Advance(fmt.Sprintf("document %d", docID), err)
+		}
+	}
+
+	s.logger.Info("Retried failed documents",
+		zap.Int("total", result.Total),
+		zap.Int("succeeded", result.Succeeded),
+		zap.Int("failed", result.Failed),
+		zap.Int("skipped", result.Skipped))
+
+	return result, nil
+}
+
+// outdatedScope 筛选已索引且分块参数与当前配置不一致的文档，kbID 为 0 时不限知识库
+func outdatedScope(params ChunkingParams, kbID uint) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		tx = tx.Where("status IN ?", []models.DocumentStatus{models.DocumentStatusIndexed, models.DocumentStatusPartiallyIndexed}).
+			Where("chunk_size <> ? OR chunk_overlap <> ? OR chunking_strategy <> ?",
+				params.ChunkSize, params.ChunkOverlap, string(params.Strategy)).
+			Scopes(ActiveDocuments)
+		if kbID > 0 {
+			tx = tx.Where("knowledge_base_id = ?", kbID)
+		}
+		return tx
+	}
+}
+
+// GetOutdatedDocuments 获取分块参数与当前配置不一致的文档（支持分页）
+func (s *Service) GetOutdatedDocuments(kbID uint, page, pageSize int) ([]models.Document, int64, error) {
+	database := db.GetDB()
+	scope := outdatedScope(CurrentChunkingParams(s.config.Snapshot()), kbID)
+
+	var total int64
+	if err := database.Model(&models.Document{}).Scopes(scope).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var docs []models.Document
+	offset := (page - 1) * pageSize
+	if err := database.Preload("KnowledgeBase").
+		Scopes(scope).
+		Offset(offset).
+		Limit(pageSize).
+		Order("created_at DESC").
+		Find(&docs).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return docs, total, nil
+}
+
+// HasStoredText 返回给定文档中保存了解析文本、可以重新切分的文档ID集合
+func (s *Service) HasStoredText(docIDs []uint) (map[uint]bool, error) {
+	result := make(map[uint]bool, len(docIDs))
+	if len(docIDs) == 0 {
+		return result, nil
+	}
+
+	var ids []uint
+	if err := db.GetDB().Model(&models.DocumentText{}).
+		Where("document_id IN ?", docIDs).
+		Pluck("document_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		result[id] = true
+	}
+	return result, nil
+}
+
+// Rechunk 使用当前分块配置重新切分并索引已索引的文档
+func (s *Service) Rechunk(ctx context.Context, docID uint) (*models.Document, int, error) {
+	cfg := s.config.Snapshot()
+	if s.retriever == nil {
+		return nil, 0, fmt.Errorf("vector database is not available, please try again later")
+	}
+
+	// 与重试共用互斥，同一文档同时只允许一个重新索引
+	if _, loaded := s.retrying.LoadOrStore(docID, struct{}{}); loaded {
+		return nil, 0, ErrRetryInProgress
+	}
+	defer s.retrying.Delete(docID)
+
+	database := db.GetDB()
+	var doc models.Document
+	if err := database.First(&doc, docID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, 0, fmt.Errorf("document not found")
+		}
+		return nil, 0, err
+	}
+	if !doc.Status.IsIndexed() {
+		return nil, 0, ErrNotIndexed
+	}
+
+	var text models.DocumentText
+	if err := database.First(&text, "document_id = ?", docID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, 0, ErrNoStoredText
+		}
+		return nil, 0, fmt.Errorf("failed to load document text: %w", err)
+	}
+
+	params := CurrentChunkingParams(cfg)
+	metadata := map[string]interface{}{
+		"filename": doc.FileName,
+		"kb_id":    doc.KnowledgeBaseID,
+		"doc_id":   doc.ID,
+		"user_id":  doc.CreatorID,
+	}
+	addFrontmatterMetadata(metadata, &doc)
+	metadata = chunkMetadata(cfg, metadata)
+	chunks, err := s.processor.ProcessTextWithParams(text.Content, metadata, params)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to process document: %w", err)
+	}
+	// 超过分块数上限时保留原有分块和向量
+	if chunks, err = s.limitChunks(&doc, chunks, cfg); err != nil {
+		return nil, 0, err
+	}
+
+	s.logger.Info("Re-chunking document with current config",
+		zap.Uint("doc_id", doc.ID),
+		zap.Int("old_chunk_size", doc.ChunkSize),
+		zap.Int("new_chunk_size", params.ChunkSize),
+		zap.Int("chunk_count", len(chunks)))
+
+	// 旧向量删除后文档暂不可检索，先从知识库文档数量中移除，完成后由 markIndexed 加回
+	if err := s.unmarkIndexed(&doc); err != nil {
+		return nil, 0, err
+	}
+
+	// 替换已保存的分块，失败后仍可通过重试接口基于新分块恢复
+	err = database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("document_id = ?", doc.ID).Delete(&models.DocumentChunk{}).Error; err != nil {
+			return err
+		}
+		doc.ChunkSize = params.ChunkSize
+		doc.ChunkOverlap = params.ChunkOverlap
+		doc.ChunkingStrategy = string(params.Strategy)
+		return tx.Model(&doc).Updates(map[string]interface{}{
+			"chunk_size":        doc.ChunkSize,
+			"chunk_overlap":     doc.ChunkOverlap,
+			"chunking_strategy": doc.ChunkingStrategy,
+		}).Error
+	})
+	if err != nil {
+		return nil, 0, s.failDocument(&doc, fmt.Errorf("failed to replace document chunks: %w", err))
+	}
+	if err := s.saveChunks(doc.ID, chunks); err != nil {
+		return nil, 0, s.failDocument(&doc, err)
+	}
+
+	s.updateStatus(&doc, models.DocumentStatusEmbedding, "")
+	if err := s.retriever.DeleteByDocument(ctx, doc.ID); err != nil {
+		return nil, 0, s.failDocument(&doc, fmt.Errorf("failed to clean up old vectors: %w", err))
+	}
+
+	indexed, err := s.indexChunks(ctx, &doc, chunks, nil)
+	if err != nil {
+		return nil, 0, s.failDocument(&doc, err)
+	}
+	if err := s.markIndexed(&doc); err != nil {
+		return nil, 0, s.failDocument(&doc, err)
+	}
+
+	// 摘要分块随旧向量一起被删除，需要重新写入
+	s.indexSummary(ctx, doc.ID, doc.KnowledgeBaseID, doc.Summary)
+
+	s.logger.Info("Document re-chunked successfully",
+		zap.Uint("doc_id", doc.ID),
+		zap.Int("indexed_chunks", indexed),
+		zap.Int("failed_chunks", doc.FailedChunks))
+
+	return &doc, indexed, nil
+}
+
+// unmarkIndexed 将文档移出已索引状态并减少知识库文档数量
+func (s *Service) unmarkIndexed(doc *models.Document) error {
+	return db.GetDB().Transaction(func(tx *gorm.DB) error {
+		doc.Status = models.DocumentStatusChunking
+		if err := tx.Model(doc).Updates(map[string]interface{}{
+			"status":         doc.Status,
+			"status_message": "",
+			"updated_at":     time.Now(),
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update document status: %w", err)
+		}
+
+		if err := tx.Model(&models.KnowledgeBase{}).
+			Where("id = ?", doc.KnowledgeBaseID).
+			Update("doc_count", gorm.Expr("doc_count - 1")).Error; err != nil {
+			return fmt.Errorf("failed to update knowledge base doc count: %w", err)
+		}
+		return nil
+	})
+}
+
+// RechunkOutdatedDocuments 重新索引分块参数与当前配置不一致的文档，kbID 为 0 时处理全部知识库
+// progress 不为nil时报告每个文档的处理进度
+func (s *Service) RechunkOutdatedDocuments(ctx context.Context, kbID uint, progress jobs.Reporter) (*RetryResult, error) {
+	var docIDs []uint
+	if err := db.GetDB().Model(&models.Document{}).
+		Scopes(outdatedScope(CurrentChunkingParams(s.config.Snapshot()), kbID)).
+		Pluck("id", &docIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list outdated documents: %w", err)
+	}
+
+	result := &RetryResult{Total: len(docIDs)}
+	if progress != nil {
+		progress.SetTotal(len(docIDs))
+	}
+	for _, docID := range docIDs {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+
+		_, _, err := s.Rechunk(ctx, docID)
+		switch {
+		case err == nil:
+			result.Succeeded++
+		case errors.Is(err, ErrRetryInProgress), errors.Is(err, ErrNotIndexed), errors.Is(err, ErrNoStoredText):
+			result.Skipped++
+			err = nil
+		default:
+			result.Failed++
+			result.FailedIDs = append(result.FailedIDs, docID)
+		}
+		if progress != nil {
+			progress.Advance(fmt.Sprintf("document %d", docID), err)
+		}
+	}
+
+	s.logger.Info("Re-chunked outdated documents",
+		zap.Uint("kb_id", kbID),
+		zap.Int("total", result.Total),
+		zap.Int("succeeded", result.Succeeded),
+		zap.Int("failed", result.Failed),
+		zap.Int("skipped", result.Skipped))
+
+	return result, nil
+}
+
+// GetDocument 获取单个文档详情
+func (s *Service) GetDocument(docID uint) (*models.Document, error) {
+	var doc models.Document
+	if err := db.GetDB().Preload("KnowledgeBase").First(&doc, docID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("document not found")
+		}
+		return nil, err
+	}
+	return &doc, nil
 }
 
 // SearchDocuments 搜索文档
 func (s *Service) SearchDocuments(ctx context.Context, query string, kbID uint, topK int) ([]*schema.Document, error) {
+	return s.SearchDocumentsWithOptions(ctx, query, kbID, rag.RetrieveOptions{TopK: topK})
+}
+
+// SearchDocumentsWithOptions 按指定检索参数搜索文档
+func (s *Service) SearchDocumentsWithOptions(ctx context.Context, query string, kbID uint, opts rag.RetrieveOptions) ([]*schema.Document, error) {
+	cfg := s.config.Snapshot()
 	if s.retriever == nil {
-		return nil, fmt.Errorf("vector search is not available - Milvus connection failed")
+		return nil, fmt.Errorf("%w - Milvus connection failed", rag.ErrVectorStoreUnavailable)
 	}
-	
-	if topK <= 0 {
-		topK = s.config.TopK
+
+	opts.TopK = ResolveTopK(cfg, kbID, opts.TopK)
+	recencyWeight, recencyHalfLife := ResolveRecency(cfg, kbID, opts.RecencyWeight, opts.RecencyHalfLifeDays)
+	maxPerDoc := ResolveMaxChunksPerDoc(cfg, opts.MaxChunksPerDoc)
+
+	// 时间衰减和按文档限量在检索之后进行，检索（及其缓存）只与召回数量有关
+	retrieveOpts := opts
+	retrieveOpts.RecencyWeight = nil
+	retrieveOpts.RecencyHalfLifeDays = 0
+	retrieveOpts.MaxChunksPerDoc = nil
+	retrieveOpts.CandidateMultiplier = 0
+	if recencyWeight > 0 || maxPerDoc > 0 {
+		retrieveOpts.TopK = retrievalCandidates(opts.TopK, ResolveCandidateMultiplier(cfg, opts.CandidateMultiplier))
+	}
+
+	// 按文档属性过滤时只在符合条件的文档中检索
+	retrieveOpts.CreatorID = 0
+	retrieveOpts.CreatedAfter = nil
+	retrieveOpts.CreatedBefore = nil
+	retrieveOpts.Tags = nil
+	if hasDocumentFilter(opts) {
+		docIDs, err := filteredDocIDs(kbID, opts)
+		if err != nil {
+			return nil, err
+		}
+		if len(docIDs) == 0 {
+			return []*schema.Document{}, nil
+		}
+		retrieveOpts.DocIDs = docIDs
 	}
 
 	// 使用检索器搜索
-	docs, err := s.retriever.Retrieve(ctx, query, kbID)
+	docs, err := s.expandedRetrieve(ctx, query, kbID, retrieveOpts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve documents: %w", err)
 	}
 
-	// 限制返回数量
-	if len(docs) > topK {
-		docs = docs[:topK]
+	if recencyWeight > 0 {
+		docs = s.applyRecency(docs, recencyWeight, recencyHalfLife, time.Now())
+	}
+	docs = limitPerDocument(docs, maxPerDoc)
+
+	// 检索时多取了候选（时间衰减、按文档限量）或合并了扩展查询的结果时截断到请求的数量，其余情况向量库已按 topK 限制
+	if len(docs) > opts.TopK {
+		docs = docs[:opts.TopK]
+	}
+
+	return s.attachDocumentInfo(docs), nil
+}
+
+// VectorStoreAvailable 向量库是否可用：配置了检索器，且检索器能报告连接状态时已连接
+func (s *Service) VectorStoreAvailable() bool {
+	if s.retriever == nil {
+		return false
+	}
+	if conn, ok := s.retriever.(interface{ IsConnected() bool }); ok {
+		return conn.IsConnected()
+	}
+	return true
+}
+
+// ResolveTopK 返回实际使用的检索数量：请求指定的值优先，其次是知识库的 DefaultTopK，最后是全局配置
+func ResolveTopK(cfg *config.Config, kbID uint, topK int) int {
+	if topK > 0 {
+		return topK
+	}
+
+	var kb models.KnowledgeBase
+	if kbID > 0 && db.GetDB().Select("default_top_k").First(&kb, kbID).Error == nil && kb.DefaultTopK > 0 {
+		return kb.DefaultTopK
 	}
+	return cfg.TopK
+}
 
-	return docs, nil
+// chunkMetadata 按 CHUNK_METADATA_KEYS 过滤复制到分块的文档元数据，kb_id 和 doc_id 是向量库的字段，总会保留
+func chunkMetadata(cfg *config.Config, metadata map[string]interface{}) map[string]interface{} {
+	filtered := rag.FilterMetadata(metadata, cfg.ChunkMetadataKeys)
+	for _, key := range []string{"kb_id", "doc_id"} {
+		if v, ok := metadata[key]; ok {
+			filtered[key] = v
+		}
+	}
+	return filtered
 }
 
 // DeleteDocument 删除文档
@@ -242,7 +991,7 @@ func (s *Service) DeleteDocument(ctx context.Context, docID uint) error {
 	}
 
 	// 开始事务
-	return database.Transaction(func(tx *gorm.DB) error {
+	err := database.Transaction(func(tx *gorm.DB) error {
 		// 从向量数据库删除
 		if s.retriever != nil {
 			if err := s.retriever.DeleteByDocument(ctx, docID); err != nil {
@@ -254,11 +1003,20 @@ func (s *Service) DeleteDocument(ctx context.Context, docID uint) error {
 		}
 
 		// 删除数据库记录
+		if err := tx.Where("document_id = ?", docID).Delete(&models.DocumentChunk{}).Error; err != nil {
+			return fmt.Errorf("failed to delete document chunks: %w", err)
+		}
+		if err := tx.Where("document_id = ?", docID).Delete(&models.DocumentText{}).Error; err != nil {
+			return fmt.Errorf("failed to delete document text: %w", err)
+		}
 		if err := tx.Delete(&doc).Error; err != nil {
 			return fmt.Errorf("failed to delete document record: %w", err)
 		}
 
-		// 更新知识库文档数量
+		// 更新知识库文档数量（未完成索引的文档没有计入）
+		if !doc.Status.IsIndexed() {
+			return nil
+		}
 		if err := tx.Model(&models.KnowledgeBase{}).
 			Where("id = ?", doc.KnowledgeBaseID).
 			Update("doc_count", gorm.Expr("doc_count - 1")).Error; err != nil {
@@ -267,6 +1025,12 @@ func (s *Service) DeleteDocument(ctx context.Context, docID uint) error {
 
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	s.invalidateRetrievalCache(doc.KnowledgeBaseID)
+	return nil
 }
 
 // GetDocumentsByKB 获取知识库的文档列表
@@ -294,21 +1058,27 @@ func (s *Service) GetDocumentsByKB(kbID uint, page, pageSize int) ([]models.Docu
 	return docs, total, nil
 }
 
-// GetAllDocuments 获取所有文档（支持分页）
-func (s *Service) GetAllDocuments(page, pageSize int) ([]models.Document, int64, error) {
+// GetAllDocuments 获取所有文档（支持分页，不包括对话附件），kbScopes 限定文档所在的知识库，例如只返回当前用户可以访问的知识库
+func (s *Service) GetAllDocuments(page, pageSize int, kbScopes ...func(*gorm.DB) *gorm.DB) ([]models.Document, int64, error) {
 	database := db.GetDB()
 
 	var total int64
 	var docs []models.Document
 
+	// inKnowledgeBases 只查询 kbScopes 范围内的普通知识库中的文档，对话附件只在所属对话中使用
+	inKnowledgeBases := func(tx *gorm.DB) *gorm.DB {
+		kbIDs := database.Model(&models.KnowledgeBase{}).Select("id").Scopes(PersistentKnowledgeBases).Scopes(kbScopes...)
+		return tx.Where("knowledge_base_id IN (?)", kbIDs)
+	}
+
 	// 计算总数
-	if err := database.Model(&models.Document{}).Count(&total).Error; err != nil {
+	if err := database.Model(&models.Document{}).Scopes(ActiveDocuments, inKnowledgeBases).Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
 
 	// 分页查询，预加载知识库信息
 	offset := (page - 1) * pageSize
-	if err := database.Preload("KnowledgeBase").
+	if err := database.Preload("KnowledgeBase").Scopes(ActiveDocuments, inKnowledgeBases).
 		Offset(offset).
 		Limit(pageSize).
 		Order("created_at DESC").
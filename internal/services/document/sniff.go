@@ -0,0 +1,133 @@
+package document
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrUnknownFileType 文件没有可识别的扩展名，内容也无法判断类型
+var ErrUnknownFileType = errors.New("unable to determine file type")
+
+// supportedFileTypes 解析器支持的扩展名
+var supportedFileTypes = map[string]bool{
+	".txt": true, ".md": true, ".markdown": true,
+	".pdf": true, ".json": true, ".csv": true,
+	".html": true, ".htm": true, ".docx": true,
+}
+
+// sniffLength 内容检测读取的最大字节数
+const sniffLength = 8 * 1024
+
+// DetectFileType 返回用于解析的文件类型（带点的扩展名，如 .pdf）
+// 扩展名受支持时直接使用；缺失或不受支持时根据内容推断，无法推断时返回 ErrUnknownFileType
+func (p *DocumentParser) DetectFileType(filename string, content []byte) (string, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if supportedFileTypes[ext] {
+		return ext, nil
+	}
+
+	detected := sniffFileType(content)
+	if detected == "" {
+		if ext == "" {
+			return "", fmt.Errorf("%w: file has no extension and content is not a supported type", ErrUnknownFileType)
+		}
+		return "", fmt.Errorf("%w: extension %s is not supported and content is not a supported type", ErrUnknownFileType, ext)
+	}
+	return detected, nil
+}
+
+// sniffFileType 根据内容推断文件类型，无法识别时返回空字符串
+func sniffFileType(content []byte) string {
+	if bytes.HasPrefix(content, []byte("%PDF-")) {
+		return ".pdf"
+	}
+	if bytes.HasPrefix(content, []byte("PK\x03\x04")) && isDOCX(content) {
+		return ".docx"
+	}
+
+	head := content
+	if len(head) > sniffLength {
+		head = head[:sniffLength]
+		// 截断处可能切开多字节字符
+		for len(head) > 0 && !utf8.RuneStart(head[len(head)-1]) {
+			head = head[:len(head)-1]
+		}
+		if len(head) > 0 {
+			head = head[:len(head)-1]
+		}
+	}
+	// 二进制内容不按文本处理
+	if bytes.IndexByte(head, 0) >= 0 || !utf8.Valid(head) {
+		return ""
+	}
+
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(content, []byte("\xef\xbb\xbf")))
+	if len(trimmed) == 0 {
+		return ""
+	}
+
+	switch {
+	case (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed):
+		return ".json"
+	case looksLikeHTML(trimmed):
+		return ".html"
+	case looksLikeCSV(trimmed):
+		return ".csv"
+	default:
+		return ".txt"
+	}
+}
+
+// looksLikeHTML 内容以HTML文档或常见标签开头
+func looksLikeHTML(content []byte) bool {
+	if content[0] != '<' {
+		return false
+	}
+	head := content
+	if len(head) > sniffLength {
+		head = head[:sniffLength]
+	}
+	lower := strings.ToLower(string(head))
+	for _, marker := range []string{"<!doctype html", "<html", "<head", "<body"} {
+		if strings.Contains(lower, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// looksLikeCSV 前若干行都能按逗号解析为相同且不少于2的列数
+func looksLikeCSV(content []byte) bool {
+	head := content
+	if len(head) > sniffLength {
+		head = head[:bytes.LastIndexByte(head[:sniffLength], '\n')+1]
+	}
+
+	reader := csv.NewReader(bytes.NewReader(head))
+	fields := 0
+	rows := 0
+	for rows < 20 {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return false
+		}
+		if rows == 0 {
+			fields = len(record)
+		}
+		if len(record) < 2 || len(record) != fields {
+			return false
+		}
+		rows++
+	}
+	return rows >= 2
+}
@@ -0,0 +1,92 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/services/llm"
+
+	"github.com/cloudwego/eino-ext/components/model/openai"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"go.uber.org/zap"
+)
+
+// summaryTimeout 单个文档生成摘要的超时时间
+const summaryTimeout = 2 * time.Minute
+
+// summaryMaxTokens 摘要回复的最大token数
+const summaryMaxTokens = 512
+
+const summaryPrompt = `请为以下文档生成一段简洁的摘要（不超过200字），概括文档的主题、主要内容和关键结论。
+只输出摘要本身，不要添加标题或解释。
+
+文档内容：
+%s`
+
+// Summarizer 使用LLM为文档生成摘要
+type Summarizer struct {
+	chatModel *openai.ChatModel
+	logger    *zap.Logger
+	config    *config.Config
+}
+
+// NewSummarizer 创建摘要生成器，未启用摘要或未配置LLM时返回nil
+func NewSummarizer(cfg *config.Config, logger *zap.Logger) *Summarizer {
+	if !cfg.SummaryEnabled {
+		return nil
+	}
+	if cfg.OpenAIAPIKey == "" {
+		logger.Warn("Document summary is enabled but no LLM is configured, skipping")
+		return nil
+	}
+
+	chatModelConfig, err := llm.NewChatModelConfig(cfg, summaryTimeout)
+	if err != nil {
+		logger.Warn("Invalid OpenAI client config, skipping document summary", zap.Error(err))
+		return nil
+	}
+
+	chatModel, err := openai.NewChatModel(context.Background(), chatModelConfig)
+	if err != nil {
+		logger.Warn("Failed to initialize summary ChatModel", zap.Error(err))
+		return nil
+	}
+
+	return &Summarizer{
+		chatModel: chatModel,
+		logger:    logger,
+		config:    cfg,
+	}
+}
+
+// ShouldSummarize 判断文本是否足够长，值得生成摘要
+func (s *Summarizer) ShouldSummarize(text string) bool {
+	return len([]rune(strings.TrimSpace(text))) >= s.config.Snapshot().SummaryMinLength
+}
+
+// Summarize 生成文档摘要，过长的文本只取开头部分
+func (s *Summarizer) Summarize(ctx context.Context, text string) (string, error) {
+	runes := []rune(strings.TrimSpace(text))
+	if maxLen := s.config.Snapshot().SummaryMaxInputLength; maxLen > 0 && len(runes) > maxLen {
+		runes = runes[:maxLen]
+	}
+
+	messages := []*schema.Message{
+		schema.UserMessage(fmt.Sprintf(summaryPrompt, string(runes))),
+	}
+
+	resp, err := s.chatModel.Generate(ctx, messages, model.WithMaxTokens(summaryMaxTokens))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate summary: %w", err)
+	}
+
+	summary := strings.TrimSpace(resp.Content)
+	if summary == "" {
+		return "", fmt.Errorf("empty summary returned by model")
+	}
+	return summary, nil
+}
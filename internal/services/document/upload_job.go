@@ -0,0 +1,169 @@
+package document
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 异步上传
+//
+// 大文件的解析、切分、向量化和写入向量库可能需要几分钟，普通上传会一直占用请求。
+// 上传时带 async=true 时，请求只读取文件并检查知识库和文件类型，创建 UploadJob 记录后返回202，
+// 其余步骤在后台按普通上传的流程执行（见 UploadDocument）。任务记录保存在数据库中，
+// 客户端通过 GET /api/documents/jobs/:id 查询状态、完成百分比和分块数。
+//
+// 完成百分比按处理阶段估算：开始处理为 uploadJobProgress 中对应阶段的值，向量化期间按已完成的分块数
+// 从 embedding 阶段的值增长到 uploadJobEmbeddedProgress，结束时为100。
+// 任务超过 UPLOAD_JOB_TTL 没有更新后视为过期，不再返回，并在创建新任务时删除；
+// 服务重启时仍在处理的任务不会继续，同样在过期后删除。维护模式下任务保持 pending，维护结束后再开始处理。
+
+// ErrUploadJobNotFound 任务不存在或已过期
+var ErrUploadJobNotFound = errors.New("upload job not found")
+
+// uploadJobProgress 各处理阶段开始时任务的完成百分比
+var uploadJobProgress = map[models.DocumentStatus]float64{
+	models.DocumentStatusUploaded:  10,
+	models.DocumentStatusChunking:  20,
+	models.DocumentStatusEmbedding: 40,
+}
+
+// uploadJobEmbeddedProgress 全部分块向量化完成、尚未写入向量库时的完成百分比
+const uploadJobEmbeddedProgress = 95
+
+// CreateUploadJob 读取文件内容并检查知识库和文件类型，保存等待处理的任务，返回任务和文件内容
+// 重复文件、没有可提取的文本等需要解析后才能发现的问题在处理任务时记录到任务中
+func (s *Service) CreateUploadJob(ctx context.Context, filename string, content io.Reader, kbID, userID uint) (*models.UploadJob, []byte, error) {
+	cfg := s.config.Snapshot()
+	database := db.GetDB().WithContext(ctx)
+
+	var kb models.KnowledgeBase
+	if err := database.Select("id").First(&kb, kbID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, fmt.Errorf("knowledge base with id %d not found", kbID)
+		}
+		return nil, nil, fmt.Errorf("failed to check knowledge base: %w", err)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(content, cfg.MaxUploadSize))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	fileType, err := s.parser.DetectFileType(filename, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.parser.ValidateDetectedType(fileType, filename, cfg.AllowedFileTypes); err != nil {
+		return nil, nil, err
+	}
+
+	s.removeExpiredUploadJobs(ctx, cfg.UploadJobTTL)
+
+	job := &models.UploadJob{
+		ID:              uuid.New().String(),
+		UserID:          userID,
+		KnowledgeBaseID: kbID,
+		FileName:        filename,
+		Status:          models.UploadJobPending,
+	}
+	if err := database.Create(job).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to save upload job: %w", err)
+	}
+	return job, data, nil
+}
+
+// RunUploadJob 按普通上传的流程处理任务的文件，并把进度和结果记录到任务中
+func (s *Service) RunUploadJob(ctx context.Context, job *models.UploadJob, data []byte, opts UploadOptions) (*models.Document, int, error) {
+	if err := db.WaitForMaintenance(ctx); err != nil {
+		now := time.Now()
+		s.updateUploadJob(job, map[string]interface{}{
+			"status":      models.UploadJobFailed,
+			"error":       err.Error(),
+			"finished_at": &now,
+		})
+		return nil, 0, err
+	}
+	s.updateUploadJob(job, map[string]interface{}{"status": models.UploadJobProcessing})
+
+	opts.Progress = func(doc *models.Document, chunkCount int) {
+		s.updateUploadJob(job, map[string]interface{}{
+			"progress":    uploadJobProgress[doc.Status],
+			"chunk_count": chunkCount,
+		})
+	}
+	opts.EmbedProgress = func(processed, total int) {
+		start := uploadJobProgress[models.DocumentStatusEmbedding]
+		progress := start + (uploadJobEmbeddedProgress-start)*float64(processed)/float64(total)
+		s.updateUploadJob(job, map[string]interface{}{"progress": math.Round(progress*10) / 10})
+	}
+	doc, indexed, err := s.UploadDocument(ctx, job.FileName, bytes.NewReader(data), job.KnowledgeBaseID, job.UserID, opts)
+
+	now := time.Now()
+	if err != nil {
+		s.updateUploadJob(job, map[string]interface{}{
+			"status":      models.UploadJobFailed,
+			"error":       err.Error(),
+			"finished_at": &now,
+		})
+		return nil, 0, err
+	}
+	s.updateUploadJob(job, map[string]interface{}{
+		"status":      models.UploadJobCompleted,
+		"progress":    100,
+		"document_id": doc.ID,
+		"finished_at": &now,
+	})
+	return doc, indexed, nil
+}
+
+// GetUploadJob 获取任务，超过 UPLOAD_JOB_TTL 没有更新的任务视为不存在
+func (s *Service) GetUploadJob(ctx context.Context, id string) (*models.UploadJob, error) {
+	query := db.GetDB().WithContext(ctx).Where("id = ?", id)
+	if ttl := s.config.Snapshot().UploadJobTTL; ttl > 0 {
+		query = query.Where("updated_at >= ?", time.Now().Add(-ttl))
+	}
+
+	var job models.UploadJob
+	if err := query.First(&job).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUploadJobNotFound
+		}
+		return nil, fmt.Errorf("failed to get upload job: %w", err)
+	}
+	return &job, nil
+}
+
+// updateUploadJob 更新任务记录，失败时只记录日志，不影响文档处理
+func (s *Service) updateUploadJob(job *models.UploadJob, updates map[string]interface{}) {
+	if err := db.GetDB().Model(job).Updates(updates).Error; err != nil {
+		s.logger.Warn("Failed to update upload job",
+			zap.String("job_id", job.ID),
+			zap.Error(err))
+	}
+}
+
+// removeExpiredUploadJobs 删除超过 ttl 没有更新的任务
+func (s *Service) removeExpiredUploadJobs(ctx context.Context, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	result := db.GetDB().WithContext(ctx).Where("updated_at < ?", time.Now().Add(-ttl)).Delete(&models.UploadJob{})
+	if result.Error != nil {
+		s.logger.Warn("Failed to remove expired upload jobs", zap.Error(result.Error))
+		return
+	}
+	if result.RowsAffected > 0 {
+		s.logger.Info("Removed expired upload jobs", zap.Int64("count", result.RowsAffected))
+	}
+}
@@ -0,0 +1,56 @@
+package llm
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"eino-rag/internal/config"
+
+	"github.com/cloudwego/eino-ext/components/model/openai"
+)
+
+// NewChatModelConfig 按配置构建 OpenAI ChatModel 的配置
+// 基础地址不满足出站限制或代理地址无效时返回错误，调用方不应继续创建模型
+func NewChatModelConfig(cfg *config.Config, timeout time.Duration) (*openai.ChatModelConfig, error) {
+	if err := config.ValidateOpenAIBaseURL(cfg.OpenAIBaseURL, cfg.OpenAIAllowedHosts); err != nil {
+		return nil, err
+	}
+
+	chatModelConfig := &openai.ChatModelConfig{
+		APIKey:  cfg.OpenAIAPIKey,
+		Model:   cfg.OpenAIModel,
+		Timeout: timeout,
+		BaseURL: cfg.OpenAIBaseURL,
+	}
+
+	if cfg.OpenAIProxyURL != "" {
+		client, err := proxyClient(cfg.OpenAIProxyURL, timeout)
+		if err != nil {
+			return nil, err
+		}
+		// 设置 HTTPClient 后 Timeout 不再生效，超时由 client 控制
+		chatModelConfig.HTTPClient = client
+	}
+
+	return chatModelConfig, nil
+}
+
+// proxyClient 创建通过指定代理访问的 HTTP 客户端
+func proxyClient(rawURL string, timeout time.Duration) (*http.Client, error) {
+	if err := config.ValidateProxyURL(rawURL); err != nil {
+		return nil, err
+	}
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url: %w", err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(proxyURL)
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}, nil
+}
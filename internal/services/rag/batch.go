@@ -0,0 +1,105 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"go.uber.org/zap"
+)
+
+// 批量向量化
+//
+// 写入分块时一次把所有分块交给 Embedder.EmbedTexts：Ollama 按 EMBEDDING_CONCURRENCY 并发请求，
+// OpenAI 兼容接口每个请求发送一批文本，两者都按文本查找向量缓存。
+// 批量向量化失败且允许跳过失败的分块时，逐个分块重新向量化，只跳过失败的分块（已成功的分块在开启向量缓存时直接命中缓存）。
+// 需要报告进度时（AddOptions.Progress，如流式上传）每次只提交 embeddingProgressStep 个分块，每批完成后报告一次，
+// OpenAI 兼容接口因此需要更多请求；逐个重试时同样每完成 embeddingProgressStep 个分块报告一次。
+
+// embeddingProgressStep 记录和报告向量化进度的分块间隔
+const embeddingProgressStep = 10
+
+// generateEmbeddings 为分块生成向量，结果与 docs 顺序一致，SkipFailed 时失败的分块为nil
+func (r *MilvusRetriever) generateEmbeddings(ctx context.Context, docs []*schema.Document, opts AddOptions) ([][]float32, error) {
+	texts := make([]string, len(docs))
+	for i, doc := range docs {
+		texts[i] = EmbeddingText(doc)
+	}
+
+	start := time.Now()
+	embeddings, err := r.embedTexts(ctx, texts, opts.Progress)
+	if err == nil {
+		r.logger.Info("Generated embeddings",
+			zap.Int("chunks", len(docs)),
+			zap.Duration("duration", time.Since(start)))
+		return embeddings, nil
+	}
+	if ctx.Err() != nil || !opts.SkipFailed {
+		return nil, fmt.Errorf("failed to generate embeddings: %w", err)
+	}
+
+	r.logger.Warn("Batch embedding failed, retrying chunks one by one", zap.Error(err))
+	return r.generateEmbeddingsEach(ctx, docs, texts, opts.Progress)
+}
+
+// embedTexts 批量向量化，progress 不为nil时按 embeddingProgressStep 分批提交并在每批完成后报告
+func (r *MilvusRetriever) embedTexts(ctx context.Context, texts []string, progress func(processed, total int)) ([][]float32, error) {
+	if progress == nil {
+		return r.embedding.EmbedTexts(ctx, texts)
+	}
+
+	embeddings := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += embeddingProgressStep {
+		batch, err := r.embedding.EmbedTexts(ctx, texts[start:min(start+embeddingProgressStep, len(texts))])
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, batch...)
+		progress(len(embeddings), len(texts))
+	}
+	return embeddings, nil
+}
+
+// generateEmbeddingsEach 并发逐个生成分块的向量，失败的分块记录日志后为nil，只有 ctx 被取消时返回错误
+func (r *MilvusRetriever) generateEmbeddingsEach(ctx context.Context, docs []*schema.Document, texts []string, progress func(processed, total int)) ([][]float32, error) {
+	generated := make([][]float32, len(docs))
+	// 完成数和进度回调由锁保护，回调按完成顺序依次调用
+	var mu sync.Mutex
+	processed := 0
+	err := forEachConcurrent(ctx, len(docs), embeddingWorkers(r.config.Snapshot(), len(docs)), func(ctx context.Context, i int) error {
+		doc := docs[i]
+		defer func() {
+			mu.Lock()
+			defer mu.Unlock()
+			processed++
+			if processed%embeddingProgressStep != 0 && processed != len(docs) {
+				return
+			}
+			// 记录当前处理进度
+			r.logger.Info("Embedding generation progress",
+				zap.Int("processed", processed),
+				zap.Int("total", len(docs)),
+				zap.String("doc_id", doc.ID))
+			if progress != nil {
+				progress(processed, len(docs))
+			}
+		}()
+
+		embedding, err := r.embedding.EmbedText(ctx, texts[i])
+		if err != nil {
+			r.logger.Error("Failed to generate embedding",
+				zap.String("doc_id", doc.ID),
+				zap.Int("content_length", len(doc.Content)),
+				zap.Error(err))
+			return nil
+		}
+		generated[i] = embedding
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate embeddings: %w", err)
+	}
+	return generated, nil
+}
@@ -0,0 +1,112 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrCircuitOpen 熔断器打开期间直接拒绝请求
+var ErrCircuitOpen = errors.New("milvus is temporarily unavailable (circuit breaker open), please try again later")
+
+type breakerState int
+
+const (
+	breakerClosed   breakerState = iota // 正常放行
+	breakerOpen                         // 熔断中，快速失败
+	breakerHalfOpen                     // 试探中，只放行一个请求
+)
+
+// circuitBreaker 轻量熔断器：连续失败达到阈值后打开，超时后半开试探
+type circuitBreaker struct {
+	mu               sync.Mutex
+	state            breakerState
+	failures         int
+	failureThreshold int
+	openTimeout      time.Duration
+	openedAt         time.Time
+	onOpen           func()
+}
+
+func newCircuitBreaker(failureThreshold int, openTimeout time.Duration, onOpen func()) *circuitBreaker {
+	return &circuitBreaker{
+		state:            breakerClosed,
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+		onOpen:           onOpen,
+	}
+}
+
+// allow 判断是否放行本次请求，打开超时后转为半开并放行一个试探请求
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return ErrCircuitOpen
+		}
+		b.state = breakerHalfOpen
+		return nil
+	case breakerHalfOpen:
+		// 已有试探请求在进行中
+		return ErrCircuitOpen
+	default:
+		return nil
+	}
+}
+
+// isOpen 只读地检查熔断器是否处于打开状态，不改变状态
+func (b *circuitBreaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == breakerOpen && time.Since(b.openedAt) < b.openTimeout
+}
+
+// success 记录一次成功，关闭熔断器
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = breakerClosed
+	b.failures = 0
+}
+
+// failure 记录一次失败，达到阈值或试探失败时打开熔断器
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	b.failures++
+	shouldOpen := b.state == breakerHalfOpen ||
+		(b.failureThreshold > 0 && b.failures >= b.failureThreshold)
+	if shouldOpen {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+	b.mu.Unlock()
+
+	if shouldOpen && b.onOpen != nil {
+		b.onOpen()
+	}
+}
+
+// isTransientError 判断是否为可重试的临时性gRPC错误
+func isTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &grpcErr) {
+		switch grpcErr.GRPCStatus().Code() {
+		case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+			return true
+		}
+		return false
+	}
+
+	return errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,189 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/milvus-io/milvus-sdk-go/v2/client"
+	"github.com/milvus-io/milvus-sdk-go/v2/entity"
+	"go.uber.org/zap"
+)
+
+// 嵌入模型对比
+//
+// 更换嵌入模型前，管理员可以用同一个问题对比两个模型的检索效果。每个模型都需要自己的向量集合：
+// 集合中的向量必须由该模型生成，维度也必须与模型输出一致。对比时依次对每个模型：
+//   - 用该模型生成问题的向量（不读写向量缓存，不检查配置的 VECTOR_DIM）
+//   - 集合存在且维度一致时，在集合中检索 topK 个结果
+//
+// 未指定集合时，当前配置的模型（EMBEDDING_MODEL）使用 COLLECTION_NAME，其他模型只生成向量不检索。
+// 一侧失败不影响另一侧，错误记录在该侧的结果中。仅用于诊断，不会创建或修改集合。
+
+// CompareTarget 参与对比的一个嵌入模型
+type CompareTarget struct {
+	Model      string
+	Collection string // 为空时只有当前配置的模型使用默认集合
+}
+
+// CompareResult 一个模型的对比结果
+type CompareResult struct {
+	Model               string
+	Collection          string
+	Dimension           int // 模型生成的向量维度
+	CollectionExists    bool
+	CollectionDimension int // 集合中向量字段的维度，集合不存在时为0
+	EmbeddingTime       time.Duration
+	SearchTime          time.Duration
+	Results             []*schema.Document
+	Error               string
+}
+
+// CompareEmbeddings 用每个模型生成问题的向量，并在各自的集合中检索
+func (r *MilvusRetriever) CompareEmbeddings(ctx context.Context, query string, targets []CompareTarget, kbID uint, topK int) []*CompareResult {
+	cfg := r.config.Snapshot()
+	if topK <= 0 {
+		topK = r.topK
+	}
+
+	results := make([]*CompareResult, len(targets))
+	for i, target := range targets {
+		result := &CompareResult{Model: target.Model, Collection: target.Collection}
+		if result.Collection == "" && target.Model == cfg.EmbeddingModel {
+			result.Collection = cfg.CollectionName
+		}
+		if err := r.compareTarget(ctx, query, kbID, topK, result); err != nil {
+			r.logger.Warn("Embedding comparison failed",
+				zap.String("model", result.Model),
+				zap.String("collection", result.Collection),
+				zap.Error(err))
+			result.Error = err.Error()
+		}
+		results[i] = result
+	}
+	return results
+}
+
+// compareTarget 生成向量并检索，结果写入 result
+func (r *MilvusRetriever) compareTarget(ctx context.Context, query string, kbID uint, topK int, result *CompareResult) error {
+	start := time.Now()
+	embedder, ok := r.embedding.(ModelEmbedder)
+	if !ok {
+		return fmt.Errorf("embedding provider does not support choosing a model")
+	}
+	embedding, err := embedder.EmbedWithModel(ctx, result.Model, query)
+	result.EmbeddingTime = time.Since(start)
+	if err != nil {
+		return fmt.Errorf("failed to generate query embedding: %w", err)
+	}
+	result.Dimension = len(embedding)
+
+	if result.Collection == "" {
+		return nil
+	}
+
+	r.mu.RLock()
+	milvusClient := r.client
+	r.mu.RUnlock()
+	if !r.IsConnected() || milvusClient == nil {
+		return fmt.Errorf("milvus is not connected")
+	}
+
+	exists, err := milvusClient.HasCollection(ctx, result.Collection)
+	if err != nil {
+		return fmt.Errorf("failed to check collection existence: %w", err)
+	}
+	result.CollectionExists = exists
+	if !exists {
+		return nil
+	}
+
+	result.CollectionDimension, err = collectionDimension(ctx, milvusClient, result.Collection)
+	if err != nil {
+		return err
+	}
+	if result.CollectionDimension != result.Dimension {
+		return fmt.Errorf("%w: model %s produces %d-dimensional vectors but collection %s stores %d",
+			ErrEmbeddingDimensionMismatch, result.Model, result.Dimension, result.Collection, result.CollectionDimension)
+	}
+
+	start = time.Now()
+	result.Results, err = r.searchCollection(ctx, milvusClient, result.Collection, embedding, kbID, topK)
+	result.SearchTime = time.Since(start)
+	return err
+}
+
+// collectionDimension 读取集合中向量字段的维度
+func collectionDimension(ctx context.Context, c client.Client, collection string) (int, error) {
+	coll, err := c.DescribeCollection(ctx, collection)
+	if err != nil {
+		return 0, fmt.Errorf("failed to describe collection: %w", err)
+	}
+	if coll.Schema == nil {
+		return 0, fmt.Errorf("collection %s has no schema", collection)
+	}
+	for _, field := range coll.Schema.Fields {
+		if field.Name == "embedding" {
+			return strconv.Atoi(field.TypeParams[entity.TypeParamDim])
+		}
+	}
+	return 0, fmt.Errorf("collection %s has no embedding field", collection)
+}
+
+// searchCollection 在指定集合中检索，结果格式与 RetrieveWithOptions 相同
+func (r *MilvusRetriever) searchCollection(ctx context.Context, c client.Client, collection string, embedding []float32, kbID uint, topK int) ([]*schema.Document, error) {
+	cfg := r.config.Snapshot()
+	sp, err := buildSearchParam(cfg, 0, topK)
+	if err != nil {
+		return nil, err
+	}
+	metric, err := ParseMetricType(cfg.MetricType)
+	if err != nil {
+		return nil, err
+	}
+
+	searchCtx := ctx
+	if cfg.MilvusSearchTimeout > 0 {
+		var cancel context.CancelFunc
+		searchCtx, cancel = context.WithTimeout(ctx, cfg.MilvusSearchTimeout)
+		defer cancel()
+	}
+	searchResult, err := c.Search(
+		searchCtx,
+		collection,
+		nil,
+		searchExpr(kbID, nil),
+		[]string{"id", "content", "kb_id", "doc_id"},
+		[]entity.Vector{entity.FloatVector(embedding)},
+		"embedding",
+		metric,
+		topK,
+		sp,
+	)
+	if err != nil {
+		return nil, WrapTimeout(ctx, StageSearch, cfg.MilvusSearchTimeout, fmt.Errorf("failed to search: %w", err))
+	}
+
+	var documents []*schema.Document
+	for _, result := range searchResult {
+		for i := 0; i < result.ResultCount; i++ {
+			id, _ := result.Fields.GetColumn("id").Get(i)
+			content, _ := result.Fields.GetColumn("content").Get(i)
+			hitKBID, _ := result.Fields.GetColumn("kb_id").GetAsInt64(i)
+			hitDocID, _ := result.Fields.GetColumn("doc_id").GetAsInt64(i)
+			documents = append(documents, &schema.Document{
+				ID:      id.(string),
+				Content: content.(string),
+				MetaData: map[string]interface{}{
+					"score":    distanceToScore(metric, result.Scores[i]),
+					"distance": result.Scores[i],
+					"kb_id":    uint(hitKBID),
+					"doc_id":   uint(hitDocID),
+				},
+			})
+		}
+	}
+	return documents, nil
+}
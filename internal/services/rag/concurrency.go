@@ -0,0 +1,63 @@
+package rag
+
+import (
+	"context"
+	"sync"
+
+	"eino-rag/internal/config"
+)
+
+// 并发向量化
+//
+// 写入向量库（AddDocumentsWithOptions）和批量向量化（EmbedTexts）按 EMBEDDING_CONCURRENCY 同时发出多个向量化请求，
+// 结果仍按输入顺序排列。任一请求失败且不能跳过时取消其余请求、不再开始新请求，返回第一个错误。
+// 并发数应不大于 EMBEDDING_MAX_IDLE_CONNS_PER_HOST，否则多出的连接用完即关闭。
+
+// embeddingWorkers 返回处理 n 个文本时的并发数，至少为1，不超过文本数
+func embeddingWorkers(cfg *config.Config, n int) int {
+	return max(1, min(cfg.EmbeddingConcurrency, n))
+}
+
+// forEachConcurrent 用最多 workers 个 goroutine 对 0 到 n-1 依次执行 fn
+// fn 返回错误时取消传给其余调用的 context 并停止分发，返回第一个错误；ctx 被取消时返回 ctx 的错误
+func forEachConcurrent(ctx context.Context, n, workers int, fn func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	next := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if err := fn(ctx, i); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+	var ctxErr error
+	for i := 0; i < n && ctxErr == nil; i++ {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			ctxErr = ctx.Err()
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctxErr
+}
@@ -0,0 +1,209 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 嵌入维度与配置不一致
+//
+// 部分 Ollama 嵌入模型返回的维度与 VECTOR_DIM 不同，此时向量化会失败，所有上传都无法索引。
+// EMBEDDING_DIMENSION_MODE 决定如何处理：
+//   - strict（默认）：返回 ErrEmbeddingDimensionMismatch，错误中给出应配置的维度，同一维度只记录一次错误日志
+//   - auto：首次成功向量化时采用模型的实际维度，写入系统配置（vector_dim）并记录变更历史；
+//     Milvus 集合为空时按新维度重建，已有向量时拒绝切换并提示需要重建索引
+//
+// 管理员手动修改 vector_dim 时，集合为空同样会按新维度重建。
+
+// ErrEmbeddingDimensionMismatch 嵌入模型返回的向量维度与配置的 vector_dim 不一致
+var ErrEmbeddingDimensionMismatch = errors.New("embedding dimension mismatch")
+
+// DimensionCheck 采用新维度前的检查，返回错误时保持原配置
+type DimensionCheck func(ctx context.Context, dim int) error
+
+// SetDimensionCheck 设置自动采用新维度前的检查，由向量库确认现有数据不受影响
+func (s *EmbeddingService) SetDimensionCheck(check DimensionCheck) {
+	s.adoptMu.Lock()
+	defer s.adoptMu.Unlock()
+	s.dimensionCheck = check
+}
+
+// checkDimension 检查模型返回的维度，auto 模式下维度不一致时尝试采用新维度
+func (s *EmbeddingService) checkDimension(ctx context.Context, dim int) error {
+	cfg := s.config.Snapshot()
+	if dim == cfg.VectorDimension {
+		return nil
+	}
+
+	if cfg.EmbeddingDimensionMode != config.EmbeddingDimensionAuto {
+		err := fmt.Errorf("%w: model %q returns %d-dimensional vectors but vector_dim is %d; set VECTOR_DIM=%d (or vector_dim in system config), or set EMBEDDING_DIMENSION_MODE=auto to adopt it automatically",
+			ErrEmbeddingDimensionMismatch, s.embeddingModel, dim, cfg.VectorDimension, dim)
+		s.reportDimensionMismatch(dim, err)
+		return err
+	}
+	return s.adoptDimension(ctx, dim)
+}
+
+// adoptDimension 采用模型的实际维度，并发的向量化请求只有一个执行切换
+func (s *EmbeddingService) adoptDimension(ctx context.Context, dim int) error {
+	s.adoptMu.Lock()
+	defer s.adoptMu.Unlock()
+
+	previous := s.GetDimension()
+	if previous == dim {
+		return nil
+	}
+
+	if s.dimensionCheck != nil {
+		if err := s.dimensionCheck(ctx, dim); err != nil {
+			s.reportDimensionMismatch(dim, err)
+			return err
+		}
+	}
+
+	if err := saveVectorDimension(previous, dim); err != nil {
+		return fmt.Errorf("failed to save adopted embedding dimension: %w", err)
+	}
+
+	s.logger.Warn("Adopted embedding dimension reported by the model",
+		zap.String("model", s.embeddingModel),
+		zap.Int("previous", previous),
+		zap.Int("dimension", dim))
+	return nil
+}
+
+// reportDimensionMismatch 记录维度不一致的错误，同一维度只记录一次，避免每个分块都刷一条日志
+func (s *EmbeddingService) reportDimensionMismatch(dim int, err error) {
+	if s.reportedDimension.Swap(int64(dim)) == int64(dim) {
+		return
+	}
+	s.logger.Error("Embedding dimension does not match configuration",
+		zap.String("model", s.embeddingModel),
+		zap.Int("dimension", dim),
+		zap.Error(err))
+}
+
+// saveVectorDimension 把新维度写入系统配置并记录变更历史，然后更新内存中的配置
+func saveVectorDimension(previous, dim int) error {
+	value := strconv.Itoa(dim)
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&models.SystemConfig{Key: "vector_dim", Value: value}).Error; err != nil {
+			return err
+		}
+		// ActorID 为0表示系统自动变更
+		return tx.Create(&models.ConfigHistory{
+			ChangeID:  uuid.New().String(),
+			Key:       "vector_dim",
+			OldValue:  strconv.Itoa(previous),
+			NewValue:  value,
+			CreatedAt: time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	config.UpdateFromDB(map[string]string{"vector_dim": value})
+	return nil
+}
+
+// checkCollectionEmpty 采用新维度前确认集合中没有向量，已有向量的集合无法更换维度
+func (r *MilvusRetriever) checkCollectionEmpty(ctx context.Context, dim int) error {
+	cfg := r.config.Snapshot()
+	rows, err := r.collectionRowCount(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: model %q returns %d-dimensional vectors but vector_dim is %d, and the collection could not be checked: %v",
+			ErrEmbeddingDimensionMismatch, cfg.EmbeddingModel, dim, cfg.VectorDimension, err)
+	}
+	if rows > 0 {
+		return fmt.Errorf("%w: model %q returns %d-dimensional vectors but collection %q already holds %d vectors of dimension %d; drop the collection, set VECTOR_DIM=%d and re-index, or switch back to a %d-dimensional model",
+			ErrEmbeddingDimensionMismatch, cfg.EmbeddingModel, dim, r.collectionName, rows, cfg.VectorDimension, dim, cfg.VectorDimension)
+	}
+	return nil
+}
+
+// collectionRowCount 返回集合中的向量数，集合不存在时为0
+// 先刷新再统计，未落盘的写入也会计入；已删除但未压缩的向量同样计入，此时按非空处理
+func (r *MilvusRetriever) collectionRowCount(ctx context.Context) (int64, error) {
+	if !r.IsConnected() {
+		return 0, fmt.Errorf("milvus is not connected")
+	}
+
+	r.mu.RLock()
+	client := r.client
+	r.mu.RUnlock()
+
+	if client == nil {
+		return 0, fmt.Errorf("milvus client is not initialized")
+	}
+
+	exists, err := client.HasCollection(ctx, r.collectionName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check collection existence: %w", err)
+	}
+	if !exists {
+		return 0, nil
+	}
+
+	if err := client.Flush(ctx, r.collectionName, false); err != nil {
+		return 0, fmt.Errorf("failed to flush collection: %w", err)
+	}
+	stats, err := client.GetCollectionStatistics(ctx, r.collectionName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get collection statistics: %w", err)
+	}
+	rows, err := strconv.ParseInt(stats["row_count"], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid collection row count %q: %w", stats["row_count"], err)
+	}
+	return rows, nil
+}
+
+// recreateEmptyCollection vector_dim 变更后按新维度重建空集合，集合中已有向量时保留并记录错误
+func (r *MilvusRetriever) recreateEmptyCollection(dim int) {
+	ctx, cancel := context.WithTimeout(r.ctx, r.config.Snapshot().MilvusConnectTimeout)
+	defer cancel()
+
+	rows, err := r.collectionRowCount(ctx)
+	if err != nil {
+		r.logger.Warn("Vector dimension changed but the collection could not be checked",
+			zap.Int("dimension", dim),
+			zap.Error(err))
+		return
+	}
+	if rows > 0 {
+		r.logger.Error("Vector dimension changed but the collection is not empty, re-index required",
+			zap.String("collection", r.collectionName),
+			zap.Int64("rows", rows),
+			zap.Int("dimension", dim))
+		return
+	}
+
+	r.mu.RLock()
+	client := r.client
+	r.mu.RUnlock()
+
+	if err := client.DropCollection(ctx, r.collectionName); err != nil {
+		r.logger.Error("Failed to drop collection for new vector dimension", zap.Error(err))
+		return
+	}
+	r.resetPartitions()
+	if err := r.ensureCollectionWithClient(ctx, client); err != nil {
+		r.logger.Error("Failed to recreate collection for new vector dimension", zap.Error(err))
+		return
+	}
+	r.logger.Info("Recreated empty collection with new vector dimension",
+		zap.String("collection", r.collectionName),
+		zap.Int("dimension", dim))
+}
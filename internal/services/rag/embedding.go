@@ -6,7 +6,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"eino-rag/internal/config"
@@ -15,13 +18,26 @@ import (
 	"go.uber.org/zap"
 )
 
+// EmbeddingService 通过 Ollama 生成向量的 Embedder，可以在 Ollama 不可用时转移到 OpenAI 兼容接口
 type EmbeddingService struct {
 	ollamaURL      string
 	embeddingModel string
-	dimension      int
+	config         *config.Config
 	logger         *zap.Logger
 	httpClient     *http.Client
 	useCache       bool
+
+	// 维度不一致的处理，见 dimension.go
+	adoptMu           sync.Mutex
+	dimensionCheck    DimensionCheck
+	reportedDimension atomic.Int64
+
+	// 故障转移，见 failover.go
+	primaryBreaker   *circuitBreaker
+	failoverClient   *http.Client // 访问备用服务的客户端，为nil时不启用故障转移
+	failoverMu       sync.Mutex
+	failedOverAt     time.Time // 切换到备用服务的时间，使用主服务时为零值
+	lastPrimaryError string
 }
 
 func NewEmbeddingService(cfg *config.Config, logger *zap.Logger) *EmbeddingService {
@@ -35,38 +51,61 @@ func NewEmbeddingService(cfg *config.Config, logger *zap.Logger) *EmbeddingServi
 		zap.Duration("timeout", embeddingTimeout),
 		zap.String("model", cfg.EmbeddingModel))
 	
-	return &EmbeddingService{
+	service := &EmbeddingService{
 		ollamaURL:      cfg.OllamaBaseURL,
 		embeddingModel: cfg.EmbeddingModel,
-		dimension:      cfg.VectorDimension,
+		config:         cfg,
 		logger:         logger,
 		httpClient: &http.Client{
-			Timeout: embeddingTimeout,
+			Timeout:   embeddingTimeout,
+			Transport: newEmbeddingTransport(cfg),
 		},
 		useCache: cfg.EmbeddingCache,
 	}
+	service.initFailover(cfg, embeddingTimeout)
+	return service
+}
+
+// newEmbeddingTransport 创建复用连接的HTTP传输层
+// 默认传输层每个主机只保留2个空闲连接，并发向量化时多出的连接用完即关闭，导致频繁建连
+func newEmbeddingTransport(cfg *config.Config) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: cfg.EmbeddingKeepAlive,
+	}).DialContext
+	if cfg.EmbeddingMaxIdleConns > 0 {
+		transport.MaxIdleConns = cfg.EmbeddingMaxIdleConns
+	}
+	if cfg.EmbeddingMaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = cfg.EmbeddingMaxIdleConnsPerHost
+	}
+	if cfg.EmbeddingIdleConnTimeout > 0 {
+		transport.IdleConnTimeout = cfg.EmbeddingIdleConnTimeout
+	}
+	return transport
 }
 
 // EmbedText 将文本转换为向量
 func (s *EmbeddingService) EmbedText(ctx context.Context, text string) ([]float32, error) {
-	// 尝试从缓存获取
+	// 尝试从缓存获取，缓存按服务和模型区分
 	if s.useCache {
-		cached, err := db.GetCachedEmbedding(ctx, text)
+		cached, err := db.GetCachedEmbedding(ctx, s.activeSource().cacheTag(), text)
 		if err == nil && cached != nil {
 			s.logger.Debug("Using cached embedding", zap.Int("text_length", len(text)))
 			return cached, nil
 		}
 	}
 
-	// 调用Ollama API生成嵌入
-	embedding, err := s.generateEmbedding(ctx, text)
+	// 调用Ollama API生成嵌入，开启故障转移时可能由备用服务生成
+	embedding, source, err := s.generateEmbedding(ctx, text)
 	if err != nil {
 		return nil, err
 	}
 
 	// 缓存结果
 	if s.useCache {
-		if err := db.CacheEmbedding(ctx, text, embedding); err != nil {
+		if err := db.CacheEmbedding(ctx, source.cacheTag(), text, embedding); err != nil {
 			s.logger.Warn("Failed to cache embedding", zap.Error(err))
 		}
 	}
@@ -77,20 +116,26 @@ func (s *EmbeddingService) EmbedText(ctx context.Context, text string) ([]float3
 // EmbedTexts 批量转换文本为向量
 func (s *EmbeddingService) EmbedTexts(ctx context.Context, texts []string) ([][]float32, error) {
 	embeddings := make([][]float32, len(texts))
-	
-	for i, text := range texts {
-		embedding, err := s.EmbedText(ctx, text)
+
+	// 并发向量化，结果按输入顺序保存，任一文本失败时取消其余请求
+	workers := embeddingWorkers(s.config.Snapshot(), len(texts))
+	err := forEachConcurrent(ctx, len(texts), workers, func(ctx context.Context, i int) error {
+		embedding, err := s.EmbedText(ctx, texts[i])
 		if err != nil {
-			return nil, fmt.Errorf("failed to embed text %d: %w", i, err)
+			return fmt.Errorf("failed to embed text %d: %w", i, err)
 		}
 		embeddings[i] = embedding
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	
+
 	return embeddings, nil
 }
 
-// generateEmbedding 调用Ollama API生成嵌入向量
-func (s *EmbeddingService) generateEmbedding(ctx context.Context, text string) ([]float32, error) {
+// generateEmbedding 调用Ollama API生成嵌入向量，返回实际生成向量的服务
+func (s *EmbeddingService) generateEmbedding(ctx context.Context, text string) ([]float32, embeddingSource, error) {
 	// 记录开始时间
 	startTime := time.Now()
 	textLen := len(text)
@@ -99,8 +144,49 @@ func (s *EmbeddingService) generateEmbedding(ctx context.Context, text string) (
 		zap.Int("text_length", textLen),
 		zap.String("model", s.embeddingModel))
 	
+	embedding, source, err := s.embed(ctx, text)
+	if err != nil {
+		return nil, source, err
+	}
+
+	// 备用服务的维度已在请求时检查，不会自动采用新维度
+	if source.provider == EmbeddingProviderOllama {
+		if err := s.checkDimension(ctx, len(embedding)); err != nil {
+			return nil, source, err
+		}
+	}
+
+	// 记录耗时
+	duration := time.Since(startTime)
+	s.logger.Debug("Embedding generated successfully",
+		zap.Int("text_length", textLen),
+		zap.Duration("duration", duration),
+		zap.Int("vector_dimension", len(embedding)),
+		zap.String("provider", source.provider))
+
+	return embedding, source, nil
+}
+
+// EmbedWithModel 使用指定模型生成向量，不读写缓存，也不检查配置的向量维度，用于模型对比
+func (s *EmbeddingService) EmbedWithModel(ctx context.Context, model, text string) ([]float32, error) {
+	return s.requestEmbedding(ctx, model, text)
+}
+
+// requestEmbedding 请求Ollama API，返回模型生成的向量，5xx 和网络错误按 EMBEDDING_MAX_RETRIES 重试
+func (s *EmbeddingService) requestEmbedding(ctx context.Context, model, text string) ([]float32, error) {
+	var embedding []float32
+	err := withEmbeddingRetry(ctx, s.config.Snapshot(), s.logger, EmbeddingProviderOllama, func() error {
+		var err error
+		embedding, err = s.requestEmbeddingOnce(ctx, model, text)
+		return err
+	})
+	return embedding, err
+}
+
+// requestEmbeddingOnce 请求一次Ollama API
+func (s *EmbeddingService) requestEmbeddingOnce(ctx context.Context, model, text string) ([]float32, error) {
 	reqBody := map[string]interface{}{
-		"model":  s.embeddingModel,
+		"model":  model,
 		"prompt": text,
 	}
 
@@ -118,13 +204,17 @@ func (s *EmbeddingService) generateEmbedding(ctx context.Context, text string) (
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to call ollama API: %w", err)
+		return nil, WrapTimeout(ctx, StageEmbedding, s.httpClient.Timeout, fmt.Errorf("failed to call ollama API: %w", err))
 	}
-	defer resp.Body.Close()
+	defer func() {
+		// 读完剩余内容，连接才能放回连接池复用
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("ollama API error: %s, body: %s", resp.Status, body)
+		return nil, &EmbeddingAPIError{Provider: EmbeddingProviderOllama, Status: resp.Status, StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	var result struct {
@@ -132,24 +222,14 @@ func (s *EmbeddingService) generateEmbedding(ctx context.Context, text string) (
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	if len(result.Embedding) != s.dimension {
-		return nil, fmt.Errorf("unexpected embedding dimension: got %d, expected %d", len(result.Embedding), s.dimension)
+		// 客户端超时也会在读取响应体时触发
+		return nil, WrapTimeout(ctx, StageEmbedding, s.httpClient.Timeout, fmt.Errorf("failed to decode response: %w", err))
 	}
 
-	// 记录耗时
-	duration := time.Since(startTime)
-	s.logger.Debug("Embedding generated successfully",
-		zap.Int("text_length", textLen),
-		zap.Duration("duration", duration),
-		zap.Int("vector_dimension", len(result.Embedding)))
-
 	return result.Embedding, nil
 }
 
 // GetDimension 获取嵌入向量维度
 func (s *EmbeddingService) GetDimension() int {
-	return s.dimension
+	return s.config.Snapshot().VectorDimension
 }
\ No newline at end of file
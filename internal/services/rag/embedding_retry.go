@@ -0,0 +1,70 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"eino-rag/internal/config"
+
+	"go.uber.org/zap"
+)
+
+// 嵌入请求重试
+//
+// 负载较高时 Ollama 偶尔返回 5xx 或连接被重置，不重试的话整个文档的上传都会失败。
+// 嵌入服务返回 5xx 或请求遇到网络错误时，最多重试 EMBEDDING_MAX_RETRIES 次，第一次等待 EMBEDDING_RETRY_BACKOFF_MS，
+// 之后每次加倍；4xx（模型不存在、参数错误等）重试也不会成功，直接返回。请求超时不重试，以免一次向量化等待数倍的超时时间。
+// 等待期间调用方取消时立即返回。OpenAI 兼容的嵌入服务同样重试，备用服务不重试，由故障转移处理。
+
+// EmbeddingAPIError 嵌入服务返回了非200的状态码
+type EmbeddingAPIError struct {
+	Provider   string // ollama 或 openai
+	Status     string // 如 "500 Internal Server Error"
+	StatusCode int
+	Body       string // 响应内容，用于排查
+}
+
+func (e *EmbeddingAPIError) Error() string {
+	if e.Provider == EmbeddingProviderOllama {
+		return fmt.Sprintf("ollama API error: %s, body: %s", e.Status, e.Body)
+	}
+	return fmt.Sprintf("embeddings API error: %s, body: %s", e.Status, e.Body)
+}
+
+// isRetryableEmbeddingError 嵌入请求的错误是否值得重试：5xx 和超时以外的网络错误
+func isRetryableEmbeddingError(err error) bool {
+	var apiErr *EmbeddingAPIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && !IsTimeout(err)
+}
+
+// withEmbeddingRetry 执行嵌入请求，遇到可重试的错误时按指数退避重试
+func withEmbeddingRetry(ctx context.Context, cfg *config.Config, logger *zap.Logger, provider string, fn func() error) error {
+	backoff := cfg.EmbeddingRetryBackoff
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= cfg.EmbeddingMaxRetries || ctx.Err() != nil || !isRetryableEmbeddingError(err) {
+			return err
+		}
+
+		logger.Warn("Retrying embedding request",
+			zap.String("provider", provider),
+			zap.Int("attempt", attempt+1),
+			zap.Int("max_retries", cfg.EmbeddingMaxRetries),
+			zap.Duration("backoff", backoff),
+			zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,127 @@
+package rag
+
+import (
+	"context"
+
+	"github.com/cloudwego/eino/schema"
+	"go.uber.org/zap"
+)
+
+// EvalCase 检索评估用例：查询及期望命中的文档ID
+type EvalCase struct {
+	Query          string
+	ExpectedDocIDs []uint
+}
+
+// EvalQueryResult 单个查询的评估结果
+type EvalQueryResult struct {
+	Query           string  `json:"query"`
+	ExpectedDocIDs  []uint  `json:"expected_doc_ids"`
+	RetrievedDocIDs []uint  `json:"retrieved_doc_ids"`
+	Hits            int     `json:"hits"`
+	Recall          float64 `json:"recall"`
+	Precision       float64 `json:"precision"`
+	ReciprocalRank  float64 `json:"reciprocal_rank"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// EvalReport 评估汇总，指标为成功执行的查询的平均值
+type EvalReport struct {
+	TopK        int               `json:"top_k"`
+	QueryCount  int               `json:"query_count"`
+	FailedCount int               `json:"failed_count"`
+	Recall      float64           `json:"recall_at_k"`
+	Precision   float64           `json:"precision_at_k"`
+	MRR         float64           `json:"mrr"`
+	Results     []EvalQueryResult `json:"results"`
+}
+
+// Evaluate 对知识库逐条执行检索并计算 recall@k、precision@k 和 MRR
+// 检索结果按分块返回，计算指标前会按文档去重并保留首次出现的排名
+func (r *MilvusRetriever) Evaluate(ctx context.Context, kbID uint, cases []EvalCase, topK int) *EvalReport {
+	if topK <= 0 {
+		topK = r.topK
+	}
+
+	report := &EvalReport{
+		TopK:       topK,
+		QueryCount: len(cases),
+		Results:    make([]EvalQueryResult, 0, len(cases)),
+	}
+
+	succeeded := 0
+	for _, c := range cases {
+		result := EvalQueryResult{
+			Query:          c.Query,
+			ExpectedDocIDs: c.ExpectedDocIDs,
+		}
+
+		docs, err := r.RetrieveWithOptions(ctx, c.Query, kbID, RetrieveOptions{TopK: topK})
+		if err != nil {
+			r.logger.Warn("Evaluation query failed",
+				zap.String("query", c.Query),
+				zap.Error(err))
+			result.Error = err.Error()
+			report.FailedCount++
+			report.Results = append(report.Results, result)
+			continue
+		}
+
+		result.RetrievedDocIDs = rankedDocIDs(docs)
+		scoreEvalResult(&result)
+
+		report.Recall += result.Recall
+		report.Precision += result.Precision
+		report.MRR += result.ReciprocalRank
+		succeeded++
+		report.Results = append(report.Results, result)
+	}
+
+	if succeeded > 0 {
+		report.Recall /= float64(succeeded)
+		report.Precision /= float64(succeeded)
+		report.MRR /= float64(succeeded)
+	}
+
+	return report
+}
+
+// rankedDocIDs 按检索顺序提取去重后的文档ID
+func rankedDocIDs(docs []*schema.Document) []uint {
+	seen := make(map[uint]bool)
+	ids := make([]uint, 0, len(docs))
+	for _, doc := range docs {
+		docID, ok := doc.MetaData["doc_id"].(uint)
+		if !ok || seen[docID] {
+			continue
+		}
+		seen[docID] = true
+		ids = append(ids, docID)
+	}
+	return ids
+}
+
+// scoreEvalResult 根据期望文档和检索到的文档计算单条查询的指标
+func scoreEvalResult(result *EvalQueryResult) {
+	expected := make(map[uint]bool, len(result.ExpectedDocIDs))
+	for _, id := range result.ExpectedDocIDs {
+		expected[id] = true
+	}
+
+	for rank, id := range result.RetrievedDocIDs {
+		if !expected[id] {
+			continue
+		}
+		result.Hits++
+		if result.ReciprocalRank == 0 {
+			result.ReciprocalRank = 1 / float64(rank+1)
+		}
+	}
+
+	if len(expected) > 0 {
+		result.Recall = float64(result.Hits) / float64(len(expected))
+	}
+	if len(result.RetrievedDocIDs) > 0 {
+		result.Precision = float64(result.Hits) / float64(len(result.RetrievedDocIDs))
+	}
+}
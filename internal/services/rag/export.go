@@ -0,0 +1,64 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/milvus-io/milvus-sdk-go/v2/client"
+	"github.com/milvus-io/milvus-sdk-go/v2/entity"
+)
+
+// ChunkEmbeddings 按分块ID查询向量，返回集合中存在的分块的向量，ID不存在的分块不在结果中
+// 调用方负责分批，每次查询的ID数不应超过 inventoryQueryLimit
+func (r *MilvusRetriever) ChunkEmbeddings(ctx context.Context, chunkIDs []string) (map[string][]float32, error) {
+	embeddings := make(map[string][]float32, len(chunkIDs))
+	if len(chunkIDs) == 0 {
+		return embeddings, nil
+	}
+
+	c, exists, err := r.inventoryClient(ctx)
+	if err != nil || !exists {
+		return embeddings, err
+	}
+
+	expr := fmt.Sprintf("id in [%s]", quoteIDs(chunkIDs))
+	var result client.ResultSet
+	err = r.withRetry(ctx, "query", func() error {
+		var err error
+		result, err = c.Query(ctx, r.collectionName, nil, expr, []string{"id", "embedding"},
+			client.WithLimit(int64(len(chunkIDs))),
+			client.WithSearchQueryConsistencyLevel(entity.ClStrong))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chunk embeddings: %w", err)
+	}
+
+	idColumn, ok := result.GetColumn("id").(*entity.ColumnVarChar)
+	if !ok {
+		return embeddings, nil
+	}
+	vectorColumn, ok := result.GetColumn("embedding").(*entity.ColumnFloatVector)
+	if !ok {
+		return nil, fmt.Errorf("query result has no embedding column")
+	}
+	ids, vectors := idColumn.Data(), vectorColumn.Data()
+	if len(ids) != len(vectors) {
+		return nil, fmt.Errorf("query result has %d ids but %d embeddings", len(ids), len(vectors))
+	}
+	for i, id := range ids {
+		embeddings[id] = vectors[i]
+	}
+	return embeddings, nil
+}
+
+// quoteIDs 将字符串ID列表格式化为表达式中的列表内容
+func quoteIDs(ids []string) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Quote(id)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,313 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"eino-rag/internal/config"
+
+	"go.uber.org/zap"
+)
+
+// 嵌入服务故障转移
+//
+// 开启 EMBEDDING_FAILOVER 并配置了 OPENAI_API_KEY 时，主嵌入服务（Ollama）连续失败 EMBEDDING_FAILOVER_THRESHOLD 次后
+// 改用 OpenAI 兼容的 /embeddings 接口（模型为 EMBEDDING_FAILOVER_MODEL），上传和检索不会因为 Ollama 不可用而全部失败。
+// 切换期间每隔 EMBEDDING_FAILOVER_COOLDOWN 用一个请求试探主服务，成功后切回，切换和恢复都记录日志。
+//
+// 备用服务请求 vector_dim 维的向量（dimensions 参数），返回的维度不一致时向量化失败，不会自动采用新维度，
+// 以免写入与集合不兼容的向量。两个模型的向量空间不同，即使维度相同也只能近似匹配，因此：
+//   - 向量缓存按服务和模型区分，不会把一个模型的向量当作另一个模型的结果
+//   - 切换期间不使用检索缓存和语义缓存，避免缓存备用模型的检索结果或与主模型的问题向量比较
+//   - 主服务恢复后，切换期间上传的文档建议重建索引
+
+// 嵌入服务提供方
+const (
+	EmbeddingProviderOllama = "ollama"
+	EmbeddingProviderOpenAI = "openai"
+)
+
+// defaultOpenAIBaseURL 未配置 OPENAI_BASE_URL 时备用服务使用的地址
+const defaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+// EmbeddingStatus 嵌入服务的故障转移状态
+type EmbeddingStatus struct {
+	FailoverEnabled bool      // 故障转移已开启且备用服务可用
+	ActiveProvider  string    // 当前使用的服务
+	ActiveModel     string    // 当前使用的模型
+	PrimaryModel    string    // 主服务的模型
+	FailoverModel   string    // 备用服务的模型，未开启故障转移时为空
+	FailedOverAt    time.Time // 切换到备用服务的时间，未切换时为零值
+	LastError       string    // 主服务最近一次失败的原因，主服务恢复后清空
+}
+
+// embeddingSource 生成向量的服务和模型
+type embeddingSource struct {
+	provider string
+	model    string
+}
+
+// cacheTag 向量缓存中区分服务和模型的标识
+func (s embeddingSource) cacheTag() string {
+	return s.provider + ":" + s.model
+}
+
+// initFailover 创建主服务的熔断器和访问备用服务的客户端，代理地址无效时不启用故障转移
+func (s *EmbeddingService) initFailover(cfg *config.Config, timeout time.Duration) {
+	threshold, cooldown := cfg.EmbeddingFailoverThreshold, cfg.EmbeddingFailoverCooldown
+	if threshold <= 0 {
+		threshold = 3
+	}
+	if cooldown <= 0 {
+		cooldown = time.Minute
+	}
+	s.primaryBreaker = newCircuitBreaker(threshold, cooldown, nil)
+
+	failoverClient, err := newOpenAIHTTPClient(cfg, timeout)
+	if err != nil {
+		s.logger.Error("Invalid OpenAI proxy url, embedding failover disabled", zap.Error(err))
+		return
+	}
+	s.failoverClient = failoverClient
+}
+
+// newOpenAIHTTPClient 创建访问 OpenAI 兼容接口的客户端，配置了 OPENAI_PROXY_URL 时经代理访问
+func newOpenAIHTTPClient(cfg *config.Config, timeout time.Duration) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.OpenAIProxyURL != "" {
+		proxyURL, err := url.Parse(cfg.OpenAIProxyURL)
+		if err == nil {
+			err = config.ValidateProxyURL(cfg.OpenAIProxyURL)
+		}
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
+
+// failoverAvailable 是否开启了故障转移且备用服务可用
+func (s *EmbeddingService) failoverAvailable(cfg *config.Config) bool {
+	return cfg.EmbeddingFailover && cfg.OpenAIAPIKey != "" && cfg.EmbeddingFailoverModel != "" && s.failoverClient != nil
+}
+
+// EmbeddingFailingOver 是否正在使用备用服务
+func (s *EmbeddingService) EmbeddingFailingOver() bool {
+	if !s.failoverAvailable(s.config.Snapshot()) {
+		return false
+	}
+	s.failoverMu.Lock()
+	defer s.failoverMu.Unlock()
+	return !s.failedOverAt.IsZero()
+}
+
+// activeSource 返回当前应使用的服务，用于查找缓存
+func (s *EmbeddingService) activeSource() embeddingSource {
+	if s.EmbeddingFailingOver() {
+		return embeddingSource{provider: EmbeddingProviderOpenAI, model: s.config.Snapshot().EmbeddingFailoverModel}
+	}
+	return embeddingSource{provider: EmbeddingProviderOllama, model: s.embeddingModel}
+}
+
+// Status 返回嵌入服务的故障转移状态
+func (s *EmbeddingService) Status() EmbeddingStatus {
+	cfg := s.config.Snapshot()
+	active := s.activeSource()
+	status := EmbeddingStatus{
+		FailoverEnabled: s.failoverAvailable(cfg),
+		ActiveProvider:  active.provider,
+		ActiveModel:     active.model,
+		PrimaryModel:    s.embeddingModel,
+	}
+	if status.FailoverEnabled {
+		status.FailoverModel = cfg.EmbeddingFailoverModel
+	}
+
+	s.failoverMu.Lock()
+	defer s.failoverMu.Unlock()
+	status.LastError = s.lastPrimaryError
+	if status.FailoverEnabled {
+		status.FailedOverAt = s.failedOverAt
+	}
+	return status
+}
+
+// embed 生成向量，主服务连续失败达到阈值后改用备用服务，返回实际使用的服务
+func (s *EmbeddingService) embed(ctx context.Context, text string) ([]float32, embeddingSource, error) {
+	cfg := s.config.Snapshot()
+	primary := embeddingSource{provider: EmbeddingProviderOllama, model: s.embeddingModel}
+	if !s.failoverAvailable(cfg) {
+		embedding, err := s.requestEmbedding(ctx, s.embeddingModel, text)
+		return embedding, primary, err
+	}
+
+	// 熔断器打开期间直接使用备用服务，半开时只放行一个试探请求
+	if s.primaryBreaker.allow() == nil {
+		embedding, err := s.requestEmbedding(ctx, s.embeddingModel, text)
+		if err == nil {
+			s.recordPrimarySuccess()
+			return embedding, primary, nil
+		}
+		if ctx.Err() != nil {
+			// 调用方取消或超时，不代表主服务不可用
+			return nil, primary, err
+		}
+		if !s.recordPrimaryFailure(err) {
+			return nil, primary, err
+		}
+	}
+
+	secondary := embeddingSource{provider: EmbeddingProviderOpenAI, model: cfg.EmbeddingFailoverModel}
+	embedding, err := s.requestFailoverEmbedding(ctx, cfg, text)
+	if err != nil {
+		return nil, secondary, fmt.Errorf("embedding failover to %s failed: %w", secondary.model, err)
+	}
+	return embedding, secondary, nil
+}
+
+// recordPrimarySuccess 记录主服务请求成功，正在使用备用服务时切回主服务
+func (s *EmbeddingService) recordPrimarySuccess() {
+	s.primaryBreaker.success()
+
+	s.failoverMu.Lock()
+	failedOverAt := s.failedOverAt
+	s.failedOverAt = time.Time{}
+	s.lastPrimaryError = ""
+	s.failoverMu.Unlock()
+
+	if !failedOverAt.IsZero() {
+		s.logger.Warn("Primary embedding provider recovered, switched back from failover",
+			zap.String("model", s.embeddingModel),
+			zap.Duration("failover_duration", time.Since(failedOverAt)))
+	}
+}
+
+// recordPrimaryFailure 记录主服务请求失败，返回本次请求是否应改用备用服务
+func (s *EmbeddingService) recordPrimaryFailure(err error) bool {
+	s.primaryBreaker.failure()
+	open := s.primaryBreaker.isOpen()
+
+	s.failoverMu.Lock()
+	s.lastPrimaryError = err.Error()
+	switched := open && s.failedOverAt.IsZero()
+	if switched {
+		s.failedOverAt = time.Now()
+	}
+	s.failoverMu.Unlock()
+
+	if switched {
+		cfg := s.config.Snapshot()
+		s.logger.Warn("Primary embedding provider is failing, switched to failover provider",
+			zap.String("primary_model", s.embeddingModel),
+			zap.String("failover_model", cfg.EmbeddingFailoverModel),
+			zap.Duration("probe_interval", cfg.EmbeddingFailoverCooldown),
+			zap.Error(err))
+	}
+	return open
+}
+
+// requestFailoverEmbedding 请求 OpenAI 兼容的 /embeddings 接口，要求返回 vector_dim 维的向量
+func (s *EmbeddingService) requestFailoverEmbedding(ctx context.Context, cfg *config.Config, text string) ([]float32, error) {
+	embeddings, err := requestOpenAIEmbeddings(ctx, s.failoverClient, cfg, cfg.EmbeddingFailoverModel, []string{text})
+	if err != nil {
+		return nil, err
+	}
+
+	embedding := embeddings[0]
+	if len(embedding) != cfg.VectorDimension {
+		return nil, fmt.Errorf("%w: failover model %q returns %d-dimensional vectors but vector_dim is %d",
+			ErrEmbeddingDimensionMismatch, cfg.EmbeddingFailoverModel, len(embedding), cfg.VectorDimension)
+	}
+	return embedding, nil
+}
+
+// requestOpenAIEmbeddings 请求 OpenAI 兼容的 /embeddings 接口，按输入顺序返回向量，要求返回 vector_dim 维的向量（dimensions 参数）
+func requestOpenAIEmbeddings(ctx context.Context, httpClient *http.Client, cfg *config.Config, model string, inputs []string) ([][]float32, error) {
+	baseURL := cfg.OpenAIBaseURL
+	if baseURL == "" {
+		baseURL = defaultOpenAIBaseURL
+	}
+	if err := config.ValidateOpenAIBaseURL(baseURL, cfg.OpenAIAllowedHosts); err != nil {
+		return nil, err
+	}
+
+	// 单个输入按字符串发送，部分兼容接口不支持数组
+	var input interface{} = inputs
+	if len(inputs) == 1 {
+		input = inputs[0]
+	}
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"model":      model,
+		"input":      input,
+		"dimensions": cfg.VectorDimension,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimRight(baseURL, "/")+"/embeddings", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// 本地部署的兼容接口可能不需要认证
+	if cfg.OpenAIAPIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.OpenAIAPIKey)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, WrapTimeout(ctx, StageEmbedding, httpClient.Timeout, fmt.Errorf("failed to call embeddings API: %w", err))
+	}
+	defer func() {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &EmbeddingAPIError{Provider: EmbeddingProviderOpenAI, Status: resp.Status, StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var result struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, WrapTimeout(ctx, StageEmbedding, httpClient.Timeout, fmt.Errorf("failed to decode response: %w", err))
+	}
+	if len(result.Data) != len(inputs) {
+		return nil, fmt.Errorf("embeddings API returned %d embeddings for %d inputs", len(result.Data), len(inputs))
+	}
+
+	// 接口按 index 标明对应的输入，返回顺序不一定与输入一致
+	embeddings := make([][]float32, len(inputs))
+	for _, item := range result.Data {
+		if item.Index < 0 || item.Index >= len(inputs) || embeddings[item.Index] != nil {
+			return nil, fmt.Errorf("embeddings API returned an invalid index %d", item.Index)
+		}
+		embeddings[item.Index] = item.Embedding
+	}
+	return embeddings, nil
+}
+
+// EmbeddingFailingOver 是否正在使用备用嵌入服务，向量库不可用时为false
+func (r *MilvusRetriever) EmbeddingFailingOver() bool {
+	return r.embedding != nil && EmbeddingFailingOver(r.embedding)
+}
+
+// EmbeddingFailingOver 判断 v 是否正在使用备用嵌入服务，未实现 FailoverReporter 时为false
+func EmbeddingFailingOver(v interface{}) bool {
+	reporter, ok := v.(FailoverReporter)
+	return ok && reporter.EmbeddingFailingOver()
+}
@@ -0,0 +1,49 @@
+package rag
+
+import (
+	"sort"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// 结果融合
+//
+// 同一个问题的多组检索结果（如查询扩展的各个变体）按倒数排名融合（Reciprocal Rank Fusion）：
+// 分块在每组结果中按名次得到 1/(rrfK+名次) 分，累加后排序，在多组结果中都靠前的分块排在最前。
+// 名次只与组内的顺序有关，不同查询的相似度不必可比。融合后 metadata 中的 score 取各组中的最高分，
+// 之后的分数阈值、时间衰减等仍按相似度的含义处理。
+
+// rrfK 平滑常数，越大名次之间的差距越小，60 是常用的取值
+const rrfK = 60
+
+// FuseRankings 按倒数排名融合多组已按相关度排序的检索结果，按分块ID去重
+func FuseRankings(lists ...[]*schema.Document) []*schema.Document {
+	fused := make(map[string]float64)
+	first := make(map[string]*schema.Document)
+	var docs []*schema.Document
+	for _, list := range lists {
+		for rank, doc := range list {
+			fused[doc.ID] += 1.0 / float64(rrfK+rank+1)
+			existing, ok := first[doc.ID]
+			if !ok {
+				first[doc.ID] = doc
+				docs = append(docs, doc)
+				continue
+			}
+			if score := documentScore(doc); score > documentScore(existing) {
+				existing.MetaData["score"] = score
+			}
+		}
+	}
+
+	sort.SliceStable(docs, func(i, j int) bool {
+		return fused[docs[i].ID] > fused[docs[j].ID]
+	})
+	return docs
+}
+
+// documentScore 返回分块的相似度，没有时为0
+func documentScore(doc *schema.Document) float64 {
+	score, _ := doc.MetaData["score"].(float64)
+	return score
+}
@@ -0,0 +1,226 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"eino-rag/internal/config"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/milvus-io/milvus-sdk-go/v2/client"
+	"github.com/milvus-io/milvus-sdk-go/v2/entity"
+	"go.uber.org/zap"
+)
+
+// 混合检索
+//
+// 纯向量检索对产品编号、错误码等需要精确匹配的词不敏感。混合检索在向量检索之外，用 content like "%词%"
+// 在同一范围（知识库、分区和文档过滤条件）中查找包含查询词的分块，两路结果按分块ID去重后按
+//   score = alpha × 向量分数 + (1 - alpha) × 关键词分数
+// 重新排序，alpha 为 HYBRID_ALPHA。关键词分数是查询词在分块中出现的比例（不区分大小写，与内存检索器相同），
+// 只被关键词命中的分块没有向量分数，按0计算；最低分数阈值作用于混合后的分数。
+// 检索结果 metadata 中的 score 为混合分数，vector_score 和 keyword_score 为两路各自的分数。
+// Milvus 的 like 区分大小写，查询词按查询中的原样、小写和大写匹配；关键词查询失败时只返回向量检索的结果。
+
+// hybridKeywordCandidates 关键词查询相对 topK 多取的倍数，Milvus 返回的匹配分块没有顺序，多取后按关键词分数筛选
+const hybridKeywordCandidates = 10
+
+// hybridAlpha 返回混合检索中向量分数的权重，超出 [0,1] 时截断
+func hybridAlpha(cfg *config.Config) float64 {
+	return min(max(cfg.HybridAlpha, 0), 1)
+}
+
+// RetrieveHybrid 混合向量相似度和关键词匹配检索知识库中最相关的 topK 个分块，topK <= 0 时使用配置的 TOP_K
+func (r *MilvusRetriever) RetrieveHybrid(ctx context.Context, query string, kbID uint, topK int) ([]*schema.Document, error) {
+	return r.RetrieveHybridWithOptions(ctx, query, kbID, RetrieveOptions{TopK: topK})
+}
+
+// RetrieveHybridWithOptions 按指定参数混合检索，opts.Hybrid 被忽略
+func (r *MilvusRetriever) RetrieveHybridWithOptions(ctx context.Context, query string, kbID uint, opts RetrieveOptions) ([]*schema.Document, error) {
+	topK := opts.TopK
+	if topK <= 0 {
+		topK = r.topK
+	}
+
+	// 阈值在混合分数上生效，向量检索不过滤
+	vectorOpts := opts
+	vectorOpts.TopK = topK
+	vectorOpts.ScoreThreshold = 0
+	vectorOpts.Hybrid = false
+	vectorDocs, err := r.vectorSearch(ctx, query, kbID, vectorOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	terms := tokenize(query)
+	keywordDocs, err := r.keywordSearch(ctx, query, terms, kbID, opts.DocIDs, topK*hybridKeywordCandidates)
+	if err != nil {
+		r.logger.Warn("Keyword search failed, using vector search results only",
+			zap.Uint("kb_id", kbID),
+			zap.Error(err))
+		keywordDocs = nil
+	}
+
+	return mergeHybrid(vectorDocs, keywordDocs, terms, hybridAlpha(r.config.Snapshot()), opts.ScoreThreshold, topK), nil
+}
+
+// keywordSearch 查询内容包含任一查询词的分块，最多 limit 个
+func (r *MilvusRetriever) keywordSearch(ctx context.Context, query string, terms []string, kbID uint, docIDs []uint, limit int) ([]*schema.Document, error) {
+	match := keywordExpr(query, terms)
+	if match == "" {
+		return nil, nil
+	}
+	expr := match
+	if filter := searchExpr(kbID, docIDs); filter != "" {
+		expr = fmt.Sprintf("%s && (%s)", filter, match)
+	}
+
+	r.mu.RLock()
+	c := r.client
+	r.mu.RUnlock()
+	if c == nil {
+		return nil, fmt.Errorf("%w: milvus client is not initialized", ErrVectorStoreUnavailable)
+	}
+
+	cfg := r.config.Snapshot()
+	partitions := r.searchPartitions(ctx, c, kbID)
+	var result client.ResultSet
+	err := r.withRetry(ctx, "query", func() error {
+		queryCtx := ctx
+		if cfg.MilvusSearchTimeout > 0 {
+			var cancel context.CancelFunc
+			queryCtx, cancel = context.WithTimeout(ctx, cfg.MilvusSearchTimeout)
+			defer cancel()
+		}
+
+		var err error
+		result, err = c.Query(queryCtx, r.collectionName, partitions, expr,
+			[]string{"id", "content", "kb_id", "doc_id"},
+			client.WithLimit(int64(min(limit, inventoryQueryLimit))))
+		return err
+	})
+	if err != nil {
+		r.forgetPartition(kbID)
+		return nil, WrapTimeout(ctx, StageSearch, cfg.MilvusSearchTimeout, fmt.Errorf("failed to query keywords: %w", err))
+	}
+
+	idColumn, ok := result.GetColumn("id").(*entity.ColumnVarChar)
+	if !ok {
+		return nil, nil
+	}
+	contentColumn, okContent := result.GetColumn("content").(*entity.ColumnVarChar)
+	kbColumn, okKB := result.GetColumn("kb_id").(*entity.ColumnInt64)
+	docColumn, okDoc := result.GetColumn("doc_id").(*entity.ColumnInt64)
+	if !okContent || !okKB || !okDoc {
+		return nil, fmt.Errorf("keyword query result is missing fields")
+	}
+
+	ids, contents, kbIDs, hitDocIDs := idColumn.Data(), contentColumn.Data(), kbColumn.Data(), docColumn.Data()
+	documents := make([]*schema.Document, 0, len(ids))
+	for i, id := range ids {
+		if i >= len(contents) || i >= len(kbIDs) || i >= len(hitDocIDs) {
+			break
+		}
+		doc := &schema.Document{
+			ID:      id,
+			Content: contents[i],
+			MetaData: map[string]interface{}{
+				"kb_id":  uint(kbIDs[i]),
+				"doc_id": uint(hitDocIDs[i]),
+			},
+		}
+		if IsSummaryChunk(doc.ID) {
+			doc.MetaData["type"] = ChunkTypeSummary
+		}
+		documents = append(documents, doc)
+	}
+	return documents, nil
+}
+
+// keywordExpr 构建匹配任一查询词的表达式，查询词只包含字母和数字，不需要转义
+func keywordExpr(query string, terms []string) string {
+	lowerQuery := strings.ToLower(query)
+	seen := make(map[string]bool)
+	var conditions []string
+	for _, term := range terms {
+		variants := []string{term, strings.ToUpper(term)}
+		// 小写后长度不变时可以按位置取出查询中的原样写法
+		if len(lowerQuery) == len(query) {
+			if i := strings.Index(lowerQuery, term); i >= 0 {
+				variants = append(variants, query[i:i+len(term)])
+			}
+		}
+		for _, variant := range variants {
+			if !seen[variant] {
+				seen[variant] = true
+				conditions = append(conditions, fmt.Sprintf(`content like "%%%s%%"`, variant))
+			}
+		}
+	}
+	return strings.Join(conditions, " || ")
+}
+
+// keywordScore 返回查询词在文本中出现的比例，不区分大小写
+func keywordScore(text string, terms []string) float64 {
+	if len(terms) == 0 {
+		return 0
+	}
+	text = strings.ToLower(text)
+	matched := 0
+	for _, term := range terms {
+		if strings.Contains(text, term) {
+			matched++
+		}
+	}
+	return float64(matched) / float64(len(terms))
+}
+
+// mergeHybrid 按分块ID合并向量和关键词检索结果，按混合分数排序并截断到 topK
+func mergeHybrid(vectorDocs, keywordDocs []*schema.Document, terms []string, alpha float64, threshold float32, topK int) []*schema.Document {
+	seen := make(map[string]bool, len(vectorDocs)+len(keywordDocs))
+	candidates := make([]*schema.Document, 0, len(vectorDocs)+len(keywordDocs))
+	for _, doc := range vectorDocs {
+		if seen[doc.ID] {
+			continue
+		}
+		seen[doc.ID] = true
+		score, _ := doc.MetaData["score"].(float64)
+		doc.MetaData["vector_score"] = score
+		candidates = append(candidates, doc)
+	}
+	for _, doc := range keywordDocs {
+		if seen[doc.ID] {
+			continue
+		}
+		seen[doc.ID] = true
+		doc.MetaData["vector_score"] = 0.0
+		candidates = append(candidates, doc)
+	}
+
+	merged := make([]*schema.Document, 0, len(candidates))
+	for _, doc := range candidates {
+		vectorScore := doc.MetaData["vector_score"].(float64)
+		keyword := keywordScore(doc.Content, terms)
+		// 关键词查询的结果都应包含查询词，内容中找不到时（如只匹配了大小写变体以外的写法）不保留
+		if vectorScore == 0 && keyword == 0 {
+			continue
+		}
+		score := alpha*vectorScore + (1-alpha)*keyword
+		if threshold > 0 && score < float64(threshold) {
+			continue
+		}
+		doc.MetaData["keyword_score"] = keyword
+		doc.MetaData["score"] = score
+		merged = append(merged, doc)
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].MetaData["score"].(float64) > merged[j].MetaData["score"].(float64)
+	})
+	if topK > 0 && len(merged) > topK {
+		merged = merged[:topK]
+	}
+	return merged
+}
@@ -0,0 +1,160 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/milvus-io/milvus-sdk-go/v2/client"
+	"github.com/milvus-io/milvus-sdk-go/v2/entity"
+)
+
+// 向量盘点
+//
+// 一致性检查需要知道哪些文档在 Milvus 中有向量。Milvus 2.3 的 Query 不支持分组，
+// 单次最多返回 inventoryQueryLimit 行，因此按文档ID分批查询 doc_id 字段：
+//   - 确认文档是否有向量：每批查询 doc_id in [...]，结果被截断时对批内未出现的文档逐个查询一行
+//   - 查找孤立向量：查询 doc_id not in [已知文档]，结果被截断时把已找到的文档加入排除列表继续查询
+//
+// 查询使用强一致性，刚写入的向量也能查到。
+
+// inventoryQueryLimit Milvus 单次查询最多返回的行数
+const inventoryQueryLimit = 16384
+
+// inventoryBatchSize 每次查询包含的文档ID数
+const inventoryBatchSize = 256
+
+// DocumentsWithVectors 返回 docIDs 中在集合里至少有一个向量的文档ID
+func (r *MilvusRetriever) DocumentsWithVectors(ctx context.Context, docIDs []uint) ([]uint, error) {
+	c, exists, err := r.inventoryClient(ctx)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	found := make(map[uint]bool, len(docIDs))
+	for start := 0; start < len(docIDs); start += inventoryBatchSize {
+		batch := docIDs[start:min(start+inventoryBatchSize, len(docIDs))]
+		ids, truncated, err := r.queryDocIDs(ctx, c, fmt.Sprintf("doc_id in [%s]", formatIDs(batch)), inventoryQueryLimit)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			found[id] = true
+		}
+		if !truncated {
+			continue
+		}
+
+		// 批内个别文档的向量占满了结果，其余文档需要单独确认
+		for _, docID := range batch {
+			if found[docID] {
+				continue
+			}
+			ids, _, err := r.queryDocIDs(ctx, c, fmt.Sprintf("doc_id == %d", docID), 1)
+			if err != nil {
+				return nil, err
+			}
+			if len(ids) > 0 {
+				found[docID] = true
+			}
+		}
+	}
+
+	result := make([]uint, 0, len(found))
+	for _, docID := range docIDs {
+		if found[docID] {
+			result = append(result, docID)
+		}
+	}
+	return result, nil
+}
+
+// OrphanDocuments 返回集合中有向量、但不在 known 中的文档ID
+func (r *MilvusRetriever) OrphanDocuments(ctx context.Context, known []uint) ([]uint, error) {
+	c, exists, err := r.inventoryClient(ctx)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	excluded := append([]uint(nil), known...)
+	var orphans []uint
+	for {
+		expr := "doc_id >= 0"
+		if len(excluded) > 0 {
+			expr = fmt.Sprintf("doc_id not in [%s]", formatIDs(excluded))
+		}
+		ids, truncated, err := r.queryDocIDs(ctx, c, expr, inventoryQueryLimit)
+		if err != nil {
+			return nil, err
+		}
+		orphans = append(orphans, ids...)
+		if !truncated || len(ids) == 0 {
+			return orphans, nil
+		}
+		excluded = append(excluded, ids...)
+	}
+}
+
+// inventoryClient 返回当前的Milvus客户端，以及集合是否存在
+func (r *MilvusRetriever) inventoryClient(ctx context.Context) (client.Client, bool, error) {
+	if !r.IsConnected() {
+		return nil, false, fmt.Errorf("milvus is not connected")
+	}
+
+	r.mu.RLock()
+	c := r.client
+	r.mu.RUnlock()
+
+	if c == nil {
+		return nil, false, fmt.Errorf("milvus client is not initialized")
+	}
+
+	exists, err := c.HasCollection(ctx, r.collectionName)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to check collection existence: %w", err)
+	}
+	return c, exists, nil
+}
+
+// queryDocIDs 查询满足表达式的向量，返回去重后的文档ID，以及结果是否达到 limit 可能被截断
+func (r *MilvusRetriever) queryDocIDs(ctx context.Context, c client.Client, expr string, limit int64) ([]uint, bool, error) {
+	var result client.ResultSet
+	err := r.withRetry(ctx, "query", func() error {
+		var err error
+		result, err = c.Query(ctx, r.collectionName, nil, expr, []string{"doc_id"},
+			client.WithLimit(limit),
+			client.WithSearchQueryConsistencyLevel(entity.ClStrong))
+		return err
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query document ids: %w", err)
+	}
+
+	column := result.GetColumn("doc_id")
+	if column == nil {
+		return nil, false, nil
+	}
+	seen := make(map[uint]bool)
+	var ids []uint
+	for i := 0; i < column.Len(); i++ {
+		value, err := column.GetAsInt64(i)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid doc_id in query result: %w", err)
+		}
+		if id := uint(value); !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, int64(column.Len()) >= limit, nil
+}
+
+// formatIDs 将ID列表格式化为表达式中的列表内容
+func formatIDs(ids []uint) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,236 @@
+package rag
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// memoryEntry 内存检索器中保存的分块
+type memoryEntry struct {
+	id         string
+	content    string
+	searchText string // 参与匹配的文本，即分块的 EmbeddingText
+	kbID       uint
+	docID      uint
+}
+
+// MemoryRetriever 基于关键词匹配的内存检索器，不依赖 Milvus 和嵌入服务
+// 分数为查询词在分块中出现的比例，只用于测试和本地开发，不反映语义相似度
+type MemoryRetriever struct {
+	mu      sync.RWMutex
+	entries []memoryEntry
+	topK    int
+}
+
+// NewMemoryRetriever 创建内存检索器，topK 为未指定返回数量时的默认值
+func NewMemoryRetriever(topK int) *MemoryRetriever {
+	return &MemoryRetriever{topK: topK}
+}
+
+// AddDocuments 添加分块
+func (m *MemoryRetriever) AddDocuments(ctx context.Context, docs []*schema.Document, kbID, docID uint) error {
+	_, err := m.AddDocumentsWithOptions(ctx, docs, kbID, docID, AddOptions{})
+	return err
+}
+
+// AddDocumentsWithOptions 添加分块，同ID的分块会被覆盖
+func (m *MemoryRetriever) AddDocumentsWithOptions(ctx context.Context, docs []*schema.Document, kbID, docID uint, opts AddOptions) (*AddResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, doc := range docs {
+		m.removeLocked(func(e memoryEntry) bool { return e.id == doc.ID })
+		m.entries = append(m.entries, memoryEntry{
+			id:         doc.ID,
+			content:    doc.Content,
+			searchText: EmbeddingText(doc),
+			kbID:       kbID,
+			docID:      docID,
+		})
+	}
+	// 不生成向量，全部分块一次完成
+	if opts.Progress != nil && len(docs) > 0 {
+		opts.Progress(len(docs), len(docs))
+	}
+	return &AddResult{Indexed: len(docs)}, nil
+}
+
+// RetrieveWithOptions 按查询词命中比例检索，kbID 为0时检索所有知识库
+func (m *MemoryRetriever) RetrieveWithOptions(ctx context.Context, query string, kbID uint, opts RetrieveOptions) ([]*schema.Document, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	topK := opts.TopK
+	if topK <= 0 {
+		topK = m.topK
+	}
+
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var documents []*schema.Document
+	for _, entry := range m.entries {
+		if kbID > 0 && entry.kbID != kbID {
+			continue
+		}
+		if len(opts.DocIDs) > 0 && !slices.Contains(opts.DocIDs, entry.docID) {
+			continue
+		}
+		score := keywordScore(entry.searchText, terms)
+		if score == 0 {
+			continue
+		}
+		if opts.ScoreThreshold > 0 && score < float64(opts.ScoreThreshold) {
+			continue
+		}
+
+		doc := &schema.Document{
+			ID:      entry.id,
+			Content: entry.content,
+			MetaData: map[string]interface{}{
+				"score":  score,
+				"kb_id":  entry.kbID,
+				"doc_id": entry.docID,
+			},
+		}
+		if IsSummaryChunk(doc.ID) {
+			doc.MetaData["type"] = ChunkTypeSummary
+		}
+		documents = append(documents, doc)
+	}
+
+	sort.SliceStable(documents, func(i, j int) bool {
+		return documents[i].MetaData["score"].(float64) > documents[j].MetaData["score"].(float64)
+	})
+	if topK > 0 && len(documents) > topK {
+		documents = documents[:topK]
+	}
+	return documents, nil
+}
+
+// DeleteByKnowledgeBase 删除指定知识库的所有分块
+func (m *MemoryRetriever) DeleteByKnowledgeBase(ctx context.Context, kbID uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.removeLocked(func(e memoryEntry) bool { return e.kbID == kbID })
+	return nil
+}
+
+// DeleteByDocument 删除指定文档的所有分块
+func (m *MemoryRetriever) DeleteByDocument(ctx context.Context, docID uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.removeLocked(func(e memoryEntry) bool { return e.docID == docID })
+	return nil
+}
+
+// DocumentsWithVectors 返回 docIDs 中至少有一个分块的文档ID
+func (m *MemoryRetriever) DocumentsWithVectors(ctx context.Context, docIDs []uint) ([]uint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	present := make(map[uint]bool, len(m.entries))
+	for _, entry := range m.entries {
+		present[entry.docID] = true
+	}
+	found := make([]uint, 0, len(docIDs))
+	for _, docID := range docIDs {
+		if present[docID] {
+			found = append(found, docID)
+		}
+	}
+	return found, nil
+}
+
+// OrphanDocuments 返回存在分块、但不在 known 中的文档ID
+func (m *MemoryRetriever) OrphanDocuments(ctx context.Context, known []uint) ([]uint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	seen := make(map[uint]bool, len(known))
+	for _, docID := range known {
+		seen[docID] = true
+	}
+	var orphans []uint
+	for _, entry := range m.entries {
+		if !seen[entry.docID] {
+			seen[entry.docID] = true
+			orphans = append(orphans, entry.docID)
+		}
+	}
+	return orphans, nil
+}
+
+// ChunkEmbeddings 内存检索器不计算向量，存在的分块返回空向量
+func (m *MemoryRetriever) ChunkEmbeddings(ctx context.Context, chunkIDs []string) (map[string][]float32, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	embeddings := make(map[string][]float32, len(chunkIDs))
+	for _, entry := range m.entries {
+		if slices.Contains(chunkIDs, entry.id) {
+			embeddings[entry.id] = []float32{}
+		}
+	}
+	return embeddings, nil
+}
+
+// Count 返回当前保存的分块数量
+func (m *MemoryRetriever) Count() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.entries)
+}
+
+func (m *MemoryRetriever) removeLocked(match func(memoryEntry) bool) {
+	kept := m.entries[:0]
+	for _, entry := range m.entries {
+		if !match(entry) {
+			kept = append(kept, entry)
+		}
+	}
+	m.entries = kept
+}
+
+// tokenize 将查询拆分为小写词，中文按单字拆分
+func tokenize(text string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	add := func(term string) {
+		if term != "" && !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+
+	var word strings.Builder
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			add(word.String())
+			word.Reset()
+			add(string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word.WriteRune(r)
+		default:
+			add(word.String())
+			word.Reset()
+		}
+	}
+	add(word.String())
+	return terms
+}
@@ -0,0 +1,27 @@
+package rag
+
+// 分块元数据的可见范围
+//
+// 分块和检索结果的元数据来自多个环节，按可见范围分为三类：
+//   - 写入分块：上传和重新切分时，文档元数据（filename、file_type、kb_id、doc_id、user_id、page_start、page_end）
+//     只有 CHUNK_METADATA_KEYS 中的键会复制到每个分块。Milvus 集合只把 kb_id 和 doc_id 存为字段，
+//     这两个键总会保留，其余键只在索引流程中使用（如上下文向量化），不会写入向量库。
+//   - 返回客户端：检索和对话接口的 metadata 只包含 RESPONSE_METADATA_KEYS 中的键。
+//   - 仅内部使用：其余的键，例如检索后附加的 creator_id、creator_name（文档权限过滤使用）、
+//     Milvus 返回的原始 distance 和向量化文本 embedding_text，服务内部照常使用，但不返回给客户端。
+//
+// 修改前 user_id 会写入每个分块，creator_id 和 creator_name 会随检索结果返回。默认的允许列表不包含这些键。
+
+// FilterMetadata 返回只包含 allowed 中键的元数据副本，metadata 为空时返回nil
+func FilterMetadata(metadata map[string]interface{}, allowed []string) map[string]interface{} {
+	if len(metadata) == 0 {
+		return nil
+	}
+	filtered := make(map[string]interface{}, len(allowed))
+	for _, key := range allowed {
+		if v, ok := metadata[key]; ok {
+			filtered[key] = v
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,48 @@
+package rag
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"eino-rag/internal/config"
+
+	"github.com/milvus-io/milvus-sdk-go/v2/entity"
+)
+
+// 向量距离度量
+//
+// METRIC_TYPE 同时决定创建集合时索引使用的度量和检索时的度量，两者必须一致，否则 Milvus 拒绝检索。
+// 支持 L2（欧氏距离，越小越相似）、IP（内积）和 COSINE（余弦相似度），不区分大小写，未设置时为 L2。
+// 向量已归一化时 IP 与 COSINE 排序相同。索引的度量在创建集合时确定，修改 METRIC_TYPE 后需要重建集合并重新索引文档。
+// 无法识别的度量在创建检索器时报错，不会静默改用 L2。
+
+// ErrInvalidMetricType 配置的度量类型无法识别
+var ErrInvalidMetricType = errors.New("invalid metric type")
+
+// ParseMetricType 把配置的度量名称转换为 Milvus 的度量类型，空字符串表示 L2
+func ParseMetricType(name string) (entity.MetricType, error) {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "", "L2":
+		return entity.L2, nil
+	case "IP":
+		return entity.IP, nil
+	case "COSINE":
+		return entity.COSINE, nil
+	default:
+		return "", fmt.Errorf("%w: %q, must be one of L2, IP, COSINE", ErrInvalidMetricType, name)
+	}
+}
+
+// embeddingIndex 按配置的索引类型和度量构建向量字段的索引定义
+func embeddingIndex(cfg *config.Config) (entity.Index, error) {
+	metric, err := ParseMetricType(cfg.MetricType)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := vectorIndex(cfg, metric)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create index definition: %w", err)
+	}
+	return idx, nil
+}
@@ -0,0 +1,130 @@
+package rag
+
+import (
+	"context"
+	"math"
+
+	"eino-rag/internal/config"
+
+	"github.com/cloudwego/eino/schema"
+	"go.uber.org/zap"
+)
+
+// MMR 重排
+//
+// 长文档中相邻或重复的段落切出的分块向量很接近，按相似度取前 topK 个时结果经常是几乎相同的内容，
+// 对话上下文重复而信息量少。开启 RETRIEVAL_MMR 后，向量检索先召回 topK × RETRIEVAL_CANDIDATE_MULTIPLIER
+// 个候选（连同分块向量），再按最大边际相关性逐个选出 topK 个：每次选
+//   lambda × 与查询的相似度 - (1 - lambda) × 与已选分块的最大相似度
+// 最大的候选，lambda 为 RETRIEVAL_MMR_LAMBDA。选出的结果按被选中的顺序排列，metadata 中的 score 仍为向量相似度。
+// 混合检索的关键词结果没有向量，不做 MMR 重排。
+
+const (
+	defaultMMRCandidateMultiplier = 3   // 未配置候选召回倍数时使用的倍数，与文档服务一致
+	maxMMRCandidates              = 100 // MMR 最多召回的候选数
+)
+
+// mmrCandidates MMR 召回的候选数，不少于 topK
+func mmrCandidates(cfg *config.Config, topK int) int {
+	multiplier := cfg.RetrievalCandidateMultiplier
+	if multiplier <= 0 {
+		multiplier = defaultMMRCandidateMultiplier
+	}
+	return max(topK, min(topK*multiplier, maxMMRCandidates))
+}
+
+// denseVectorKey schema.Document.WithDenseVector 保存向量使用的 metadata 键
+const denseVectorKey = "_dense_vector"
+
+// retrieveMMR 召回较多候选后按 MMR 选出 topK 个分块
+func (r *MilvusRetriever) retrieveMMR(ctx context.Context, query string, kbID uint, opts RetrieveOptions) ([]*schema.Document, error) {
+	topK := opts.TopK
+	if topK <= 0 {
+		topK = r.topK
+	}
+	queryEmbedding, err := r.embedQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := r.config.Snapshot()
+	candidateOpts := opts
+	candidateOpts.TopK = mmrCandidates(cfg, topK)
+	candidates, err := r.searchByVector(ctx, query, queryEmbedding, kbID, candidateOpts, true)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := MMRRerank(candidates, queryEmbedding, cfg.RetrievalMMRLambda, topK)
+	// 分块向量只在重排时使用，不随结果返回和缓存
+	for _, doc := range docs {
+		delete(doc.MetaData, denseVectorKey)
+	}
+
+	r.logger.Debug("Re-ranked documents with MMR",
+		zap.Int("candidates", len(candidates)),
+		zap.Int("results", len(docs)))
+	return docs, nil
+}
+
+// MMRRerank 按最大边际相关性从 docs 中选出最多 k 个分块，k <= 0 时保留全部，只调整顺序
+// 分块向量取 schema.Document.DenseVector，没有向量的分块以 metadata 中的 score 作为相关性，且不与其他分块比较相似度
+// lambda 超出 [0,1] 时截断；相同分数时保留 docs 中靠前的分块
+func MMRRerank(docs []*schema.Document, queryEmbedding []float32, lambda float64, k int) []*schema.Document {
+	if k <= 0 || k > len(docs) {
+		k = len(docs)
+	}
+	lambda = min(max(lambda, 0), 1)
+
+	query := float64Vector(queryEmbedding)
+	vectors := make([][]float64, len(docs))
+	relevance := make([]float64, len(docs))
+	for i, doc := range docs {
+		vectors[i] = doc.DenseVector()
+		if len(vectors[i]) > 0 && len(query) > 0 {
+			relevance[i] = cosineSimilarity(query, vectors[i])
+		} else {
+			relevance[i] = documentScore(doc)
+		}
+	}
+
+	// redundancy[i] 为候选 i 与已选分块的最大相似度
+	redundancy := make([]float64, len(docs))
+	selected := make([]bool, len(docs))
+	ranked := make([]*schema.Document, 0, k)
+	for len(ranked) < k {
+		best, bestScore := -1, math.Inf(-1)
+		for i := range docs {
+			if selected[i] {
+				continue
+			}
+			if score := lambda*relevance[i] - (1-lambda)*redundancy[i]; score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+
+		selected[best] = true
+		ranked = append(ranked, docs[best])
+		if len(vectors[best]) == 0 {
+			continue
+		}
+		for i := range docs {
+			if !selected[i] && len(vectors[i]) > 0 {
+				redundancy[i] = max(redundancy[i], cosineSimilarity(vectors[i], vectors[best]))
+			}
+		}
+	}
+	return ranked
+}
+
+// float64Vector 把 float32 向量转换为 float64 向量
+func float64Vector(vector []float32) []float64 {
+	if vector == nil {
+		return nil
+	}
+	converted := make([]float64, len(vector))
+	for i, v := range vector {
+		converted[i] = float64(v)
+	}
+	return converted
+}
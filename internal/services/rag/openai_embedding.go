@@ -0,0 +1,176 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/db"
+
+	"go.uber.org/zap"
+)
+
+// OpenAI 兼容的嵌入服务
+//
+// EMBEDDING_PROVIDER=openai 时不使用 Ollama，向 OPENAI_BASE_URL/embeddings（未配置时为 OpenAI 官方地址）请求向量，
+// 模型为 EMBEDDING_MODEL，使用 OPENAI_API_KEY 认证，经 OPENAI_PROXY_URL 访问，地址同样受 OPENAI_ALLOWED_HOSTS 限制。
+// 请求要求返回 vector_dim 维的向量，返回的维度不一致时向量化失败，不会像 Ollama 那样自动采用新维度。
+// 批量向量化时每个请求最多包含 openAIEmbeddingBatch 条文本。向量缓存按服务和模型区分。
+// 该服务本身就是 OpenAI 兼容接口，不使用嵌入服务故障转移。
+
+// openAIEmbeddingBatch 批量向量化时每个请求最多包含的文本数
+const openAIEmbeddingBatch = 64
+
+// ErrInvalidEmbeddingProvider 不支持的 EMBEDDING_PROVIDER
+var ErrInvalidEmbeddingProvider = errors.New("invalid embedding provider")
+
+// NewEmbedder 按 EMBEDDING_PROVIDER 创建嵌入服务，为空时使用 Ollama
+func NewEmbedder(cfg *config.Config, logger *zap.Logger) (Embedder, error) {
+	switch strings.ToLower(cfg.EmbeddingProvider) {
+	case "", EmbeddingProviderOllama:
+		return NewEmbeddingService(cfg, logger), nil
+	case EmbeddingProviderOpenAI:
+		return NewOpenAIEmbedder(cfg, logger)
+	default:
+		return nil, fmt.Errorf("%w: %q (supported: %s, %s)",
+			ErrInvalidEmbeddingProvider, cfg.EmbeddingProvider, EmbeddingProviderOllama, EmbeddingProviderOpenAI)
+	}
+}
+
+// OpenAIEmbedder 通过 OpenAI 兼容的 /embeddings 接口生成向量
+type OpenAIEmbedder struct {
+	config     *config.Config
+	logger     *zap.Logger
+	httpClient *http.Client
+}
+
+// NewOpenAIEmbedder 创建 OpenAI 兼容的嵌入服务，代理地址无效时返回错误
+func NewOpenAIEmbedder(cfg *config.Config, logger *zap.Logger) (*OpenAIEmbedder, error) {
+	timeout := cfg.EmbeddingTimeout
+	if timeout == 0 {
+		timeout = 120 * time.Second
+	}
+	httpClient, err := newOpenAIHTTPClient(cfg, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenAI proxy url: %w", err)
+	}
+
+	logger.Info("Initializing OpenAI-compatible embedding service",
+		zap.Duration("timeout", timeout),
+		zap.String("model", cfg.EmbeddingModel))
+
+	return &OpenAIEmbedder{
+		config:     cfg,
+		logger:     logger,
+		httpClient: httpClient,
+	}, nil
+}
+
+// source 返回当前使用的服务和模型
+func (e *OpenAIEmbedder) source() embeddingSource {
+	return embeddingSource{provider: EmbeddingProviderOpenAI, model: e.config.Snapshot().EmbeddingModel}
+}
+
+// EmbedText 将文本转换为向量
+func (e *OpenAIEmbedder) EmbedText(ctx context.Context, text string) ([]float32, error) {
+	embeddings, err := e.EmbedTexts(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+// EmbedTexts 批量转换文本为向量，已缓存的文本不再请求
+func (e *OpenAIEmbedder) EmbedTexts(ctx context.Context, texts []string) ([][]float32, error) {
+	cfg := e.config.Snapshot()
+	source := e.source()
+	embeddings := make([][]float32, len(texts))
+
+	// 未命中缓存的文本
+	var pending []int
+	for i, text := range texts {
+		if cfg.EmbeddingCache {
+			if cached, err := db.GetCachedEmbedding(ctx, source.cacheTag(), text); err == nil && cached != nil {
+				embeddings[i] = cached
+				continue
+			}
+		}
+		pending = append(pending, i)
+	}
+
+	batches := (len(pending) + openAIEmbeddingBatch - 1) / openAIEmbeddingBatch
+	err := forEachConcurrent(ctx, batches, embeddingWorkers(cfg, batches), func(ctx context.Context, b int) error {
+		batch := pending[b*openAIEmbeddingBatch : min((b+1)*openAIEmbeddingBatch, len(pending))]
+		inputs := make([]string, len(batch))
+		for j, i := range batch {
+			inputs[j] = texts[i]
+		}
+
+		start := time.Now()
+		var results [][]float32
+		err := withEmbeddingRetry(ctx, cfg, e.logger, EmbeddingProviderOpenAI, func() error {
+			var err error
+			results, err = requestOpenAIEmbeddings(ctx, e.httpClient, cfg, source.model, inputs)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		for j, i := range batch {
+			if len(results[j]) != cfg.VectorDimension {
+				return fmt.Errorf("%w: model %q returns %d-dimensional vectors but vector_dim is %d",
+					ErrEmbeddingDimensionMismatch, source.model, len(results[j]), cfg.VectorDimension)
+			}
+			embeddings[i] = results[j]
+			if cfg.EmbeddingCache {
+				if err := db.CacheEmbedding(ctx, source.cacheTag(), texts[i], results[j]); err != nil {
+					e.logger.Warn("Failed to cache embedding", zap.Error(err))
+				}
+			}
+		}
+
+		e.logger.Debug("Embeddings generated successfully",
+			zap.Int("texts", len(batch)),
+			zap.Duration("duration", time.Since(start)),
+			zap.String("provider", EmbeddingProviderOpenAI))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return embeddings, nil
+}
+
+// EmbedWithModel 使用指定模型生成向量，不读写缓存，也不检查返回的向量维度，用于模型对比
+func (e *OpenAIEmbedder) EmbedWithModel(ctx context.Context, model, text string) ([]float32, error) {
+	cfg := e.config.Snapshot()
+	var embeddings [][]float32
+	err := withEmbeddingRetry(ctx, cfg, e.logger, EmbeddingProviderOpenAI, func() error {
+		var err error
+		embeddings, err = requestOpenAIEmbeddings(ctx, e.httpClient, cfg, model, []string{text})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+// GetDimension 获取嵌入向量维度
+func (e *OpenAIEmbedder) GetDimension() int {
+	return e.config.Snapshot().VectorDimension
+}
+
+// Status 返回嵌入服务状态，不使用故障转移
+func (e *OpenAIEmbedder) Status() EmbeddingStatus {
+	source := e.source()
+	return EmbeddingStatus{
+		ActiveProvider: source.provider,
+		ActiveModel:    source.model,
+		PrimaryModel:   source.model,
+	}
+}
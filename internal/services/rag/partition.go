@@ -0,0 +1,351 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"eino-rag/internal/jobs"
+
+	"github.com/milvus-io/milvus-sdk-go/v2/client"
+	"github.com/milvus-io/milvus-sdk-go/v2/entity"
+	"go.uber.org/zap"
+)
+
+// 按知识库分区
+//
+// 开启 MILVUS_KB_PARTITIONS 时，每个知识库的向量写入名为 kb_<id> 的分区，分区在第一次写入时创建；
+// 按知识库检索时只搜索该分区和默认分区（_default），不再扫描整个集合。
+// 默认分区保存分区加入之前写入的向量，以及关闭分区或分区创建失败（如超过 Milvus 的分区数上限）时写入的向量，
+// 检索时仍按 kb_id 过滤，因此新旧数据都能检索到。MigratePartitions 把默认分区中的向量按知识库移动到各自的分区，
+// 迁移完成后默认分区为空，检索它几乎没有开销。
+// 删除知识库时删除默认分区中该知识库的向量，并删除它的分区。
+// 对话附件知识库数量多且很快过期，始终写入默认分区（见 AddOptions.DefaultPartition），迁移时也跳过。
+//
+// 分区是否存在的检查结果（包括不存在）缓存 partitionCacheTTL，其他副本创建或删除分区后最多经过这段时间生效；
+// 检查、写入或检索分区出错时清除该知识库的缓存，下次重新检查。
+
+// defaultPartition Milvus 集合的默认分区
+const defaultPartition = "_default"
+
+// partitionMigrationBatch 迁移时每次从默认分区读取的向量数
+const partitionMigrationBatch = 1000
+
+// partitionCacheTTL 分区是否存在的缓存有效期
+const partitionCacheTTL = 30 * time.Second
+
+// partitionCacheEntry 缓存的分区检查结果
+type partitionCacheEntry struct {
+	exists    bool
+	checkedAt time.Time
+}
+
+// PartitionName 返回知识库的分区名
+func PartitionName(kbID uint) string {
+	return fmt.Sprintf("kb_%d", kbID)
+}
+
+// hasPartition 知识库的分区是否存在，结果缓存 partitionCacheTTL
+func (r *MilvusRetriever) hasPartition(ctx context.Context, c client.Client, kbID uint) (bool, error) {
+	name := PartitionName(kbID)
+	if value, ok := r.partitions.Load(name); ok {
+		entry := value.(partitionCacheEntry)
+		if time.Since(entry.checkedAt) < partitionCacheTTL {
+			return entry.exists, nil
+		}
+	}
+	exists, err := c.HasPartition(ctx, r.collectionName, name)
+	if err != nil {
+		r.partitions.Delete(name)
+		return false, fmt.Errorf("failed to check partition %s: %w", name, err)
+	}
+	r.cachePartition(name, exists)
+	return exists, nil
+}
+
+// cachePartition 记录分区是否存在
+func (r *MilvusRetriever) cachePartition(name string, exists bool) {
+	r.partitions.Store(name, partitionCacheEntry{exists: exists, checkedAt: time.Now()})
+}
+
+// forgetPartition 清除知识库分区的缓存，写入或检索出错时调用，分区可能已被其他副本创建或删除
+func (r *MilvusRetriever) forgetPartition(kbID uint) {
+	if kbID != 0 {
+		r.partitions.Delete(PartitionName(kbID))
+	}
+}
+
+// ensurePartition 确保知识库的分区存在，返回分区名
+func (r *MilvusRetriever) ensurePartition(ctx context.Context, c client.Client, kbID uint) (string, error) {
+	name := PartitionName(kbID)
+	exists, err := r.hasPartition(ctx, c, kbID)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return name, nil
+	}
+
+	if err := c.CreatePartition(ctx, r.collectionName, name); err != nil {
+		// 同一知识库的并发写入或其他副本可能已经创建了分区
+		if exists, checkErr := c.HasPartition(ctx, r.collectionName, name); checkErr != nil || !exists {
+			r.partitions.Delete(name)
+			return "", fmt.Errorf("failed to create partition %s: %w", name, err)
+		}
+	} else {
+		r.logger.Info("Created knowledge base partition",
+			zap.String("collection", r.collectionName),
+			zap.String("partition", name))
+	}
+	r.cachePartition(name, true)
+	return name, nil
+}
+
+// insertPartition 返回写入知识库向量的分区，未开启分区、要求写入默认分区或分区创建失败时返回空字符串，写入默认分区
+func (r *MilvusRetriever) insertPartition(ctx context.Context, c client.Client, kbID uint, defaultOnly bool) string {
+	if kbID == 0 || defaultOnly || !r.config.Snapshot().MilvusKBPartitions {
+		return ""
+	}
+	name, err := r.ensurePartition(ctx, c, kbID)
+	if err != nil {
+		r.logger.Warn("Failed to prepare knowledge base partition, inserting into the default partition",
+			zap.Uint("kb_id", kbID),
+			zap.Error(err))
+		return ""
+	}
+	return name
+}
+
+// searchPartitions 返回检索知识库时搜索的分区，kbID 为0或无法确认分区时返回nil，搜索整个集合
+func (r *MilvusRetriever) searchPartitions(ctx context.Context, c client.Client, kbID uint) []string {
+	if kbID == 0 {
+		return nil
+	}
+	exists, err := r.hasPartition(ctx, c, kbID)
+	if err != nil {
+		r.logger.Warn("Failed to check knowledge base partition, searching the whole collection",
+			zap.Uint("kb_id", kbID),
+			zap.Error(err))
+		return nil
+	}
+	if !exists {
+		return []string{defaultPartition}
+	}
+	return []string{defaultPartition, PartitionName(kbID)}
+}
+
+// dropPartition 删除知识库的分区，分区不存在时直接返回
+func (r *MilvusRetriever) dropPartition(ctx context.Context, c client.Client, kbID uint) error {
+	name := PartitionName(kbID)
+	r.partitions.Delete(name)
+
+	exists, err := c.HasPartition(ctx, r.collectionName, name)
+	if err != nil {
+		return fmt.Errorf("failed to check partition %s: %w", name, err)
+	}
+	if !exists {
+		return nil
+	}
+	// 已加载的分区需要先释放才能删除
+	if err := c.ReleasePartitions(ctx, r.collectionName, []string{name}); err != nil {
+		return fmt.Errorf("failed to release partition %s: %w", name, err)
+	}
+	if err := c.DropPartition(ctx, r.collectionName, name); err != nil {
+		return fmt.Errorf("failed to drop partition %s: %w", name, err)
+	}
+	return nil
+}
+
+// resetPartitions 清空分区缓存，重新连接或重建集合后分区可能已经不存在
+func (r *MilvusRetriever) resetPartitions() {
+	r.partitions.Range(func(key, _ interface{}) bool {
+		r.partitions.Delete(key)
+		return true
+	})
+}
+
+// PartitionMigrationResult 默认分区迁移结果
+type PartitionMigrationResult struct {
+	Moved          int    `json:"moved"`           // 移动到知识库分区的向量数
+	KnowledgeBases []uint `json:"knowledge_bases"` // 有向量被移动的知识库
+}
+
+// MigratePartitions 把默认分区中的向量按知识库移动到各自的分区，skip 中的知识库（如对话附件知识库）留在默认分区
+// 每批先删除目标分区中的同ID向量再写入，最后从默认分区删除，中断后重新执行不会产生重复的向量；
+// 写入和删除之间的短暂时间内，同一分块可能在检索结果中出现两次
+func (r *MilvusRetriever) MigratePartitions(ctx context.Context, skip []uint, progress jobs.Reporter) (*PartitionMigrationResult, error) {
+	result := &PartitionMigrationResult{KnowledgeBases: []uint{}}
+	c, exists, err := r.inventoryClient(ctx)
+	if err != nil || !exists {
+		return result, err
+	}
+
+	moved := make(map[string]bool)
+	migrated := make(map[uint]bool)
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		batch, err := r.queryDefaultPartition(ctx, c, skip)
+		if err != nil {
+			return result, err
+		}
+		if len(batch.ids) == 0 {
+			break
+		}
+
+		for _, group := range batch.byKnowledgeBase() {
+			for _, id := range group.ids {
+				// 删除没有生效时避免重复读取同一批向量
+				if moved[id] {
+					return result, fmt.Errorf("vector %s was not removed from the default partition", id)
+				}
+				moved[id] = true
+			}
+			name, err := r.movePartitionGroup(ctx, c, group)
+			if progress != nil {
+				progress.Advance(name, err)
+			}
+			if err != nil {
+				return result, err
+			}
+			result.Moved += len(group.ids)
+			if !migrated[group.kbID] {
+				migrated[group.kbID] = true
+				result.KnowledgeBases = append(result.KnowledgeBases, group.kbID)
+			}
+		}
+	}
+
+	r.logger.Info("Migrated vectors into knowledge base partitions",
+		zap.String("collection", r.collectionName),
+		zap.Int("moved", result.Moved),
+		zap.Int("knowledge_bases", len(result.KnowledgeBases)))
+	return result, nil
+}
+
+// vectorRows 从集合中读取的一批向量
+type vectorRows struct {
+	kbID       uint
+	ids        []string
+	contents   []string
+	embeddings [][]float32
+	kbIDs      []int64
+	docIDs     []int64
+}
+
+// byKnowledgeBase 按知识库拆分，按知识库ID排序
+func (rows *vectorRows) byKnowledgeBase() []*vectorRows {
+	groups := make(map[uint]*vectorRows)
+	for i, id := range rows.ids {
+		kbID := uint(rows.kbIDs[i])
+		group, ok := groups[kbID]
+		if !ok {
+			group = &vectorRows{kbID: kbID}
+			groups[kbID] = group
+		}
+		group.ids = append(group.ids, id)
+		group.contents = append(group.contents, rows.contents[i])
+		group.embeddings = append(group.embeddings, rows.embeddings[i])
+		group.kbIDs = append(group.kbIDs, rows.kbIDs[i])
+		group.docIDs = append(group.docIDs, rows.docIDs[i])
+	}
+
+	sorted := make([]*vectorRows, 0, len(groups))
+	for _, group := range groups {
+		sorted = append(sorted, group)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].kbID < sorted[j].kbID })
+	return sorted
+}
+
+// queryDefaultPartition 读取默认分区中最多 partitionMigrationBatch 个属于知识库、且不在 skip 中的向量
+func (r *MilvusRetriever) queryDefaultPartition(ctx context.Context, c client.Client, skip []uint) (*vectorRows, error) {
+	expr := "kb_id > 0"
+	if len(skip) > 0 {
+		ids := make([]string, len(skip))
+		for i, kbID := range skip {
+			ids[i] = strconv.FormatUint(uint64(kbID), 10)
+		}
+		expr += fmt.Sprintf(" and kb_id not in [%s]", strings.Join(ids, ","))
+	}
+
+	var result client.ResultSet
+	err := r.withRetry(ctx, "query", func() error {
+		var err error
+		result, err = c.Query(ctx, r.collectionName, []string{defaultPartition}, expr,
+			[]string{"id", "content", "embedding", "kb_id", "doc_id"},
+			client.WithLimit(partitionMigrationBatch),
+			client.WithSearchQueryConsistencyLevel(entity.ClStrong))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query default partition: %w", err)
+	}
+
+	rows := &vectorRows{}
+	idColumn, ok := result.GetColumn("id").(*entity.ColumnVarChar)
+	if !ok {
+		return rows, nil
+	}
+	contentColumn, okContent := result.GetColumn("content").(*entity.ColumnVarChar)
+	vectorColumn, okVector := result.GetColumn("embedding").(*entity.ColumnFloatVector)
+	kbColumn, okKB := result.GetColumn("kb_id").(*entity.ColumnInt64)
+	docColumn, okDoc := result.GetColumn("doc_id").(*entity.ColumnInt64)
+	if !okContent || !okVector || !okKB || !okDoc {
+		return nil, fmt.Errorf("default partition query result is missing fields")
+	}
+
+	rows.ids = idColumn.Data()
+	rows.contents = contentColumn.Data()
+	rows.embeddings = vectorColumn.Data()
+	rows.kbIDs = kbColumn.Data()
+	rows.docIDs = docColumn.Data()
+	n := len(rows.ids)
+	if len(rows.contents) != n || len(rows.embeddings) != n || len(rows.kbIDs) != n || len(rows.docIDs) != n {
+		return nil, fmt.Errorf("default partition query returned columns of different lengths")
+	}
+	return rows, nil
+}
+
+// movePartitionGroup 把一个知识库的一批向量从默认分区移动到知识库分区，返回分区名
+func (r *MilvusRetriever) movePartitionGroup(ctx context.Context, c client.Client, group *vectorRows) (string, error) {
+	name, err := r.ensurePartition(ctx, c, group.kbID)
+	if err != nil {
+		return PartitionName(group.kbID), err
+	}
+
+	expr := fmt.Sprintf("id in [%s]", quoteIDs(group.ids))
+	// 上次迁移中断时这些向量可能已写入知识库分区
+	if err := r.withRetry(ctx, "delete", func() error {
+		return c.Delete(ctx, r.collectionName, name, expr)
+	}); err != nil {
+		return name, fmt.Errorf("failed to clear partition %s: %w", name, err)
+	}
+
+	if err := r.withRetry(ctx, "insert", func() error {
+		insertCtx, cancel := context.WithTimeout(ctx, r.insertTimeout)
+		defer cancel()
+		_, err := c.Insert(insertCtx, r.collectionName, name,
+			entity.NewColumnVarChar("id", group.ids),
+			entity.NewColumnVarChar("content", group.contents),
+			entity.NewColumnFloatVector("embedding", len(group.embeddings[0]), group.embeddings),
+			entity.NewColumnInt64("kb_id", group.kbIDs),
+			entity.NewColumnInt64("doc_id", group.docIDs),
+		)
+		return err
+	}); err != nil {
+		r.forgetPartition(group.kbID)
+		return name, fmt.Errorf("failed to insert into partition %s: %w", name, err)
+	}
+
+	if err := r.withRetry(ctx, "delete", func() error {
+		return c.Delete(ctx, r.collectionName, defaultPartition, expr)
+	}); err != nil {
+		return name, fmt.Errorf("failed to delete migrated vectors from the default partition: %w", err)
+	}
+	return name, nil
+}
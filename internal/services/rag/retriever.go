@@ -3,6 +3,7 @@ package rag
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,18 +20,50 @@ import (
 type MilvusRetriever struct {
 	client         client.Client
 	collectionName string
-	embedding      *EmbeddingService
+	embedding      Embedder
 	topK           int
 	logger         *zap.Logger
 	insertTimeout  time.Duration
 	config         *config.Config
 	isConnected    bool
+	breaker        *circuitBreaker
 	mu             sync.RWMutex
 	ctx            context.Context
 	cancel         context.CancelFunc
+
+	// 重连退避状态，由 mu 保护
+	retryDelay  time.Duration
+	nextRetryAt time.Time
+	lastError   string
+	resetCh     chan struct{}
+
+	unsubscribe func() // 取消配置变更通知
+
+	partitions sync.Map // 分区名到 partitionCacheEntry 的缓存，见 partition.go
+}
+
+const (
+	minRetryDelay = time.Second
+	maxRetryDelay = 5 * time.Minute
+)
+
+// MilvusStatus Milvus 连接与重连退避状态
+type MilvusStatus struct {
+	Connected   bool
+	BreakerOpen bool
+	RetryDelay  time.Duration // 断开时的重连退避间隔，下一次检查（已连接时为健康检查）在 NextRetryAt 进行
+	NextRetryAt time.Time
+	LastError   string // 最近一次连接失败的原因，连接成功后清空
 }
 
-func NewMilvusRetriever(cfg *config.Config, embedding *EmbeddingService, logger *zap.Logger) (*MilvusRetriever, error) {
+func NewMilvusRetriever(cfg *config.Config, embedding Embedder, logger *zap.Logger) (*MilvusRetriever, error) {
+	if _, err := ParseMetricType(cfg.MetricType); err != nil {
+		return nil, err
+	}
+	if _, err := ParseIndexType(cfg.IndexType); err != nil {
+		return nil, err
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	
 	retriever := &MilvusRetriever{
@@ -42,13 +75,40 @@ func NewMilvusRetriever(cfg *config.Config, embedding *EmbeddingService, logger
 		config:         cfg,
 		ctx:            ctx,
 		cancel:         cancel,
+		retryDelay:     minRetryDelay,
+		resetCh:        make(chan struct{}, 1),
 	}
 
+	// 熔断器打开时标记为断开，由重连循环负责恢复
+	retriever.breaker = newCircuitBreaker(cfg.MilvusBreakerThreshold, cfg.MilvusBreakerTimeout, func() {
+		logger.Warn("Milvus circuit breaker opened, marking as disconnected",
+			zap.Int("threshold", cfg.MilvusBreakerThreshold),
+			zap.Duration("open_timeout", cfg.MilvusBreakerTimeout))
+		retriever.mu.Lock()
+		retriever.isConnected = false
+		retriever.mu.Unlock()
+	})
+
 	// 尝试初始连接
 	if err := retriever.connect(); err != nil {
 		logger.Warn("Initial connection to Milvus failed, will retry in background", 
 			zap.Error(err),
-			zap.String("address", cfg.MilvusAddress))
+			zap.String("address", config.RedactURL(cfg.MilvusAddress)))
+	}
+
+	// 连接参数变更后使用新配置重连
+	retriever.unsubscribe = config.Subscribe(func(old, updated *config.Config) {
+		if milvusConnectionChanged(old, updated) {
+			logger.Info("Milvus connection settings changed, reconnecting",
+				zap.String("address", config.RedactURL(updated.MilvusAddress)))
+			retriever.reconnect()
+		}
+		if old.VectorDimension != updated.VectorDimension {
+			retriever.recreateEmptyCollection(updated.VectorDimension)
+		}
+	})
+	if checker, ok := embedding.(DimensionChecker); ok {
+		checker.SetDimensionCheck(retriever.checkCollectionEmpty)
 	}
 
 	// 启动重连协程
@@ -57,6 +117,45 @@ func NewMilvusRetriever(cfg *config.Config, embedding *EmbeddingService, logger
 	return retriever, nil
 }
 
+// NewMilvusRetrieverWithClient 使用已建立的连接创建检索器，集合不存在时创建
+// 不启动重连协程，也不随配置变更重连，连接由调用方提供，Close 时一并关闭
+func NewMilvusRetrieverWithClient(cfg *config.Config, embedding Embedder, c client.Client, logger *zap.Logger) (*MilvusRetriever, error) {
+	if _, err := ParseMetricType(cfg.MetricType); err != nil {
+		return nil, err
+	}
+	if _, err := ParseIndexType(cfg.IndexType); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	retriever := &MilvusRetriever{
+		collectionName: cfg.CollectionName,
+		embedding:      embedding,
+		topK:           cfg.TopK,
+		logger:         logger,
+		insertTimeout:  cfg.MilvusInsertTimeout,
+		config:         cfg,
+		ctx:            ctx,
+		cancel:         cancel,
+		retryDelay:     minRetryDelay,
+		resetCh:        make(chan struct{}, 1),
+		unsubscribe:    func() {},
+	}
+	retriever.breaker = newCircuitBreaker(cfg.MilvusBreakerThreshold, cfg.MilvusBreakerTimeout, func() {
+		retriever.mu.Lock()
+		retriever.isConnected = false
+		retriever.mu.Unlock()
+	})
+
+	if err := retriever.ensureCollectionWithClient(ctx, c); err != nil {
+		cancel()
+		return nil, err
+	}
+	retriever.client = c
+	retriever.isConnected = true
+	return retriever, nil
+}
+
 // ensureCollectionWithClient 确保集合存在
 func (r *MilvusRetriever) ensureCollectionWithClient(ctx context.Context, c client.Client) error {
 	// 使用带超时的上下文
@@ -99,7 +198,7 @@ func (r *MilvusRetriever) ensureCollectionWithClient(ctx context.Context, c clie
 					Name:     "embedding",
 					DataType: entity.FieldTypeFloatVector,
 					TypeParams: map[string]string{
-						"dim": fmt.Sprintf("%d", r.config.VectorDimension),
+						"dim": fmt.Sprintf("%d", r.config.Snapshot().VectorDimension),
 					},
 				},
 				{
@@ -120,9 +219,9 @@ func (r *MilvusRetriever) ensureCollectionWithClient(ctx context.Context, c clie
 		r.logger.Info("Created Milvus collection", zap.String("collection", r.collectionName))
 
 		// 创建索引
-		idx, err := entity.NewIndexIvfFlat(entity.L2, 1024)
+		idx, err := embeddingIndex(r.config.Snapshot())
 		if err != nil {
-			return fmt.Errorf("failed to create index definition: %w", err)
+			return err
 		}
 
 		if err := c.CreateIndex(ctx, r.collectionName, "embedding", idx, false); err != nil {
@@ -209,9 +308,9 @@ func (r *MilvusRetriever) ensureCollection(ctx context.Context, cfg *config.Conf
 		r.logger.Info("Created Milvus collection", zap.String("collection", r.collectionName))
 
 		// 创建索引
-		idx, err := entity.NewIndexIvfFlat(entity.L2, 1024)
+		idx, err := embeddingIndex(cfg)
 		if err != nil {
-			return fmt.Errorf("failed to create index definition: %w", err)
+			return err
 		}
 
 		if err := client.CreateIndex(ctx, r.collectionName, "embedding", idx, false); err != nil {
@@ -227,22 +326,49 @@ func (r *MilvusRetriever) ensureCollection(ctx context.Context, cfg *config.Conf
 	return nil
 }
 
-// AddDocuments 添加文档到向量数据库
+// AddOptions 写入向量库的可选参数
+type AddOptions struct {
+	SkipFailed bool // 跳过向量化失败的分块，只写入成功的部分
+	// DefaultPartition 写入默认分区，不创建知识库分区，用于对话附件等临时的知识库
+	DefaultPartition bool
+
+	// Progress 不为nil时报告向量化进度，processed 为已完成的分块数，调用不会并发，见 batch.go
+	Progress func(processed, total int)
+}
+
+// AddResult 写入结果统计
+type AddResult struct {
+	Indexed        int      // 成功写入的分块数
+	FailedChunkIDs []string // 向量化失败被跳过的分块ID
+}
+
+// AddDocuments 添加文档到向量数据库，任一分块失败即整体失败
 func (r *MilvusRetriever) AddDocuments(ctx context.Context, docs []*schema.Document, kbID, docID uint) error {
+	_, err := r.AddDocumentsWithOptions(ctx, docs, kbID, docID, AddOptions{})
+	return err
+}
+
+// AddDocumentsWithOptions 按指定参数添加文档到向量数据库
+// SkipFailed 时单个分块向量化失败只记录日志并跳过，全部失败时仍返回错误
+func (r *MilvusRetriever) AddDocumentsWithOptions(ctx context.Context, docs []*schema.Document, kbID, docID uint, opts AddOptions) (*AddResult, error) {
+	result := &AddResult{}
 	if len(docs) == 0 {
-		return nil
+		return result, nil
 	}
 	
-	// 检查连接状态
+	// 检查熔断和连接状态
+	if r.breaker.isOpen() {
+		return nil, ErrCircuitOpen
+	}
 	if !r.IsConnected() {
-		return fmt.Errorf("milvus is not connected")
+		return nil, fmt.Errorf("milvus is not connected")
 	}
 
-	ids := make([]string, len(docs))
-	contents := make([]string, len(docs))
-	embeddings := make([][]float32, len(docs))
-	kbIDs := make([]int64, len(docs))
-	docIDs := make([]int64, len(docs))
+	ids := make([]string, 0, len(docs))
+	contents := make([]string, 0, len(docs))
+	embeddings := make([][]float32, 0, len(docs))
+	kbIDs := make([]int64, 0, len(docs))
+	docIDs := make([]int64, 0, len(docs))
 
 	// 准备数据
 	r.logger.Info("Starting to generate embeddings",
@@ -250,116 +376,218 @@ func (r *MilvusRetriever) AddDocuments(ctx context.Context, docs []*schema.Docum
 		zap.Uint("kb_id", kbID),
 		zap.Uint("doc_id", docID))
 	
+	// 批量生成嵌入向量，按分块顺序保存结果，见 batch.go
+	generated, err := r.generateEmbeddings(ctx, docs, opts)
+	if err != nil {
+		return nil, err
+	}
+
 	for i, doc := range docs {
-		ids[i] = doc.ID
-		contents[i] = doc.Content
-
-		// 记录当前处理进度
-		if i%10 == 0 {
-			r.logger.Info("Embedding generation progress",
-				zap.Int("processed", i),
-				zap.Int("total", len(docs)),
-				zap.String("doc_id", doc.ID))
+		if generated[i] == nil {
+			result.FailedChunkIDs = append(result.FailedChunkIDs, doc.ID)
+			continue
 		}
-		
-		// 生成嵌入向量
-		embedding, err := r.embedding.EmbedText(ctx, doc.Content)
-		if err != nil {
-			r.logger.Error("Failed to generate embedding",
-				zap.String("doc_id", doc.ID),
-				zap.Int("content_length", len(doc.Content)),
-				zap.Error(err))
-			return fmt.Errorf("failed to generate embedding for document %s: %w", doc.ID, err)
-		}
-		embeddings[i] = embedding
+		ids = append(ids, doc.ID)
+		contents = append(contents, doc.Content)
+		embeddings = append(embeddings, generated[i])
+		kbIDs = append(kbIDs, int64(kbID))
+		docIDs = append(docIDs, int64(docID))
+	}
 
-		kbIDs[i] = int64(kbID)
-		docIDs[i] = int64(docID)
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("failed to generate embeddings for all %d chunks", len(docs))
+	}
+	if len(result.FailedChunkIDs) > 0 {
+		r.logger.Warn("Skipped chunks that failed to embed",
+			zap.Uint("doc_id", docID),
+			zap.Int("failed", len(result.FailedChunkIDs)),
+			zap.Int("total", len(docs)))
 	}
 
 	// 插入数据
 	r.logger.Info("All embeddings generated, inserting to Milvus",
-		zap.Int("doc_count", len(docs)),
+		zap.Int("doc_count", len(ids)),
 		zap.String("collection", r.collectionName))
 	
-	insertCtx, cancel := context.WithTimeout(ctx, r.insertTimeout)
-	defer cancel()
-
 	r.mu.RLock()
 	client := r.client
 	r.mu.RUnlock()
 	
 	if client == nil {
-		return fmt.Errorf("milvus client is not initialized")
+		return nil, fmt.Errorf("milvus client is not initialized")
 	}
 
-	_, err := client.Insert(insertCtx, r.collectionName, "",
-		entity.NewColumnVarChar("id", ids),
-		entity.NewColumnVarChar("content", contents),
-		entity.NewColumnFloatVector("embedding", int(r.embedding.GetDimension()), embeddings),
-		entity.NewColumnInt64("kb_id", kbIDs),
-		entity.NewColumnInt64("doc_id", docIDs),
-	)
+	partition := r.insertPartition(ctx, client, kbID, opts.DefaultPartition)
+	err = r.withRetry(ctx, "insert", func() error {
+		insertCtx, cancel := context.WithTimeout(ctx, r.insertTimeout)
+		defer cancel()
+
+		_, err := client.Insert(insertCtx, r.collectionName, partition,
+			entity.NewColumnVarChar("id", ids),
+			entity.NewColumnVarChar("content", contents),
+			entity.NewColumnFloatVector("embedding", int(r.embedding.GetDimension()), embeddings),
+			entity.NewColumnInt64("kb_id", kbIDs),
+			entity.NewColumnInt64("doc_id", docIDs),
+		)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("failed to insert documents: %w", err)
+		if partition != "" {
+			r.forgetPartition(kbID)
+		}
+		return nil, WrapTimeout(ctx, StageInsert, r.insertTimeout, fmt.Errorf("failed to insert documents: %w", err))
 	}
 
 	r.logger.Info("Inserted documents to Milvus",
-		zap.Int("count", len(docs)),
-		zap.String("collection", r.collectionName))
+		zap.Int("count", len(ids)),
+		zap.String("collection", r.collectionName),
+		zap.String("partition", partition))
 
-	return nil
+	result.Indexed = len(ids)
+	return result, nil
 }
 
-// Retrieve 检索相关文档
-func (r *MilvusRetriever) Retrieve(ctx context.Context, query string, kbID uint) ([]*schema.Document, error) {
-	// 检查连接状态
+// RetrieveOptions 单次检索的可选参数，零值表示使用默认配置
+type RetrieveOptions struct {
+	TopK           int     // 返回结果数量，<= 0 时使用配置的 TopK
+	ScoreThreshold float32 // 最低相似度分数，<= 0 时不过滤
+	SearchEffort   int     // 检索力度（IVF 的 nprobe / HNSW 的 ef），<= 0 时使用配置的默认值
+
+	// 时间衰减重排参数，检索器不使用，由文档服务在检索后按文档创建时间重排
+	RecencyWeight       *float64 // 新鲜度权重 [0,1]，nil 时使用知识库的设置，0 表示不启用
+	RecencyHalfLifeDays float64  // 半衰期（天），<= 0 时使用知识库的设置或全局配置
+
+	// 每个文档最多返回的分块数，检索器不使用，由文档服务在检索后筛选；nil 时使用配置，0 表示不限制
+	MaxChunksPerDoc *int
+
+	// 启用重排或筛选时相对 TopK 多召回的倍数，检索器不使用，由文档服务据此放大 TopK；<= 0 时使用配置
+	CandidateMultiplier int
+
+	// 按文档创建者、创建时间和标签过滤，检索器不使用，由文档服务查询出符合条件的文档后设置 DocIDs
+	CreatorID     uint       // 文档创建者，0 表示不过滤
+	CreatedAfter  *time.Time // 只检索在此时间及之后创建的文档
+	CreatedBefore *time.Time // 只检索在此时间之前创建的文档
+	Tags          []string   // 只检索包含全部这些标签的文档（markdown frontmatter 中的 tags）
+
+	// 只检索这些文档中的分块，为空表示不限制
+	DocIDs []uint
+
+	// 混合检索：同时按关键词匹配分块内容，按 HYBRID_ALPHA 混合两种分数；内存检索器本身按关键词匹配，忽略该参数
+	Hybrid bool
+}
+
+// Retrieve 检索知识库中最相似的 topK 个分块，数量由 Milvus 限制，topK <= 0 时使用配置的 TOP_K
+func (r *MilvusRetriever) Retrieve(ctx context.Context, query string, kbID uint, topK int) ([]*schema.Document, error) {
+	return r.RetrieveWithOptions(ctx, query, kbID, RetrieveOptions{TopK: topK})
+}
+
+// RetrieveWithOptions 按指定参数检索文档，opts.Hybrid 时同时按关键词匹配分块内容
+func (r *MilvusRetriever) RetrieveWithOptions(ctx context.Context, query string, kbID uint, opts RetrieveOptions) ([]*schema.Document, error) {
+	if opts.Hybrid {
+		return r.RetrieveHybridWithOptions(ctx, query, kbID, opts)
+	}
+	if r.config.Snapshot().RetrievalMMR {
+		return r.retrieveMMR(ctx, query, kbID, opts)
+	}
+	return r.vectorSearch(ctx, query, kbID, opts)
+}
+
+// vectorSearch 按向量相似度检索文档
+func (r *MilvusRetriever) vectorSearch(ctx context.Context, query string, kbID uint, opts RetrieveOptions) ([]*schema.Document, error) {
+	queryEmbedding, err := r.embedQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return r.searchByVector(ctx, query, queryEmbedding, kbID, opts, false)
+}
+
+// embedQuery 检查熔断和连接状态后生成查询向量
+func (r *MilvusRetriever) embedQuery(ctx context.Context, query string) ([]float32, error) {
+	// 检查熔断和连接状态
+	if r.breaker.isOpen() {
+		return nil, ErrCircuitOpen
+	}
 	if !r.IsConnected() {
-		return nil, fmt.Errorf("milvus is not connected")
+		return nil, fmt.Errorf("%w: milvus is not connected", ErrVectorStoreUnavailable)
 	}
 	// 生成查询向量
 	queryEmbedding, err := r.embedding.EmbedText(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
 	}
+	return queryEmbedding, nil
+}
+
+// searchByVector 用查询向量检索文档，withEmbeddings 时同时返回分块的向量（schema.Document.DenseVector）
+func (r *MilvusRetriever) searchByVector(ctx context.Context, query string, queryEmbedding []float32, kbID uint, opts RetrieveOptions, withEmbeddings bool) ([]*schema.Document, error) {
+	topK := opts.TopK
+	if topK <= 0 {
+		topK = r.topK
+	}
 
 	// 构建搜索向量
 	vectors := []entity.Vector{
 		entity.FloatVector(queryEmbedding),
 	}
 
-	// 搜索参数
-	sp, _ := entity.NewIndexFlatSearchParam()
+	// 搜索参数，按索引类型设置检索力度
+	cfg := r.config.Snapshot()
+	sp, err := buildSearchParam(cfg, opts.SearchEffort, topK)
+	if err != nil {
+		return nil, err
+	}
+	metric, err := ParseMetricType(cfg.MetricType)
+	if err != nil {
+		return nil, err
+	}
 
 	// 构建表达式
-	expr := ""
-	if kbID > 0 {
-		expr = fmt.Sprintf("kb_id == %d", kbID)
-	}
+	expr := searchExpr(kbID, opts.DocIDs)
 
 	r.mu.RLock()
-	client := r.client
+	milvusClient := r.client
 	r.mu.RUnlock()
 	
-	if client == nil {
-		return nil, fmt.Errorf("milvus client is not initialized")
+	if milvusClient == nil {
+		return nil, fmt.Errorf("%w: milvus client is not initialized", ErrVectorStoreUnavailable)
+	}
+
+	// 按知识库检索时只搜索知识库分区和保存旧数据的默认分区
+	partitions := r.searchPartitions(ctx, milvusClient, kbID)
+
+	outputFields := []string{"id", "content", "kb_id", "doc_id"}
+	if withEmbeddings {
+		outputFields = append(outputFields, "embedding")
 	}
 
 	// 执行搜索
-	searchResult, err := client.Search(
-		ctx,
-		r.collectionName,
-		nil,
-		expr,
-		[]string{"id", "content"},
-		vectors,
-		"embedding",
-		entity.L2,
-		r.topK,
-		sp,
-	)
+	var searchResult []client.SearchResult
+	err = r.withRetry(ctx, "search", func() error {
+		searchCtx := ctx
+		if cfg.MilvusSearchTimeout > 0 {
+			var cancel context.CancelFunc
+			searchCtx, cancel = context.WithTimeout(ctx, cfg.MilvusSearchTimeout)
+			defer cancel()
+		}
+
+		var err error
+		searchResult, err = milvusClient.Search(
+			searchCtx,
+			r.collectionName,
+			partitions,
+			expr,
+			outputFields,
+			vectors,
+			"embedding",
+			metric,
+			topK,
+			sp,
+		)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to search: %w", err)
+		r.forgetPartition(kbID)
+		return nil, WrapTimeout(ctx, StageSearch, cfg.MilvusSearchTimeout, fmt.Errorf("failed to search: %w", err))
 	}
 
 	// 转换结果
@@ -368,16 +596,34 @@ func (r *MilvusRetriever) Retrieve(ctx context.Context, query string, kbID uint)
 		for i := 0; i < result.ResultCount; i++ {
 			id, _ := result.Fields.GetColumn("id").Get(i)
 			content, _ := result.Fields.GetColumn("content").Get(i)
-			score, _ := result.IDs.Get(i)
+			hitKBID, _ := result.Fields.GetColumn("kb_id").GetAsInt64(i)
+			hitDocID, _ := result.Fields.GetColumn("doc_id").GetAsInt64(i)
+			distance := result.Scores[i]
+			score := distanceToScore(metric, distance)
+
+			// 过滤低于阈值的结果
+			if opts.ScoreThreshold > 0 && score < float64(opts.ScoreThreshold) {
+				continue
+			}
 
 			doc := &schema.Document{
 				ID:      id.(string),
 				Content: content.(string),
 				MetaData: map[string]interface{}{
 					"score":    score,
-					"distance": result.Scores[i],
+					"distance": distance,
+					"kb_id":    uint(hitKBID),
+					"doc_id":   uint(hitDocID),
 				},
 			}
+			if IsSummaryChunk(doc.ID) {
+				doc.MetaData["type"] = ChunkTypeSummary
+			}
+			if withEmbeddings {
+				if column, ok := result.Fields.GetColumn("embedding").(*entity.ColumnFloatVector); ok && i < len(column.Data()) {
+					doc.WithDenseVector(float64Vector(column.Data()[i]))
+				}
+			}
 			documents = append(documents, doc)
 		}
 	}
@@ -389,6 +635,59 @@ func (r *MilvusRetriever) Retrieve(ctx context.Context, query string, kbID uint)
 	return documents, nil
 }
 
+// searchExpr 构建按知识库和文档过滤的检索表达式
+func searchExpr(kbID uint, docIDs []uint) string {
+	var conditions []string
+	if kbID > 0 {
+		conditions = append(conditions, fmt.Sprintf("kb_id == %d", kbID))
+	}
+	if len(docIDs) > 0 {
+		conditions = append(conditions, fmt.Sprintf("doc_id in [%s]", formatIDs(docIDs)))
+	}
+	return strings.Join(conditions, " && ")
+}
+
+// distanceToScore 将距离转换为越大越相似的分数
+func distanceToScore(metric entity.MetricType, distance float32) float64 {
+	switch metric {
+	case entity.IP, entity.COSINE:
+		return float64(distance)
+	default:
+		// L2 距离越小越相似，映射到 (0, 1]
+		return 1 / (1 + float64(distance))
+	}
+}
+
+// ChunkTypeSummary 文档摘要分块在检索结果 metadata 中的 type 值
+const ChunkTypeSummary = "summary"
+
+// ChunkTypeFallback 降级检索（按文件名和摘要匹配）结果在 metadata 中的 type 值
+const ChunkTypeFallback = "fallback"
+
+// summaryChunkPrefix 摘要分块ID前缀，集合中没有类型字段，通过ID区分
+const summaryChunkPrefix = "summary_"
+
+// SummaryChunkID 返回文档摘要分块的ID
+func SummaryChunkID(docID uint) string {
+	return fmt.Sprintf("%s%d", summaryChunkPrefix, docID)
+}
+
+// IsSummaryChunk 判断分块是否为文档摘要
+func IsSummaryChunk(chunkID string) bool {
+	return strings.HasPrefix(chunkID, summaryChunkPrefix)
+}
+
+// EmbeddingTextKey 分块 metadata 中用于向量化的文本，未设置时使用分块内容；写入向量库的始终是分块内容
+const EmbeddingTextKey = "embedding_text"
+
+// EmbeddingText 返回分块用于向量化的文本
+func EmbeddingText(doc *schema.Document) string {
+	if text, ok := doc.MetaData[EmbeddingTextKey].(string); ok && text != "" {
+		return text
+	}
+	return doc.Content
+}
+
 // DeleteByKnowledgeBase 删除指定知识库的所有文档
 func (r *MilvusRetriever) DeleteByKnowledgeBase(ctx context.Context, kbID uint) error {
 	// 检查连接状态
@@ -404,8 +703,17 @@ func (r *MilvusRetriever) DeleteByKnowledgeBase(ctx context.Context, kbID uint)
 		return fmt.Errorf("milvus client is not initialized")
 	}
 	
+	// 默认分区中保存着分区加入之前写入的向量，知识库分区整个删除
 	expr := fmt.Sprintf("kb_id == %d", kbID)
-	err := client.Delete(ctx, r.collectionName, "", expr)
+	err := r.withRetry(ctx, "delete", func() error {
+		return client.Delete(ctx, r.collectionName, defaultPartition, expr)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete documents: %w", err)
+	}
+	err = r.withRetry(ctx, "drop_partition", func() error {
+		return r.dropPartition(ctx, client, kbID)
+	})
 	if err != nil {
 		return fmt.Errorf("failed to delete documents: %w", err)
 	}
@@ -432,7 +740,9 @@ func (r *MilvusRetriever) DeleteByDocument(ctx context.Context, docID uint) erro
 	}
 	
 	expr := fmt.Sprintf("doc_id == %d", docID)
-	err := client.Delete(ctx, r.collectionName, "", expr)
+	err := r.withRetry(ctx, "delete", func() error {
+		return client.Delete(ctx, r.collectionName, "", expr)
+	})
 	if err != nil {
 		return fmt.Errorf("failed to delete document vectors: %w", err)
 	}
@@ -443,8 +753,53 @@ func (r *MilvusRetriever) DeleteByDocument(ctx context.Context, docID uint) erro
 	return nil
 }
 
+// withRetry 在熔断器保护下执行Milvus操作，临时性错误会按退避重试
+func (r *MilvusRetriever) withRetry(ctx context.Context, op string, fn func() error) error {
+	cfg := r.config.Snapshot()
+	if err := r.breaker.allow(); err != nil {
+		return err
+	}
+
+	var err error
+	backoff := cfg.MilvusRetryBackoff
+	for attempt := 0; attempt <= cfg.MilvusMaxRetries; attempt++ {
+		if attempt > 0 {
+			r.logger.Warn("Retrying Milvus operation",
+				zap.String("op", op),
+				zap.Int("attempt", attempt),
+				zap.Error(err))
+
+			select {
+			case <-ctx.Done():
+				r.breaker.failure()
+				return err
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		err = fn()
+		if err == nil {
+			r.breaker.success()
+			return nil
+		}
+		if !isTransientError(err) || ctx.Err() != nil {
+			break
+		}
+	}
+
+	// 只有临时性错误计入熔断，参数错误等不影响熔断状态
+	if isTransientError(err) {
+		r.breaker.failure()
+	} else {
+		r.breaker.success()
+	}
+	return err
+}
+
 // Close 关闭连接
 func (r *MilvusRetriever) Close() error {
+	r.unsubscribe()
 	r.cancel()
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -461,31 +816,91 @@ func (r *MilvusRetriever) IsConnected() bool {
 	return r.isConnected
 }
 
+// Status 返回连接状态和重连退避状态
+func (r *MilvusRetriever) Status() MilvusStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return MilvusStatus{
+		Connected:   r.isConnected,
+		BreakerOpen: r.breaker.isOpen(),
+		RetryDelay:  r.retryDelay,
+		NextRetryAt: r.nextRetryAt,
+		LastError:   r.lastError,
+	}
+}
+
+// ResetBackoff 把重连间隔重置为最小值并立即触发一次重连检查
+// Milvus 恢复后重连循环可能仍在长时间退避中，运维修复后调用此方法即可尽快恢复
+func (r *MilvusRetriever) ResetBackoff() {
+	r.mu.Lock()
+	r.retryDelay = minRetryDelay
+	r.mu.Unlock()
+
+	r.logger.Info("Milvus reconnect backoff reset, triggering immediate reconnect attempt")
+	// 已有未处理的触发信号时无需重复发送
+	select {
+	case r.resetCh <- struct{}{}:
+	default:
+	}
+}
+
+// reconnect 标记为断开并立即触发重连，新连接使用当前配置，建立成功后替换旧连接
+func (r *MilvusRetriever) reconnect() {
+	r.mu.Lock()
+	r.isConnected = false
+	r.mu.Unlock()
+	r.ResetBackoff()
+}
+
+// milvusConnectionChanged 判断建立连接使用的配置是否发生变化
+func milvusConnectionChanged(old, updated *config.Config) bool {
+	return old.MilvusAddress != updated.MilvusAddress ||
+		old.MilvusUsername != updated.MilvusUsername ||
+		old.MilvusPassword != updated.MilvusPassword ||
+		old.MilvusToken != updated.MilvusToken ||
+		old.MilvusTLS != updated.MilvusTLS
+}
+
+// setNextCheck 记录下一次健康检查或重连的时间
+func (r *MilvusRetriever) setNextCheck(delay time.Duration) {
+	r.mu.Lock()
+	r.nextRetryAt = time.Now().Add(delay)
+	r.mu.Unlock()
+}
+
 // connect 连接到Milvus
 func (r *MilvusRetriever) connect() error {
-	ctx, cancel := context.WithTimeout(r.ctx, r.config.MilvusConnectTimeout)
+	cfg := r.config.Snapshot()
+	ctx, cancel := context.WithTimeout(r.ctx, cfg.MilvusConnectTimeout)
 	defer cancel()
 
 	// 配置gRPC连接选项
 	keepaliveParams := keepalive.ClientParameters{
-		Time:                r.config.GRPCKeepaliveTime,
-		Timeout:             r.config.GRPCKeepaliveTimeout,
+		Time:                cfg.GRPCKeepaliveTime,
+		Timeout:             cfg.GRPCKeepaliveTimeout,
 		PermitWithoutStream: true,
 	}
 
-	// 创建Milvus客户端
+	// 创建Milvus客户端，凭据不写入日志
+	address := config.RedactURL(cfg.MilvusAddress)
 	r.logger.Info("Connecting to Milvus", 
-		zap.String("address", r.config.MilvusAddress),
-		zap.String("collection", r.collectionName))
+		zap.String("address", address),
+		zap.String("collection", r.collectionName),
+		zap.Bool("auth", cfg.MilvusToken != "" || cfg.MilvusUsername != ""),
+		zap.Bool("tls", cfg.MilvusTLS))
 	
 	c, err := client.NewClient(ctx, client.Config{
-		Address: r.config.MilvusAddress,
+		Address:       cfg.MilvusAddress,
+		Username:      cfg.MilvusUsername,
+		Password:      cfg.MilvusPassword,
+		APIKey:        cfg.MilvusToken,
+		EnableTLSAuth: cfg.MilvusTLS,
 		DialOptions: []grpc.DialOption{
 			grpc.WithKeepaliveParams(keepaliveParams),
 		},
 	})
 	if err != nil {
-		return fmt.Errorf("failed to connect to Milvus at %s: %w", r.config.MilvusAddress, err)
+		return fmt.Errorf("failed to connect to Milvus at %s: %w", address, err)
 	}
 
 	// 确保集合存在
@@ -502,60 +917,106 @@ func (r *MilvusRetriever) connect() error {
 	r.client = c
 	r.isConnected = true
 	r.mu.Unlock()
+	r.resetPartitions()
 
 	r.logger.Info("Successfully connected to Milvus", 
-		zap.String("address", r.config.MilvusAddress))
+		zap.String("address", address))
 
 	return nil
 }
 
+// defaultHealthCheckInterval 未配置 MILVUS_HEALTH_CHECK_INTERVAL 时已连接状态的健康检查间隔
+const defaultHealthCheckInterval = 30 * time.Second
+
+// MilvusCheckDelay 返回重连循环下一次检查前的等待时间
+// 已连接时按配置的健康检查间隔检查连接，断开时按当前的退避间隔 backoff 重连
+func MilvusCheckDelay(connected bool, backoff time.Duration, cfg *config.Config) time.Duration {
+	if !connected {
+		return backoff
+	}
+	if cfg.MilvusHealthCheckInterval <= 0 {
+		return defaultHealthCheckInterval
+	}
+	return cfg.MilvusHealthCheckInterval
+}
+
 // reconnectLoop 重连循环
+// 已连接时定期检查连接健康状态，连接断开时按指数退避重试，ResetBackoff 可以打断当前等待并立即检查
 func (r *MilvusRetriever) reconnectLoop() {
-	retryDelay := time.Second
-	maxRetryDelay := 5 * time.Minute
-
 	for {
+		r.mu.RLock()
+		retryDelay := r.retryDelay
+		connected := r.isConnected
+		r.mu.RUnlock()
+		delay := MilvusCheckDelay(connected, retryDelay, r.config.Snapshot())
+		r.setNextCheck(delay)
+
+		timer := time.NewTimer(delay)
 		select {
 		case <-r.ctx.Done():
+			timer.Stop()
 			return
-		case <-time.After(retryDelay):
-			if !r.IsConnected() {
-				r.logger.Info("Attempting to reconnect to Milvus", 
-					zap.Duration("retry_delay", retryDelay))
-				
-				if err := r.connect(); err != nil {
-					r.logger.Error("Failed to reconnect to Milvus", 
-						zap.Error(err),
-						zap.Duration("next_retry", retryDelay*2))
-					
-					// 指数退避
-					retryDelay = retryDelay * 2
-					if retryDelay > maxRetryDelay {
-						retryDelay = maxRetryDelay
-					}
-				} else {
-					// 重连成功，重置延迟
-					retryDelay = time.Second
+		case <-r.resetCh:
+			timer.Stop()
+			retryDelay = minRetryDelay
+		case <-timer.C:
+		}
+
+		if !r.IsConnected() {
+			r.logger.Info("Attempting to reconnect to Milvus",
+				zap.Duration("retry_delay", retryDelay))
+
+			if err := r.connect(); err != nil {
+				// 指数退避
+				retryDelay = retryDelay * 2
+				if retryDelay > maxRetryDelay {
+					retryDelay = maxRetryDelay
 				}
+				r.logger.Error("Failed to reconnect to Milvus",
+					zap.Error(err),
+					zap.Duration("next_retry", retryDelay))
+
+				r.mu.Lock()
+				r.retryDelay = retryDelay
+				r.lastError = err.Error()
+				r.mu.Unlock()
 			} else {
-				// 已连接，检查连接健康状态
-				ctx, cancel := context.WithTimeout(r.ctx, 5*time.Second)
-				r.mu.RLock()
-				client := r.client
-				r.mu.RUnlock()
-				
-				if client != nil {
-					// 简单的健康检查
-					if _, err := client.HasCollection(ctx, r.collectionName); err != nil {
-						r.logger.Warn("Health check failed, marking as disconnected", 
-							zap.Error(err))
-						r.mu.Lock()
-						r.isConnected = false
-						r.mu.Unlock()
-					}
-				}
-				cancel()
+				// 重连成功，重置延迟
+				r.mu.Lock()
+				r.retryDelay = minRetryDelay
+				r.lastError = ""
+				r.mu.Unlock()
 			}
+		} else {
+			r.checkHealth()
 		}
 	}
 }
+
+// checkHealth 检查已建立的连接，失败时标记为断开，由重连循环按退避间隔重连
+func (r *MilvusRetriever) checkHealth() {
+	timeout := r.config.Snapshot().MilvusHealthCheckTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(r.ctx, timeout)
+	defer cancel()
+
+	r.mu.RLock()
+	client := r.client
+	r.mu.RUnlock()
+	if client == nil {
+		return
+	}
+
+	// 简单的健康检查
+	if _, err := client.HasCollection(ctx, r.collectionName); err != nil {
+		r.logger.Warn("Health check failed, marking as disconnected",
+			zap.Duration("timeout", timeout),
+			zap.Error(err))
+		r.mu.Lock()
+		r.isConnected = false
+		r.retryDelay = minRetryDelay
+		r.mu.Unlock()
+	}
+}
@@ -0,0 +1,150 @@
+package rag
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"eino-rag/internal/config"
+
+	"github.com/milvus-io/milvus-sdk-go/v2/entity"
+)
+
+// ivfNlist 创建IVF索引时的聚类数，nprobe 不能超过该值
+const ivfNlist = 1024
+
+// maxHNSWEf Milvus 允许的最大 ef
+const maxHNSWEf = 32768
+
+// fallbackNprobe 配置的 nprobe 无效时使用的值
+const fallbackNprobe = 16
+
+// hnswM 创建HNSW索引时每个节点的最大连接数
+const hnswM = 16
+
+// hnswEfConstruction 创建HNSW索引时的候选集大小
+const hnswEfConstruction = 200
+
+// ErrInvalidSearchEffort 检索力度超出当前索引类型允许的范围
+var ErrInvalidSearchEffort = errors.New("invalid search effort")
+
+// ErrInvalidIndexType 配置的索引类型无法识别
+var ErrInvalidIndexType = errors.New("invalid index type")
+
+// ParseIndexType 规范化配置的索引类型，空字符串表示 IVF_FLAT
+// INDEX_TYPE 决定创建集合时的索引和检索时的参数，与 METRIC_TYPE 一样在创建集合时确定，修改后需要重建集合
+func ParseIndexType(name string) (string, error) {
+	indexType := strings.ToUpper(strings.TrimSpace(name))
+	switch indexType {
+	case "":
+		return "IVF_FLAT", nil
+	case "FLAT", "IVF_FLAT", "IVF_SQ8", "IVF_PQ", "HNSW":
+		return indexType, nil
+	default:
+		return "", fmt.Errorf("%w: %q, must be one of FLAT, IVF_FLAT, IVF_SQ8, IVF_PQ, HNSW", ErrInvalidIndexType, name)
+	}
+}
+
+// indexType 返回配置的索引类型，无法识别时按 IVF_FLAT 处理（创建检索器时已校验）
+func indexType(name string) string {
+	parsed, err := ParseIndexType(name)
+	if err != nil {
+		return "IVF_FLAT"
+	}
+	return parsed
+}
+
+// pqSubQuantizers IVF_PQ 的子向量数，必须整除向量维度
+func pqSubQuantizers(dim int) int {
+	for _, m := range []int{64, 32, 16, 8, 4, 2} {
+		if dim > 0 && dim%m == 0 {
+			return m
+		}
+	}
+	return 1
+}
+
+// vectorIndex 按配置的索引类型和度量构建向量字段的索引定义
+func vectorIndex(cfg *config.Config, metric entity.MetricType) (entity.Index, error) {
+	switch indexType(cfg.IndexType) {
+	case "FLAT":
+		return entity.NewIndexFlat(metric)
+	case "IVF_SQ8":
+		return entity.NewIndexIvfSQ8(metric, ivfNlist)
+	case "IVF_PQ":
+		return entity.NewIndexIvfPQ(metric, ivfNlist, pqSubQuantizers(cfg.VectorDimension), 8)
+	case "HNSW":
+		return entity.NewIndexHNSW(metric, hnswM, hnswEfConstruction)
+	default:
+		return entity.NewIndexIvfFlat(metric, ivfNlist)
+	}
+}
+
+// 检索力度（search effort）决定查询时扫描的范围：
+//   - IVF 类索引对应 nprobe，即查询的聚类数，范围 [1, nlist]
+//   - HNSW 对应 ef，即候选集大小，范围 [topK, 32768]
+//   - FLAT 等精确检索没有可调参数，忽略该值
+//
+// 值越大召回率越高，但延迟和CPU开销随之增加；值越小查询越快，但可能漏掉相关结果。
+
+// DefaultSearchEffort 返回配置的索引类型对应的默认检索力度，不支持调节时返回0
+func DefaultSearchEffort(cfg *config.Config) int {
+	switch indexType(cfg.IndexType) {
+	case "IVF_FLAT", "IVF_SQ8", "IVF_PQ":
+		return cfg.MilvusSearchNprobe
+	case "HNSW":
+		return cfg.MilvusSearchEf
+	default:
+		return 0
+	}
+}
+
+// ValidateSearchEffort 检查请求指定的检索力度是否在索引类型允许的范围内，effort <= 0 表示使用默认值
+func ValidateSearchEffort(configuredType string, effort, topK int) error {
+	if effort <= 0 {
+		return nil
+	}
+
+	switch indexType(configuredType) {
+	case "IVF_FLAT", "IVF_SQ8", "IVF_PQ":
+		if effort > ivfNlist {
+			return fmt.Errorf("%w: nprobe must be between 1 and %d", ErrInvalidSearchEffort, ivfNlist)
+		}
+	case "HNSW":
+		if effort < topK || effort > maxHNSWEf {
+			return fmt.Errorf("%w: ef must be between top_k (%d) and %d", ErrInvalidSearchEffort, topK, maxHNSWEf)
+		}
+	}
+	return nil
+}
+
+// buildSearchParam 按索引类型构建搜索参数
+// 请求指定的 effort 超出范围时报错；effort <= 0 时使用配置的默认值，默认值按 topK 和索引允许的范围调整，不会导致检索失败
+func buildSearchParam(cfg *config.Config, effort, topK int) (entity.SearchParam, error) {
+	if err := ValidateSearchEffort(cfg.IndexType, effort, topK); err != nil {
+		return nil, err
+	}
+	if effort <= 0 {
+		effort = DefaultSearchEffort(cfg)
+	}
+
+	nprobe := effort
+	if nprobe <= 0 {
+		nprobe = fallbackNprobe
+	}
+	nprobe = min(nprobe, ivfNlist)
+	ef := min(max(effort, topK), maxHNSWEf)
+
+	switch indexType(cfg.IndexType) {
+	case "IVF_FLAT":
+		return entity.NewIndexIvfFlatSearchParam(nprobe)
+	case "IVF_SQ8":
+		return entity.NewIndexIvfSQ8SearchParam(nprobe)
+	case "IVF_PQ":
+		return entity.NewIndexIvfPQSearchParam(nprobe)
+	case "HNSW":
+		return entity.NewIndexHNSWSearchParam(ef)
+	default:
+		return entity.NewIndexFlatSearchParam()
+	}
+}
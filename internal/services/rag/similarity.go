@@ -0,0 +1,26 @@
+package rag
+
+import "math"
+
+// CosineSimilarity 计算两个向量的余弦相似度，维度不同或存在零向量时返回0
+func CosineSimilarity(a, b []float32) float64 {
+	return cosineSimilarity(a, b)
+}
+
+// cosineSimilarity 计算 float32 或 float64 向量的余弦相似度
+func cosineSimilarity[T float32 | float64](a, b []T) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,90 @@
+package rag
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// ErrVectorStoreUnavailable 向量库未配置或未连接，与检索没有结果区分
+var ErrVectorStoreUnavailable = errors.New("vector search is not available")
+
+// IsVectorStoreUnavailable 判断检索错误是否因为向量库不可用（未连接或熔断中）
+func IsVectorStoreUnavailable(err error) bool {
+	return errors.Is(err, ErrVectorStoreUnavailable) || errors.Is(err, ErrCircuitOpen)
+}
+
+// Retriever 向量存储与检索接口，文档服务通过该接口读写向量库
+// 生产环境使用 MilvusRetriever，测试和无向量库的本地环境可使用 MemoryRetriever
+type Retriever interface {
+	AddDocuments(ctx context.Context, docs []*schema.Document, kbID, docID uint) error
+	AddDocumentsWithOptions(ctx context.Context, docs []*schema.Document, kbID, docID uint, opts AddOptions) (*AddResult, error)
+	RetrieveWithOptions(ctx context.Context, query string, kbID uint, opts RetrieveOptions) ([]*schema.Document, error)
+	DeleteByKnowledgeBase(ctx context.Context, kbID uint) error
+	DeleteByDocument(ctx context.Context, docID uint) error
+}
+
+// VectorInventory 能够按文档盘点向量的存储，SQL 与向量库的一致性检查使用
+type VectorInventory interface {
+	// DocumentsWithVectors 返回 docIDs 中至少有一个向量的文档ID
+	DocumentsWithVectors(ctx context.Context, docIDs []uint) ([]uint, error)
+	// OrphanDocuments 返回向量库中存在向量、但不在 known 中的文档ID
+	OrphanDocuments(ctx context.Context, known []uint) ([]uint, error)
+	DeleteByDocument(ctx context.Context, docID uint) error
+}
+
+// VectorExporter 能够按分块ID读取向量的存储，分块导出使用
+type VectorExporter interface {
+	// ChunkEmbeddings 返回 chunkIDs 中存在的分块的向量，按分块ID索引
+	ChunkEmbeddings(ctx context.Context, chunkIDs []string) (map[string][]float32, error)
+}
+
+// FailoverReporter 能报告是否正在使用备用嵌入服务，备用服务的向量与主服务的向量不可比较，期间不使用依赖向量的缓存
+type FailoverReporter interface {
+	EmbeddingFailingOver() bool
+}
+
+// Embedder 将文本转换为向量，检索器用它生成分块和查询的向量，语义缓存用它计算问题的向量
+// 由 EMBEDDING_PROVIDER 选择实现：EmbeddingService（Ollama）或 OpenAIEmbedder，见 NewEmbedder
+type Embedder interface {
+	EmbedText(ctx context.Context, text string) ([]float32, error)
+	// EmbedTexts 批量生成向量，结果与 texts 顺序一致
+	EmbedTexts(ctx context.Context, texts []string) ([][]float32, error)
+	// GetDimension 返回配置的向量维度
+	GetDimension() int
+}
+
+// ModelEmbedder 能够使用指定模型生成向量的嵌入服务，模型对比使用
+type ModelEmbedder interface {
+	EmbedWithModel(ctx context.Context, model, text string) ([]float32, error)
+}
+
+// DimensionChecker 能够在模型返回的维度与配置不一致时自动采用新维度的嵌入服务，检索器为其设置检查
+type DimensionChecker interface {
+	SetDimensionCheck(check DimensionCheck)
+}
+
+// EmbeddingStatusReporter 能报告当前使用的服务和模型的嵌入服务
+type EmbeddingStatusReporter interface {
+	Status() EmbeddingStatus
+}
+
+var (
+	_ Retriever        = (*MilvusRetriever)(nil)
+	_ Retriever        = (*MemoryRetriever)(nil)
+	_ VectorInventory  = (*MilvusRetriever)(nil)
+	_ VectorInventory  = (*MemoryRetriever)(nil)
+	_ VectorExporter   = (*MilvusRetriever)(nil)
+	_ VectorExporter   = (*MemoryRetriever)(nil)
+	_ Embedder         = (*EmbeddingService)(nil)
+	_ Embedder         = (*OpenAIEmbedder)(nil)
+	_ ModelEmbedder    = (*EmbeddingService)(nil)
+	_ ModelEmbedder    = (*OpenAIEmbedder)(nil)
+	_ DimensionChecker = (*EmbeddingService)(nil)
+	_ FailoverReporter = (*EmbeddingService)(nil)
+	_ FailoverReporter = (*MilvusRetriever)(nil)
+
+	_ EmbeddingStatusReporter = (*EmbeddingService)(nil)
+	_ EmbeddingStatusReporter = (*OpenAIEmbedder)(nil)
+)
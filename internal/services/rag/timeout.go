@@ -0,0 +1,76 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 阶段超时
+//
+// 切分、向量化、写入、检索和生成各有超时配置（INDEX_TIMEOUT、EMBEDDING_TIMEOUT、MILVUS_INSERT_TIMEOUT、
+// MILVUS_SEARCH_TIMEOUT、OPENAI_TIMEOUT）。超时触发时返回 *TimeoutError，标明超时的阶段和时长，
+// 接口据此返回 504 而不是 500，客户端可以区分超时和其他错误并决定是否重试。
+// 调用方的上下文已结束（请求整体超时或客户端断开）时不属于阶段超时，错误原样返回。
+
+// Stage 处理阶段
+type Stage string
+
+const (
+	StageChunking   Stage = "chunking"
+	StageEmbedding  Stage = "embedding"
+	StageInsert     Stage = "vector insert"
+	StageSearch     Stage = "vector search"
+	StageGeneration Stage = "generation"
+)
+
+// TimeoutError 某个处理阶段超时
+type TimeoutError struct {
+	Stage   Stage
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s: %v", e.Stage, e.Timeout, e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// IsTimeout 判断错误是否由超时引起，包括上下文超时、网络超时和gRPC的 DeadlineExceeded
+func IsTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	return errors.As(err, &grpcErr) && grpcErr.GRPCStatus().Code() == codes.DeadlineExceeded
+}
+
+// WrapTimeout 错误由本阶段的超时引起时包装为 TimeoutError
+// ctx 为调用方的上下文，它已结束时说明不是本阶段超时；已经标明阶段的错误和其他错误原样返回
+func WrapTimeout(ctx context.Context, stage Stage, timeout time.Duration, err error) error {
+	if !IsTimeout(err) || ctx.Err() != nil {
+		return err
+	}
+	var timeoutErr *TimeoutError
+	if errors.As(err, &timeoutErr) {
+		return err
+	}
+	return &TimeoutError{Stage: stage, Timeout: timeout, Err: err}
+}
@@ -0,0 +1,78 @@
+package auth_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/auth"
+)
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	policy := auth.PasswordPolicy{
+		MinLength:    8,
+		RequireUpper: true,
+		RequireLower: true,
+		RequireDigit: true,
+	}
+
+	assert.NoError(t, policy.Validate("Secret123"))
+
+	err := policy.Validate("secret")
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, auth.ErrWeakPassword))
+
+	var policyErr *auth.PasswordPolicyError
+	require.True(t, errors.As(err, &policyErr))
+	assert.Equal(t, []string{
+		"password must be at least 8 characters",
+		"password must contain an uppercase letter",
+		"password must contain a digit",
+	}, policyErr.Violations)
+}
+
+func TestPasswordPolicy_Symbol(t *testing.T) {
+	policy := auth.PasswordPolicy{MinLength: 8, RequireSymbol: true}
+
+	assert.Error(t, policy.Validate("password1"))
+	assert.NoError(t, policy.Validate("pass-word"))
+}
+
+func TestPasswordPolicy_LengthCountsCharacters(t *testing.T) {
+	policy := auth.PasswordPolicy{MinLength: 8}
+
+	// 多字节字符按字符数计算长度
+	assert.Error(t, policy.Validate("密码密码密码"))
+	assert.NoError(t, policy.Validate("密码密码密码密码"))
+
+	// 超过 bcrypt 的72字节上限
+	assert.Error(t, policy.Validate(strings.Repeat("a", 73)))
+}
+
+func TestPasswordPolicy_GeneratePassword(t *testing.T) {
+	policy := auth.PasswordPolicy{
+		MinLength:     20,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		password, err := policy.GeneratePassword()
+		require.NoError(t, err)
+		assert.Len(t, password, 20)
+		assert.NoError(t, policy.Validate(password))
+		assert.False(t, seen[password], "generated passwords should not repeat")
+		seen[password] = true
+	}
+
+	// 未要求更长时使用默认长度
+	password, err := auth.PasswordPolicy{MinLength: 8}.GeneratePassword()
+	require.NoError(t, err)
+	assert.Len(t, password, 16)
+}
@@ -0,0 +1,53 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"eino-rag/internal/config"
+)
+
+func TestValidateOpenAIBaseURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		allowed []string
+		wantErr bool
+	}{
+		{name: "empty uses default endpoint", url: ""},
+		{name: "https without allowlist", url: "https://api.example.com/v1"},
+		{name: "http without allowlist", url: "http://api.example.com/v1", wantErr: true},
+		{name: "no host", url: "https:///v1", wantErr: true},
+		{name: "unsupported scheme", url: "ftp://api.example.com", allowed: []string{"api.example.com"}, wantErr: true},
+		{name: "allowed host", url: "https://api.openai.com/v1", allowed: []string{"api.openai.com"}},
+		{name: "host not allowed", url: "https://evil.example.net/v1", allowed: []string{"api.openai.com"}, wantErr: true},
+		{name: "wildcard subdomain", url: "https://eastus.openai.azure.com", allowed: []string{"*.openai.azure.com"}},
+		{name: "wildcard does not match apex", url: "https://openai.azure.com", allowed: []string{"*.openai.azure.com"}, wantErr: true},
+		{name: "http for listed host", url: "http://llm.internal:8000/v1", allowed: []string{"llm.internal"}},
+		{name: "http for wildcard host", url: "http://a.llm.internal/v1", allowed: []string{"*.llm.internal"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := config.ValidateOpenAIBaseURL(tt.url, tt.allowed)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, config.ErrOpenAIBaseURLNotAllowed)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestUpdateFromDB_IgnoresDisallowedBaseURL(t *testing.T) {
+	cfg := config.Load()
+	cfg.OpenAIAllowedHosts = []string{"api.openai.com"}
+	cfg.OpenAIBaseURL = ""
+
+	config.UpdateFromDB(map[string]string{"openai_base_url": "https://evil.example.net/v1"})
+	assert.Empty(t, cfg.OpenAIBaseURL)
+
+	config.UpdateFromDB(map[string]string{"openai_base_url": "https://api.openai.com/v1"})
+	assert.Equal(t, "https://api.openai.com/v1", cfg.OpenAIBaseURL)
+}
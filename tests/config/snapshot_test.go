@@ -0,0 +1,73 @@
+package config_test
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/config"
+)
+
+// 使用 go test -race 运行时可以发现读取配置和 UpdateFromDB 之间的数据竞争
+func TestSnapshot_ConcurrentReadUpdate(t *testing.T) {
+	cfg := config.Load()
+	config.UpdateFromDB(map[string]string{"top_k": "3", "chunk_size": "300"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				topK := 3 + 4*((i+j)%2)
+				config.UpdateFromDB(map[string]string{
+					"top_k":      strconv.Itoa(topK),
+					"chunk_size": strconv.Itoa(topK * 100),
+				})
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				// 同一次更新写入的配置项在快照中总是一致的
+				snapshot := cfg.Snapshot()
+				assert.Equal(t, snapshot.TopK*100, snapshot.ChunkSize)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSnapshot_IsIndependentCopy(t *testing.T) {
+	cfg := config.Load()
+	config.UpdateFromDB(map[string]string{"top_k": "5", "allowed_file_types": ".txt,.md"})
+
+	snapshot := cfg.Snapshot()
+	snapshot.AllowedFileTypes[0] = ".exe"
+	config.UpdateFromDB(map[string]string{"top_k": "9"})
+
+	assert.Equal(t, 5, snapshot.TopK)
+	assert.Equal(t, ".txt", cfg.Snapshot().AllowedFileTypes[0])
+}
+
+func TestSubscribe(t *testing.T) {
+	config.Load()
+	config.UpdateFromDB(map[string]string{"top_k": "5"})
+
+	var calls [][2]int
+	unsubscribe := config.Subscribe(func(old, updated *config.Config) {
+		calls = append(calls, [2]int{old.TopK, updated.TopK})
+	})
+
+	config.UpdateFromDB(map[string]string{"top_k": "8"})
+	// 没有变化时不通知
+	config.UpdateFromDB(map[string]string{"top_k": "8"})
+	unsubscribe()
+	config.UpdateFromDB(map[string]string{"top_k": "5"})
+
+	require.Len(t, calls, 1)
+	assert.Equal(t, [2]int{5, 8}, calls[0])
+}
@@ -0,0 +1,139 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/auth"
+	"eino-rag/internal/db"
+	"eino-rag/internal/handlers"
+	"eino-rag/internal/middleware"
+	"eino-rag/internal/models"
+	"eino-rag/tests/testutil"
+)
+
+// apiKeyRouter 与 main.go 相同的认证中间件和API密钥接口，另加一个需要上传权限的接口
+func apiKeyRouter(h *testutil.Harness) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	authHandler := handlers.NewAuthHandler(h.Logger)
+	router := gin.New()
+	authorized := router.Group("", middleware.AuthMiddleware())
+	authorized.POST("/api-keys", authHandler.CreateAPIKey)
+	authorized.GET("/api-keys", authHandler.ListAPIKeys)
+	authorized.DELETE("/api-keys/:id", authHandler.DeleteAPIKey)
+	authorized.POST("/upload", middleware.RequirePermission(auth.PermissionUploadDoc), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.GetUint("user_id"), "role_name": c.GetString("role_name")})
+	})
+	return router
+}
+
+// serveWithKey 使用 X-API-Key 请求接口，返回状态码和响应体
+func serveWithKey(router *gin.Engine, key, method, path string, body interface{}) (int, []byte) {
+	var payload bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&payload).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec.Code, rec.Body.Bytes()
+}
+
+func TestAPIKey_Lifecycle(t *testing.T) {
+	h := testutil.New(t)
+	router := apiKeyRouter(h)
+
+	_, bootstrap, err := auth.CreateAPIKey(h.AdminID, "bootstrap")
+	require.NoError(t, err)
+
+	// 使用密钥创建新密钥，明文只在创建时返回
+	code, body := serveWithKey(router, bootstrap, http.MethodPost, "/api-keys", models.CreateAPIKeyRequest{Name: "ci"})
+	require.Equal(t, http.StatusCreated, code, string(body))
+	var created struct {
+		Data models.CreateAPIKeyResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(body, &created))
+	key := created.Data.Key
+	assert.Equal(t, "ci", created.Data.Name)
+	assert.Equal(t, key[:len(created.Data.Prefix)], created.Data.Prefix)
+
+	// 数据库只保存哈希
+	var stored models.APIKey
+	require.NoError(t, db.GetDB().First(&stored, created.Data.ID).Error)
+	assert.Equal(t, auth.HashAPIKey(key), stored.KeyHash)
+	assert.NotContains(t, stored.KeyHash, key)
+	assert.Nil(t, stored.LastUsedAt)
+
+	// 密钥解析为所属用户和角色，权限检查照常生效
+	code, body = serveWithKey(router, key, http.MethodPost, "/upload", nil)
+	require.Equal(t, http.StatusOK, code, string(body))
+	assert.JSONEq(t, fmt.Sprintf(`{"user_id":%d,"role_name":"admin"}`, h.AdminID), string(body))
+	require.NoError(t, db.GetDB().First(&stored, created.Data.ID).Error)
+	require.NotNil(t, stored.LastUsedAt)
+
+	// 一分钟内再次使用不更新最后使用时间
+	lastUsed := *stored.LastUsedAt
+	code, _ = serveWithKey(router, key, http.MethodPost, "/upload", nil)
+	require.Equal(t, http.StatusOK, code)
+	require.NoError(t, db.GetDB().First(&stored, created.Data.ID).Error)
+	assert.True(t, lastUsed.Equal(*stored.LastUsedAt))
+
+	// 列表不包含明文和哈希
+	code, body = serveWithKey(router, key, http.MethodGet, "/api-keys", nil)
+	require.Equal(t, http.StatusOK, code)
+	assert.NotContains(t, string(body), key)
+	assert.NotContains(t, string(body), stored.KeyHash)
+	var list struct {
+		Data handlers.APIKeyListResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(body, &list))
+	assert.Len(t, list.Data.APIKeys, 2)
+
+	// 撤销后立即失效
+	code, _ = serveWithKey(router, bootstrap, http.MethodDelete, fmt.Sprintf("/api-keys/%d", created.Data.ID), nil)
+	require.Equal(t, http.StatusOK, code)
+	code, _ = serveWithKey(router, key, http.MethodGet, "/api-keys", nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = serveWithKey(router, "erk_not-a-real-key", http.MethodGet, "/api-keys", nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestAPIKey_OwnerAndRole(t *testing.T) {
+	h := testutil.New(t)
+	router := apiKeyRouter(h)
+
+	var guestRole models.Role
+	require.NoError(t, db.GetDB().Where("name = ?", "guest").First(&guestRole).Error)
+	guest := &models.User{Name: "Guest", Email: "guest@example.com", Password: "x", RoleID: guestRole.ID, Status: "active"}
+	require.NoError(t, db.GetDB().Create(guest).Error)
+
+	adminKey, _, err := auth.CreateAPIKey(h.AdminID, "admin")
+	require.NoError(t, err)
+	_, guestKey, err := auth.CreateAPIKey(guest.ID, "guest")
+	require.NoError(t, err)
+
+	// 密钥继承所属用户的角色权限
+	code, _ := serveWithKey(router, guestKey, http.MethodPost, "/upload", nil)
+	assert.Equal(t, http.StatusForbidden, code)
+
+	// 不能撤销别人的密钥
+	code, _ = serveWithKey(router, guestKey, http.MethodDelete, fmt.Sprintf("/api-keys/%d", adminKey.ID), nil)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// 用户被禁用后密钥失效
+	require.NoError(t, db.GetDB().Model(guest).Update("status", "inactive").Error)
+	code, _ = serveWithKey(router, guestKey, http.MethodGet, "/api-keys", nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
@@ -0,0 +1,176 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/handlers"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/chat"
+	"eino-rag/tests/testutil"
+)
+
+// branchRouter 编辑消息和旧分支接口，请求头 X-User-ID 和 X-Role 指定当前用户
+func branchRouter(t *testing.T, h *testutil.Harness) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	service, err := chat.NewService(h.Documents, nil, h.Config, h.Logger)
+	require.NoError(t, err)
+	chatHandler := handlers.NewChatHandler(service, h.Logger)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		var userID uint
+		fmt.Sscan(c.GetHeader("X-User-ID"), &userID)
+		c.Set("user_id", userID)
+		c.Set("role_name", c.GetHeader("X-Role"))
+	})
+	router.PUT("/conversations/:id/messages/:index", chatHandler.EditMessage)
+	router.GET("/conversations/:id/branches", chatHandler.ListBranches)
+	return router
+}
+
+// seedConversation 保存两轮对话，回复使用 kbID 检索
+func seedConversation(t *testing.T, convID string, userID, kbID uint) *models.Conversation {
+	t.Helper()
+	retrieval := &models.RetrievalParams{KnowledgeBaseID: kbID, TopK: 3}
+	conv := &models.Conversation{ID: convID, UserID: userID, CreatedAt: time.Now()}
+	_, err := db.AppendMessages(context.Background(), conv,
+		models.ChatMessage{Role: "user", Content: "first question", Seq: 1},
+		models.ChatMessage{Role: "assistant", Content: "first answer", Retrieval: retrieval, Seq: 2},
+		models.ChatMessage{Role: "user", Content: "second question", Seq: 3},
+		models.ChatMessage{Role: "assistant", Content: "second answer", Retrieval: retrieval, Seq: 4},
+	)
+	require.NoError(t, err)
+	return conv
+}
+
+func messageSeqs(msgs []models.ChatMessage) []int64 {
+	seqs := make([]int64, len(msgs))
+	for i, msg := range msgs {
+		seqs[i] = msg.Seq
+	}
+	return seqs
+}
+
+func TestEditMessage_ReplacesTailAndKeepsBranch(t *testing.T) {
+	h := testutil.New(t)
+	server := testutil.NewRedis(t)
+	router := branchRouter(t, h)
+	kb := h.CreateKnowledgeBase(t, "kb")
+	seedConversation(t, "conv-edit", h.AdminID, kb.ID)
+
+	code, body := serveKB(router, h.AdminID, "admin", http.MethodPut, "/conversations/conv-edit/messages/2",
+		`{"content":"second question, edited","keep_branch":true}`)
+	require.Equal(t, http.StatusOK, code, body)
+	var edited struct {
+		Data handlers.EditMessageResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &edited))
+	require.Len(t, edited.Data.Messages, 4)
+	assert.Equal(t, []int64{1, 2, 5, 6}, messageSeqs(edited.Data.Messages))
+	assert.Equal(t, "second question, edited", edited.Data.Messages[2].Content)
+	assert.Equal(t, kb.ID, edited.Data.Messages[3].Retrieval.KnowledgeBaseID)
+	assert.NotZero(t, edited.Data.BranchID)
+
+	// 旧分支保存被替换的消息
+	code, body = serveKB(router, h.AdminID, "admin", http.MethodGet, "/conversations/conv-edit/branches", "")
+	require.Equal(t, http.StatusOK, code)
+	var branches struct {
+		Data handlers.ConversationBranchListResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &branches))
+	require.Len(t, branches.Data.Branches, 1)
+	assert.Equal(t, 2, branches.Data.Branches[0].FromIndex)
+	assert.Equal(t, []int64{3, 4}, messageSeqs(branches.Data.Branches[0].Messages))
+
+	// 其他用户看不到旧分支，也不能编辑
+	code, body = serveKB(router, h.AdminID+100, "user", http.MethodGet, "/conversations/conv-edit/branches", "")
+	require.Equal(t, http.StatusOK, code)
+	require.NoError(t, json.Unmarshal([]byte(body), &branches))
+	assert.Empty(t, branches.Data.Branches)
+	code, _ = serveKB(router, h.AdminID+100, "user", http.MethodPut, "/conversations/conv-edit/messages/0", `{"content":"x"}`)
+	assert.Equal(t, http.StatusForbidden, code)
+
+	// 编辑后的对话写入数据库，Redis中过期后可以恢复
+	var persisted int64
+	require.NoError(t, db.GetDB().Model(&models.ConversationMessage{}).Where("conversation_id = ?", "conv-edit").Count(&persisted).Error)
+	assert.EqualValues(t, 4, persisted)
+	server.FlushAll()
+	restored, err := db.GetConversation(context.Background(), "conv-edit")
+	require.NoError(t, err)
+	require.NotNil(t, restored)
+	assert.Equal(t, h.AdminID, restored.UserID)
+	assert.Equal(t, edited.Data.Messages[2].Content, restored.Messages[2].Content)
+	assert.Equal(t, []int64{1, 2, 5, 6}, messageSeqs(restored.Messages))
+}
+
+func TestEditMessage_RechecksKnowledgeBaseAccess(t *testing.T) {
+	h := testutil.New(t)
+	testutil.NewRedis(t)
+	router := branchRouter(t, h)
+	kb := h.CreateKnowledgeBase(t, "admin only")
+
+	// 原回复检索的知识库已不属于对话所属用户
+	other := &models.User{Name: "other", Email: "other@example.com", Password: "x"}
+	require.NoError(t, db.GetDB().Create(other).Error)
+	seedConversation(t, "conv-kb", other.ID, kb.ID)
+
+	code, _ := serveKB(router, other.ID, "user", http.MethodPut, "/conversations/conv-kb/messages/0",
+		`{"content":"edited","keep_branch":true}`)
+	assert.Equal(t, http.StatusForbidden, code)
+
+	// 对话和旧分支都没有变化
+	conv, err := db.GetConversation(context.Background(), "conv-kb")
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3, 4}, messageSeqs(conv.Messages))
+	var branches int64
+	require.NoError(t, db.GetDB().Model(&models.ConversationBranch{}).Where("conversation_id = ?", "conv-kb").Count(&branches).Error)
+	assert.Zero(t, branches)
+
+	code, _ = serveKB(router, other.ID, "user", http.MethodPut, "/conversations/conv-kb/messages/1", `{"content":"edited"}`)
+	assert.Equal(t, http.StatusBadRequest, code, "index must refer to a user message")
+}
+
+func TestReplaceMessages_KeepsConcurrentMessages(t *testing.T) {
+	h := testutil.New(t)
+	testutil.NewRedis(t)
+	ctx := context.Background()
+	snapshot := seedConversation(t, "conv-race", h.AdminID, 0)
+
+	// 编辑生成回复期间另一个请求追加了一轮对话
+	concurrent := &models.Conversation{ID: "conv-race", UserID: h.AdminID}
+	_, err := db.AppendMessages(ctx, concurrent,
+		models.ChatMessage{Role: "user", Content: "concurrent question", Seq: 5},
+		models.ChatMessage{Role: "assistant", Content: "concurrent answer", Seq: 6},
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, db.ReplaceMessages(ctx, snapshot, []int64{3, 4},
+		models.ChatMessage{Role: "user", Content: "edited", Seq: 7},
+		models.ChatMessage{Role: "assistant", Content: "regenerated", Seq: 8},
+	))
+	assert.Equal(t, []int64{1, 2, 5, 6, 7, 8}, messageSeqs(snapshot.Messages))
+
+	conv, err := db.GetConversation(ctx, "conv-race")
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 5, 6, 7, 8}, messageSeqs(conv.Messages))
+
+	// 对话已被删除时不会重新创建
+	require.NoError(t, db.DeleteConversations(ctx, "conv-race"))
+	require.NoError(t, db.GetDB().Where("conversation_id = ?", "conv-race").Delete(&models.ConversationMessage{}).Error)
+	err = db.ReplaceMessages(ctx, &models.Conversation{ID: "conv-race"}, []int64{1}, models.ChatMessage{Role: "user", Seq: 9})
+	require.Error(t, err)
+	conv, err = db.GetConversation(ctx, "conv-race")
+	require.NoError(t, err)
+	assert.Nil(t, conv)
+}
@@ -0,0 +1,95 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/handlers"
+	"eino-rag/internal/services/chat"
+	"eino-rag/tests/testutil"
+)
+
+// chatRequestAs 以指定角色调用聊天接口
+func chatRequestAs(t *testing.T, h *testutil.Harness, roleName, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	service, err := chat.NewService(h.Documents, nil, h.Config, h.Logger)
+	require.NoError(t, err)
+	chatHandler := handlers.NewChatHandler(service, h.Logger)
+
+	router := gin.New()
+	group := router.Group("/chat", func(c *gin.Context) {
+		c.Set("user_id", h.AdminID)
+		c.Set("role_name", roleName)
+	})
+	group.POST("", chatHandler.Chat)
+	group.POST("/stream", chatHandler.ChatStream)
+	group.POST("/trace", chatHandler.Trace)
+	group.POST("/conversations/:id/candidates/select", chatHandler.SelectCandidate)
+
+	payload, err := json.Marshal(body)
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestChatCandidates_RoleLimit(t *testing.T) {
+	h := testutil.New(t)
+	cfg := config.Get().Snapshot()
+	userLimit := min(cfg.MaxCandidatesUser, chat.MaxCandidates)
+
+	rec := chatRequestAs(t, h, "user", "/chat", map[string]interface{}{"message": "hi", "n": userLimit + 1})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "n exceeds the allowed limit")
+
+	// 管理员的上限同样不能超过硬上限
+	rec = chatRequestAs(t, h, "admin", "/chat", map[string]interface{}{"message": "hi", "n": chat.MaxCandidates + 1})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = chatRequestAs(t, h, "user", "/chat", map[string]interface{}{"message": "hi", "n": 0})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestChatCandidates_StreamRejectsMultiple(t *testing.T) {
+	h := testutil.New(t)
+
+	rec := chatRequestAs(t, h, "admin", "/chat/stream", map[string]interface{}{"message": "hi", "n": 2})
+	assert.Contains(t, rec.Body.String(), "only supported by non-streaming chat")
+}
+
+func TestChatCandidates_InvalidCount(t *testing.T) {
+	h := testutil.New(t)
+	service, err := chat.NewService(h.Documents, nil, h.Config, h.Logger)
+	require.NoError(t, err)
+
+	for _, n := range []int{1, chat.MaxCandidates + 1} {
+		_, err := service.ChatCandidates(context.Background(), "hi", "", h.AdminID, 0, false, chat.ChatOptions{}, n)
+		assert.ErrorIs(t, err, chat.ErrInvalidCandidateCount, "n=%d", n)
+	}
+}
+
+func TestSelectCandidate_RequiresSetAndIndex(t *testing.T) {
+	h := testutil.New(t)
+
+	for _, body := range []map[string]interface{}{
+		{"index": 0},
+		{"candidate_set_id": "set"},
+		{"candidate_set_id": "set", "index": -1},
+	} {
+		rec := chatRequestAs(t, h, "user", "/chat/conversations/conv/candidates/select", body)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "%v", body)
+	}
+}
@@ -0,0 +1,43 @@
+package handlers_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"eino-rag/internal/config"
+	"eino-rag/tests/testutil"
+)
+
+func TestChatGenerationParams_PenaltyRoleLimit(t *testing.T) {
+	h := testutil.New(t)
+	cfg := config.Get().Snapshot()
+	userLimit := min(cfg.MaxPenaltyUser, 2)
+	if userLimit >= 2 {
+		t.Skip("user penalty limit is not lower than the hard cap")
+	}
+
+	rec := chatRequestAs(t, h, "user", "/chat", map[string]interface{}{"message": "hi", "presence_penalty": userLimit + 0.5})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "presence_penalty must be between")
+
+	rec = chatRequestAs(t, h, "user", "/chat", map[string]interface{}{"message": "hi", "frequency_penalty": -(userLimit + 0.5)})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "frequency_penalty must be between")
+
+	// 超出接口取值范围的值在绑定时被拒绝
+	rec = chatRequestAs(t, h, "admin", "/chat", map[string]interface{}{"message": "hi", "presence_penalty": 2.5})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestChatGenerationParams_StopValidation(t *testing.T) {
+	h := testutil.New(t)
+
+	rec := chatRequestAs(t, h, "user", "/chat", map[string]interface{}{"message": "hi", "stop": []string{"a", "b", "c", "d", "e"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = chatRequestAs(t, h, "user", "/chat", map[string]interface{}{"message": "hi", "stop": []string{strings.Repeat("x", 51)}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
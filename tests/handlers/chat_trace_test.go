@@ -0,0 +1,69 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/handlers"
+	"eino-rag/internal/services/document"
+	"eino-rag/tests/testutil"
+)
+
+func TestChatTrace_ReturnsPipelineArtifacts(t *testing.T) {
+	h := testutil.New(t)
+	kb := h.CreateKnowledgeBase(t, "trace")
+	content := "Milvus is a vector database built for scalable similarity search."
+	_, _, err := h.Documents.UploadDocument(context.Background(), "milvus.txt", strings.NewReader(content), kb.ID, h.AdminID, document.UploadOptions{})
+	require.NoError(t, err)
+
+	rec := chatRequestAs(t, h, "admin", "/chat/trace", map[string]interface{}{
+		"message": "What is Milvus?",
+		"kb_id":   kb.ID,
+		"use_rag": true,
+	})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp struct {
+		Data handlers.ChatTraceResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	trace := resp.Data
+
+	assert.Equal(t, "What is Milvus?", trace.Query)
+	require.NotNil(t, trace.Retrieval)
+	assert.Equal(t, kb.ID, trace.Retrieval.KnowledgeBaseID)
+	require.NotEmpty(t, trace.Documents)
+	assert.Contains(t, trace.Documents[0].Content, "vector database")
+	assert.Contains(t, trace.Context, "vector database")
+
+	// 系统消息包含检索上下文，最后一条是本次问题
+	require.GreaterOrEqual(t, len(trace.Prompt), 2)
+	assert.Equal(t, "system", trace.Prompt[0].Role)
+	assert.Contains(t, trace.Prompt[0].Content, trace.Context)
+	last := trace.Prompt[len(trace.Prompt)-1]
+	assert.Equal(t, "user", last.Role)
+	assert.Equal(t, "What is Milvus?", last.Content)
+	assert.NotEmpty(t, trace.Answer)
+}
+
+func TestChatTrace_WithoutRAG(t *testing.T) {
+	h := testutil.New(t)
+
+	rec := chatRequestAs(t, h, "admin", "/chat/trace", map[string]interface{}{"message": "hi"})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp struct {
+		Data handlers.ChatTraceResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Nil(t, resp.Data.Retrieval)
+	assert.Empty(t, resp.Data.Documents)
+	assert.Empty(t, resp.Data.Context)
+	assert.Zero(t, resp.Data.RetrievalMs)
+}
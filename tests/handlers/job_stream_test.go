@@ -0,0 +1,115 @@
+package handlers_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/handlers"
+	"eino-rag/internal/jobs"
+)
+
+func newJobServer(t *testing.T, manager *jobs.Manager) *httptest.Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	sysHandler := handlers.NewSystemHandler(&config.Config{}, manager, nil, zap.NewNop())
+	router.GET("/jobs/:id/stream", sysHandler.StreamJob)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// readEvents 读取SSE流直到服务端关闭连接
+func readEvents(t *testing.T, resp *http.Response) []map[string]interface{} {
+	t.Helper()
+	var events []map[string]interface{}
+	scanner := bufio.NewScanner(resp.Body)
+	var raw strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		raw.WriteString(line + "\n")
+		if line == "" {
+			if strings.HasPrefix(raw.String(), "data: ") {
+				events = append(events, decodeSSE(t, raw.String()))
+			}
+			raw.Reset()
+		}
+	}
+	return events
+}
+
+func TestStreamJob_EndsWhenJobCompletes(t *testing.T) {
+	manager := jobs.NewManager(zap.NewNop())
+	step := make(chan struct{})
+	job := manager.Start("reindex", func(ctx context.Context, progress jobs.Reporter) (interface{}, error) {
+		progress.SetTotal(2)
+		for _, item := range []string{"document 1", "document 2"} {
+			<-step
+			progress.Advance(item, nil)
+		}
+		return nil, nil
+	})
+
+	server := newJobServer(t, manager)
+	resp, err := http.Get(server.URL + "/jobs/" + job.ID + "/stream")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	go func() {
+		step <- struct{}{}
+		step <- struct{}{}
+	}()
+
+	events := readEvents(t, resp)
+	require.GreaterOrEqual(t, len(events), 2)
+	assert.Equal(t, "progress", events[0]["type"])
+
+	last := events[len(events)-1]
+	assert.Equal(t, "end", last["type"])
+	data := last["data"].(map[string]interface{})
+	assert.Equal(t, "completed", data["status"])
+	assert.Equal(t, float64(2), data["processed"])
+	assert.Equal(t, float64(100), data["percent"])
+}
+
+func TestStreamJob_FailedJob(t *testing.T) {
+	manager := jobs.NewManager(zap.NewNop())
+	job := manager.Start("reindex", func(ctx context.Context, progress jobs.Reporter) (interface{}, error) {
+		return nil, assert.AnError
+	})
+	require.Eventually(t, func() bool {
+		current, _ := manager.Get(job.ID)
+		return current.Done()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	server := newJobServer(t, manager)
+	resp, err := http.Get(server.URL + "/jobs/" + job.ID + "/stream")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	events := readEvents(t, resp)
+	require.Len(t, events, 2)
+	assert.Equal(t, "progress", events[0]["type"])
+	assert.Equal(t, "error", events[1]["type"])
+	assert.Equal(t, "job_failed", events[1]["data"].(map[string]interface{})["code"])
+}
+
+func TestStreamJob_UnknownJob(t *testing.T) {
+	server := newJobServer(t, jobs.NewManager(zap.NewNop()))
+	resp, err := http.Get(server.URL + "/jobs/missing/stream")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,188 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/handlers"
+	"eino-rag/internal/jobs"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/document"
+	"eino-rag/tests/testutil"
+)
+
+// searchAs 以指定用户身份调用搜索接口
+func searchAs(t *testing.T, h *testutil.Harness, userID uint, roleName string, body map[string]interface{}) int {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	docHandler := handlers.NewDocumentHandler(h.Documents, jobs.NewManager(h.Logger), h.Logger)
+	router := gin.New()
+	router.POST("/search", func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Set("role_name", roleName)
+	}, docHandler.Search)
+
+	payload, err := json.Marshal(body)
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/search", bytes.NewReader(payload)))
+	return rec.Code
+}
+
+func TestSearch_KnowledgeBaseAccess(t *testing.T) {
+	h := testutil.New(t)
+	kb := h.CreateKnowledgeBase(t, "private")
+
+	other := &models.User{Name: "other", Email: "other@example.com", Password: "x"}
+	require.NoError(t, db.GetDB().Create(other).Error)
+
+	query := map[string]interface{}{"query": "anything", "kb_id": kb.ID}
+	assert.Equal(t, http.StatusForbidden, searchAs(t, h, other.ID, "user", query))
+	assert.Equal(t, http.StatusOK, searchAs(t, h, h.AdminID, "user", query), "creator can search")
+	assert.Equal(t, http.StatusOK, searchAs(t, h, other.ID, "admin", query), "admin can search any knowledge base")
+
+	assert.Equal(t, http.StatusNotFound, searchAs(t, h, other.ID, "user", map[string]interface{}{"query": "anything", "kb_id": kb.ID + 100}))
+	assert.Equal(t, http.StatusBadRequest, searchAs(t, h, other.ID, "user", map[string]interface{}{"query": "anything"}))
+}
+
+func TestDeleteKnowledgeBase_RequiresOwner(t *testing.T) {
+	h := testutil.New(t)
+	router := kbRouter(h)
+	kb := h.CreateKnowledgeBase(t, "private")
+	path := fmt.Sprintf("/knowledge-bases/%d", kb.ID)
+
+	guest := &models.User{Name: "guest", Email: "guest@example.com", Password: "x"}
+	require.NoError(t, db.GetDB().Create(guest).Error)
+
+	// 非创建者不能删除，知识库保持不变
+	code, _ := serveKB(router, guest.ID, "guest", http.MethodDelete, path, "")
+	assert.Equal(t, http.StatusForbidden, code)
+	var count int64
+	require.NoError(t, db.GetDB().Model(&models.KnowledgeBase{}).Where("id = ?", kb.ID).Count(&count).Error)
+	assert.EqualValues(t, 1, count)
+
+	code, _ = serveKB(router, guest.ID, "guest", http.MethodDelete, fmt.Sprintf("/knowledge-bases/%d", kb.ID+100), "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// 创建者可以删除
+	code, body := serveKB(router, h.AdminID, "user", http.MethodDelete, path, "")
+	assert.Equal(t, http.StatusOK, code, body)
+}
+
+func TestListKnowledgeBases_ScopedToCreator(t *testing.T) {
+	h := testutil.New(t)
+	router := kbRouter(h)
+	adminKB := h.CreateKnowledgeBase(t, "admin's")
+
+	other := &models.User{Name: "other", Email: "other@example.com", Password: "x"}
+	require.NoError(t, db.GetDB().Create(other).Error)
+	ownKB := &models.KnowledgeBase{Name: "other's", CreatorID: other.ID}
+	require.NoError(t, db.GetDB().Create(ownKB).Error)
+
+	listed := func(userID uint, role string) []uint {
+		code, body := serveKB(router, userID, role, http.MethodGet, "/knowledge-bases", "")
+		require.Equal(t, http.StatusOK, code, body)
+		var resp struct {
+			Data handlers.KBListResponse `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(body), &resp))
+		ids := make([]uint, len(resp.Data.KnowledgeBases))
+		for i, kb := range resp.Data.KnowledgeBases {
+			ids[i] = kb.ID
+		}
+		assert.EqualValues(t, len(ids), resp.Data.Total)
+		return ids
+	}
+
+	// 非管理员只看到自己创建的知识库，管理员看到全部
+	assert.Equal(t, []uint{ownKB.ID}, listed(other.ID, "user"))
+	assert.ElementsMatch(t, []uint{adminKB.ID, ownKB.ID}, listed(h.AdminID, "admin"))
+
+	// 详情与列表一致
+	code, _ := serveKB(router, other.ID, "user", http.MethodGet, fmt.Sprintf("/knowledge-bases/%d", adminKB.ID), "")
+	assert.Equal(t, http.StatusForbidden, code)
+	code, _ = serveKB(router, other.ID, "user", http.MethodGet, fmt.Sprintf("/knowledge-bases/%d", ownKB.ID), "")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = serveKB(router, h.AdminID, "admin", http.MethodGet, fmt.Sprintf("/knowledge-bases/%d", ownKB.ID), "")
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestUpdateKnowledgeBase_RequiresOwner(t *testing.T) {
+	h := testutil.New(t)
+	router := kbRouter(h)
+	kb := h.CreateKnowledgeBase(t, "private")
+	path := fmt.Sprintf("/knowledge-bases/%d", kb.ID)
+
+	other := &models.User{Name: "other", Email: "other@example.com", Password: "x"}
+	require.NoError(t, db.GetDB().Create(other).Error)
+
+	// 非创建者不能修改，包括会触发后台删除的保留期限
+	code, _ := serveKB(router, other.ID, "user", http.MethodPut, path, `{"retention_days":1,"retention_action":"delete"}`)
+	assert.Equal(t, http.StatusForbidden, code)
+	var stored models.KnowledgeBase
+	require.NoError(t, db.GetDB().First(&stored, kb.ID).Error)
+	assert.Zero(t, stored.RetentionDays)
+
+	code, body := serveKB(router, h.AdminID, "user", http.MethodPut, path, `{"retention_days":30}`)
+	assert.Equal(t, http.StatusOK, code, body)
+}
+
+func TestDocuments_ScopedToKnowledgeBaseAccess(t *testing.T) {
+	h := testutil.New(t)
+	router := kbRouter(h)
+	adminKB := h.CreateKnowledgeBase(t, "admin's")
+	adminDoc, _, err := h.Documents.UploadDocument(context.Background(), "secret.txt",
+		strings.NewReader("The acquisition closes next quarter."), adminKB.ID, h.AdminID, document.UploadOptions{})
+	require.NoError(t, err)
+
+	other := &models.User{Name: "other", Email: "other@example.com", Password: "x"}
+	require.NoError(t, db.GetDB().Create(other).Error)
+	ownKB := &models.KnowledgeBase{Name: "other's", CreatorID: other.ID}
+	require.NoError(t, db.GetDB().Create(ownKB).Error)
+	ownDoc, _, err := h.Documents.UploadDocument(context.Background(), "notes.txt",
+		strings.NewReader("Team notes about the roadmap."), ownKB.ID, other.ID, document.UploadOptions{})
+	require.NoError(t, err)
+
+	listedDocs := func(userID uint, role string) []uint {
+		code, body := serveKB(router, userID, role, http.MethodGet, "/documents", "")
+		require.Equal(t, http.StatusOK, code, body)
+		var resp struct {
+			Data handlers.DocumentListResponse `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(body), &resp))
+		ids := make([]uint, len(resp.Data.Documents))
+		for i, doc := range resp.Data.Documents {
+			ids[i] = doc.ID
+		}
+		assert.EqualValues(t, len(ids), resp.Data.Total)
+		return ids
+	}
+
+	// 非管理员只看到自己知识库中的文档，管理员看到全部
+	assert.Equal(t, []uint{ownDoc.ID}, listedDocs(other.ID, "user"))
+	assert.ElementsMatch(t, []uint{adminDoc.ID, ownDoc.ID}, listedDocs(h.AdminID, "admin"))
+
+	code, _ := serveKB(router, other.ID, "user", http.MethodGet, fmt.Sprintf("/knowledge-bases/%d/documents", adminKB.ID), "")
+	assert.Equal(t, http.StatusForbidden, code)
+	code, _ = serveKB(router, other.ID, "user", http.MethodGet, fmt.Sprintf("/knowledge-bases/%d/documents", ownKB.ID), "")
+	assert.Equal(t, http.StatusOK, code)
+
+	code, _ = serveKB(router, other.ID, "user", http.MethodGet, fmt.Sprintf("/documents/%d", adminDoc.ID), "")
+	assert.Equal(t, http.StatusForbidden, code)
+	code, _ = serveKB(router, other.ID, "user", http.MethodGet, fmt.Sprintf("/documents/%d", ownDoc.ID), "")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = serveKB(router, h.AdminID, "admin", http.MethodGet, fmt.Sprintf("/documents/%d", ownDoc.ID), "")
+	assert.Equal(t, http.StatusOK, code)
+}
@@ -0,0 +1,103 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/handlers"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/document"
+	"eino-rag/tests/testutil"
+)
+
+// createKB 以指定用户身份创建知识库，返回状态码和响应中的知识库或冲突的知识库ID
+func createKB(t *testing.T, router *gin.Engine, userID uint, body string) (int, handlers.KBCreateResponse, uint) {
+	t.Helper()
+	code, raw := serveKB(router, userID, "user", http.MethodPost, "/knowledge-bases", body)
+	var created struct {
+		Data handlers.KBCreateResponse `json:"data"`
+	}
+	var conflict struct {
+		Data handlers.KBConflict `json:"data"`
+	}
+	if code == http.StatusOK {
+		require.NoError(t, json.Unmarshal([]byte(raw), &created))
+	} else if code == http.StatusConflict {
+		require.NoError(t, json.Unmarshal([]byte(raw), &conflict))
+	}
+	return code, created.Data, conflict.Data.ExistingID
+}
+
+func TestKnowledgeBaseName_UniquePerCreator(t *testing.T) {
+	h := testutil.New(t)
+	router := kbRouter(h)
+	other := &models.User{Name: "other", Email: "other@example.com", Password: "x"}
+	require.NoError(t, db.GetDB().Create(other).Error)
+
+	code, created, _ := createKB(t, router, h.AdminID, `{"name":"docs"}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.True(t, created.Created)
+	docsID := created.KnowledgeBase.ID
+
+	// 重复创建返回409和已有知识库ID，get_or_create 时直接返回已有知识库
+	code, _, existingID := createKB(t, router, h.AdminID, `{"name":" docs "}`)
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, docsID, existingID)
+	code, created, _ = createKB(t, router, h.AdminID, `{"name":"docs","get_or_create":true}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.False(t, created.Created)
+	assert.Equal(t, docsID, created.KnowledgeBase.ID)
+
+	// 其他用户可以使用相同名称
+	code, _, _ = createKB(t, router, other.ID, `{"name":"docs"}`)
+	assert.Equal(t, http.StatusOK, code)
+
+	// 改名同样不能与已有知识库重名
+	code, created, _ = createKB(t, router, h.AdminID, `{"name":"notes"}`)
+	require.Equal(t, http.StatusOK, code)
+	notesPath := fmt.Sprintf("/knowledge-bases/%d", created.KnowledgeBase.ID)
+	code, body := serveKB(router, h.AdminID, "admin", http.MethodPut, notesPath, `{"name":"docs"}`)
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Contains(t, body, fmt.Sprintf(`"existing_id":%d`, docsID))
+	code, _ = serveKB(router, h.AdminID, "admin", http.MethodPut, notesPath, `{"name":"notes"}`)
+	assert.Equal(t, http.StatusOK, code, "keeping its own name is not a conflict")
+	code, _ = serveKB(router, h.AdminID, "admin", http.MethodPut, notesPath, `{"name":"  "}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// 绕过接口检查时由唯一索引拒绝
+	err := db.GetDB().Create(&models.KnowledgeBase{Name: "docs", CreatorID: h.AdminID}).Error
+	assert.ErrorIs(t, err, gorm.ErrDuplicatedKey)
+}
+
+func TestKnowledgeBaseName_DeletedAndAttachmentsExcluded(t *testing.T) {
+	h := testutil.New(t)
+	router := kbRouter(h)
+
+	// 软删除后可以重新使用名称
+	code, created, _ := createKB(t, router, h.AdminID, `{"name":"docs"}`)
+	require.Equal(t, http.StatusOK, code)
+	require.NoError(t, db.GetDB().Delete(&models.KnowledgeBase{}, created.KnowledgeBase.ID).Error)
+	code, _, _ = createKB(t, router, h.AdminID, `{"name":"docs"}`)
+	assert.Equal(t, http.StatusOK, code)
+
+	// 恢复后会与新建的同名知识库冲突
+	_, err := h.Documents.RestoreKnowledgeBase(context.Background(), created.KnowledgeBase.ID)
+	assert.ErrorIs(t, err, document.ErrKnowledgeBaseNameTaken)
+
+	// 同一用户的多个对话各有一个同名的附件知识库
+	for _, convID := range []string{"conv-1", "conv-2"} {
+		_, _, err := h.Documents.AttachToConversation(context.Background(), convID, h.AdminID, "notes.txt",
+			strings.NewReader("Attachment content for the conversation."), document.UploadOptions{})
+		require.NoError(t, err, convID)
+	}
+}
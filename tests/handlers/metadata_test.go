@@ -0,0 +1,124 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/handlers"
+	"eino-rag/internal/jobs"
+	"eino-rag/internal/services/document"
+	"eino-rag/tests/testutil"
+)
+
+// searchAsAdmin 以管理员身份调用搜索接口，返回搜索结果
+func searchAsAdmin(t *testing.T, h *testutil.Harness, request map[string]interface{}) []handlers.DocResult {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	docHandler := handlers.NewDocumentHandler(h.Documents, jobs.NewManager(h.Logger), h.Logger)
+	router := gin.New()
+	router.POST("/search", func(c *gin.Context) {
+		c.Set("user_id", h.AdminID)
+		c.Set("role_name", "admin")
+	}, docHandler.Search)
+
+	payload, err := json.Marshal(request)
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/search", bytes.NewReader(payload)))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp struct {
+		Data handlers.SearchResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return resp.Data.Documents
+}
+
+// searchMetadata 以管理员身份搜索，返回第一个结果的元数据
+func searchMetadata(t *testing.T, h *testutil.Harness, kbID uint) map[string]interface{} {
+	t.Helper()
+	results := searchAsAdmin(t, h, map[string]interface{}{"query": "milvus", "kb_id": kbID})
+	require.NotEmpty(t, results)
+	return results[0].Metadata
+}
+
+func TestSearch_MetadataAllowlist(t *testing.T) {
+	h := testutil.New(t)
+	kb := h.CreateKnowledgeBase(t, "metadata")
+	_, _, err := h.Documents.UploadDocument(context.Background(), "milvus.txt",
+		strings.NewReader("Milvus is a vector database."), kb.ID, h.AdminID, document.UploadOptions{})
+	require.NoError(t, err)
+
+	// 默认不返回创建者等内部字段
+	metadata := searchMetadata(t, h, kb.ID)
+	assert.Contains(t, metadata, "doc_id")
+	assert.Contains(t, metadata, "score")
+	assert.NotContains(t, metadata, "creator_id")
+	assert.NotContains(t, metadata, "creator_name")
+	assert.NotContains(t, metadata, "user_id")
+	assert.NotContains(t, metadata, "distance")
+
+	previous := strings.Join(config.Get().Snapshot().ResponseMetadataKeys, ",")
+	t.Cleanup(func() { config.UpdateFromDB(map[string]string{"response_metadata_keys": previous}) })
+	config.UpdateFromDB(map[string]string{"response_metadata_keys": "doc_id,creator_name"})
+	metadata = searchMetadata(t, h, kb.ID)
+	assert.Equal(t, []string{"creator_name", "doc_id"}, keys(metadata))
+}
+
+func TestSearch_ContextWindow(t *testing.T) {
+	h := testutil.New(t)
+	kb := h.CreateKnowledgeBase(t, "neighbors")
+	text := strings.Repeat("alpha ", 150) + "zebra " + strings.Repeat("gamma ", 150)
+	_, _, err := h.Documents.UploadDocument(context.Background(), "zebra.txt",
+		strings.NewReader(text), kb.ID, h.AdminID, document.UploadOptions{})
+	require.NoError(t, err)
+
+	contents := func(results []handlers.DocResult) []string {
+		var result []string
+		for _, doc := range results {
+			result = append(result, doc.Content)
+		}
+		return result
+	}
+
+	// 默认只返回命中的分块
+	hits := contents(searchAsAdmin(t, h, map[string]interface{}{"query": "zebra", "kb_id": kb.ID}))
+	require.NotEmpty(t, hits)
+	for _, content := range hits {
+		assert.Contains(t, content, "zebra")
+	}
+
+	// 指定 context_window 时补充前后相邻的分块
+	expanded := contents(searchAsAdmin(t, h, map[string]interface{}{"query": "zebra", "kb_id": kb.ID, "context_window": 1}))
+	assert.Greater(t, len(expanded), len(hits))
+	assert.Contains(t, expanded, hits[0])
+	assert.True(t, strings.HasPrefix(expanded[0], "alpha"), "neighbors are ordered by chunk index")
+
+	// 未指定时使用全局配置
+	previous := config.Get().Snapshot().ContextWindow
+	t.Cleanup(func() { config.UpdateFromDB(map[string]string{"context_window": strconv.Itoa(previous)}) })
+	config.UpdateFromDB(map[string]string{"context_window": "1"})
+	assert.Equal(t, expanded, contents(searchAsAdmin(t, h, map[string]interface{}{"query": "zebra", "kb_id": kb.ID})))
+}
+
+func keys(m map[string]interface{}) []string {
+	var result []string
+	for k := range m {
+		result = append(result, k)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,64 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/handlers"
+	"eino-rag/internal/jobs"
+	"eino-rag/internal/middleware"
+)
+
+func serveJSON(t *testing.T, router *gin.Engine, path string) (int, map[string]interface{}) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	return rec.Code, body
+}
+
+func TestResponseEnvelope_HandlerSuccessAndError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	manager := jobs.NewManager(zap.NewNop())
+	job := manager.Start("test", func(ctx context.Context, progress jobs.Reporter) (interface{}, error) {
+		return nil, nil
+	})
+
+	router := gin.New()
+	sysHandler := handlers.NewSystemHandler(&config.Config{}, manager, nil, zap.NewNop())
+	router.GET("/jobs/:id", sysHandler.GetJob)
+
+	status, body := serveJSON(t, router, "/jobs/"+job.ID)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, true, body["success"])
+	assert.NotContains(t, body, "error")
+	data := body["data"].(map[string]interface{})
+	assert.Equal(t, job.ID, data["job"].(map[string]interface{})["id"])
+
+	status, body = serveJSON(t, router, "/jobs/missing")
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, map[string]interface{}{"success": false, "error": "Job not found"}, body)
+}
+
+func TestResponseEnvelope_MiddlewareError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/protected", middleware.AuthMiddleware(), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	status, body := serveJSON(t, router, "/protected")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, map[string]interface{}{"success": false, "error": "Authorization header required"}, body)
+}
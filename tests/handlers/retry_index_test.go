@@ -0,0 +1,41 @@
+package handlers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/handlers"
+	"eino-rag/internal/jobs"
+	"eino-rag/internal/services/document"
+	"eino-rag/tests/testutil"
+)
+
+func TestRetryIndex_NotFailedConflict(t *testing.T) {
+	h := testutil.New(t)
+	kb := h.CreateKnowledgeBase(t, "retry")
+	doc, _, err := h.Documents.UploadDocument(context.Background(), "indexed.txt",
+		strings.NewReader("Milvus is a vector database built for similarity search."), kb.ID, h.AdminID, document.UploadOptions{})
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	docHandler := handlers.NewDocumentHandler(h.Documents, jobs.NewManager(h.Logger), h.Logger)
+	router := gin.New()
+	router.POST("/documents/:id/retry-index", func(c *gin.Context) {
+		c.Set("user_id", h.AdminID)
+		c.Set("role_name", "admin")
+	}, docHandler.RetryIndex)
+
+	// 已索引的文档不能重试，返回409而不是在记录日志时崩溃
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/documents/%d/retry-index", doc.ID), nil))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), document.ErrNotFailed.Error())
+}
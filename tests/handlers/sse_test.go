@@ -0,0 +1,99 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/handlers"
+)
+
+// decodeSSE 解析单个 `data: ...\n\n` 事件
+func decodeSSE(t *testing.T, raw string) map[string]interface{} {
+	t.Helper()
+	require.True(t, strings.HasPrefix(raw, "data: "), "missing data prefix: %q", raw)
+	require.True(t, strings.HasSuffix(raw, "\n\n"), "missing event terminator: %q", raw)
+
+	var event map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimSuffix(strings.TrimPrefix(raw, "data: "), "\n\n")), &event))
+	return event
+}
+
+func TestWriteSSEEvent_WireShape(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  handlers.SSEPayload
+		wantType string
+		wantData map[string]interface{}
+	}{
+		{
+			name:     "start",
+			payload:  handlers.StartEvent{ConversationID: "conv-1", Message: "Starting chat"},
+			wantType: "start",
+			wantData: map[string]interface{}{"conversation_id": "conv-1", "message": "Starting chat"},
+		},
+		{
+			name:     "content",
+			payload:  handlers.ContentEvent{Content: "你好"},
+			wantType: "content",
+			wantData: map[string]interface{}{"content": "你好"},
+		},
+		{
+			name:     "end",
+			payload:  handlers.EndEvent{ConversationID: "conv-1", Message: "Completed", Timestamp: 1640995200},
+			wantType: "end",
+			wantData: map[string]interface{}{"conversation_id": "conv-1", "message": "Completed", "timestamp": float64(1640995200)},
+		},
+		{
+			name:     "error without code",
+			payload:  handlers.ErrorEvent{Message: "Invalid request data"},
+			wantType: "error",
+			wantData: map[string]interface{}{"message": "Invalid request data"},
+		},
+		{
+			name:     "error with code",
+			payload:  handlers.ErrorEvent{Message: "Too many concurrent streams", Code: "too_many_streams"},
+			wantType: "error",
+			wantData: map[string]interface{}{"message": "Too many concurrent streams", "code": "too_many_streams"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, handlers.WriteSSEEvent(&buf, tt.payload))
+
+			event := decodeSSE(t, buf.String())
+			assert.Equal(t, tt.wantType, event["type"])
+			assert.Equal(t, tt.wantData, event["data"])
+		})
+	}
+}
+
+func TestWriteSSEEvent_Context(t *testing.T) {
+	var buf bytes.Buffer
+	err := handlers.WriteSSEEvent(&buf, handlers.ContextEvent{
+		Documents: []handlers.DocResult{{
+			ID:       "chunk-1",
+			Content:  "检索内容",
+			Score:    0.8,
+			Metadata: map[string]interface{}{"score": 0.8},
+		}},
+	})
+	require.NoError(t, err)
+
+	event := decodeSSE(t, buf.String())
+	assert.Equal(t, "context", event["type"])
+
+	docs := event["data"].(map[string]interface{})["documents"].([]interface{})
+	require.Len(t, docs, 1)
+	doc := docs[0].(map[string]interface{})
+	assert.Equal(t, "chunk-1", doc["id"])
+	assert.Equal(t, "检索内容", doc["content"])
+	assert.Equal(t, 0.8, doc["score"])
+
+}
@@ -0,0 +1,180 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/handlers"
+	"eino-rag/internal/jobs"
+	"eino-rag/internal/models"
+	"eino-rag/tests/testutil"
+)
+
+// uploadJobRouter 上传和任务查询接口，请求头 X-User-ID 指定当前用户
+func uploadJobRouter(h *testutil.Harness) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	docHandler := handlers.NewDocumentHandler(h.Documents, jobs.NewManager(h.Logger), h.Logger)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		var userID uint
+		fmt.Sscan(c.GetHeader("X-User-ID"), &userID)
+		c.Set("user_id", userID)
+	})
+	router.POST("/upload", docHandler.Upload)
+	router.GET("/jobs/:id", docHandler.GetUploadJob)
+	return router
+}
+
+// uploadAsync 以 async=true 上传文件，返回状态码和任务
+func uploadAsync(t *testing.T, router *gin.Engine, userID, kbID uint, filename, content string) (int, models.UploadJob) {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	require.NoError(t, w.WriteField("kb_id", fmt.Sprint(kbID)))
+	part, err := w.CreateFormFile("file", filename)
+	require.NoError(t, err)
+	part.Write([]byte(content))
+	require.NoError(t, w.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/upload?async=true", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.Header.Set("X-User-ID", fmt.Sprint(userID))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	var resp struct {
+		Data models.UploadJob `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec.Code, resp.Data
+}
+
+// getUploadJob 查询任务，返回状态码和任务
+func getUploadJob(router *gin.Engine, userID uint, id string) (int, models.UploadJob) {
+	req := httptest.NewRequest(http.MethodGet, "/jobs/"+id, nil)
+	req.Header.Set("X-User-ID", fmt.Sprint(userID))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	var resp struct {
+		Data models.UploadJob `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec.Code, resp.Data
+}
+
+// waitUploadJob 等待任务结束
+func waitUploadJob(t *testing.T, router *gin.Engine, userID uint, id string) models.UploadJob {
+	t.Helper()
+	var job models.UploadJob
+	require.Eventually(t, func() bool {
+		code, current := getUploadJob(router, userID, id)
+		if code != http.StatusOK {
+			return false
+		}
+		job = current
+		return job.Status == models.UploadJobCompleted || job.Status == models.UploadJobFailed
+	}, 10*time.Second, 10*time.Millisecond)
+	return job
+}
+
+func TestUpload_Async(t *testing.T) {
+	h := testutil.New(t)
+	kb := h.CreateKnowledgeBase(t, "async")
+	router := uploadJobRouter(h)
+	content := "Milvus is a vector database built for similarity search.\n\nIt stores embeddings in collections."
+
+	code, job := uploadAsync(t, router, h.AdminID, kb.ID, "milvus.txt", content)
+	require.Equal(t, http.StatusAccepted, code)
+	require.NotEmpty(t, job.ID)
+	assert.Equal(t, models.UploadJobPending, job.Status)
+	assert.Equal(t, "milvus.txt", job.FileName)
+
+	job = waitUploadJob(t, router, h.AdminID, job.ID)
+	require.Equal(t, models.UploadJobCompleted, job.Status, job.Error)
+	assert.Equal(t, 100.0, job.Progress)
+	assert.Positive(t, job.ChunkCount)
+	assert.NotNil(t, job.FinishedAt)
+	var doc models.Document
+	require.NoError(t, db.GetDB().First(&doc, job.DocumentID).Error)
+	assert.Equal(t, models.DocumentStatusIndexed, doc.Status)
+
+	// 只能查询自己创建的任务
+	code, _ = getUploadJob(router, h.AdminID+100, job.ID)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// 解析后才能发现的错误记录在任务中
+	code, job = uploadAsync(t, router, h.AdminID, kb.ID, "copy.txt", content)
+	require.Equal(t, http.StatusAccepted, code)
+	job = waitUploadJob(t, router, h.AdminID, job.ID)
+	assert.Equal(t, models.UploadJobFailed, job.Status)
+	assert.Contains(t, job.Error, "already exists")
+	assert.Zero(t, job.DocumentID)
+
+	// 知识库和文件类型在返回前检查
+	code, _ = uploadAsync(t, router, h.AdminID, kb.ID, "image.exe", "\x00\x01binary")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestUpload_AsyncJobExpires(t *testing.T) {
+	h := testutil.New(t)
+	h.Config.UploadJobTTL = time.Hour
+	kb := h.CreateKnowledgeBase(t, "expiry")
+	router := uploadJobRouter(h)
+
+	code, old := uploadAsync(t, router, h.AdminID, kb.ID, "old.txt", "An old document.")
+	require.Equal(t, http.StatusAccepted, code)
+	waitUploadJob(t, router, h.AdminID, old.ID)
+	require.NoError(t, db.GetDB().Model(&models.UploadJob{}).Where("id = ?", old.ID).
+		UpdateColumn("updated_at", time.Now().Add(-2*time.Hour)).Error)
+
+	// 过期的任务不再返回，创建新任务时删除
+	code, _ = getUploadJob(router, h.AdminID, old.ID)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, fresh := uploadAsync(t, router, h.AdminID, kb.ID, "new.txt", "A new document.")
+	require.Equal(t, http.StatusAccepted, code)
+	waitUploadJob(t, router, h.AdminID, fresh.ID)
+	var count int64
+	require.NoError(t, db.GetDB().Model(&models.UploadJob{}).Count(&count).Error)
+	assert.EqualValues(t, 1, count)
+}
+
+func TestUpload_AsyncJobWaitsForMaintenance(t *testing.T) {
+	h := testutil.New(t)
+	kb := h.CreateKnowledgeBase(t, "maintenance")
+	router := uploadJobRouter(h)
+	ctx := context.Background()
+
+	// 任务在开启维护模式前已排队
+	require.NoError(t, db.SetMaintenance(ctx, db.MaintenanceState{Enabled: true, Reason: "reindex"}))
+	t.Cleanup(func() { db.SetMaintenance(ctx, db.MaintenanceState{}) })
+	code, job := uploadAsync(t, router, h.AdminID, kb.ID, "queued.txt", "A document queued before maintenance.")
+	require.Equal(t, http.StatusAccepted, code)
+
+	// 维护期间保持 pending，不写入文档
+	time.Sleep(200 * time.Millisecond)
+	code, current := getUploadJob(router, h.AdminID, job.ID)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, models.UploadJobPending, current.Status)
+	var docs int64
+	require.NoError(t, db.GetDB().Model(&models.Document{}).Where("knowledge_base_id = ?", kb.ID).Count(&docs).Error)
+	assert.Zero(t, docs)
+
+	// 维护结束后继续处理
+	require.NoError(t, db.SetMaintenance(ctx, db.MaintenanceState{}))
+	job = waitUploadJob(t, router, h.AdminID, job.ID)
+	assert.Equal(t, models.UploadJobCompleted, job.Status, job.Error)
+}
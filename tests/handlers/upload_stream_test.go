@@ -0,0 +1,103 @@
+package handlers_test
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/handlers"
+	"eino-rag/internal/jobs"
+	"eino-rag/internal/models"
+	"eino-rag/tests/testutil"
+)
+
+// uploadStream 以管理员身份调用流式上传接口，返回状态码和解析后的事件
+func uploadStream(t *testing.T, h *testutil.Harness, kbID uint, filename, content string) (int, []map[string]interface{}) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	docHandler := handlers.NewDocumentHandler(h.Documents, jobs.NewManager(h.Logger), h.Logger)
+	router := gin.New()
+	router.POST("/upload/stream", func(c *gin.Context) {
+		c.Set("user_id", h.AdminID)
+	}, docHandler.UploadStream)
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	require.NoError(t, w.WriteField("kb_id", fmt.Sprint(kbID)))
+	part, err := w.CreateFormFile("file", filename)
+	require.NoError(t, err)
+	part.Write([]byte(content))
+	require.NoError(t, w.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/upload/stream", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/event-stream") {
+		return rec.Code, nil
+	}
+	assert.True(t, rec.Flushed)
+
+	var events []map[string]interface{}
+	for _, raw := range strings.SplitAfter(rec.Body.String(), "\n\n") {
+		if raw != "" {
+			events = append(events, decodeSSE(t, raw))
+		}
+	}
+	return rec.Code, events
+}
+
+func eventTypes(events []map[string]interface{}) []string {
+	types := make([]string, len(events))
+	for i, event := range events {
+		types[i] = event["type"].(string)
+	}
+	return types
+}
+
+func TestUploadStream(t *testing.T) {
+	h := testutil.New(t)
+	kb := h.CreateKnowledgeBase(t, "stream")
+	content := "Milvus is a vector database built for similarity search.\n\nIt stores embeddings in collections."
+
+	code, events := uploadStream(t, h, kb.ID, "milvus.txt", content)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, []string{"parse", "chunk", "embed", "end"}, eventTypes(events))
+
+	parse := events[0]["data"].(map[string]interface{})
+	docID := uint(parse["document_id"].(float64))
+	assert.NotZero(t, docID)
+
+	chunk := events[1]["data"].(map[string]interface{})
+	chunks := chunk["total"].(float64)
+	assert.Positive(t, chunks)
+
+	embed := events[2]["data"].(map[string]interface{})
+	assert.Equal(t, chunks, embed["processed"])
+	assert.Equal(t, chunks, embed["total"])
+
+	end := events[3]["data"].(map[string]interface{})
+	assert.Equal(t, float64(docID), end["document_id"])
+	assert.Equal(t, chunks, end["indexed_chunks"])
+
+	// 文档与普通上传一样保存
+	var doc models.Document
+	require.NoError(t, db.GetDB().First(&doc, docID).Error)
+	assert.Equal(t, models.DocumentStatusIndexed, doc.Status)
+
+	// 处理失败时以 error 事件结束
+	code, events = uploadStream(t, h, kb.ID, "copy.txt", content)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, []string{"error"}, eventTypes(events))
+	assert.Equal(t, "upload_failed", events[0]["data"].(map[string]interface{})["code"])
+}
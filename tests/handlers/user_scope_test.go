@@ -0,0 +1,170 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/handlers"
+	"eino-rag/internal/models"
+	"eino-rag/tests/testutil"
+)
+
+// userRequestAs 以指定管理员身份调用用户管理接口
+func userRequestAs(t *testing.T, h *testutil.Harness, adminID uint, method, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	userHandler := handlers.NewUserHandler(h.Logger)
+	router := gin.New()
+	users := router.Group("/users", func(c *gin.Context) {
+		c.Set("user_id", adminID)
+		c.Set("role_name", "admin")
+	})
+	users.GET("", userHandler.ListUsers)
+	users.GET("/:id", userHandler.GetUser)
+	users.POST("", userHandler.CreateUser)
+	users.PUT("/:id", userHandler.UpdateUser)
+	users.DELETE("/:id", userHandler.DeleteUser)
+	users.PUT("/:id/status", userHandler.UpdateUserStatus)
+
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		require.NoError(t, err)
+	}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+// createGroupUser 直接在数据库中创建属于指定分组的用户
+func createGroupUser(t *testing.T, name, group, roleName string) *models.User {
+	t.Helper()
+	var role models.Role
+	require.NoError(t, db.GetDB().Where("name = ?", roleName).First(&role).Error)
+	user := &models.User{Name: name, Email: name + "@example.com", Password: "x", RoleID: role.ID, Status: "active", Group: group}
+	require.NoError(t, db.GetDB().Create(user).Error)
+	return user
+}
+
+// listedEmails 返回用户列表接口中的邮箱
+func listedEmails(t *testing.T, rec *httptest.ResponseRecorder) []string {
+	t.Helper()
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var body struct {
+		Data handlers.UserListResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	emails := make([]string, len(body.Data.Users))
+	for i, user := range body.Data.Users {
+		emails[i] = user.Email
+	}
+	assert.EqualValues(t, len(emails), body.Data.Total)
+	return emails
+}
+
+func TestUserScope_GroupAdminSeesOnlyOwnGroup(t *testing.T) {
+	h := testutil.New(t)
+	groupAdmin := createGroupUser(t, "sales-admin", "sales", "group_admin")
+	member := createGroupUser(t, "sales-member", "sales", "user")
+	outsider := createGroupUser(t, "support-member", "support", "user")
+
+	emails := listedEmails(t, userRequestAs(t, h, groupAdmin.ID, http.MethodGet, "/users?page_size=100", nil))
+	assert.ElementsMatch(t, []string{groupAdmin.Email, member.Email}, emails)
+
+	assert.Equal(t, http.StatusOK, userRequestAs(t, h, groupAdmin.ID, http.MethodGet, fmt.Sprintf("/users/%d", member.ID), nil).Code)
+	assert.Equal(t, http.StatusNotFound, userRequestAs(t, h, groupAdmin.ID, http.MethodGet, fmt.Sprintf("/users/%d", outsider.ID), nil).Code)
+	assert.Equal(t, http.StatusNotFound, userRequestAs(t, h, groupAdmin.ID, http.MethodGet, fmt.Sprintf("/users/%d", h.AdminID), nil).Code)
+
+	// 范围外的用户不能被修改或删除
+	path := fmt.Sprintf("/users/%d", outsider.ID)
+	assert.Equal(t, http.StatusNotFound, userRequestAs(t, h, groupAdmin.ID, http.MethodPut, path, map[string]string{"name": "renamed"}).Code)
+	assert.Equal(t, http.StatusNotFound, userRequestAs(t, h, groupAdmin.ID, http.MethodPut, path+"/status", map[string]string{"status": "inactive"}).Code)
+	assert.Equal(t, http.StatusNotFound, userRequestAs(t, h, groupAdmin.ID, http.MethodDelete, path, nil).Code)
+
+	var unchanged models.User
+	require.NoError(t, db.GetDB().First(&unchanged, outsider.ID).Error)
+	assert.Equal(t, "support-member", unchanged.Name)
+	assert.Equal(t, "active", unchanged.Status)
+}
+
+func TestUserScope_SuperAdminSeesEveryone(t *testing.T) {
+	h := testutil.New(t)
+	createGroupUser(t, "sales-member", "sales", "user")
+	createGroupUser(t, "support-member", "support", "user")
+
+	// 超级管理员由角色等级决定，与是否属于分组无关
+	groupedSuper := createGroupUser(t, "sales-super", "sales", "admin")
+
+	var total int64
+	require.NoError(t, db.GetDB().Model(&models.User{}).Count(&total).Error)
+	for _, adminID := range []uint{h.AdminID, groupedSuper.ID} {
+		emails := listedEmails(t, userRequestAs(t, h, adminID, http.MethodGet, "/users?page_size=100", nil))
+		assert.Len(t, emails, int(total))
+	}
+}
+
+func TestUserScope_UngroupedGroupAdminIsScoped(t *testing.T) {
+	h := testutil.New(t)
+	groupAdmin := createGroupUser(t, "plain-admin", "", "group_admin")
+	ungrouped := createGroupUser(t, "plain-member", "", "user")
+	createGroupUser(t, "sales-member", "sales", "user")
+
+	// 未分配分组的分组管理员只能管理未分组且等级不高于自己的用户
+	emails := listedEmails(t, userRequestAs(t, h, groupAdmin.ID, http.MethodGet, "/users?page_size=100", nil))
+	assert.ElementsMatch(t, []string{groupAdmin.Email, ungrouped.Email}, emails)
+	path := fmt.Sprintf("/users/%d", h.AdminID)
+	assert.Equal(t, http.StatusNotFound, userRequestAs(t, h, groupAdmin.ID, http.MethodPut, path+"/status", map[string]string{"status": "inactive"}).Code)
+
+	// 不能分配比自己等级更高的角色
+	path = fmt.Sprintf("/users/%d", ungrouped.ID)
+	assert.Equal(t, http.StatusForbidden, userRequestAs(t, h, groupAdmin.ID, http.MethodPut, path, map[string]string{"role_name": "admin"}).Code)
+	rec := userRequestAs(t, h, groupAdmin.ID, http.MethodPost, "/users", map[string]string{
+		"name": "new-admin", "email": "new-admin@example.com", "password": "Sc0ped!Passw0rd", "role_name": "admin",
+	})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, http.StatusOK, userRequestAs(t, h, groupAdmin.ID, http.MethodPut, path, map[string]string{"role_name": "guest"}).Code)
+}
+
+func TestUserScope_GroupAssignment(t *testing.T) {
+	h := testutil.New(t)
+	groupAdmin := createGroupUser(t, "sales-admin", "sales", "group_admin")
+	member := createGroupUser(t, "sales-member", "sales", "user")
+	password := "Sc0ped!Passw0rd"
+
+	// 分组管理员创建的用户自动加入其分组，不能指定其他分组
+	rec := userRequestAs(t, h, groupAdmin.ID, http.MethodPost, "/users", map[string]string{
+		"name": "new-sales", "email": "new-sales@example.com", "password": password,
+	})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var created models.User
+	require.NoError(t, db.GetDB().Where("email = ?", "new-sales@example.com").First(&created).Error)
+	assert.Equal(t, "sales", created.Group)
+
+	rec = userRequestAs(t, h, groupAdmin.ID, http.MethodPost, "/users", map[string]string{
+		"name": "escapee", "email": "escapee@example.com", "password": password, "group": "support",
+	})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	// 分组管理员不能修改分组，超级管理员可以
+	path := fmt.Sprintf("/users/%d", member.ID)
+	assert.Equal(t, http.StatusForbidden, userRequestAs(t, h, groupAdmin.ID, http.MethodPut, path, map[string]string{"group": ""}).Code)
+	require.Equal(t, http.StatusOK, userRequestAs(t, h, h.AdminID, http.MethodPut, path, map[string]string{"group": "support"}).Code)
+
+	var moved models.User
+	require.NoError(t, db.GetDB().First(&moved, member.ID).Error)
+	assert.Equal(t, "support", moved.Group)
+	assert.Equal(t, http.StatusNotFound, userRequestAs(t, h, groupAdmin.ID, http.MethodGet, path, nil).Code)
+}
@@ -0,0 +1,110 @@
+//go:build integration
+// +build integration
+
+package integration_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestChatStream_DisconnectAfterStartKeepsMessages 新对话在收到 start 事件后立即断开，
+// 用户消息和已生成的回复仍应保存
+func TestChatStream_DisconnectAfterStartKeepsMessages(t *testing.T) {
+	token := loginAndGetToken(t)
+	message := "disconnect test " + time.Now().Format(time.RFC3339Nano)
+
+	resp := openChatStream(t, token, message, "")
+	start := readSSEEvent(t, bufio.NewReader(resp.Body))
+	resp.Body.Close()
+
+	if start["type"] != "start" {
+		t.Fatalf("Expected start event, got %v", start["type"])
+	}
+	data, _ := start["data"].(map[string]interface{})
+	convID, _ := data["conversation_id"].(string)
+	if convID == "" {
+		t.Fatal("Expected start event to carry the new conversation ID")
+	}
+
+	// 等待服务端发现断开并保存回复
+	time.Sleep(time.Second)
+	messages := getConversationMessages(t, token, convID)
+	if len(messages) == 0 {
+		t.Fatal("Expected the user message to be saved after disconnect")
+	}
+	if messages[0]["role"] != "user" || messages[0]["content"] != message {
+		t.Errorf("Expected first message to be the user message, got %v", messages[0])
+	}
+	if len(messages) != 2 || messages[1]["role"] != "assistant" {
+		t.Fatalf("Expected the (possibly partial) assistant reply to be saved, got %d messages", len(messages))
+	}
+}
+
+// TestChatStream_CompletedReplyNotIncomplete 读完整个流时保存的回复不标记为不完整
+func TestChatStream_CompletedReplyNotIncomplete(t *testing.T) {
+	token := loginAndGetToken(t)
+
+	resp := openChatStream(t, token, "complete stream test", "")
+	reader := bufio.NewReader(resp.Body)
+	var convID string
+	for {
+		event := readSSEEvent(t, reader)
+		data, _ := event["data"].(map[string]interface{})
+		if event["type"] == "start" {
+			convID, _ = data["conversation_id"].(string)
+		}
+		if event["type"] == "end" || event["type"] == "error" {
+			break
+		}
+	}
+	resp.Body.Close()
+
+	messages := getConversationMessages(t, token, convID)
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(messages))
+	}
+	if incomplete, _ := messages[1]["incomplete"].(bool); incomplete {
+		t.Error("Expected completed reply not to be marked incomplete")
+	}
+}
+
+func openChatStream(t *testing.T, token, message, convID string) *http.Response {
+	body, _ := json.Marshal(map[string]interface{}{
+		"message":         message,
+		"conversation_id": convID,
+	})
+	req, _ := http.NewRequest("POST", baseURL+"/chat/stream", bytes.NewBuffer(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open chat stream: %v", err)
+	}
+	return resp
+}
+
+// readSSEEvent 读取下一个 data 行并解析为事件
+func readSSEEvent(t *testing.T, reader *bufio.Reader) map[string]interface{} {
+	t.Helper()
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read SSE event: %v", err)
+		}
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var event map[string]interface{}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+			t.Fatalf("Invalid SSE event: %v", err)
+		}
+		return event
+	}
+}
@@ -0,0 +1,108 @@
+//go:build integration
+// +build integration
+
+package integration_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestConversation_RapidMessagesKeepOrder 连续快速发送消息，流式回复在后台异步保存，
+// 对话中的消息仍应按发送顺序排列且序号递增
+func TestConversation_RapidMessagesKeepOrder(t *testing.T) {
+	token := loginAndGetToken(t)
+
+	sent := []string{"order test first"}
+	convID := sendChat(t, token, "/chat", sent[0], "")
+	for i := 1; i <= 4; i++ {
+		msg := fmt.Sprintf("order test stream %d", i)
+		sendChat(t, token, "/chat/stream", msg, convID)
+		sent = append(sent, msg)
+	}
+	sent = append(sent, "order test last")
+	sendChat(t, token, "/chat", sent[len(sent)-1], convID)
+
+	// 等待最后一个流式回复的异步保存
+	time.Sleep(time.Second)
+	messages := getConversationMessages(t, token, convID)
+
+	if len(messages) != 2*len(sent) {
+		t.Fatalf("Expected %d messages, got %d", 2*len(sent), len(messages))
+	}
+	var lastSeq float64
+	for i, msg := range messages {
+		seq, _ := msg["seq"].(float64)
+		if seq <= lastSeq {
+			t.Errorf("Message %d has seq %v, not after %v", i, seq, lastSeq)
+		}
+		lastSeq = seq
+
+		wantRole := "user"
+		if i%2 == 1 {
+			wantRole = "assistant"
+		}
+		if msg["role"] != wantRole {
+			t.Errorf("Message %d: expected role %s, got %v", i, wantRole, msg["role"])
+		}
+		if wantRole == "user" && msg["content"] != sent[i/2] {
+			t.Errorf("Message %d: expected %q, got %v", i, sent[i/2], msg["content"])
+		}
+	}
+}
+
+// sendChat 发送一条消息并读完响应，返回对话ID（流式接口返回空）
+func sendChat(t *testing.T, token, path, message, convID string) string {
+	body, _ := json.Marshal(map[string]interface{}{
+		"message":         message,
+		"conversation_id": convID,
+	})
+	req, _ := http.NewRequest("POST", baseURL+path, bytes.NewBuffer(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to send chat message: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Chat request failed with status %d: %s", resp.StatusCode, respBody)
+	}
+
+	var result struct {
+		Data struct {
+			ConversationID string `json:"conversation_id"`
+		} `json:"data"`
+	}
+	json.Unmarshal(respBody, &result)
+	return result.Data.ConversationID
+}
+
+func getConversationMessages(t *testing.T, token, convID string) []map[string]interface{} {
+	req, _ := http.NewRequest("GET", baseURL+"/chat/conversations/"+convID, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to get conversation: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Data struct {
+			Messages []map[string]interface{} `json:"messages"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Invalid response format: %v", err)
+	}
+	return result.Data.Messages
+}
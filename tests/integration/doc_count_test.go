@@ -1,16 +1,16 @@
+//go:build integration
 // +build integration
 
+// 线上集成测试：需要先启动服务（localhost:8080）及 Milvus、Redis，使用 make test-integration 运行
+
 package integration_test
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
-	"mime/multipart"
 	"net/http"
 	"testing"
-	"time"
 )
 
 func TestDocumentCount_Update(t *testing.T) {
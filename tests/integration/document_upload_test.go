@@ -1,5 +1,8 @@
+//go:build integration
 // +build integration
 
+// 线上集成测试：需要先启动服务（localhost:8080）及 Milvus、Redis，使用 make test-integration 运行
+
 package integration_test
 
 import (
@@ -14,7 +17,7 @@ import (
 )
 
 const (
-	baseURL = "http://localhost:8080/api/v1"
+	baseURL = "http://localhost:8080/api"
 	testPDF = `%PDF-1.4
 1 0 obj
 << /Type /Catalog /Pages 2 0 R >>
@@ -66,8 +69,8 @@ func TestDocumentUpload_DuplicateHandling(t *testing.T) {
 
 func loginAndGetToken(t *testing.T) string {
 	payload := map[string]string{
-		"username": "admin",
-		"password": "admin123",
+		"email":    "admin@eino-rag.com",
+		"password": "admin123456",
 	}
 
 	body, _ := json.Marshal(payload)
@@ -145,9 +148,10 @@ func uploadDocument(t *testing.T, token string, kbID uint, filename string, cont
 		t.Fatalf("Failed to copy file content: %v", err)
 	}
 
+	w.WriteField("kb_id", fmt.Sprintf("%d", kbID))
 	w.Close()
 
-	req, _ := http.NewRequest("POST", fmt.Sprintf("%s/knowledge-bases/%d/documents", baseURL, kbID), &b)
+	req, _ := http.NewRequest("POST", baseURL+"/documents/upload", &b)
 	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Content-Type", w.FormDataContentType())
 
@@ -161,16 +165,15 @@ func uploadDocument(t *testing.T, token string, kbID uint, filename string, cont
 	respBody, _ := io.ReadAll(resp.Body)
 	t.Logf("Upload response: %s", string(respBody))
 
-	if resp.StatusCode != http.StatusCreated {
-		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
 	}
 
 	var result map[string]interface{}
 	json.Unmarshal(respBody, &result)
 
 	data, _ := result["data"].(map[string]interface{})
-	doc, _ := data["document"].(map[string]interface{})
-	id, _ := doc["id"].(float64)
+	id, _ := data["document_id"].(float64)
 
 	return uint(id)
 }
@@ -188,9 +191,10 @@ func uploadDuplicateDocument(t *testing.T, token string, kbID uint, filename str
 		t.Fatalf("Failed to copy file content: %v", err)
 	}
 
+	w.WriteField("kb_id", fmt.Sprintf("%d", kbID))
 	w.Close()
 
-	req, _ := http.NewRequest("POST", fmt.Sprintf("%s/knowledge-bases/%d/documents", baseURL, kbID), &b)
+	req, _ := http.NewRequest("POST", baseURL+"/documents/upload", &b)
 	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Content-Type", w.FormDataContentType())
 
@@ -0,0 +1,116 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"eino-rag/internal/jobs"
+)
+
+// waitDone 读取更新直到通道关闭，返回读到的所有状态
+func waitDone(t *testing.T, updates <-chan jobs.Job) []jobs.Job {
+	t.Helper()
+	var seen []jobs.Job
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case job, open := <-updates:
+			if !open {
+				return seen
+			}
+			seen = append(seen, job)
+		case <-timeout:
+			t.Fatal("job did not finish")
+		}
+	}
+}
+
+func TestManager_ReportsProgressAndResult(t *testing.T) {
+	manager := jobs.NewManager(zap.NewNop())
+	release := make(chan struct{})
+
+	job := manager.Start("reindex", func(ctx context.Context, progress jobs.Reporter) (interface{}, error) {
+		<-release
+		progress.SetTotal(4)
+		for i := 1; i <= 4; i++ {
+			var err error
+			if i == 3 {
+				err = errors.New("embedding failed")
+			}
+			progress.Advance(fmt.Sprintf("document %d", i), err)
+		}
+		return map[string]int{"succeeded": 3}, nil
+	})
+	assert.Equal(t, jobs.StatusRunning, job.Status)
+
+	current, updates, cancel, ok := manager.Subscribe(job.ID)
+	require.True(t, ok)
+	defer cancel()
+	assert.Equal(t, job.ID, current.ID)
+	close(release)
+
+	seen := waitDone(t, updates)
+	require.NotEmpty(t, seen)
+	final := seen[len(seen)-1]
+
+	assert.Equal(t, jobs.StatusCompleted, final.Status)
+	assert.Equal(t, 4, final.Total)
+	assert.Equal(t, 4, final.Processed)
+	assert.Equal(t, 1, final.Failed)
+	assert.Equal(t, float64(100), final.Percent)
+	assert.Equal(t, []string{"document 3: embedding failed"}, final.Errors)
+	assert.Equal(t, map[string]int{"succeeded": 3}, final.Result)
+	assert.NotNil(t, final.FinishedAt)
+
+	stored, ok := manager.Get(job.ID)
+	require.True(t, ok)
+	assert.Equal(t, final.Status, stored.Status)
+}
+
+func TestManager_FailedAndPanickingJobs(t *testing.T) {
+	manager := jobs.NewManager(zap.NewNop())
+
+	for name, run := range map[string]jobs.RunFunc{
+		"error": func(ctx context.Context, progress jobs.Reporter) (interface{}, error) {
+			return nil, errors.New("milvus unavailable")
+		},
+		"panic": func(ctx context.Context, progress jobs.Reporter) (interface{}, error) {
+			panic("boom")
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			job := manager.Start(name, run)
+			require.Eventually(t, func() bool {
+				current, _ := manager.Get(job.ID)
+				return current.Done()
+			}, 5*time.Second, 10*time.Millisecond)
+
+			current, _ := manager.Get(job.ID)
+			assert.Equal(t, jobs.StatusFailed, current.Status)
+			assert.NotEmpty(t, current.Error)
+
+			// 已结束的任务订阅后立即得到关闭的通道
+			_, updates, cancel, ok := manager.Subscribe(job.ID)
+			require.True(t, ok)
+			defer cancel()
+			_, open := <-updates
+			assert.False(t, open)
+		})
+	}
+}
+
+func TestManager_UnknownJob(t *testing.T) {
+	manager := jobs.NewManager(zap.NewNop())
+
+	_, ok := manager.Get("missing")
+	assert.False(t, ok)
+	_, _, _, ok = manager.Subscribe("missing")
+	assert.False(t, ok)
+}
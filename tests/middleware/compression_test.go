@@ -0,0 +1,99 @@
+package middleware_test
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/middleware"
+)
+
+func newCompressionRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.Compression())
+	router.GET("/json", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"content": strings.Repeat("chunk content ", 200)})
+	})
+	router.GET("/small", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+	router.GET("/stream", func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream")
+		for i := 0; i < 3; i++ {
+			c.Writer.WriteString("data: " + strings.Repeat("x", 600) + "\n\n")
+			c.Writer.Flush()
+		}
+	})
+	return router
+}
+
+func get(router *gin.Engine, path, acceptEncoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCompression_LargeJSON(t *testing.T) {
+	router := newCompressionRouter()
+
+	w := get(router, "/json", "gzip, deflate")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Contains(t, w.Header().Values("Vary"), "Accept-Encoding")
+
+	reader, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(body), `{"content":"chunk content `))
+
+	// 客户端没有声明或明确拒绝 gzip 时不压缩
+	for _, accept := range []string{"", "gzip;q=0", "br"} {
+		w = get(router, "/json", accept)
+		assert.Empty(t, w.Header().Get("Content-Encoding"), accept)
+		assert.True(t, strings.HasPrefix(w.Body.String(), `{"content":`), accept)
+	}
+}
+
+func TestCompression_SkipsSmallResponsesAndStreams(t *testing.T) {
+	router := newCompressionRouter()
+
+	w := get(router, "/small", "gzip")
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.JSONEq(t, `{"ok":true}`, w.Body.String())
+
+	w = get(router, "/stream", "gzip")
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, 3, strings.Count(w.Body.String(), "data: "))
+	assert.True(t, w.Flushed)
+}
+
+func TestCompression_Configurable(t *testing.T) {
+	router := newCompressionRouter()
+	cfg := config.Get().Snapshot()
+	t.Cleanup(func() {
+		config.UpdateFromDB(map[string]string{
+			"compression_enabled":       "true",
+			"compression_content_types": strings.Join(cfg.CompressionContentTypes, ","),
+		})
+	})
+
+	config.UpdateFromDB(map[string]string{"compression_content_types": "text/plain"})
+	assert.Empty(t, get(router, "/json", "gzip").Header().Get("Content-Encoding"))
+
+	config.UpdateFromDB(map[string]string{"compression_content_types": "application/json", "compression_enabled": "false"})
+	assert.Empty(t, get(router, "/json", "gzip").Header().Get("Content-Encoding"))
+}
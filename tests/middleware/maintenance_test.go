@@ -0,0 +1,65 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/middleware"
+)
+
+func newMaintenanceRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	ok := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true}) }
+	router.GET("/documents", ok)
+	router.POST("/documents/upload", middleware.BlockDuringMaintenance(), ok)
+	return router
+}
+
+func serve(router *gin.Engine, method, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	return rec
+}
+
+func TestBlockDuringMaintenance(t *testing.T) {
+	ctx := context.Background()
+	t.Cleanup(func() { db.SetMaintenance(ctx, db.MaintenanceState{}) })
+	router := newMaintenanceRouter()
+
+	assert.Equal(t, http.StatusOK, serve(router, http.MethodPost, "/documents/upload").Code)
+
+	require.NoError(t, db.SetMaintenance(ctx, db.MaintenanceState{Enabled: true, Reason: "reindexing"}))
+	rec := serve(router, http.MethodPost, "/documents/upload")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), "reindexing")
+	// 读操作不受影响
+	assert.Equal(t, http.StatusOK, serve(router, http.MethodGet, "/documents").Code)
+
+	require.NoError(t, db.SetMaintenance(ctx, db.MaintenanceState{}))
+	assert.Equal(t, http.StatusOK, serve(router, http.MethodPost, "/documents/upload").Code)
+}
+
+func TestSetMaintenance_DisableClearsState(t *testing.T) {
+	ctx := context.Background()
+	t.Cleanup(func() { db.SetMaintenance(ctx, db.MaintenanceState{}) })
+
+	require.NoError(t, db.SetMaintenance(ctx, db.MaintenanceState{Enabled: true, Reason: "migration", StartedBy: 1}))
+	state, err := db.GetMaintenance(ctx)
+	require.NoError(t, err)
+	assert.True(t, state.Enabled)
+	assert.Equal(t, "migration", state.Reason)
+
+	// 关闭时一并清除原因，不残留上一次的信息
+	require.NoError(t, db.SetMaintenance(ctx, db.MaintenanceState{Reason: "ignored"}))
+	state, err = db.GetMaintenance(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, db.MaintenanceState{}, state)
+}
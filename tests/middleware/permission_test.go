@@ -0,0 +1,126 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/auth"
+	"eino-rag/internal/db"
+	"eino-rag/internal/handlers"
+	"eino-rag/internal/jobs"
+	"eino-rag/internal/models"
+	"eino-rag/internal/routes"
+	"eino-rag/internal/services/chat"
+	"eino-rag/tests/testutil"
+)
+
+// newAPIRouter 使用服务实际注册的路由表，处理器使用测试数据库和内存检索器
+func newAPIRouter(t *testing.T, h *testutil.Harness) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	chatService, err := chat.NewService(h.Documents, nil, h.Config, h.Logger)
+	require.NoError(t, err)
+	jobManager := jobs.NewManager(h.Logger)
+
+	router := gin.New()
+	routes.RegisterAPI(router, routes.Handlers{
+		Auth:          handlers.NewAuthHandler(h.Logger),
+		Document:      handlers.NewDocumentHandler(h.Documents, jobManager, h.Logger),
+		Chat:          handlers.NewChatHandler(chatService, h.Logger),
+		KnowledgeBase: handlers.NewKnowledgeBaseHandler(nil, h.Documents, h.Config, h.Logger),
+		System:        handlers.NewSystemHandler(h.Config, jobManager, nil, h.Logger),
+		User:          handlers.NewUserHandler(h.Logger),
+		Consistency:   handlers.NewConsistencyHandler(nil, h.Logger),
+		Retention:     handlers.NewRetentionHandler(nil, h.Logger),
+		Embedding:     handlers.NewEmbeddingHandler(nil, h.Logger),
+	})
+	return router
+}
+
+// serveAs 使用 token 中角色为 role 的用户请求接口，返回状态码
+func serveAs(t *testing.T, router *gin.Engine, role, method, path string) int {
+	t.Helper()
+	token, _, err := auth.GenerateToken(&models.User{ID: 1, Email: role + "@example.com", RoleName: role})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(method, path, strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+// uploadRoutes 会解析和索引文件的接口，包括对话附件
+var uploadRoutes = [][2]string{
+	{http.MethodPost, "/api/documents/upload"},
+	{http.MethodPost, "/api/documents/upload/stream"},
+	{http.MethodPost, "/api/documents/uploads"},
+	{http.MethodPatch, "/api/documents/uploads/session-1"},
+	{http.MethodPost, "/api/chat/conversations/conv-1/attach"},
+}
+
+func TestRequirePermission(t *testing.T) {
+	h := testutil.New(t)
+	router := newAPIRouter(t, h)
+	denied := []int{http.StatusUnauthorized, http.StatusForbidden}
+
+	// guest 不能上传，user 和 admin 可以，请求通过权限检查后由处理器校验参数
+	for _, route := range uploadRoutes {
+		method, path := route[0], route[1]
+		assert.Equal(t, http.StatusForbidden, serveAs(t, router, "guest", method, path), path)
+		assert.NotContains(t, denied, serveAs(t, router, "user", method, path), path)
+		assert.NotContains(t, denied, serveAs(t, router, "admin", method, path), path)
+	}
+
+	// 所有角色都可以检索
+	for _, role := range []string{"guest", "user", "admin"} {
+		assert.NotContains(t, denied, serveAs(t, router, role, http.MethodPost, "/api/documents/search"), role)
+	}
+
+	// 角色不存在时拒绝
+	assert.Equal(t, http.StatusForbidden, serveAs(t, router, "intern", http.MethodPost, "/api/documents/search"))
+
+	// 权限列表无法解析时返回500
+	require.NoError(t, db.GetDB().Create(&models.Role{Name: "broken", Level: 50, Permissions: "chat"}).Error)
+	assert.Equal(t, http.StatusInternalServerError, serveAs(t, router, "broken", http.MethodPost, "/api/documents/search"))
+}
+
+func TestCheckPermission(t *testing.T) {
+	testutil.New(t)
+
+	var roles []models.Role
+	require.NoError(t, db.GetDB().Find(&roles).Error)
+	byName := map[string]models.Role{}
+	for _, role := range roles {
+		byName[role.Name] = role
+	}
+
+	// 未预加载角色时按 RoleID 加载
+	guest := &models.User{RoleID: byName["guest"].ID}
+	allowed, err := auth.CheckPermission(guest, auth.PermissionUploadDoc)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	allowed, err = auth.CheckPermission(guest, auth.PermissionChat)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	user := byName["user"]
+	allowed, err = auth.CheckPermission(&models.User{Role: &user}, auth.PermissionUploadDoc)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	// all 拥有任何权限，空的权限列表没有任何权限
+	allowed, err = auth.RoleHasPermission(&models.Role{Level: 10, Permissions: `["all"]`}, "manage_users")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	allowed, err = auth.RoleHasPermission(&models.Role{Level: 10}, auth.PermissionChat)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+}
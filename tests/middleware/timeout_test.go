@@ -0,0 +1,78 @@
+package middleware_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/middleware"
+)
+
+// setRequestTimeouts 设置请求超时（秒），测试结束后恢复
+func setRequestTimeouts(t *testing.T, timeout, long string) {
+	cfg := config.Get().Snapshot()
+	config.UpdateFromDB(map[string]string{"request_timeout": timeout, "request_timeout_long": long})
+	t.Cleanup(func() {
+		config.UpdateFromDB(map[string]string{
+			"request_timeout":      strconv.Itoa(int(cfg.RequestTimeout.Seconds())),
+			"request_timeout_long": strconv.Itoa(int(cfg.LongRequestTimeout.Seconds())),
+		})
+	})
+}
+
+func newTimeoutRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	group := router.Group("", middleware.RequestTimeout())
+
+	// 等到请求 context 结束（到期或被取消）再写响应
+	slow := func(c *gin.Context) {
+		select {
+		case <-c.Request.Context().Done():
+		case <-time.After(1500 * time.Millisecond):
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "deadline exceeded"})
+	}
+	group.GET("/slow", slow)
+	group.GET("/slow/long", middleware.LongRequestTimeout(), slow)
+	group.GET("/slow/none", middleware.NoRequestTimeout(), slow)
+	group.GET("/silent", func(c *gin.Context) { <-c.Request.Context().Done() })
+	group.GET("/fast", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true}) })
+	return router
+}
+
+func TestRequestTimeout_ReturnsGatewayTimeout(t *testing.T) {
+	setRequestTimeouts(t, "1", "0")
+	router := newTimeoutRouter()
+
+	start := time.Now()
+	rec := serve(router, http.MethodGet, "/slow")
+	assert.Less(t, time.Since(start), 1400*time.Millisecond, "downstream work is cancelled at the deadline")
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Request timed out after 1s")
+	assert.NotContains(t, rec.Body.String(), "deadline exceeded")
+
+	// 处理函数没有写响应时同样返回 504
+	rec = serve(router, http.MethodGet, "/silent")
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+
+	assert.Equal(t, http.StatusOK, serve(router, http.MethodGet, "/fast").Code)
+}
+
+func TestRequestTimeout_RouteOverrides(t *testing.T) {
+	// 长时间操作不限制，普通请求 1 秒
+	setRequestTimeouts(t, "1", "0")
+	router := newTimeoutRouter()
+
+	for _, path := range []string{"/slow/long", "/slow/none"} {
+		start := time.Now()
+		rec := serve(router, http.MethodGet, path)
+		assert.GreaterOrEqual(t, time.Since(start), 1500*time.Millisecond, path)
+		assert.Equal(t, http.StatusInternalServerError, rec.Code, "%s: handler response is kept", path)
+	}
+}
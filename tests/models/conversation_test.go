@@ -0,0 +1,42 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"eino-rag/internal/models"
+)
+
+func TestConversationSortMessages(t *testing.T) {
+	// 流式回复晚于下一轮对话保存，追加顺序与发送顺序不一致
+	conv := &models.Conversation{Messages: []models.ChatMessage{
+		{Role: "user", Content: "first", Seq: 1},
+		{Role: "user", Content: "second", Seq: 3},
+		{Role: "assistant", Content: "second reply", Seq: 4},
+		{Role: "assistant", Content: "first reply", Seq: 2},
+	}}
+	conv.SortMessages()
+
+	var contents []string
+	for _, msg := range conv.Messages {
+		contents = append(contents, msg.Content)
+	}
+	assert.Equal(t, []string{"first", "first reply", "second", "second reply"}, contents)
+	assert.EqualValues(t, 4, conv.LastSeq())
+}
+
+func TestConversationSortMessages_LegacyMessages(t *testing.T) {
+	// 没有序号的旧消息按保存顺序补上序号，之后分配的序号排在它们后面
+	conv := &models.Conversation{Messages: []models.ChatMessage{
+		{Role: "user", Content: "old"},
+		{Role: "assistant", Content: "old reply"},
+	}}
+	conv.SortMessages()
+	assert.EqualValues(t, 2, conv.LastSeq())
+
+	conv.Messages = append(conv.Messages, models.ChatMessage{Role: "user", Content: "new", Seq: conv.LastSeq() + 1})
+	conv.SortMessages()
+	assert.Equal(t, "old", conv.Messages[0].Content)
+	assert.Equal(t, "new", conv.Messages[2].Content)
+}
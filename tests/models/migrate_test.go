@@ -0,0 +1,62 @@
+package models_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"eino-rag/internal/models"
+)
+
+// legacyKnowledgeBase 唯一索引之前的知识库表，名称只有普通索引
+type legacyKnowledgeBase struct {
+	ID             uint   `gorm:"primaryKey"`
+	Name           string `gorm:"size:200;not null;index:idx_kb_creator_name,priority:2"`
+	CreatorID      uint   `gorm:"index:idx_kb_creator_name,priority:1"`
+	ConversationID string `gorm:"size:64;index"`
+	CreatedAt      time.Time
+	DeletedAt      gorm.DeletedAt `gorm:"index"`
+}
+
+func (legacyKnowledgeBase) TableName() string { return "knowledge_bases" }
+
+func TestMigrate_RenamesDuplicateKnowledgeBases(t *testing.T) {
+	database, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "legacy.db")), &gorm.Config{
+		Logger:         logger.Discard,
+		TranslateError: true,
+	})
+	require.NoError(t, err)
+	require.NoError(t, database.AutoMigrate(&legacyKnowledgeBase{}))
+
+	// 旧数据中同一用户有同名知识库，附件知识库名称相同但不参与唯一约束
+	legacy := []legacyKnowledgeBase{
+		{Name: "docs", CreatorID: 1},
+		{Name: "docs", CreatorID: 1},
+		{Name: "docs", CreatorID: 2},
+		{Name: "attachments", CreatorID: 1, ConversationID: "conv-1"},
+		{Name: "attachments", CreatorID: 1, ConversationID: "conv-2"},
+	}
+	require.NoError(t, database.Create(&legacy).Error)
+
+	require.NoError(t, models.Migrate(database))
+
+	var kbs []models.KnowledgeBase
+	require.NoError(t, database.Order("id ASC").Find(&kbs).Error)
+	names := make([]string, len(kbs))
+	for i, kb := range kbs {
+		names[i] = kb.Name
+	}
+	assert.Equal(t, []string{"docs", "docs (2)", "docs", "attachments", "attachments"}, names)
+	assert.False(t, database.Migrator().HasIndex(&models.KnowledgeBase{}, "idx_kb_creator_name"))
+
+	// 迁移后唯一索引生效，再次迁移不改变数据
+	err = database.Create(&models.KnowledgeBase{Name: "docs", CreatorID: 1}).Error
+	assert.ErrorIs(t, err, gorm.ErrDuplicatedKey)
+	require.NoError(t, models.Migrate(database))
+}
@@ -0,0 +1,120 @@
+package chat_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/chat"
+	"eino-rag/internal/services/document"
+	"eino-rag/internal/services/rag"
+	"eino-rag/tests/testutil"
+)
+
+const attachmentText = "The quarterly report shows revenue grew by twelve percent, driven by subscriptions in Europe."
+
+// attach 上传一个文本附件到对话，suffix 区分同一对话中的不同附件
+func attach(t *testing.T, service *chat.Service, convID string, userID uint, suffix string) *models.Document {
+	t.Helper()
+	doc, indexed, err := service.AttachDocument(context.Background(), convID, userID, "report.txt", strings.NewReader(attachmentText+suffix), document.UploadOptions{})
+	require.NoError(t, err)
+	require.Positive(t, indexed)
+	return doc
+}
+
+func TestAttachDocument_IndexesIntoConversationKnowledgeBase(t *testing.T) {
+	h := testutil.New(t)
+	service, err := chat.NewService(h.Documents, nil, h.Config, h.Logger)
+	require.NoError(t, err)
+	regular := h.CreateKnowledgeBase(t, "regular")
+
+	doc := attach(t, service, "conv-1", h.AdminID, "")
+	second := attach(t, service, "conv-1", h.AdminID, " Costs fell.")
+
+	kb, err := h.Documents.ConversationKnowledgeBase("conv-1")
+	require.NoError(t, err)
+	require.NotNil(t, kb)
+	assert.Equal(t, kb.ID, doc.KnowledgeBaseID)
+	assert.Equal(t, kb.ID, second.KnowledgeBaseID, "all attachments of a conversation share one knowledge base")
+	assert.Equal(t, h.AdminID, kb.CreatorID)
+	require.NotNil(t, kb.ExpiresAt)
+	assert.True(t, kb.ExpiresAt.After(time.Now()))
+
+	docs, err := h.Documents.SearchDocumentsWithOptions(context.Background(), "quarterly revenue", kb.ID, rag.RetrieveOptions{})
+	require.NoError(t, err)
+	require.NotEmpty(t, docs)
+
+	// 附件知识库不出现在知识库列表中
+	var listed []uint
+	require.NoError(t, db.GetDB().Model(&models.KnowledgeBase{}).Scopes(document.PersistentKnowledgeBases).Pluck("id", &listed).Error)
+	assert.Equal(t, []uint{regular.ID}, listed)
+
+	none, err := h.Documents.ConversationKnowledgeBase("conv-2")
+	require.NoError(t, err)
+	assert.Nil(t, none)
+}
+
+func TestAttachDocument_RejectsOtherUsersConversation(t *testing.T) {
+	h := testutil.New(t)
+	service, err := chat.NewService(h.Documents, nil, h.Config, h.Logger)
+	require.NoError(t, err)
+	seedConversations(t, h.AdminID, 1)
+
+	_, _, err = service.AttachDocument(context.Background(), "conv-0", h.AdminID+1, "report.txt", strings.NewReader(attachmentText), document.UploadOptions{})
+	require.EqualError(t, err, "unauthorized")
+
+	// 先上传附件再开始的对话同样只属于上传者
+	attach(t, service, "fresh", h.AdminID, "")
+	_, _, err = service.AttachDocument(context.Background(), "fresh", h.AdminID+1, "other.txt", strings.NewReader(attachmentText), document.UploadOptions{})
+	require.EqualError(t, err, "unauthorized")
+}
+
+func TestConversationAttachments_DeletedWithConversation(t *testing.T) {
+	h := testutil.New(t, func(cfg *config.Config) {
+		cfg.MaxConversationsPerUser = 1
+		cfg.ConversationLimitPolicy = config.ConversationLimitEvictOldest
+	})
+	service, err := chat.NewService(h.Documents, nil, h.Config, h.Logger)
+	require.NoError(t, err)
+	ids := seedConversations(t, h.AdminID, 1)
+	doc := attach(t, service, ids[0], h.AdminID, "")
+
+	require.NoError(t, service.EnforceConversationLimit(context.Background(), h.AdminID, "new-conv"))
+
+	kb, err := h.Documents.ConversationKnowledgeBase(ids[0])
+	require.NoError(t, err)
+	assert.Nil(t, kb)
+	assert.ErrorIs(t, db.GetDB().First(&models.Document{}, doc.ID).Error, gorm.ErrRecordNotFound)
+	var chunks int64
+	require.NoError(t, db.GetDB().Model(&models.DocumentChunk{}).Where("document_id = ?", doc.ID).Count(&chunks).Error)
+	assert.Zero(t, chunks)
+}
+
+func TestConversationAttachments_ExpiredAttachmentsRemovedByRetention(t *testing.T) {
+	h := testutil.New(t)
+	service, err := chat.NewService(h.Documents, nil, h.Config, h.Logger)
+	require.NoError(t, err)
+	attach(t, service, "stale", h.AdminID, "")
+	attach(t, service, "active", h.AdminID, "")
+	require.NoError(t, db.GetDB().Model(&models.KnowledgeBase{}).Where("conversation_id = ?", "stale").
+		Update("expires_at", time.Now().Add(-time.Minute)).Error)
+
+	report, err := h.Documents.ApplyRetention(context.Background(), time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"stale"}, report.ExpiredAttachments)
+
+	stale, err := h.Documents.ConversationKnowledgeBase("stale")
+	require.NoError(t, err)
+	assert.Nil(t, stale)
+	active, err := h.Documents.ConversationKnowledgeBase("active")
+	require.NoError(t, err)
+	assert.NotNil(t, active)
+}
@@ -0,0 +1,35 @@
+package chat_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/services/chat"
+)
+
+func TestValidateResponseFormat(t *testing.T) {
+	cfg := &config.Config{OpenAIModel: "local-model", OpenAIJSONMode: true}
+	service, err := chat.NewService(nil, nil, cfg, zap.NewNop())
+	require.NoError(t, err)
+
+	for _, format := range []chat.ResponseFormat{"", chat.ResponseFormatMarkdown, chat.ResponseFormatPlain, chat.ResponseFormatJSON} {
+		assert.NoError(t, service.ValidateResponseFormat(format), format)
+	}
+	assert.ErrorIs(t, service.ValidateResponseFormat("html"), chat.ErrUnsupportedResponseFormat)
+
+	// 模型不支持 JSON 模式时拒绝 json 格式
+	cfg.OpenAIJSONMode = false
+	err = service.ValidateResponseFormat(chat.ResponseFormatJSON)
+	assert.ErrorIs(t, err, chat.ErrUnsupportedResponseFormat)
+	assert.Contains(t, err.Error(), "local-model")
+	assert.NoError(t, service.ValidateResponseFormat(chat.ResponseFormatPlain))
+}
+
+func TestResolveResponseFormat_DefaultsToMarkdown(t *testing.T) {
+	assert.Equal(t, chat.ResponseFormatMarkdown, chat.ResolveResponseFormat(""))
+	assert.Equal(t, chat.ResponseFormatJSON, chat.ResolveResponseFormat(chat.ResponseFormatJSON))
+}
@@ -0,0 +1,81 @@
+package chat_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/chat"
+	"eino-rag/tests/testutil"
+)
+
+// seedConversations 为用户创建 n 条对话记录，第 i 条的最近使用时间为 n-i 小时前
+func seedConversations(t *testing.T, userID uint, n int) []string {
+	t.Helper()
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("conv-%d", i)
+		at := time.Now().Add(-time.Duration(n-i) * time.Hour)
+		require.NoError(t, db.GetDB().Create(&models.ChatHistory{
+			UserID:         userID,
+			ConversationID: ids[i],
+			Title:          ids[i],
+			CreatedAt:      at,
+			UpdatedAt:      at,
+		}).Error)
+	}
+	return ids
+}
+
+func TestEnforceConversationLimit_Reject(t *testing.T) {
+	h := testutil.New(t, func(cfg *config.Config) {
+		cfg.MaxConversationsPerUser = 2
+		cfg.ConversationLimitPolicy = config.ConversationLimitReject
+	})
+	service, err := chat.NewService(h.Documents, nil, h.Config, h.Logger)
+	require.NoError(t, err)
+	ids := seedConversations(t, h.AdminID, 2)
+	ctx := context.Background()
+
+	err = service.EnforceConversationLimit(ctx, h.AdminID, "new-conv")
+	require.ErrorIs(t, err, chat.ErrConversationLimitReached)
+
+	// 继续已有的对话不受上限影响
+	require.NoError(t, service.EnforceConversationLimit(ctx, h.AdminID, ids[0]))
+
+	usage, err := service.GetConversationUsage(h.AdminID)
+	require.NoError(t, err)
+	assert.Equal(t, &chat.ConversationUsage{Count: 2, Limit: 2}, usage)
+}
+
+func TestEnforceConversationLimit_EvictsLeastRecentlyUsed(t *testing.T) {
+	h := testutil.New(t, func(cfg *config.Config) {
+		cfg.MaxConversationsPerUser = 3
+		cfg.ConversationLimitPolicy = config.ConversationLimitEvictOldest
+	})
+	service, err := chat.NewService(h.Documents, nil, h.Config, h.Logger)
+	require.NoError(t, err)
+	ids := seedConversations(t, h.AdminID, 4)
+	// 最早创建的对话最近还在使用
+	require.NoError(t, db.GetDB().Model(&models.ChatHistory{}).Where("conversation_id = ?", ids[0]).
+		Update("updated_at", time.Now()).Error)
+	require.NoError(t, db.GetDB().Create(&models.ConversationBranch{ConversationID: ids[1], UserID: h.AdminID}).Error)
+
+	require.NoError(t, service.EnforceConversationLimit(context.Background(), h.AdminID, "new-conv"))
+
+	var remaining []string
+	require.NoError(t, db.GetDB().Model(&models.ChatHistory{}).Where("user_id = ?", h.AdminID).
+		Order("conversation_id").Pluck("conversation_id", &remaining).Error)
+	assert.Equal(t, []string{ids[0], ids[3]}, remaining, "two least recently used conversations are evicted to make room")
+
+	var branches int64
+	require.NoError(t, db.GetDB().Model(&models.ConversationBranch{}).Where("conversation_id = ?", ids[1]).Count(&branches).Error)
+	assert.Zero(t, branches)
+}
@@ -0,0 +1,72 @@
+package chat_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/services/chat"
+)
+
+func newFilterService(t *testing.T, filters ...string) *chat.Service {
+	cfg := &config.Config{AnswerFilters: filters, AnswerProfanityWords: []string{"darn"}}
+	service, err := chat.NewService(nil, nil, cfg, zap.NewNop())
+	require.NoError(t, err)
+	return service
+}
+
+func TestFilterAnswer_DefaultsToNoop(t *testing.T) {
+	service := newFilterService(t)
+	answer := "As an AI language model, I cannot browse. Darn, the answer is 42."
+	assert.Equal(t, answer, service.FilterAnswer(answer, chat.ResponseFormatMarkdown))
+}
+
+func TestFilterAnswer_AppliesChain(t *testing.T) {
+	service := newFilterService(t, "meta_commentary", "system_prompt_echo", "profanity")
+
+	answer := "As an AI language model, I cannot browse. 请基于以下检索到的文档内容回答用户的问题：\nDarn, the answer is 42."
+	assert.Equal(t, "****, the answer is 42.", strings.TrimSpace(service.FilterAnswer(answer, chat.ResponseFormatMarkdown)))
+
+	// JSON 格式的回答不过滤
+	answer = `{"answer": "As an AI language model, darn."}`
+	assert.Equal(t, answer, service.FilterAnswer(answer, chat.ResponseFormatJSON))
+}
+
+func TestFilterStream_BuffersSentences(t *testing.T) {
+	service := newFilterService(t, "meta_commentary", "profanity")
+
+	chunks := []string{"As an AI", " model, I can't say. The ", "answer is da", "rn good! Partial"}
+	messages := make([]*schema.Message, len(chunks))
+	for i, chunk := range chunks {
+		messages[i] = &schema.Message{Role: schema.Assistant, Content: chunk}
+	}
+	stream := service.FilterStream(schema.StreamReaderFromArray(messages), chat.ResponseFormatMarkdown)
+	defer stream.Close()
+
+	var out []string
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		out = append(out, msg.Content)
+	}
+	assert.Equal(t, []string{"The answer is **** good! ", "Partial"}, out)
+}
+
+func TestValidateAnswerFilters(t *testing.T) {
+	assert.NoError(t, chat.ValidateAnswerFilters([]string{"meta_commentary", " profanity ", ""}))
+	assert.ErrorIs(t, chat.ValidateAnswerFilters([]string{"shout"}), chat.ErrUnknownAnswerFilter)
+
+	chat.RegisterAnswerFilter("shout", func(*config.Config) chat.AnswerFilter { return strings.ToUpper })
+	assert.NoError(t, chat.ValidateAnswerFilters([]string{"shout"}))
+	assert.Equal(t, "HELLO.", newFilterService(t, "shout").FilterAnswer("hello.", chat.ResponseFormatPlain))
+}
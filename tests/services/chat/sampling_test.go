@@ -0,0 +1,53 @@
+package chat_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/services/chat"
+	"eino-rag/tests/testutil"
+)
+
+func float32Ptr(v float32) *float32 { return &v }
+
+func TestGenerationParams_PassesThroughRequestedParams(t *testing.T) {
+	h := testutil.New(t)
+	service, err := chat.NewService(h.Documents, nil, h.Config, h.Logger)
+	require.NoError(t, err)
+
+	assert.Nil(t, service.GenerationParams(chat.ChatOptions{}))
+
+	params := service.GenerationParams(chat.ChatOptions{
+		Stop:             []string{"###"},
+		PresencePenalty:  float32Ptr(0.5),
+		FrequencyPenalty: float32Ptr(-0.25),
+	})
+	require.NotNil(t, params)
+	assert.Equal(t, []string{"###"}, params.Stop)
+	assert.InDelta(t, 0.5, *params.PresencePenalty, 1e-6)
+	assert.InDelta(t, -0.25, *params.FrequencyPenalty, 1e-6)
+}
+
+func TestGenerationParams_IgnoresUnsupportedParams(t *testing.T) {
+	h := testutil.New(t, func(cfg *config.Config) {
+		cfg.OpenAIUnsupportedParams = []string{chat.GenerationParamStop, chat.GenerationParamFrequencyPenalty}
+	})
+	service, err := chat.NewService(h.Documents, nil, h.Config, h.Logger)
+	require.NoError(t, err)
+
+	params := service.GenerationParams(chat.ChatOptions{
+		Stop:             []string{"###"},
+		PresencePenalty:  float32Ptr(0.5),
+		FrequencyPenalty: float32Ptr(0.5),
+	})
+	require.NotNil(t, params)
+	assert.Empty(t, params.Stop)
+	assert.Nil(t, params.FrequencyPenalty)
+	assert.InDelta(t, 0.5, *params.PresencePenalty, 1e-6)
+
+	// 只设置了不支持的参数时不保存任何生成参数
+	assert.Nil(t, service.GenerationParams(chat.ChatOptions{Stop: []string{"###"}}))
+}
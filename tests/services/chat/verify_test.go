@@ -0,0 +1,45 @@
+package chat_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/services/chat"
+)
+
+func TestParseVerification(t *testing.T) {
+	content := "```json\n" + `{"claims":[
+		{"claim":"Milvus 是向量数据库","supported":true},
+		{"claim":"Milvus 由 Google 开发","supported":false},
+		{"claim":"  ","supported":false}
+	]}` + "\n```"
+
+	verification, err := chat.ParseVerification(content)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Milvus 是向量数据库"}, verification.Supported)
+	assert.Equal(t, []string{"Milvus 由 Google 开发"}, verification.Unsupported)
+	assert.Contains(t, chat.VerificationNote(verification), "1 处内容")
+
+	_, err = chat.ParseVerification("all claims are supported")
+	require.Error(t, err)
+}
+
+func TestVerificationNote_EmptyWhenAllSupported(t *testing.T) {
+	assert.Empty(t, chat.VerificationNote(nil))
+	assert.Empty(t, chat.VerificationNote(&chat.AnswerVerification{Supported: []string{"a"}}))
+}
+
+func TestVerifyStreamReply_SkippedWithoutModel(t *testing.T) {
+	cfg := &config.Config{AnswerVerification: true, AnswerVerificationAction: config.AnswerVerificationNote}
+	service, err := chat.NewService(nil, nil, cfg, zap.NewNop())
+	require.NoError(t, err)
+
+	verification, note := service.VerifyStreamReply(context.Background(), &chat.StreamReply{Context: "[文档1] Milvus"}, "Milvus 由 Google 开发")
+	assert.Nil(t, verification)
+	assert.Empty(t, note)
+}
@@ -0,0 +1,100 @@
+package document_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/document"
+	"eino-rag/tests/testutil"
+)
+
+func TestStripBoilerplate_RepeatedLines(t *testing.T) {
+	pages := []string{
+		"ACME Corp Handbook   \nIntroduction to the handbook.\nConfidential — Page 1 of 4",
+		"ACME Corp Handbook\nVacation policy details.\nConfidential — Page 2 of 4",
+		"ACME Corp Handbook\nExpense policy details.\nConfidential — Page 3 of 4",
+		"Appendix without header.\nConfidential — Page 4 of 4",
+	}
+
+	result := document.StripBoilerplate(pages, document.BoilerplateOptions{
+		DetectRepeated: true,
+		MinRepeatRatio: 0.5,
+	})
+
+	assert.Equal(t, "Introduction to the handbook.\n\nVacation policy details.\n\nExpense policy details.\n\nAppendix without header.", result.Text)
+	require.Len(t, result.Removed, 2)
+	assert.Equal(t, document.RemovedBoilerplate{Line: "Confidential — Page 1 of 4", Count: 4}, result.Removed[0])
+	assert.Equal(t, document.RemovedBoilerplate{Line: "ACME Corp Handbook", Count: 3}, result.Removed[1])
+}
+
+func TestStripBoilerplate_TooFewPagesKeepsLines(t *testing.T) {
+	pages := []string{"Header\nFirst page.", "Header\nSecond page."}
+
+	result := document.StripBoilerplate(pages, document.BoilerplateOptions{
+		DetectRepeated: true,
+		MinRepeatRatio: 0.5,
+	})
+
+	assert.Equal(t, "Header\nFirst page.\n\nHeader\nSecond page.", result.Text)
+	assert.Empty(t, result.Removed)
+}
+
+func TestStripBoilerplate_Patterns(t *testing.T) {
+	patterns, err := document.CompileBoilerplatePatterns([]string{`^Draft$`, ` \[\d+\]`})
+	require.NoError(t, err)
+
+	result := document.StripBoilerplate([]string{"Draft\nGo was released in 2009 [1].\n\nIt is fast [2]."}, document.BoilerplateOptions{
+		Patterns: patterns,
+	})
+
+	assert.Equal(t, "Go was released in 2009.\n\nIt is fast.", result.Text)
+	assert.Len(t, result.Removed, 2)
+}
+
+func TestCompileBoilerplatePatterns_Invalid(t *testing.T) {
+	_, err := document.CompileBoilerplatePatterns([]string{"(unclosed"})
+	assert.ErrorIs(t, err, document.ErrInvalidBoilerplatePattern)
+}
+
+func TestUploadDocument_StripsBoilerplate(t *testing.T) {
+	h := testutil.New(t, func(cfg *config.Config) {
+		cfg.BoilerplateMinRepeatRatio = 0.5
+	})
+	kb := h.CreateKnowledgeBase(t, "boilerplate")
+	require.NoError(t, db.GetDB().Model(kb).Updates(map[string]interface{}{
+		"strip_boilerplate":    true,
+		"boilerplate_patterns": `["^DRAFT "]`,
+	}).Error)
+
+	pages := []string{
+		"Internal Guide\n" + goDoc + "\nPage 1",
+		"Internal Guide\nDRAFT " + milvusDoc + "\nPage 2",
+		"Internal Guide\nThe end.\nPage 3",
+	}
+	uploadText(t, h, kb.ID, "guide.txt", strings.Join(pages, "\f"))
+
+	var text models.DocumentText
+	require.NoError(t, db.GetDB().Joins("JOIN documents ON documents.id = document_texts.document_id").
+		Where("documents.knowledge_base_id = ?", kb.ID).First(&text).Error)
+	assert.Equal(t, goDoc+"\n\n"+milvusDoc+"\n\nThe end.", text.Content)
+}
+
+func TestUploadDocument_BoilerplateDisabledByDefault(t *testing.T) {
+	h := testutil.New(t)
+	kb := h.CreateKnowledgeBase(t, "plain")
+
+	content := "Header\nfirst\fHeader\nsecond\fHeader\nthird"
+	doc, _, err := h.Documents.UploadDocument(context.Background(), "plain.txt", strings.NewReader(content), kb.ID, h.AdminID, document.UploadOptions{})
+	require.NoError(t, err)
+
+	var text models.DocumentText
+	require.NoError(t, db.GetDB().Where("document_id = ?", doc.ID).First(&text).Error)
+	assert.Equal(t, content, text.Content)
+}
@@ -0,0 +1,60 @@
+package document_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/services/document"
+	"eino-rag/internal/services/rag"
+	"eino-rag/tests/testutil"
+)
+
+func TestResolveCandidateMultiplier(t *testing.T) {
+	cfg := &config.Config{RetrievalCandidateMultiplier: 4}
+	assert.Equal(t, 4, document.ResolveCandidateMultiplier(cfg, 0))
+	assert.Equal(t, 2, document.ResolveCandidateMultiplier(cfg, 2))
+	assert.Equal(t, document.MaxCandidateMultiplier, document.ResolveCandidateMultiplier(cfg, 50))
+
+	// 未配置时使用默认倍数
+	assert.Equal(t, 3, document.ResolveCandidateMultiplier(&config.Config{}, 0))
+}
+
+func TestSearchDocuments_CandidateMultiplier(t *testing.T) {
+	h := testutil.New(t, func(cfg *config.Config) {
+		cfg.ChunkSize = 100
+		cfg.ChunkOverlap = 0
+		cfg.RetrievalCandidateMultiplier = 1
+	})
+	kb := h.CreateKnowledgeBase(t, "candidates")
+
+	long := uploadText(t, h, kb.ID, "manual.txt", strings.Repeat("Retrieval service retrieval guide chapter. ", 8))
+	short := uploadText(t, h, kb.ID, "faq.txt", "Retrieval FAQ.")
+
+	// 只召回 topK 个候选时全部来自长文档，按文档限量后只剩一个结果
+	maxPerDoc := 1
+	results, err := h.Documents.SearchDocumentsWithOptions(context.Background(), "retrieval", kb.ID, rag.RetrieveOptions{TopK: 2, MaxChunksPerDoc: &maxPerDoc})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, long.ID, results[0].MetaData["doc_id"])
+
+	// 请求放大召回倍数后其他文档进入候选
+	results, err = h.Documents.SearchDocumentsWithOptions(context.Background(), "retrieval", kb.ID, rag.RetrieveOptions{
+		TopK:                2,
+		MaxChunksPerDoc:     &maxPerDoc,
+		CandidateMultiplier: 5,
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, long.ID, results[0].MetaData["doc_id"])
+	assert.Equal(t, short.ID, results[1].MetaData["doc_id"])
+
+	// 没有检索后处理时倍数不生效，仍只返回 topK 个
+	results, err = h.Documents.SearchDocumentsWithOptions(context.Background(), "retrieval", kb.ID, rag.RetrieveOptions{TopK: 2, CandidateMultiplier: 5})
+	require.NoError(t, err)
+	assert.Len(t, results, 2)
+}
@@ -0,0 +1,92 @@
+package document_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/document"
+	"eino-rag/tests/testutil"
+)
+
+// exportAll 导出知识库从 cursor 开始的 limit 个分块
+func exportAll(t *testing.T, h *testutil.Harness, kbID, cursor uint, limit int) []document.ChunkExport {
+	t.Helper()
+	var chunks []document.ChunkExport
+	n, err := h.Documents.ExportChunks(context.Background(), kbID, cursor, limit, func(batch []document.ChunkExport) error {
+		chunks = append(chunks, batch...)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, len(chunks), n)
+	return chunks
+}
+
+func TestExportChunks_ExportsKnowledgeBaseChunksInOrder(t *testing.T) {
+	h := testutil.New(t)
+	kb := h.CreateKnowledgeBase(t, "export")
+	other := h.CreateKnowledgeBase(t, "other")
+	first := uploadText(t, h, kb.ID, "go.txt", goDoc)
+	second := uploadText(t, h, kb.ID, "milvus.txt", milvusDoc)
+	uploadText(t, h, other.ID, "go.txt", goDoc)
+
+	var records []models.DocumentChunk
+	require.NoError(t, db.GetDB().Where("document_id IN ?", []uint{first.ID, second.ID}).Order("id").Find(&records).Error)
+	require.NotEmpty(t, records)
+
+	chunks := exportAll(t, h, kb.ID, 0, 0)
+	require.Len(t, chunks, len(records), "only chunks of the requested knowledge base are exported")
+	for i, chunk := range chunks {
+		assert.Equal(t, records[i].ChunkID, chunk.ID)
+		assert.Equal(t, records[i].Content, chunk.Content)
+		assert.Equal(t, kb.ID, chunk.Metadata.KnowledgeBaseID)
+		assert.Equal(t, records[i].DocumentID, chunk.Metadata.DocumentID)
+		assert.Equal(t, records[i].ChunkIndex, chunk.Metadata.ChunkIndex)
+		assert.Equal(t, records[i].ID, chunk.Metadata.Cursor)
+		assert.NotNil(t, chunk.Embedding)
+	}
+	assert.Equal(t, "go.txt", chunks[0].Metadata.FileName)
+}
+
+func TestExportChunks_PagesWithCursor(t *testing.T) {
+	h := testutil.New(t)
+	kb := h.CreateKnowledgeBase(t, "pages")
+	uploadText(t, h, kb.ID, "go.txt", goDoc)
+	uploadText(t, h, kb.ID, "milvus.txt", milvusDoc)
+	all := exportAll(t, h, kb.ID, 0, 0)
+	require.Greater(t, len(all), 1)
+
+	var paged []document.ChunkExport
+	cursor := uint(0)
+	for pages := 0; pages <= len(all); pages++ {
+		next, err := h.Documents.NextChunkCursor(kb.ID, cursor, 1)
+		require.NoError(t, err)
+		page := exportAll(t, h, kb.ID, cursor, 1)
+		require.Len(t, page, 1)
+		paged = append(paged, page...)
+		if next == 0 {
+			break
+		}
+		assert.Equal(t, page[0].Metadata.Cursor, next)
+		cursor = next
+	}
+	assert.Equal(t, all, paged)
+}
+
+func TestExportChunks_SkipsChunksWithoutVectors(t *testing.T) {
+	h := testutil.New(t)
+	kb := h.CreateKnowledgeBase(t, "missing")
+	removed := uploadText(t, h, kb.ID, "go.txt", goDoc)
+	kept := uploadText(t, h, kb.ID, "milvus.txt", milvusDoc)
+	require.NoError(t, h.Retriever.DeleteByDocument(context.Background(), removed.ID))
+
+	chunks := exportAll(t, h, kb.ID, 0, 0)
+	require.NotEmpty(t, chunks)
+	for _, chunk := range chunks {
+		assert.Equal(t, kept.ID, chunk.Metadata.DocumentID)
+	}
+}
@@ -0,0 +1,59 @@
+package document_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/document"
+	"eino-rag/tests/testutil"
+)
+
+// longDoc 按默认分块大小切分为多个分块
+var longDoc = strings.Repeat("Milvus stores embeddings and answers similarity queries over them. ", 60)
+
+func limitChunks(action config.ChunkLimitAction) func(cfg *config.Config) {
+	return func(cfg *config.Config) {
+		cfg.MaxChunksPerDocument = 2
+		cfg.ChunkLimitAction = action
+	}
+}
+
+func TestUploadDocument_RejectsTooManyChunks(t *testing.T) {
+	h := testutil.New(t, limitChunks(config.ChunkLimitReject))
+	kb := h.CreateKnowledgeBase(t, "limit")
+
+	_, _, err := h.Documents.UploadDocument(context.Background(), "long.txt", strings.NewReader(longDoc), kb.ID, h.AdminID, document.UploadOptions{})
+	require.ErrorIs(t, err, document.ErrTooManyChunks)
+	assert.Contains(t, err.Error(), "at most 2 allowed")
+
+	var count int64
+	require.NoError(t, db.GetDB().Model(&models.Document{}).Where("knowledge_base_id = ?", kb.ID).Count(&count).Error)
+	assert.Zero(t, count, "rejected documents leave no record behind")
+}
+
+func TestUploadDocument_TruncatesTooManyChunks(t *testing.T) {
+	h := testutil.New(t, limitChunks(config.ChunkLimitTruncate))
+	kb := h.CreateKnowledgeBase(t, "limit")
+
+	doc, indexed, err := h.Documents.UploadDocument(context.Background(), "long.txt", strings.NewReader(longDoc), kb.ID, h.AdminID, document.UploadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, indexed)
+	assert.Greater(t, doc.TruncatedChunks, 0)
+
+	var stored models.Document
+	require.NoError(t, db.GetDB().First(&stored, doc.ID).Error)
+	assert.Equal(t, models.DocumentStatusPartiallyIndexed, stored.Status)
+	assert.Equal(t, doc.TruncatedChunks, stored.TruncatedChunks)
+	assert.Contains(t, stored.StatusMessage, "dropped")
+
+	var chunks int64
+	require.NoError(t, db.GetDB().Model(&models.DocumentChunk{}).Where("document_id = ?", doc.ID).Count(&chunks).Error)
+	assert.EqualValues(t, 2, chunks)
+}
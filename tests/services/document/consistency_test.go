@@ -0,0 +1,60 @@
+package document_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/document"
+	"eino-rag/tests/testutil"
+)
+
+func TestReconciler_ReportsOrphansAndMissing(t *testing.T) {
+	h := testutil.New(t)
+	kb := h.CreateKnowledgeBase(t, "consistency")
+	healthy := uploadText(t, h, kb.ID, "go.txt", goDoc)
+	lost := uploadText(t, h, kb.ID, "milvus.txt", milvusDoc)
+	recent := uploadText(t, h, kb.ID, "recent.txt", goDoc+" recent")
+
+	ctx := context.Background()
+	const orphanID = 9999
+	require.NoError(t, h.Retriever.AddDocuments(ctx, []*schema.Document{{ID: "orphan_0", Content: "left behind"}}, kb.ID, orphanID))
+
+	// 向量丢失的文档：一个超过宽限期，一个刚刚写入
+	require.NoError(t, h.Retriever.DeleteByDocument(ctx, lost.ID))
+	require.NoError(t, h.Retriever.DeleteByDocument(ctx, recent.ID))
+	require.NoError(t, db.GetDB().Model(&models.Document{}).Where("id IN ?", []uint{healthy.ID, lost.ID}).
+		Update("updated_at", time.Now().Add(-time.Hour)).Error)
+
+	reconciler := document.NewReconciler(h.Documents, h.Retriever, h.Config, h.Logger)
+
+	report, err := reconciler.Check(ctx, false)
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.SQLDocuments)
+	assert.Equal(t, []uint{orphanID}, report.OrphanDocIDs)
+	assert.Empty(t, report.CleanedDocIDs, "cleanup is opt-in")
+	assert.Equal(t, []uint{lost.ID}, report.MissingDocIDs)
+
+	var flagged models.Document
+	require.NoError(t, db.GetDB().First(&flagged, lost.ID).Error)
+	assert.Equal(t, models.DocumentStatusFailed, flagged.Status)
+	assert.Equal(t, document.MissingVectorsMessage, flagged.StatusMessage)
+	var updatedKB models.KnowledgeBase
+	require.NoError(t, db.GetDB().First(&updatedKB, kb.ID).Error)
+	assert.Equal(t, 2, updatedKB.DocCount)
+
+	report, err = reconciler.Check(ctx, true)
+	require.NoError(t, err)
+	assert.Equal(t, []uint{orphanID}, report.CleanedDocIDs)
+	assert.Empty(t, report.MissingDocIDs, "already flagged documents are not flagged again")
+
+	report, err = reconciler.Check(ctx, true)
+	require.NoError(t, err)
+	assert.Empty(t, report.OrphanDocIDs)
+}
@@ -0,0 +1,45 @@
+package document_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/db"
+	"eino-rag/tests/testutil"
+)
+
+// installGuide 安装章节的正文分成多个分块，只有第一个分块包含章节标题
+var installGuide = "# Handbook\n\n## Installation\n\n" +
+	strings.Repeat("Download the release archive and unpack it into the target directory. ", 20) +
+	"\n\n```\n# not a heading\n```\n\n## Usage\n\nStart the server with the default configuration."
+
+func TestContextualEmbedding_MatchesSectionHeading(t *testing.T) {
+	h := testutil.New(t)
+	plain := h.CreateKnowledgeBase(t, "plain")
+	contextual := h.CreateKnowledgeBase(t, "contextual")
+	require.NoError(t, db.GetDB().Model(contextual).Update("contextual_embedding", true).Error)
+
+	uploadText(t, h, plain.ID, "guide.md", installGuide)
+	uploadText(t, h, contextual.ID, "guide.md", installGuide)
+
+	ctx := context.Background()
+	plainHits, err := h.Documents.SearchDocuments(ctx, "installation", plain.ID, 20)
+	require.NoError(t, err)
+	contextualHits, err := h.Documents.SearchDocuments(ctx, "installation", contextual.ID, 20)
+	require.NoError(t, err)
+
+	assert.Len(t, plainHits, 1, "only the chunk containing the heading matches without context")
+	assert.Greater(t, len(contextualHits), len(plainHits), "every chunk of the section matches with context")
+	for _, hit := range contextualHits {
+		assert.NotContains(t, hit.Content, "guide > ", "stored content is the original chunk")
+	}
+
+	usageHits, err := h.Documents.SearchDocuments(ctx, "handbook usage", contextual.ID, 20)
+	require.NoError(t, err)
+	require.NotEmpty(t, usageHits)
+	assert.Contains(t, usageHits[0].Content, "Start the server")
+}
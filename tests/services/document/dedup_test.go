@@ -0,0 +1,60 @@
+package document_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/services/document"
+	"eino-rag/tests/testutil"
+)
+
+func TestNormalizeContent(t *testing.T) {
+	a := document.NormalizeContent([]byte("\xef\xbb\xbfline one  \r\nline\t\ttwo\r\n\r\n\r\n\r\nline three\r\n\r\n"))
+	b := document.NormalizeContent([]byte("  line one\nline two\n\nline three"))
+	assert.Equal(t, "line one\nline two\n\nline three", string(a))
+	assert.Equal(t, a, b)
+
+	// 空行数量不影响结果，但段落之间的分隔保留
+	assert.NotEqual(t, document.NormalizeContent([]byte("a\n\nb")), document.NormalizeContent([]byte("a b")))
+}
+
+func TestContentHashes_PDFUsesRawHash(t *testing.T) {
+	hash, normalized := document.ContentHashes([]byte("%PDF-1.4 \r\n"), ".pdf")
+	assert.Equal(t, hash, normalized)
+
+	hash, normalized = document.ContentHashes([]byte("text \r\n"), ".txt")
+	assert.NotEqual(t, hash, normalized)
+}
+
+// multiLineDoc 多行文本，用于构造只有行尾不同的文件
+const multiLineDoc = goDoc + "\n\n" + milvusDoc + "\n"
+
+func TestUploadDocument_NormalizedDuplicate(t *testing.T) {
+	h := testutil.New(t, func(cfg *config.Config) {
+		cfg.DedupNormalize = true
+	})
+	kb := h.CreateKnowledgeBase(t, "dedup")
+
+	doc := uploadText(t, h, kb.ID, "go.txt", multiLineDoc)
+	assert.NotEmpty(t, doc.NormalizedHash)
+
+	crlf := strings.ReplaceAll(multiLineDoc, "\n", "\r\n") + "  \r\n"
+	_, _, err := h.Documents.UploadDocument(context.Background(), "go-windows.txt", strings.NewReader(crlf), kb.ID, h.AdminID, document.UploadOptions{})
+	assert.ErrorIs(t, err, document.ErrDuplicate)
+}
+
+func TestUploadDocument_ExactBytesWhenNormalizationDisabled(t *testing.T) {
+	h := testutil.New(t)
+	kb := h.CreateKnowledgeBase(t, "dedup")
+
+	first := uploadText(t, h, kb.ID, "go.txt", multiLineDoc)
+	second := uploadText(t, h, kb.ID, "go-windows.txt", strings.ReplaceAll(multiLineDoc, "\n", "\r\n"))
+
+	// 关闭规范化时仍保存规范化哈希，两者相同但不视为重复
+	assert.NotEqual(t, first.Hash, second.Hash)
+	assert.Equal(t, first.NormalizedHash, second.NormalizedHash)
+}
@@ -0,0 +1,89 @@
+package document_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"eino-rag/internal/services/document"
+)
+
+// fixtureDOCX 生成只包含 [Content_Types].xml 和 word/document.xml 的最小 docx
+func fixtureDOCX(t *testing.T, body string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	files := map[string]string{
+		"[Content_Types].xml": `<?xml version="1.0" encoding="UTF-8"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"/>`,
+		"word/document.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+			body + `<w:sectPr/></w:body></w:document>`,
+	}
+	for name, content := range files {
+		f, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestParseDocument_DOCX(t *testing.T) {
+	parser := document.NewDocumentParser(zap.NewNop())
+	content := fixtureDOCX(t,
+		`<w:p><w:r><w:t>Deployment</w:t></w:r><w:r><w:t xml:space="preserve"> guide</w:t></w:r></w:p>`+
+			`<w:p/>`+
+			`<w:p><w:r><w:t>Name</w:t><w:tab/><w:t>Value</w:t></w:r></w:p>`+
+			`<w:p><w:r><w:t>kept</w:t><w:delText>removed</w:delText></w:r></w:p>`+
+			`<w:tbl>`+
+			`<w:tr><w:tc><w:p><w:r><w:t>Port</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>8080</w:t></w:r></w:p></w:tc></w:tr>`+
+			`<w:tr><w:tc><w:p><w:r><w:t>Hosts</w:t></w:r></w:p></w:tc>`+
+			`<w:tc><w:p><w:r><w:t>a</w:t></w:r></w:p><w:p><w:r><w:t>b</w:t></w:r></w:p></w:tc></w:tr>`+
+			`<w:tr><w:tc><w:p/></w:tc><w:tc><w:p/></w:tc></w:tr>`+
+			`</w:tbl>`+
+			`<w:p><w:r><w:t>The end</w:t></w:r></w:p>`)
+
+	text, err := parser.ParseDocument("guide.docx", content)
+	require.NoError(t, err)
+	assert.Equal(t, "Deployment guide\nName\tValue\nkept\nPort | 8080\nHosts | a b\nThe end", text)
+
+	// 没有扩展名时根据内容识别
+	result, err := parser.ParseDocumentWithOptions("upload", content, document.ParseOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, ".docx", result.FileType)
+	assert.Equal(t, text, result.Text)
+}
+
+func TestParseDocument_DOCXEdgeCases(t *testing.T) {
+	parser := document.NewDocumentParser(zap.NewNop())
+
+	// 空文档解析为空文本
+	text, err := parser.ParseDocument("empty.docx", fixtureDOCX(t, `<w:p/>`))
+	require.NoError(t, err)
+	assert.Empty(t, text)
+
+	// 段落属性中的制表位和其他命名空间的同名元素不是正文
+	text, err = parser.ParseDocument("tabs.docx", fixtureDOCX(t,
+		`<w:p><w:pPr><w:tabs><w:tab w:val="left" w:pos="720"/></w:tabs></w:pPr>`+
+			`<w:r><w:t>Name</w:t><w:tab/><w:t>Value</w:t></w:r>`+
+			`<w:r xmlns:x="urn:example:other"><x:t>ignored</x:t><x:tab/></w:r></w:p>`))
+	require.NoError(t, err)
+	assert.Equal(t, "Name\tValue", text)
+
+	// 不是 zip 包或缺少正文时返回错误
+	_, err = parser.ParseDocument("broken.docx", []byte("not a zip"))
+	assert.Error(t, err)
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	_, err = w.Create("xl/workbook.xml")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	_, err = parser.ParseDocument("sheet.docx", buf.Bytes())
+	assert.ErrorContains(t, err, "word/document.xml not found")
+}
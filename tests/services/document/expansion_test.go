@@ -0,0 +1,44 @@
+package document_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/services/document"
+	"eino-rag/tests/testutil"
+)
+
+func TestSynonymVariants(t *testing.T) {
+	groups := document.ParseSynonymGroups("login | sign in | log in; delete|remove; lonely")
+	require.Len(t, groups, 2)
+
+	assert.Equal(t, []string{"How do I sign in?", "How do I log in?"}, document.SynonymVariants("How do I Login?", groups, 3))
+	assert.Equal(t, []string{"How do I sign in?"}, document.SynonymVariants("How do I login?", groups, 1))
+	// 只匹配整词
+	assert.Empty(t, document.SynonymVariants("loginname and deleted files", groups, 3))
+}
+
+func TestSearchDocuments_QueryExpansion(t *testing.T) {
+	h := testutil.New(t, func(cfg *config.Config) {
+		cfg.QueryExpansionSynonyms = "login|sign in"
+		cfg.QueryExpansionVariants = 2
+	})
+	kb := h.CreateKnowledgeBase(t, "expansion")
+	uploadText(t, h, kb.ID, "portal.md", "Open the portal and sign in with your company account.")
+	ctx := context.Background()
+
+	// 默认关闭，用词不同时检索不到
+	docs, err := h.Documents.SearchDocuments(ctx, "login", kb.ID, 5)
+	require.NoError(t, err)
+	assert.Empty(t, docs)
+
+	h.Config.QueryExpansion = true
+	docs, err = h.Documents.SearchDocuments(ctx, "login", kb.ID, 5)
+	require.NoError(t, err)
+	require.NotEmpty(t, docs)
+	assert.Contains(t, docs[0].Content, "sign in")
+}
@@ -0,0 +1,44 @@
+package document_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/rag"
+	"eino-rag/tests/testutil"
+)
+
+func TestFallbackSearch_MatchesFilenameAndSummary(t *testing.T) {
+	h := testutil.New(t, func(cfg *config.Config) {
+		cfg.RAGFallbackMaxDocs = 3
+	})
+	kb := h.CreateKnowledgeBase(t, "fallback")
+	handbook := uploadText(t, h, kb.ID, "Handbook.md", goDoc)
+	guide := uploadText(t, h, kb.ID, "guide.txt", milvusDoc)
+	require.NoError(t, db.GetDB().Model(&models.Document{}).Where("id = ?", guide.ID).
+		Update("summary", "Overview of a vector database").Error)
+
+	ctx := context.Background()
+	docs, err := h.Documents.FallbackSearch(ctx, "What does the handbook say?", kb.ID, rag.RetrieveOptions{})
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, goDoc, docs[0].Content)
+	assert.Equal(t, handbook.ID, docs[0].MetaData["doc_id"])
+	assert.Equal(t, rag.ChunkTypeFallback, docs[0].MetaData["type"])
+	assert.Equal(t, "Handbook.md", docs[0].MetaData["file_name"])
+
+	docs, err = h.Documents.FallbackSearch(ctx, "vector database", kb.ID, rag.RetrieveOptions{})
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, guide.ID, docs[0].MetaData["doc_id"])
+
+	docs, err = h.Documents.FallbackSearch(ctx, "is it on?", kb.ID, rag.RetrieveOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, docs)
+}
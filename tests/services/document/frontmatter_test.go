@@ -0,0 +1,101 @@
+package document_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/document"
+	"eino-rag/internal/services/rag"
+	"eino-rag/tests/testutil"
+)
+
+func TestExtractFrontmatter_YAML(t *testing.T) {
+	text := "---\ntitle: Deployment Guide\nauthor: [Alice, Bob]\ntags: [ops, Go, go, \" \"]\ndate: 2024-03-01\nlayout: post\n---\n\n# Deploy\nSteps.\n"
+
+	fm, body, err := document.ExtractFrontmatter(text)
+	require.NoError(t, err)
+	require.NotNil(t, fm)
+	assert.Equal(t, "Deployment Guide", fm.Title)
+	assert.Equal(t, "Alice, Bob", fm.Author)
+	assert.Equal(t, []string{"ops", "Go"}, fm.Tags)
+	require.NotNil(t, fm.Date)
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), fm.Date.UTC())
+	assert.Equal(t, "# Deploy\nSteps.\n", body)
+}
+
+func TestExtractFrontmatter_TOML(t *testing.T) {
+	text := "+++\ntitle = \"Release Notes\"\ntags = \"release, changelog\"\ndate = 2024-05-06T10:00:00Z\n+++\nBody text"
+
+	fm, body, err := document.ExtractFrontmatter(text)
+	require.NoError(t, err)
+	require.NotNil(t, fm)
+	assert.Equal(t, "Release Notes", fm.Title)
+	assert.Equal(t, []string{"release", "changelog"}, fm.Tags)
+	require.NotNil(t, fm.Date)
+	assert.Equal(t, time.Date(2024, 5, 6, 10, 0, 0, 0, time.UTC), fm.Date.UTC())
+	assert.Equal(t, "Body text", body)
+}
+
+func TestExtractFrontmatter_LeavesOtherTextUnchanged(t *testing.T) {
+	for _, text := range []string{
+		"# Title\n\nNo frontmatter here.",
+		"---\n# Heading after a rule\n---\nText",
+		"---\ntitle: unterminated\n\nText",
+		"--- not a delimiter\ntitle: x\n---\n",
+	} {
+		fm, body, err := document.ExtractFrontmatter(text)
+		require.NoError(t, err, text)
+		assert.Nil(t, fm, text)
+		assert.Equal(t, text, body)
+	}
+
+	text := "---\ntitle: [unclosed\n---\nText"
+	fm, body, err := document.ExtractFrontmatter(text)
+	assert.Error(t, err)
+	assert.Nil(t, fm)
+	assert.Equal(t, text, body)
+}
+
+func TestUploadMarkdown_FrontmatterAttributes(t *testing.T) {
+	h := testutil.New(t)
+	kb := h.CreateKnowledgeBase(t, "guides")
+
+	tagged := uploadText(t, h, kb.ID, "deploy.md", "---\ntitle: Deployment Guide\nauthor: Alice\ntags: [ops, go]\n---\n"+goDoc)
+	plain := uploadText(t, h, kb.ID, "plain.md", milvusDoc)
+
+	var stored models.Document
+	require.NoError(t, db.GetDB().First(&stored, tagged.ID).Error)
+	assert.Equal(t, "Deployment Guide", stored.Title)
+	assert.Equal(t, "Alice", stored.Author)
+	assert.Equal(t, []string{"ops", "go"}, stored.Tags)
+
+	// 保存的全文不包含 frontmatter
+	var text models.DocumentText
+	require.NoError(t, db.GetDB().First(&text, "document_id = ?", tagged.ID).Error)
+	assert.Equal(t, goDoc, text.Content)
+	var plainText models.DocumentText
+	require.NoError(t, db.GetDB().First(&plainText, "document_id = ?", plain.ID).Error)
+	assert.Equal(t, milvusDoc, plainText.Content)
+
+	// 按标签过滤，检索结果附带 frontmatter 属性
+	results, err := h.Documents.SearchDocumentsWithOptions(context.Background(), "scalable", kb.ID, rag.RetrieveOptions{
+		Tags: []string{"OPS", "go"},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, tagged.ID, results[0].MetaData["doc_id"])
+	assert.Equal(t, "Deployment Guide", results[0].MetaData["doc_title"])
+	assert.Equal(t, []string{"ops", "go"}, results[0].MetaData["doc_tags"])
+
+	results, err = h.Documents.SearchDocumentsWithOptions(context.Background(), "scalable", kb.ID, rag.RetrieveOptions{
+		Tags: []string{"ops", "missing"},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+}
@@ -0,0 +1,103 @@
+package document_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/document"
+	"eino-rag/tests/testutil"
+)
+
+// docCount 读取知识库的 doc_count，包括软删除的知识库
+func docCount(t *testing.T, kbID uint) int {
+	t.Helper()
+	var kb models.KnowledgeBase
+	require.NoError(t, db.GetDB().Unscoped().First(&kb, kbID).Error)
+	return kb.DocCount
+}
+
+func TestSoftDeleteKnowledgeBase_HidesAndRestores(t *testing.T) {
+	h := testutil.New(t)
+	ctx := context.Background()
+	kb := h.CreateKnowledgeBase(t, "soft-delete")
+	doc := uploadText(t, h, kb.ID, "go.txt", goDoc)
+	vectors := h.Retriever.Count()
+
+	_, err := h.Documents.SoftDeleteKnowledgeBase(ctx, kb.ID)
+	require.NoError(t, err)
+
+	// 知识库不再可见，文档被标记且不参与检索，向量和 doc_count 保留
+	assert.ErrorIs(t, db.GetDB().First(&models.KnowledgeBase{}, kb.ID).Error, gorm.ErrRecordNotFound)
+	var marked models.Document
+	require.NoError(t, db.GetDB().First(&marked, doc.ID).Error)
+	assert.NotNil(t, marked.KnowledgeBaseDeletedAt)
+	assert.Equal(t, vectors, h.Retriever.Count())
+	assert.Equal(t, 1, docCount(t, kb.ID))
+	hits, err := h.Documents.SearchDocuments(ctx, "programming language", 0, 5)
+	require.NoError(t, err)
+	assert.Empty(t, hits)
+	docs, total, err := h.Documents.GetAllDocuments(1, 10)
+	require.NoError(t, err)
+	assert.Zero(t, total)
+	assert.Empty(t, docs)
+
+	restored, err := h.Documents.RestoreKnowledgeBase(ctx, kb.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, restored.DocCount)
+	require.NoError(t, db.GetDB().First(&models.KnowledgeBase{}, kb.ID).Error)
+	var unmarked models.Document
+	require.NoError(t, db.GetDB().First(&unmarked, doc.ID).Error)
+	assert.Nil(t, unmarked.KnowledgeBaseDeletedAt)
+	hits, err = h.Documents.SearchDocuments(ctx, "programming language", 0, 5)
+	require.NoError(t, err)
+	assert.NotEmpty(t, hits)
+
+	// 没有被删除的知识库不能恢复
+	_, err = h.Documents.RestoreKnowledgeBase(ctx, kb.ID)
+	assert.ErrorIs(t, err, document.ErrKnowledgeBaseNotDeleted)
+}
+
+func TestRestoreKnowledgeBase_NameTaken(t *testing.T) {
+	h := testutil.New(t)
+	ctx := context.Background()
+	kb := h.CreateKnowledgeBase(t, "reused")
+
+	_, err := h.Documents.SoftDeleteKnowledgeBase(ctx, kb.ID)
+	require.NoError(t, err)
+	h.CreateKnowledgeBase(t, "reused")
+
+	_, err = h.Documents.RestoreKnowledgeBase(ctx, kb.ID)
+	assert.ErrorIs(t, err, document.ErrKnowledgeBaseNameTaken)
+}
+
+func TestApplyRetention_PurgesAfterGracePeriod(t *testing.T) {
+	h := testutil.New(t, func(cfg *config.Config) {
+		cfg.KBDeleteGracePeriod = time.Hour
+	})
+	ctx := context.Background()
+	kb := h.CreateKnowledgeBase(t, "purge")
+	doc := uploadText(t, h, kb.ID, "go.txt", goDoc)
+	_, err := h.Documents.SoftDeleteKnowledgeBase(ctx, kb.ID)
+	require.NoError(t, err)
+
+	// 宽限期内保留
+	report, err := h.Documents.ApplyRetention(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, report.PurgedKnowledgeBases)
+	assert.NotZero(t, h.Retriever.Count())
+
+	report, err = h.Documents.ApplyRetention(ctx, time.Now().Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []uint{kb.ID}, report.PurgedKnowledgeBases)
+	assert.Zero(t, h.Retriever.Count())
+	assert.ErrorIs(t, db.GetDB().Unscoped().First(&models.KnowledgeBase{}, kb.ID).Error, gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, db.GetDB().First(&models.Document{}, doc.ID).Error, gorm.ErrRecordNotFound)
+}
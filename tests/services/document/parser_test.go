@@ -0,0 +1,62 @@
+package document_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"eino-rag/internal/services/document"
+)
+
+func TestDetectFileType(t *testing.T) {
+	parser := document.NewDocumentParser(zap.NewNop())
+
+	tests := []struct {
+		name     string
+		filename string
+		content  string
+		expected string
+	}{
+		{name: "known extension wins", filename: "notes.md", content: `{"a": 1}`, expected: ".md"},
+		{name: "pdf magic bytes", filename: "download", content: "%PDF-1.7\n...", expected: ".pdf"},
+		{name: "json object", filename: "clipboard", content: "  {\"name\": \"eino\"}\n", expected: ".json"},
+		{name: "json array", filename: "data.bin", content: `[1, 2, 3]`, expected: ".json"},
+		{name: "html document", filename: "page", content: "<!DOCTYPE html><html><body>hi</body></html>", expected: ".html"},
+		{name: "html fragment", filename: "page", content: "<body><p>hi</p></body>", expected: ".html"},
+		{name: "csv", filename: "export", content: "name,age\nalice,30\nbob,25\n", expected: ".csv"},
+		{name: "plain text", filename: "paste", content: "just some text, with a comma\nand another line", expected: ".txt"},
+		{name: "invalid json falls back to text", filename: "paste", content: "{not json", expected: ".txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileType, err := parser.DetectFileType(tt.filename, []byte(tt.content))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, fileType)
+		})
+	}
+}
+
+func TestDetectFileType_Unknown(t *testing.T) {
+	parser := document.NewDocumentParser(zap.NewNop())
+
+	for _, content := range [][]byte{
+		{0x89, 'P', 'N', 'G', 0x0d, 0x0a, 0x1a, 0x0a, 0x00},
+		{0xff, 0xfe, 0xfd},
+		[]byte("   "),
+	} {
+		_, err := parser.DetectFileType("upload", content)
+		assert.ErrorIs(t, err, document.ErrUnknownFileType)
+	}
+}
+
+func TestParseDocument_ExtensionlessJSON(t *testing.T) {
+	parser := document.NewDocumentParser(zap.NewNop())
+
+	result, err := parser.ParseDocumentWithOptions("clipboard", []byte(`{"b":1}`), document.ParseOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, ".json", result.FileType)
+	assert.Contains(t, result.Text, "\"b\": 1")
+}
@@ -0,0 +1,54 @@
+package document_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/document"
+	"eino-rag/tests/testutil"
+)
+
+const piiText = "Contact alice@example.com or 13812345678. ID 11010519491231002X, card 4111 1111 1111 1111, " +
+	"order 4111 1111 1111 1112, SSN 123-45-6789, server 10.0.0.12."
+
+func TestRedactPII(t *testing.T) {
+	result := document.RedactPII(piiText, document.PIICategories())
+
+	assert.Equal(t, "Contact [REDACTED_EMAIL] or [REDACTED_PHONE]. ID [REDACTED_ID_CARD], card [REDACTED_CREDIT_CARD], "+
+		"order 4111 1111 1111 1112, SSN [REDACTED_SSN], server [REDACTED_IP].", result.Text)
+	assert.Equal(t, map[string]int{"email": 1, "phone": 1, "id_card": 1, "credit_card": 1, "ssn": 1, "ip": 1}, result.Counts)
+	assert.Contains(t, result.Matches, document.PIIMatch{Category: "email", Value: "alice@example.com"})
+
+	emailOnly := document.RedactPII(piiText, []string{document.PIIEmail})
+	assert.Equal(t, map[string]int{"email": 1}, emailOnly.Counts)
+	assert.Contains(t, emailOnly.Text, "13812345678")
+
+	assert.ErrorIs(t, document.ValidatePIICategories([]string{"email", "address"}), document.ErrUnknownPIICategory)
+}
+
+func TestUploadDocument_RedactsPII(t *testing.T) {
+	h := testutil.New(t)
+	kb := h.CreateKnowledgeBase(t, "pii")
+	require.NoError(t, db.GetDB().Model(kb).Update("pii_redaction", `["email","phone"]`).Error)
+
+	doc := uploadText(t, h, kb.ID, "contacts.txt", piiText)
+	assert.Equal(t, map[string]int{"email": 1, "phone": 1}, doc.Redactions)
+
+	var text models.DocumentText
+	require.NoError(t, db.GetDB().First(&text, "document_id = ?", doc.ID).Error)
+	assert.NotContains(t, text.Content, "alice@example.com")
+	assert.NotContains(t, text.Content, "13812345678")
+	assert.Contains(t, text.Content, "123-45-6789", "categories not enabled are kept")
+
+	hits, err := h.Documents.SearchDocuments(context.Background(), "contact", kb.ID, 5)
+	require.NoError(t, err)
+	require.NotEmpty(t, hits)
+	for _, hit := range hits {
+		assert.NotContains(t, hit.Content, "alice@example.com")
+	}
+}
@@ -0,0 +1,68 @@
+package document_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/document"
+	"eino-rag/tests/testutil"
+)
+
+func TestBuildPreview(t *testing.T) {
+	// 去掉控制字符和双向文本控制符，合并连续空行
+	assert.Equal(t, "标题\n\n正文 evil", document.BuildPreview("  标题\n\n\n\n正文\x00 \u202eevil\r", "", 100))
+
+	// 按字符截断，不拆分多字节字符
+	assert.Equal(t, "一二三", document.BuildPreview("一二三四五", "", 3))
+
+	// PDF 预览不超过第一页
+	assert.Equal(t, "page one", document.BuildPreview("page one\n\npage two", "page one", 100))
+
+	assert.Empty(t, document.BuildPreview("text", "", 0))
+}
+
+func TestGetDocumentPreview_StoredAtUpload(t *testing.T) {
+	h := testutil.New(t, func(cfg *config.Config) {
+		cfg.DocumentPreviewLength = 20
+	})
+	kb := h.CreateKnowledgeBase(t, "preview")
+	require.NoError(t, db.GetDB().Model(kb).Update("pii_redaction", `["email"]`).Error)
+
+	doc := uploadText(t, h, kb.ID, "notes.txt", "Mail alice@example.com about the release plan and schedule.")
+
+	preview, err := h.Documents.GetDocumentPreview(doc.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "notes.txt", preview.FileName)
+	assert.Equal(t, kb.ID, preview.KnowledgeBaseID)
+	// 预览取自清理个人信息后的文本
+	assert.Equal(t, "Mail [REDACTED_EMAIL", preview.Preview)
+	assert.NotContains(t, preview.Preview, "alice")
+}
+
+func TestGetDocumentPreview_BackfillsOldDocuments(t *testing.T) {
+	h := testutil.New(t, func(cfg *config.Config) {
+		cfg.DocumentPreviewLength = 10
+	})
+	kb := h.CreateKnowledgeBase(t, "preview")
+	doc := uploadText(t, h, kb.ID, "old.txt", strings.Repeat("abcdefghij", 5))
+
+	// 模拟预览列加入之前上传的文档
+	require.NoError(t, db.GetDB().Model(&models.Document{}).Where("id = ?", doc.ID).UpdateColumn("preview", "").Error)
+
+	preview, err := h.Documents.GetDocumentPreview(doc.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "abcdefghij", preview.Preview)
+
+	var stored models.Document
+	require.NoError(t, db.GetDB().Select("preview").First(&stored, doc.ID).Error)
+	assert.Equal(t, "abcdefghij", stored.Preview)
+
+	_, err = h.Documents.GetDocumentPreview(doc.ID + 100)
+	assert.EqualError(t, err, "document not found")
+}
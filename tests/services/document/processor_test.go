@@ -0,0 +1,309 @@
+package document_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/services/document"
+)
+
+func newTestProcessor(cfg *config.Config) *document.DocumentProcessor {
+	return document.NewDocumentProcessor(cfg, zap.NewNop())
+}
+
+func TestEstimateTokens(t *testing.T) {
+	processor := newTestProcessor(&config.Config{
+		ChunkSize:        500,
+		ChunkOverlap:     50,
+		ChunkingStrategy: config.ChunkingStrategyLength,
+	})
+
+	tests := []struct {
+		name     string
+		text     string
+		expected int
+	}{
+		{name: "empty", text: "", expected: 0},
+		{name: "latin", text: "hello world, this is a test", expected: 7},
+		{name: "short latin rounds up", text: "hi", expected: 1},
+		{name: "chinese", text: "人工智能的发展历史", expected: 9},
+		{name: "chinese with punctuation", text: "你好，世界。", expected: 6},
+		{name: "japanese", text: "こんにちは", expected: 5},
+		{name: "korean", text: "안녕하세요", expected: 5},
+		{name: "mixed", text: "RAG系统使用Milvus存储向量", expected: 8 + 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, processor.EstimateTokens(tt.text))
+		})
+	}
+}
+
+func TestEstimateTokens_CJKNotUnderestimated(t *testing.T) {
+	processor := newTestProcessor(&config.Config{ChunkSize: 500})
+
+	// 同样字节数的中文应远多于英文的token估算
+	chinese := "检索增强生成结合了信息检索与文本生成"
+	latin := "retrieval augmented generation combines search and text generation"
+
+	assert.Equal(t, 18, processor.EstimateTokens(chinese))
+	assert.Greater(t, processor.EstimateTokens(chinese), len(chinese)/4)
+	assert.Equal(t, (len(latin)+3)/4, processor.EstimateTokens(latin))
+}
+
+// makeParagraphs 生成互不相同的段落，便于检查重叠和重复
+func makeParagraphs(count, words int) []string {
+	paragraphs := make([]string, count)
+	for i := range paragraphs {
+		parts := make([]string, words)
+		for j := range parts {
+			parts[j] = fmt.Sprintf("p%dw%d", i, j)
+		}
+		paragraphs[i] = strings.Join(parts, " ")
+	}
+	return paragraphs
+}
+
+func semanticChunks(t *testing.T, chunkSize, chunkOverlap int, paragraphs []string) []string {
+	t.Helper()
+	processor := newTestProcessor(&config.Config{
+		ChunkSize:        chunkSize,
+		ChunkOverlap:     chunkOverlap,
+		ChunkingStrategy: config.ChunkingStrategySemantic,
+	})
+
+	docs, err := processor.ProcessText(strings.Join(paragraphs, "\n\n"), nil)
+	require.NoError(t, err)
+
+	chunks := make([]string, len(docs))
+	for i, doc := range docs {
+		chunks[i] = doc.Content
+	}
+	return chunks
+}
+
+func TestSplitBySemantic_OverlapAppearsInNextChunk(t *testing.T) {
+	paragraphs := makeParagraphs(12, 20)
+	chunks := semanticChunks(t, 300, 40, paragraphs)
+	require.Greater(t, len(chunks), 2)
+
+	for i := 1; i < len(chunks); i++ {
+		prev := chunks[i-1]
+		lastWord := prev[strings.LastIndex(prev, " ")+1:]
+
+		// 重叠部分位于新块的第一个段落分隔符之前
+		sep := strings.Index(chunks[i], "\n\n")
+		require.Greater(t, sep, 0, "chunk %d should start with overlap", i)
+		overlap := chunks[i][:sep]
+		assert.LessOrEqual(t, len(overlap), 40)
+		assert.True(t, strings.HasSuffix(prev, overlap),
+			"chunk %d should carry the tail of chunk %d", i, i-1)
+		assert.Contains(t, overlap, lastWord)
+	}
+}
+
+func TestSplitBySemantic_OverlapRespectsLimits(t *testing.T) {
+	paragraphs := makeParagraphs(12, 20)
+	chunks := semanticChunks(t, 300, 40, paragraphs)
+
+	for i, chunk := range chunks {
+		assert.LessOrEqual(t, len(chunk), 300, "chunk %d exceeds chunk size", i)
+	}
+
+	// 每个段落只完整出现在一个块中
+	for _, para := range paragraphs {
+		count := 0
+		for _, chunk := range chunks {
+			if strings.Contains(chunk, para) {
+				count++
+			}
+		}
+		assert.Equal(t, 1, count, "paragraph %q duplicated or missing", para[:10])
+	}
+}
+
+func TestSplitBySemantic_NoOverlapWhenDisabled(t *testing.T) {
+	paragraphs := makeParagraphs(12, 20)
+	chunks := semanticChunks(t, 300, 0, paragraphs)
+	require.Greater(t, len(chunks), 2)
+
+	for i := 1; i < len(chunks); i++ {
+		assert.True(t, strings.HasPrefix(chunks[i], "p"), "chunk %d should start with a paragraph", i)
+		firstWord := chunks[i][:strings.Index(chunks[i], " ")]
+		assert.NotContains(t, chunks[i-1], firstWord+" ", "chunk %d should not overlap with previous chunk", i)
+	}
+}
+
+func TestSplitByLength_LargeInputFullyChunked(t *testing.T) {
+	processor := newTestProcessor(&config.Config{
+		ChunkSize:        100,
+		ChunkOverlap:     10,
+		ChunkingStrategy: config.ChunkingStrategyLength,
+	})
+
+	// 约 29 万字符，按 100 字符分块需要远超 1000 次迭代
+	words := make([]string, 40000)
+	for i := range words {
+		words[i] = fmt.Sprintf("w%d", i)
+	}
+	content := strings.Join(words, " ")
+
+	docs, err := processor.ProcessText(content, nil)
+	require.NoError(t, err)
+	require.Greater(t, len(docs), 1000)
+
+	seen := make(map[string]bool, len(words))
+	for _, doc := range docs {
+		for _, field := range strings.Fields(doc.Content) {
+			seen[field] = true
+		}
+	}
+	for _, word := range words {
+		require.True(t, seen[word], "word %q missing from chunks", word)
+	}
+	assert.True(t, strings.HasSuffix(docs[len(docs)-1].Content, words[len(words)-1]))
+}
+
+func TestMinChunkLength_MergesShortParagraphs(t *testing.T) {
+	processor := newTestProcessor(&config.Config{
+		ChunkSize:        60,
+		ChunkOverlap:     0,
+		ChunkingStrategy: config.ChunkingStrategySemantic,
+		MinChunkLength:   10,
+	})
+
+	// 标题和页码单独成块时信息量很低
+	content := strings.Join([]string{
+		"Intro",
+		strings.Repeat("alpha ", 9),
+		strings.Repeat("bravo ", 9),
+		"42",
+		strings.Repeat("charlie ", 7),
+	}, "\n\n")
+
+	docs, err := processor.ProcessText(content, nil)
+	require.NoError(t, err)
+	require.Len(t, docs, 3)
+
+	assert.True(t, strings.HasPrefix(docs[0].Content, "Intro\n\nalpha"), "leading short chunk merges forward")
+	assert.True(t, strings.HasSuffix(docs[1].Content, "bravo\n\n42"), "short chunk merges into previous")
+	for i, doc := range docs {
+		assert.Equal(t, i, doc.MetaData["chunk_index"])
+		assert.Equal(t, len(docs), doc.MetaData["total_chunks"])
+	}
+}
+
+func TestMinChunkLength_MergesWithoutRepeatingOverlap(t *testing.T) {
+	cfg := &config.Config{
+		ChunkSize:        60,
+		ChunkOverlap:     12,
+		ChunkingStrategy: config.ChunkingStrategyLength,
+	}
+	words := make([]string, 17)
+	for i := range words {
+		words[i] = fmt.Sprintf("w%02d", i)
+	}
+	content := strings.Join(words, " ")
+
+	unfiltered, err := newTestProcessor(cfg).ProcessText(content, nil)
+	require.NoError(t, err)
+	require.Len(t, unfiltered, 2)
+	require.Less(t, len(unfiltered[1].Content), 30)
+
+	// 末尾短块带有前一块的重叠，合并时只接上新内容
+	cfg.MinChunkLength = 30
+	filtered, err := newTestProcessor(cfg).ProcessText(content, nil)
+	require.NoError(t, err)
+	require.Len(t, filtered, 1)
+	assert.Equal(t, content, filtered[0].Content)
+}
+
+func TestMinChunkLength_KeepsShortDocument(t *testing.T) {
+	processor := newTestProcessor(&config.Config{
+		ChunkSize:        500,
+		ChunkingStrategy: config.ChunkingStrategySemantic,
+		MinChunkLength:   10,
+	})
+
+	docs, err := processor.ProcessText("FAQ\n\n42", nil)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, "FAQ\n\n42", docs[0].Content)
+}
+
+// mixedParagraphs 生成短段落中夹着一个由多句话组成、远超块大小的段落
+func mixedParagraphs() (short []string, huge string) {
+	short = makeParagraphs(6, 8)
+	sentences := make([]string, 40)
+	for i := range sentences {
+		sentences[i] = fmt.Sprintf("Sentence h%d explains one more detail of the topic.", i)
+	}
+	return short, strings.Join(sentences, " ")
+}
+
+func TestSplitBySemantic_OversizedParagraphProducesUniformChunks(t *testing.T) {
+	short, huge := mixedParagraphs()
+	paragraphs := append(append(append([]string{}, short[:3]...), huge), short[3:]...)
+	chunks := semanticChunks(t, 300, 40, paragraphs)
+	require.Greater(t, len(chunks), 4)
+
+	for i, chunk := range chunks {
+		assert.LessOrEqual(t, len(chunk), 300, "chunk %d exceeds chunk size", i)
+		if i < len(chunks)-1 {
+			assert.GreaterOrEqual(t, len(chunk), 150, "chunk %d is much smaller than its neighbours", i)
+		}
+	}
+
+	// 超长段落在句末拆分，末尾与后面的短段落合并在同一块中
+	joined := strings.Join(chunks, "\n")
+	for i := 0; i < 40; i++ {
+		assert.Contains(t, joined, fmt.Sprintf("Sentence h%d explains one more detail of the topic.", i))
+	}
+	var tail string
+	for _, chunk := range chunks {
+		if strings.Contains(chunk, "h39 explains") {
+			tail = chunk
+		}
+	}
+	assert.Contains(t, tail, short[3], "the end of the huge paragraph shares a chunk with the next paragraph")
+	for _, para := range short {
+		assert.Contains(t, joined, para)
+	}
+}
+
+func TestSplitBySemantic_OversizedParagraphKeepsOverlap(t *testing.T) {
+	_, huge := mixedParagraphs()
+	chunks := semanticChunks(t, 300, 40, []string{huge})
+	require.Greater(t, len(chunks), 2)
+
+	for i := 1; i < len(chunks); i++ {
+		// 重叠部分是上一块最后一句的末尾，位于新块的第一个完整句子之前
+		sep := strings.Index(chunks[i], " Sentence")
+		require.Greater(t, sep, 0, "chunk %d should start with overlap", i)
+		overlap := chunks[i][:sep]
+		assert.LessOrEqual(t, len(overlap), 40)
+		assert.True(t, strings.HasSuffix(chunks[i-1], overlap),
+			"chunk %d should carry the tail of chunk %d", i, i-1)
+	}
+}
+
+func TestSplitBySemantic_OversizedParagraphWithoutSpaces(t *testing.T) {
+	huge := strings.Repeat("检索增强生成结合了信息检索与文本生成", 40)
+	chunks := semanticChunks(t, 300, 30, []string{"简介", huge, "结尾"})
+	require.Greater(t, len(chunks), 2)
+
+	for i, chunk := range chunks {
+		assert.LessOrEqual(t, len(chunk), 300, "chunk %d exceeds chunk size", i)
+		assert.True(t, utf8.ValidString(chunk), "chunk %d splits a character", i)
+	}
+	assert.True(t, strings.HasPrefix(chunks[0], "简介\n\n"), "short paragraph joins the first piece of the huge paragraph")
+	assert.True(t, strings.HasSuffix(chunks[len(chunks)-1], "\n\n结尾"))
+}
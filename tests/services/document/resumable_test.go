@@ -0,0 +1,83 @@
+package document_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/document"
+	"eino-rag/tests/testutil"
+)
+
+// interruptedReader 读出 n 个字节后模拟连接中断
+type interruptedReader struct {
+	r io.Reader
+	n int
+}
+
+func (r *interruptedReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, errors.New("connection reset")
+	}
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	n, err := r.r.Read(p)
+	r.n -= n
+	return n, err
+}
+
+func TestResumableUpload(t *testing.T) {
+	h := testutil.New(t, func(cfg *config.Config) {
+		cfg.UploadSessionDir = t.TempDir()
+	})
+	kb := h.CreateKnowledgeBase(t, "resumable")
+	content := goDoc + "\n\n" + milvusDoc
+
+	session, err := h.Documents.NewUploadSession(h.AdminID, kb.ID, "notes.md", int64(len(content)), document.UploadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, models.UploadSessionUploading, session.Status)
+
+	// 第一个分片中途断开，已收到的部分保留
+	err = h.Documents.WriteUploadPart(session, 0, &interruptedReader{r: strings.NewReader(content[:40]), n: 25})
+	require.Error(t, err)
+	assert.EqualValues(t, 25, session.Offset)
+
+	// 从错误的位置继续会被拒绝
+	err = h.Documents.WriteUploadPart(session, 40, strings.NewReader(content[40:]))
+	require.ErrorIs(t, err, document.ErrUploadOffsetMismatch)
+
+	_, _, err = h.Documents.CompleteUpload(context.Background(), session)
+	require.ErrorIs(t, err, document.ErrUploadIncomplete)
+
+	// 超出声明大小的分片被拒绝，位置不变
+	err = h.Documents.WriteUploadPart(session, 25, strings.NewReader(content[25:]+"extra"))
+	require.ErrorIs(t, err, document.ErrUploadTooLarge)
+	assert.EqualValues(t, 25, session.Offset)
+
+	require.NoError(t, h.Documents.WriteUploadPart(session, 25, strings.NewReader(content[25:])))
+	assert.EqualValues(t, len(content), session.Offset)
+
+	doc, indexed, err := h.Documents.CompleteUpload(context.Background(), session)
+	require.NoError(t, err)
+	assert.Greater(t, indexed, 0)
+	assert.Equal(t, "notes.md", doc.FileName)
+	assert.EqualValues(t, len(content), doc.FileSize)
+}
+
+func TestNewUploadSession_RejectsOversizedFile(t *testing.T) {
+	h := testutil.New(t, func(cfg *config.Config) {
+		cfg.UploadSessionDir = t.TempDir()
+	})
+	kb := h.CreateKnowledgeBase(t, "resumable")
+
+	_, err := h.Documents.NewUploadSession(h.AdminID, kb.ID, "huge.pdf", h.Config.MaxUploadSize+1, document.UploadOptions{})
+	require.ErrorIs(t, err, document.ErrUploadTooLarge)
+}
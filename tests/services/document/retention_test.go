@@ -0,0 +1,91 @@
+package document_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+	"eino-rag/tests/testutil"
+)
+
+// backdate 将文档的创建时间改为 days 天前
+func backdate(t *testing.T, docID uint, days int) {
+	t.Helper()
+	require.NoError(t, db.GetDB().Model(&models.Document{}).Where("id = ?", docID).
+		Update("created_at", time.Now().AddDate(0, 0, -days)).Error)
+}
+
+func TestApplyRetention_DeletesExpiredDocuments(t *testing.T) {
+	h := testutil.New(t)
+	kb := h.CreateKnowledgeBase(t, "retention")
+	require.NoError(t, db.GetDB().Model(kb).Update("retention_days", 30).Error)
+	kept := h.CreateKnowledgeBase(t, "forever")
+
+	expired := uploadText(t, h, kb.ID, "old.txt", goDoc)
+	fresh := uploadText(t, h, kb.ID, "new.txt", milvusDoc)
+	untouched := uploadText(t, h, kept.ID, "old.txt", goDoc)
+	backdate(t, expired.ID, 45)
+	backdate(t, untouched.ID, 45)
+
+	report, err := h.Documents.ApplyRetention(context.Background(), time.Now())
+	require.NoError(t, err)
+	require.Len(t, report.KnowledgeBases, 1, "knowledge bases without retention keep their documents")
+	result := report.KnowledgeBases[0]
+	assert.Equal(t, kb.ID, result.KnowledgeBaseID)
+	assert.Equal(t, models.RetentionDelete, result.Action)
+	assert.Equal(t, []uint{expired.ID}, result.DocIDs)
+	assert.Empty(t, result.FailedDocIDs)
+
+	var count int64
+	require.NoError(t, db.GetDB().Model(&models.Document{}).Where("id = ?", expired.ID).Count(&count).Error)
+	assert.Zero(t, count)
+	require.NoError(t, db.GetDB().Model(&models.Document{}).Where("id IN ?", []uint{fresh.ID, untouched.ID}).Count(&count).Error)
+	assert.EqualValues(t, 2, count)
+
+	var updated models.KnowledgeBase
+	require.NoError(t, db.GetDB().First(&updated, kb.ID).Error)
+	assert.Equal(t, 1, updated.DocCount)
+}
+
+func TestApplyRetention_ArchivesExpiredDocuments(t *testing.T) {
+	h := testutil.New(t)
+	kb := h.CreateKnowledgeBase(t, "archive")
+	require.NoError(t, db.GetDB().Model(kb).Updates(map[string]interface{}{
+		"retention_days":   7,
+		"retention_action": models.RetentionArchive,
+	}).Error)
+
+	doc := uploadText(t, h, kb.ID, "milvus.txt", milvusDoc)
+	backdate(t, doc.ID, 10)
+	ctx := context.Background()
+
+	report, err := h.Documents.ApplyRetention(ctx, time.Now())
+	require.NoError(t, err)
+	require.Len(t, report.KnowledgeBases, 1)
+	assert.Equal(t, models.RetentionArchive, report.KnowledgeBases[0].Action)
+	assert.Equal(t, []uint{doc.ID}, report.KnowledgeBases[0].DocIDs)
+
+	var archived models.Document
+	require.NoError(t, db.GetDB().First(&archived, doc.ID).Error)
+	assert.Equal(t, models.DocumentStatusArchived, archived.Status)
+	var chunks int64
+	require.NoError(t, db.GetDB().Model(&models.DocumentChunk{}).Where("document_id = ?", doc.ID).Count(&chunks).Error)
+	assert.Zero(t, chunks)
+	var updated models.KnowledgeBase
+	require.NoError(t, db.GetDB().First(&updated, kb.ID).Error)
+	assert.Equal(t, 0, updated.DocCount)
+
+	found, err := h.Documents.SearchDocuments(ctx, "Milvus", kb.ID, 5)
+	require.NoError(t, err)
+	assert.Empty(t, found, "archived documents are no longer retrievable")
+
+	// 已归档的文档不会被再次处理
+	report, err = h.Documents.ApplyRetention(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, report.KnowledgeBases)
+}
@@ -0,0 +1,86 @@
+package document_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+	"eino-rag/tests/testutil"
+)
+
+func TestSeedIfEmpty(t *testing.T) {
+	h := testutil.New(t)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.txt"), []byte(goDoc), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "milvus.md"), []byte(milvusDoc), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "blank.txt"), []byte("  \n"), 0o644))
+
+	result, err := h.Documents.SeedIfEmpty(context.Background(), dir, "samples")
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, 2, result.Imported)
+	assert.Equal(t, 1, result.Failed)
+
+	var kb models.KnowledgeBase
+	require.NoError(t, db.GetDB().First(&kb, result.KnowledgeBaseID).Error)
+	assert.Equal(t, "samples", kb.Name)
+	assert.Equal(t, h.AdminID, kb.CreatorID)
+	assert.Equal(t, 2, kb.DocCount)
+	assert.Greater(t, h.Retriever.Count(), 0)
+
+	// 有文档失败时没有完成，下次启动继续导入，已导入的文档被跳过
+	result, err = h.Documents.SeedIfEmpty(context.Background(), dir, "samples")
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, kb.ID, result.KnowledgeBaseID)
+	assert.Equal(t, 0, result.Imported)
+	assert.Equal(t, 2, result.Skipped)
+	assert.Equal(t, 1, result.Failed)
+
+	// 全部导入后不再导入
+	require.NoError(t, os.Remove(filepath.Join(dir, "blank.txt")))
+	result, err = h.Documents.SeedIfEmpty(context.Background(), dir, "samples")
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.Zero(t, result.Failed)
+	result, err = h.Documents.SeedIfEmpty(context.Background(), dir, "samples")
+	require.NoError(t, err)
+	assert.Nil(t, result)
+
+	var kbCount int64
+	require.NoError(t, db.GetDB().Model(&models.KnowledgeBase{}).Count(&kbCount).Error)
+	assert.Equal(t, int64(1), kbCount)
+	require.NoError(t, db.GetDB().First(&kb, kb.ID).Error)
+	assert.Equal(t, 2, kb.DocCount)
+}
+
+func TestSeedIfEmpty_SkipsExistingDataAndConcurrentSeed(t *testing.T) {
+	h := testutil.New(t)
+	testutil.NewRedis(t)
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.txt"), []byte(goDoc), 0o644))
+
+	// 其他节点正在导入
+	lock, err := db.AcquireLock(context.Background(), "seed", time.Minute)
+	require.NoError(t, err)
+	result, err := h.Documents.SeedIfEmpty(context.Background(), dir, "samples")
+	require.NoError(t, err)
+	assert.Nil(t, result)
+	require.NoError(t, db.ReleaseLock(context.Background(), lock))
+
+	// 只有已软删除的知识库时数据库也不为空
+	kb := h.CreateKnowledgeBase(t, "deleted")
+	require.NoError(t, db.GetDB().Delete(kb).Error)
+	result, err = h.Documents.SeedIfEmpty(context.Background(), dir, "samples")
+	require.NoError(t, err)
+	assert.Nil(t, result)
+	assert.Zero(t, h.Retriever.Count())
+}
@@ -1,179 +1,296 @@
 package document_test
 
 import (
-	"bytes"
-	"crypto/sha256"
-	"fmt"
+	"context"
+	"strings"
 	"testing"
+	"time"
 
-	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/mock"
-	"go.uber.org/zap"
-	"gorm.io/driver/mysql"
-	"gorm.io/gorm"
+	"github.com/stretchr/testify/require"
 
+	"eino-rag/internal/config"
 	"eino-rag/internal/db"
 	"eino-rag/internal/models"
 	"eino-rag/internal/services/document"
+	"eino-rag/internal/services/rag"
+	"eino-rag/tests/testutil"
 )
 
-type MockParser struct {
-	mock.Mock
+const goDoc = "Go is an open source programming language that makes it simple to build secure, scalable systems."
+
+const milvusDoc = "Milvus is a vector database built for scalable similarity search and AI applications."
+
+func uploadText(t *testing.T, h *testutil.Harness, kbID uint, filename, content string) *models.Document {
+	t.Helper()
+
+	doc, indexed, err := h.Documents.UploadDocument(context.Background(), filename, strings.NewReader(content), kbID, h.AdminID, document.UploadOptions{})
+	require.NoError(t, err)
+	require.Greater(t, indexed, 0)
+	return doc
+}
+
+func TestUploadDocument_IndexesChunks(t *testing.T) {
+	h := testutil.New(t)
+	kb := h.CreateKnowledgeBase(t, "upload")
+
+	doc := uploadText(t, h, kb.ID, "go.txt", goDoc)
+
+	assert.Equal(t, models.DocumentStatusIndexed, doc.Status)
+	assert.Equal(t, ".txt", doc.FileType)
+	assert.Equal(t, int64(len(goDoc)), doc.FileSize)
+	assert.NotEmpty(t, doc.Hash)
+
+	var chunkCount int64
+	require.NoError(t, db.GetDB().Model(&models.DocumentChunk{}).Where("document_id = ?", doc.ID).Count(&chunkCount).Error)
+	assert.Equal(t, int64(h.Retriever.Count()), chunkCount)
+
+	var text models.DocumentText
+	require.NoError(t, db.GetDB().Where("document_id = ?", doc.ID).First(&text).Error)
+	assert.Equal(t, goDoc, text.Content)
+
+	var stored models.KnowledgeBase
+	require.NoError(t, db.GetDB().First(&stored, kb.ID).Error)
+	assert.Equal(t, 1, stored.DocCount)
 }
 
-func (m *MockParser) ParseDocument(filename string, data []byte) (string, error) {
-	args := m.Called(filename, data)
-	return args.String(0), args.Error(1)
+func TestUploadDocument_RejectsDuplicate(t *testing.T) {
+	h := testutil.New(t)
+	kb := h.CreateKnowledgeBase(t, "duplicate")
+
+	uploadText(t, h, kb.ID, "go.txt", goDoc)
+
+	_, _, err := h.Documents.UploadDocument(context.Background(), "copy.txt", strings.NewReader(goDoc), kb.ID, h.AdminID, document.UploadOptions{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already exists")
+
+	// 同样的内容可以上传到其他知识库
+	other := h.CreateKnowledgeBase(t, "other")
+	uploadText(t, h, other.ID, "go.txt", goDoc)
+}
+
+func TestUploadDocument_RejectsBlankText(t *testing.T) {
+	h := testutil.New(t)
+	kb := h.CreateKnowledgeBase(t, "blank")
+
+	_, _, err := h.Documents.UploadDocument(context.Background(), "blank.txt", strings.NewReader(" \n\t\r\n  "), kb.ID, h.AdminID, document.UploadOptions{})
+	require.ErrorIs(t, err, document.ErrNoText)
+
+	var docCount int64
+	require.NoError(t, db.GetDB().Model(&models.Document{}).Where("knowledge_base_id = ?", kb.ID).Count(&docCount).Error)
+	assert.Zero(t, docCount)
+	assert.Equal(t, 0, h.Retriever.Count())
 }
 
-type MockChunker struct {
-	mock.Mock
+func TestUploadDocument_UnknownKnowledgeBase(t *testing.T) {
+
+	h := testutil.New(t)
+
+	_, _, err := h.Documents.UploadDocument(context.Background(), "go.txt", strings.NewReader(goDoc), 999, h.AdminID, document.UploadOptions{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not found")
+	assert.Equal(t, 0, h.Retriever.Count())
 }
 
-func (m *MockChunker) ChunkText(text string, metadata map[string]interface{}) ([]*models.DocumentChunk, error) {
-	args := m.Called(text, metadata)
-	return args.Get(0).([]*models.DocumentChunk), args.Error(1)
+func TestUploadDocument_WithoutRetriever(t *testing.T) {
+	h := testutil.New(t)
+	kb := h.CreateKnowledgeBase(t, "offline")
+
+	service := document.NewService(document.NewDocumentParser(h.Logger), document.NewDocumentProcessor(h.Config, h.Logger), nil, nil, h.Config, h.Logger)
+	_, _, err := service.UploadDocument(context.Background(), "go.txt", strings.NewReader(goDoc), kb.ID, h.AdminID, document.UploadOptions{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not available")
 }
 
-type MockEmbedder struct {
-	mock.Mock
+func TestSearchDocuments_ScopedToKnowledgeBase(t *testing.T) {
+	h := testutil.New(t)
+	goKB := h.CreateKnowledgeBase(t, "go")
+	milvusKB := h.CreateKnowledgeBase(t, "milvus")
+
+	goDocument := uploadText(t, h, goKB.ID, "go.txt", goDoc)
+	uploadText(t, h, milvusKB.ID, "milvus.txt", milvusDoc)
+
+	results, err := h.Documents.SearchDocuments(context.Background(), "scalable programming language", goKB.ID, 0)
+	require.NoError(t, err)
+	require.NotEmpty(t, results)
+	for _, result := range results {
+		assert.Equal(t, goKB.ID, result.MetaData["kb_id"])
+		assert.Equal(t, goDocument.ID, result.MetaData["doc_id"])
+	}
+
+	results, err = h.Documents.SearchDocuments(context.Background(), "vector database", goKB.ID, 0)
+	require.NoError(t, err)
+	assert.Empty(t, results)
 }
 
-func (m *MockEmbedder) EmbedDocuments(chunks []*models.DocumentChunk) error {
-	args := m.Called(chunks)
-	return args.Error(0)
+func TestSearchDocuments_KnowledgeBaseDefaultTopK(t *testing.T) {
+	h := testutil.New(t, func(cfg *config.Config) {
+		cfg.ChunkSize = 100
+		cfg.ChunkOverlap = 0
+	})
+	kb := h.CreateKnowledgeBase(t, "faq")
+	require.NoError(t, db.GetDB().Model(kb).Update("default_top_k", 2).Error)
+
+	content := strings.Repeat("Question about the retrieval service and its answer. ", 20)
+	uploadText(t, h, kb.ID, "faq.txt", content)
+	require.Greater(t, h.Retriever.Count(), 2)
+
+	results, err := h.Documents.SearchDocumentsWithOptions(context.Background(), "retrieval", kb.ID, rag.RetrieveOptions{})
+	require.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	// 请求指定的 topK 优先于知识库默认值
+	results, err = h.Documents.SearchDocumentsWithOptions(context.Background(), "retrieval", kb.ID, rag.RetrieveOptions{TopK: 3})
+	require.NoError(t, err)
+	assert.Len(t, results, 3)
 }
 
-func setupTestDB(t *testing.T) (sqlmock.Sqlmock, func()) {
-	mockDB, mock, err := sqlmock.New()
-	assert.NoError(t, err)
+func TestSearchDocuments_RecencyDecay(t *testing.T) {
+	h := testutil.New(t)
+	kb := h.CreateKnowledgeBase(t, "changelog")
+
+	stale := uploadText(t, h, kb.ID, "v1.txt", "Release notes: the retrieval cache was added.")
+	fresh := uploadText(t, h, kb.ID, "v2.txt", "Release notes: retrieval latency was reduced.")
+	require.NoError(t, db.GetDB().Model(stale).Update("created_at", time.Now().AddDate(0, 0, -60)).Error)
+
+	// 未启用时按相似度排序，旧文档命中更多查询词
+	results, err := h.Documents.SearchDocumentsWithOptions(context.Background(), "retrieval cache", kb.ID, rag.RetrieveOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, stale.ID, results[0].MetaData["doc_id"])
 
-	dialector := mysql.New(mysql.Config{
-		Conn:                      mockDB,
-		SkipInitializeWithVersion: true,
+	weight := 0.6
+	results, err = h.Documents.SearchDocumentsWithOptions(context.Background(), "retrieval cache", kb.ID, rag.RetrieveOptions{
+		RecencyWeight:       &weight,
+		RecencyHalfLifeDays: 7,
 	})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, fresh.ID, results[0].MetaData["doc_id"])
+	assert.Equal(t, 0.5, results[0].MetaData["similarity"])
+	assert.Greater(t, results[0].MetaData["score"], results[1].MetaData["score"])
+
+	// 知识库设置在请求未指定时生效，请求可以关闭
+	require.NoError(t, db.GetDB().Model(kb).Updates(map[string]interface{}{"recency_weight": 0.6, "recency_half_life_days": 7}).Error)
+	results, err = h.Documents.SearchDocumentsWithOptions(context.Background(), "retrieval cache", kb.ID, rag.RetrieveOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, fresh.ID, results[0].MetaData["doc_id"])
+
+	off := 0.0
+	results, err = h.Documents.SearchDocumentsWithOptions(context.Background(), "retrieval cache", kb.ID, rag.RetrieveOptions{RecencyWeight: &off})
+	require.NoError(t, err)
+	assert.Equal(t, stale.ID, results[0].MetaData["doc_id"])
+}
 
-	gormDB, err := gorm.Open(dialector, &gorm.Config{})
-	assert.NoError(t, err)
+func TestSearchDocuments_MaxChunksPerDoc(t *testing.T) {
+	h := testutil.New(t, func(cfg *config.Config) {
+		cfg.ChunkSize = 100
+		cfg.ChunkOverlap = 0
+	})
+	kb := h.CreateKnowledgeBase(t, "diversity")
 
-	db.SetDB(gormDB)
+	long := uploadText(t, h, kb.ID, "manual.txt", strings.Repeat("Retrieval service retrieval guide chapter. ", 8))
+	short := uploadText(t, h, kb.ID, "faq.txt", "Retrieval FAQ.")
 
-	cleanup := func() {
-		mockDB.Close()
+	// 未启用时长文档的分块占满所有名额
+	results, err := h.Documents.SearchDocumentsWithOptions(context.Background(), "retrieval", kb.ID, rag.RetrieveOptions{TopK: 3})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	for _, result := range results {
+		assert.Equal(t, long.ID, result.MetaData["doc_id"])
 	}
 
-	return mock, cleanup
+	maxPerDoc := 2
+	results, err = h.Documents.SearchDocumentsWithOptions(context.Background(), "retrieval", kb.ID, rag.RetrieveOptions{TopK: 3, MaxChunksPerDoc: &maxPerDoc})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	counts := map[interface{}]int{}
+	for _, result := range results {
+		counts[result.MetaData["doc_id"]]++
+	}
+	assert.Equal(t, 2, counts[long.ID])
+	assert.Equal(t, 1, counts[short.ID])
 }
 
-func TestUploadDocument_NewDocument(t *testing.T) {
-	mock, cleanup := setupTestDB(t)
-	defer cleanup()
-
-	logger := zap.NewNop()
-	mockParser := new(MockParser)
-	mockChunker := new(MockChunker)
-	mockEmbedder := new(MockEmbedder)
-
-	service := document.NewService(logger, mockParser, mockChunker, mockEmbedder)
-
-	filename := "test.pdf"
-	kbID := uint(1)
-	userID := uint(1)
-	fileData := []byte("test content")
-	hash := fmt.Sprintf("%x", sha256.Sum256(fileData))
-
-	// 期望的查询：检查文档是否已存在
-	mock.ExpectQuery("SELECT \\* FROM `documents`").
-		WithArgs(hash, kbID).
-		WillReturnRows(sqlmock.NewRows([]string{})) // 返回空结果，模拟 record not found
-
-	// 期望的解析操作
-	mockParser.On("ParseDocument", filename, fileData).Return("parsed text content", nil)
-
-	// 期望开始事务
-	mock.ExpectBegin()
-
-	// 期望插入文档
-	mock.ExpectExec("INSERT INTO `documents`").
-		WithArgs(kbID, filename, int64(len(fileData)), hash, userID, sqlmock.AnyArg(), sqlmock.AnyArg()).
-		WillReturnResult(sqlmock.NewResult(1, 1))
-
-	// 模拟chunk操作
-	chunks := []*models.DocumentChunk{
-		{
-			DocumentID: 1,
-			ChunkIndex: 0,
-			Content:    "chunk 1",
-		},
+func TestSearchDocuments_FilterByCreatorAndDate(t *testing.T) {
+	h := testutil.New(t)
+	kb := h.CreateKnowledgeBase(t, "audited")
+
+	author := &models.User{Name: "author", Email: "author@example.com", Password: "x"}
+	require.NoError(t, db.GetDB().Create(author).Error)
+
+	adminDoc := uploadText(t, h, kb.ID, "admin.txt", goDoc)
+	doc, _, err := h.Documents.UploadDocument(context.Background(), "author.txt", strings.NewReader("Go modules manage dependencies."), kb.ID, author.ID, document.UploadOptions{})
+	require.NoError(t, err)
+	oldDoc, _, err := h.Documents.UploadDocument(context.Background(), "old.txt", strings.NewReader("Go 1.0 was released long ago."), kb.ID, author.ID, document.UploadOptions{})
+	require.NoError(t, err)
+	cutoff := time.Now().Add(-24 * time.Hour)
+	require.NoError(t, db.GetDB().Model(oldDoc).Update("created_at", cutoff.Add(-24*time.Hour)).Error)
+
+	// 创建者和时间条件同时生效
+	results, err := h.Documents.SearchDocumentsWithOptions(context.Background(), "go", kb.ID, rag.RetrieveOptions{
+		CreatorID:    author.ID,
+		CreatedAfter: &cutoff,
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, doc.ID, results[0].MetaData["doc_id"])
+	assert.Equal(t, author.ID, results[0].MetaData["creator_id"])
+	assert.Equal(t, "author", results[0].MetaData["creator_name"])
+	assert.IsType(t, time.Time{}, results[0].MetaData["doc_created_at"])
+
+	results, err = h.Documents.SearchDocumentsWithOptions(context.Background(), "go", kb.ID, rag.RetrieveOptions{
+		CreatedBefore: &cutoff,
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, oldDoc.ID, results[0].MetaData["doc_id"])
+
+	// 没有符合条件的文档时不检索
+	results, err = h.Documents.SearchDocumentsWithOptions(context.Background(), "go", kb.ID, rag.RetrieveOptions{
+		CreatorID: author.ID + 100,
+	})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	// 不过滤时结果也附带创建者
+	results, err = h.Documents.SearchDocumentsWithOptions(context.Background(), "go", kb.ID, rag.RetrieveOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	for _, result := range results {
+		if result.MetaData["doc_id"] == adminDoc.ID {
+			assert.Equal(t, h.AdminID, result.MetaData["creator_id"])
+		}
 	}
-	mockChunker.On("ChunkText", "parsed text content", mock.Anything).Return(chunks, nil)
-
-	// 期望批量插入chunks
-	mock.ExpectExec("INSERT INTO `document_chunks`").
-		WillReturnResult(sqlmock.NewResult(1, 1))
-
-	// 模拟embedding操作
-	mockEmbedder.On("EmbedDocuments", chunks).Return(nil)
-
-	// 期望更新chunks的embedding状态
-	mock.ExpectExec("UPDATE `document_chunks`").
-		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).
-		WillReturnResult(sqlmock.NewResult(0, 1))
-
-	// 期望提交事务
-	mock.ExpectCommit()
-
-	// 执行测试
-	doc, chunkCount, err := service.UploadDocument(filename, bytes.NewReader(fileData), kbID, userID)
-
-	// 验证结果
-	assert.NoError(t, err)
-	assert.NotNil(t, doc)
-	assert.Equal(t, filename, doc.FileName)
-	assert.Equal(t, hash, doc.Hash)
-	assert.Equal(t, 1, chunkCount)
-
-	// 验证所有期望都被满足
-	assert.NoError(t, mock.ExpectationsWereMet())
-	mockParser.AssertExpectations(t)
-	mockChunker.AssertExpectations(t)
-	mockEmbedder.AssertExpectations(t)
 }
 
-func TestUploadDocument_DuplicateDocument(t *testing.T) {
-	mock, cleanup := setupTestDB(t)
-	defer cleanup()
+func TestDeleteDocument_RemovesVectorsAndRecords(t *testing.T) {
+	h := testutil.New(t)
+	kb := h.CreateKnowledgeBase(t, "delete")
 
-	logger := zap.NewNop()
-	mockParser := new(MockParser)
-	mockChunker := new(MockChunker)
-	mockEmbedder := new(MockEmbedder)
+	doc := uploadText(t, h, kb.ID, "go.txt", goDoc)
+	kept := uploadText(t, h, kb.ID, "milvus.txt", milvusDoc)
+	before := h.Retriever.Count()
 
-	service := document.NewService(logger, mockParser, mockChunker, mockEmbedder)
+	require.NoError(t, h.Documents.DeleteDocument(context.Background(), doc.ID))
 
-	filename := "test.pdf"
-	kbID := uint(1)
-	userID := uint(1)
-	fileData := []byte("test content")
-	hash := fmt.Sprintf("%x", sha256.Sum256(fileData))
+	results, err := h.Documents.SearchDocuments(context.Background(), "programming language", kb.ID, 0)
+	require.NoError(t, err)
+	for _, result := range results {
+		assert.Equal(t, kept.ID, result.MetaData["doc_id"])
+	}
+	assert.Less(t, h.Retriever.Count(), before)
 
-	// 期望的查询：检查文档是否已存在
-	rows := sqlmock.NewRows([]string{"id", "knowledge_base_id", "file_name", "hash"}).
-		AddRow(1, kbID, filename, hash)
-	mock.ExpectQuery("SELECT \\* FROM `documents`").
-		WithArgs(hash, kbID).
-		WillReturnRows(rows) // 返回结果，表示文档已存在
+	var chunkCount, textCount int64
+	require.NoError(t, db.GetDB().Model(&models.DocumentChunk{}).Where("document_id = ?", doc.ID).Count(&chunkCount).Error)
+	require.NoError(t, db.GetDB().Model(&models.DocumentText{}).Where("document_id = ?", doc.ID).Count(&textCount).Error)
+	assert.Zero(t, chunkCount)
+	assert.Zero(t, textCount)
 
-	// 执行测试
-	doc, chunkCount, err := service.UploadDocument(filename, bytes.NewReader(fileData), kbID, userID)
+	var stored models.KnowledgeBase
+	require.NoError(t, db.GetDB().First(&stored, kb.ID).Error)
+	assert.Equal(t, 1, stored.DocCount)
 
-	// 验证结果
+	err = h.Documents.DeleteDocument(context.Background(), doc.ID)
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "document already exists in this knowledge base")
-	assert.Nil(t, doc)
-	assert.Equal(t, 0, chunkCount)
-
-	// 验证所有期望都被满足
-	assert.NoError(t, mock.ExpectationsWereMet())
-}
\ No newline at end of file
+}
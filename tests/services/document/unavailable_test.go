@@ -0,0 +1,39 @@
+package document_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"eino-rag/internal/services/document"
+	"eino-rag/internal/services/rag"
+	"eino-rag/tests/testutil"
+)
+
+func TestSearchDocuments_VectorStoreUnavailable(t *testing.T) {
+	h := testutil.New(t)
+	kb := h.CreateKnowledgeBase(t, "offline")
+	ctx := context.Background()
+
+	offline := document.NewService(document.NewDocumentParser(h.Logger), document.NewDocumentProcessor(h.Config, h.Logger), nil, nil, h.Config, h.Logger)
+	assert.False(t, offline.VectorStoreAvailable())
+	_, err := offline.SearchDocuments(ctx, "anything", kb.ID, 5)
+	require.Error(t, err)
+	assert.True(t, rag.IsVectorStoreUnavailable(err))
+
+	// 检索成功但没有结果不算不可用
+	assert.True(t, h.Documents.VectorStoreAvailable())
+	docs, err := h.Documents.SearchDocuments(ctx, "anything", kb.ID, 5)
+	require.NoError(t, err)
+	assert.Empty(t, docs)
+}
+
+func TestIsVectorStoreUnavailable(t *testing.T) {
+	assert.True(t, rag.IsVectorStoreUnavailable(fmt.Errorf("search: %w", rag.ErrCircuitOpen)))
+	assert.True(t, rag.IsVectorStoreUnavailable(fmt.Errorf("%w: milvus is not connected", rag.ErrVectorStoreUnavailable)))
+	assert.False(t, rag.IsVectorStoreUnavailable(fmt.Errorf("failed to generate query embedding")))
+	assert.False(t, rag.IsVectorStoreUnavailable(nil))
+}
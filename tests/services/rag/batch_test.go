@@ -0,0 +1,88 @@
+package rag_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/services/rag"
+)
+
+func indexedChunks(n int) []*schema.Document {
+	docs := make([]*schema.Document, n)
+	for i := range docs {
+		docs[i] = &schema.Document{ID: fmt.Sprintf("1_%d", i), Content: fmt.Sprintf("text-%d", i)}
+	}
+	return docs
+}
+
+func TestAddDocuments_BatchesOpenAIRequests(t *testing.T) {
+	cfg, requests := newOpenAIEmbeddings(t, 4)
+	cfg.CollectionName = "batch_test"
+	embedder, err := rag.NewEmbedder(cfg, zap.NewNop())
+	require.NoError(t, err)
+	fake := newPartitionMilvus()
+	retriever, err := rag.NewMilvusRetrieverWithClient(cfg, embedder, fake, zap.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() { retriever.Close() })
+
+	// 70 个分块只需要两个请求，向量按分块顺序写入
+	require.NoError(t, retriever.AddDocuments(context.Background(), indexedChunks(70), 1, 1))
+	assert.EqualValues(t, 2, requests.Load())
+	require.Len(t, fake.rows, 70)
+	for i, row := range fake.rows {
+		assert.Equal(t, fmt.Sprintf("1_%d", i), row.id)
+		assert.Equal(t, float32(i), row.embedding[0])
+	}
+}
+
+func TestAddDocuments_SkipFailedRetriesChunks(t *testing.T) {
+	server, _ := newIndexedOllama(t, 6, func(i int) bool { return i == 3 })
+	fake := newPartitionMilvus()
+	cfg := &config.Config{CollectionName: "batch_test", TopK: 5}
+	retriever, err := rag.NewMilvusRetrieverWithClient(cfg, newConcurrentEmbedding(server.URL, 2), fake, zap.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() { retriever.Close() })
+
+	// 不允许跳过时批量失败即整体失败
+	_, err = retriever.AddDocumentsWithOptions(context.Background(), indexedChunks(6), 1, 1, rag.AddOptions{})
+	require.Error(t, err)
+	assert.Empty(t, fake.rows)
+
+	// 允许跳过时逐个重试，只跳过失败的分块
+	result, err := retriever.AddDocumentsWithOptions(context.Background(), indexedChunks(6), 1, 1, rag.AddOptions{SkipFailed: true})
+	require.NoError(t, err)
+	assert.Equal(t, 5, result.Indexed)
+	assert.Equal(t, []string{"1_3"}, result.FailedChunkIDs)
+	assert.Len(t, fake.rows, 5)
+}
+
+func TestAddDocuments_ReportsEmbeddingProgress(t *testing.T) {
+	server, _ := newIndexedOllama(t, 25, func(i int) bool { return i == 3 })
+	fake := newPartitionMilvus()
+	cfg := &config.Config{CollectionName: "batch_test", TopK: 5}
+	retriever, err := rag.NewMilvusRetrieverWithClient(cfg, newConcurrentEmbedding(server.URL, 4), fake, zap.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() { retriever.Close() })
+
+	// 每 10 个分块和全部完成时报告一次
+	var reported [][2]int
+	progress := func(processed, total int) { reported = append(reported, [2]int{processed, total}) }
+	_, err = retriever.AddDocumentsWithOptions(context.Background(), indexedChunks(25)[4:], 1, 1, rag.AddOptions{Progress: progress})
+	require.NoError(t, err)
+	assert.Equal(t, [][2]int{{10, 21}, {20, 21}, {21, 21}}, reported)
+
+	// 逐个重试时同样报告，失败的分块也计入已完成
+	reported = nil
+	result, err := retriever.AddDocumentsWithOptions(context.Background(), indexedChunks(12), 1, 1, rag.AddOptions{SkipFailed: true, Progress: progress})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1_3"}, result.FailedChunkIDs)
+	require.NotEmpty(t, reported)
+	assert.Equal(t, [2]int{12, 12}, reported[len(reported)-1])
+}
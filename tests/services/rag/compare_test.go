@@ -0,0 +1,57 @@
+package rag_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/services/rag"
+	"eino-rag/tests/testutil"
+)
+
+func TestEmbedWithModel_UsesRequestedModel(t *testing.T) {
+	testutil.New(t)
+
+	// 每个模型返回不同维度的向量
+	dims := map[string]int{"bge-m3": 4, "nomic-embed-text": 8}
+	var models []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		models = append(models, req.Model)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"embedding": make([]float32, dims[req.Model]),
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := config.Load()
+	config.UpdateFromDB(map[string]string{
+		"vector_dim":               "4",
+		"embedding_dimension_mode": string(config.EmbeddingDimensionStrict),
+		"embedding_cache":          "false",
+		"ollama_url":               server.URL,
+		"embedding_model":          "bge-m3",
+	})
+	service := rag.NewEmbeddingService(cfg, zap.NewNop())
+
+	// 对比的模型不受配置维度的限制
+	embedding, err := service.EmbedWithModel(context.Background(), "nomic-embed-text", "hello")
+	require.NoError(t, err)
+	assert.Len(t, embedding, 8)
+	assert.Equal(t, 4, service.GetDimension())
+
+	embedding, err = service.EmbedText(context.Background(), "hello")
+	require.NoError(t, err)
+	assert.Len(t, embedding, 4)
+	assert.Equal(t, []string{"nomic-embed-text", "bge-m3"}, models)
+}
@@ -0,0 +1,81 @@
+package rag_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/rag"
+	"eino-rag/tests/testutil"
+)
+
+// newDimensionService 创建使用全局配置的向量化服务，模型返回 dim 维向量，配置的维度为4
+func newDimensionService(t *testing.T, mode config.EmbeddingDimensionMode, dim int) *rag.EmbeddingService {
+	testutil.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"embedding": make([]float32, dim),
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := config.Load()
+	config.UpdateFromDB(map[string]string{
+		"vector_dim":               "4",
+		"embedding_dimension_mode": string(mode),
+		"embedding_cache":          "false",
+		"ollama_url":               server.URL,
+	})
+	return rag.NewEmbeddingService(cfg, zap.NewNop())
+}
+
+func TestEmbedText_StrictDimensionMismatch(t *testing.T) {
+	service := newDimensionService(t, config.EmbeddingDimensionStrict, 8)
+
+	_, err := service.EmbedText(context.Background(), "hello")
+	require.ErrorIs(t, err, rag.ErrEmbeddingDimensionMismatch)
+	assert.Contains(t, err.Error(), "VECTOR_DIM=8")
+	assert.Equal(t, 4, service.GetDimension())
+}
+
+func TestEmbedText_AutoAdoptsDimension(t *testing.T) {
+	service := newDimensionService(t, config.EmbeddingDimensionAuto, 8)
+
+	embedding, err := service.EmbedText(context.Background(), "hello")
+	require.NoError(t, err)
+	assert.Len(t, embedding, 8)
+	assert.Equal(t, 8, service.GetDimension())
+
+	var stored models.SystemConfig
+	require.NoError(t, db.GetDB().First(&stored, "key = ?", "vector_dim").Error)
+	assert.Equal(t, "8", stored.Value)
+
+	var history models.ConfigHistory
+	require.NoError(t, db.GetDB().First(&history, "key = ?", "vector_dim").Error)
+	assert.Equal(t, "4", history.OldValue)
+	assert.Equal(t, "8", history.NewValue)
+}
+
+func TestEmbedText_AutoRejectedByCheck(t *testing.T) {
+	service := newDimensionService(t, config.EmbeddingDimensionAuto, 8)
+	rejected := errors.New("collection is not empty")
+	service.SetDimensionCheck(func(ctx context.Context, dim int) error {
+		assert.Equal(t, 8, dim)
+		return rejected
+	})
+
+	_, err := service.EmbedText(context.Background(), "hello")
+	require.ErrorIs(t, err, rejected)
+	assert.Equal(t, 4, service.GetDimension())
+}
@@ -0,0 +1,104 @@
+package rag_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/services/rag"
+)
+
+// newIndexedOllama 模拟 Ollama 的向量接口，文本 "text-<i>" 的向量第一维为 i
+// 序号越小响应越慢，并发时先发出的请求后完成；handler 返回非nil错误时响应500
+func newIndexedOllama(t *testing.T, total int, fail func(i int) bool) (*httptest.Server, *int64) {
+	var inFlight, peak int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt64(&inFlight, 1)
+		defer atomic.AddInt64(&inFlight, -1)
+		for {
+			old := atomic.LoadInt64(&peak)
+			if current <= old || atomic.CompareAndSwapInt64(&peak, old, current) {
+				break
+			}
+		}
+
+		var req struct {
+			Prompt string `json:"prompt"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		i, _ := strconv.Atoi(strings.TrimPrefix(req.Prompt, "text-"))
+		if fail != nil && fail(i) {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		time.Sleep(time.Duration(total-i) * time.Millisecond)
+
+		embedding := make([]float32, benchDimension)
+		embedding[0] = float32(i)
+		json.NewEncoder(w).Encode(map[string]interface{}{"embedding": embedding})
+	}))
+	t.Cleanup(server.Close)
+	return server, &peak
+}
+
+func newConcurrentEmbedding(url string, concurrency int) *rag.EmbeddingService {
+	return rag.NewEmbeddingService(&config.Config{
+		OllamaBaseURL:                url,
+		EmbeddingModel:               "test",
+		VectorDimension:              benchDimension,
+		EmbeddingMaxIdleConnsPerHost: concurrency,
+		EmbeddingConcurrency:         concurrency,
+	}, zap.NewNop())
+}
+
+func indexedTexts(n int) []string {
+	texts := make([]string, n)
+	for i := range texts {
+		texts[i] = fmt.Sprintf("text-%d", i)
+	}
+	return texts
+}
+
+func TestEmbedTexts_PreservesOrder(t *testing.T) {
+	const total = 20
+	server, peak := newIndexedOllama(t, total, nil)
+	service := newConcurrentEmbedding(server.URL, 4)
+
+	embeddings, err := service.EmbedTexts(context.Background(), indexedTexts(total))
+	require.NoError(t, err)
+	require.Len(t, embeddings, total)
+	for i, embedding := range embeddings {
+		assert.Equal(t, float32(i), embedding[0], "embedding %d out of order", i)
+	}
+	assert.Greater(t, atomic.LoadInt64(peak), int64(1), "requests should run concurrently")
+	assert.LessOrEqual(t, atomic.LoadInt64(peak), int64(4), "concurrency should be bounded")
+}
+
+func TestEmbedTexts_FailsFast(t *testing.T) {
+	const total = 50
+	var requests int64
+	server, _ := newIndexedOllama(t, total, func(i int) bool {
+		atomic.AddInt64(&requests, 1)
+		return i == 0
+	})
+	service := newConcurrentEmbedding(server.URL, 2)
+
+	embeddings, err := service.EmbedTexts(context.Background(), indexedTexts(total))
+	require.Error(t, err)
+	assert.Nil(t, embeddings)
+	assert.Contains(t, err.Error(), "failed to embed text 0")
+	// 第一个请求失败后不再分发剩余的文本
+	assert.Less(t, atomic.LoadInt64(&requests), int64(total))
+}
@@ -0,0 +1,181 @@
+package rag_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/services/rag"
+)
+
+const (
+	benchDimension   = 64
+	benchConcurrency = 16
+)
+
+// newFakeOllama 模拟 Ollama 的向量接口，并统计建立的连接数
+func newFakeOllama(b *testing.B) (*httptest.Server, *int64) {
+	var conns int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond) // 模拟模型推理耗时
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"embedding": make([]float32, benchDimension),
+		})
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&conns, 1)
+		}
+	}
+	server.Start()
+	b.Cleanup(server.Close)
+	return server, &conns
+}
+
+func benchmarkEmbedding(b *testing.B, idleConnsPerHost int) {
+	server, conns := newFakeOllama(b)
+	service := rag.NewEmbeddingService(&config.Config{
+		OllamaBaseURL:                server.URL,
+		EmbeddingModel:               "bench",
+		VectorDimension:              benchDimension,
+		EmbeddingMaxIdleConnsPerHost: idleConnsPerHost,
+	}, zap.NewNop())
+
+	// 按批并发向量化，与索引文档时分批处理分块的负载一致：
+	// 每批结束后连接回到连接池，空闲连接上限不足时多余的连接被关闭，下一批需要重新建连
+	b.ResetTimer()
+	for done := 0; done < b.N; done += benchConcurrency {
+		var wg sync.WaitGroup
+		for i := done; i < b.N && i < done+benchConcurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := service.EmbedText(context.Background(), "benchmark text"); err != nil {
+					b.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(atomic.LoadInt64(conns))/float64(b.N), "conns/op")
+}
+
+// BenchmarkEmbedText_DefaultPool 与 net/http 默认传输层相同，每个主机只保留2个空闲连接
+func BenchmarkEmbedText_DefaultPool(b *testing.B) {
+	benchmarkEmbedding(b, 2)
+}
+
+// BenchmarkEmbedText_TunedPool 空闲连接数与并发数匹配，连接可以复用
+func BenchmarkEmbedText_TunedPool(b *testing.B) {
+	benchmarkEmbedding(b, benchConcurrency)
+}
+
+func benchmarkEmbedTexts(b *testing.B, concurrency int) {
+	server, _ := newFakeOllama(b)
+	service := rag.NewEmbeddingService(&config.Config{
+		OllamaBaseURL:                server.URL,
+		EmbeddingModel:               "bench",
+		VectorDimension:              benchDimension,
+		EmbeddingMaxIdleConnsPerHost: benchConcurrency,
+		EmbeddingConcurrency:         concurrency,
+	}, zap.NewNop())
+
+	texts := make([]string, 64)
+	for i := range texts {
+		texts[i] = "benchmark text"
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := service.EmbedTexts(context.Background(), texts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkEmbedTexts_Sequential 逐个向量化一批文本
+func BenchmarkEmbedTexts_Sequential(b *testing.B) {
+	benchmarkEmbedTexts(b, 1)
+}
+
+// BenchmarkEmbedTexts_Concurrent 按 EMBEDDING_CONCURRENCY 并发向量化一批文本
+func BenchmarkEmbedTexts_Concurrent(b *testing.B) {
+	benchmarkEmbedTexts(b, benchConcurrency)
+}
+
+// newFakeOpenAIEmbeddings 模拟 OpenAI 兼容的向量接口，每个请求的耗时固定，与请求中的文本数无关
+func newFakeOpenAIEmbeddings(b *testing.B) *config.Config {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond) // 模拟网络往返和推理耗时
+		var req struct {
+			Input json.RawMessage `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		var inputs []string
+		if json.Unmarshal(req.Input, &inputs) != nil {
+			inputs = []string{""}
+		}
+		data := make([]map[string]interface{}, len(inputs))
+		for i := range inputs {
+			data[i] = map[string]interface{}{"index": i, "embedding": make([]float32, benchDimension)}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	b.Cleanup(server.Close)
+
+	serverURL, _ := url.Parse(server.URL)
+	return &config.Config{
+		EmbeddingModel:     "bench",
+		VectorDimension:    benchDimension,
+		OpenAIBaseURL:      server.URL + "/v1",
+		OpenAIAllowedHosts: []string{serverURL.Hostname()},
+	}
+}
+
+func benchmarkOpenAIEmbedTexts(b *testing.B, batched bool) {
+	embedder, err := rag.NewOpenAIEmbedder(newFakeOpenAIEmbeddings(b), zap.NewNop())
+	if err != nil {
+		b.Fatal(err)
+	}
+	texts := make([]string, 64)
+	for i := range texts {
+		texts[i] = "benchmark text"
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if batched {
+			if _, err := embedder.EmbedTexts(context.Background(), texts); err != nil {
+				b.Fatal(err)
+			}
+			continue
+		}
+		for _, text := range texts {
+			if _, err := embedder.EmbedText(context.Background(), text); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkOpenAIEmbedTexts_PerText 每个文本一个请求
+func BenchmarkOpenAIEmbedTexts_PerText(b *testing.B) {
+	benchmarkOpenAIEmbedTexts(b, false)
+}
+
+// BenchmarkOpenAIEmbedTexts_Batched 一个请求发送一批文本
+func BenchmarkOpenAIEmbedTexts_Batched(b *testing.B) {
+	benchmarkOpenAIEmbedTexts(b, true)
+}
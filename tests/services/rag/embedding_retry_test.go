@@ -0,0 +1,100 @@
+package rag_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/services/rag"
+)
+
+// newFlakyOllama 前 failures 个请求返回 status，之后正常返回向量
+func newFlakyOllama(t *testing.T, failures int64, status int) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var calls atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			http.Error(w, "model is busy", status)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"embedding": []float32{1, 0, 0, 0}})
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func newRetryingEmbedding(url string, retries int, backoff time.Duration) *rag.EmbeddingService {
+	return rag.NewEmbeddingService(&config.Config{
+		OllamaBaseURL:         url,
+		EmbeddingModel:        "test",
+		VectorDimension:       4,
+		EmbeddingMaxRetries:   retries,
+		EmbeddingRetryBackoff: backoff,
+	}, zap.NewNop())
+}
+
+func TestEmbedText_RetriesServerErrors(t *testing.T) {
+	server, calls := newFlakyOllama(t, 2, http.StatusInternalServerError)
+	service := newRetryingEmbedding(server.URL, 3, time.Millisecond)
+
+	embedding, err := service.EmbedText(context.Background(), "hello")
+	require.NoError(t, err)
+	assert.Equal(t, []float32{1, 0, 0, 0}, embedding)
+	assert.EqualValues(t, 3, calls.Load())
+}
+
+func TestEmbedText_GivesUpAfterMaxRetries(t *testing.T) {
+	server, calls := newFlakyOllama(t, 10, http.StatusBadGateway)
+	service := newRetryingEmbedding(server.URL, 2, time.Millisecond)
+
+	_, err := service.EmbedText(context.Background(), "hello")
+	var apiErr *rag.EmbeddingAPIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadGateway, apiErr.StatusCode)
+	assert.EqualValues(t, 3, calls.Load())
+}
+
+func TestEmbedText_DoesNotRetryClientErrors(t *testing.T) {
+	server, calls := newFlakyOllama(t, 1, http.StatusNotFound)
+	service := newRetryingEmbedding(server.URL, 3, time.Millisecond)
+
+	_, err := service.EmbedText(context.Background(), "hello")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ollama API error: 404")
+	assert.EqualValues(t, 1, calls.Load())
+}
+
+func TestEmbedText_RetriesNetworkErrors(t *testing.T) {
+	server, _ := newFlakyOllama(t, 0, http.StatusOK)
+	url := server.URL
+	server.Close()
+
+	// 服务不可达时每次都是网络错误，重试用尽后返回
+	service := newRetryingEmbedding(url, 2, time.Millisecond)
+	start := time.Now()
+	_, err := service.EmbedText(context.Background(), "hello")
+	require.Error(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 3*time.Millisecond, "waits 1ms then 2ms between attempts")
+}
+
+func TestEmbedText_RetryStopsWhenCanceled(t *testing.T) {
+	server, calls := newFlakyOllama(t, 10, http.StatusServiceUnavailable)
+	service := newRetryingEmbedding(server.URL, 3, time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := service.EmbedText(ctx, "hello")
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.EqualValues(t, 1, calls.Load())
+}
@@ -0,0 +1,153 @@
+package rag_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/services/rag"
+	"eino-rag/tests/testutil"
+)
+
+// failoverServers 主服务（Ollama）和备用服务（OpenAI 兼容接口）的测试服务器
+type failoverServers struct {
+	primaryDown   atomic.Bool
+	primaryCalls  atomic.Int32
+	failoverCalls atomic.Int32
+	failoverDim   int
+}
+
+// newFailoverService 创建开启故障转移的向量化服务，主服务连续失败 threshold 次后切换
+func newFailoverService(t *testing.T, threshold int, cooldown time.Duration) (*rag.EmbeddingService, *failoverServers) {
+	t.Helper()
+	testutil.New(t)
+	servers := &failoverServers{failoverDim: 4}
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		servers.primaryCalls.Add(1)
+		if servers.primaryDown.Load() {
+			http.Error(w, "model not loaded", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"embedding": []float32{1, 0, 0, 0}})
+	}))
+	t.Cleanup(primary.Close)
+
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		servers.failoverCalls.Add(1)
+		assert.Equal(t, "/v1/embeddings", r.URL.Path)
+		assert.Equal(t, "Bearer sk-test", r.Header.Get("Authorization"))
+		var req struct {
+			Model      string `json:"model"`
+			Input      string `json:"input"`
+			Dimensions int    `json:"dimensions"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "backup-embed", req.Model)
+		assert.Equal(t, 4, req.Dimensions)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": []map[string]interface{}{{"embedding": make([]float32, servers.failoverDim)}},
+		})
+	}))
+	t.Cleanup(secondary.Close)
+
+	secondaryURL, err := url.Parse(secondary.URL)
+	require.NoError(t, err)
+	cfg := &config.Config{
+		OllamaBaseURL:              primary.URL,
+		EmbeddingModel:             "nomic-embed-text",
+		VectorDimension:            4,
+		OpenAIAPIKey:               "sk-test",
+		OpenAIBaseURL:              secondary.URL + "/v1",
+		OpenAIAllowedHosts:         []string{secondaryURL.Hostname()},
+		EmbeddingFailover:          true,
+		EmbeddingFailoverModel:     "backup-embed",
+		EmbeddingFailoverThreshold: threshold,
+		EmbeddingFailoverCooldown:  cooldown,
+	}
+	return rag.NewEmbeddingService(cfg, zap.NewNop()), servers
+}
+
+func TestEmbeddingFailover_SwitchesAfterRepeatedFailures(t *testing.T) {
+	service, servers := newFailoverService(t, 2, time.Minute)
+	ctx := context.Background()
+
+	status := service.Status()
+	assert.True(t, status.FailoverEnabled)
+	assert.Equal(t, rag.EmbeddingProviderOllama, status.ActiveProvider)
+
+	servers.primaryDown.Store(true)
+	_, err := service.EmbedText(ctx, "first")
+	require.Error(t, err, "a single failure below the threshold is returned")
+	assert.False(t, service.EmbeddingFailingOver())
+
+	embedding, err := service.EmbedText(ctx, "second")
+	require.NoError(t, err)
+	assert.Len(t, embedding, 4)
+	assert.True(t, service.EmbeddingFailingOver())
+	assert.True(t, rag.EmbeddingFailingOver(service))
+
+	status = service.Status()
+	assert.Equal(t, rag.EmbeddingProviderOpenAI, status.ActiveProvider)
+	assert.Equal(t, "backup-embed", status.ActiveModel)
+	assert.False(t, status.FailedOverAt.IsZero())
+	assert.NotEmpty(t, status.LastError)
+
+	// 熔断期间不再请求主服务
+	primaryCalls := servers.primaryCalls.Load()
+	_, err = service.EmbedText(ctx, "third")
+	require.NoError(t, err)
+	assert.Equal(t, primaryCalls, servers.primaryCalls.Load())
+	assert.EqualValues(t, 2, servers.failoverCalls.Load())
+}
+
+func TestEmbeddingFailover_RecoversAfterCooldown(t *testing.T) {
+	service, servers := newFailoverService(t, 1, 50*time.Millisecond)
+	ctx := context.Background()
+
+	servers.primaryDown.Store(true)
+	_, err := service.EmbedText(ctx, "down")
+	require.NoError(t, err)
+	require.True(t, service.EmbeddingFailingOver())
+
+	servers.primaryDown.Store(false)
+	time.Sleep(80 * time.Millisecond)
+	embedding, err := service.EmbedText(ctx, "up")
+	require.NoError(t, err)
+	assert.Equal(t, []float32{1, 0, 0, 0}, embedding)
+	assert.False(t, service.EmbeddingFailingOver())
+
+	status := service.Status()
+	assert.Equal(t, rag.EmbeddingProviderOllama, status.ActiveProvider)
+	assert.True(t, status.FailedOverAt.IsZero())
+	assert.Empty(t, status.LastError)
+}
+
+func TestEmbeddingFailover_RejectsDimensionMismatch(t *testing.T) {
+	service, servers := newFailoverService(t, 1, time.Minute)
+	servers.failoverDim = 8
+	servers.primaryDown.Store(true)
+
+	_, err := service.EmbedText(context.Background(), "hello")
+	require.ErrorIs(t, err, rag.ErrEmbeddingDimensionMismatch)
+	assert.Equal(t, 4, service.GetDimension(), "the failover dimension is never adopted")
+}
+
+func TestEmbeddingFailover_DisabledByDefault(t *testing.T) {
+	service := newDimensionService(t, config.EmbeddingDimensionStrict, 4)
+
+	status := service.Status()
+	assert.False(t, status.FailoverEnabled)
+	assert.Equal(t, rag.EmbeddingProviderOllama, status.ActiveProvider)
+	assert.False(t, service.EmbeddingFailingOver())
+}
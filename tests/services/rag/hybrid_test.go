@@ -0,0 +1,120 @@
+package rag_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/milvus-io/milvus-sdk-go/v2/client"
+	"github.com/milvus-io/milvus-sdk-go/v2/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/services/rag"
+)
+
+// hybridMilvus 向量检索和关键词查询返回不同的分块，记录关键词查询的表达式
+type hybridMilvus struct {
+	*fakeMilvus
+	queryExpr string
+	queryErr  error
+}
+
+func (f *hybridMilvus) Search(ctx context.Context, collName string, partitions []string, expr string, outputFields []string, vectors []entity.Vector, vectorField string, metricType entity.MetricType, topK int, sp entity.SearchParam, opts ...client.SearchQueryOptionFunc) ([]client.SearchResult, error) {
+	return []client.SearchResult{{
+		ResultCount: 2,
+		Fields: client.ResultSet{
+			entity.NewColumnVarChar("id", []string{"1_0", "1_1"}),
+			entity.NewColumnVarChar("content", []string{"Deploy with Docker", "General overview"}),
+			entity.NewColumnInt64("kb_id", []int64{1, 1}),
+			entity.NewColumnInt64("doc_id", []int64{1, 1}),
+		},
+		Scores: []float32{0.9, 0.8},
+	}}, nil
+}
+
+func (f *hybridMilvus) Query(ctx context.Context, collectionName string, partitionNames []string, expr string, outputFields []string, opts ...client.SearchQueryOptionFunc) (client.ResultSet, error) {
+	f.queryExpr = expr
+	if f.queryErr != nil {
+		return nil, f.queryErr
+	}
+	return client.ResultSet{
+		entity.NewColumnVarChar("id", []string{"1_0", "2_0"}),
+		entity.NewColumnVarChar("content", []string{"Deploy with Docker", "Docker fails with ERR42"}),
+		entity.NewColumnInt64("kb_id", []int64{1, 1}),
+		entity.NewColumnInt64("doc_id", []int64{1, 2}),
+	}, nil
+}
+
+func newHybridRetriever(t *testing.T, fake *hybridMilvus, alpha float64) *rag.MilvusRetriever {
+	t.Helper()
+	server, _ := newIndexedOllama(t, 1, nil)
+	cfg := &config.Config{CollectionName: "hybrid_test", TopK: 5, MetricType: "COSINE", HybridAlpha: alpha}
+	retriever, err := rag.NewMilvusRetrieverWithClient(cfg, newConcurrentEmbedding(server.URL, 1), fake, zap.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() { retriever.Close() })
+	return retriever
+}
+
+func resultIDs(docs []*schema.Document) []string {
+	ids := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		ids = append(ids, doc.ID)
+	}
+	return ids
+}
+
+func TestMilvusRetriever_RetrieveHybrid(t *testing.T) {
+	fake := &hybridMilvus{fakeMilvus: &fakeMilvus{}}
+	retriever := newHybridRetriever(t, fake, 0.5)
+
+	docs, err := retriever.RetrieveHybrid(context.Background(), "Docker ERR42", 1, 0)
+	require.NoError(t, err)
+
+	// 关键词查询限定在知识库内，查询词按原样、小写和大写匹配
+	assert.Contains(t, fake.queryExpr, "kb_id == 1 && (")
+	for _, variant := range []string{"docker", "DOCKER", "Docker", "err42", "ERR42"} {
+		assert.Contains(t, fake.queryExpr, `content like "%`+variant+`%"`)
+	}
+
+	// 1_0 两路都命中只出现一次：0.5×0.9 + 0.5×0.5；2_0 只被关键词命中：0.5×1；1_1 只被向量命中：0.5×0.8
+	require.Equal(t, []string{"1_0", "2_0", "1_1"}, resultIDs(docs))
+	assert.InDelta(t, 0.7, docs[0].MetaData["score"], 1e-6)
+	assert.InDelta(t, 0.9, docs[0].MetaData["vector_score"], 1e-6)
+	assert.InDelta(t, 0.5, docs[0].MetaData["keyword_score"], 1e-6)
+	assert.InDelta(t, 0.5, docs[1].MetaData["score"], 1e-6)
+	assert.Equal(t, 0.0, docs[1].MetaData["vector_score"])
+	assert.Equal(t, uint(2), docs[1].MetaData["doc_id"])
+	assert.InDelta(t, 0.4, docs[2].MetaData["score"], 1e-6)
+
+	// 阈值作用于混合分数，topK 在合并后截断
+	docs, err = retriever.RetrieveWithOptions(context.Background(), "Docker ERR42", 1, rag.RetrieveOptions{
+		TopK:           1,
+		ScoreThreshold: 0.45,
+		Hybrid:         true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1_0"}, resultIDs(docs))
+}
+
+func TestMilvusRetriever_RetrieveHybridAlpha(t *testing.T) {
+	// alpha 为1时只按向量分数排序
+	docs, err := newHybridRetriever(t, &hybridMilvus{fakeMilvus: &fakeMilvus{}}, 1).RetrieveHybrid(context.Background(), "Docker ERR42", 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1_0", "1_1", "2_0"}, resultIDs(docs))
+
+	// alpha 为0时只按关键词分数排序，只被向量命中的分块分数为0
+	docs, err = newHybridRetriever(t, &hybridMilvus{fakeMilvus: &fakeMilvus{}}, 0).RetrieveHybrid(context.Background(), "Docker ERR42", 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2_0", "1_0", "1_1"}, resultIDs(docs))
+	assert.Equal(t, 0.0, docs[2].MetaData["score"])
+
+	// 关键词查询失败时只返回向量检索的结果
+	fake := &hybridMilvus{fakeMilvus: &fakeMilvus{}, queryErr: errors.New("like is not supported")}
+	docs, err = newHybridRetriever(t, fake, 0.5).RetrieveHybrid(context.Background(), "Docker ERR42", 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1_0", "1_1"}, resultIDs(docs))
+}
@@ -0,0 +1,136 @@
+package rag_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/milvus-io/milvus-sdk-go/v2/client"
+	"github.com/milvus-io/milvus-sdk-go/v2/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/services/rag"
+)
+
+// fakeMilvus 记录创建索引和检索时使用的度量，每次检索返回一个距离为 distance 的结果
+type fakeMilvus struct {
+	client.Client
+	distance     float32
+	indexMetric  string
+	searchMetric entity.MetricType
+}
+
+func (f *fakeMilvus) HasCollection(ctx context.Context, collName string) (bool, error) {
+	return false, nil
+}
+
+func (f *fakeMilvus) HasPartition(ctx context.Context, collName string, partitionName string) (bool, error) {
+	return false, nil
+}
+
+func (f *fakeMilvus) CreateCollection(ctx context.Context, schema *entity.Schema, shardsNum int32, opts ...client.CreateCollectionOption) error {
+	return nil
+}
+
+func (f *fakeMilvus) CreateIndex(ctx context.Context, collName string, fieldName string, idx entity.Index, async bool, opts ...client.IndexOption) error {
+	f.indexMetric = idx.Params()["metric_type"]
+	return nil
+}
+
+func (f *fakeMilvus) LoadCollection(ctx context.Context, collName string, async bool, opts ...client.LoadCollectionOption) error {
+	return nil
+}
+
+func (f *fakeMilvus) Search(ctx context.Context, collName string, partitions []string, expr string, outputFields []string, vectors []entity.Vector, vectorField string, metricType entity.MetricType, topK int, sp entity.SearchParam, opts ...client.SearchQueryOptionFunc) ([]client.SearchResult, error) {
+	f.searchMetric = metricType
+	return []client.SearchResult{{
+		ResultCount: 1,
+		Fields: client.ResultSet{
+			entity.NewColumnVarChar("id", []string{"1_0"}),
+			entity.NewColumnVarChar("content", []string{"hello"}),
+			entity.NewColumnInt64("kb_id", []int64{1}),
+			entity.NewColumnInt64("doc_id", []int64{1}),
+		},
+		Scores: []float32{f.distance},
+	}}, nil
+}
+
+func (f *fakeMilvus) Close() error {
+	return nil
+}
+
+func TestMilvusRetriever_UsesConfiguredMetric(t *testing.T) {
+	server, _ := newIndexedOllama(t, 1, nil)
+
+	for _, tc := range []struct {
+		configured string
+		metric     entity.MetricType
+		score      float64
+	}{
+		{"L2", entity.L2, 0.5},
+		{"", entity.L2, 0.5},
+		{"ip", entity.IP, 1},
+		{"COSINE", entity.COSINE, 1},
+	} {
+		fake := &fakeMilvus{distance: 1}
+		cfg := &config.Config{CollectionName: "metric_test", TopK: 5, MetricType: tc.configured}
+		retriever, err := rag.NewMilvusRetrieverWithClient(cfg, newConcurrentEmbedding(server.URL, 1), fake, zap.NewNop())
+		require.NoError(t, err, tc.configured)
+
+		docs, err := retriever.Retrieve(context.Background(), "hello", 1, 0)
+		require.NoError(t, err, tc.configured)
+		require.Len(t, docs, 1)
+
+		assert.Equal(t, string(tc.metric), fake.indexMetric, "index metric for %q", tc.configured)
+		assert.Equal(t, tc.metric, fake.searchMetric, "search metric for %q", tc.configured)
+		// L2 距离越小越相似，分数映射到 (0, 1]；IP 和 COSINE 直接使用相似度
+		assert.InDelta(t, tc.score, docs[0].MetaData["score"], 1e-6, tc.configured)
+		require.NoError(t, retriever.Close())
+	}
+}
+
+func TestMilvusRetriever_RejectsUnknownMetric(t *testing.T) {
+	_, err := rag.ParseMetricType("HAMMING")
+	assert.ErrorIs(t, err, rag.ErrInvalidMetricType)
+
+	cfg := &config.Config{CollectionName: "metric_test", MetricType: "EUCLIDEAN"}
+	fake := &fakeMilvus{}
+	_, err = rag.NewMilvusRetrieverWithClient(cfg, rag.NewEmbeddingService(cfg, zap.NewNop()), fake, zap.NewNop())
+	assert.ErrorIs(t, err, rag.ErrInvalidMetricType)
+	assert.Empty(t, fake.indexMetric, "no index is created with an unknown metric")
+
+	// 启动时直接报错，不尝试连接
+	_, err = rag.NewMilvusRetriever(cfg, rag.NewEmbeddingService(cfg, zap.NewNop()), zap.NewNop())
+	assert.ErrorIs(t, err, rag.ErrInvalidMetricType)
+}
+
+func TestMilvusRetriever_RetrievePassesTopK(t *testing.T) {
+	server, _ := newIndexedOllama(t, 1, nil)
+	fake := &topKMilvus{fakeMilvus: &fakeMilvus{distance: 1}}
+	cfg := &config.Config{CollectionName: "topk_test", TopK: 5}
+	retriever, err := rag.NewMilvusRetrieverWithClient(cfg, newConcurrentEmbedding(server.URL, 1), fake, zap.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() { retriever.Close() })
+
+	_, err = retriever.Retrieve(context.Background(), "hello", 1, 12)
+	require.NoError(t, err)
+	assert.Equal(t, 12, fake.topK)
+
+	// 未指定时使用配置的 TOP_K
+	_, err = retriever.Retrieve(context.Background(), "hello", 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 5, fake.topK)
+}
+
+// topKMilvus 额外记录检索时传给 Milvus 的 topK
+type topKMilvus struct {
+	*fakeMilvus
+	topK int
+}
+
+func (f *topKMilvus) Search(ctx context.Context, collName string, partitions []string, expr string, outputFields []string, vectors []entity.Vector, vectorField string, metricType entity.MetricType, topK int, sp entity.SearchParam, opts ...client.SearchQueryOptionFunc) ([]client.SearchResult, error) {
+	f.topK = topK
+	return f.fakeMilvus.Search(ctx, collName, partitions, expr, outputFields, vectors, vectorField, metricType, topK, sp, opts...)
+}
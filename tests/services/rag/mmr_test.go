@@ -0,0 +1,114 @@
+package rag_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/milvus-io/milvus-sdk-go/v2/client"
+	"github.com/milvus-io/milvus-sdk-go/v2/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/services/rag"
+)
+
+func vectorDoc(id string, vector ...float64) *schema.Document {
+	return (&schema.Document{ID: id, MetaData: map[string]interface{}{}}).WithDenseVector(vector)
+}
+
+func TestMMRRerank(t *testing.T) {
+	query := []float32{1, 0, 0}
+	docs := func() []*schema.Document {
+		return []*schema.Document{
+			vectorDoc("a", 1, 0.1, 0),
+			vectorDoc("a-copy", 1, 0.11, 0),
+			vectorDoc("b", 1, 0, 0.3),
+		}
+	}
+
+	// lambda 为1时按与查询的相似度排序
+	assert.Equal(t, []string{"a", "a-copy"}, resultIDs(rag.MMRRerank(docs(), query, 1, 2)))
+	// 与已选分块几乎相同的分块被跳过
+	assert.Equal(t, []string{"a", "b"}, resultIDs(rag.MMRRerank(docs(), query, 0.5, 2)))
+	// k <= 0 时保留全部，只调整顺序
+	assert.Equal(t, []string{"a", "b", "a-copy"}, resultIDs(rag.MMRRerank(docs(), query, 0.5, 0)))
+	assert.Empty(t, rag.MMRRerank(nil, query, 0.5, 3))
+
+	// 没有向量的分块以 score 作为相关性
+	scored := []*schema.Document{
+		{ID: "low", MetaData: map[string]interface{}{"score": 0.2}},
+		{ID: "high", MetaData: map[string]interface{}{"score": 0.9}},
+	}
+	assert.Equal(t, []string{"high", "low"}, resultIDs(rag.MMRRerank(scored, query, 0.5, 0)))
+}
+
+// mmrMilvus 返回带向量的候选，其中两个分块几乎相同，记录检索的 topK 和输出字段
+type mmrMilvus struct {
+	*fakeMilvus
+	topK         int
+	outputFields []string
+}
+
+func (f *mmrMilvus) Search(ctx context.Context, collName string, partitions []string, expr string, outputFields []string, vectors []entity.Vector, vectorField string, metricType entity.MetricType, topK int, sp entity.SearchParam, opts ...client.SearchQueryOptionFunc) ([]client.SearchResult, error) {
+	f.topK = topK
+	f.outputFields = outputFields
+	embedding := func(values ...float32) []float32 {
+		vector := make([]float32, benchDimension)
+		copy(vector, values)
+		return vector
+	}
+	return []client.SearchResult{{
+		ResultCount: 3,
+		Fields: client.ResultSet{
+			entity.NewColumnVarChar("id", []string{"1_0", "1_1", "2_0"}),
+			entity.NewColumnVarChar("content", []string{"intro", "intro again", "details"}),
+			entity.NewColumnInt64("kb_id", []int64{1, 1, 1}),
+			entity.NewColumnInt64("doc_id", []int64{1, 1, 2}),
+			entity.NewColumnFloatVector("embedding", benchDimension, [][]float32{
+				embedding(1, 0.2), embedding(1, 0.21), embedding(1, 0, 0.5),
+			}),
+		},
+		Scores: []float32{0.98, 0.97, 0.89},
+	}}, nil
+}
+
+func TestMilvusRetriever_RetrieveMMR(t *testing.T) {
+	server, _ := newIndexedOllama(t, 1, nil)
+	fake := &mmrMilvus{fakeMilvus: &fakeMilvus{}}
+	cfg := &config.Config{
+		CollectionName:               "mmr_test",
+		TopK:                         2,
+		MetricType:                   "COSINE",
+		RetrievalCandidateMultiplier: 4,
+		RetrievalMMR:                 true,
+		RetrievalMMRLambda:           0.5,
+	}
+	retriever, err := rag.NewMilvusRetrieverWithClient(cfg, newConcurrentEmbedding(server.URL, 1), fake, zap.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() { retriever.Close() })
+
+	// 查询向量为第一维上的单位向量
+	docs, err := retriever.Retrieve(context.Background(), "text-1", 1, 0)
+	require.NoError(t, err)
+
+	// 召回 topK × 倍数个候选和分块向量，重复的分块被更多样的分块替换
+	assert.Equal(t, 8, fake.topK)
+	assert.Contains(t, fake.outputFields, "embedding")
+	require.Equal(t, []string{"1_0", "2_0"}, resultIDs(docs))
+	assert.InDelta(t, 0.89, docs[1].MetaData["score"], 1e-6)
+	for _, doc := range docs {
+		assert.Nil(t, doc.DenseVector(), "chunk vectors are not returned")
+		assert.NotContains(t, doc.MetaData, "_dense_vector")
+	}
+
+	// 关闭后按相似度返回 topK 个，不读取分块向量
+	cfg.RetrievalMMR = false
+	docs, err = retriever.Retrieve(context.Background(), "text-1", 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, fake.topK)
+	assert.NotContains(t, fake.outputFields, "embedding")
+	assert.Equal(t, []string{"1_0", "1_1", "2_0"}, resultIDs(docs))
+}
@@ -0,0 +1,132 @@
+package rag_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/services/rag"
+)
+
+// newOpenAIEmbeddings 模拟 OpenAI 兼容的 /v1/embeddings 接口，向量第一维为输入在请求中的位置，倒序返回
+func newOpenAIEmbeddings(t *testing.T, dim int) (*config.Config, *atomic.Int64) {
+	t.Helper()
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		assert.Equal(t, "/v1/embeddings", r.URL.Path)
+		assert.Equal(t, "Bearer sk-test", r.Header.Get("Authorization"))
+		var req struct {
+			Model string          `json:"model"`
+			Input json.RawMessage `json:"input"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "text-embedding-3-small", req.Model)
+
+		var inputs []string
+		if err := json.Unmarshal(req.Input, &inputs); err != nil {
+			var input string
+			require.NoError(t, json.Unmarshal(req.Input, &input))
+			inputs = []string{input}
+		}
+		data := make([]map[string]interface{}, 0, len(inputs))
+		for i := len(inputs) - 1; i >= 0; i-- {
+			embedding := make([]float32, dim)
+			fmt.Sscanf(inputs[i], "text-%f", &embedding[0])
+			data = append(data, map[string]interface{}{"index": i, "embedding": embedding})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	t.Cleanup(server.Close)
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	return &config.Config{
+		EmbeddingProvider:    "openai",
+		EmbeddingModel:       "text-embedding-3-small",
+		VectorDimension:      4,
+		OpenAIAPIKey:         "sk-test",
+		OpenAIBaseURL:        server.URL + "/v1",
+		OpenAIAllowedHosts:   []string{serverURL.Hostname()},
+		EmbeddingConcurrency: 2,
+	}, &requests
+}
+
+func TestOpenAIEmbedder_EmbedTexts(t *testing.T) {
+	cfg, requests := newOpenAIEmbeddings(t, 4)
+	embedder, err := rag.NewEmbedder(cfg, zap.NewNop())
+	require.NoError(t, err)
+	require.IsType(t, &rag.OpenAIEmbedder{}, embedder)
+	assert.Equal(t, 4, embedder.GetDimension())
+
+	// 超过单次请求上限时分批请求，结果按输入顺序排列
+	texts := make([]string, 70)
+	for i := range texts {
+		texts[i] = fmt.Sprintf("text-%d", i)
+	}
+	embeddings, err := embedder.EmbedTexts(context.Background(), texts)
+	require.NoError(t, err)
+	require.Len(t, embeddings, 70)
+	assert.EqualValues(t, 2, requests.Load())
+	for i, embedding := range embeddings {
+		assert.Equal(t, float32(i), embedding[0])
+	}
+
+	embedding, err := embedder.EmbedText(context.Background(), "text-3")
+	require.NoError(t, err)
+	assert.Equal(t, []float32{3, 0, 0, 0}, embedding)
+
+	status := embedder.(rag.EmbeddingStatusReporter).Status()
+	assert.Equal(t, rag.EmbeddingProviderOpenAI, status.ActiveProvider)
+	assert.Equal(t, "text-embedding-3-small", status.ActiveModel)
+}
+
+func TestOpenAIEmbedder_RejectsDimensionMismatch(t *testing.T) {
+	cfg, _ := newOpenAIEmbeddings(t, 8)
+	embedder, err := rag.NewOpenAIEmbedder(cfg, zap.NewNop())
+	require.NoError(t, err)
+
+	_, err = embedder.EmbedText(context.Background(), "text-1")
+	assert.ErrorIs(t, err, rag.ErrEmbeddingDimensionMismatch)
+}
+
+func TestNewEmbedder_SelectsProvider(t *testing.T) {
+	embedder, err := rag.NewEmbedder(&config.Config{}, zap.NewNop())
+	require.NoError(t, err)
+	assert.IsType(t, &rag.EmbeddingService{}, embedder)
+
+	embedder, err = rag.NewEmbedder(&config.Config{EmbeddingProvider: "Ollama"}, zap.NewNop())
+	require.NoError(t, err)
+	assert.IsType(t, &rag.EmbeddingService{}, embedder)
+
+	_, err = rag.NewEmbedder(&config.Config{EmbeddingProvider: "cohere"}, zap.NewNop())
+	assert.ErrorIs(t, err, rag.ErrInvalidEmbeddingProvider)
+}
+
+func TestMilvusRetriever_WithOpenAIEmbedder(t *testing.T) {
+	cfg, requests := newOpenAIEmbeddings(t, 4)
+	cfg.CollectionName = "openai_test"
+	cfg.TopK = 5
+	embedder, err := rag.NewEmbedder(cfg, zap.NewNop())
+	require.NoError(t, err)
+
+	fake := &fakeMilvus{distance: 1}
+	retriever, err := rag.NewMilvusRetrieverWithClient(cfg, embedder, fake, zap.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() { retriever.Close() })
+
+	docs, err := retriever.Retrieve(context.Background(), "text-1", 1, 0)
+	require.NoError(t, err)
+	assert.Len(t, docs, 1)
+	assert.EqualValues(t, 1, requests.Load())
+}
@@ -0,0 +1,288 @@
+package rag_test
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/milvus-io/milvus-sdk-go/v2/client"
+	"github.com/milvus-io/milvus-sdk-go/v2/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/services/rag"
+)
+
+// partitionRow 分区 fake 中保存的一个向量
+type partitionRow struct {
+	id        string
+	embedding []float32
+	kbID      int64
+	docID     int64
+	partition string
+}
+
+// partitionMilvus 在内存中保存各分区的向量，记录检索的分区、分区检查次数和释放、删除的分区
+type partitionMilvus struct {
+	*fakeMilvus
+	created          bool
+	rows             []partitionRow
+	partitions       map[string]bool
+	partitionChecks  int
+	searchErr        error
+	searchPartitions []string
+	released         []string
+}
+
+func newPartitionMilvus() *partitionMilvus {
+	return &partitionMilvus{fakeMilvus: &fakeMilvus{distance: 1}, partitions: map[string]bool{"_default": true}}
+}
+
+func (f *partitionMilvus) HasCollection(ctx context.Context, collName string) (bool, error) {
+	return f.created, nil
+}
+
+func (f *partitionMilvus) CreateCollection(ctx context.Context, schema *entity.Schema, shardsNum int32, opts ...client.CreateCollectionOption) error {
+	f.created = true
+	return nil
+}
+
+func (f *partitionMilvus) HasPartition(ctx context.Context, collName string, partitionName string) (bool, error) {
+	f.partitionChecks++
+	return f.partitions[partitionName], nil
+}
+
+func (f *partitionMilvus) CreatePartition(ctx context.Context, collName string, partitionName string, opts ...client.CreatePartitionOption) error {
+	if f.partitions[partitionName] {
+		return fmt.Errorf("partition %s already exists", partitionName)
+	}
+	f.partitions[partitionName] = true
+	return nil
+}
+
+func (f *partitionMilvus) ReleasePartitions(ctx context.Context, collName string, partitions []string, opts ...client.ReleasePartitionsOption) error {
+	f.released = append(f.released, partitions...)
+	return nil
+}
+
+func (f *partitionMilvus) DropPartition(ctx context.Context, collName string, partitionName string, opts ...client.DropPartitionOption) error {
+	delete(f.partitions, partitionName)
+	f.remove(func(row partitionRow) bool { return row.partition == partitionName })
+	return nil
+}
+
+func (f *partitionMilvus) Insert(ctx context.Context, collName string, partitionName string, columns ...entity.Column) (entity.Column, error) {
+	if partitionName == "" {
+		partitionName = "_default"
+	}
+	if !f.partitions[partitionName] {
+		return nil, fmt.Errorf("partition %s not found", partitionName)
+	}
+	ids := columns[0].(*entity.ColumnVarChar).Data()
+	vectors := columns[2].(*entity.ColumnFloatVector).Data()
+	kbIDs := columns[3].(*entity.ColumnInt64).Data()
+	docIDs := columns[4].(*entity.ColumnInt64).Data()
+	for i, id := range ids {
+		f.rows = append(f.rows, partitionRow{id: id, embedding: vectors[i], kbID: kbIDs[i], docID: docIDs[i], partition: partitionName})
+	}
+	return nil, nil
+}
+
+var (
+	kbExpr     = regexp.MustCompile(`^kb_id == (\d+)$`)
+	idsExpr    = regexp.MustCompile(`"([^"]+)"`)
+	notInExpr  = regexp.MustCompile(`kb_id not in \[([\d,]+)\]`)
+	kbListExpr = regexp.MustCompile(`\d+`)
+)
+
+func (f *partitionMilvus) Delete(ctx context.Context, collName string, partitionName string, expr string) error {
+	inPartition := func(row partitionRow) bool { return partitionName == "" || row.partition == partitionName }
+	if m := kbExpr.FindStringSubmatch(expr); m != nil {
+		kbID, _ := strconv.ParseInt(m[1], 10, 64)
+		f.remove(func(row partitionRow) bool { return inPartition(row) && row.kbID == kbID })
+		return nil
+	}
+	ids := map[string]bool{}
+	for _, m := range idsExpr.FindAllStringSubmatch(expr, -1) {
+		ids[m[1]] = true
+	}
+	f.remove(func(row partitionRow) bool { return inPartition(row) && ids[row.id] })
+	return nil
+}
+
+func (f *partitionMilvus) Query(ctx context.Context, collectionName string, partitionNames []string, expr string, outputFields []string, opts ...client.SearchQueryOptionFunc) (client.ResultSet, error) {
+	var ids, contents []string
+	var vectors [][]float32
+	var kbIDs, docIDs []int64
+	skipped := map[int64]bool{}
+	if m := notInExpr.FindStringSubmatch(expr); m != nil {
+		for _, id := range kbListExpr.FindAllString(m[1], -1) {
+			kbID, _ := strconv.ParseInt(id, 10, 64)
+			skipped[kbID] = true
+		}
+	}
+	for _, row := range f.rows {
+		if row.partition != partitionNames[0] || row.kbID <= 0 || skipped[row.kbID] {
+			continue
+		}
+		ids = append(ids, row.id)
+		contents = append(contents, "content of "+row.id)
+		vectors = append(vectors, row.embedding)
+		kbIDs = append(kbIDs, row.kbID)
+		docIDs = append(docIDs, row.docID)
+	}
+	return client.ResultSet{
+		entity.NewColumnVarChar("id", ids),
+		entity.NewColumnVarChar("content", contents),
+		entity.NewColumnFloatVector("embedding", 4, vectors),
+		entity.NewColumnInt64("kb_id", kbIDs),
+		entity.NewColumnInt64("doc_id", docIDs),
+	}, nil
+}
+
+func (f *partitionMilvus) Search(ctx context.Context, collName string, partitions []string, expr string, outputFields []string, vectors []entity.Vector, vectorField string, metricType entity.MetricType, topK int, sp entity.SearchParam, opts ...client.SearchQueryOptionFunc) ([]client.SearchResult, error) {
+	f.searchPartitions = partitions
+	if f.searchErr != nil {
+		return nil, f.searchErr
+	}
+	return f.fakeMilvus.Search(ctx, collName, partitions, expr, outputFields, vectors, vectorField, metricType, topK, sp, opts...)
+}
+
+func (f *partitionMilvus) remove(match func(row partitionRow) bool) {
+	kept := f.rows[:0]
+	for _, row := range f.rows {
+		if !match(row) {
+			kept = append(kept, row)
+		}
+	}
+	f.rows = kept
+}
+
+// partitionCounts 返回每个分区中每个知识库的向量数
+func (f *partitionMilvus) partitionCounts() map[string]map[int64]int {
+	counts := map[string]map[int64]int{}
+	for _, row := range f.rows {
+		if counts[row.partition] == nil {
+			counts[row.partition] = map[int64]int{}
+		}
+		counts[row.partition][row.kbID]++
+	}
+	return counts
+}
+
+func newPartitionRetriever(t *testing.T, fake *partitionMilvus, partitions bool) *rag.MilvusRetriever {
+	t.Helper()
+	server, _ := newIndexedOllama(t, 1, nil)
+	cfg := &config.Config{CollectionName: "partition_test", TopK: 5, MilvusKBPartitions: partitions}
+	retriever, err := rag.NewMilvusRetrieverWithClient(cfg, newConcurrentEmbedding(server.URL, 1), fake, zap.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() { retriever.Close() })
+	return retriever
+}
+
+func TestMilvusRetriever_KnowledgeBasePartitions(t *testing.T) {
+	fake := newPartitionMilvus()
+	// 分区加入之前写入的向量保存在默认分区
+	fake.rows = []partitionRow{
+		{id: "1_0", embedding: make([]float32, 4), kbID: 1, docID: 1, partition: "_default"},
+		{id: "2_0", embedding: make([]float32, 4), kbID: 2, docID: 2, partition: "_default"},
+	}
+	retriever := newPartitionRetriever(t, fake, true)
+	ctx := context.Background()
+
+	// 第一次写入时创建知识库分区
+	require.NoError(t, retriever.AddDocuments(ctx, []*schema.Document{{ID: "3_0", Content: "text-0"}}, 1, 3))
+	assert.Equal(t, map[string]map[int64]int{"_default": {1: 1, 2: 1}, "kb_1": {1: 1}}, fake.partitionCounts())
+
+	// 按知识库检索时只搜索知识库分区和默认分区
+	_, err := retriever.Retrieve(ctx, "text-0", 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"_default", "kb_1"}, fake.searchPartitions)
+	_, err = retriever.Retrieve(ctx, "text-0", 2, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"_default"}, fake.searchPartitions)
+	_, err = retriever.Retrieve(ctx, "text-0", 0, 0)
+	require.NoError(t, err)
+	assert.Nil(t, fake.searchPartitions)
+
+	// 迁移后默认分区为空，重复执行不产生重复向量
+	result, err := retriever.MigratePartitions(ctx, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Moved)
+	assert.Equal(t, []uint{1, 2}, result.KnowledgeBases)
+	assert.Equal(t, map[string]map[int64]int{"kb_1": {1: 2}, "kb_2": {2: 1}}, fake.partitionCounts())
+	result, err = retriever.MigratePartitions(ctx, nil, nil)
+	require.NoError(t, err)
+	assert.Zero(t, result.Moved)
+
+	// 删除知识库时释放并删除其分区
+	require.NoError(t, retriever.DeleteByKnowledgeBase(ctx, 1))
+	assert.False(t, fake.partitions["kb_1"])
+	assert.Equal(t, []string{"kb_1"}, fake.released)
+	assert.Equal(t, map[string]map[int64]int{"kb_2": {2: 1}}, fake.partitionCounts())
+	_, err = retriever.Retrieve(ctx, "text-0", 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"_default"}, fake.searchPartitions)
+}
+
+func TestMilvusRetriever_PartitionsDisabled(t *testing.T) {
+	fake := newPartitionMilvus()
+	retriever := newPartitionRetriever(t, fake, false)
+
+	require.NoError(t, retriever.AddDocuments(context.Background(), []*schema.Document{{ID: "1_0", Content: "text-0"}}, 1, 1))
+	assert.Equal(t, map[string]map[int64]int{"_default": {1: 1}}, fake.partitionCounts())
+	assert.False(t, fake.partitions["kb_1"])
+}
+
+func TestMilvusRetriever_PartitionCache(t *testing.T) {
+	fake := newPartitionMilvus()
+	retriever := newPartitionRetriever(t, fake, true)
+	ctx := context.Background()
+
+	// 分区不存在的结果同样被缓存，重复检索不再检查
+	_, err := retriever.Retrieve(ctx, "text-0", 1, 0)
+	require.NoError(t, err)
+	checks := fake.partitionChecks
+	_, err = retriever.Retrieve(ctx, "text-0", 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, checks, fake.partitionChecks)
+
+	// 检索出错后清除缓存，下次重新检查，看到其他副本创建的分区
+	fake.partitions["kb_1"] = true
+	fake.searchErr = fmt.Errorf("partition not loaded")
+	_, err = retriever.Retrieve(ctx, "text-0", 1, 0)
+	require.Error(t, err)
+	fake.searchErr = nil
+	_, err = retriever.Retrieve(ctx, "text-0", 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, checks+1, fake.partitionChecks)
+	assert.Equal(t, []string{"_default", "kb_1"}, fake.searchPartitions)
+}
+
+func TestMilvusRetriever_DefaultPartitionKnowledgeBases(t *testing.T) {
+	fake := newPartitionMilvus()
+	retriever := newPartitionRetriever(t, fake, true)
+	ctx := context.Background()
+
+	// 附件知识库写入默认分区，不创建知识库分区
+	_, err := retriever.AddDocumentsWithOptions(ctx, []*schema.Document{{ID: "1_0", Content: "text-0"}}, 1, 1,
+		rag.AddOptions{DefaultPartition: true})
+	require.NoError(t, err)
+	require.NoError(t, retriever.AddDocuments(ctx, []*schema.Document{{ID: "2_0", Content: "text-0"}}, 2, 2))
+	assert.False(t, fake.partitions["kb_1"])
+	assert.Equal(t, map[string]map[int64]int{"_default": {1: 1}, "kb_2": {2: 1}}, fake.partitionCounts())
+
+	// 迁移跳过附件知识库
+	fake.rows = append(fake.rows, partitionRow{id: "3_0", embedding: make([]float32, 4), kbID: 3, docID: 3, partition: "_default"})
+	result, err := retriever.MigratePartitions(ctx, []uint{1}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Moved)
+	assert.Equal(t, []uint{3}, result.KnowledgeBases)
+	assert.False(t, fake.partitions["kb_1"])
+	assert.Equal(t, map[string]map[int64]int{"_default": {1: 1}, "kb_2": {2: 1}, "kb_3": {3: 1}}, fake.partitionCounts())
+}
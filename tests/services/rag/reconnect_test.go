@@ -0,0 +1,61 @@
+package rag_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/services/rag"
+)
+
+func TestMilvusCheckDelay_ConnectedUsesHealthCheckInterval(t *testing.T) {
+	cfg := &config.Config{MilvusHealthCheckInterval: 45 * time.Second}
+
+	// 已连接时与退避间隔无关
+	assert.Equal(t, 45*time.Second, rag.MilvusCheckDelay(true, time.Second, cfg))
+	assert.Equal(t, 45*time.Second, rag.MilvusCheckDelay(true, 5*time.Minute, cfg))
+
+	assert.Equal(t, 30*time.Second, rag.MilvusCheckDelay(true, time.Second, &config.Config{}), "unset interval falls back to 30s")
+}
+
+func TestMilvusCheckDelay_DisconnectedUsesBackoff(t *testing.T) {
+	cfg := &config.Config{MilvusHealthCheckInterval: 45 * time.Second}
+
+	assert.Equal(t, time.Second, rag.MilvusCheckDelay(false, time.Second, cfg))
+	assert.Equal(t, 8*time.Second, rag.MilvusCheckDelay(false, 8*time.Second, cfg))
+}
+
+func TestMilvusRetriever_DisconnectedBacksOff(t *testing.T) {
+	cfg := &config.Config{
+		MilvusAddress:             "127.0.0.1:1",
+		CollectionName:            "reconnect_test",
+		MilvusConnectTimeout:      100 * time.Millisecond,
+		MilvusHealthCheckInterval: time.Hour,
+		MilvusHealthCheckTimeout:  time.Second,
+	}
+	retriever, err := rag.NewMilvusRetriever(cfg, rag.NewEmbeddingService(cfg, zap.NewNop()), zap.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() { retriever.Close() })
+
+	// 断开时先按最小退避间隔重连，而不是按健康检查间隔等待
+	require.Eventually(t, func() bool {
+		return !retriever.Status().NextRetryAt.IsZero()
+	}, time.Second, 10*time.Millisecond)
+	status := retriever.Status()
+	assert.False(t, status.Connected)
+	assert.Equal(t, time.Second, status.RetryDelay)
+	assert.WithinDuration(t, time.Now().Add(time.Second), status.NextRetryAt, 500*time.Millisecond)
+
+	// 重连失败后退避间隔翻倍
+	require.Eventually(t, func() bool {
+		return retriever.Status().RetryDelay == 2*time.Second
+	}, 3*time.Second, 50*time.Millisecond)
+	status = retriever.Status()
+	assert.False(t, status.Connected)
+	assert.NotEmpty(t, status.LastError)
+	assert.WithinDuration(t, time.Now().Add(2*time.Second), status.NextRetryAt, time.Second)
+}
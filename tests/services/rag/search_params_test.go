@@ -0,0 +1,86 @@
+package rag_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/milvus-io/milvus-sdk-go/v2/client"
+	"github.com/milvus-io/milvus-sdk-go/v2/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/services/rag"
+)
+
+// effortMilvus 额外记录创建的索引类型和检索参数
+type effortMilvus struct {
+	*fakeMilvus
+	indexType   entity.IndexType
+	searchParam map[string]interface{}
+}
+
+func (f *effortMilvus) CreateIndex(ctx context.Context, collName string, fieldName string, idx entity.Index, async bool, opts ...client.IndexOption) error {
+	f.indexType = idx.IndexType()
+	return f.fakeMilvus.CreateIndex(ctx, collName, fieldName, idx, async, opts...)
+}
+
+func (f *effortMilvus) Search(ctx context.Context, collName string, partitions []string, expr string, outputFields []string, vectors []entity.Vector, vectorField string, metricType entity.MetricType, topK int, sp entity.SearchParam, opts ...client.SearchQueryOptionFunc) ([]client.SearchResult, error) {
+	f.searchParam = sp.Params()
+	return f.fakeMilvus.Search(ctx, collName, partitions, expr, outputFields, vectors, vectorField, metricType, topK, sp, opts...)
+}
+
+func TestMilvusRetriever_BuildsConfiguredIndex(t *testing.T) {
+	server, _ := newIndexedOllama(t, 1, nil)
+
+	for _, tc := range []struct {
+		configured string
+		indexType  entity.IndexType
+	}{
+		{"", entity.IvfFlat},
+		{"hnsw", entity.HNSW},
+		{"IVF_SQ8", entity.IvfSQ8},
+		{"IVF_PQ", entity.IvfPQ},
+		{"FLAT", entity.Flat},
+	} {
+		fake := &effortMilvus{fakeMilvus: &fakeMilvus{distance: 1}}
+		cfg := &config.Config{CollectionName: "index_test", TopK: 5, IndexType: tc.configured, VectorDimension: 768}
+		retriever, err := rag.NewMilvusRetrieverWithClient(cfg, newConcurrentEmbedding(server.URL, 1), fake, zap.NewNop())
+		require.NoError(t, err, tc.configured)
+		assert.Equal(t, tc.indexType, fake.indexType, "index for %q", tc.configured)
+		require.NoError(t, retriever.Close())
+	}
+
+	_, err := rag.ParseIndexType("ANNOY")
+	assert.ErrorIs(t, err, rag.ErrInvalidIndexType)
+	fake := &effortMilvus{fakeMilvus: &fakeMilvus{}}
+	_, err = rag.NewMilvusRetrieverWithClient(&config.Config{CollectionName: "index_test", IndexType: "ANNOY"}, nil, fake, zap.NewNop())
+	assert.ErrorIs(t, err, rag.ErrInvalidIndexType)
+	assert.Empty(t, fake.indexType, "no index is created with an unknown index type")
+}
+
+func TestMilvusRetriever_SearchEffort(t *testing.T) {
+	server, _ := newIndexedOllama(t, 1, nil)
+	fake := &effortMilvus{fakeMilvus: &fakeMilvus{distance: 1}}
+	cfg := &config.Config{CollectionName: "effort_test", TopK: 5, IndexType: "HNSW", MilvusSearchEf: 64}
+	retriever, err := rag.NewMilvusRetrieverWithClient(cfg, newConcurrentEmbedding(server.URL, 1), fake, zap.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() { retriever.Close() })
+
+	// 配置的默认 ef 小于 topK 时按 topK 调整，不报错
+	_, err = retriever.RetrieveWithOptions(context.Background(), "hello", 1, rag.RetrieveOptions{TopK: 100})
+	require.NoError(t, err)
+	assert.EqualValues(t, 100, fake.searchParam["ef"])
+
+	_, err = retriever.RetrieveWithOptions(context.Background(), "hello", 1, rag.RetrieveOptions{TopK: 10})
+	require.NoError(t, err)
+	assert.EqualValues(t, 64, fake.searchParam["ef"])
+
+	// 请求指定的 ef 小于 topK 时拒绝
+	_, err = retriever.RetrieveWithOptions(context.Background(), "hello", 1, rag.RetrieveOptions{TopK: 100, SearchEffort: 50})
+	assert.ErrorIs(t, err, rag.ErrInvalidSearchEffort)
+	_, err = retriever.RetrieveWithOptions(context.Background(), "hello", 1, rag.RetrieveOptions{TopK: 100, SearchEffort: 200})
+	require.NoError(t, err)
+	assert.EqualValues(t, 200, fake.searchParam["ef"])
+}
@@ -0,0 +1,20 @@
+package rag_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"eino-rag/internal/services/rag"
+)
+
+func TestCosineSimilarity(t *testing.T) {
+	assert.InDelta(t, 1.0, rag.CosineSimilarity([]float32{1, 2, 3}, []float32{2, 4, 6}), 1e-9)
+	assert.InDelta(t, 0.0, rag.CosineSimilarity([]float32{1, 0}, []float32{0, 1}), 1e-9)
+	assert.InDelta(t, -1.0, rag.CosineSimilarity([]float32{1, 1}, []float32{-1, -1}), 1e-9)
+
+	// 维度不同或零向量时不视为相似
+	assert.Zero(t, rag.CosineSimilarity([]float32{1, 2}, []float32{1, 2, 3}))
+	assert.Zero(t, rag.CosineSimilarity([]float32{0, 0}, []float32{1, 2}))
+	assert.Zero(t, rag.CosineSimilarity(nil, nil))
+}
@@ -0,0 +1,86 @@
+package rag_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/services/rag"
+	"eino-rag/tests/testutil"
+)
+
+// newSlowEmbeddingService 创建向量化服务，模型直到请求结束或测试结束都不返回
+func newSlowEmbeddingService(t *testing.T, timeout time.Duration) *rag.EmbeddingService {
+	testutil.New(t)
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	cfg := config.Load()
+	config.UpdateFromDB(map[string]string{
+		"embedding_cache": "false",
+		"ollama_url":      server.URL,
+	})
+	cfg.EmbeddingTimeout = timeout
+	return rag.NewEmbeddingService(cfg, zap.NewNop())
+}
+
+func TestEmbedText_TimeoutNamesStage(t *testing.T) {
+	service := newSlowEmbeddingService(t, 50*time.Millisecond)
+
+	_, err := service.EmbedText(context.Background(), "hello")
+	require.Error(t, err)
+
+	var timeoutErr *rag.TimeoutError
+	require.ErrorAs(t, err, &timeoutErr)
+	assert.Equal(t, rag.StageEmbedding, timeoutErr.Stage)
+	assert.Equal(t, 50*time.Millisecond, timeoutErr.Timeout)
+	assert.Contains(t, err.Error(), "embedding timed out after 50ms")
+}
+
+func TestEmbedText_CallerDeadlineIsNotStageTimeout(t *testing.T) {
+	service := newSlowEmbeddingService(t, time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := service.EmbedText(ctx, "hello")
+	require.Error(t, err)
+
+	var timeoutErr *rag.TimeoutError
+	assert.False(t, errors.As(err, &timeoutErr), "the request deadline is not attributed to a stage")
+	assert.True(t, rag.IsTimeout(err))
+}
+
+func TestWrapTimeout(t *testing.T) {
+	ctx := context.Background()
+	grpcTimeout := status.Error(codes.DeadlineExceeded, "deadline exceeded")
+
+	err := rag.WrapTimeout(ctx, rag.StageSearch, time.Second, grpcTimeout)
+	var timeoutErr *rag.TimeoutError
+	require.ErrorAs(t, err, &timeoutErr)
+	assert.Equal(t, rag.StageSearch, timeoutErr.Stage)
+
+	// 已标明阶段的错误不会被外层阶段覆盖
+	assert.Same(t, err, rag.WrapTimeout(ctx, rag.StageGeneration, time.Minute, err))
+
+	other := status.Error(codes.Internal, "boom")
+	assert.Same(t, other, rag.WrapTimeout(ctx, rag.StageSearch, time.Second, other))
+	assert.Nil(t, rag.WrapTimeout(ctx, rag.StageSearch, time.Second, nil))
+}
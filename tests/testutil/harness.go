@@ -0,0 +1,111 @@
+// Package testutil 提供不依赖外部服务的测试环境：临时SQLite数据库、内存检索器和内存Redis
+package testutil
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"eino-rag/internal/config"
+	"eino-rag/internal/db"
+	"eino-rag/internal/models"
+	"eino-rag/internal/services/document"
+	"eino-rag/internal/services/rag"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Harness 测试用的服务集合，数据库在测试结束时自动关闭并删除
+type Harness struct {
+	Config    *config.Config
+	Logger    *zap.Logger
+	Retriever *rag.MemoryRetriever
+	Documents *document.Service
+	AdminID   uint // 初始化数据库时创建的默认管理员
+}
+
+// NewConfig 返回测试用的默认配置，数据库位于 dir 下
+func NewConfig(dir string) *config.Config {
+	return &config.Config{
+		GinMode:          "test",
+		DBPath:           filepath.Join(dir, "test.db"),
+		ChunkSize:        500,
+		ChunkOverlap:     50,
+		ChunkingStrategy: config.ChunkingStrategyLength,
+		TopK:             5,
+		MaxUploadSize:    10 * 1024 * 1024,
+		AllowedFileTypes: []string{".txt", ".md", ".pdf", ".json", ".csv", ".html", ".docx"},
+		IndexTimeout:     30 * time.Second,
+	}
+}
+
+// New 初始化临时数据库和使用内存检索器的文档服务，configure 可在创建服务前修改配置
+func New(t *testing.T, configure ...func(cfg *config.Config)) *Harness {
+	t.Helper()
+
+	cfg := NewConfig(t.TempDir())
+	for _, fn := range configure {
+		fn(cfg)
+	}
+
+	if err := db.Init(cfg); err != nil {
+		t.Fatalf("failed to init test database: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close test database: %v", err)
+		}
+	})
+
+	var admin models.User
+	if err := db.GetDB().Order("id ASC").First(&admin).Error; err != nil {
+		t.Fatalf("failed to load default admin: %v", err)
+	}
+
+	logger := zap.NewNop()
+	retriever := rag.NewMemoryRetriever(cfg.TopK)
+	return &Harness{
+		Config:    cfg,
+		Logger:    logger,
+		Retriever: retriever,
+		Documents: document.NewService(
+			document.NewDocumentParser(logger),
+			document.NewDocumentProcessor(cfg, logger),
+			retriever,
+			nil,
+			cfg,
+			logger,
+		),
+		AdminID: admin.ID,
+	}
+}
+
+// CreateKnowledgeBase 以默认管理员身份创建知识库
+func (h *Harness) CreateKnowledgeBase(t *testing.T, name string) *models.KnowledgeBase {
+	t.Helper()
+
+	kb := &models.KnowledgeBase{
+		Name:      name,
+		CreatorID: h.AdminID,
+	}
+	if err := db.GetDB().Create(kb).Error; err != nil {
+		t.Fatalf("failed to create knowledge base: %v", err)
+	}
+	return kb
+}
+
+// NewRedis 启动内存Redis并替换 db 包的Redis客户端，测试结束时恢复为未配置Redis
+func NewRedis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	db.SetRedis(client)
+	t.Cleanup(func() {
+		db.SetRedis(nil)
+		client.Close()
+	})
+	return server
+}
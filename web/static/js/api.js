@@ -91,7 +91,7 @@ const api = {
                         window.location.href = '/login';
                     }
                 }
-                throw new Error(data.message || 'Request failed');
+                throw new Error(data.error || 'Request failed');
             }
 
             return data;
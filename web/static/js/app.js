@@ -14,8 +14,8 @@ document.addEventListener('DOMContentLoaded', async () => {
             // 有token，尝试验证
             try {
                 const profileResult = await api.auth.getProfile();
-                if (profileResult.success && profileResult.user) {
-                    const user = profileResult.user;
+                if (profileResult.success && profileResult.data.user) {
+                    const user = profileResult.data.user;
                     utils.setUser(user);
                     // 已登录，根据角色重定向
                     if (user.role_name === 'admin') {
@@ -46,11 +46,11 @@ document.addEventListener('DOMContentLoaded', async () => {
     // 验证token
     try {
         const profileResult = await api.auth.getProfile();
-        if (!profileResult.success || !profileResult.user) {
+        if (!profileResult.success || !profileResult.data.user) {
             throw new Error('Invalid token');
         }
         
-        const user = profileResult.user;
+        const user = profileResult.data.user;
         utils.setUser(user);
         
         // 如果访问admin页面，检查权限